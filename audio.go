@@ -0,0 +1,612 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1"
+)
+
+// flacStreamInfoLength is the size of the STREAMINFO metadata block body
+const flacStreamInfoLength = 34
+
+// parseFLACHeader extracts the sample rate and channel count from the STREAMINFO block of a FLAC stream.
+// FLAC streams start with the "fLaC" marker followed by a metadata block header whose
+// STREAMINFO body holds the sample rate (20 bits) and channel count minus one (3 bits) at byte 10.
+func parseFLACHeader(data []byte) (sampleRate int, channels int, err error) {
+	if len(data) < 4 || !bytes.Equal(data[:4], []byte("fLaC")) {
+		return 0, 0, errors.New("missing fLaC stream marker")
+	}
+	if len(data) < 8 {
+		return 0, 0, errors.New("truncated FLAC metadata block header")
+	}
+
+	blockType := data[4] & 0x7f
+	if blockType != 0 {
+		return 0, 0, errors.New("first FLAC metadata block is not STREAMINFO")
+	}
+	blockLength := int(binary.BigEndian.Uint32([]byte{0, data[5], data[6], data[7]}))
+	if blockLength < flacStreamInfoLength || len(data) < 8+flacStreamInfoLength {
+		return 0, 0, errors.New("truncated FLAC STREAMINFO block")
+	}
+
+	info := data[8 : 8+flacStreamInfoLength]
+	sampleRate = int(info[10])<<12 | int(info[11])<<4 | int(info[12])>>4
+	channels = int((info[12]>>1)&0x07) + 1
+	if sampleRate == 0 {
+		return 0, 0, errors.New("invalid FLAC sample rate")
+	}
+	return sampleRate, channels, nil
+}
+
+// opusFrameDurationsMicros maps each Opus TOC configuration number to its frame duration (RFC 6716, section 3.1)
+var opusFrameDurationsMicros = [32]int{
+	10000, 20000, 40000, 60000, // SILK NB
+	10000, 20000, 40000, 60000, // SILK MB
+	10000, 20000, 40000, 60000, // SILK WB
+	10000, 20000, // Hybrid SWB
+	10000, 20000, // Hybrid FB
+	2500, 5000, 10000, 20000, // CELT NB
+	2500, 5000, 10000, 20000, // CELT WB
+	2500, 5000, 10000, 20000, // CELT SWB
+	2500, 5000, 10000, 20000, // CELT FB
+}
+
+// opusMaxPacketDurationMicros is the longest audio duration a single Opus packet may carry
+const opusMaxPacketDurationMicros = 120000
+
+// opusFrameLength decodes a frame length coded in one or two bytes at the start of data (RFC 6716, section 3.2.1),
+// returning the length and the number of bytes it took
+func opusFrameLength(data []byte) (length, size int, ok bool) {
+	if len(data) < 1 {
+		return 0, 0, false
+	}
+	if data[0] < 252 {
+		return int(data[0]), 1, true
+	}
+	if len(data) < 2 {
+		return 0, 0, false
+	}
+	return int(data[1])*4 + int(data[0]), 2, true
+}
+
+// validateOpusPacket checks that data is a well-formed Opus packet.
+// It verifies the packet is not empty, that the table-of-contents byte describes a
+// frame layout the packet length can hold, and that the packet duration stays within 120ms.
+func validateOpusPacket(data []byte) error {
+	if len(data) < 1 {
+		return errors.New("empty Opus packet")
+	}
+
+	toc := data[0]
+	frameDuration := opusFrameDurationsMicros[toc>>3]
+	payload := len(data) - 1
+
+	switch toc & 0x03 {
+	case 0:
+		// One frame
+	case 1:
+		// Two frames of equal size
+		if payload%2 != 0 {
+			return errors.New("Opus packet with two equal frames has odd payload length")
+		}
+	case 2:
+		// Two frames of different sizes, the first size is coded in one or two bytes
+		firstLength, lengthBytes, ok := opusFrameLength(data[1:])
+		if !ok {
+			return errors.New("truncated Opus packet: missing frame length")
+		}
+		if firstLength > payload-lengthBytes {
+			return errors.New("truncated Opus packet: frame length exceeds packet")
+		}
+	case 3:
+		// Arbitrary number of frames, counted in the second byte along with the VBR and padding flags
+		if payload < 1 {
+			return errors.New("truncated Opus packet: missing frame count")
+		}
+		vbr, padded := data[1]&0x80 != 0, data[1]&0x40 != 0
+		frameCount := int(data[1] & 0x3f)
+		if frameCount == 0 {
+			return errors.New("Opus packet has zero frames")
+		}
+		if frameCount*frameDuration > opusMaxPacketDurationMicros {
+			return errors.New("Opus packet exceeds 120ms")
+		}
+		// rest holds the padding lengths and frame lengths still to read followed by the frames,
+		// the padding itself is trimmed off its end
+		rest := data[2:]
+		if padded {
+			padding := 0
+			for {
+				if len(rest) < 1 {
+					return errors.New("truncated Opus packet: missing padding length")
+				}
+				b := int(rest[0])
+				rest = rest[1:]
+				if b < 255 {
+					padding += b
+					break
+				}
+				padding += 254
+			}
+			if padding > len(rest) {
+				return errors.New("Opus packet padding exceeds packet")
+			}
+			rest = rest[:len(rest)-padding]
+		}
+		if !vbr {
+			if len(rest)%frameCount != 0 {
+				return errors.New("Opus packet with equal frames has a payload not divisible by the frame count")
+			}
+			break
+		}
+		// Every frame but the last has its length coded before the frames
+		total := 0
+		for i := 0; i < frameCount-1; i++ {
+			length, lengthBytes, ok := opusFrameLength(rest)
+			if !ok {
+				return errors.New("truncated Opus packet: missing frame length")
+			}
+			rest = rest[lengthBytes:]
+			total += length
+		}
+		if total > len(rest) {
+			return errors.New("truncated Opus packet: frame lengths exceed packet")
+		}
+	}
+	return nil
+}
+
+// audioRingBuffer keeps the audio chunks received within a sliding time window, or every chunk when the window is 0.
+// A non-zero maxBytes additionally drops the oldest chunks once the buffered audio exceeds it.
+type audioRingBuffer struct {
+	mu           sync.Mutex
+	window       time.Duration
+	maxBytes     int
+	size         int
+	droppedUntil time.Time // Receive time of the newest chunk dropped so far
+	chunks       []timedAudioChunk
+}
+
+// timedAudioChunk is an audio chunk with the time it was received
+type timedAudioChunk struct {
+	data       []byte
+	receivedAt time.Time
+}
+
+// newAudioRingBuffer creates a buffer keeping the last window of audio; a zero window keeps all audio
+func newAudioRingBuffer(window time.Duration) *audioRingBuffer {
+	return &audioRingBuffer{window: window}
+}
+
+// newRetainedAudioBuffer creates a buffer keeping the most recent maxBytes of audio regardless of age
+func newRetainedAudioBuffer(maxBytes int) *audioRingBuffer {
+	return &audioRingBuffer{maxBytes: maxBytes}
+}
+
+// Add appends a chunk and drops chunks older than the window or beyond maxBytes
+func (b *audioRingBuffer) Add(data []byte, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.chunks = append(b.chunks, timedAudioChunk{data: data, receivedAt: now})
+	b.size += len(data)
+	cutoff := now.Add(-b.window)
+	drop := 0
+	for drop < len(b.chunks) {
+		expired := b.window > 0 && b.chunks[drop].receivedAt.Before(cutoff)
+		oversized := b.maxBytes > 0 && b.size > b.maxBytes
+		if !expired && !oversized {
+			break
+		}
+		b.size -= len(b.chunks[drop].data)
+		b.droppedUntil = b.chunks[drop].receivedAt
+		drop++
+	}
+	b.chunks = b.chunks[drop:]
+}
+
+// Chunks returns the buffered chunks, oldest first
+func (b *audioRingBuffer) Chunks() [][]byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	chunks := make([][]byte, len(b.chunks))
+	for i, chunk := range b.chunks {
+		chunks[i] = chunk.data
+	}
+	return chunks
+}
+
+// Range concatenates the chunks received between from and to; complete is false when
+// chunks of the range have already been dropped, so the returned audio would be truncated
+func (b *audioRingBuffer) Range(from, to time.Time) (audio []byte, complete bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, chunk := range b.chunks {
+		if chunk.receivedAt.Before(from) || chunk.receivedAt.After(to) {
+			continue
+		}
+		audio = append(audio, chunk.data...)
+	}
+	return audio, b.droppedUntil.IsZero() || b.droppedUntil.Before(from)
+}
+
+// pendingAudioBuffer holds the audio received while no Speech-to-Text stream can take it, up to maxDuration.
+// Chunks whose duration cannot be computed from their encoding count for the time since the previous chunk.
+type pendingAudioBuffer struct {
+	mu          sync.Mutex
+	maxDuration time.Duration
+	chunks      []pendingAudioChunk
+	duration    time.Duration
+	startedAt   time.Time     // Time the oldest buffered chunk was received
+	dropped     time.Duration // Audio dropped since the buffer was last emptied
+}
+
+// pendingAudioChunk is a buffered audio chunk with its duration
+type pendingAudioChunk struct {
+	data       []byte
+	duration   time.Duration
+	receivedAt time.Time
+}
+
+// newPendingAudioBuffer creates a buffer keeping at most maxDuration of audio
+func newPendingAudioBuffer(maxDuration time.Duration) *pendingAudioBuffer {
+	return &pendingAudioBuffer{maxDuration: maxDuration}
+}
+
+// Add appends a chunk lasting duration (0 when unknown) and drops the oldest chunks beyond maxDuration,
+// returning the duration dropped. The newest chunk is always kept.
+func (b *pendingAudioBuffer) Add(data []byte, duration time.Duration, now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if duration <= 0 && len(b.chunks) > 0 {
+		duration = now.Sub(b.chunks[len(b.chunks)-1].receivedAt)
+	}
+	b.chunks = append(b.chunks, pendingAudioChunk{data: data, duration: duration, receivedAt: now})
+	b.duration += duration
+
+	drop := 0
+	var dropped time.Duration
+	for drop < len(b.chunks)-1 && b.duration-dropped > b.maxDuration {
+		dropped += b.chunks[drop].duration
+		drop++
+	}
+	if drop > 0 {
+		clear(b.chunks[:drop]) // Release the dropped audio
+		b.chunks = b.chunks[drop:]
+		b.duration -= dropped
+		b.dropped += dropped
+	}
+	b.startedAt = b.chunks[0].receivedAt
+	return dropped
+}
+
+// Take returns the buffered chunks, oldest first, and empties the buffer
+func (b *pendingAudioBuffer) Take() [][]byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	chunks := make([][]byte, len(b.chunks))
+	for i, chunk := range b.chunks {
+		chunks[i] = chunk.data
+	}
+	b.chunks, b.duration, b.startedAt, b.dropped = nil, 0, time.Time{}, 0
+	return chunks
+}
+
+// Bytes returns the size of the buffered audio
+func (b *pendingAudioBuffer) Bytes() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	size := 0
+	for _, chunk := range b.chunks {
+		size += len(chunk.data)
+	}
+	return size
+}
+
+// Dropped returns the duration of audio dropped since the buffer was last emptied
+func (b *pendingAudioBuffer) Dropped() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.dropped
+}
+
+// Duration returns the length of the buffered audio and the time its oldest chunk was received
+func (b *pendingAudioBuffer) Duration() (time.Duration, time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.duration, b.startedAt
+}
+
+// encodedAudioDuration computes the duration of an uncompressed LINEAR16 or MULAW chunk; it is 0 for other encodings
+func encodedAudioDuration(data []byte, encoding speechpb.RecognitionConfig_AudioEncoding, sampleRate, channels int) time.Duration {
+	switch encoding {
+	case speechpb.RecognitionConfig_LINEAR16:
+		return pcmDuration(data, sampleRate, channels)
+	case speechpb.RecognitionConfig_MULAW:
+		if sampleRate <= 0 {
+			return 0
+		}
+		frames := len(data) / max(channels, 1)
+		return time.Duration(frames) * time.Second / time.Duration(sampleRate)
+	}
+	return 0
+}
+
+// minAudioLevelDBFS is reported for digital silence, whose level is not finite
+const minAudioLevelDBFS = -120.0
+
+// audioLevelInterval is how often audio_level messages are sent for LINEAR16 sessions
+const audioLevelInterval = 500 * time.Millisecond
+
+// ComputeAudioLevel returns the root mean square level of 16-bit little-endian PCM samples in dBFS
+func ComputeAudioLevel(pcm []byte) (rmsDB float64) {
+	samples := len(pcm) / 2
+	if samples == 0 {
+		return minAudioLevelDBFS
+	}
+	var sumSquares float64
+	for i := 0; i < samples; i++ {
+		sample := float64(int16(binary.LittleEndian.Uint16(pcm[2*i:]))) / 32768
+		sumSquares += sample * sample
+	}
+	rms := math.Sqrt(sumSquares / float64(samples))
+	if rms == 0 {
+		return minAudioLevelDBFS
+	}
+	return max(20*math.Log10(rms), minAudioLevelDBFS)
+}
+
+// pcmDuration is the playback duration of 16-bit PCM audio
+func pcmDuration(pcm []byte, sampleRate, channels int) time.Duration {
+	if sampleRate <= 0 {
+		return 0
+	}
+	frames := len(pcm) / 2 / max(channels, 1)
+	return time.Duration(frames) * time.Second / time.Duration(sampleRate)
+}
+
+// vadThresholdDBFS is the level above which audio counts as speech (VAD_THRESHOLD_DBFS, default -40)
+func vadThresholdDBFS() float64 {
+	if value := os.Getenv("VAD_THRESHOLD_DBFS"); value != "" {
+		if threshold, err := strconv.ParseFloat(value, 64); err == nil {
+			return threshold
+		}
+		logger.Warn("Invalid VAD_THRESHOLD_DBFS, using default", "value", value)
+	}
+	return -40
+}
+
+// voiceActivityDetector classifies PCM chunks as speech or silence by their level
+// and meters the loudest level of each audioLevelInterval
+type voiceActivityDetector struct {
+	threshold       float64
+	speechDuration  time.Duration
+	audioDuration   time.Duration
+	silenceDuration time.Duration // Length of the current run of silence
+
+	windowStart  time.Time
+	windowPeak   float64
+	windowSpeech bool
+}
+
+// newVoiceActivityDetector creates a detector classifying levels above threshold dBFS as speech
+func newVoiceActivityDetector(threshold float64) *voiceActivityDetector {
+	return &voiceActivityDetector{threshold: threshold, windowPeak: minAudioLevelDBFS}
+}
+
+// Process classifies a chunk lasting duration and returns a meter reading once per audioLevelInterval
+func (d *voiceActivityDetector) Process(pcm []byte, duration time.Duration, now time.Time) *AudioLevelResponse {
+	level := ComputeAudioLevel(pcm)
+	isSpeech := level > d.threshold
+
+	d.audioDuration += duration
+	if isSpeech {
+		d.speechDuration += duration
+		d.silenceDuration = 0
+	} else {
+		d.silenceDuration += duration
+	}
+
+	if d.windowStart.IsZero() {
+		d.windowStart = now
+	}
+	d.windowPeak = max(d.windowPeak, level)
+	d.windowSpeech = d.windowSpeech || isSpeech
+	if now.Sub(d.windowStart) < audioLevelInterval {
+		return nil
+	}
+
+	reading := &AudioLevelResponse{
+		Type:      "audio_level",
+		RMSdBFS:   math.Round(d.windowPeak*10) / 10,
+		IsSpeech:  d.windowSpeech,
+		Timestamp: Timestamp{Time: now},
+	}
+	d.windowStart, d.windowPeak, d.windowSpeech = now, minAudioLevelDBFS, false
+	return reading
+}
+
+// Stats summarizes the speech detected so far
+func (d *voiceActivityDetector) Stats() AudioStatsResponse {
+	return AudioStatsResponse{
+		Type:                  "audio_stats",
+		SpeechDurationSeconds: d.speechDuration.Seconds(),
+		AudioDurationSeconds:  d.audioDuration.Seconds(),
+		Timestamp:             Timestamp{Time: time.Now()},
+	}
+}
+
+// downmixPCM averages the interleaved channels of 16-bit little-endian PCM into mono; a trailing partial frame is dropped
+func downmixPCM(data []byte, channels int) []byte {
+	if channels <= 1 {
+		return data
+	}
+	frameSize := 2 * channels
+	mono := make([]byte, len(data)/frameSize*2)
+	for frame := 0; frame < len(data)/frameSize; frame++ {
+		var sum int
+		for channel := 0; channel < channels; channel++ {
+			sum += int(int16(binary.LittleEndian.Uint16(data[frame*frameSize+2*channel:])))
+		}
+		binary.LittleEndian.PutUint16(mono[2*frame:], uint16(int16(sum/channels)))
+	}
+	return mono
+}
+
+// pcmDownmixer downmixes a stream of interleaved PCM chunks, carrying a partial frame split across chunks over to the next one
+type pcmDownmixer struct {
+	channels  int
+	remainder []byte
+}
+
+// newPCMDownmixer creates a downmixer for audio with the given number of interleaved channels
+func newPCMDownmixer(channels int) *pcmDownmixer {
+	return &pcmDownmixer{channels: channels}
+}
+
+// Downmix returns the mono audio for all complete frames seen so far and keeps any trailing partial frame for the next chunk
+func (d *pcmDownmixer) Downmix(data []byte) []byte {
+	if d.channels <= 1 {
+		return data
+	}
+	if len(d.remainder) > 0 {
+		data = append(d.remainder, data...)
+		d.remainder = nil
+	}
+	frameSize := 2 * d.channels
+	if partial := len(data) % frameSize; partial > 0 {
+		d.remainder = append([]byte(nil), data[len(data)-partial:]...)
+		data = data[:len(data)-partial]
+	}
+	return downmixPCM(data, d.channels)
+}
+
+// Sample rates accepted as resampling targets
+const (
+	minResampleHz = 8000
+	maxResampleHz = 48000
+)
+
+// pcmResampler converts a stream of 16-bit little-endian PCM chunks from fromHz to toHz by linear interpolation
+// between neighbouring frames. The interpolation position, the last frame and any partial frame are carried from
+// one chunk to the next, so chunk boundaries neither drop nor repeat samples. When downsampling, a low-pass
+// filter below the new Nyquist frequency runs first so higher frequencies do not alias into the speech band.
+type pcmResampler struct {
+	fromHz, toHz int
+	channels     int
+	step         float64    // Input frames per output frame
+	position     float64    // Input position of the next output frame; frame 0 is the last frame of the previous chunk
+	last         []float64  // Last filtered input frame of the previous chunk, nil before the first chunk
+	filters      [][]biquad // Low-pass filter sections per channel, nil when upsampling
+	remainder    []byte     // Trailing partial frame of the previous chunk
+}
+
+// newPCMResampler creates a resampler for interleaved audio with the given number of channels
+func newPCMResampler(fromHz, toHz, channels int) *pcmResampler {
+	channels = max(channels, 1)
+	r := &pcmResampler{fromHz: fromHz, toHz: toHz, channels: channels, step: float64(fromHz) / float64(toHz)}
+	if toHz < fromHz {
+		// Fourth-order Butterworth low-pass as two biquad sections, cut off a little below the new Nyquist frequency
+		cutoff := 0.45 * float64(toHz)
+		r.filters = make([][]biquad, channels)
+		for channel := range r.filters {
+			r.filters[channel] = []biquad{
+				newLowPassBiquad(float64(fromHz), cutoff, 0.5412),
+				newLowPassBiquad(float64(fromHz), cutoff, 1.3066),
+			}
+		}
+	}
+	return r
+}
+
+// Resample converts a chunk, returning the output frames that can be interpolated so far
+func (r *pcmResampler) Resample(data []byte) []byte {
+	if r.fromHz <= 0 || r.toHz <= 0 || r.fromHz == r.toHz {
+		return data
+	}
+	frameSize := 2 * r.channels
+	if len(r.remainder) > 0 {
+		data = append(r.remainder, data...)
+		r.remainder = nil
+	}
+	if partial := len(data) % frameSize; partial > 0 {
+		r.remainder = append([]byte(nil), data[len(data)-partial:]...)
+		data = data[:len(data)-partial]
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	// Filtered input frames, prefixed with the last frame of the previous chunk
+	var frames [][]float64
+	if r.last != nil {
+		frames = append(frames, r.last)
+	}
+	for offset := 0; offset < len(data); offset += frameSize {
+		frame := make([]float64, r.channels)
+		for channel := range frame {
+			value := float64(int16(binary.LittleEndian.Uint16(data[offset+2*channel:])))
+			if r.filters != nil {
+				for i := range r.filters[channel] {
+					value = r.filters[channel][i].Process(value)
+				}
+			}
+			frame[channel] = value
+		}
+		frames = append(frames, frame)
+	}
+
+	var out []byte
+	end := float64(len(frames) - 1)
+	for ; r.position < end; r.position += r.step {
+		index := int(r.position)
+		fraction := r.position - float64(index)
+		for channel := 0; channel < r.channels; channel++ {
+			value := frames[index][channel]*(1-fraction) + frames[index+1][channel]*fraction
+			out = binary.LittleEndian.AppendUint16(out, uint16(clampInt16(value)))
+		}
+	}
+	r.position -= end
+	r.last = frames[len(frames)-1]
+	return out
+}
+
+// clampInt16 rounds a sample to the nearest 16-bit value, saturating instead of wrapping
+func clampInt16(value float64) int16 {
+	return int16(max(math.MinInt16, min(math.MaxInt16, math.Round(value))))
+}
+
+// biquad is a second-order IIR filter section in direct form I
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+// newLowPassBiquad creates a low-pass section with the given cutoff and quality factor (Audio EQ Cookbook)
+func newLowPassBiquad(sampleRate, cutoff, q float64) biquad {
+	w0 := 2 * math.Pi * cutoff / sampleRate
+	alpha := math.Sin(w0) / (2 * q)
+	cos := math.Cos(w0)
+	a0 := 1 + alpha
+	return biquad{
+		b0: (1 - cos) / 2 / a0,
+		b1: (1 - cos) / a0,
+		b2: (1 - cos) / 2 / a0,
+		a1: -2 * cos / a0,
+		a2: (1 - alpha) / a0,
+	}
+}
+
+// Process filters one sample
+func (f *biquad) Process(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+	return y
+}
@@ -0,0 +1,577 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+// pcm encodes 16-bit samples as little-endian PCM
+func pcm(samples ...int16) []byte {
+	data := make([]byte, 2*len(samples))
+	for i, sample := range samples {
+		binary.LittleEndian.PutUint16(data[2*i:], uint16(sample))
+	}
+	return data
+}
+
+func TestDownmixPCM(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		channels int
+		want     []byte
+	}{
+		{"mono unchanged", pcm(1, 2, 3), 1, pcm(1, 2, 3)},
+		{"stereo average", pcm(100, 300, -100, -300), 2, pcm(200, -200)},
+		{"three channels", pcm(3, 6, 9), 3, pcm(6)},
+		{"partial frame dropped", append(pcm(10, 20), 0x01), 2, pcm(15)},
+		{"no overflow", pcm(32767, 32767), 2, pcm(32767)},
+		{"empty", nil, 2, []byte{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := downmixPCM(tt.data, tt.channels); !bytes.Equal(got, tt.want) {
+				t.Errorf("downmixPCM() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPCMDownmixerCarriesPartialFrames(t *testing.T) {
+	stereo := pcm(100, 300, -100, -300, 50, 150)
+	tests := []struct {
+		name   string
+		splits []int
+	}{
+		{"whole stream", nil},
+		{"split inside a sample", []int{3}},
+		{"split between channels", []int{2, 6}},
+		{"byte by byte", []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}},
+	}
+	want := pcm(200, -200, 100)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			downmixer := newPCMDownmixer(2)
+			var got []byte
+			start := 0
+			for _, end := range append(tt.splits, len(stereo)) {
+				got = append(got, downmixer.Downmix(stereo[start:end])...)
+				start = end
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("downmixed = %v, want %v", got, want)
+			}
+			if len(downmixer.remainder) != 0 {
+				t.Errorf("remainder = %v, want empty", downmixer.remainder)
+			}
+		})
+	}
+}
+
+func TestAudioRingBuffer(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+	tests := []struct {
+		name         string
+		buffer       *audioRingBuffer
+		adds         []int // Receive times in ms of 100-byte chunks
+		from, to     int
+		wantBytes    int
+		wantComplete bool
+	}{
+		{"keeps everything", newAudioRingBuffer(0), []int{0, 100, 200}, 0, 200, 300, true},
+		{"window drops old chunks", newAudioRingBuffer(150 * time.Millisecond), []int{0, 100, 200}, 0, 200, 200, false},
+		{"window range after drop", newAudioRingBuffer(150 * time.Millisecond), []int{0, 100, 200}, 100, 200, 200, true},
+		{"byte bound drops oldest", newRetainedAudioBuffer(250), []int{0, 100, 200}, 0, 200, 200, false},
+		{"byte bound keeps recent range", newRetainedAudioBuffer(250), []int{0, 100, 200}, 50, 200, 200, true},
+		{"range subset", newRetainedAudioBuffer(1000), []int{0, 100, 200, 300}, 100, 200, 200, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, ms := range tt.adds {
+				tt.buffer.Add(make([]byte, 100), at(ms))
+			}
+			audio, complete := tt.buffer.Range(at(tt.from), at(tt.to))
+			if len(audio) != tt.wantBytes || complete != tt.wantComplete {
+				t.Errorf("Range() = %d bytes, complete %v; want %d bytes, complete %v", len(audio), complete, tt.wantBytes, tt.wantComplete)
+			}
+		})
+	}
+}
+
+// tone generates a mono sine wave of the given frequency and amplitude
+func tone(sampleRate, frequency, frames int, amplitude float64) []byte {
+	samples := make([]int16, frames)
+	for i := range samples {
+		samples[i] = int16(amplitude * math.Sin(2*math.Pi*float64(frequency)*float64(i)/float64(sampleRate)))
+	}
+	return pcm(samples...)
+}
+
+// peak returns the largest absolute sample of mono PCM, skipping the first skip frames
+func peak(data []byte, skip int) float64 {
+	var largest float64
+	for i := 2 * skip; i+1 < len(data); i += 2 {
+		largest = max(largest, math.Abs(float64(int16(binary.LittleEndian.Uint16(data[i:])))))
+	}
+	return largest
+}
+
+func TestPCMResamplerChunking(t *testing.T) {
+	tests := []struct {
+		name         string
+		fromHz, toHz int
+		channels     int
+		chunkBytes   int
+	}{
+		{"downsample mono", 48000, 16000, 1, 320},
+		{"downsample odd ratio", 22050, 16000, 1, 441},
+		{"upsample mono", 8000, 16000, 1, 160},
+		{"downsample stereo uneven chunks", 44100, 16000, 2, 333},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := tone(tt.fromHz, 440, tt.fromHz/2*tt.channels, 8000)
+			whole := newPCMResampler(tt.fromHz, tt.toHz, tt.channels).Resample(input)
+
+			chunked := newPCMResampler(tt.fromHz, tt.toHz, tt.channels)
+			var output []byte
+			for start := 0; start < len(input); start += tt.chunkBytes {
+				output = append(output, chunked.Resample(input[start:min(start+tt.chunkBytes, len(input))])...)
+			}
+			if !bytes.Equal(output, whole) {
+				t.Fatalf("chunked output differs from one-shot output (%d vs %d bytes)", len(output), len(whole))
+			}
+
+			inFrames := len(input) / (2 * tt.channels)
+			wantFrames := inFrames * tt.toHz / tt.fromHz
+			// Output frames after the last input frame wait for the next chunk to interpolate
+			heldBack := tt.toHz/tt.fromHz + 1
+			if gotFrames := len(output) / (2 * tt.channels); gotFrames < wantFrames-heldBack || gotFrames > wantFrames+1 {
+				t.Errorf("output frames = %d, want about %d", gotFrames, wantFrames)
+			}
+		})
+	}
+}
+
+func TestPCMResamplerFiltersAliasing(t *testing.T) {
+	tests := []struct {
+		name        string
+		frequency   int
+		wantAtLeast float64
+		wantAtMost  float64
+	}{
+		{"speech band passes", 500, 7000, 8500},
+		{"above the new Nyquist is removed", 7000, 0, 800},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := tone(22050, tt.frequency, 22050, 8000)
+			output := newPCMResampler(22050, 8000, 1).Resample(input)
+			if got := peak(output, 800); got < tt.wantAtLeast || got > tt.wantAtMost {
+				t.Errorf("peak = %.0f, want between %.0f and %.0f", got, tt.wantAtLeast, tt.wantAtMost)
+			}
+		})
+	}
+}
+
+func TestPCMResamplerPassthrough(t *testing.T) {
+	input := pcm(1, 2, 3)
+	if got := newPCMResampler(16000, 16000, 1).Resample(input); !bytes.Equal(got, input) {
+		t.Errorf("Resample() at the same rate = %v, want input unchanged", got)
+	}
+}
+
+func TestPendingAudioBufferDrops(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		maxDuration time.Duration
+		chunks      int // 100-byte chunks of 100ms each
+		wantDropped time.Duration
+		wantBytes   int
+	}{
+		{"within the limit", time.Second, 5, 0, 500},
+		{"oldest dropped", 300 * time.Millisecond, 5, 200 * time.Millisecond, 300},
+		{"newest chunk always kept", 50 * time.Millisecond, 2, 100 * time.Millisecond, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buffer := newPendingAudioBuffer(tt.maxDuration)
+			var dropped time.Duration
+			for i := 0; i < tt.chunks; i++ {
+				dropped += buffer.Add(make([]byte, 100), 100*time.Millisecond, start.Add(time.Duration(i)*100*time.Millisecond))
+			}
+			if dropped != tt.wantDropped || buffer.Dropped() != tt.wantDropped {
+				t.Errorf("dropped = %v (Dropped() = %v), want %v", dropped, buffer.Dropped(), tt.wantDropped)
+			}
+			if got := buffer.Bytes(); got != tt.wantBytes {
+				t.Errorf("Bytes() = %d, want %d", got, tt.wantBytes)
+			}
+			if chunks := buffer.Take(); len(bytes.Join(chunks, nil)) != tt.wantBytes {
+				t.Errorf("Take() returned %d bytes, want %d", len(bytes.Join(chunks, nil)), tt.wantBytes)
+			}
+			if buffer.Bytes() != 0 || buffer.Dropped() != 0 {
+				t.Errorf("after Take: Bytes() = %d, Dropped() = %v; want an empty buffer", buffer.Bytes(), buffer.Dropped())
+			}
+		})
+	}
+}
+
+func TestPendingAudioBufferStart(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name         string
+		duration     time.Duration // Of each chunk, 0 for compressed audio
+		chunks       int           // Received every 20ms
+		wantDuration time.Duration
+		wantStart    time.Time
+	}{
+		{"known durations", 20 * time.Millisecond, 5, 100 * time.Millisecond, start},
+		{"durations from arrival times", 0, 5, 80 * time.Millisecond, start},
+		{"start moves with dropped chunks", 20 * time.Millisecond, 10, 100 * time.Millisecond, start.Add(100 * time.Millisecond)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buffer := newPendingAudioBuffer(100 * time.Millisecond)
+			for i := 0; i < tt.chunks; i++ {
+				buffer.Add(make([]byte, 80), tt.duration, start.Add(time.Duration(i)*20*time.Millisecond))
+			}
+			duration, startedAt := buffer.Duration()
+			if duration != tt.wantDuration || !startedAt.Equal(tt.wantStart) {
+				t.Errorf("Duration() = %v, %v, want %v, %v", duration, startedAt, tt.wantDuration, tt.wantStart)
+			}
+		})
+	}
+}
+
+// BenchmarkPendingAudioBuffer measures the buffering overhead for 20ms chunks: 80-byte Opus frames
+// (32 kbit/s) and 640-byte LINEAR16 frames (16 kHz mono), with the buffer full so every Add drops a chunk
+func BenchmarkPendingAudioBuffer(b *testing.B) {
+	const chunkDuration = 20 * time.Millisecond
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, size := range []int{80, 640} {
+		chunk := make([]byte, size)
+		b.Run(fmt.Sprintf("Add/%dB", size), func(b *testing.B) {
+			buffer := newPendingAudioBuffer(2 * time.Second)
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				buffer.Add(chunk, chunkDuration, start.Add(time.Duration(i)*chunkDuration))
+			}
+		})
+		// A stream recreation: 2s of audio buffered, then replayed
+		b.Run(fmt.Sprintf("AddTake/%dB", size), func(b *testing.B) {
+			buffer := newPendingAudioBuffer(2 * time.Second)
+			b.SetBytes(int64(size) * 100)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for j := 0; j < 100; j++ {
+					buffer.Add(chunk, chunkDuration, start.Add(time.Duration(j)*chunkDuration))
+				}
+				buffer.Take()
+			}
+		})
+	}
+}
+
+func TestComputeAudioLevel(t *testing.T) {
+	tests := []struct {
+		name string
+		pcm  []byte
+		want float64
+	}{
+		{"empty", nil, minAudioLevelDBFS},
+		{"digital silence", pcm(0, 0, 0, 0), minAudioLevelDBFS},
+		{"full scale square wave", pcm(-32768, -32768, -32768), 0},
+		{"half scale", pcm(16384, -16384, 16384, -16384), -6.0206},
+		{"full scale sine", tone(16000, 1000, 1600, 32767), -3.0104},
+		{"quietest sample", pcm(1, -1), -90.309},
+		{"trailing odd byte ignored", append(pcm(16384, -16384), 0x7f), -6.0206},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ComputeAudioLevel(tt.pcm); math.Abs(got-tt.want) > 0.01 {
+				t.Errorf("ComputeAudioLevel() = %.4f dBFS, want %.4f", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPCMDuration(t *testing.T) {
+	tests := []struct {
+		name       string
+		bytes      int
+		sampleRate int
+		channels   int
+		want       time.Duration
+	}{
+		{"mono 16 kHz", 32000, 16000, 1, time.Second},
+		{"stereo 16 kHz", 32000, 16000, 2, 500 * time.Millisecond},
+		{"channels default to mono", 3200, 16000, 0, 100 * time.Millisecond},
+		{"unknown sample rate", 3200, 0, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pcmDuration(make([]byte, tt.bytes), tt.sampleRate, tt.channels); got != tt.want {
+				t.Errorf("pcmDuration() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVADThresholdDBFS(t *testing.T) {
+	tests := []struct {
+		value string
+		want  float64
+	}{
+		{"", -40},
+		{"-55.5", -55.5},
+		{"loud", -40},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("VAD_THRESHOLD_DBFS", tt.value)
+			if got := vadThresholdDBFS(); got != tt.want {
+				t.Errorf("vadThresholdDBFS() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVoiceActivityDetector(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	speech := tone(16000, 300, 1600, 8000) // About -15 dBFS
+	quiet := tone(16000, 300, 1600, 50)    // About -59 dBFS
+	const chunk = 100 * time.Millisecond
+
+	detector := newVoiceActivityDetector(-40)
+	var readings []*AudioLevelResponse
+	// 300ms of speech followed by 900ms of silence, in 100ms chunks
+	for i := 0; i < 12; i++ {
+		data := quiet
+		if i < 3 {
+			data = speech
+		}
+		if reading := detector.Process(data, chunk, start.Add(time.Duration(i)*chunk)); reading != nil {
+			readings = append(readings, reading)
+		}
+	}
+
+	if len(readings) != 2 {
+		t.Fatalf("got %d readings over 1.2s, want one per 500ms", len(readings))
+	}
+	if !readings[0].IsSpeech || readings[0].RMSdBFS < -16 || readings[0].RMSdBFS > -14 {
+		t.Errorf("first reading = %+v, want speech at about -15 dBFS", readings[0])
+	}
+	if readings[1].IsSpeech || readings[1].RMSdBFS > -40 {
+		t.Errorf("second reading = %+v, want silence", readings[1])
+	}
+	if detector.silenceDuration != 900*time.Millisecond {
+		t.Errorf("silence duration = %s, want 900ms", detector.silenceDuration)
+	}
+
+	stats := detector.Stats()
+	if stats.SpeechDurationSeconds != 0.3 || math.Abs(stats.AudioDurationSeconds-1.2) > 1e-9 {
+		t.Errorf("stats = %+v, want 0.3s of speech in 1.2s of audio", stats)
+	}
+
+	// Speech ends the silence run
+	detector.Process(speech, chunk, start.Add(1200*time.Millisecond))
+	if detector.silenceDuration != 0 {
+		t.Errorf("silence duration after speech = %s, want 0", detector.silenceDuration)
+	}
+}
+
+func TestPCMResamplerKnownValues(t *testing.T) {
+	t.Run("upsampling interpolates midpoints", func(t *testing.T) {
+		got := newPCMResampler(8000, 16000, 1).Resample(pcm(0, 100, -100, 1000))
+		if want := pcm(0, 50, 100, 0, -100, 450); !bytes.Equal(got, want) {
+			t.Errorf("Resample() = %v, want %v", got, want)
+		}
+	})
+
+	tests := []struct {
+		name   string
+		fromHz int
+	}{
+		{"44100 to 16000", 44100},
+		{"22050 to 16000", 22050},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+" DC", func(t *testing.T) {
+			samples := make([]int16, tt.fromHz/10)
+			for i := range samples {
+				samples[i] = 1000
+			}
+			output := newPCMResampler(tt.fromHz, 16000, 1).Resample(pcm(samples...))
+			// The low-pass filter has unity gain at DC once it settles
+			for i := 800; 2*i+1 < len(output); i++ {
+				if got := int16(binary.LittleEndian.Uint16(output[2*i:])); got != 1000 {
+					t.Fatalf("frame %d = %d, want 1000", i, got)
+				}
+			}
+		})
+		t.Run(tt.name+" 200 Hz tone", func(t *testing.T) {
+			const frequency, amplitude = 200.0, 10000.0
+			output := newPCMResampler(tt.fromHz, 16000, 1).Resample(tone(tt.fromHz, frequency, tt.fromHz, amplitude))
+			if frames := len(output) / 2; frames < 15998 || frames > 16000 {
+				t.Errorf("output frames = %d, want about 16000 for one second", frames)
+			}
+			// The tone keeps its level and its frequency: 400 zero crossings per second
+			if got := peak(output, 800); math.Abs(got-amplitude) > 0.01*amplitude {
+				t.Errorf("peak = %.0f, want %.0f", got, amplitude)
+			}
+			crossings := 0
+			previous := int16(binary.LittleEndian.Uint16(output[1600:]))
+			for i := 801; 2*i+1 < len(output); i++ {
+				sample := int16(binary.LittleEndian.Uint16(output[2*i:]))
+				if (previous < 0) != (sample < 0) {
+					crossings++
+				}
+				previous = sample
+			}
+			if want := 2 * frequency * float64(len(output)/2-800) / 16000; math.Abs(float64(crossings)-want) > 1 {
+				t.Errorf("zero crossings = %d, want %.0f", crossings, want)
+			}
+		})
+	}
+}
+
+// flacHeader builds a FLAC stream marker and a 16-bit STREAMINFO block for the sample rate and channels
+func flacHeader(sampleRate, channels int) []byte {
+	info := make([]byte, flacStreamInfoLength)
+	binary.BigEndian.PutUint16(info[0:], 4096) // Minimum block size
+	binary.BigEndian.PutUint16(info[2:], 4096) // Maximum block size
+	info[10] = byte(sampleRate >> 12)
+	info[11] = byte(sampleRate >> 4)
+	info[12] = byte(sampleRate<<4) | byte(channels-1)<<1 // Bits per sample minus one is 15; its top bit is 0
+	info[13] = 0xf0
+	header := []byte{0x80, 0, 0, flacStreamInfoLength} // Last metadata block, STREAMINFO
+	return append(append([]byte("fLaC"), header...), info...)
+}
+
+func TestParseFLACHeader(t *testing.T) {
+	tests := []struct {
+		name           string
+		data           []byte
+		wantSampleRate int
+		wantChannels   int
+		wantErr        bool
+	}{
+		{"16 kHz mono", flacHeader(16000, 1), 16000, 1, false},
+		{"48 kHz stereo", flacHeader(48000, 2), 48000, 2, false},
+		{"44.1 kHz with 8 channels", flacHeader(44100, 8), 44100, 8, false},
+		{"followed by audio frames", append(flacHeader(16000, 1), 0xff, 0xf8, 0x69, 0x08), 16000, 1, false},
+		{"empty", nil, 0, 0, true},
+		{"bad magic", append([]byte("OggS"), flacHeader(16000, 1)[4:]...), 0, 0, true},
+		{"truncated block header", flacHeader(16000, 1)[:6], 0, 0, true},
+		{"truncated STREAMINFO", flacHeader(16000, 1)[:20], 0, 0, true},
+		{"first block is not STREAMINFO", append([]byte("fLaC\x84"), flacHeader(16000, 1)[5:]...), 0, 0, true},
+		{"zero sample rate", flacHeader(0, 1), 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sampleRate, channels, err := parseFLACHeader(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseFLACHeader() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if sampleRate != tt.wantSampleRate || channels != tt.wantChannels {
+				t.Errorf("parseFLACHeader() = %d Hz, %d channels, want %d Hz, %d channels", sampleRate, channels, tt.wantSampleRate, tt.wantChannels)
+			}
+		})
+	}
+}
+
+// opusTOC builds an Opus table-of-contents byte for a configuration number and frame count code
+func opusTOC(config, code byte) byte {
+	return config<<3 | code
+}
+
+func TestValidateOpusPacket(t *testing.T) {
+	frames := func(n int) []byte { return bytes.Repeat([]byte{0xaa}, n) }
+	packet := func(head []byte, tail ...[]byte) []byte {
+		for _, part := range tail {
+			head = append(head, part...)
+		}
+		return head
+	}
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{"empty", nil, true},
+		{"code 0 single frame", packet([]byte{opusTOC(1, 0)}, frames(40)), false},
+		{"code 0 TOC only", []byte{opusTOC(1, 0)}, false},
+		{"code 1 equal frames", packet([]byte{opusTOC(1, 1)}, frames(40)), false},
+		{"code 1 odd payload", packet([]byte{opusTOC(1, 1)}, frames(41)), true},
+		{"code 2 one-byte length", packet([]byte{opusTOC(1, 2), 10}, frames(25)), false},
+		{"code 2 two-byte length", packet([]byte{opusTOC(1, 2), 252, 1}, frames(256)), false},
+		{"code 2 missing length", []byte{opusTOC(1, 2)}, true},
+		{"code 2 truncated two-byte length", []byte{opusTOC(1, 2), 252}, true},
+		{"code 2 length exceeds packet", packet([]byte{opusTOC(1, 2), 10}, frames(9)), true},
+		{"code 2 two-byte length exceeds packet", packet([]byte{opusTOC(1, 2), 252, 1}, frames(255)), true},
+		{"code 3 missing frame count", []byte{opusTOC(1, 3)}, true},
+		{"code 3 zero frames", []byte{opusTOC(1, 3), 0x00}, true},
+		{"code 3 equal frames", packet([]byte{opusTOC(1, 3), 0x03}, frames(30)), false},
+		{"code 3 equal frames not divisible", packet([]byte{opusTOC(1, 3), 0x03}, frames(31)), true},
+		{"code 3 at 120ms", packet([]byte{opusTOC(1, 3), 0x06}, frames(6)), false},
+		{"code 3 over 120ms", packet([]byte{opusTOC(1, 3), 0x07}, frames(7)), true},
+		{"code 3 maximum frame count", []byte{opusTOC(1, 3), 0x3f}, true},
+		{"code 3 padding", packet([]byte{opusTOC(1, 3), 0x41, 2}, frames(12)), false},
+		{"code 3 padding continued", packet([]byte{opusTOC(1, 3), 0x41, 255, 3}, frames(257)), false},
+		{"code 3 padding overflow", packet([]byte{opusTOC(1, 3), 0x41, 20}, frames(10)), true},
+		{"code 3 continued padding overflow", packet([]byte{opusTOC(1, 3), 0x41, 255, 1}, frames(254)), true},
+		{"code 3 missing padding length", []byte{opusTOC(1, 3), 0x41}, true},
+		{"code 3 truncated padding length", []byte{opusTOC(1, 3), 0x41, 255}, true},
+		{"code 3 padding leaves frames not divisible", packet([]byte{opusTOC(1, 3), 0x42, 1}, frames(6)), true},
+		{"code 3 variable frames", packet([]byte{opusTOC(1, 3), 0x83, 5, 7}, frames(20)), false},
+		{"code 3 variable frames two-byte length", packet([]byte{opusTOC(1, 3), 0x82, 253, 0}, frames(260)), false},
+		{"code 3 variable frames with padding", packet([]byte{opusTOC(1, 3), 0xc2, 3, 4}, frames(7)), false},
+		{"code 3 missing frame lengths", []byte{opusTOC(1, 3), 0x83, 5}, true},
+		{"code 3 truncated two-byte frame length", []byte{opusTOC(1, 3), 0x82, 253}, true},
+		{"code 3 frame lengths exceed packet", packet([]byte{opusTOC(1, 3), 0x83, 5, 7}, frames(11)), true},
+		{"code 3 frame lengths exceed packet after padding", packet([]byte{opusTOC(1, 3), 0xc2, 3, 4}, frames(6)), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateOpusPacket(tt.data); (err != nil) != tt.wantErr {
+				t.Errorf("validateOpusPacket(% x) error = %v, wantErr %v", tt.data, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateOpusPacketDurations(t *testing.T) {
+	for config := byte(0); config < 32; config++ {
+		maxFrames := byte(opusMaxPacketDurationMicros / opusFrameDurationsMicros[config])
+		if err := validateOpusPacket([]byte{opusTOC(config, 3), maxFrames}); err != nil {
+			t.Errorf("config %d with %d frames: %v", config, maxFrames, err)
+		}
+		if maxFrames < 0x3f {
+			if err := validateOpusPacket([]byte{opusTOC(config, 3), maxFrames + 1}); err == nil {
+				t.Errorf("config %d with %d frames accepted, want an error over 120ms", config, maxFrames+1)
+			}
+		}
+	}
+}
+
+func TestValidateOpusPacketNoPanic(t *testing.T) {
+	// Every two-byte packet, then every third byte after each code 2 and code 3 header
+	for first := 0; first < 256; first++ {
+		for second := 0; second < 256; second++ {
+			validateOpusPacket([]byte{byte(first), byte(second)})
+			if first&0x03 < 2 {
+				continue
+			}
+			for third := 0; third < 256; third++ {
+				validateOpusPacket([]byte{byte(first), byte(second), byte(third)})
+			}
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// auditedHeaders are the only request headers copied into audit records
+var auditedHeaders = []string{
+	"Accept-Language",
+	"Origin",
+	"Sec-WebSocket-Extensions",
+	"Sec-WebSocket-Protocol",
+	"Sec-WebSocket-Version",
+	"User-Agent",
+	"X-Forwarded-For",
+	"X-Forwarded-Proto",
+}
+
+// AuditLogger writes one JSON line per WebSocket connection attempt, separately from the application log
+type AuditLogger struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// auditLogger records WebSocket connection attempts; set by initAuditLogger. Without AUDIT_LOG_FILE it writes to
+// stderr, apart from the application log on stdout
+var auditLogger = NewAuditLogger(os.Stderr)
+
+// NewAuditLogger creates an audit logger writing to w
+func NewAuditLogger(w io.Writer) *AuditLogger {
+	return &AuditLogger{w: w}
+}
+
+// Log writes the record as a single JSON line
+func (a *AuditLogger) Log(record AuditRecord) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		logger.Error("Failed to marshal audit record", "error", err)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.w.Write(append(data, '\n')); err != nil {
+		logger.Error("Failed to write audit record", "error", err)
+	}
+}
+
+// newAuditRecord describes a connection attempt from the upgrade request
+func newAuditRecord(r *http.Request, sessionID, authResult string) AuditRecord {
+	record := AuditRecord{
+		Timestamp:      time.Now(),
+		RemoteIP:       clientIP(r),
+		UserAgent:      r.UserAgent(),
+		Origin:         r.Header.Get("Origin"),
+		SessionID:      sessionID,
+		AuthResult:     authResult,
+		RequestHeaders: map[string]string{},
+	}
+	if r.TLS != nil {
+		record.TLSVersion = tls.VersionName(r.TLS.Version)
+	}
+	for _, name := range auditedHeaders {
+		if value := r.Header.Get(name); value != "" {
+			record.RequestHeaders[name] = value
+		}
+	}
+	return record
+}
+
+// initAuditLogger directs audit records to AUDIT_LOG_FILE, or stderr when unset
+func initAuditLogger() {
+	auditLogger = NewAuditLogger(os.Stderr)
+	path := os.Getenv("AUDIT_LOG_FILE")
+	if path == "" {
+		logger.Warn("AUDIT_LOG_FILE not set, writing audit records to stderr")
+		return
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		logger.Error("Failed to open audit log file, writing audit records to stderr", "path", path, "error", err)
+		return
+	}
+	auditLogger = NewAuditLogger(file)
+	logger.Info("Audit log enabled", "path", path)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInitAuditLogger(t *testing.T) {
+	previous := auditLogger
+	t.Cleanup(func() { auditLogger = previous })
+	dir := t.TempDir()
+	tests := []struct {
+		name       string
+		path       string
+		wantStderr bool
+	}{
+		{"unset", "", true},
+		{"file", filepath.Join(dir, "audit.jsonl"), false},
+		{"unopenable file", filepath.Join(dir, "missing", "audit.jsonl"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("AUDIT_LOG_FILE", tt.path)
+			initAuditLogger()
+			if got := auditLogger.w == os.Stderr; got != tt.wantStderr {
+				t.Fatalf("audit records written to stderr = %v, want %v", got, tt.wantStderr)
+			}
+			if tt.wantStderr {
+				return
+			}
+			auditLogger.Log(newAuditRecord(httptest.NewRequest("GET", "/ws", nil), "session", "success"))
+			data, err := os.ReadFile(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(data), `"authResult":"success"`) {
+				t.Errorf("audit log = %s, want the record", data)
+			}
+		})
+	}
+}
+
+func TestWebSocketAuditRecords(t *testing.T) {
+	var buffer bytes.Buffer
+	previous := auditLogger
+	auditLogger = NewAuditLogger(&buffer)
+	t.Cleanup(func() { auditLogger = previous })
+	// lastRecord returns the most recent audit record, read under the logger's lock since sessions write concurrently
+	lastRecord := func(t *testing.T) AuditRecord {
+		t.Helper()
+		auditLogger.mu.Lock()
+		defer auditLogger.mu.Unlock()
+		lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+		var record AuditRecord
+		if err := json.Unmarshal([]byte(lines[len(lines)-1]), &record); err != nil {
+			t.Fatalf("audit log %q: %v", buffer.String(), err)
+		}
+		buffer.Reset()
+		return record
+	}
+	header := http.Header{
+		"Origin":        {"https://app.example.com"},
+		"User-Agent":    {"desktop/1.2"},
+		"Authorization": {"Bearer secret"},
+	}
+
+	t.Run("accepted", func(t *testing.T) {
+		newFakeSpeechPool(t)
+		conn := dialWebSocket(t, header)
+		if err := conn.WriteJSON(ConfigMessage{AudioFormat: AudioFormat{Format: "LINEAR16", SampleRate: 16000, Channels: 1}, LanguageCode: "en-US"}); err != nil {
+			t.Fatal(err)
+		}
+		started := readUntil(t, conn, "status", "session_started")
+		record := lastRecord(t)
+		if record.AuthResult != "success" || record.SessionID != started["sessionID"] {
+			t.Errorf("record = %+v, want a success for session %v", record, started["sessionID"])
+		}
+		if record.Origin != "https://app.example.com" || record.UserAgent != "desktop/1.2" || record.RemoteIP != "127.0.0.1" || record.Timestamp.IsZero() {
+			t.Errorf("record = %+v, want the client's origin, user agent, IP and a timestamp", record)
+		}
+		if _, ok := record.RequestHeaders["Authorization"]; ok || record.RequestHeaders["Sec-WebSocket-Version"] != "13" {
+			t.Errorf("request headers = %v, want only allowlisted headers", record.RequestHeaders)
+		}
+	})
+
+	t.Run("rejected configuration", func(t *testing.T) {
+		conn := dialWebSocket(t, header)
+		if err := conn.WriteJSON(ConfigMessage{AudioFormat: AudioFormat{Format: "LINEAR16", SampleRate: 16000, Channels: 1}, LanguageCode: "en-US", TimestampFormat: "iso"}); err != nil {
+			t.Fatal(err)
+		}
+		readUntil(t, conn, "status", "config_error")
+		record := lastRecord(t)
+		if !strings.HasPrefix(record.AuthResult, "failure: invalid timestampFormat") || record.SessionID == "" {
+			t.Errorf("record = %+v, want a timestampFormat failure for the rejected session", record)
+		}
+	})
+
+	t.Run("failed upgrade", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+		r.Header.Set("User-Agent", "curl/8.0")
+		handleWebSocket(httptest.NewRecorder(), r)
+		record := lastRecord(t)
+		if !strings.HasPrefix(record.AuthResult, "failure: upgrade failed") || record.SessionID != "" || record.UserAgent != "curl/8.0" {
+			t.Errorf("record = %+v, want an upgrade failure without a session", record)
+		}
+	})
+}
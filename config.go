@@ -0,0 +1,427 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/genai"
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1"
+)
+
+// getEnvInt64 reads an integer environment variable, returning def when unset or invalid
+func getEnvInt64(name string, def int64) int64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		logger.Warn("Invalid integer environment variable, using default",
+			"name", name,
+			"value", value,
+			"default", def)
+		return def
+	}
+	return parsed
+}
+
+// getEnvDuration reads a duration environment variable (e.g. "5m"), returning def when unset or invalid
+func getEnvDuration(name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		logger.Warn("Invalid duration environment variable, using default",
+			"name", name,
+			"value", value,
+			"default", def)
+		return def
+	}
+	return parsed
+}
+
+// Default alternative language codes per primary language, loaded from LANGUAGE_ALTERNATIVES
+var languageAlternatives map[string][]string
+
+// loadLanguageAlternatives parses the LANGUAGE_ALTERNATIVES JSON map, e.g. {"en-US":["fr-FR","es-ES"],"fr-FR":["en-US"]}
+func loadLanguageAlternatives() {
+	value := os.Getenv("LANGUAGE_ALTERNATIVES")
+	if value == "" {
+		return
+	}
+
+	var alternatives map[string][]string
+	if err := json.Unmarshal([]byte(value), &alternatives); err != nil {
+		logger.Error("Invalid LANGUAGE_ALTERNATIVES, using built-in defaults", "error", err)
+		return
+	}
+
+	languageAlternatives = alternatives
+	logger.Info("Language alternatives loaded", "languages", len(alternatives))
+}
+
+// defaultAlternativeLanguages returns the default alternative language codes for a primary language
+func defaultAlternativeLanguages(primaryLanguage string) []string {
+	if alternatives, ok := languageAlternatives[primaryLanguage]; ok {
+		return alternatives
+	}
+	if primaryLanguage == "en-US" {
+		return []string{"fr-FR", "es-ES"} // Built-in fallback when no mapping is configured
+	}
+	return nil
+}
+
+// ConfigError describes an invalid value in the client configuration message
+type ConfigError struct {
+	Field   string
+	Message string
+}
+
+// Error implements the error interface
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Field, e.Message)
+}
+
+// allowedGeminiModels returns the models clients may request, from GEMINI_ALLOWED_MODELS
+func allowedGeminiModels() []string {
+	value := os.Getenv("GEMINI_ALLOWED_MODELS")
+	if value == "" {
+		value = "gemini-2.5-flash,gemini-2.5-pro"
+	}
+
+	var models []string
+	for _, model := range strings.Split(value, ",") {
+		if model = strings.TrimSpace(model); model != "" {
+			models = append(models, model)
+		}
+	}
+	return models
+}
+
+// selectGeminiModel returns the requested model when it is allowed, or defaultModel when none is requested
+func selectGeminiModel(requested, defaultModel string, allowed []string) (string, error) {
+	if requested == "" {
+		return defaultModel, nil
+	}
+	for _, model := range allowed {
+		if model == requested {
+			return requested, nil
+		}
+	}
+	return "", &ConfigError{
+		Field:   "geminiModel",
+		Message: fmt.Sprintf("model %q is not allowed (allowed: %s)", requested, strings.Join(allowed, ", ")),
+	}
+}
+
+// selectAutoPunctuateModel validates the Gemini model requested for punctuation; an empty value selects rule-based punctuation
+func selectAutoPunctuateModel(requested string, allowed []string) (string, error) {
+	model, err := selectGeminiModel(requested, "", allowed)
+	if configErr, ok := err.(*ConfigError); ok {
+		configErr.Field = "autoPunctuateModel"
+	}
+	return model, err
+}
+
+// selectGeminiFallbackModel validates the Gemini model used when the summary model is out of quota; an empty value disables the fallback
+func selectGeminiFallbackModel(requested string, allowed []string) (string, error) {
+	model, err := selectGeminiModel(requested, "", allowed)
+	if configErr, ok := err.(*ConfigError); ok {
+		configErr.Field = "geminiFallbackModel"
+	}
+	return model, err
+}
+
+// sessionDurationUnit is the unit of maxSessionDurationMinutes and MAX_SESSION_DURATION_MINUTES, shortened in tests
+var sessionDurationUnit = time.Minute
+
+// silenceTimeoutUnit is the unit of SILENCE_TIMEOUT_SECONDS and inactivityWarningSeconds, shortened in tests
+var silenceTimeoutUnit = time.Second
+
+// defaultInactivityWarningSeconds is how long before the silence timeout clients are warned by default
+const defaultInactivityWarningSeconds = 30
+
+// selectInactivityWarning returns how long before silenceTimeout clients are warned (0 = no warning). The default
+// warning falls back to half of a shorter timeout, while a requested warning of at least the timeout is rejected
+// since it would fire as soon as the session goes quiet.
+func selectInactivityWarning(requestedSeconds int, silenceTimeout time.Duration) (time.Duration, error) {
+	if silenceTimeout <= 0 || requestedSeconds < 0 {
+		return 0, nil
+	}
+	if requestedSeconds == 0 {
+		return min(defaultInactivityWarningSeconds*silenceTimeoutUnit, silenceTimeout/2), nil
+	}
+	warning := time.Duration(requestedSeconds) * silenceTimeoutUnit
+	if warning >= silenceTimeout {
+		return 0, &ConfigError{
+			Field:   "inactivityWarningSeconds",
+			Message: fmt.Sprintf("warning of %ds must be shorter than the %s silence timeout", requestedSeconds, silenceTimeout),
+		}
+	}
+	return warning, nil
+}
+
+// effectiveMaxSessionDuration combines the client requested limit with the server-wide ceiling, both in minutes;
+// 0 means unlimited and the ceiling always wins
+func effectiveMaxSessionDuration(requestedMinutes int, ceilingMinutes int64) time.Duration {
+	minutes := int64(requestedMinutes)
+	if minutes <= 0 || (ceilingMinutes > 0 && minutes > ceilingMinutes) {
+		minutes = ceilingMinutes
+	}
+	if minutes < 0 {
+		return 0
+	}
+	return time.Duration(minutes) * sessionDurationUnit
+}
+
+// Summary formats selectable with summaryFormat in the config message
+const (
+	summaryFormatMarkdown = "markdown"
+	summaryFormatJSON     = "json"
+)
+
+// selectSummaryFormat validates the requested summary format; an empty value selects Markdown
+func selectSummaryFormat(requested string) (string, error) {
+	switch requested {
+	case "", summaryFormatMarkdown:
+		return summaryFormatMarkdown, nil
+	case summaryFormatJSON:
+		return summaryFormatJSON, nil
+	}
+	return "", &ConfigError{
+		Field:   "summaryFormat",
+		Message: fmt.Sprintf("unknown format %q (expected %s or %s)", requested, summaryFormatMarkdown, summaryFormatJSON),
+	}
+}
+
+// Timestamp formats selectable with timestampFormat in the config message
+const (
+	timestampFormatRFC3339  = "rfc3339"
+	timestampFormatUnixMs   = "unix_ms"
+	timestampFormatRelative = "relative" // Milliseconds since the session started
+)
+
+// selectTimestampFormat validates the requested timestamp format; an empty value selects RFC 3339
+func selectTimestampFormat(requested string) (string, error) {
+	switch requested {
+	case "", timestampFormatRFC3339:
+		return timestampFormatRFC3339, nil
+	case timestampFormatUnixMs, timestampFormatRelative:
+		return requested, nil
+	}
+	return "", &ConfigError{
+		Field: "timestampFormat",
+		Message: fmt.Sprintf("unknown format %q (expected %s, %s or %s)",
+			requested, timestampFormatRFC3339, timestampFormatUnixMs, timestampFormatRelative),
+	}
+}
+
+// Stream recreation strategies selectable with streamRecreationStrategy in the config message
+const (
+	// streamRecreationFullRestart closes the current stream before opening the next one
+	streamRecreationFullRestart = "full_restart"
+	// streamRecreationSeamless opens the next stream alongside the current one and switches once it answers
+	streamRecreationSeamless = "seamless"
+)
+
+// selectStreamRecreationStrategy validates the requested strategy; an empty value selects a full restart
+func selectStreamRecreationStrategy(requested string) (string, error) {
+	switch requested {
+	case "", streamRecreationFullRestart:
+		return streamRecreationFullRestart, nil
+	case streamRecreationSeamless:
+		return streamRecreationSeamless, nil
+	}
+	return "", &ConfigError{
+		Field:   "streamRecreationStrategy",
+		Message: fmt.Sprintf("unknown strategy %q (expected %s or %s)", requested, streamRecreationFullRestart, streamRecreationSeamless),
+	}
+}
+
+// geminiSummaryLanguages are the primary language subtags Gemini can write summaries in
+var geminiSummaryLanguages = []string{
+	"ar", "bg", "bn", "cs", "da", "de", "el", "en", "es", "et", "fa", "fi", "fr", "he", "hi", "hr", "hu",
+	"id", "it", "ja", "ko", "lt", "lv", "nl", "no", "pl", "pt", "ro", "ru", "sk", "sl", "sr", "sv", "sw",
+	"th", "tr", "uk", "vi", "zh",
+}
+
+// primaryLanguageSubtag returns the lowercased language part of a BCP-47 code, e.g. "fr" for "fr-FR"
+func primaryLanguageSubtag(code string) string {
+	primary, _, _ := strings.Cut(code, "-")
+	return strings.ToLower(primary)
+}
+
+// selectSummaryLanguage validates the requested summary language and returns it only when it differs from the transcript language
+func selectSummaryLanguage(requested, languageCode string) (string, error) {
+	if requested == "" {
+		return "", nil
+	}
+	if !slices.Contains(geminiSummaryLanguages, primaryLanguageSubtag(requested)) {
+		return "", &ConfigError{
+			Field:   "summaryLanguage",
+			Message: fmt.Sprintf("language %q is not supported for summaries", requested),
+		}
+	}
+	if primaryLanguageSubtag(requested) == primaryLanguageSubtag(languageCode) {
+		return "", nil
+	}
+	return requested, nil
+}
+
+// validateAutoDetectLanguage rejects automatic language detection, requested with autoDetectLanguage or the "auto"
+// language code, unless model supports it on the Speech-to-Text API version the server streams to
+func validateAutoDetectLanguage(autoDetect bool, languageCode, model string) error {
+	if !autoDetect && languageCode != "auto" {
+		return nil
+	}
+	if supportsAutoDetectLanguage(model, speechAPIVersion) {
+		return nil
+	}
+	field := "autoDetectLanguage"
+	if !autoDetect {
+		field = "languageCode"
+	}
+	return &ConfigError{
+		Field:   field,
+		Message: fmt.Sprintf("automatic language detection needs the %s model on the v2 API, but the server uses %s; set languageCode and alternativeLanguageCodes instead", autoDetectLanguageModel, speechAPIVersion),
+	}
+}
+
+// validatePhraseSetRef checks that ref is the resource name of a Cloud Speech phrase set
+// (projects/*/locations/*/phraseSets/*) belonging to projectID
+func validatePhraseSetRef(ref, projectID string) error {
+	parts := strings.Split(ref, "/")
+	if len(parts) != 6 || parts[0] != "projects" || parts[2] != "locations" || parts[4] != "phraseSets" ||
+		parts[1] == "" || parts[3] == "" || parts[5] == "" {
+		return &ConfigError{
+			Field:   "phraseSetResources",
+			Message: fmt.Sprintf("%q is not a phrase set resource name (expected projects/*/locations/*/phraseSets/*)", ref),
+		}
+	}
+	if projectID == "" {
+		return &ConfigError{
+			Field:   "phraseSetResources",
+			Message: "phrase set references require GCP_PROJECT_ID on the server",
+		}
+	}
+	if parts[1] != projectID {
+		return &ConfigError{
+			Field:   "phraseSetResources",
+			Message: fmt.Sprintf("phrase set %q does not belong to project %q", ref, projectID),
+		}
+	}
+	return nil
+}
+
+// selectRecognitionMetadata converts the requested metadata into Speech-to-Text recognition metadata;
+// enum values must be names known to the Speech API, and no metadata is sent when none is requested
+func selectRecognitionMetadata(requested *RecognitionMetadata) (*speechpb.RecognitionMetadata, error) {
+	if requested == nil || *requested == (RecognitionMetadata{}) {
+		return nil, nil
+	}
+	interactionType, err := recognitionMetadataEnum("interactionType", requested.InteractionType, speechpb.RecognitionMetadata_InteractionType_value)
+	if err != nil {
+		return nil, err
+	}
+	microphoneDistance, err := recognitionMetadataEnum("microphoneDistance", requested.MicrophoneDistance, speechpb.RecognitionMetadata_MicrophoneDistance_value)
+	if err != nil {
+		return nil, err
+	}
+	recordingDeviceType, err := recognitionMetadataEnum("recordingDeviceType", requested.RecordingDeviceType, speechpb.RecognitionMetadata_RecordingDeviceType_value)
+	if err != nil {
+		return nil, err
+	}
+	originalMediaType, err := recognitionMetadataEnum("originalMediaType", requested.OriginalMediaType, speechpb.RecognitionMetadata_OriginalMediaType_value)
+	if err != nil {
+		return nil, err
+	}
+	return &speechpb.RecognitionMetadata{
+		InteractionType:     speechpb.RecognitionMetadata_InteractionType(interactionType),
+		MicrophoneDistance:  speechpb.RecognitionMetadata_MicrophoneDistance(microphoneDistance),
+		RecordingDeviceType: speechpb.RecognitionMetadata_RecordingDeviceType(recordingDeviceType),
+		RecordingDeviceName: requested.RecordingDeviceName,
+		OriginalMediaType:   speechpb.RecognitionMetadata_OriginalMediaType(originalMediaType),
+	}, nil
+}
+
+// recognitionMetadataEnum looks up an enum value name of a recognition metadata field; empty selects the unspecified value
+func recognitionMetadataEnum(field, name string, values map[string]int32) (int32, error) {
+	if name == "" {
+		return 0, nil
+	}
+	if value, ok := values[name]; ok && value != 0 {
+		return value, nil
+	}
+	var allowed []string
+	for _, known := range slices.Sorted(maps.Keys(values)) {
+		if values[known] != 0 {
+			allowed = append(allowed, known)
+		}
+	}
+	return 0, &ConfigError{
+		Field:   "recognitionMetadata." + field,
+		Message: fmt.Sprintf("unknown value %q (expected one of %s)", name, strings.Join(allowed, ", ")),
+	}
+}
+
+// geminiHarmCategories are the harm categories clients may configure in geminiSafetySettings
+var geminiHarmCategories = []genai.HarmCategory{
+	genai.HarmCategoryHarassment,
+	genai.HarmCategoryHateSpeech,
+	genai.HarmCategorySexuallyExplicit,
+	genai.HarmCategoryDangerousContent,
+	genai.HarmCategoryCivicIntegrity,
+}
+
+// geminiHarmBlockThresholds are the thresholds clients may configure in geminiSafetySettings
+var geminiHarmBlockThresholds = []genai.HarmBlockThreshold{
+	genai.HarmBlockThresholdBlockLowAndAbove,
+	genai.HarmBlockThresholdBlockMediumAndAbove,
+	genai.HarmBlockThresholdBlockOnlyHigh,
+	genai.HarmBlockThresholdBlockNone,
+	genai.HarmBlockThresholdOff,
+}
+
+// selectSafetySettings converts the requested harm category thresholds into Gemini safety settings, ordered by category.
+// Custom settings are only accepted when ALLOW_CUSTOM_SAFETY_SETTINGS is true; none keeps Gemini's defaults.
+func selectSafetySettings(requested map[string]string) ([]*genai.SafetySetting, error) {
+	if len(requested) == 0 {
+		return nil, nil
+	}
+	if os.Getenv("ALLOW_CUSTOM_SAFETY_SETTINGS") != "true" {
+		return nil, &ConfigError{
+			Field:   "geminiSafetySettings",
+			Message: "custom safety settings are not allowed on this server",
+		}
+	}
+
+	var settings []*genai.SafetySetting
+	for _, category := range slices.Sorted(maps.Keys(requested)) {
+		threshold := requested[category]
+		if !slices.Contains(geminiHarmCategories, genai.HarmCategory(category)) {
+			return nil, &ConfigError{
+				Field:   "geminiSafetySettings",
+				Message: fmt.Sprintf("unknown harm category %q", category),
+			}
+		}
+		if !slices.Contains(geminiHarmBlockThresholds, genai.HarmBlockThreshold(threshold)) {
+			return nil, &ConfigError{
+				Field:   "geminiSafetySettings",
+				Message: fmt.Sprintf("unknown threshold %q for %s", threshold, category),
+			}
+		}
+		settings = append(settings, &genai.SafetySetting{
+			Category:  genai.HarmCategory(category),
+			Threshold: genai.HarmBlockThreshold(threshold),
+		})
+	}
+	return settings, nil
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestAllowedGeminiModels(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  []string
+	}{
+		{"default", "", []string{"gemini-2.5-flash", "gemini-2.5-pro"}},
+		{"custom list", "gemini-2.5-flash-lite, gemini-2.5-pro", []string{"gemini-2.5-flash-lite", "gemini-2.5-pro"}},
+		{"blank entries skipped", "gemini-2.5-pro,, ", []string{"gemini-2.5-pro"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GEMINI_ALLOWED_MODELS", tt.value)
+			if got := allowedGeminiModels(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("allowedGeminiModels() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultAlternativeLanguages(t *testing.T) {
+	previous := languageAlternatives
+	t.Cleanup(func() { languageAlternatives = previous })
+	tests := []struct {
+		name    string
+		value   string
+		primary string
+		want    []string
+	}{
+		{"built-in fallback for en-US", "", "en-US", []string{"fr-FR", "es-ES"}},
+		{"no fallback for other languages", "", "fr-FR", nil},
+		{"configured mapping", `{"fr-FR":["en-US","de-DE"]}`, "fr-FR", []string{"en-US", "de-DE"}},
+		{"configured mapping replaces the en-US fallback", `{"en-US":["ja-JP"]}`, "en-US", []string{"ja-JP"}},
+		{"explicitly empty alternatives", `{"en-US":[]}`, "en-US", []string{}},
+		{"unmapped language", `{"fr-FR":["en-US"]}`, "de-DE", nil},
+		{"invalid JSON keeps built-in defaults", `{"en-US":`, "en-US", []string{"fr-FR", "es-ES"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			languageAlternatives = nil
+			t.Setenv("LANGUAGE_ALTERNATIVES", tt.value)
+			loadLanguageAlternatives()
+			if got := defaultAlternativeLanguages(tt.primary); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("defaultAlternativeLanguages(%q) = %v, want %v", tt.primary, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectGeminiModel(t *testing.T) {
+	allowed := []string{"gemini-2.5-flash", "gemini-2.5-pro"}
+	tests := []struct {
+		name      string
+		requested string
+		want      string
+		wantErr   bool
+	}{
+		{"default when none requested", "", "gemini-2.5-flash", false},
+		{"allowed override", "gemini-2.5-pro", "gemini-2.5-pro", false},
+		{"disallowed model", "gemini-1.0-ultra", "", true},
+		{"model names are case sensitive", "Gemini-2.5-Pro", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectGeminiModel(tt.requested, "gemini-2.5-flash", allowed)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("selectGeminiModel(%q) error = %v, wantErr %v", tt.requested, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("selectGeminiModel(%q) = %q, want %q", tt.requested, got, tt.want)
+			}
+			var configErr *ConfigError
+			if tt.wantErr && (!errors.As(err, &configErr) || configErr.Field != "geminiModel") {
+				t.Errorf("error = %#v, want a ConfigError on geminiModel", err)
+			}
+		})
+	}
+}
+
+func TestSelectGeminiModelVariantsSetTheirField(t *testing.T) {
+	allowed := []string{"gemini-2.5-flash"}
+	tests := []struct {
+		name      string
+		selectFn  func(string, []string) (string, error)
+		wantField string
+	}{
+		{"punctuation model", selectAutoPunctuateModel, "autoPunctuateModel"},
+		{"fallback model", selectGeminiFallbackModel, "geminiFallbackModel"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := tt.selectFn("", allowed); got != "" || err != nil {
+				t.Errorf("empty request = %q, %v, want disabled", got, err)
+			}
+			if got, err := tt.selectFn("gemini-2.5-flash", allowed); got != "gemini-2.5-flash" || err != nil {
+				t.Errorf("allowed request = %q, %v, want gemini-2.5-flash", got, err)
+			}
+			_, err := tt.selectFn("gemini-2.5-pro", allowed)
+			var configErr *ConfigError
+			if !errors.As(err, &configErr) || configErr.Field != tt.wantField {
+				t.Errorf("disallowed request error = %#v, want a ConfigError on %s", err, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestSelectRecognitionMetadata(t *testing.T) {
+	tests := []struct {
+		name      string
+		requested *RecognitionMetadata
+		want      *speechpb.RecognitionMetadata
+		wantField string // Field of the expected ConfigError
+	}{
+		{"none requested", nil, nil, ""},
+		{"empty", &RecognitionMetadata{}, nil, ""},
+		{"discussion", &RecognitionMetadata{InteractionType: "DISCUSSION"}, &speechpb.RecognitionMetadata{InteractionType: speechpb.RecognitionMetadata_DISCUSSION}, ""},
+		{"all fields", &RecognitionMetadata{
+			InteractionType:     "PHONE_CALL",
+			MicrophoneDistance:  "FARFIELD",
+			RecordingDeviceType: "SMARTPHONE",
+			RecordingDeviceName: "Pixel XL",
+			OriginalMediaType:   "VIDEO",
+		}, &speechpb.RecognitionMetadata{
+			InteractionType:     speechpb.RecognitionMetadata_PHONE_CALL,
+			MicrophoneDistance:  speechpb.RecognitionMetadata_FARFIELD,
+			RecordingDeviceType: speechpb.RecognitionMetadata_SMARTPHONE,
+			RecordingDeviceName: "Pixel XL",
+			OriginalMediaType:   speechpb.RecognitionMetadata_VIDEO,
+		}, ""},
+		{"device name only", &RecognitionMetadata{RecordingDeviceName: "Studio mic"}, &speechpb.RecognitionMetadata{RecordingDeviceName: "Studio mic"}, ""},
+		{"unknown interaction type", &RecognitionMetadata{InteractionType: "PODCAST"}, nil, "recognitionMetadata.interactionType"},
+		{"names are case sensitive", &RecognitionMetadata{InteractionType: "discussion"}, nil, "recognitionMetadata.interactionType"},
+		{"unspecified value rejected", &RecognitionMetadata{InteractionType: "INTERACTION_TYPE_UNSPECIFIED"}, nil, "recognitionMetadata.interactionType"},
+		{"unknown microphone distance", &RecognitionMetadata{MicrophoneDistance: "CLOSE"}, nil, "recognitionMetadata.microphoneDistance"},
+		{"unknown recording device", &RecognitionMetadata{RecordingDeviceType: "TABLET"}, nil, "recognitionMetadata.recordingDeviceType"},
+		{"unknown media type", &RecognitionMetadata{OriginalMediaType: "PODCAST"}, nil, "recognitionMetadata.originalMediaType"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectRecognitionMetadata(tt.requested)
+			if tt.wantField != "" {
+				var configErr *ConfigError
+				if !errors.As(err, &configErr) || configErr.Field != tt.wantField {
+					t.Fatalf("error = %#v, want a ConfigError on %s", err, tt.wantField)
+				}
+				if _, allowed, _ := strings.Cut(configErr.Message, "expected one of"); strings.Contains(allowed, "UNSPECIFIED") {
+					t.Errorf("error message %q lists the unspecified value as allowed", configErr.Message)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !proto.Equal(got, tt.want) {
+				t.Errorf("selectRecognitionMetadata() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateAutoDetectLanguage(t *testing.T) {
+	tests := []struct {
+		name         string
+		autoDetect   bool
+		languageCode string
+		model        string
+		wantField    string // Field of the expected ConfigError
+	}{
+		{"not requested", false, "en-US", "", ""},
+		{"not requested with chirp", false, "fr-FR", autoDetectLanguageModel, ""},
+		{"requested with chirp on v1", true, "en-US", autoDetectLanguageModel, "autoDetectLanguage"},
+		{"requested with another model", true, "en-US", "latest_long", "autoDetectLanguage"},
+		{"auto language code", false, "auto", autoDetectLanguageModel, "languageCode"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAutoDetectLanguage(tt.autoDetect, tt.languageCode, tt.model)
+			if tt.wantField == "" {
+				if err != nil {
+					t.Fatalf("validateAutoDetectLanguage() = %v, want nil", err)
+				}
+				return
+			}
+			var configErr *ConfigError
+			if !errors.As(err, &configErr) || configErr.Field != tt.wantField {
+				t.Fatalf("error = %#v, want a ConfigError on %s", err, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestValidatePhraseSetRef(t *testing.T) {
+	tests := []struct {
+		name      string
+		ref       string
+		projectID string
+		wantErr   string // part of the expected ConfigError message
+	}{
+		{"valid", "projects/my-project/locations/global/phraseSets/medical-terms", "my-project", ""},
+		{"regional", "projects/my-project/locations/europe-west1/phraseSets/legal", "my-project", ""},
+		{"bare name", "medical-terms", "my-project", "is not a phrase set resource name"},
+		{"wrong collection", "projects/my-project/locations/global/customClasses/drugs", "my-project", "is not a phrase set resource name"},
+		{"missing location", "projects/my-project/phraseSets/medical-terms", "my-project", "is not a phrase set resource name"},
+		{"empty segment", "projects//locations/global/phraseSets/medical-terms", "my-project", "is not a phrase set resource name"},
+		{"trailing segment", "projects/my-project/locations/global/phraseSets/medical-terms/extra", "my-project", "is not a phrase set resource name"},
+		{"no server project", "projects/my-project/locations/global/phraseSets/medical-terms", "", "require GCP_PROJECT_ID"},
+		{"project mismatch", "projects/other-project/locations/global/phraseSets/medical-terms", "my-project", `does not belong to project "my-project"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePhraseSetRef(tt.ref, tt.projectID)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validatePhraseSetRef(%q, %q) = %v, want nil", tt.ref, tt.projectID, err)
+				}
+				return
+			}
+			var configErr *ConfigError
+			if !errors.As(err, &configErr) || configErr.Field != "phraseSetResources" {
+				t.Fatalf("error = %#v, want a ConfigError on phraseSetResources", err)
+			}
+			if !strings.Contains(configErr.Message, tt.wantErr) {
+				t.Errorf("error message %q does not contain %q", configErr.Message, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSelectInactivityWarning(t *testing.T) {
+	tests := []struct {
+		name           string
+		requested      int
+		silenceTimeout time.Duration
+		want           time.Duration
+		wantErr        bool
+	}{
+		{"no silence timeout", 10, 0, 0, false},
+		{"default", 0, 5 * time.Minute, 30 * time.Second, false},
+		{"default halves a shorter timeout", 0, 40 * time.Second, 20 * time.Second, false},
+		{"requested", 10, 5 * time.Minute, 10 * time.Second, false},
+		{"negative disables the warning", -1, 5 * time.Minute, 0, false},
+		{"as long as the timeout", 60, time.Minute, 0, true},
+		{"longer than the timeout", 90, time.Minute, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectInactivityWarning(tt.requested, tt.silenceTimeout)
+			if tt.wantErr {
+				var configErr *ConfigError
+				if !errors.As(err, &configErr) || configErr.Field != "inactivityWarningSeconds" {
+					t.Fatalf("error = %#v, want a ConfigError on inactivityWarningSeconds", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("selectInactivityWarning(%d, %s) = %s, want %s", tt.requested, tt.silenceTimeout, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEffectiveMaxSessionDuration(t *testing.T) {
+	tests := []struct {
+		name      string
+		requested int
+		ceiling   int64
+		want      time.Duration
+	}{
+		{"unlimited", 0, 0, 0},
+		{"client limit without a ceiling", 30, 0, 30 * time.Minute},
+		{"server ceiling only", 0, 60, 60 * time.Minute},
+		{"client limit below the ceiling", 30, 60, 30 * time.Minute},
+		{"client limit above the ceiling", 90, 60, 60 * time.Minute},
+		{"negative client limit uses the ceiling", -5, 60, 60 * time.Minute},
+		{"negative ceiling is unlimited", 0, -1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := effectiveMaxSessionDuration(tt.requested, tt.ceiling); got != tt.want {
+				t.Errorf("effectiveMaxSessionDuration(%d, %d) = %s, want %s", tt.requested, tt.ceiling, got, tt.want)
+			}
+		})
+	}
+}
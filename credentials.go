@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"cloud.google.com/go/auth"
+	"cloud.google.com/go/auth/credentials"
+	"google.golang.org/api/option"
+)
+
+// cloudPlatformScope grants access to the Speech-to-Text, Vertex AI and Cloud Storage APIs
+const cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// gcpCredentials holds the credentials loaded from GCP_CREDENTIALS_FILE for GenAI clients;
+// nil means Application Default Credentials are used
+var gcpCredentials *auth.Credentials
+
+// loadCredentialsFile reads Google Cloud credentials (e.g. a service account key) from a JSON file
+func loadCredentialsFile(credsPath string) (*auth.Credentials, error) {
+	return credentials.DetectDefault(&credentials.DetectOptions{
+		CredentialsFile: credsPath,
+		Scopes:          []string{cloudPlatformScope},
+	})
+}
+
+// validateCredentials checks that the credentials in credsPath are accepted by fetching an access token,
+// which verifies authentication without calling, or consuming the quota of, any API
+func validateCredentials(ctx context.Context, credsPath string) error {
+	creds, err := loadCredentialsFile(credsPath)
+	if err != nil {
+		return fmt.Errorf("invalid credentials file %s: %v", credsPath, err)
+	}
+	if _, err := creds.Token(ctx); err != nil {
+		return fmt.Errorf("credentials from %s were rejected: %v", credsPath, err)
+	}
+	return nil
+}
+
+// initGCPCredentials loads GCP_CREDENTIALS_FILE when set and exits when its credentials do not work
+func initGCPCredentials() {
+	credsPath := os.Getenv("GCP_CREDENTIALS_FILE")
+	if credsPath == "" {
+		logger.Debug("Using Application Default Credentials")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := validateCredentials(ctx, credsPath); err != nil {
+		logger.Error("GCP credentials validation failed", "credentialsFile", credsPath, "error", err)
+		os.Exit(1)
+	}
+
+	creds, err := loadCredentialsFile(credsPath)
+	if err != nil {
+		logger.Error("Failed to load GCP credentials", "credentialsFile", credsPath, "error", err)
+		os.Exit(1)
+	}
+	gcpCredentials = creds
+	logger.Info("Using GCP credentials file", "credentialsFile", credsPath)
+}
+
+// googleClientOptions returns the options authenticating Google Cloud API clients with GCP_CREDENTIALS_FILE, if set
+func googleClientOptions() []option.ClientOption {
+	if credsPath := os.Getenv("GCP_CREDENTIALS_FILE"); credsPath != "" {
+		return []option.ClientOption{option.WithCredentialsFile(credsPath)}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeServiceAccountKey writes a service account key whose tokens are requested from tokenURI
+func writeServiceAccountKey(t *testing.T, tokenURI string) string {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "project",
+		"private_key_id": "key-id",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"client_email":   "transcriber@project.iam.gserviceaccount.com",
+		"client_id":      "1234",
+		"token_uri":      tokenURI,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestValidateCredentials(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int  // Status of the token endpoint
+		down    bool // The token endpoint is unreachable
+		wantErr string
+	}{
+		{"token issued", http.StatusOK, false, ""},
+		{"credentials rejected", http.StatusUnauthorized, false, "were rejected"},
+		{"token endpoint unreachable", 0, true, "were rejected"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				if tt.status != http.StatusOK {
+					json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client", "error_description": "The OAuth client was not found."})
+					return
+				}
+				json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "token", "token_type": "Bearer", "expires_in": 3600})
+			}))
+			defer server.Close()
+			credsPath := writeServiceAccountKey(t, server.URL+"/token")
+			if tt.down {
+				server.Close()
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			err := validateCredentials(ctx, credsPath)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validateCredentials() = %v, want nil", err)
+				}
+				if requests != 1 {
+					t.Errorf("%d token requests, want 1", requests)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateCredentials() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateCredentialsInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	if err := os.WriteFile(path, []byte("not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateCredentials(context.Background(), path); err == nil || !strings.Contains(err.Error(), "invalid credentials file") {
+		t.Errorf("validateCredentials() = %v, want an invalid credentials file error", err)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import "strings"
+
+// Diff operations
+const (
+	diffEqual  = "equal"
+	diffInsert = "insert"
+	diffDelete = "delete"
+)
+
+// DiffOp is a run of words that is kept, inserted or deleted between two texts
+type DiffOp struct {
+	Operation string `json:"operation"`
+	Text      string `json:"text"`
+}
+
+// generateDiff returns a word-level diff from original to corrected based on their longest common subsequence.
+// Consecutive words with the same operation are merged into a single DiffOp; deletions come before insertions.
+func generateDiff(original, corrected string) []DiffOp {
+	a := strings.Fields(original)
+	b := strings.Fields(corrected)
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	ops := []DiffOp{}
+	add := func(operation, word string) {
+		if n := len(ops); n > 0 && ops[n-1].Operation == operation {
+			ops[n-1].Text += " " + word
+			return
+		}
+		ops = append(ops, DiffOp{Operation: operation, Text: word})
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			add(diffEqual, a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			add(diffDelete, a[i])
+			i++
+		default:
+			add(diffInsert, b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		add(diffDelete, a[i])
+	}
+	for ; j < len(b); j++ {
+		add(diffInsert, b[j])
+	}
+	return ops
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGenerateDiff(t *testing.T) {
+	tests := []struct {
+		name      string
+		original  string
+		corrected string
+		want      []DiffOp
+	}{
+		{"both empty", "", "", []DiffOp{}},
+		{"empty original", "", "hello world", []DiffOp{{diffInsert, "hello world"}}},
+		{"empty corrected", "hello world", "", []DiffOp{{diffDelete, "hello world"}}},
+		{"identical", "the quick fox", "the quick fox", []DiffOp{{diffEqual, "the quick fox"}}},
+		{"whitespace only changes", "the  quick\tfox", "the quick fox", []DiffOp{{diffEqual, "the quick fox"}}},
+		{"complete replacement", "foo bar", "baz qux", []DiffOp{{diffDelete, "foo bar"}, {diffInsert, "baz qux"}}},
+		{"substituted word", "meet at noon today", "meet at ten today", []DiffOp{
+			{diffEqual, "meet at"}, {diffDelete, "noon"}, {diffInsert, "ten"}, {diffEqual, "today"},
+		}},
+		{"inserted word", "ship the release", "ship the new release", []DiffOp{
+			{diffEqual, "ship the"}, {diffInsert, "new"}, {diffEqual, "release"},
+		}},
+		{"deleted word", "ship the old release", "ship the release", []DiffOp{
+			{diffEqual, "ship the"}, {diffDelete, "old"}, {diffEqual, "release"},
+		}},
+		{"case changes are edits", "Cube Nettie", "Kubernetes", []DiffOp{{diffDelete, "Cube Nettie"}, {diffInsert, "Kubernetes"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := generateDiff(tt.original, tt.corrected); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("generateDiff(%q, %q) = %v, want %v", tt.original, tt.corrected, got, tt.want)
+			}
+		})
+	}
+}
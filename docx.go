@@ -0,0 +1,192 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// docxContentTypes declares the parts of the generated Word document
+const docxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/>
+<Override PartName="/word/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.styles+xml"/>
+</Types>`
+
+// docxPackageRels points the package at the main document
+const docxPackageRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/>
+</Relationships>`
+
+// docxDocumentRels links the main document to its styles
+const docxDocumentRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+</Relationships>`
+
+// docxStyles defines the paragraph styles used by exported documents
+const docxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+<w:style w:type="paragraph" w:default="1" w:styleId="Normal"><w:name w:val="Normal"/><w:pPr><w:spacing w:after="120"/></w:pPr><w:rPr><w:sz w:val="22"/></w:rPr></w:style>
+<w:style w:type="paragraph" w:styleId="Title"><w:name w:val="Title"/><w:basedOn w:val="Normal"/><w:pPr><w:spacing w:after="240"/></w:pPr><w:rPr><w:b/><w:sz w:val="48"/></w:rPr></w:style>
+<w:style w:type="paragraph" w:styleId="Heading1"><w:name w:val="heading 1"/><w:basedOn w:val="Normal"/><w:pPr><w:keepNext/><w:spacing w:before="240"/><w:outlineLvl w:val="0"/></w:pPr><w:rPr><w:b/><w:sz w:val="32"/></w:rPr></w:style>
+<w:style w:type="paragraph" w:styleId="Heading2"><w:name w:val="heading 2"/><w:basedOn w:val="Normal"/><w:pPr><w:keepNext/><w:spacing w:before="200"/><w:outlineLvl w:val="1"/></w:pPr><w:rPr><w:b/><w:sz w:val="26"/></w:rPr></w:style>
+</w:styles>`
+
+// docxRun is a run of text sharing the same formatting
+type docxRun struct {
+	Text string
+	Bold bool
+}
+
+// docxParagraph is a paragraph of a generated Word document
+type docxParagraph struct {
+	Style           string // Empty for the Normal style
+	PageBreakBefore bool
+	Runs            []docxRun
+}
+
+// speakerTurn is a run of consecutive words from the same speaker
+type speakerTurn struct {
+	SpeakerTag int32
+	StartMs    int64
+	Text       string
+}
+
+// speakerTurns splits a segment at speaker changes; segments without diarization form a single turn with speaker 0
+func speakerTurns(segment TranscriptionSegment, sessionStart time.Time) []speakerTurn {
+	if len(segment.Words) == 0 {
+		return []speakerTurn{{StartMs: segment.StartTime.Sub(sessionStart).Milliseconds(), Text: strings.TrimSpace(segment.Text)}}
+	}
+
+	var turns []speakerTurn
+	var words []string
+	for i, word := range segment.Words {
+		if i > 0 && word.SpeakerTag != segment.Words[i-1].SpeakerTag {
+			turns[len(turns)-1].Text = strings.Join(words, " ")
+			words = nil
+		}
+		if len(words) == 0 {
+			turns = append(turns, speakerTurn{SpeakerTag: word.SpeakerTag, StartMs: word.StartMs})
+		}
+		words = append(words, word.Word)
+	}
+	turns[len(turns)-1].Text = strings.Join(words, " ")
+
+	// Without diarization the segment text keeps punctuation the word list lacks
+	if len(turns) == 1 && turns[0].SpeakerTag == 0 {
+		turns[0].Text = strings.TrimSpace(segment.Text)
+	}
+	return turns
+}
+
+// exportToDocx renders a session as a Word document: a cover page with the session metadata,
+// the transcript with one paragraph per speaker turn, and the summary as an appendix
+func exportToDocx(segments []TranscriptionSegment, summary string, metadata SessionMetadata) ([]byte, error) {
+	paragraphs := []docxParagraph{
+		{Style: "Title", Runs: []docxRun{{Text: "Session transcript"}}},
+		{Runs: []docxRun{{Text: "Session ID: ", Bold: true}, {Text: metadata.SessionID}}},
+		{Runs: []docxRun{{Text: "Started: ", Bold: true}, {Text: metadata.CreatedAt.Format(time.RFC1123)}}},
+	}
+	if metadata.EndedAt != nil {
+		paragraphs = append(paragraphs,
+			docxParagraph{Runs: []docxRun{{Text: "Ended: ", Bold: true}, {Text: metadata.EndedAt.Format(time.RFC1123)}}},
+			docxParagraph{Runs: []docxRun{{Text: "Duration: ", Bold: true}, {Text: metadata.EndedAt.Sub(metadata.CreatedAt).Round(time.Second).String()}}})
+	}
+	languages := metadata.LanguageCode
+	if len(metadata.AlternativeLanguageCodes) > 0 {
+		languages += " (alternatives: " + strings.Join(metadata.AlternativeLanguageCodes, ", ") + ")"
+	}
+	paragraphs = append(paragraphs,
+		docxParagraph{Runs: []docxRun{{Text: "Language: ", Bold: true}, {Text: languages}}},
+		docxParagraph{Runs: []docxRun{{Text: "Segments: ", Bold: true}, {Text: fmt.Sprintf("%d", len(segments))}}},
+		docxParagraph{Style: "Heading1", PageBreakBefore: true, Runs: []docxRun{{Text: "Transcript"}}})
+
+	for _, segment := range segments {
+		for _, turn := range speakerTurns(segment, metadata.CreatedAt) {
+			runs := []docxRun{{Text: "[" + formatSubtitleTimestamp(time.Duration(turn.StartMs)*time.Millisecond, ".")[:8] + "] "}}
+			if turn.SpeakerTag > 0 {
+				runs = append(runs, docxRun{Text: fmt.Sprintf("Speaker %d: ", turn.SpeakerTag), Bold: true})
+			}
+			paragraphs = append(paragraphs, docxParagraph{Runs: append(runs, docxRun{Text: turn.Text})})
+		}
+	}
+
+	if strings.TrimSpace(summary) != "" {
+		paragraphs = append(paragraphs, docxParagraph{Style: "Heading1", PageBreakBefore: true, Runs: []docxRun{{Text: "Summary"}}})
+		for _, line := range strings.Split(strings.TrimSpace(summary), "\n") {
+			paragraphs = append(paragraphs, docxParagraph{Runs: []docxRun{{Text: line}}})
+		}
+	}
+
+	document, err := renderDocxDocument(paragraphs)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	parts := []struct {
+		name    string
+		content []byte
+	}{
+		{"[Content_Types].xml", []byte(docxContentTypes)},
+		{"_rels/.rels", []byte(docxPackageRels)},
+		{"word/_rels/document.xml.rels", []byte(docxDocumentRels)},
+		{"word/styles.xml", []byte(docxStyles)},
+		{"word/document.xml", document},
+	}
+	for _, part := range parts {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return nil, fmt.Errorf("error creating %s: %v", part.name, err)
+		}
+		if _, err := f.Write(part.content); err != nil {
+			return nil, fmt.Errorf("error writing %s: %v", part.name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("error finalizing document: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// renderDocxDocument writes the paragraphs as the WordprocessingML main document part
+func renderDocxDocument(paragraphs []docxParagraph) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	b.WriteString(`<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>`)
+	for _, paragraph := range paragraphs {
+		b.WriteString("<w:p>")
+		if paragraph.Style != "" || paragraph.PageBreakBefore {
+			b.WriteString("<w:pPr>")
+			if paragraph.Style != "" {
+				fmt.Fprintf(&b, `<w:pStyle w:val="%s"/>`, paragraph.Style)
+			}
+			if paragraph.PageBreakBefore {
+				b.WriteString("<w:pageBreakBefore/>")
+			}
+			b.WriteString("</w:pPr>")
+		}
+		for _, run := range paragraph.Runs {
+			b.WriteString("<w:r>")
+			if run.Bold {
+				b.WriteString("<w:rPr><w:b/></w:rPr>")
+			}
+			b.WriteString(`<w:t xml:space="preserve">`)
+			if err := xml.EscapeText(&b, []byte(run.Text)); err != nil {
+				return nil, fmt.Errorf("error escaping document text: %v", err)
+			}
+			b.WriteString("</w:t></w:r>")
+		}
+		b.WriteString("</w:p>")
+	}
+	b.WriteString("</w:body></w:document>")
+	return b.Bytes(), nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportToDocx(t *testing.T) {
+	start := time.Date(2026, 1, 2, 9, 0, 0, 0, time.UTC)
+	segments := []TranscriptionSegment{
+		{Text: "Hello & welcome.", StartTime: start.Add(5 * time.Second)},
+		{Text: "hi there yes", StartTime: start.Add(time.Minute), Words: []WordTiming{
+			{Word: "hi", SpeakerTag: 1, StartMs: 60000},
+			{Word: "there", SpeakerTag: 1, StartMs: 60300},
+			{Word: "yes", SpeakerTag: 2, StartMs: 61000},
+		}},
+	}
+	data, err := exportToDocx(segments, "Decision: ship <it>", SessionMetadata{SessionID: "abc", CreatedAt: start, LanguageCode: "en-US"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		t.Fatalf("document starts with %q, want the ZIP magic bytes", data[:4])
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := map[string]string{}
+	for _, file := range reader.File {
+		rc, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(rc)
+		rc.Close()
+		parts[file.Name] = string(content)
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "word/_rels/document.xml.rels", "word/styles.xml", "word/document.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("missing part %s", name)
+		}
+	}
+
+	document := parts["word/document.xml"]
+	for _, want := range []string{
+		"Session ID: ", "abc",
+		"Hello &amp; welcome.",
+		`<w:rPr><w:b/></w:rPr><w:t xml:space="preserve">Speaker 1: </w:t>`,
+		"hi there",
+		"Speaker 2: ",
+		"[00:01:01] ",
+		"Decision: ship &lt;it&gt;",
+	} {
+		if !strings.Contains(document, want) {
+			t.Errorf("document.xml does not contain %q", want)
+		}
+	}
+}
+
+func TestSpeakerTurns(t *testing.T) {
+	start := time.Date(2026, 1, 2, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		segment TranscriptionSegment
+		want    []speakerTurn
+	}{
+		{"no words", TranscriptionSegment{Text: " Hello. ", StartTime: start.Add(2 * time.Second)}, []speakerTurn{{StartMs: 2000, Text: "Hello."}}},
+		{"without diarization keeps punctuation", TranscriptionSegment{Text: "Hi, there.", Words: []WordTiming{{Word: "hi", StartMs: 10}, {Word: "there", StartMs: 20}}},
+			[]speakerTurn{{StartMs: 10, Text: "Hi, there."}}},
+		{"speaker changes", TranscriptionSegment{Text: "a b c", Words: []WordTiming{{Word: "a", SpeakerTag: 1, StartMs: 0}, {Word: "b", SpeakerTag: 2, StartMs: 100}, {Word: "c", SpeakerTag: 2, StartMs: 200}}},
+			[]speakerTurn{{SpeakerTag: 1, StartMs: 0, Text: "a"}, {SpeakerTag: 2, StartMs: 100, Text: "b c"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := speakerTurns(tt.segment, start); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("speakerTurns() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServeSessionExportDocx(t *testing.T) {
+	session := newSession(func() {}, ConfigMessage{LanguageCode: "en-US"})
+	session.addSegment(TranscriptionSegment{Text: "hello world"})
+	sessionRegistry.Register(session)
+	defer sessionRegistry.Unregister(session.ID)
+
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		t.Run(method, func(t *testing.T) {
+			r := httptest.NewRequest(method, "/api/sessions/"+session.ID+"/export?format=docx", nil)
+			r.SetPathValue("sessionID", session.ID)
+			recorder := httptest.NewRecorder()
+			serveSessionExport(recorder, r)
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", recorder.Code)
+			}
+			if got := recorder.Header().Get("Content-Type"); got != "application/vnd.openxmlformats-officedocument.wordprocessingml.document" {
+				t.Errorf("Content-Type = %q", got)
+			}
+			if got, want := recorder.Header().Get("Content-Disposition"), `attachment; filename="session-`+session.ID+`.docx"`; got != want {
+				t.Errorf("Content-Disposition = %q, want %q", got, want)
+			}
+			if !bytes.HasPrefix(recorder.Body.Bytes(), []byte("PK\x03\x04")) {
+				t.Error("response does not start with the ZIP magic bytes")
+			}
+		})
+	}
+}
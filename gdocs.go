@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf16"
+
+	"google.golang.org/api/docs/v1"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+// DocsClient creates and fills Google Docs documents; it is an interface so exports can run against a fake
+type DocsClient interface {
+	CreateDocument(ctx context.Context, title string) (string, error)
+	BatchUpdate(ctx context.Context, documentID string, requests []*docs.Request) error
+	MoveToFolder(ctx context.Context, documentID, folderID string) error
+}
+
+// googleDocsClient implements DocsClient with the Docs and Drive APIs
+type googleDocsClient struct {
+	docs  *docs.Service
+	drive *drive.Service
+}
+
+// newDocsClient creates the client used by Google Docs exports, authenticated with GCP_CREDENTIALS_FILE when set
+// and Application Default Credentials otherwise
+var newDocsClient = func(ctx context.Context) (DocsClient, error) {
+	docsService, err := docs.NewService(ctx, append(googleClientOptions(), option.WithScopes(docs.DocumentsScope))...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating Docs client: %v", err)
+	}
+	driveService, err := drive.NewService(ctx, append(googleClientOptions(), option.WithScopes(drive.DriveFileScope))...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating Drive client: %v", err)
+	}
+	return &googleDocsClient{docs: docsService, drive: driveService}, nil
+}
+
+// CreateDocument creates an empty document and returns its identifier
+func (c *googleDocsClient) CreateDocument(ctx context.Context, title string) (string, error) {
+	document, err := c.docs.Documents.Create(&docs.Document{Title: title}).Context(ctx).Do()
+	if err != nil {
+		return "", err
+	}
+	return document.DocumentId, nil
+}
+
+// BatchUpdate applies the requests to the document
+func (c *googleDocsClient) BatchUpdate(ctx context.Context, documentID string, requests []*docs.Request) error {
+	_, err := c.docs.Documents.BatchUpdate(documentID, &docs.BatchUpdateDocumentRequest{Requests: requests}).Context(ctx).Do()
+	return err
+}
+
+// MoveToFolder moves the document from the root of the user's Drive to the folder
+func (c *googleDocsClient) MoveToFolder(ctx context.Context, documentID, folderID string) error {
+	_, err := c.drive.Files.Update(documentID, &drive.File{}).AddParents(folderID).RemoveParents("root").Context(ctx).Do()
+	return err
+}
+
+// docParagraph is a paragraph of an exported document with its named style
+type docParagraph struct {
+	Text  string
+	Style string
+}
+
+// buildDocumentParagraphs lays out a session as paragraphs: chapters as headings, segments as paragraphs and the summary as an appendix
+func buildDocumentParagraphs(archive *SessionArchive) []docParagraph {
+	var paragraphs []docParagraph
+	chapters := archive.Chapters
+	offset := 0
+	for _, segment := range archive.Segments {
+		// Chapter offsets are positions in the transcript, where each segment is followed by a space
+		for len(chapters) > 0 && chapters[0].CharOffset <= offset {
+			paragraphs = append(paragraphs, docParagraph{Text: chapters[0].Title, Style: "HEADING_2"})
+			chapters = chapters[1:]
+		}
+		paragraphs = append(paragraphs, docParagraph{Text: strings.TrimSpace(segment.Text), Style: "NORMAL_TEXT"})
+		offset += len(segment.Text) + 1
+	}
+	for _, chapter := range chapters {
+		paragraphs = append(paragraphs, docParagraph{Text: chapter.Title, Style: "HEADING_2"})
+	}
+
+	if archive.Summary != "" {
+		paragraphs = append(paragraphs, docParagraph{Text: "Summary", Style: "HEADING_1"})
+		for _, line := range strings.Split(strings.TrimSpace(archive.Summary), "\n") {
+			paragraphs = append(paragraphs, docParagraph{Text: line, Style: "NORMAL_TEXT"})
+		}
+	}
+	return paragraphs
+}
+
+// buildDocsRequests inserts the paragraphs at the start of an empty document and styles the headings.
+// Docs API indexes count UTF-16 code units and the body of a new document starts at index 1.
+func buildDocsRequests(paragraphs []docParagraph) []*docs.Request {
+	if len(paragraphs) == 0 {
+		return nil
+	}
+
+	var text strings.Builder
+	var styles []*docs.Request
+	index := int64(1)
+	for _, paragraph := range paragraphs {
+		line := paragraph.Text + "\n"
+		length := int64(len(utf16.Encode([]rune(line))))
+		text.WriteString(line)
+		if paragraph.Style != "NORMAL_TEXT" {
+			styles = append(styles, &docs.Request{
+				UpdateParagraphStyle: &docs.UpdateParagraphStyleRequest{
+					Range:          &docs.Range{StartIndex: index, EndIndex: index + length},
+					ParagraphStyle: &docs.ParagraphStyle{NamedStyleType: paragraph.Style},
+					Fields:         "namedStyleType",
+				},
+			})
+		}
+		index += length
+	}
+
+	requests := []*docs.Request{{
+		InsertText: &docs.InsertTextRequest{
+			Location: &docs.Location{Index: 1},
+			Text:     text.String(),
+		},
+	}}
+	return append(requests, styles...)
+}
+
+// exportToGoogleDocs creates a document holding the session transcript and returns its identifier
+func exportToGoogleDocs(ctx context.Context, client DocsClient, archive *SessionArchive, title, folderID string) (string, error) {
+	documentID, err := client.CreateDocument(ctx, title)
+	if err != nil {
+		return "", fmt.Errorf("error creating document: %w", err)
+	}
+	if requests := buildDocsRequests(buildDocumentParagraphs(archive)); len(requests) > 0 {
+		if err := client.BatchUpdate(ctx, documentID, requests); err != nil {
+			return "", fmt.Errorf("error writing document: %w", err)
+		}
+	}
+	if folderID != "" {
+		if err := client.MoveToFolder(ctx, documentID, folderID); err != nil {
+			return "", fmt.Errorf("error moving document to folder: %w", err)
+		}
+	}
+	return documentID, nil
+}
+
+// isQuotaError reports whether a Google API error is caused by rate limiting or exhausted quota
+func isQuotaError(err error) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	if apiErr.Code == http.StatusTooManyRequests {
+		return true
+	}
+	for _, item := range apiErr.Errors {
+		switch item.Reason {
+		case "rateLimitExceeded", "userRateLimitExceeded", "quotaExceeded":
+			return true
+		}
+	}
+	return false
+}
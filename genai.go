@@ -2,27 +2,529 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"os"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	"google.golang.org/genai"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-// generateSummary uses Google GenAI to generate content based on the provided transcript, previous summary, prompt, and custom words
-func generateSummary(ctx context.Context, projectID, location, model, fullTranscript, newTranscript, previousSummary, prompt string, customWords []string) (string, error) {
-	if fullTranscript == "" {
-		return "", nil
+// SummaryResult holds a generated summary and the tokens consumed to produce it
+type SummaryResult struct {
+	Text         string
+	InputTokens  int32
+	OutputTokens int32
+	// Strategy is summaryStrategyDirect or summaryStrategyMapReduce
+	Strategy string
+}
+
+// Summary generation strategies
+const (
+	// summaryStrategyDirect sends the full transcript in a single request
+	summaryStrategyDirect = "direct"
+	// summaryStrategyMapReduce summarizes transcript chunks first, then summarizes the chunk summaries
+	summaryStrategyMapReduce = "map_reduce"
+)
+
+// ModelSemaphoreMap bounds the concurrent Gemini requests per model across all sessions
+var (
+	ModelSemaphoreMap   = make(map[string]chan struct{})
+	modelSemaphoreMu    sync.Mutex
+	modelSemaphoreLimit = 5
+	modelQueueTimeout   = 30 * time.Second
+)
+
+// initModelSemaphores sizes the per-model semaphores from GEMINI_MAX_CONCURRENT_PER_MODEL and creates them
+// for the default and allowed models; models first seen later get one on demand
+func initModelSemaphores() {
+	modelSemaphoreLimit = max(1, int(getEnvInt64("GEMINI_MAX_CONCURRENT_PER_MODEL", 5)))
+	modelQueueTimeout = time.Duration(getEnvInt64("GEMINI_QUEUE_TIMEOUT_MS", 30000)) * time.Millisecond
+	for _, model := range append([]string{os.Getenv("GEMINI_MODEL")}, allowedGeminiModels()...) {
+		if model != "" {
+			modelSemaphore(model)
+		}
 	}
+	logger.Info("Gemini concurrency limits configured",
+		"maxConcurrentPerModel", modelSemaphoreLimit,
+		"queueTimeout", modelQueueTimeout)
+}
 
-	client, err := genai.NewClient(ctx, &genai.ClientConfig{
-		Project:  projectID,
-		Location: location,
-		Backend:  genai.BackendVertexAI,
+// modelSemaphore returns the semaphore of a model, creating it on first use
+func modelSemaphore(model string) chan struct{} {
+	modelSemaphoreMu.Lock()
+	defer modelSemaphoreMu.Unlock()
+	semaphore, ok := ModelSemaphoreMap[model]
+	if !ok {
+		semaphore = make(chan struct{}, modelSemaphoreLimit)
+		ModelSemaphoreMap[model] = semaphore
+	}
+	return semaphore
+}
+
+// acquireModelSlot waits for a free request slot of the model, failing when none frees up within
+// GEMINI_QUEUE_TIMEOUT_MS (0 waits indefinitely); release must be called once the request is done
+func acquireModelSlot(ctx context.Context, model string) (release func(), err error) {
+	semaphore := modelSemaphore(model)
+	var timeout <-chan time.Time
+	if modelQueueTimeout > 0 {
+		timer := time.NewTimer(modelQueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case semaphore <- struct{}{}:
+		return func() { <-semaphore }, nil
+	case <-timeout:
+		return nil, fmt.Errorf("no %s request slot freed up within %s", model, modelQueueTimeout)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// newSummarySemaphore creates the semaphore bounding a session's concurrent summaries to MAX_CONCURRENT_SUMMARIES (at least 1)
+func newSummarySemaphore() chan struct{} {
+	return make(chan struct{}, max(1, getEnvInt64("MAX_CONCURRENT_SUMMARIES", 2)))
+}
+
+// tryAcquireSlot takes a slot of semaphore without waiting; ok is false when every slot is taken,
+// otherwise release must be called once the work is done
+func tryAcquireSlot(semaphore chan struct{}) (release func(), ok bool) {
+	select {
+	case semaphore <- struct{}{}:
+		return func() { <-semaphore }, true
+	default:
+		return nil, false
+	}
+}
+
+// genAIClients caches Vertex AI GenAI clients by project and location; clients are safe for concurrent use
+var (
+	genAIClients   = make(map[string]*genai.Client)
+	genAIClientsMu sync.Mutex
+)
+
+// sharedGenAIClient returns the GenAI client of projectID and location, creating it on first use, so frequent
+// short requests do not pay for a new client each time
+func sharedGenAIClient(projectID, location string) (*genai.Client, error) {
+	genAIClientsMu.Lock()
+	defer genAIClientsMu.Unlock()
+	key := projectID + "/" + location
+	if client, ok := genAIClients[key]; ok {
+		return client, nil
+	}
+	client, err := genai.NewClient(context.Background(), &genai.ClientConfig{
+		Project:     projectID,
+		Location:    location,
+		Backend:     genai.BackendVertexAI,
+		Credentials: gcpCredentials,
 	})
 	if err != nil {
-		return "", fmt.Errorf("error creating GenAI client: %v", err)
+		return nil, fmt.Errorf("error creating GenAI client: %v", err)
+	}
+	genAIClients[key] = client
+	return client, nil
+}
+
+// generateContent calls GenerateContent once the model has a free request slot
+func generateContent(ctx context.Context, client *genai.Client, model string, content []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error) {
+	release, err := acquireModelSlot(ctx, model)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return client.Models.GenerateContent(ctx, model, content, config)
+}
+
+// generateContentStream calls GenerateContentStream once the model has a free request slot, passing the text
+// of each chunk to onChunk as it arrives. It returns a response holding the whole text and the final usage.
+func generateContentStream(ctx context.Context, client *genai.Client, model string, content []*genai.Content, config *genai.GenerateContentConfig, onChunk func(text string)) (*genai.GenerateContentResponse, error) {
+	release, err := acquireModelSlot(ctx, model)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	var text strings.Builder
+	var usage *genai.GenerateContentResponseUsageMetadata
+	for chunk, err := range client.Models.GenerateContentStream(ctx, model, content, config) {
+		if err != nil {
+			return nil, err
+		}
+		if chunk.UsageMetadata != nil {
+			usage = chunk.UsageMetadata
+		}
+		if chunkText := chunk.Text(); chunkText != "" {
+			text.WriteString(chunkText)
+			onChunk(chunkText)
+		}
+	}
+	return &genai.GenerateContentResponse{
+		Candidates:    []*genai.Candidate{{Content: genai.NewContentFromText(text.String(), genai.RoleModel)}},
+		UsageMetadata: usage,
+	}, nil
+}
+
+// Transcript chunking settings for transcripts exceeding the model context budget
+const (
+	defaultTranscriptChunkMaxTokens = 32000
+	charsPerToken                   = 4 // Rough estimate used to size chunks without calling the tokenizer
+)
+
+// estimateTokens approximates the number of tokens in text
+func estimateTokens(text string) int {
+	return utf8.RuneCountInString(text) / charsPerToken
+}
+
+// chunkTranscript splits text into chunks of at most maxTokens estimated tokens, cutting at sentence
+// boundaries; sentences longer than a chunk are cut at word boundaries
+func chunkTranscript(text string, maxTokens int) []string {
+	maxChars := maxTokens * charsPerToken
+	if maxChars <= 0 || utf8.RuneCountInString(text) <= maxChars {
+		return []string{text}
+	}
+
+	var chunks []string
+	var current strings.Builder
+	currentChars := 0
+	flush := func() {
+		if chunk := strings.TrimSpace(current.String()); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		current.Reset()
+		currentChars = 0
+	}
+	for _, sentence := range splitSentences(text) {
+		sentenceChars := utf8.RuneCountInString(sentence)
+		if sentenceChars > maxChars {
+			flush()
+			chunks = append(chunks, splitLongPhrase(sentence, maxChars)...)
+			continue
+		}
+		if currentChars+sentenceChars > maxChars {
+			flush()
+		}
+		current.WriteString(sentence)
+		currentChars += sentenceChars
+	}
+	flush()
+	return chunks
+}
+
+// splitSentences splits text after each '.', '!' or '?' followed by whitespace, keeping the whitespace with the sentence
+func splitSentences(text string) []string {
+	var sentences []string
+	start := 0
+	for i := 0; i < len(text); i++ {
+		if text[i] != '.' && text[i] != '!' && text[i] != '?' {
+			continue
+		}
+		end := i + 1
+		for end < len(text) && (text[end] == ' ' || text[end] == '\n' || text[end] == '\t') {
+			end++
+		}
+		if end == i+1 && end < len(text) {
+			continue // Not followed by whitespace, e.g. a decimal point
+		}
+		sentences = append(sentences, text[start:end])
+		start = end
+		i = end - 1
+	}
+	if start < len(text) {
+		sentences = append(sentences, text[start:])
+	}
+	return sentences
+}
+
+// generateText sends a single-turn prompt and returns the reply with its token usage; config may be nil
+func generateText(ctx context.Context, client *genai.Client, model, prompt string, config *genai.GenerateContentConfig) (SummaryResult, error) {
+	content := []*genai.Content{
+		{Role: "user", Parts: []*genai.Part{{Text: prompt}}},
+	}
+	resp, err := generateContent(ctx, client, model, content, config)
+	if err != nil {
+		return SummaryResult{}, fmt.Errorf("error generating content: %w", err)
+	}
+	if resp == nil || len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil || len(resp.Candidates[0].Content.Parts) == 0 {
+		return SummaryResult{}, fmt.Errorf("no content generated")
 	}
 
+	result := SummaryResult{Text: resp.Candidates[0].Content.Parts[0].Text}
+	if resp.UsageMetadata != nil {
+		result.InputTokens = resp.UsageMetadata.PromptTokenCount
+		result.OutputTokens = resp.UsageMetadata.CandidatesTokenCount
+	}
+	return result, nil
+}
+
+// reduceTranscript replaces a transcript larger than maxTokens with summaries of its chunks (the map pass),
+// repeating on the summaries until they fit; the returned usage covers every chunk request.
+// Chunk requests are sent with config, which carries the session's safety settings, and switch to the
+// fallback model like the summary request.
+func reduceTranscript(ctx context.Context, client *genai.Client, model, transcript string, maxTokens int, config *genai.GenerateContentConfig, fallback *ModelFallback) (string, SummaryResult, error) {
+	var usage SummaryResult
+	for estimateTokens(transcript) > maxTokens {
+		chunks := chunkTranscript(transcript, maxTokens)
+		results := make([]SummaryResult, len(chunks))
+		errs := make([]error, len(chunks))
+		var wg sync.WaitGroup
+		for i, chunk := range chunks {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				prompt := fmt.Sprintf(`Summarize part %d of %d of a long conversation transcript. Keep every topic, decision, action item, name and figure, and keep any <!-- CHAPTER: title --> markers where they occur.
+Reply with the summary only.
+
+--- TRANSCRIPT PART %d OF %d ---
+%s`, i+1, len(chunks), i+1, len(chunks), chunk)
+				chunkModel := fallback.Select(model)
+				results[i], errs[i] = generateText(ctx, client, chunkModel, prompt, config)
+				if fallbackModel, ok := fallback.Trip(chunkModel, errs[i]); ok {
+					results[i], errs[i] = generateText(ctx, client, fallbackModel, prompt, config)
+				}
+			}()
+		}
+		wg.Wait()
+
+		summaries := make([]string, len(chunks))
+		for i, result := range results {
+			if errs[i] != nil {
+				return "", usage, fmt.Errorf("error summarizing transcript part %d of %d: %v", i+1, len(chunks), errs[i])
+			}
+			usage.InputTokens += result.InputTokens
+			usage.OutputTokens += result.OutputTokens
+			summaries[i] = fmt.Sprintf("--- SUMMARY OF PART %d OF %d ---\n%s", i+1, len(chunks), strings.TrimSpace(result.Text))
+		}
+
+		reduced := strings.Join(summaries, "\n\n")
+		shrunk := utf8.RuneCountInString(reduced) < utf8.RuneCountInString(transcript)
+		transcript = reduced
+		if !shrunk {
+			break // Another pass would not converge; send the summaries as they are
+		}
+	}
+	return transcript, usage, nil
+}
+
+// SummaryOptions control the language and format of generated summaries
+type SummaryOptions struct {
+	// Language is set when the summary must be written in a language other than TranscriptLanguage
+	Language           string
+	TranscriptLanguage string
+	// Format is summaryFormatMarkdown or summaryFormatJSON
+	Format string
+	// FocusTopics are the topics the summary should concentrate on
+	FocusTopics []string
+	// SafetySettings replace Gemini's default content filtering thresholds when set
+	SafetySettings []*genai.SafetySetting
+	// MaxParagraphLength splits longer Markdown paragraphs at sentence ends (0 = unlimited)
+	MaxParagraphLength int
+	// OnChunk streams the summary: it receives each piece of text as Gemini generates it
+	OnChunk func(text string)
+	// OnReset is called before a streamed summary starts over with the fallback model
+	OnReset func()
+	// Fallback replaces the model while it is out of quota (nil disables the fallback)
+	Fallback *ModelFallback
+}
+
+// ModelFallback switches a session's summaries to a cheaper model when Gemini reports the requested one out of quota.
+// The requested model is tried again once resetAfter has passed since the last quota error.
+type ModelFallback struct {
+	model      string
+	resetAfter time.Duration
+	onSwitch   func(requested, actual string) // Called each time a quota error switches to the fallback model
+
+	mu    sync.Mutex
+	until time.Time // End of the current fallback period, zero when the requested model is in use
+}
+
+// newModelFallback creates a fallback to model; it returns nil when model is empty
+func newModelFallback(model string, resetAfter time.Duration, onSwitch func(requested, actual string)) *ModelFallback {
+	if model == "" {
+		return nil
+	}
+	return &ModelFallback{model: model, resetAfter: resetAfter, onSwitch: onSwitch}
+}
+
+// Select returns the model to use for a request of the requested model
+func (f *ModelFallback) Select(requested string) string {
+	if f == nil || requested == f.model {
+		return requested
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.until.IsZero() {
+		return requested
+	}
+	if time.Now().Before(f.until) {
+		return f.model
+	}
+	f.until = time.Time{}
+	logger.Info("Gemini fallback period over, using the requested model again", "model", requested, "fallbackModel", f.model)
+	return requested
+}
+
+// Trip starts a fallback period when err is a quota error of the model; it returns the model to retry with
+func (f *ModelFallback) Trip(model string, err error) (string, bool) {
+	if f == nil || model == f.model || !isGeminiQuotaError(err) {
+		return "", false
+	}
+	f.mu.Lock()
+	f.until = time.Now().Add(f.resetAfter)
+	f.mu.Unlock()
+	logger.Warn("Gemini quota exceeded, switching to the fallback model",
+		"model", model,
+		"fallbackModel", f.model,
+		"resetAfter", f.resetAfter)
+	if f.onSwitch != nil {
+		f.onSwitch(model, f.model)
+	}
+	return f.model, true
+}
+
+// isGeminiQuotaError reports whether err is Gemini rejecting a request for exhausted quota (HTTP 429 or RESOURCE_EXHAUSTED)
+func isGeminiQuotaError(err error) bool {
+	var apiErr genai.APIError
+	if errors.As(err, &apiErr) {
+		// The API reports the status name as in google.rpc.Code, not as codes.Code.String() ("ResourceExhausted")
+		return apiErr.Code == http.StatusTooManyRequests || apiErr.Status == "RESOURCE_EXHAUSTED"
+	}
+	return status.Code(err) == codes.ResourceExhausted
+}
+
+// normalizeFocusTopics trims summary focus topics and drops empty and repeated ones
+func normalizeFocusTopics(topics []string) []string {
+	var normalized []string
+	seen := make(map[string]bool, len(topics))
+	for _, topic := range topics {
+		topic = strings.TrimSpace(topic)
+		if topic == "" || seen[strings.ToLower(topic)] {
+			continue
+		}
+		seen[strings.ToLower(topic)] = true
+		normalized = append(normalized, topic)
+	}
+	return normalized
+}
+
+// focusTopicsInstruction is the prompt section asking for a summary focused on topics, or an empty string without topics
+func focusTopicsInstruction(topics []string) string {
+	if len(topics) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\n\nFocus the summary on these topics: %s. If the transcript does not cover these topics, say so explicitly.", strings.Join(topics, ", "))
+}
+
+// structuredSummarySchema constrains Gemini output to the StructuredSummary shape
+var structuredSummarySchema = &genai.Schema{
+	Type: genai.TypeObject,
+	Properties: map[string]*genai.Schema{
+		"title":        {Type: genai.TypeString},
+		"participants": {Type: genai.TypeArray, Items: &genai.Schema{Type: genai.TypeString}},
+		"keyPoints":    {Type: genai.TypeArray, Items: &genai.Schema{Type: genai.TypeString}},
+		"decisions":    {Type: genai.TypeArray, Items: &genai.Schema{Type: genai.TypeString}},
+		"actionItems": {
+			Type: genai.TypeArray,
+			Items: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"description": {Type: genai.TypeString},
+					"owner":       {Type: genai.TypeString},
+					"dueDate":     {Type: genai.TypeString},
+				},
+				Required: []string{"description"},
+			},
+		},
+		"conclusion": {Type: genai.TypeString},
+	},
+	Required:         []string{"title", "participants", "keyPoints", "decisions", "actionItems", "conclusion"},
+	PropertyOrdering: []string{"title", "participants", "keyPoints", "decisions", "actionItems", "conclusion"},
+}
+
+// normalizeStructuredSummary checks that a JSON summary matches StructuredSummary and re-marshals it
+func normalizeStructuredSummary(text string) (string, error) {
+	var summary StructuredSummary
+	if err := json.Unmarshal([]byte(text), &summary); err != nil {
+		return "", fmt.Errorf("invalid JSON summary: %v", err)
+	}
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling JSON summary: %v", err)
+	}
+	return string(data), nil
+}
+
+// TotalTokens returns the input and output tokens consumed
+func (r SummaryResult) TotalTokens() int32 {
+	return r.InputTokens + r.OutputTokens
+}
+
+// effectiveTokenBudget combines a client requested budget with the server-wide ceiling; 0 means unlimited.
+// The ceiling always wins so clients cannot raise their own budget above it.
+func effectiveTokenBudget(requested int32, ceiling int64) int64 {
+	budget := int64(requested)
+	if budget <= 0 || (ceiling > 0 && budget > ceiling) {
+		budget = ceiling
+	}
+	if budget < 0 {
+		return 0
+	}
+	return budget
+}
+
+// generateSummary uses Google GenAI to generate content based on the provided transcript, previous summary, prompt, custom words and chapters
+func generateSummary(ctx context.Context, projectID, location, model, fullTranscript, newTranscript, previousSummary, prompt string, customWords []string, chapters []Chapter, options SummaryOptions) (SummaryResult, error) {
+	if fullTranscript == "" {
+		return SummaryResult{}, nil
+	}
+
+	hooked := hookRegistry.Run(ctx, HookEvent{Type: HookPreSummary, Text: fullTranscript, NewTranscript: newTranscript})
+	fullTranscript, newTranscript = hooked.Text, hooked.NewTranscript
+
+	// Mark chapter boundaries so the summary can be structured by chapter
+	if len(chapters) > 0 {
+		fullTranscript = annotateChapters(fullTranscript, chapters)
+		prompt += "\n\nThe transcript contains chapter boundary markers of the form <!-- CHAPTER: title -->. Structure the summary by chapter, using the chapter titles as section headings."
+	}
+
+	// Summaries can be shared with people who do not speak the meeting language
+	if options.Language != "" {
+		prompt += fmt.Sprintf("\n\nIMPORTANT: Write the summary in %s, even though the transcript is in %s.", options.Language, options.TranscriptLanguage)
+	}
+
+	prompt += focusTopicsInstruction(options.FocusTopics)
+
+	client, err := sharedGenAIClient(projectID, location)
+	if err != nil {
+		return SummaryResult{}, err
+	}
+
+	// Transcripts beyond TRANSCRIPT_CHUNK_MAX_TOKENS are summarized chunk by chunk, and the chunk
+	// summaries stand in for the full transcript below
+	strategy := summaryStrategyDirect
+	var mapUsage SummaryResult
+	if maxTokens := int(getEnvInt64("TRANSCRIPT_CHUNK_MAX_TOKENS", defaultTranscriptChunkMaxTokens)); maxTokens > 0 && estimateTokens(fullTranscript) > maxTokens {
+		strategy = summaryStrategyMapReduce
+		// Chunks hold the same transcript text, so they need the same filtering thresholds as the summary
+		var chunkConfig *genai.GenerateContentConfig
+		if len(options.SafetySettings) > 0 {
+			chunkConfig = &genai.GenerateContentConfig{SafetySettings: options.SafetySettings}
+		}
+		fullTranscript, mapUsage, err = reduceTranscript(ctx, client, model, fullTranscript, maxTokens, chunkConfig, options.Fallback)
+		if err != nil {
+			return SummaryResult{}, err
+		}
+	}
+	// Selected after the map pass, whose chunk requests may have switched to the fallback model
+	model = options.Fallback.Select(model)
+
 	// Build the full prompt with new transcript focus, full context, previous summary, and custom words
 	var fullPrompt string
 	customWordsText := ""
@@ -37,11 +539,11 @@ func generateSummary(ctx context.Context, projectID, location, model, fullTransc
 	}
 
 	if previousSummary != "" {
-		fullPrompt = fmt.Sprintf("%s%s%s\n\n--- PREVIOUS SUMMARY ---\n%s\n\n--- FULL TRANSCRIPT (FOR CONTEXT) ---\n%s", 
+		fullPrompt = fmt.Sprintf("%s%s%s\n\n--- PREVIOUS SUMMARY ---\n%s\n\n--- FULL TRANSCRIPT (FOR CONTEXT) ---\n%s",
 			prompt, customWordsText, newTranscriptSection, previousSummary, fullTranscript)
 	} else {
 		if newTranscriptSection != "" {
-			fullPrompt = fmt.Sprintf("%s%s%s\n\n--- FULL TRANSCRIPT (FOR CONTEXT) ---\n%s", 
+			fullPrompt = fmt.Sprintf("%s%s%s\n\n--- FULL TRANSCRIPT (FOR CONTEXT) ---\n%s",
 				prompt, customWordsText, newTranscriptSection, fullTranscript)
 		} else {
 			fullPrompt = fmt.Sprintf("%s%s\n\n--- FULL TRANSCRIPT ---\n%s", prompt, customWordsText, fullTranscript)
@@ -56,17 +558,164 @@ func generateSummary(ctx context.Context, projectID, location, model, fullTransc
 		{Role: "user", Parts: parts},
 	}
 
-	resp, err := client.Models.GenerateContent(ctx, model, content, nil)
+	// Structured summaries are constrained to the schema so downstream systems can parse them
+	var generateConfig *genai.GenerateContentConfig
+	if options.Format == summaryFormatJSON {
+		generateConfig = &genai.GenerateContentConfig{
+			ResponseMIMEType: "application/json",
+			ResponseSchema:   structuredSummarySchema,
+		}
+	}
+	// Professional transcripts (medical, legal, security) can trip the default filters
+	if len(options.SafetySettings) > 0 {
+		if generateConfig == nil {
+			generateConfig = &genai.GenerateContentConfig{}
+		}
+		generateConfig.SafetySettings = options.SafetySettings
+	}
+
+	generate := func(model string) (*genai.GenerateContentResponse, error) {
+		if options.OnChunk != nil {
+			return generateContentStream(ctx, client, model, content, generateConfig, options.OnChunk)
+		}
+		return generateContent(ctx, client, model, content, generateConfig)
+	}
+	resp, err := generate(model)
+	if fallbackModel, ok := options.Fallback.Trip(model, err); ok {
+		// Chunks streamed before the quota error belong to the abandoned attempt
+		if options.OnChunk != nil && options.OnReset != nil {
+			options.OnReset()
+		}
+		resp, err = generate(fallbackModel)
+	}
 	if err != nil {
-		return "", fmt.Errorf("error generating content: %v", err)
+		return SummaryResult{}, fmt.Errorf("error generating content: %v", err)
 	}
 
 	if resp != nil && len(resp.Candidates) > 0 && len(resp.Candidates[0].Content.Parts) > 0 {
 		if resp.Candidates[0].Content.Parts[0].Text != "" {
-			return resp.Candidates[0].Content.Parts[0].Text, nil
+			result := SummaryResult{Text: resp.Candidates[0].Content.Parts[0].Text, Strategy: strategy}
+			if resp.UsageMetadata != nil {
+				result.InputTokens = resp.UsageMetadata.PromptTokenCount
+				result.OutputTokens = resp.UsageMetadata.CandidatesTokenCount
+			}
+			result.InputTokens += mapUsage.InputTokens
+			result.OutputTokens += mapUsage.OutputTokens
+			if options.Format == summaryFormatJSON {
+				if result.Text, err = normalizeStructuredSummary(result.Text); err != nil {
+					return SummaryResult{}, err
+				}
+			} else {
+				result.Text = splitLongParagraphs(result.Text, options.MaxParagraphLength)
+			}
+			return result, nil
 		}
 	}
 
-	return "", fmt.Errorf("no content generated")
+	return SummaryResult{}, fmt.Errorf("no content generated")
+}
+
+// maxKeywordSuggestions is the maximum number of keywords suggested at once
+const maxKeywordSuggestions = 5
+
+// suggestKeywords asks Gemini for technical or domain-specific terms from the transcript that are not already boosted
+func suggestKeywords(ctx context.Context, projectID, location, model, transcript string, existingKeywords []string) ([]string, error) {
+	if strings.TrimSpace(transcript) == "" {
+		return nil, nil
+	}
+
+	client, err := genai.NewClient(ctx, &genai.ClientConfig{
+		Project:     projectID,
+		Location:    location,
+		Backend:     genai.BackendVertexAI,
+		Credentials: gcpCredentials,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating GenAI client: %v", err)
+	}
+
+	prompt := fmt.Sprintf(`Identify up to %d technical or domain-specific terms from the following transcript that would improve speech recognition accuracy if boosted.
+Do not include any of these existing keywords: %s
+Reply with one term per line, without numbering, bullets or explanations.
+
+--- TRANSCRIPT ---
+%s`, maxKeywordSuggestions, strings.Join(existingKeywords, ", "), transcript)
+
+	content := []*genai.Content{
+		{Role: "user", Parts: []*genai.Part{{Text: prompt}}},
+	}
+
+	resp, err := generateContent(ctx, client, model, content, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error generating content: %v", err)
+	}
+
+	if resp == nil || len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil || len(resp.Candidates[0].Content.Parts) == 0 {
+		return nil, fmt.Errorf("no content generated")
+	}
+
+	return filterKeywordSuggestions(strings.Split(resp.Candidates[0].Content.Parts[0].Text, "\n"), existingKeywords, maxKeywordSuggestions), nil
+}
+
+// filterKeywordSuggestions cleans up suggested terms and drops duplicates and terms already in the keyword list
+func filterKeywordSuggestions(suggestions, existingKeywords []string, max int) []string {
+	seen := make(map[string]bool)
+	for _, keyword := range existingKeywords {
+		seen[strings.ToLower(strings.TrimSpace(keyword))] = true
+	}
+
+	var words []string
+	for _, suggestion := range suggestions {
+		word := strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(suggestion), "-*•0123456789. "))
+		key := strings.ToLower(word)
+		if word == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		words = append(words, word)
+		if len(words) == max {
+			break
+		}
+	}
+	return words
 }
 
+// punctuateWithGemini asks Gemini to add punctuation and capitalization to a transcript segment without changing its words
+func punctuateWithGemini(ctx context.Context, projectID, location, model, text string) (SummaryResult, error) {
+	if strings.TrimSpace(text) == "" {
+		return SummaryResult{Text: text}, nil
+	}
+
+	client, err := sharedGenAIClient(projectID, location)
+	if err != nil {
+		return SummaryResult{}, err
+	}
+
+	prompt := fmt.Sprintf(`Add punctuation and capitalization to the following speech transcript. Do not add, remove, reorder or translate any words.
+Reply with the punctuated transcript only.
+
+%s`, text)
+
+	content := []*genai.Content{
+		{Role: "user", Parts: []*genai.Part{{Text: prompt}}},
+	}
+
+	resp, err := generateContent(ctx, client, model, content, nil)
+	if err != nil {
+		return SummaryResult{}, fmt.Errorf("error generating content: %v", err)
+	}
+
+	if resp == nil || len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil || len(resp.Candidates[0].Content.Parts) == 0 {
+		return SummaryResult{}, fmt.Errorf("no content generated")
+	}
+
+	result := SummaryResult{Text: strings.TrimSpace(resp.Candidates[0].Content.Parts[0].Text)}
+	if resp.UsageMetadata != nil {
+		result.InputTokens = resp.UsageMetadata.PromptTokenCount
+		result.OutputTokens = resp.UsageMetadata.CandidatesTokenCount
+	}
+	if result.Text == "" {
+		return SummaryResult{}, fmt.Errorf("no content generated")
+	}
+	return result, nil
+}
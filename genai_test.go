@@ -0,0 +1,641 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/genai"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeGemini serves generateContent requests, answering each with reply and recording the requests by model
+type fakeGemini struct {
+	mu       sync.Mutex
+	requests map[string][]map[string]interface{}
+	reply    func(model string) (status int, text string)
+}
+
+func (f *fakeGemini) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Paths look like /v1beta/models/<model>:generateContent or :streamGenerateContent
+	model, method, _ := strings.Cut(r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:], ":")
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+	f.mu.Lock()
+	f.requests[model] = append(f.requests[model], body)
+	f.mu.Unlock()
+
+	status, text := http.StatusOK, "summary"
+	if f.reply != nil {
+		status, text = f.reply(model)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if status != http.StatusOK {
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]interface{}{"code": status, "message": text, "status": "RESOURCE_EXHAUSTED"}})
+		return
+	}
+	if method == "streamGenerateContent" {
+		// Streamed replies send each "|"-separated part of the text as its own chunk
+		for _, part := range strings.Split(text, "|") {
+			fmt.Fprintf(w, "data: %s\n\n", fakeGeminiResponse(part))
+		}
+		return
+	}
+	w.Write(fakeGeminiResponse(strings.ReplaceAll(text, "|", "")))
+}
+
+// fakeGeminiResponse encodes a generateContent response holding text
+func fakeGeminiResponse(text string) []byte {
+	response, _ := json.Marshal(map[string]interface{}{
+		"candidates":    []interface{}{map[string]interface{}{"content": map[string]interface{}{"role": "model", "parts": []interface{}{map[string]interface{}{"text": text}}}}},
+		"usageMetadata": map[string]interface{}{"promptTokenCount": 10, "candidatesTokenCount": 2},
+	})
+	return response
+}
+
+// newFakeGeminiClient starts a fakeGemini and returns a GenAI client sending requests to it
+func newFakeGeminiClient(t *testing.T, reply func(model string) (int, string)) (*genai.Client, *fakeGemini) {
+	t.Helper()
+	fake := &fakeGemini{requests: map[string][]map[string]interface{}{}, reply: reply}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	client, err := genai.NewClient(context.Background(), &genai.ClientConfig{
+		APIKey:      "test",
+		Backend:     genai.BackendGeminiAPI,
+		HTTPOptions: genai.HTTPOptions{BaseURL: server.URL},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, fake
+}
+
+// prompt returns the text of the first part of a recorded generateContent request
+func (f *fakeGemini) prompt(request map[string]interface{}) string {
+	contents, _ := request["contents"].([]interface{})
+	if len(contents) == 0 {
+		return ""
+	}
+	parts, _ := contents[0].(map[string]interface{})["parts"].([]interface{})
+	if len(parts) == 0 {
+		return ""
+	}
+	text, _ := parts[0].(map[string]interface{})["text"].(string)
+	return text
+}
+
+func TestChunkTranscript(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		maxTokens int
+		want      []string
+	}{
+		{"fits in one chunk", "Short text.", 5, []string{"Short text."}},
+		{"no limit", "The team met today. Budget is fine.", 0, []string{"The team met today. Budget is fine."}},
+		{"cut at sentence boundaries", "The team met today. Budget is fine. We ship soon.", 5, []string{"The team met today.", "Budget is fine.", "We ship soon."}},
+		{"sentences grouped up to the limit", "One. Two. Three. Four.", 3, []string{"One. Two.", "Three. Four."}},
+		{"decimal point is not a boundary", "Revenue grew 2.5 percent. Costs fell.", 8, []string{"Revenue grew 2.5 percent.", "Costs fell."}},
+		{"over-long sentence cut at words", "Short. This sentence is far too long.", 3, []string{"Short.", "This", "sentence is", "far too", "long."}},
+		{"sized in runes, not bytes", "Déjà vu. Été.", 4, []string{"Déjà vu. Été."}},
+		{"accented sentences cut by rune count", "Café déjà vu. Été très chaud.", 4, []string{"Café déjà vu.", "Été très chaud."}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := chunkTranscript(tt.text, tt.maxTokens); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("chunkTranscript(%q, %d) = %q, want %q", tt.text, tt.maxTokens, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitSentences(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"empty", "", nil},
+		{"no terminator", "still talking", []string{"still talking"}},
+		{"all terminators", "One. Two! Three? Four", []string{"One. ", "Two! ", "Three? ", "Four"}},
+		{"decimal point", "Pi is 3.14 today. Really.", []string{"Pi is 3.14 today. ", "Really."}},
+		{"whitespace kept with the sentence", "Done.\nNext.  Last.", []string{"Done.\n", "Next.  ", "Last."}},
+		{"ellipsis", "Wait... what?", []string{"Wait... ", "what?"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitSentences(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitSentences(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReduceTranscriptSafetySettings(t *testing.T) {
+	safetySettings := []*genai.SafetySetting{{Category: genai.HarmCategoryDangerousContent, Threshold: genai.HarmBlockThresholdBlockOnlyHigh}}
+	tests := []struct {
+		name       string
+		config     *genai.GenerateContentConfig
+		wantFilter bool
+	}{
+		{"default filters", nil, false},
+		{"session safety settings", &genai.GenerateContentConfig{SafetySettings: safetySettings}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, fake := newFakeGeminiClient(t, nil)
+			transcript := strings.Repeat("The patient reported chest pain after the procedure. ", 40)
+			if _, _, err := reduceTranscript(context.Background(), client, "gemini-test", transcript, 200, tt.config, nil); err != nil {
+				t.Fatal(err)
+			}
+			requests := fake.requests["gemini-test"]
+			if len(requests) < 2 {
+				t.Fatalf("%d chunk requests, want several", len(requests))
+			}
+			for _, request := range requests {
+				if _, ok := request["safetySettings"]; ok != tt.wantFilter {
+					t.Errorf("chunk request has safetySettings = %v, want %v", ok, tt.wantFilter)
+				}
+			}
+		})
+	}
+}
+
+func TestReduceTranscriptFallback(t *testing.T) {
+	tests := []struct {
+		name        string
+		quotaErrors bool
+		wantModel   string
+	}{
+		{"requested model available", false, "gemini-pro"},
+		{"quota exceeded", true, "gemini-lite"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, fake := newFakeGeminiClient(t, func(model string) (int, string) {
+				if tt.quotaErrors && model == "gemini-pro" {
+					return http.StatusTooManyRequests, "quota exceeded"
+				}
+				return http.StatusOK, model + " summary"
+			})
+			var switches int
+			fallback := newModelFallback("gemini-lite", time.Minute, func(requested, actual string) { switches++ })
+			transcript := strings.Repeat("The budget review moved to next quarter. ", 40)
+			reduced, _, err := reduceTranscript(context.Background(), client, "gemini-pro", transcript, 200, nil, fallback)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Count(reduced, tt.wantModel+" summary") < 2 {
+				t.Errorf("reduced transcript = %q, want chunk summaries from %s", reduced, tt.wantModel)
+			}
+			if got := fallback.Select("gemini-pro"); got != tt.wantModel {
+				t.Errorf("Select() after the map pass = %q, want %q", got, tt.wantModel)
+			}
+			if tt.quotaErrors && (switches == 0 || len(fake.requests["gemini-lite"]) < 2) {
+				t.Errorf("%d switches and %d fallback requests, want the chunks retried on the fallback model", switches, len(fake.requests["gemini-lite"]))
+			}
+		})
+	}
+}
+
+func TestModelFallbackTrip(t *testing.T) {
+	quotaErr := genai.APIError{Code: http.StatusTooManyRequests, Status: "RESOURCE_EXHAUSTED"}
+	tests := []struct {
+		name       string
+		fallback   string
+		model      string
+		err        error
+		wantSwitch bool
+	}{
+		{"HTTP 429", "gemini-lite", "gemini-pro", quotaErr, true},
+		{"RESOURCE_EXHAUSTED status", "gemini-lite", "gemini-pro", genai.APIError{Code: http.StatusBadRequest, Status: "RESOURCE_EXHAUSTED"}, true},
+		{"gRPC resource exhausted", "gemini-lite", "gemini-pro", status.Error(codes.ResourceExhausted, "quota"), true},
+		{"other API error", "gemini-lite", "gemini-pro", genai.APIError{Code: http.StatusInternalServerError, Status: "INTERNAL"}, false},
+		{"fallback model out of quota", "gemini-lite", "gemini-lite", quotaErr, false},
+		{"no fallback model", "", "gemini-pro", quotaErr, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var switches []string
+			fallback := newModelFallback(tt.fallback, time.Minute, func(requested, actual string) {
+				switches = append(switches, requested+"->"+actual)
+			})
+			retryModel, switched := fallback.Trip(tt.model, tt.err)
+			if switched != tt.wantSwitch {
+				t.Fatalf("Trip() switched = %v, want %v", switched, tt.wantSwitch)
+			}
+			wantSelected, wantSwitches := tt.model, []string(nil)
+			if tt.wantSwitch {
+				wantSelected, wantSwitches = tt.fallback, []string{tt.model + "->" + tt.fallback}
+				if retryModel != tt.fallback {
+					t.Errorf("Trip() retry model = %q, want %q", retryModel, tt.fallback)
+				}
+			}
+			if got := fallback.Select(tt.model); got != wantSelected {
+				t.Errorf("Select() = %q, want %q", got, wantSelected)
+			}
+			if !reflect.DeepEqual(switches, wantSwitches) {
+				t.Errorf("switches = %v, want %v", switches, wantSwitches)
+			}
+		})
+	}
+}
+
+func TestModelFallbackReset(t *testing.T) {
+	fallback := newModelFallback("gemini-lite", 50*time.Millisecond, nil)
+	fallback.Trip("gemini-pro", genai.APIError{Code: http.StatusTooManyRequests})
+	if got := fallback.Select("gemini-pro"); got != "gemini-lite" {
+		t.Fatalf("Select() during the fallback period = %q, want gemini-lite", got)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if got := fallback.Select("gemini-pro"); got != "gemini-pro" {
+		t.Errorf("Select() after GEMINI_FALLBACK_RESET_MINUTES = %q, want the requested model again", got)
+	}
+}
+
+func TestGenerateSummaryStreamResetOnFallback(t *testing.T) {
+	tests := []struct {
+		name        string
+		quotaErrors bool
+		wantResets  int
+		wantText    string
+	}{
+		{"no quota error", false, 0, "gemini-pro summary"},
+		{"quota exceeded", true, 1, "gemini-lite summary"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := newFakeGeminiClient(t, func(model string) (int, string) {
+				if tt.quotaErrors && model == "gemini-pro" {
+					return http.StatusTooManyRequests, "quota exceeded"
+				}
+				return http.StatusOK, model + " summary"
+			})
+			genAIClientsMu.Lock()
+			genAIClients["project/"+tt.name] = client
+			genAIClientsMu.Unlock()
+
+			var events []string
+			options := SummaryOptions{
+				OnChunk:  func(text string) { events = append(events, "chunk:"+text) },
+				OnReset:  func() { events = append(events, "reset") },
+				Fallback: newModelFallback("gemini-lite", time.Minute, nil),
+			}
+			result, err := generateSummary(context.Background(), "project", tt.name, "gemini-pro", "We agreed on the launch date.", "", "", "Summarize.", nil, nil, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Text != tt.wantText {
+				t.Errorf("summary = %q, want %q", result.Text, tt.wantText)
+			}
+			var resets int
+			for i, event := range events {
+				if event == "reset" {
+					resets++
+					if i != 0 {
+						t.Errorf("events = %v, want the reset before any chunk of the new attempt", events)
+					}
+				}
+			}
+			if resets != tt.wantResets {
+				t.Errorf("%d resets, want %d (events %v)", resets, tt.wantResets, events)
+			}
+		})
+	}
+}
+
+func TestGenerateSummaryStreamsChunks(t *testing.T) {
+	tests := []struct {
+		name       string
+		stream     bool
+		wantChunks []string
+	}{
+		{"streamed", true, []string{"The team ", "agreed on ", "Friday."}},
+		{"not streamed", false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, fake := newFakeGeminiClient(t, func(model string) (int, string) {
+				return http.StatusOK, "The team |agreed on |Friday."
+			})
+			genAIClientsMu.Lock()
+			genAIClients["project/stream-"+tt.name] = client
+			genAIClientsMu.Unlock()
+
+			var chunks []string
+			var options SummaryOptions
+			if tt.stream {
+				options.OnChunk = func(text string) { chunks = append(chunks, text) }
+			}
+			result, err := generateSummary(context.Background(), "project", "stream-"+tt.name, "gemini-test", "We agreed on Friday.", "", "", "Summarize.", nil, nil, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(chunks, tt.wantChunks) {
+				t.Errorf("chunks = %q, want %q", chunks, tt.wantChunks)
+			}
+			if result.Text != "The team agreed on Friday." {
+				t.Errorf("summary = %q, want the chunks joined", result.Text)
+			}
+			if len(fake.requests["gemini-test"]) != 1 {
+				t.Errorf("%d requests, want 1", len(fake.requests["gemini-test"]))
+			}
+		})
+	}
+}
+
+func TestGenerateSummaryParagraphLength(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxLength int
+		want      string
+	}{
+		{"unlimited", 0, "The team met. They agreed on Friday."},
+		{"split", 20, "The team met.\n\nThey agreed on Friday."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := newFakeGeminiClient(t, func(model string) (int, string) {
+				return http.StatusOK, "The team met. They agreed on Friday."
+			})
+			genAIClientsMu.Lock()
+			genAIClients["project/paragraphs-"+tt.name] = client
+			genAIClientsMu.Unlock()
+
+			options := SummaryOptions{MaxParagraphLength: tt.maxLength}
+			result, err := generateSummary(context.Background(), "project", "paragraphs-"+tt.name, "gemini-test", "We met and agreed on Friday.", "", "", "Summarize.", nil, nil, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Text != tt.want {
+				t.Errorf("summary = %q, want %q", result.Text, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateSummaryLanguage(t *testing.T) {
+	tests := []struct {
+		name            string
+		summaryLanguage string
+		reply           string
+		wantInstruction bool
+	}{
+		{"transcript language", "", "The team agreed to ship on Friday.", false},
+		{"same language", "en-GB", "The team agreed to ship on Friday.", false},
+		{"french", "fr", "L'équipe a convenu de livrer vendredi.", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, fake := newFakeGeminiClient(t, func(model string) (int, string) {
+				return http.StatusOK, tt.reply
+			})
+			genAIClientsMu.Lock()
+			genAIClients["project/language-"+tt.name] = client
+			genAIClientsMu.Unlock()
+
+			language, err := selectSummaryLanguage(tt.summaryLanguage, "en-US")
+			if err != nil {
+				t.Fatal(err)
+			}
+			options := SummaryOptions{Language: language, TranscriptLanguage: "en-US"}
+			result, err := generateSummary(context.Background(), "project", "language-"+tt.name, "gemini-test", "We agreed to ship on Friday.", "", "", "Summarize.", nil, nil, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Text != tt.reply {
+				t.Errorf("summary = %q, want %q", result.Text, tt.reply)
+			}
+			requests := fake.requests["gemini-test"]
+			if len(requests) != 1 {
+				t.Fatalf("%d requests, want 1", len(requests))
+			}
+			instruction := "Write the summary in fr, even though the transcript is in en-US."
+			if got := strings.Contains(fake.prompt(requests[0]), instruction); got != tt.wantInstruction {
+				t.Errorf("prompt contains %q = %v, want %v", instruction, got, tt.wantInstruction)
+			}
+		})
+	}
+}
+
+func TestNormalizeFocusTopics(t *testing.T) {
+	tests := []struct {
+		name   string
+		topics []string
+		want   []string
+	}{
+		{"none", nil, nil},
+		{"trimmed", []string{"  budget ", "hiring\t"}, []string{"budget", "hiring"}},
+		{"empty dropped", []string{"", "   ", "roadmap"}, []string{"roadmap"}},
+		{"duplicates dropped", []string{"Budget", "budget", " BUDGET ", "hiring"}, []string{"Budget", "hiring"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeFocusTopics(tt.topics); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeFocusTopics(%q) = %q, want %q", tt.topics, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFocusTopicsInstruction(t *testing.T) {
+	tests := []struct {
+		name   string
+		topics []string
+		want   string
+	}{
+		{"no topics", nil, ""},
+		{"one topic", []string{"budget"}, "\n\nFocus the summary on these topics: budget. If the transcript does not cover these topics, say so explicitly."},
+		{"several topics", []string{"budget", "hiring"}, "\n\nFocus the summary on these topics: budget, hiring. If the transcript does not cover these topics, say so explicitly."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := focusTopicsInstruction(tt.topics); got != tt.want {
+				t.Errorf("focusTopicsInstruction(%q) = %q, want %q", tt.topics, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateSummaryFocusTopics(t *testing.T) {
+	client, fake := newFakeGeminiClient(t, nil)
+	genAIClientsMu.Lock()
+	genAIClients["project/focus-topics"] = client
+	genAIClientsMu.Unlock()
+
+	options := SummaryOptions{FocusTopics: normalizeFocusTopics([]string{" budget", "Budget", "hiring "})}
+	if _, err := generateSummary(context.Background(), "project", "focus-topics", "gemini-test", "We discussed the budget and two open positions.", "", "", "Summarize.", nil, nil, options); err != nil {
+		t.Fatal(err)
+	}
+	requests := fake.requests["gemini-test"]
+	if len(requests) != 1 {
+		t.Fatalf("%d requests, want 1", len(requests))
+	}
+	if prompt, want := fake.prompt(requests[0]), "Focus the summary on these topics: budget, hiring."; !strings.Contains(prompt, want) {
+		t.Errorf("prompt %q does not contain %q", prompt, want)
+	}
+}
+
+func TestSummarySemaphoreLimitsConcurrency(t *testing.T) {
+	tests := []struct {
+		maxConcurrent string
+		wantSlots     int
+	}{
+		{"2", 2},
+		{"0", 1},
+		{"", 2},
+	}
+	for _, tt := range tests {
+		t.Run("MAX_CONCURRENT_SUMMARIES="+tt.maxConcurrent, func(t *testing.T) {
+			t.Setenv("MAX_CONCURRENT_SUMMARIES", tt.maxConcurrent)
+			semaphore := newSummarySemaphore()
+
+			// Five summaries requested at once against a generator that sleeps
+			var active, peak, started atomic.Int32
+			var wg sync.WaitGroup
+			for range 5 {
+				release, ok := tryAcquireSlot(semaphore)
+				if !ok {
+					continue
+				}
+				started.Add(1)
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer release()
+					current := active.Add(1)
+					for {
+						previous := peak.Load()
+						if current <= previous || peak.CompareAndSwap(previous, current) {
+							break
+						}
+					}
+					time.Sleep(20 * time.Millisecond)
+					active.Add(-1)
+				}()
+			}
+			wg.Wait()
+			if started.Load() != int32(tt.wantSlots) || peak.Load() > int32(tt.wantSlots) {
+				t.Errorf("%d summaries started, %d at once; want at most %d", started.Load(), peak.Load(), tt.wantSlots)
+			}
+			if _, ok := tryAcquireSlot(semaphore); !ok {
+				t.Error("slots not released after the summaries finished")
+			}
+		})
+	}
+}
+
+func TestModelSemaphoreLimitsConcurrency(t *testing.T) {
+	previousLimit, previousTimeout := modelSemaphoreLimit, modelQueueTimeout
+	t.Cleanup(func() { modelSemaphoreLimit, modelQueueTimeout = previousLimit, previousTimeout })
+	modelSemaphoreLimit, modelQueueTimeout = 2, 5*time.Second
+
+	// Six requests at once against a model that answers slowly
+	var active, peak atomic.Int32
+	client, fake := newFakeGeminiClient(t, func(model string) (int, string) {
+		current := active.Add(1)
+		defer active.Add(-1)
+		for {
+			previous := peak.Load()
+			if current <= previous || peak.CompareAndSwap(previous, current) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		return http.StatusOK, "summary"
+	})
+	var wg sync.WaitGroup
+	for range 6 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := generateContent(context.Background(), client, "gemini-semaphore-test", genai.Text("hello"), nil); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := len(fake.requests["gemini-semaphore-test"]); got != 6 {
+		t.Errorf("%d requests served, want 6", got)
+	}
+	if peak.Load() != 2 {
+		t.Errorf("%d requests in flight at once, want 2", peak.Load())
+	}
+}
+
+func TestAcquireModelSlot(t *testing.T) {
+	previousLimit, previousTimeout := modelSemaphoreLimit, modelQueueTimeout
+	t.Cleanup(func() { modelSemaphoreLimit, modelQueueTimeout = previousLimit, previousTimeout })
+	modelSemaphoreLimit = 1
+
+	tests := []struct {
+		name         string
+		queueTimeout time.Duration
+		cancelled    bool
+		wantErr      error
+	}{
+		{"queue timeout", 20 * time.Millisecond, false, nil},
+		{"cancelled while queued", 0, true, context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modelQueueTimeout = tt.queueTimeout
+			model := "gemini-slot-test-" + tt.name
+			release, err := acquireModelSlot(context.Background(), model)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			if tt.cancelled {
+				time.AfterFunc(20*time.Millisecond, cancel)
+			}
+			defer cancel()
+			if _, err := acquireModelSlot(ctx, model); err == nil || (tt.wantErr != nil && err != tt.wantErr) {
+				t.Errorf("acquireModelSlot() with every slot taken = %v, want an error", err)
+			}
+
+			// A released slot can be taken again
+			release()
+			if release, err := acquireModelSlot(context.Background(), model); err != nil {
+				t.Errorf("acquireModelSlot() after release = %v", err)
+			} else {
+				release()
+			}
+		})
+	}
+}
+
+func TestFilterKeywordSuggestions(t *testing.T) {
+	tests := []struct {
+		name        string
+		suggestions []string
+		existing    []string
+		max         int
+		want        []string
+	}{
+		{"list markers stripped", []string{"- Kubernetes", "* Terraform", "1. BigQuery", "• Vertex AI"}, nil, 10, []string{"Kubernetes", "Terraform", "BigQuery", "Vertex AI"}},
+		{"existing keywords excluded case-insensitively", []string{"kubernetes", "Terraform", "Cloud Run"}, []string{" Kubernetes ", "cloud run"}, 10, []string{"Terraform"}},
+		{"duplicate suggestions dropped", []string{"Terraform", "terraform", "- TERRAFORM"}, nil, 10, []string{"Terraform"}},
+		{"empty suggestions skipped", []string{"", "  ", "-", "Pub/Sub"}, nil, 10, []string{"Pub/Sub"}},
+		{"capped at max after exclusions", []string{"GKE", "Anthos", "Spanner", "Bigtable"}, []string{"gke"}, 2, []string{"Anthos", "Spanner"}},
+		{"everything already known", []string{"GKE"}, []string{"GKE"}, 10, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := filterKeywordSuggestions(tt.suggestions, tt.existing, tt.max); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("filterKeywordSuggestions() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
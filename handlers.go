@@ -1,18 +1,146 @@
 package main
 
 import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/subtle"
 	"embed"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"html/template"
+	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1"
 )
 
 //go:embed ui
 var uiFiles embed.FS
 
+// timeoutMiddleware returns a middleware that fails requests taking longer than d with a 503; d <= 0 disables the timeout
+func timeoutMiddleware(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if d <= 0 {
+			return next
+		}
+		return http.TimeoutHandler(next, d, `{"error":"request timeout"}`)
+	}
+}
+
+// gzipResponseWriter compresses the response body once the handler writes a status that allows one
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz              *gzip.Writer
+	compressed      *countingWriter
+	wroteHeader     bool
+	uncompressedLen int64
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+// Write forwards to the underlying writer and counts the bytes written
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// WriteHeader switches to gzip encoding unless the status has no body or the handler set its own encoding
+func (w *gzipResponseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if code != http.StatusNoContent && code != http.StatusNotModified && w.Header().Get("Content-Encoding") == "" {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Del("Content-Length")
+		w.compressed = &countingWriter{w: w.ResponseWriter}
+		w.gz = gzip.NewWriter(w.compressed)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write compresses p, sniffing the content type from the uncompressed bytes when the handler did not set one
+func (w *gzipResponseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gz == nil {
+		return w.ResponseWriter.Write(p)
+	}
+	w.uncompressedLen += int64(len(p))
+	return w.gz.Write(p)
+}
+
+// Flush writes pending compressed data to the client
+func (w *gzipResponseWriter) Flush() {
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip, honouring q=0 refusals
+func acceptsGzip(acceptEncoding string) bool {
+	wildcard := false
+	for _, coding := range parseAccept(acceptEncoding) {
+		switch coding.MediaType {
+		case "gzip":
+			return coding.Quality > 0
+		case "*":
+			wildcard = coding.Quality > 0
+		}
+	}
+	return wildcard
+}
+
+// gzipMiddleware compresses responses for clients accepting gzip; DISABLE_GZIP=true turns it off
+// for clients that advertise gzip without supporting it
+func gzipMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if os.Getenv("DISABLE_GZIP") == "true" || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(gw, r)
+		if gw.gz == nil {
+			return
+		}
+		if err := gw.gz.Close(); err != nil {
+			logger.Error("Failed to finish gzip response", "path", r.URL.Path, "error", err)
+			return
+		}
+		if gw.uncompressedLen > 0 {
+			logger.Debug("Response compressed",
+				"path", r.URL.Path,
+				"uncompressedBytes", gw.uncompressedLen,
+				"compressedBytes", gw.compressed.n,
+				"ratio", float64(gw.compressed.n)/float64(gw.uncompressedLen))
+		}
+	})
+}
+
 // serveDefaultPrompt serves the default summary prompt as JSON
 func serveDefaultPrompt(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -226,6 +354,127 @@ func parsePresetFile(content string) (*Preset, error) {
 	return preset, nil
 }
 
+// presetFormatVersion is the version written to JSON preset files
+const presetFormatVersion = 2
+
+// migratePreset parses a preset in either the JSON format or the legacy line-based format
+func migratePreset(content string) (*Preset, error) {
+	trimmed := strings.TrimSpace(content)
+	switch {
+	case strings.HasPrefix(trimmed, "{"):
+		var v2 PresetV2
+		if err := json.Unmarshal([]byte(trimmed), &v2); err != nil {
+			return nil, fmt.Errorf("error parsing JSON preset: %v", err)
+		}
+		return &Preset{Title: v2.Title, Summary: v2.Summary, Conclusion: v2.Conclusion}, nil
+	case strings.HasPrefix(trimmed, "Title:"):
+		return parsePresetFile(content)
+	default:
+		return nil, errors.New("unknown preset format: expected JSON or a legacy file starting with \"Title:\"")
+	}
+}
+
+// isValidPresetName reports whether name is safe to use as a preset file name; the rules are those of session IDs
+func isValidPresetName(name string) bool {
+	return isValidSessionID(name)
+}
+
+// readPreset loads a preset by name, preferring <name>.json over the legacy <name>.txt
+func readPreset(presetDir, name string) (*Preset, error) {
+	for _, extension := range []string{".json", ".txt"} {
+		content, err := os.ReadFile(filepath.Join(presetDir, name+extension))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return migratePreset(string(content))
+	}
+	return nil, os.ErrNotExist
+}
+
+// serveMigratePreset converts a legacy <name>.txt preset to <name>.json and returns the parsed preset
+func serveMigratePreset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireAdminKey(w, r) {
+		return
+	}
+
+	name := r.PathValue("name")
+	if !isValidPresetName(name) {
+		http.Error(w, "Invalid preset name", http.StatusBadRequest)
+		return
+	}
+
+	presetDir := getPresetDirectory()
+	legacyPath := filepath.Join(presetDir, name+".txt")
+	jsonPath := filepath.Join(presetDir, name+".json")
+
+	content, err := os.ReadFile(legacyPath)
+	if os.IsNotExist(err) {
+		// Already migrated: return the JSON preset so the call is idempotent
+		preset, err := readPreset(presetDir, name)
+		if err != nil {
+			http.Error(w, "Preset not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(preset)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to read preset file", "file", legacyPath, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	preset, err := migratePreset(string(content))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	data, err := json.MarshalIndent(PresetV2{
+		Version:    presetFormatVersion,
+		Title:      preset.Title,
+		Summary:    preset.Summary,
+		Conclusion: preset.Conclusion,
+	}, "", "  ")
+	if err != nil {
+		logger.Error("Failed to marshal migrated preset", "preset", name, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Write to a temporary file first so a failed write never leaves a truncated preset
+	tmpPath := jsonPath + ".tmp"
+	if err := os.WriteFile(tmpPath, append(data, '\n'), 0644); err != nil {
+		logger.Error("Failed to write migrated preset", "file", tmpPath, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := os.Rename(tmpPath, jsonPath); err != nil {
+		os.Remove(tmpPath)
+		logger.Error("Failed to write migrated preset", "file", jsonPath, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := os.Remove(legacyPath); err != nil {
+		logger.Warn("Failed to remove legacy preset after migration", "file", legacyPath, "error", err)
+	}
+	logger.Info("Preset migrated to JSON", "preset", name, "file", jsonPath)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(preset); err != nil {
+		logger.Error("Failed to encode preset response", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
 // servePresets serves the list of available presets
 func servePresets(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -233,6 +482,15 @@ func servePresets(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The preset watcher keeps the listing up to date without reading every file
+	if presetWatcher != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(presetWatcher.Titles()); err != nil {
+			logger.Error("Failed to encode presets response", "error", err)
+		}
+		return
+	}
+
 	presetDir := getPresetDirectory()
 	presets := make(map[string]string)
 
@@ -252,9 +510,14 @@ func servePresets(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Process each .txt file
+	// Process each .json and legacy .txt file; a JSON preset takes precedence over a legacy one of the same name
 	for _, file := range files {
-		if file.IsDir() || !strings.HasSuffix(file.Name(), ".txt") {
+		extension := filepath.Ext(file.Name())
+		if file.IsDir() || (extension != ".json" && extension != ".txt") {
+			continue
+		}
+		presetName := strings.TrimSuffix(file.Name(), extension)
+		if _, seen := presets[presetName]; seen && extension == ".txt" {
 			continue
 		}
 
@@ -265,13 +528,12 @@ func servePresets(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 
-		preset, err := parsePresetFile(string(content))
+		preset, err := migratePreset(string(content))
 		if err != nil {
 			logger.Error("Failed to parse preset file", "file", filePath, "error", err)
 			continue
 		}
 
-		presetName := strings.TrimSuffix(file.Name(), ".txt")
 		presets[presetName] = preset.Title
 	}
 
@@ -295,34 +557,1019 @@ func servePreset(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Preset name required", http.StatusBadRequest)
 		return
 	}
+	if !isValidPresetName(path) {
+		http.Error(w, "Invalid preset name", http.StatusBadRequest)
+		return
+	}
 
-	presetDir := getPresetDirectory()
-	filePath := filepath.Join(presetDir, path+".txt")
-
-	// Check if file exists
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+	// Serve the watched preset, or read and parse the JSON preset from disk, falling back to the legacy format
+	var preset *Preset
+	var err error
+	if cached, ok := presetWatcher.Get(path); ok {
+		preset = cached
+	} else {
+		preset, err = readPreset(getPresetDirectory(), path)
+	}
+	if os.IsNotExist(err) {
 		http.Error(w, "Preset not found", http.StatusNotFound)
 		return
 	}
+	if err != nil {
+		logger.Error("Failed to read preset", "preset", path, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(preset); err != nil {
+		logger.Error("Failed to encode preset response", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// serveSessionExport builds a ZIP archive of a live or persisted session and streams it to the client;
+// format=docx returns a Word document instead and can also be fetched with GET
+func serveSessionExport(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if r.Method != http.MethodPost && !(r.Method == http.MethodGet && format == "docx") {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if format != "" && format != "zip" && format != "docx" {
+		http.Error(w, "Unsupported export format", http.StatusBadRequest)
+		return
+	}
+
+	sessionID := r.PathValue("sessionID")
+	if !isValidSessionID(sessionID) {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	archive, err := findSessionArchive(sessionID)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		logger.Error("Failed to load session for export", "sessionID", sessionID, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
-	// Read and parse preset file
-	content, err := os.ReadFile(filePath)
+	var data []byte
+	if format == "docx" {
+		data, err = exportToDocx(archive.Segments, archive.Summary, archive.Metadata)
+	} else {
+		data, err = buildSessionZip(archive)
+	}
 	if err != nil {
-		logger.Error("Failed to read preset file", "file", filePath, "error", err)
+		logger.Error("Failed to build session export", "sessionID", sessionID, "format", format, "error", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	preset, err := parsePresetFile(string(content))
+	logger.Info("Session exported",
+		"sessionID", sessionID,
+		"format", format,
+		"segments", len(archive.Segments),
+		"bytes", len(data))
+
+	if format == "docx" {
+		w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.wordprocessingml.document")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="session-%s.docx"`, sessionID))
+	} else {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="session-%s.zip"`, sessionID))
+	}
+	w.Write(data)
+}
+
+// buildSessionZip creates an in-memory ZIP archive with the transcript, summary, word timings and metadata
+func buildSessionZip(archive *SessionArchive) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	// transcript.jsonl: one segment per line
+	var transcript bytes.Buffer
+	encoder := json.NewEncoder(&transcript)
+	for _, segment := range archive.Segments {
+		if err := encoder.Encode(segment); err != nil {
+			return nil, fmt.Errorf("error encoding segment: %v", err)
+		}
+	}
+
+	// word_timings.json: all words across segments
+	type segmentWordTiming struct {
+		SegmentIndex int `json:"segmentIndex"`
+		WordTiming
+	}
+	wordTimings := []segmentWordTiming{}
+	for _, segment := range archive.Segments {
+		for _, word := range segment.Words {
+			wordTimings = append(wordTimings, segmentWordTiming{SegmentIndex: segment.Index, WordTiming: word})
+		}
+	}
+	wordTimingsData, err := json.MarshalIndent(wordTimings, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error encoding word timings: %v", err)
+	}
+
+	chapters := archive.Chapters
+	if chapters == nil {
+		chapters = []Chapter{}
+	}
+	chaptersData, err := json.MarshalIndent(chapters, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error encoding chapters: %v", err)
+	}
+
+	metadataData, err := json.MarshalIndent(archive.Metadata, "", "  ")
 	if err != nil {
-		logger.Error("Failed to parse preset file", "file", filePath, "error", err)
+		return nil, fmt.Errorf("error encoding metadata: %v", err)
+	}
+
+	files := []struct {
+		name    string
+		content []byte
+	}{
+		{"transcript.jsonl", transcript.Bytes()},
+		{"summary.md", []byte(archive.Summary)},
+		{"word_timings.json", wordTimingsData},
+		{"chapters.json", chaptersData},
+		{"metadata.json", metadataData},
+	}
+
+	for _, file := range files {
+		fw, err := zw.Create(file.name)
+		if err != nil {
+			return nil, fmt.Errorf("error creating %s in archive: %v", file.name, err)
+		}
+		if _, err := fw.Write(file.content); err != nil {
+			return nil, fmt.Errorf("error writing %s to archive: %v", file.name, err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("error finalizing archive: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// serveSessions serves the list of live sessions
+func serveSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tag := r.URL.Query().Get("tag")
+	sessions := []SessionInfo{}
+	for _, session := range sessionRegistry.List() {
+		if tag != "" && !session.HasTag(tag) {
+			continue
+		}
+		sessions = append(sessions, session.Info())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(sessions); err != nil {
+		logger.Error("Failed to encode sessions response", "error", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// serveSession serves a specific live session
+func serveSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	session, ok := sessionRegistry.Get(r.PathValue("sessionID"))
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(preset); err != nil {
-		logger.Error("Failed to encode preset response", "error", err)
+	if err := json.NewEncoder(w).Encode(session.Info()); err != nil {
+		logger.Error("Failed to encode session response", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// maxSessionTags limits the number of tags on a session
+const maxSessionTags = 10
+
+// validateTags checks that tags are 1-32 letters, digits or hyphens, at most 10, and removes case-insensitive duplicates
+func validateTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool)
+	valid := []string{}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || len(tag) > 32 {
+			return nil, fmt.Errorf("tag %q must be 1 to 32 characters", tag)
+		}
+		for _, c := range tag {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return nil, fmt.Errorf("tag %q may only contain letters, digits and hyphens", tag)
+			}
+		}
+		if seen[strings.ToLower(tag)] {
+			continue
+		}
+		seen[strings.ToLower(tag)] = true
+		valid = append(valid, tag)
+	}
+	if len(valid) > maxSessionTags {
+		return nil, fmt.Errorf("at most %d tags are allowed", maxSessionTags)
+	}
+	return valid, nil
+}
+
+// serveSessionTags reads (GET) or replaces (PUT) the tags of a live or persisted session
+func serveSessionTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sessionID := r.PathValue("sessionID")
+	if !isValidSessionID(sessionID) {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+	session, live := sessionRegistry.Get(sessionID)
+	if !live && !persistedSessionExists(sessionID) {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	var tags []string
+	if r.Method == http.MethodPut {
+		var request SessionTags
+		if err := json.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		validTags, err := validateTags(request.Tags)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		tags = validTags
+		if live {
+			session.SetTags(tags)
+			session.recordEvent("tags_updated", map[string]interface{}{"tags": tags})
+		}
+		if err := writeSessionTags(sessionID, tags); err != nil {
+			logger.Error("Failed to persist session tags", "sessionID", sessionID, "error", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	} else if live {
+		tags = session.Tags()
+	} else {
+		persistedTags, err := loadSessionTags(sessionID)
+		if err != nil {
+			logger.Error("Failed to load session tags", "sessionID", sessionID, "error", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		tags = persistedTags
+	}
+	if tags == nil {
+		tags = []string{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(SessionTags{SessionID: sessionID, Tags: tags}); err != nil {
+		logger.Error("Failed to encode session tags response", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// serveTags lists the unique tags of live and persisted sessions
+func serveTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	all, err := listPersistedTags()
+	if err != nil {
+		logger.Error("Failed to list persisted tags", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	for _, session := range sessionRegistry.List() {
+		all = append(all, session.Tags()...)
+	}
+
+	seen := make(map[string]bool)
+	tags := []string{}
+	for _, tag := range all {
+		if !seen[strings.ToLower(tag)] {
+			seen[strings.ToLower(tag)] = true
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(tags); err != nil {
+		logger.Error("Failed to encode tags response", "error", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 	}
 }
+
+// Search result limits
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// serveSearch ranks finalized session transcripts against the q parameter; every query word must appear
+func serveSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		http.Error(w, "Missing q parameter", http.StatusBadRequest)
+		return
+	}
+	limit := defaultSearchLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+		limit = min(parsed, maxSearchLimit)
+	}
+
+	if err := searchIndex.refreshPersisted(); err != nil {
+		logger.Error("Failed to refresh search index", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(SearchResponse{Query: query, Hits: searchIndex.Search(query, limit)}); err != nil {
+		logger.Error("Failed to encode search response", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// transcriptContentTypes are the representations served by the transcript API, in order of preference
+var transcriptContentTypes = []string{"application/json", "text/plain", "text/vtt", "text/x-subrip", "application/x-ndjson"}
+
+// transcriptStreamChunkSize is how many bytes of a streamed transcript are written between flushes (TRANSCRIPT_STREAM_CHUNK_KB, default 64)
+func transcriptStreamChunkSize() int {
+	return max(1, int(getEnvInt64("TRANSCRIPT_STREAM_CHUNK_KB", 64))) << 10
+}
+
+// writeFlushed writes text in chunks of chunkSize bytes, flushing after each so long transcripts reach the client
+// progressively instead of being buffered whole
+func writeFlushed(w http.ResponseWriter, text string, chunkSize int) error {
+	controller := http.NewResponseController(w)
+	for start := 0; start < len(text); start += chunkSize {
+		if _, err := io.WriteString(w, text[start:min(start+chunkSize, len(text))]); err != nil {
+			return err
+		}
+		if err := controller.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+	}
+	return nil
+}
+
+// streamTranscriptRecords writes the transcript records of a session as JSON lines, flushing every chunkSize bytes.
+// Ended sessions are copied from their persisted record log; live sessions are written segment by segment.
+func streamTranscriptRecords(w http.ResponseWriter, sessionID string, chunkSize int) error {
+	controller := http.NewResponseController(w)
+	flush := func() error {
+		if err := controller.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		return nil
+	}
+
+	session, live := sessionRegistry.Get(sessionID)
+	if !live {
+		transcript, err := storageBackend.OpenTranscript(sessionID)
+		if os.IsNotExist(err) {
+			return nil // Ended without a final result
+		}
+		if err != nil {
+			return err
+		}
+		defer transcript.Close()
+		reader := bufio.NewReaderSize(transcript, chunkSize)
+		for {
+			n, err := io.CopyN(w, reader, int64(chunkSize))
+			if n > 0 {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	var records []TranscriptRecord
+	for _, segment := range session.Segments() {
+		records = append(records, newSegmentRecord(segment))
+	}
+	for _, chapter := range session.Chapters() {
+		records = append(records, TranscriptRecord{Type: "chapter", Timestamp: time.Now(), Chapter: &chapter})
+	}
+	pending := 0
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			return err
+		}
+		if pending += len(line) + 1; pending >= chunkSize {
+			if err := flush(); err != nil {
+				return err
+			}
+			pending = 0
+		}
+	}
+	return flush()
+}
+
+// AcceptType is a media range of an Accept header with its quality value
+type AcceptType struct {
+	MediaType string
+	Quality   float64
+}
+
+// parseAccept parses an Accept header into media ranges ordered by quality, then by specificity.
+// Ranges with equal quality and specificity keep their header order.
+func parseAccept(accept string) []AcceptType {
+	var types []AcceptType
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(fields[0]))
+		if mediaType == "" {
+			continue
+		}
+		quality := 1.0
+		for _, param := range fields[1:] {
+			key, value, found := strings.Cut(strings.TrimSpace(param), "=")
+			if !found || strings.ToLower(strings.TrimSpace(key)) != "q" {
+				continue
+			}
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil && parsed >= 0 && parsed <= 1 {
+				quality = parsed
+			}
+		}
+		types = append(types, AcceptType{MediaType: mediaType, Quality: quality})
+	}
+
+	specificity := func(mediaType string) int {
+		switch {
+		case mediaType == "*/*":
+			return 0
+		case strings.HasSuffix(mediaType, "/*"):
+			return 1
+		default:
+			return 2
+		}
+	}
+	sort.SliceStable(types, func(i, j int) bool {
+		if types[i].Quality != types[j].Quality {
+			return types[i].Quality > types[j].Quality
+		}
+		return specificity(types[i].MediaType) > specificity(types[j].MediaType)
+	})
+	return types
+}
+
+// negotiateContentType picks the supported media type that best matches the Accept header.
+// An empty header selects the first supported type.
+func negotiateContentType(accept string, supported []string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return supported[0], true
+	}
+	acceptTypes := parseAccept(accept)
+	// A q=0 entry explicitly refuses that type, even when a wildcard would match it
+	refused := map[string]bool{}
+	for _, acceptType := range acceptTypes {
+		if acceptType.Quality == 0 {
+			refused[acceptType.MediaType] = true
+		}
+	}
+	for _, acceptType := range acceptTypes {
+		if acceptType.Quality == 0 {
+			continue
+		}
+		for _, mediaType := range supported {
+			if refused[mediaType] {
+				continue
+			}
+			if acceptType.MediaType == mediaType || acceptType.MediaType == "*/*" ||
+				(strings.HasSuffix(acceptType.MediaType, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(acceptType.MediaType, "*"))) {
+				return mediaType, true
+			}
+		}
+	}
+	return "", false
+}
+
+// serveTranscript serves the transcript, segments and chapters of a live or persisted session
+func serveTranscript(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sessionID := r.PathValue("sessionID")
+	if !isValidSessionID(sessionID) {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	mediaType, ok := negotiateContentType(r.Header.Get("Accept"), transcriptContentTypes)
+	if !ok {
+		http.Error(w, "Not acceptable, supported types: "+strings.Join(transcriptContentTypes, ", "), http.StatusNotAcceptable)
+		return
+	}
+	w.Header().Add("Vary", "Accept")
+
+	// Transcript records are streamed without loading the session into memory
+	if mediaType == "application/x-ndjson" {
+		if _, live := sessionRegistry.Get(sessionID); !live && !persistedSessionExists(sessionID) {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		if err := streamTranscriptRecords(w, sessionID, transcriptStreamChunkSize()); err != nil {
+			logger.Warn("Failed to stream transcript records", "sessionID", sessionID, "error", err)
+		}
+		return
+	}
+
+	archive, err := findSessionArchive(sessionID)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		logger.Error("Failed to load session transcript", "sessionID", sessionID, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	switch mediaType {
+	case "text/plain":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if err := writeFlushed(w, archive.Transcript, transcriptStreamChunkSize()); err != nil {
+			logger.Warn("Failed to stream transcript", "sessionID", sessionID, "error", err)
+		}
+		return
+	case "text/vtt":
+		w.Header().Set("Content-Type", "text/vtt; charset=utf-8")
+		io.WriteString(w, formatVTT(archive.Segments, archive.Metadata.CreatedAt))
+		return
+	case "text/x-subrip":
+		w.Header().Set("Content-Type", "text/x-subrip; charset=utf-8")
+		io.WriteString(w, formatSRT(archive.Segments, archive.Metadata.CreatedAt))
+		return
+	}
+
+	response := TranscriptResponse{
+		SessionID:  sessionID,
+		Transcript: archive.Transcript,
+		Segments:   archive.Segments,
+		Chapters:   archive.Chapters,
+	}
+	if response.Segments == nil {
+		response.Segments = []TranscriptionSegment{}
+	}
+	if response.Chapters == nil {
+		response.Chapters = []Chapter{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.Error("Failed to encode transcript response", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// requireAdminKey checks the admin API key from the X-Admin-API-Key header or a Bearer token.
+// It writes an error response and returns false when the request is not authorized.
+func requireAdminKey(w http.ResponseWriter, r *http.Request) bool {
+	adminKey := os.Getenv("ADMIN_API_KEY")
+	if adminKey == "" {
+		logger.Warn("Admin endpoint called but ADMIN_API_KEY is not configured", "path", r.URL.Path)
+		http.Error(w, "Admin API disabled", http.StatusForbidden)
+		return false
+	}
+
+	provided := r.Header.Get("X-Admin-API-Key")
+	if provided == "" {
+		provided = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	if subtle.ConstantTimeCompare([]byte(provided), []byte(adminKey)) != 1 {
+		logger.Warn("Admin endpoint called with invalid API key", "path", r.URL.Path, "remoteIP", clientIP(r))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// serveSessionReset clears the transcript and summary state of a live session without touching its audio stream
+func serveSessionReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireAdminKey(w, r) {
+		return
+	}
+
+	session, ok := sessionRegistry.Get(r.PathValue("sessionID"))
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	session.Reset()
+	// The marker drops every persisted segment and chapter, so the archive and exports do not bring them back
+	if err := appendTranscriptRecord(session.ID, TranscriptRecord{Type: "session_reset", Timestamp: time.Now()}); err != nil {
+		logger.Error("Failed to persist session reset marker", "sessionID", session.ID, "error", err)
+	}
+	if err := writeSessionSummary(session.ID, ""); err != nil {
+		logger.Error("Failed to clear persisted session summary", "sessionID", session.ID, "error", err)
+	}
+	session.recordEvent("session_reset", map[string]interface{}{"remoteIP": clientIP(r)})
+	logger.Info("Session state reset", "sessionID", session.ID, "remoteIP", clientIP(r))
+
+	if err := session.Send(StatusResponse{
+		Type:      "status",
+		Status:    "session_reset",
+		Message:   "Transcript and summary were reset by an operator",
+		Timestamp: session.Timestamp(time.Now()),
+		SessionID: session.ID,
+	}); err != nil {
+		logger.Warn("Failed to notify client of session reset", "sessionID", session.ID, "error", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(session.Info()); err != nil {
+		logger.Error("Failed to encode session reset response", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// serveWordFrequency serves the most frequent words of a live session's transcript
+func serveWordFrequency(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	session, ok := sessionRegistry.Get(r.PathValue("sessionID"))
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	top := 20
+	if value := r.URL.Query().Get("top"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			http.Error(w, "Invalid top parameter", http.StatusBadRequest)
+			return
+		}
+		top = parsed
+	}
+
+	frequencies := session.WordFrequencies()
+	if len(frequencies) > top {
+		frequencies = frequencies[:top]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(frequencies); err != nil {
+		logger.Error("Failed to encode word frequency response", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// maxTimelineEntries caps the number of words returned by the timeline API
+const maxTimelineEntries = 10000
+
+// serveSessionTimeline streams the words of a live or persisted session with their position relative to the session start.
+// The optional from_ms and to_ms parameters restrict the response to words overlapping that window.
+func serveSessionTimeline(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sessionID := r.PathValue("sessionID")
+	if !isValidSessionID(sessionID) {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	fromMs, toMs := int64(0), int64(-1)
+	if value := r.URL.Query().Get("from_ms"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 0 {
+			http.Error(w, "Invalid from_ms parameter", http.StatusBadRequest)
+			return
+		}
+		fromMs = parsed
+	}
+	if value := r.URL.Query().Get("to_ms"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < fromMs {
+			http.Error(w, "Invalid to_ms parameter", http.StatusBadRequest)
+			return
+		}
+		toMs = parsed
+	}
+
+	archive, err := findSessionArchive(sessionID)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		logger.Error("Failed to load session timeline", "sessionID", sessionID, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Encode entries one at a time so large sessions are not buffered in memory
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	io.WriteString(w, "[")
+	written := 0
+segments:
+	for _, segment := range archive.Segments {
+		for _, entry := range timelineEntries(segment, archive.Metadata.CreatedAt) {
+			if entry.EndMs < fromMs || (toMs >= 0 && entry.StartMs > toMs) {
+				continue
+			}
+			if written == maxTimelineEntries {
+				logger.Debug("Timeline truncated", "sessionID", sessionID, "limit", maxTimelineEntries)
+				break segments
+			}
+			if written > 0 {
+				io.WriteString(w, ",")
+			}
+			if err := encoder.Encode(entry); err != nil {
+				logger.Error("Failed to encode timeline entry", "sessionID", sessionID, "error", err)
+				return
+			}
+			written++
+		}
+	}
+	io.WriteString(w, "]\n")
+}
+
+// serveSessionEvents serves the event log of a live or persisted session
+func serveSessionEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sessionID := r.PathValue("sessionID")
+	if !isValidSessionID(sessionID) {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	var events []SessionEvent
+	if session, ok := sessionRegistry.Get(sessionID); ok {
+		events = session.EventLog()
+	} else {
+		persisted, err := loadSessionEvents(sessionID)
+		if err != nil {
+			if os.IsNotExist(err) {
+				http.Error(w, "Session not found", http.StatusNotFound)
+				return
+			}
+			logger.Error("Failed to load session events", "sessionID", sessionID, "error", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		events = persisted
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(events); err != nil {
+		logger.Error("Failed to encode session events", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// serveSessionKeywords returns the keywords added to a live session with the boosts currently applied
+func serveSessionKeywords(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sessionID := r.PathValue("sessionID")
+	if !isValidSessionID(sessionID) {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	session, ok := sessionRegistry.Get(sessionID)
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(session.Keywords()); err != nil {
+		logger.Error("Failed to encode session keywords", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// writeErrorResponse writes a structured JSON error with the given status code
+func writeErrorResponse(w http.ResponseWriter, statusCode int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(ErrorResponse{Error: message}); err != nil {
+		logger.Error("Failed to encode error response", "error", err)
+	}
+}
+
+// serveBatchTranscribe transcribes an uploaded audio file in a single request.
+// The raw audio is the request body; format, sampleRate and languageCode are query parameters.
+func serveBatchTranscribe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// Bound the upload size so large files cannot exhaust server memory
+	maxBytes := getEnvInt64("MAX_UPLOAD_BYTES", 50*1024*1024)
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+	audio, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			logger.Warn("Batch upload too large", "limit", maxBytesErr.Limit, "remoteIP", clientIP(r))
+			writeErrorResponse(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body exceeds %d bytes", maxBytesErr.Limit))
+			return
+		}
+		writeErrorResponse(w, http.StatusBadRequest, "Failed to read request body")
+		return
+	}
+	if len(audio) == 0 {
+		writeErrorResponse(w, http.StatusBadRequest, "Empty audio body")
+		return
+	}
+
+	query := r.URL.Query()
+	sampleRate := 0
+	if value := query.Get("sampleRate"); value != "" {
+		sampleRate, err = strconv.Atoi(value)
+		if err != nil || sampleRate < 0 {
+			writeErrorResponse(w, http.StatusBadRequest, "Invalid sampleRate parameter")
+			return
+		}
+	}
+	languageCode := query.Get("languageCode")
+	if languageCode == "" {
+		languageCode = "en-US"
+	}
+
+	client, releaseClient, err := acquireSpeechClient(r.Context())
+	if err != nil {
+		logger.Error("Failed to create Speech-to-Text client", "error", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "Speech-to-Text unavailable")
+		return
+	}
+	defer releaseClient()
+
+	resp, err := client.Recognize(r.Context(), &speechpb.RecognizeRequest{
+		Config: &speechpb.RecognitionConfig{
+			Encoding:              audioEncoding(query.Get("format")),
+			SampleRateHertz:       int32(sampleRate),
+			LanguageCode:          languageCode,
+			EnableWordTimeOffsets: true,
+		},
+		Audio: &speechpb.RecognitionAudio{
+			AudioSource: &speechpb.RecognitionAudio_Content{Content: audio},
+		},
+	})
+	if err != nil {
+		logger.Error("Batch transcription failed", "error", err)
+		writeErrorResponse(w, http.StatusBadGateway, "Transcription failed")
+		return
+	}
+
+	start := time.Now()
+	response := BatchTranscriptionResponse{Segments: []TranscriptionSegment{}}
+	var texts []string
+	for _, result := range resp.Results {
+		if len(result.Alternatives) == 0 {
+			continue
+		}
+		segment := newTranscriptionSegment(result.Alternatives[0], result.LanguageCode, start, 0)
+		segment.Index = len(response.Segments)
+		response.Segments = append(response.Segments, segment)
+		texts = append(texts, strings.TrimSpace(segment.Text))
+	}
+	response.Transcript = strings.Join(texts, " ")
+
+	logger.Info("Batch transcription completed",
+		"bytes", len(audio),
+		"segments", len(response.Segments),
+		"remoteIP", clientIP(r))
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.Error("Failed to encode batch transcription response", "error", err)
+	}
+}
+
+// serveGoogleDocsExport exports a session transcript, chapters and summary to a new Google Doc
+func serveGoogleDocsExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sessionID := r.PathValue("sessionID")
+	if !isValidSessionID(sessionID) {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	var request GoogleDocsExportRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	archive, err := findSessionArchive(sessionID)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		logger.Error("Failed to load session for Google Docs export", "sessionID", sessionID, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	title := request.Title
+	if title == "" {
+		title = fmt.Sprintf("Transcript %s", sessionID)
+	}
+
+	client, err := newDocsClient(r.Context())
+	if err != nil {
+		logger.Error("Failed to create Google Docs client", "error", err)
+		http.Error(w, "Google Docs unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	documentID, err := exportToGoogleDocs(r.Context(), client, archive, title, request.FolderID)
+	if err != nil {
+		logger.Error("Google Docs export failed", "sessionID", sessionID, "error", err)
+		if isQuotaError(err) {
+			http.Error(w, "Google Docs quota exceeded, retry later", http.StatusServiceUnavailable)
+			return
+		}
+		http.Error(w, "Google Docs export failed", http.StatusBadGateway)
+		return
+	}
+
+	logger.Info("Session exported to Google Docs", "sessionID", sessionID, "documentID", documentID)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(GoogleDocsExportResponse{
+		DocumentID: documentID,
+		URL:        fmt.Sprintf("https://docs.google.com/document/d/%s/edit", documentID),
+	}); err != nil {
+		logger.Error("Failed to encode Google Docs export response", "error", err)
+	}
+}
@@ -0,0 +1,735 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestTimeoutMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		timeout    time.Duration
+		handlerFor time.Duration
+		wantStatus int
+	}{
+		{"fast handler", 200 * time.Millisecond, 0, http.StatusOK},
+		{"slow handler times out", 20 * time.Millisecond, 200 * time.Millisecond, http.StatusServiceUnavailable},
+		{"disabled", 0, 50 * time.Millisecond, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := timeoutMiddleware(tt.timeout)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case <-time.After(tt.handlerFor):
+					w.WriteHeader(http.StatusOK)
+				case <-r.Context().Done():
+				}
+			}))
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/transcribe", nil))
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestServeSessionExport(t *testing.T) {
+	session := newSession(func() {}, ConfigMessage{LanguageCode: "en-US"})
+	session.appendTranscript("hello world")
+	session.addSegment(TranscriptionSegment{Text: "hello world", Words: []WordTiming{{Word: "hello"}, {Word: "world"}}})
+	session.setSummary("A greeting.")
+	sessionRegistry.Register(session)
+	defer sessionRegistry.Unregister(session.ID)
+
+	tests := []struct {
+		name       string
+		method     string
+		sessionID  string
+		query      string
+		wantStatus int
+		wantFiles  []string
+	}{
+		{"zip archive", http.MethodPost, session.ID, "", http.StatusOK, []string{"transcript.jsonl", "summary.md", "word_timings.json", "chapters.json", "metadata.json"}},
+		{"explicit zip format", http.MethodPost, session.ID, "?format=zip", http.StatusOK, []string{"transcript.jsonl", "summary.md", "word_timings.json", "chapters.json", "metadata.json"}},
+		{"GET needs a format", http.MethodGet, session.ID, "", http.StatusMethodNotAllowed, nil},
+		{"unsupported format", http.MethodPost, session.ID, "?format=pdf", http.StatusBadRequest, nil},
+		{"invalid session ID", http.MethodPost, "../etc", "", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/api/sessions/"+tt.sessionID+"/export"+tt.query, nil)
+			r.SetPathValue("sessionID", tt.sessionID)
+			recorder := httptest.NewRecorder()
+			serveSessionExport(recorder, r)
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if got := recorder.Header().Get("Content-Type"); got != "application/zip" {
+				t.Errorf("Content-Type = %q, want application/zip", got)
+			}
+			reader, err := zip.NewReader(bytes.NewReader(recorder.Body.Bytes()), int64(recorder.Body.Len()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, file := range reader.File {
+				names = append(names, file.Name)
+			}
+			if !reflect.DeepEqual(names, tt.wantFiles) {
+				t.Errorf("archive files = %v, want %v", names, tt.wantFiles)
+			}
+		})
+	}
+}
+
+func TestServeSessionTimeline(t *testing.T) {
+	session := newSession(func() {}, ConfigMessage{LanguageCode: "en-US"})
+	session.addSegment(TranscriptionSegment{Text: "hello world", Words: []WordTiming{{Word: "hello", StartMs: 0, EndMs: 500}, {Word: "world", StartMs: 500, EndMs: 1000}}})
+	session.addSegment(TranscriptionSegment{Text: "budget review", StartTime: session.CreatedAt.Add(2 * time.Second), EndTime: session.CreatedAt.Add(3 * time.Second)})
+	sessionRegistry.Register(session)
+	defer sessionRegistry.Unregister(session.ID)
+
+	long := newSession(func() {}, ConfigMessage{LanguageCode: "en-US"})
+	long.addSegment(TranscriptionSegment{Text: strings.Repeat("word ", maxTimelineEntries+5), StartTime: long.CreatedAt, EndTime: long.CreatedAt.Add(time.Hour)})
+	sessionRegistry.Register(long)
+	defer sessionRegistry.Unregister(long.ID)
+
+	tests := []struct {
+		name       string
+		method     string
+		sessionID  string
+		query      string
+		wantStatus int
+		wantWords  []string
+		wantCount  int
+	}{
+		{"whole session", http.MethodGet, session.ID, "", http.StatusOK, []string{"hello", "world", "budget", "review"}, 4},
+		{"window", http.MethodGet, session.ID, "?from_ms=600&to_ms=2400", http.StatusOK, []string{"world", "budget"}, 2},
+		{"open-ended window", http.MethodGet, session.ID, "?from_ms=2600", http.StatusOK, []string{"review"}, 1},
+		{"empty window", http.MethodGet, session.ID, "?from_ms=5000", http.StatusOK, nil, 0},
+		{"capped", http.MethodGet, long.ID, "", http.StatusOK, nil, maxTimelineEntries},
+		{"invalid from_ms", http.MethodGet, session.ID, "?from_ms=-1", http.StatusBadRequest, nil, 0},
+		{"to_ms before from_ms", http.MethodGet, session.ID, "?from_ms=2000&to_ms=1000", http.StatusBadRequest, nil, 0},
+		{"unknown session", http.MethodGet, "missing", "", http.StatusNotFound, nil, 0},
+		{"wrong method", http.MethodPost, session.ID, "", http.StatusMethodNotAllowed, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/api/sessions/"+tt.sessionID+"/timeline"+tt.query, nil)
+			r.SetPathValue("sessionID", tt.sessionID)
+			recorder := httptest.NewRecorder()
+			serveSessionTimeline(recorder, r)
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var entries []TimelineEntry
+			if err := json.Unmarshal(recorder.Body.Bytes(), &entries); err != nil {
+				t.Fatalf("body is not a JSON array: %v", err)
+			}
+			if len(entries) != tt.wantCount {
+				t.Fatalf("%d entries, want %d", len(entries), tt.wantCount)
+			}
+			if tt.wantWords == nil {
+				return
+			}
+			var words []string
+			for _, entry := range entries {
+				words = append(words, entry.Word)
+			}
+			if !reflect.DeepEqual(words, tt.wantWords) {
+				t.Errorf("words = %v, want %v", words, tt.wantWords)
+			}
+		})
+	}
+}
+
+func TestServeSessionTags(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TRANSCRIPT_DIR", dir)
+	live := newSession(func() {}, ConfigMessage{LanguageCode: "en-US"})
+	sessionRegistry.Register(live)
+	defer sessionRegistry.Unregister(live.ID)
+	ended := newSession(func() {}, ConfigMessage{LanguageCode: "en-US"})
+	if err := writeSessionMetadata(SessionMetadata{SessionID: ended.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	tagsRequest := func(method, sessionID, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/api/sessions/"+sessionID+"/tags", strings.NewReader(body))
+		r.SetPathValue("sessionID", sessionID)
+		recorder := httptest.NewRecorder()
+		serveSessionTags(recorder, r)
+		return recorder
+	}
+	tests := []struct {
+		name       string
+		method     string
+		sessionID  string
+		body       string
+		wantStatus int
+		wantTags   []string
+	}{
+		{"live session without tags", http.MethodGet, live.ID, "", http.StatusOK, []string{}},
+		{"replace live tags", http.MethodPut, live.ID, `{"tags":["meeting"," Budget ","budget","Q3-review"]}`, http.StatusOK, []string{"meeting", "Budget", "Q3-review"}},
+		{"read live tags", http.MethodGet, live.ID, "", http.StatusOK, []string{"meeting", "Budget", "Q3-review"}},
+		{"replace persisted tags", http.MethodPut, ended.ID, `{"tags":["retro"]}`, http.StatusOK, []string{"retro"}},
+		{"read persisted tags", http.MethodGet, ended.ID, "", http.StatusOK, []string{"retro"}},
+		{"invalid characters", http.MethodPut, live.ID, `{"tags":["q3 review"]}`, http.StatusBadRequest, nil},
+		{"empty tag", http.MethodPut, live.ID, `{"tags":[" "]}`, http.StatusBadRequest, nil},
+		{"tag too long", http.MethodPut, live.ID, `{"tags":["` + strings.Repeat("a", 33) + `"]}`, http.StatusBadRequest, nil},
+		{"too many tags", http.MethodPut, live.ID, `{"tags":["a","b","c","d","e","f","g","h","i","j","k"]}`, http.StatusBadRequest, nil},
+		{"invalid body", http.MethodPut, live.ID, `{"tags":`, http.StatusBadRequest, nil},
+		{"unknown session", http.MethodGet, "missing", "", http.StatusNotFound, nil},
+		{"invalid session ID", http.MethodGet, "../etc", "", http.StatusBadRequest, nil},
+		{"wrong method", http.MethodPost, live.ID, "", http.StatusMethodNotAllowed, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tagsRequest(tt.method, tt.sessionID, tt.body)
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", recorder.Code, tt.wantStatus, recorder.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var response SessionTags
+			if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if response.SessionID != tt.sessionID || !reflect.DeepEqual(response.Tags, tt.wantTags) {
+				t.Errorf("response = %+v, want session %s with tags %v", response, tt.sessionID, tt.wantTags)
+			}
+		})
+	}
+	// Rejected updates leave the previous tags in place
+	if got := live.Tags(); !reflect.DeepEqual(got, []string{"meeting", "Budget", "Q3-review"}) {
+		t.Errorf("live tags = %v after rejected updates", got)
+	}
+}
+
+func TestServeTagsAndTagFilter(t *testing.T) {
+	t.Setenv("TRANSCRIPT_DIR", t.TempDir())
+	tagged := newSession(func() {}, ConfigMessage{LanguageCode: "en-US"})
+	tagged.SetTags([]string{"tagtest-Planning", "tagtest-q3"})
+	other := newSession(func() {}, ConfigMessage{LanguageCode: "en-US"})
+	other.SetTags([]string{"tagtest-planning"})
+	untagged := newSession(func() {}, ConfigMessage{LanguageCode: "en-US"})
+	for _, session := range []*Session{tagged, other, untagged} {
+		sessionRegistry.Register(session)
+		defer sessionRegistry.Unregister(session.ID)
+	}
+	if err := writeSessionTags("ended-session", []string{"tagtest-retro", "TAGTEST-Q3"}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("unique tags", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		serveTags(recorder, httptest.NewRequest(http.MethodGet, "/api/tags", nil))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", recorder.Code, http.StatusOK)
+		}
+		var tags []string
+		if err := json.Unmarshal(recorder.Body.Bytes(), &tags); err != nil {
+			t.Fatal(err)
+		}
+		// Other tests may leave live sessions behind, so only this test's tags are compared
+		counts := make(map[string]int)
+		for _, tag := range tags {
+			if strings.HasPrefix(strings.ToLower(tag), "tagtest-") {
+				counts[strings.ToLower(tag)]++
+			}
+		}
+		if want := map[string]int{"tagtest-planning": 1, "tagtest-q3": 1, "tagtest-retro": 1}; !reflect.DeepEqual(counts, want) {
+			t.Errorf("tags %v, want each of %v once ignoring case", tags, want)
+		}
+	})
+
+	filters := []struct {
+		name string
+		tag  string
+		want []string
+	}{
+		{"case-insensitive tag", "TAGTEST-PLANNING", []string{tagged.ID, other.ID}},
+		{"tag of one session", "tagtest-q3", []string{tagged.ID}},
+		{"tag of no live session", "tagtest-retro", nil},
+	}
+	for _, tt := range filters {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			serveSessions(recorder, httptest.NewRequest(http.MethodGet, "/api/sessions?tag="+tt.tag, nil))
+			var sessions []SessionInfo
+			if err := json.Unmarshal(recorder.Body.Bytes(), &sessions); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, info := range sessions {
+				got = append(got, info.SessionID)
+			}
+			sort.Strings(got)
+			want := append([]string(nil), tt.want...)
+			sort.Strings(want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("sessions with tag %q = %v, want %v", tt.tag, got, want)
+			}
+		})
+	}
+}
+
+func TestGzipMiddleware(t *testing.T) {
+	t.Setenv("TRANSCRIPT_DIR", t.TempDir())
+	session := newSession(func() {}, ConfigMessage{LanguageCode: "en-US"})
+	text := strings.Repeat("the quarterly budget was approved by the board ", 200)
+	session.appendTranscript(text)
+	session.addSegment(TranscriptionSegment{Text: text, StartTime: time.Now(), EndTime: time.Now().Add(time.Minute)})
+	sessionRegistry.Register(session)
+	defer sessionRegistry.Unregister(session.ID)
+
+	handler := gzipMiddleware(http.HandlerFunc(serveTranscript))
+	get := func(acceptEncoding string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/transcript/"+session.ID, nil)
+		r.SetPathValue("sessionID", session.ID)
+		r.Header.Set("Accept", "text/plain")
+		if acceptEncoding != "" {
+			r.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, r)
+		return recorder
+	}
+	uncompressed := get("")
+	if uncompressed.Code != http.StatusOK || uncompressed.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("uncompressed response = %d with encoding %q", uncompressed.Code, uncompressed.Header().Get("Content-Encoding"))
+	}
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		disabled       string
+		wantGzip       bool
+	}{
+		{"gzip accepted", "gzip, deflate", "", true},
+		{"wildcard", "*", "", true},
+		{"gzip refused", "gzip;q=0, *", "", false},
+		{"other encodings only", "br", "", false},
+		{"disabled", "gzip", "true", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DISABLE_GZIP", tt.disabled)
+			recorder := get(tt.acceptEncoding)
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", recorder.Code, http.StatusOK)
+			}
+			if got := recorder.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("Vary = %q, want Accept-Encoding", got)
+			}
+			if gzipped := recorder.Header().Get("Content-Encoding") == "gzip"; gzipped != tt.wantGzip {
+				t.Fatalf("Content-Encoding = %q, want gzip %v", recorder.Header().Get("Content-Encoding"), tt.wantGzip)
+			}
+			body := recorder.Body.Bytes()
+			if tt.wantGzip {
+				if len(body) >= uncompressed.Body.Len() {
+					t.Errorf("compressed body is %d bytes, want less than the %d uncompressed", len(body), uncompressed.Body.Len())
+				}
+				reader, err := gzip.NewReader(bytes.NewReader(body))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if body, err = io.ReadAll(reader); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !bytes.Equal(body, uncompressed.Body.Bytes()) {
+				t.Errorf("decoded body differs from the uncompressed response")
+			}
+			if got := recorder.Header().Get("Content-Type"); got != uncompressed.Header().Get("Content-Type") {
+				t.Errorf("Content-Type = %q, want %q", got, uncompressed.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestParseAccept(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept string
+		want   []AcceptType
+	}{
+		{"empty", "", nil},
+		{"single type", "text/plain", []AcceptType{{"text/plain", 1}}},
+		{"ordered by quality", "text/plain;q=0.5, application/json", []AcceptType{{"application/json", 1}, {"text/plain", 0.5}}},
+		{"specific before wildcards", "*/*, text/*, text/vtt", []AcceptType{{"text/vtt", 1}, {"text/*", 1}, {"*/*", 1}}},
+		{"equal ranges keep header order", "text/vtt, text/plain", []AcceptType{{"text/vtt", 1}, {"text/plain", 1}}},
+		{"media types lowercased", "Text/Plain; Q=0.8", []AcceptType{{"text/plain", 0.8}}},
+		{"invalid quality ignored", "text/plain;q=2, text/vtt;q=abc", []AcceptType{{"text/plain", 1}, {"text/vtt", 1}}},
+		{"other parameters ignored", "text/plain;charset=utf-8;q=0.3", []AcceptType{{"text/plain", 0.3}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseAccept(tt.accept); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseAccept(%q) = %v, want %v", tt.accept, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNegotiateContentType(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+		wantOK bool
+	}{
+		{"", "application/json", true},
+		{"application/json", "application/json", true},
+		{"text/plain", "text/plain", true},
+		{"text/vtt", "text/vtt", true},
+		{"text/x-subrip", "text/x-subrip", true},
+		{"application/x-ndjson", "application/x-ndjson", true},
+		{"*/*", "application/json", true},
+		{"text/*", "text/plain", true},
+		{"text/vtt;q=0.9, text/x-subrip", "text/x-subrip", true},
+		{"text/html, text/plain;q=0.1", "text/plain", true},
+		{"*/*, application/json;q=0", "text/plain", true},
+		{"text/*, text/plain;q=0", "text/vtt", true},
+		{"text/html", "", false},
+		{"application/json;q=0", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			got, ok := negotiateContentType(tt.accept, transcriptContentTypes)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("negotiateContentType(%q) = %q, %v, want %q, %v", tt.accept, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestServeTranscriptContentNegotiation(t *testing.T) {
+	t.Setenv("TRANSCRIPT_DIR", t.TempDir())
+	session := newSession(func() {}, ConfigMessage{LanguageCode: "en-US"})
+	session.appendTranscript("hello world")
+	session.addSegment(TranscriptionSegment{Text: "hello world", StartTime: time.Now(), EndTime: time.Now().Add(time.Second)})
+	sessionRegistry.Register(session)
+	defer sessionRegistry.Unregister(session.ID)
+
+	tests := []struct {
+		accept          string
+		wantStatus      int
+		wantContentType string
+		wantBody        string
+	}{
+		{"", http.StatusOK, "application/json", `"transcript":"hello world"`},
+		{"application/json", http.StatusOK, "application/json", `"transcript":"hello world"`},
+		{"text/plain", http.StatusOK, "text/plain; charset=utf-8", "hello world"},
+		{"text/vtt", http.StatusOK, "text/vtt; charset=utf-8", "WEBVTT"},
+		{"text/x-subrip", http.StatusOK, "text/x-subrip; charset=utf-8", "1\n"},
+		{"text/html", http.StatusNotAcceptable, "", "application/json, text/plain"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/transcript/"+session.ID, nil)
+			r.SetPathValue("sessionID", session.ID)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			recorder := httptest.NewRecorder()
+			serveTranscript(recorder, r)
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			if tt.wantContentType != "" && recorder.Header().Get("Content-Type") != tt.wantContentType {
+				t.Errorf("Content-Type = %q, want %q", recorder.Header().Get("Content-Type"), tt.wantContentType)
+			}
+			if !strings.Contains(recorder.Body.String(), tt.wantBody) {
+				t.Errorf("body = %q, want it to contain %q", recorder.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+// pipeResponseWriter sends a response body through an io.Pipe, recording how much was written at each flush
+type pipeResponseWriter struct {
+	header  http.Header
+	pipe    *io.PipeWriter
+	written int
+	flushes []int // Bytes written when each flush happened
+}
+
+func (w *pipeResponseWriter) Header() http.Header { return w.header }
+
+func (w *pipeResponseWriter) WriteHeader(int) {}
+
+func (w *pipeResponseWriter) Write(p []byte) (int, error) {
+	n, err := w.pipe.Write(p)
+	w.written += n
+	return n, err
+}
+
+func (w *pipeResponseWriter) Flush() { w.flushes = append(w.flushes, w.written) }
+
+func TestServeTranscriptStreamed(t *testing.T) {
+	t.Setenv("TRANSCRIPT_STREAM_CHUNK_KB", "1")
+	start := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	sentence := "the quarterly roadmap review covered hiring and the launch plan"
+	tests := []struct {
+		name   string
+		accept string
+		live   bool
+	}{
+		{"live records", "application/x-ndjson", true},
+		{"ended session records from the transcript file", "application/x-ndjson", false},
+		{"plain text", "text/plain", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useStorageBackend(t, LocalStorage{}, t.TempDir())
+			session := newSession(func() {}, ConfigMessage{LanguageCode: "en-US"})
+			for i := 0; i < 100; i++ {
+				segment := TranscriptionSegment{Text: sentence, StartTime: start.Add(time.Duration(i) * time.Second), EndTime: start.Add(time.Duration(i+1) * time.Second)}
+				session.appendTranscript(sentence)
+				if tt.live {
+					session.addSegment(segment)
+				} else if err := appendTranscriptRecord(session.ID, newSegmentRecord(segment)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.live {
+				sessionRegistry.Register(session)
+				defer sessionRegistry.Unregister(session.ID)
+			} else if err := writeSessionMetadata(SessionMetadata{SessionID: session.ID}); err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/api/transcript/"+session.ID, nil)
+			r.SetPathValue("sessionID", session.ID)
+			r.Header.Set("Accept", tt.accept)
+			reader, pipe := io.Pipe()
+			w := &pipeResponseWriter{header: http.Header{}, pipe: pipe}
+			go func() {
+				serveTranscript(w, r)
+				pipe.Close()
+			}()
+			body, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(body) < 4<<10 {
+				t.Fatalf("body is %d bytes, want a transcript of several chunks", len(body))
+			}
+			if len(w.flushes) < 2 || w.flushes[0] >= len(body) {
+				t.Errorf("flushed at %v of %d bytes, want the body sent in several chunks", w.flushes, len(body))
+			}
+			if tt.accept == "text/plain" {
+				if got := strings.Count(string(body), sentence); got != 100 {
+					t.Errorf("body has %d sentences, want 100", got)
+				}
+				return
+			}
+			lines := strings.Split(strings.TrimSuffix(string(body), "\n"), "\n")
+			if len(lines) != 100 {
+				t.Fatalf("body has %d lines, want 100", len(lines))
+			}
+			for i, line := range lines {
+				var record TranscriptRecord
+				if err := json.Unmarshal([]byte(line), &record); err != nil || record.Type != "segment" || record.Segment.Text != sentence {
+					t.Fatalf("line %d = %q (%v), want a segment record", i, line, err)
+				}
+			}
+		})
+	}
+}
+
+func TestServeSessionReset(t *testing.T) {
+	useStorageBackend(t, newMemoryStorage(), t.TempDir())
+	fake := newFakeSpeechPool(t)
+	fake.setResults("first agenda item", "")
+	conn := dialTestSession(t, ConfigMessage{AudioFormat: AudioFormat{Format: "LINEAR16", SampleRate: 16000, Channels: 1}, LanguageCode: "en-US"})
+	started := readUntil(t, conn, "status", "session_started")
+	sessionID := started["sessionID"].(string)
+	session, ok := sessionRegistry.Get(sessionID)
+	if !ok {
+		t.Fatal("session not registered")
+	}
+	if err := conn.WriteMessage(websocket.BinaryMessage, make([]byte, 3200)); err != nil {
+		t.Fatal(err)
+	}
+	readUntil(t, conn, "transcription", "")
+	waitFor(t, "the transcript", func() bool { return session.Transcript() != "" })
+
+	reset := func(adminKey, method, sessionID, provided string) *httptest.ResponseRecorder {
+		t.Setenv("ADMIN_API_KEY", adminKey)
+		r := httptest.NewRequest(method, "/api/sessions/"+sessionID+"/reset", nil)
+		r.SetPathValue("sessionID", sessionID)
+		if provided != "" {
+			r.Header.Set("X-Admin-API-Key", provided)
+		}
+		recorder := httptest.NewRecorder()
+		serveSessionReset(recorder, r)
+		return recorder
+	}
+
+	rejected := []struct {
+		name       string
+		adminKey   string
+		method     string
+		sessionID  string
+		provided   string
+		wantStatus int
+	}{
+		{"wrong method", "secret", http.MethodGet, sessionID, "secret", http.StatusMethodNotAllowed},
+		{"admin API disabled", "", http.MethodPost, sessionID, "secret", http.StatusForbidden},
+		{"wrong key", "secret", http.MethodPost, sessionID, "guess", http.StatusUnauthorized},
+		{"unknown session", "secret", http.MethodPost, "missing", "secret", http.StatusNotFound},
+	}
+	for _, tt := range rejected {
+		t.Run(tt.name, func(t *testing.T) {
+			if recorder := reset(tt.adminKey, tt.method, tt.sessionID, tt.provided); recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			if session.Transcript() == "" {
+				t.Error("rejected request reset the transcript")
+			}
+		})
+	}
+
+	recorder := reset("secret", http.MethodPost, sessionID, "secret")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusOK)
+	}
+	var info SessionInfo
+	if err := json.NewDecoder(recorder.Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	if info.SessionID != sessionID || info.SegmentCount != 0 {
+		t.Errorf("response = %+v, want session %s with no segments", info, sessionID)
+	}
+	if got := session.Transcript(); got != "" {
+		t.Errorf("transcript after reset = %q, want empty", got)
+	}
+	readUntil(t, conn, "status", "session_reset")
+	// The persisted transcript does not bring the cleared text back
+	archive, err := loadPersistedSession(sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archive.Segments) != 0 || archive.Transcript != "" {
+		t.Errorf("persisted archive after reset = %d segments, %q; want none", len(archive.Segments), archive.Transcript)
+	}
+}
+
+func TestServeSessionEvents(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TRANSCRIPT_DIR", dir)
+	live := newSession(func() {}, ConfigMessage{LanguageCode: "en-US"})
+	live.recordEvent("session_started", map[string]interface{}{"languageCode": "en-US"})
+	live.recordEvent("language_switched", map[string]interface{}{"languageCode": "fr-FR"})
+	sessionRegistry.Register(live)
+	defer sessionRegistry.Unregister(live.ID)
+
+	ended := newSession(func() {}, ConfigMessage{LanguageCode: "en-US"})
+	ended.recordEvent("session_started", nil)
+	ended.recordEvent("session_reset", map[string]interface{}{"remoteIP": "203.0.113.7"})
+	// A line cut short by a crash is skipped when the log is read back
+	if err := appendSessionFileLine(ended.ID, ".events.jsonl", []byte(`{"eventType":"sess`)); err != nil {
+		t.Fatal(err)
+	}
+	ended.recordEvent("session_ended", nil)
+
+	tests := []struct {
+		name       string
+		method     string
+		sessionID  string
+		wantStatus int
+		wantEvents []string
+	}{
+		{"live session from memory", http.MethodGet, live.ID, http.StatusOK, []string{"session_started", "language_switched"}},
+		{"ended session from disk", http.MethodGet, ended.ID, http.StatusOK, []string{"session_started", "session_reset", "session_ended"}},
+		{"unknown session", http.MethodGet, "missing", http.StatusNotFound, nil},
+		{"invalid session ID", http.MethodGet, "../secrets", http.StatusBadRequest, nil},
+		{"wrong method", http.MethodPost, live.ID, http.StatusMethodNotAllowed, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/api/sessions/events", nil)
+			r.SetPathValue("sessionID", tt.sessionID)
+			recorder := httptest.NewRecorder()
+			serveSessionEvents(recorder, r)
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var events []SessionEvent
+			if err := json.NewDecoder(recorder.Body).Decode(&events); err != nil {
+				t.Fatal(err)
+			}
+			var types []string
+			for _, event := range events {
+				types = append(types, event.EventType)
+				if event.Timestamp.IsZero() {
+					t.Errorf("event %s has no timestamp", event.EventType)
+				}
+			}
+			if !reflect.DeepEqual(types, tt.wantEvents) {
+				t.Errorf("events = %v, want %v", types, tt.wantEvents)
+			}
+		})
+	}
+
+	if got := ended.EventLog()[1].Details["remoteIP"]; got != "203.0.113.7" {
+		t.Errorf("event details = %v, want the recorded remote IP", got)
+	}
+}
+
+func TestServeBatchTranscribeUploadLimit(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxBytes   string
+		bodySize   int
+		wantStatus int
+		wantError  string
+	}{
+		{"60MB over the default 50MB limit", "", 60 << 20, http.StatusRequestEntityTooLarge, "Request body exceeds 52428800 bytes"},
+		{"over a configured limit", "1024", 2048, http.StatusRequestEntityTooLarge, "Request body exceeds 1024 bytes"},
+		{"empty body", "", 0, http.StatusBadRequest, "Empty audio body"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MAX_UPLOAD_BYTES", tt.maxBytes)
+			r := httptest.NewRequest(http.MethodPost, "/api/transcribe?format=LINEAR16&sampleRate=16000", bytes.NewReader(make([]byte, tt.bodySize)))
+			recorder := httptest.NewRecorder()
+			serveBatchTranscribe(recorder, r)
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			var response ErrorResponse
+			if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+			if response.Error != tt.wantError {
+				t.Errorf("error = %q, want %q", response.Error, tt.wantError)
+			}
+		})
+	}
+}
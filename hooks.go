@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// HookType identifies a point in the transcription pipeline where hooks run
+type HookType int
+
+const (
+	// HookPreSend runs on every recognition result before it is sent to the client
+	HookPreSend HookType = iota
+	// HookPostFinal runs on final results before they are added to the stored transcript
+	HookPostFinal
+	// HookPreSummary runs on the transcript before it is sent to the summary model
+	HookPreSummary
+)
+
+// String returns the hook type name used in logs
+func (t HookType) String() string {
+	switch t {
+	case HookPreSend:
+		return "pre_send"
+	case HookPostFinal:
+		return "post_final"
+	case HookPreSummary:
+		return "pre_summary"
+	default:
+		return fmt.Sprintf("hook_%d", int(t))
+	}
+}
+
+// HookEvent is the data passed through hooks; hooks return it, possibly modified
+type HookEvent struct {
+	Type         HookType
+	SessionID    string
+	Text         string
+	LanguageCode string
+	IsFinal      bool
+	// NewTranscript is the transcript added since the last summary (HookPreSummary only)
+	NewTranscript string
+}
+
+// Hook processes an event at a pipeline point
+type Hook interface {
+	Handle(ctx context.Context, event HookEvent) (HookEvent, error)
+}
+
+// HookRegistry holds the hooks registered for each pipeline point
+type HookRegistry struct {
+	mu    sync.RWMutex
+	hooks map[HookType][]Hook
+}
+
+// hookRegistry is the server-wide hook registry, populated by initHooks
+var hookRegistry = NewHookRegistry()
+
+// NewHookRegistry creates an empty hook registry
+func NewHookRegistry() *HookRegistry {
+	return &HookRegistry{hooks: make(map[HookType][]Hook)}
+}
+
+// Register adds a hook for the given type; hooks run in registration order
+func (r *HookRegistry) Register(hookType HookType, hook Hook) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hooks[hookType] = append(r.hooks[hookType], hook)
+}
+
+// Run passes the event through every hook registered for its type.
+// A hook that fails or panics is skipped and the event it received is passed on unchanged.
+func (r *HookRegistry) Run(ctx context.Context, event HookEvent) HookEvent {
+	r.mu.RLock()
+	hooks := r.hooks[event.Type]
+	r.mu.RUnlock()
+
+	for i, hook := range hooks {
+		result, err := runHook(ctx, hook, event)
+		if err != nil {
+			logger.Error("Hook failed, skipping", "hookType", event.Type.String(), "index", i, "sessionID", event.SessionID, "error", err)
+			continue
+		}
+		event = result
+	}
+	return event
+}
+
+// runHook calls a single hook, turning a panic into an error
+func runHook(ctx context.Context, hook Hook, event HookEvent) (result HookEvent, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("hook panicked: %v", recovered)
+		}
+	}()
+	result, err = hook.Handle(ctx, event)
+	result.Type = event.Type
+	return result, err
+}
+
+// LoggingHook logs every event it sees at debug level
+type LoggingHook struct{}
+
+// Handle logs the event and returns it unchanged
+func (LoggingHook) Handle(ctx context.Context, event HookEvent) (HookEvent, error) {
+	logger.Debug("Hook event",
+		"hookType", event.Type.String(),
+		"sessionID", event.SessionID,
+		"languageCode", event.LanguageCode,
+		"isFinal", event.IsFinal,
+		"textLength", len(event.Text))
+	return event, nil
+}
+
+// RedactionHook masks PII in the event text
+type RedactionHook struct {
+	Patterns []*regexp.Regexp
+}
+
+// Handle redacts the event text and new transcript
+func (h RedactionHook) Handle(ctx context.Context, event HookEvent) (HookEvent, error) {
+	event.Text = redactPII(event.Text, h.Patterns)
+	event.NewTranscript = redactPII(event.NewTranscript, h.Patterns)
+	return event, nil
+}
+
+// initHooks registers the built-in hooks listed in HOOKS (comma-separated: logging, redaction)
+func initHooks() {
+	for _, name := range strings.Split(os.Getenv("HOOKS"), ",") {
+		switch strings.TrimSpace(name) {
+		case "":
+			continue
+		case "logging":
+			for _, hookType := range []HookType{HookPreSend, HookPostFinal, HookPreSummary} {
+				hookRegistry.Register(hookType, LoggingHook{})
+			}
+		case "redaction":
+			// The client still sees the raw text; only stored and summarized text is redacted
+			redaction := RedactionHook{Patterns: builtinRedactionPatterns}
+			hookRegistry.Register(HookPostFinal, redaction)
+			hookRegistry.Register(HookPreSummary, redaction)
+		default:
+			logger.Warn("Unknown hook in HOOKS, ignoring", "hook", name)
+			continue
+		}
+		logger.Info("Hook enabled", "hook", strings.TrimSpace(name))
+	}
+}
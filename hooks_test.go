@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// hookFunc adapts a function to the Hook interface
+type hookFunc func(ctx context.Context, event HookEvent) (HookEvent, error)
+
+func (f hookFunc) Handle(ctx context.Context, event HookEvent) (HookEvent, error) {
+	return f(ctx, event)
+}
+
+// appendHook appends suffix to the event text
+func appendHook(suffix string) Hook {
+	return hookFunc(func(ctx context.Context, event HookEvent) (HookEvent, error) {
+		event.Text += suffix
+		return event, nil
+	})
+}
+
+func TestHookRegistryRun(t *testing.T) {
+	panicking := hookFunc(func(ctx context.Context, event HookEvent) (HookEvent, error) {
+		panic("hook bug")
+	})
+	failing := hookFunc(func(ctx context.Context, event HookEvent) (HookEvent, error) {
+		event.Text = "partially changed"
+		return event, errors.New("backend unavailable")
+	})
+	retyping := hookFunc(func(ctx context.Context, event HookEvent) (HookEvent, error) {
+		event.Type = HookPreSummary
+		event.Text += " retyped"
+		return event, nil
+	})
+
+	tests := []struct {
+		name  string
+		hooks []Hook
+		want  string
+	}{
+		{"no hooks", nil, "text"},
+		{"registration order", []Hook{appendHook(" one"), appendHook(" two"), appendHook(" three")}, "text one two three"},
+		{"panicking hook skipped", []Hook{appendHook(" one"), panicking, appendHook(" two")}, "text one two"},
+		{"failing hook changes discarded", []Hook{appendHook(" one"), failing, appendHook(" two")}, "text one two"},
+		{"hooks cannot change the event type", []Hook{retyping, appendHook(" two")}, "text retyped two"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := NewHookRegistry()
+			for _, hook := range tt.hooks {
+				registry.Register(HookPostFinal, hook)
+			}
+			registry.Register(HookPreSend, appendHook(" pre-send"))
+
+			got := registry.Run(context.Background(), HookEvent{Type: HookPostFinal, SessionID: "abc", Text: "text", IsFinal: true})
+			if got.Text != tt.want {
+				t.Errorf("text = %q, want %q", got.Text, tt.want)
+			}
+			if got.Type != HookPostFinal || got.SessionID != "abc" || !got.IsFinal {
+				t.Errorf("event = %+v, want the other fields unchanged", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Slack delivery settings
+const (
+	slackMaxRetries        = 3
+	slackDefaultRetryAfter = time.Second
+	slackMaxSectionLength  = 2990 // Slack rejects section text longer than 3000 characters
+)
+
+// Outbound webhook defaults, overridden by initWebhookClient
+const (
+	defaultWebhookMaxIdleConns = 10
+	defaultWebhookTimeout      = 10 * time.Second
+	defaultWebhookMaxRetries   = 3
+	webhookIdleConnTimeout     = 90 * time.Second
+)
+
+// webhookRetryInterval is the wait between webhook delivery attempts
+var webhookRetryInterval = 5 * time.Second
+
+// webhookClient is shared by all summary webhook and Slack deliveries so connections to the same host are reused
+var webhookClient = newWebhookClient(defaultWebhookMaxIdleConns, defaultWebhookTimeout, false)
+
+// webhookAllowPrivateNetworks disables the private address checks on webhook and Slack URLs, for deployments posting to internal services
+var webhookAllowPrivateNetworks bool
+
+// webhookMaxRetries is the number of retries after a failed webhook delivery
+var webhookMaxRetries = defaultWebhookMaxRetries
+
+// newWebhookClient creates an HTTP client keeping up to maxIdleConns idle connections per host.
+// Unless allowPrivateNetworks is set, connections to loopback, private, link-local and metadata addresses are refused
+// at dial time, so a client-supplied webhook URL cannot reach internal services even through DNS or redirects.
+func newWebhookClient(maxIdleConns int, timeout time.Duration, allowPrivateNetworks bool) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !allowPrivateNetworks {
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: webhookDialControl}
+		transport.DialContext = dialer.DialContext
+		// A proxy would resolve and dial the destination itself, bypassing the address check
+		transport.Proxy = nil
+	}
+	transport.MaxIdleConns = 0 // No global limit; the per-host limit applies
+	transport.MaxIdleConnsPerHost = maxIdleConns
+	transport.IdleConnTimeout = webhookIdleConnTimeout
+	return &http.Client{Transport: transport, Timeout: timeout}
+}
+
+// initWebhookClient configures the shared webhook client from WEBHOOK_MAX_IDLE_CONNS, WEBHOOK_TIMEOUT_MS,
+// WEBHOOK_MAX_RETRIES and WEBHOOK_ALLOW_PRIVATE_NETWORKS
+func initWebhookClient() {
+	maxIdleConns := int(getEnvInt64("WEBHOOK_MAX_IDLE_CONNS", defaultWebhookMaxIdleConns))
+	timeout := time.Duration(getEnvInt64("WEBHOOK_TIMEOUT_MS", defaultWebhookTimeout.Milliseconds())) * time.Millisecond
+	webhookAllowPrivateNetworks = os.Getenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS") == "true"
+	webhookClient = newWebhookClient(maxIdleConns, timeout, webhookAllowPrivateNetworks)
+	if webhookAllowPrivateNetworks {
+		logger.Warn("Webhook deliveries may reach private network addresses")
+	}
+
+	if retries := int(getEnvInt64("WEBHOOK_MAX_RETRIES", defaultWebhookMaxRetries)); retries >= 0 {
+		webhookMaxRetries = retries
+	}
+}
+
+// sendWebhook POSTs a signed payload to url on the shared webhook client,
+// retrying up to WEBHOOK_MAX_RETRIES times on transport errors and non-2xx responses
+func sendWebhook(ctx context.Context, url, secret string, payload []byte) error {
+	var lastErr error
+	for attempt := 0; attempt <= webhookMaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(webhookRetryInterval):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+		if err != nil {
+			return fmt.Errorf("error creating webhook request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if secret != "" {
+			req.Header.Set("X-Signature-256", "sha256="+signWebhookPayload(secret, payload))
+		}
+
+		resp, err := webhookClient.Do(req)
+		if err != nil {
+			lastErr = fmt.Errorf("error sending webhook: %v", err)
+		} else {
+			// Drain the body so the connection goes back to the idle pool
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				return nil
+			}
+			lastErr = fmt.Errorf("webhook returned status %d", resp.StatusCode)
+		}
+
+		logger.Warn("Webhook delivery attempt failed",
+			"url", url,
+			"attempt", attempt+1,
+			"error", lastErr)
+	}
+	return lastErr
+}
+
+// slackText is a Block Kit text object
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// slackBlock is a Block Kit layout block
+type slackBlock struct {
+	Type string     `json:"type"`
+	Text *slackText `json:"text,omitempty"`
+}
+
+// slackMessage is the body POSTed to a Slack incoming webhook
+type slackMessage struct {
+	Channel string       `json:"channel,omitempty"`
+	Text    string       `json:"text"`
+	Blocks  []slackBlock `json:"blocks"`
+}
+
+// truncateRunes shortens s to at most max characters without splitting a multi-byte character
+func truncateRunes(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max])
+}
+
+// newSlackSummaryMessage formats a summary as Block Kit blocks: a header with the session and time, and the summary as markdown
+func newSlackSummaryMessage(channel, sessionID, summary string, timestamp time.Time) slackMessage {
+	header := fmt.Sprintf("Session %s - %s", sessionID, timestamp.Format(time.RFC3339))
+	return slackMessage{
+		Channel: channel,
+		Text:    header,
+		Blocks: []slackBlock{
+			{Type: "header", Text: &slackText{Type: "plain_text", Text: truncateRunes(header, 150)}},
+			{Type: "section", Text: &slackText{Type: "mrkdwn", Text: truncateRunes(summary, slackMaxSectionLength)}},
+		},
+	}
+}
+
+// postToSlack posts a summary to a Slack incoming webhook, waiting for Retry-After when rate limited
+func postToSlack(ctx context.Context, webhookURL, channel, sessionID, summary string) error {
+	payload, err := json.Marshal(newSlackSummaryMessage(channel, sessionID, summary, time.Now()))
+	if err != nil {
+		return fmt.Errorf("error marshaling Slack message: %v", err)
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(payload))
+		if err != nil {
+			return fmt.Errorf("error creating Slack request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := webhookClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("error posting to Slack: %v", err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return nil
+		}
+		if resp.StatusCode != http.StatusTooManyRequests || attempt == slackMaxRetries {
+			return fmt.Errorf("slack returned status %d", resp.StatusCode)
+		}
+
+		retryAfter := slackDefaultRetryAfter
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			retryAfter = time.Duration(seconds) * time.Second
+		}
+		logger.Warn("Slack rate limited, retrying",
+			"sessionID", sessionID,
+			"attempt", attempt+1,
+			"retryAfter", retryAfter)
+
+		select {
+		case <-time.After(retryAfter):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// notifySlack posts a final summary to Slack and logs the outcome
+func notifySlack(webhookURL, channel, sessionID, summary string) {
+	if err := postToSlack(context.Background(), webhookURL, channel, sessionID, summary); err != nil {
+		logger.Error("Failed to post summary to Slack", "sessionID", sessionID, "error", err)
+		return
+	}
+	logger.Info("Summary posted to Slack", "sessionID", sessionID, "channel", channel)
+}
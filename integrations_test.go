@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSendWebhook(t *testing.T) {
+	t.Cleanup(func() {
+		webhookClient = newWebhookClient(defaultWebhookMaxIdleConns, defaultWebhookTimeout, false)
+		webhookMaxRetries, webhookRetryInterval = defaultWebhookMaxRetries, 5*time.Second
+	})
+	webhookClient = newWebhookClient(defaultWebhookMaxIdleConns, time.Second, true)
+	webhookMaxRetries, webhookRetryInterval = 2, time.Millisecond
+
+	payload := []byte(`{"sessionID":"abc"}`)
+	tests := []struct {
+		name         string
+		failures     int32
+		secret       string
+		wantErr      bool
+		wantRequests int32
+	}{
+		{"delivered", 0, "", false, 1},
+		{"signed", 0, "secret", false, 1},
+		{"retried", 2, "", false, 3},
+		{"retries exhausted", 5, "", true, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests, connections atomic.Int32
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				if signature := r.Header.Get("X-Signature-256"); tt.secret != "" && signature != "sha256="+signWebhookPayload(tt.secret, body) {
+					t.Errorf("X-Signature-256 = %q", signature)
+				}
+				if requests.Add(1) <= tt.failures {
+					w.WriteHeader(http.StatusBadGateway)
+				}
+			}))
+			server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+				if state == http.StateNew {
+					connections.Add(1)
+				}
+			}
+			server.Start()
+			defer server.Close()
+
+			err := sendWebhook(context.Background(), server.URL, tt.secret, payload)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("sendWebhook() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("%d requests, want %d", got, tt.wantRequests)
+			}
+			// Retries go through the shared client, which keeps the connection alive
+			if got := connections.Load(); got != 1 {
+				t.Errorf("%d connections opened, want 1", got)
+			}
+		})
+	}
+}
+
+func TestPostToSlack(t *testing.T) {
+	t.Cleanup(func() { webhookClient = newWebhookClient(defaultWebhookMaxIdleConns, defaultWebhookTimeout, false) })
+	webhookClient = newWebhookClient(defaultWebhookMaxIdleConns, 5*time.Second, true)
+
+	tests := []struct {
+		name         string
+		statuses     []int  // Status of each response; once exhausted, requests succeed
+		retryAfter   string // Retry-After header on 429 responses
+		timeout      time.Duration
+		wantErr      bool
+		wantRequests int32
+		wantMinWait  time.Duration
+	}{
+		{"delivered", nil, "", 0, false, 1, 0},
+		{"rate limited then delivered", []int{429, 429}, "0", 0, false, 3, 0},
+		{"waits for Retry-After", []int{429}, "1", 0, false, 2, time.Second},
+		{"rate limited past the retries", []int{429, 429, 429, 429, 429}, "0", 0, true, slackMaxRetries + 1, 0},
+		{"other errors not retried", []int{500}, "0", 0, true, 1, 0},
+		{"cancelled while waiting", []int{429}, "60", 50 * time.Millisecond, true, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			var received slackMessage
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+					t.Errorf("decoding Slack message: %v", err)
+				}
+				n := int(requests.Add(1))
+				if n > len(tt.statuses) {
+					return
+				}
+				if tt.statuses[n-1] == http.StatusTooManyRequests {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.statuses[n-1])
+			}))
+			defer server.Close()
+
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+			start := time.Now()
+			err := postToSlack(ctx, server.URL, "#meetings", "abc123", "Budget approved.")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("postToSlack() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.timeout > 0 && err != context.DeadlineExceeded {
+				t.Errorf("postToSlack() error = %v, want the context error", err)
+			}
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("%d requests, want %d", got, tt.wantRequests)
+			}
+			if elapsed := time.Since(start); elapsed < tt.wantMinWait {
+				t.Errorf("returned after %v, want at least %v", elapsed, tt.wantMinWait)
+			}
+			if received.Channel != "#meetings" || len(received.Blocks) != 2 || received.Blocks[1].Text.Text != "Budget approved." {
+				t.Errorf("Slack message = %+v, want the summary for #meetings", received)
+			}
+		})
+	}
+}
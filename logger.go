@@ -1,29 +1,33 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
 	"log/slog"
+	"net/http"
 	"os"
 	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	logging "google.golang.org/api/logging/v2"
+	"google.golang.org/api/option"
 )
 
 // Global logger instance
 var logger *slog.Logger
 
+// logOutput is where logs are written; pipe mode moves them to stderr to keep stdout for transcripts
+var logOutput io.Writer = os.Stdout
+
 // initLogger initializes the structured logger based on configuration
 func initLogger() {
 	// Get log level from environment variable, default to INFO
-	logLevel := os.Getenv("LOG_LEVEL")
-	var level slog.Level
-	switch strings.ToUpper(logLevel) {
-	case "DEBUG":
-		level = slog.LevelDebug
-	case "INFO":
-		level = slog.LevelInfo
-	case "WARN", "WARNING":
-		level = slog.LevelWarn
-	case "ERROR":
-		level = slog.LevelError
-	default:
+	level, ok := parseLogLevel(os.Getenv("LOG_LEVEL"))
+	if !ok {
 		level = slog.LevelInfo // Default to INFO
 	}
 
@@ -32,19 +36,273 @@ func initLogger() {
 	var handler slog.Handler
 	switch strings.ToUpper(logFormat) {
 	case "TEXT":
-		handler = slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		handler = slog.NewTextHandler(logOutput, &slog.HandlerOptions{
 			Level: level,
 		})
 	case "JSON", "":
-		handler = slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+		handler = slog.NewJSONHandler(logOutput, &slog.HandlerOptions{
 			Level: level,
 		})
 	default:
-		handler = slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+		handler = slog.NewJSONHandler(logOutput, &slog.HandlerOptions{
 			Level: level,
 		})
 	}
 
 	logger = slog.New(handler)
 	slog.SetDefault(logger)
-}
\ No newline at end of file
+}
+
+// parseLogLevel maps a level name such as "debug" or "WARN" to its slog level
+func parseLogLevel(name string) (slog.Level, bool) {
+	switch strings.ToUpper(name) {
+	case "DEBUG":
+		return slog.LevelDebug, true
+	case "INFO":
+		return slog.LevelInfo, true
+	case "WARN", "WARNING":
+		return slog.LevelWarn, true
+	case "ERROR":
+		return slog.LevelError, true
+	}
+	return 0, false
+}
+
+// levelFilterHandler drops records below a minimum level before the wrapped handler sees them.
+// The wrapped handler's own level still applies, so the filter can only reduce verbosity.
+type levelFilterHandler struct {
+	slog.Handler
+	level slog.Level
+}
+
+// Enabled reports whether both the filter and the wrapped handler accept the level
+func (h levelFilterHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level && h.Handler.Enabled(ctx, level)
+}
+
+// WithAttrs keeps the filter on the derived handler
+func (h levelFilterHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return levelFilterHandler{Handler: h.Handler.WithAttrs(attrs), level: h.level}
+}
+
+// WithGroup keeps the filter on the derived handler
+func (h levelFilterHandler) WithGroup(name string) slog.Handler {
+	return levelFilterHandler{Handler: h.Handler.WithGroup(name), level: h.level}
+}
+
+// newSessionLogger returns the global logger tagged with the session ID, filtered to the level requested
+// by the client; unknown levels are ignored
+func newSessionLogger(sessionID, requestedLevel string) *slog.Logger {
+	sessionLogger := logger.With("sessionID", sessionID)
+	if requestedLevel == "" {
+		return sessionLogger
+	}
+	level, ok := parseLogLevel(requestedLevel)
+	if !ok {
+		sessionLogger.Warn("Ignoring unknown session log level", "logLevel", requestedLevel)
+		return sessionLogger
+	}
+	return slog.New(levelFilterHandler{Handler: sessionLogger.Handler(), level: level})
+}
+
+// Cloud audit log settings
+const (
+	// cloudAuditLogID is the Cloud Logging log receiving session audit entries, URL-encoded as log names require
+	cloudAuditLogID = "cloudaudit.googleapis.com%2Factivity"
+	// cloudAuditServiceName identifies this server in the serviceName of audit entries
+	cloudAuditServiceName = "live_transcription"
+	// cloudAuditQueueSize is how many entries can wait to be written before new ones are dropped
+	cloudAuditQueueSize = 256
+	// cloudAuditBatchSize is the maximum number of entries written in one request
+	cloudAuditBatchSize = 50
+)
+
+// CloudAuditEntry is an auditable operation on a session
+type CloudAuditEntry struct {
+	MethodName     string // e.g. "live_transcription.session.start"
+	SessionID      string
+	PrincipalEmail string
+	CallerIP       string
+	UserAgent      string
+	Metadata       map[string]interface{}
+	Timestamp      time.Time
+}
+
+// CloudAuditLogger writes session audit entries to Cloud Logging in AuditLog format, in the background
+// and in the order they were logged
+type CloudAuditLogger struct {
+	service   *logging.Service
+	projectID string
+	entries   chan CloudAuditEntry
+	mu        sync.RWMutex // Guards closed against entries being queued while Close closes the queue
+	closed    bool
+	done      chan struct{} // Closed once run has written every queued entry
+}
+
+// cloudAuditLogger records session operations in Cloud Logging; nil unless ENABLE_CLOUD_AUDIT_LOG is true
+var cloudAuditLogger *CloudAuditLogger
+
+// NewCloudAuditLogger creates a logger writing to the audit log of projectID and starts its writer
+func NewCloudAuditLogger(ctx context.Context, projectID string) (*CloudAuditLogger, error) {
+	service, err := logging.NewService(ctx, append(googleClientOptions(), option.WithScopes(logging.LoggingWriteScope))...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating Cloud Logging client: %v", err)
+	}
+	return newCloudAuditLogger(service, projectID), nil
+}
+
+// newCloudAuditLogger creates a logger writing through service and starts its writer
+func newCloudAuditLogger(service *logging.Service, projectID string) *CloudAuditLogger {
+	l := &CloudAuditLogger{
+		service:   service,
+		projectID: projectID,
+		entries:   make(chan CloudAuditEntry, cloudAuditQueueSize),
+		done:      make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+// Log queues an entry without blocking; entries are dropped when the queue is full or the logger is nil or closed
+func (l *CloudAuditLogger) Log(entry CloudAuditEntry) {
+	if l == nil {
+		return
+	}
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
+		logger.Warn("Cloud audit log closed, dropping entry", "methodName", entry.MethodName, "sessionID", entry.SessionID)
+		return
+	}
+	select {
+	case l.entries <- entry:
+	default:
+		logger.Warn("Cloud audit log queue full, dropping entry", "methodName", entry.MethodName, "sessionID", entry.SessionID)
+	}
+}
+
+// run writes queued entries, batching those that accumulated while the previous write was in flight
+func (l *CloudAuditLogger) run() {
+	defer close(l.done)
+	for entry := range l.entries {
+		batch := []CloudAuditEntry{entry}
+	drain:
+		for len(batch) < cloudAuditBatchSize {
+			select {
+			case entry, ok := <-l.entries:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, entry)
+			default:
+				break drain
+			}
+		}
+		if err := l.write(batch); err != nil {
+			logger.Error("Failed to write cloud audit log entries", "count", len(batch), "error", err)
+		}
+	}
+}
+
+// Close stops accepting entries and waits until the queued ones are written or ctx is done
+func (l *CloudAuditLogger) Close(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	if !l.closed {
+		l.closed = true
+		close(l.entries)
+	}
+	l.mu.Unlock()
+	select {
+	case <-l.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("cloud audit entries still queued: %w", ctx.Err())
+	}
+}
+
+// write sends a batch of entries to Cloud Logging
+func (l *CloudAuditLogger) write(batch []CloudAuditEntry) error {
+	entries := make([]*logging.LogEntry, 0, len(batch))
+	for _, entry := range batch {
+		payload, err := json.Marshal(auditLogPayload(entry))
+		if err != nil {
+			return fmt.Errorf("error encoding audit entry: %v", err)
+		}
+		entries = append(entries, &logging.LogEntry{
+			ProtoPayload: googleapi.RawMessage(payload),
+			Severity:     "NOTICE",
+			Timestamp:    entry.Timestamp.UTC().Format(time.RFC3339Nano),
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := l.service.Entries.Write(&logging.WriteLogEntriesRequest{
+		LogName: fmt.Sprintf("projects/%s/logs/%s", l.projectID, cloudAuditLogID),
+		Resource: &logging.MonitoredResource{
+			Type:   "global",
+			Labels: map[string]string{"project_id": l.projectID},
+		},
+		Entries: entries,
+	}).Context(ctx).Do()
+	return err
+}
+
+// auditLogPayload is the google.cloud.audit.AuditLog protoPayload of an entry
+func auditLogPayload(entry CloudAuditEntry) map[string]interface{} {
+	payload := map[string]interface{}{
+		"@type":        "type.googleapis.com/google.cloud.audit.AuditLog",
+		"serviceName":  cloudAuditServiceName,
+		"methodName":   entry.MethodName,
+		"resourceName": entry.SessionID,
+		"authenticationInfo": map[string]interface{}{
+			"principalEmail": entry.PrincipalEmail,
+		},
+		"requestMetadata": map[string]interface{}{
+			"callerIp":                entry.CallerIP,
+			"callerSuppliedUserAgent": entry.UserAgent,
+		},
+	}
+	if len(entry.Metadata) > 0 {
+		payload["metadata"] = entry.Metadata
+	}
+	return payload
+}
+
+// trustIAPHeaders is whether the server only receives requests through Identity-Aware Proxy (TRUST_IAP_HEADERS),
+// which overwrites the identity headers that clients could otherwise set
+var trustIAPHeaders bool
+
+// authenticatedEmail returns the user email asserted by Identity-Aware Proxy in front of the server, if any
+func authenticatedEmail(r *http.Request) string {
+	if !trustIAPHeaders {
+		return ""
+	}
+	return strings.TrimPrefix(r.Header.Get("X-Goog-Authenticated-User-Email"), "accounts.google.com:")
+}
+
+// initCloudAuditLogger enables Cloud Logging audit entries when ENABLE_CLOUD_AUDIT_LOG is true
+func initCloudAuditLogger() {
+	trustIAPHeaders = os.Getenv("TRUST_IAP_HEADERS") == "true"
+	if os.Getenv("ENABLE_CLOUD_AUDIT_LOG") != "true" {
+		return
+	}
+	projectID := os.Getenv("GCP_PROJECT_ID")
+	if projectID == "" {
+		logger.Error("ENABLE_CLOUD_AUDIT_LOG requires GCP_PROJECT_ID, cloud audit log disabled")
+		return
+	}
+	auditor, err := NewCloudAuditLogger(context.Background(), projectID)
+	if err != nil {
+		logger.Error("Failed to create cloud audit logger, cloud audit log disabled", "error", err)
+		return
+	}
+	cloudAuditLogger = auditor
+	logger.Info("Cloud audit log enabled", "projectID", projectID, "logID", cloudAuditLogID, "trustIAPHeaders", trustIAPHeaders)
+}
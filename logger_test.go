@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	logging "google.golang.org/api/logging/v2"
+	"google.golang.org/api/option"
+)
+
+func TestAuthenticatedEmail(t *testing.T) {
+	tests := []struct {
+		name      string
+		trustIAP  bool
+		header    string
+		wantEmail string
+	}{
+		{"IAP header trusted", true, "accounts.google.com:alice@example.com", "alice@example.com"},
+		{"IAP header ignored without TRUST_IAP_HEADERS", false, "accounts.google.com:alice@example.com", ""},
+		{"no header", true, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := trustIAPHeaders
+			trustIAPHeaders = tt.trustIAP
+			t.Cleanup(func() { trustIAPHeaders = previous })
+
+			r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+			if tt.header != "" {
+				r.Header.Set("X-Goog-Authenticated-User-Email", tt.header)
+			}
+			if got := authenticatedEmail(r); got != tt.wantEmail {
+				t.Errorf("authenticatedEmail() = %q, want %q", got, tt.wantEmail)
+			}
+		})
+	}
+}
+
+// fakeCloudLogging records the entries written to the Cloud Logging API
+type fakeCloudLogging struct {
+	mu       sync.Mutex
+	methods  []string
+	payloads []map[string]interface{}
+	logNames []string
+	delay    time.Duration
+}
+
+func (f *fakeCloudLogging) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	time.Sleep(f.delay)
+	var request logging.WriteLogEntriesRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, entry := range request.Entries {
+		var payload map[string]interface{}
+		json.Unmarshal(entry.ProtoPayload, &payload)
+		method, _ := payload["methodName"].(string)
+		f.methods = append(f.methods, method)
+		f.payloads = append(f.payloads, payload)
+		f.logNames = append(f.logNames, request.LogName)
+	}
+	w.Write([]byte("{}"))
+}
+
+// newTestCloudAuditLogger creates a cloud audit logger writing to a fake Cloud Logging server
+func newTestCloudAuditLogger(t *testing.T, delay time.Duration) (*CloudAuditLogger, *fakeCloudLogging) {
+	t.Helper()
+	fake := &fakeCloudLogging{delay: delay}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	service, err := logging.NewService(context.Background(),
+		option.WithEndpoint(server.URL+"/"),
+		option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newCloudAuditLogger(service, "project"), fake
+}
+
+func TestCloudAuditLoggerCloseFlushesQueue(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries int
+		delay   time.Duration
+		timeout time.Duration
+		wantErr bool
+	}{
+		{"no entries", 0, 0, time.Second, false},
+		{"one batch", 3, 0, time.Second, false},
+		{"several batches", cloudAuditBatchSize + 10, 0, 5 * time.Second, false},
+		{"slow endpoint times out", 2, 500 * time.Millisecond, 50 * time.Millisecond, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auditor, fake := newTestCloudAuditLogger(t, tt.delay)
+			for i := 0; i < tt.entries; i++ {
+				auditor.Log(CloudAuditEntry{MethodName: fmt.Sprintf("method.%d", i), SessionID: "s1"})
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			if err := auditor.Close(ctx); (err != nil) != tt.wantErr {
+				t.Fatalf("Close() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				<-auditor.done
+			}
+			auditor.Log(CloudAuditEntry{MethodName: "after.close"}) // Dropped, must not panic
+
+			fake.mu.Lock()
+			defer fake.mu.Unlock()
+			if len(fake.methods) != tt.entries {
+				t.Fatalf("written entries = %d, want %d", len(fake.methods), tt.entries)
+			}
+			for i, method := range fake.methods {
+				if want := fmt.Sprintf("method.%d", i); method != want {
+					t.Errorf("entry %d = %q, want %q", i, method, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCloudAuditLoggerEntryFormat(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry CloudAuditEntry
+		want  map[string]interface{}
+	}{
+		{"authenticated session start", CloudAuditEntry{
+			MethodName:     "live_transcription.session.start",
+			SessionID:      "s1",
+			PrincipalEmail: "alice@example.com",
+			CallerIP:       "203.0.113.7",
+			UserAgent:      "test-agent",
+			Metadata:       map[string]interface{}{"languageCode": "en-US"},
+		}, map[string]interface{}{
+			"@type":              "type.googleapis.com/google.cloud.audit.AuditLog",
+			"serviceName":        "live_transcription",
+			"methodName":         "live_transcription.session.start",
+			"resourceName":       "s1",
+			"authenticationInfo": map[string]interface{}{"principalEmail": "alice@example.com"},
+			"requestMetadata":    map[string]interface{}{"callerIp": "203.0.113.7", "callerSuppliedUserAgent": "test-agent"},
+			"metadata":           map[string]interface{}{"languageCode": "en-US"},
+		}},
+		{"anonymous without metadata", CloudAuditEntry{
+			MethodName: "live_transcription.session.stop",
+			SessionID:  "s2",
+			CallerIP:   "198.51.100.1",
+		}, map[string]interface{}{
+			"@type":              "type.googleapis.com/google.cloud.audit.AuditLog",
+			"serviceName":        "live_transcription",
+			"methodName":         "live_transcription.session.stop",
+			"resourceName":       "s2",
+			"authenticationInfo": map[string]interface{}{"principalEmail": ""},
+			"requestMetadata":    map[string]interface{}{"callerIp": "198.51.100.1", "callerSuppliedUserAgent": ""},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auditor, fake := newTestCloudAuditLogger(t, 0)
+			auditor.Log(tt.entry)
+			if err := auditor.Close(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			fake.mu.Lock()
+			defer fake.mu.Unlock()
+			if len(fake.payloads) != 1 {
+				t.Fatalf("written entries = %d, want 1", len(fake.payloads))
+			}
+			if want := "projects/project/logs/cloudaudit.googleapis.com%2Factivity"; fake.logNames[0] != want {
+				t.Errorf("log name = %q, want %q", fake.logNames[0], want)
+			}
+			if !reflect.DeepEqual(fake.payloads[0], tt.want) {
+				t.Errorf("protoPayload = %v, want %v", fake.payloads[0], tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	tests := []struct {
+		name   string
+		want   slog.Level
+		wantOK bool
+	}{
+		{"debug", slog.LevelDebug, true},
+		{"INFO", slog.LevelInfo, true},
+		{"warn", slog.LevelWarn, true},
+		{"Warning", slog.LevelWarn, true},
+		{"error", slog.LevelError, true},
+		{"trace", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseLogLevel(tt.name)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("parseLogLevel(%q) = %v, %v, want %v, %v", tt.name, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestNewSessionLogger(t *testing.T) {
+	tests := []struct {
+		name           string
+		serverLevel    slog.Level
+		requestedLevel string
+		wantLogged     []string
+	}{
+		{"server default", slog.LevelInfo, "", []string{"info", "warn"}},
+		{"client lowers verbosity", slog.LevelInfo, "warn", []string{"warn"}},
+		{"client cannot escalate to debug", slog.LevelInfo, "debug", []string{"info", "warn"}},
+		{"debug server honours debug", slog.LevelDebug, "debug", []string{"debug", "info", "warn"}},
+		{"unknown level ignored", slog.LevelInfo, "verbose", []string{"info", "warn"}},
+	}
+	previous := logger
+	t.Cleanup(func() { logger = previous })
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output bytes.Buffer
+			logger = slog.New(slog.NewJSONHandler(&output, &slog.HandlerOptions{Level: tt.serverLevel}))
+			sessionLogger := newSessionLogger("abc", tt.requestedLevel)
+			output.Reset() // Drop the warning about an unknown level
+			sessionLogger.Debug("debug")
+			sessionLogger.Info("info")
+			sessionLogger.With("chunk", 1).Warn("warn")
+
+			var logged []string
+			for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+				var record struct {
+					Msg       string `json:"msg"`
+					SessionID string `json:"sessionID"`
+				}
+				if err := json.Unmarshal([]byte(line), &record); err != nil {
+					t.Fatalf("invalid log line %q: %v", line, err)
+				}
+				if record.SessionID != "abc" {
+					t.Errorf("log line %q is not tagged with the session ID", line)
+				}
+				logged = append(logged, record.Msg)
+			}
+			if !reflect.DeepEqual(logged, tt.wantLogged) {
+				t.Errorf("logged %v, want %v", logged, tt.wantLogged)
+			}
+		})
+	}
+}
@@ -1,59 +1,217 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"slices"
 	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
 )
 
 func main() {
+	pipeConfig, pipeMode, err := parsePipeFlags(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
 	// Initialize logging
+	if pipeMode {
+		logOutput = os.Stderr
+	}
 	initLogger()
 
-	// Set up routes
-	http.HandleFunc("/ws", handleWebSocket)
-	http.HandleFunc("/api/default-prompt", serveDefaultPrompt)
-	http.HandleFunc("/api/presets", servePresets)
-	http.HandleFunc("/api/presets/", servePreset)
-	http.HandleFunc("/", serveStaticFiles)
+	// Authenticate Google Cloud clients with GCP_CREDENTIALS_FILE instead of ADC when set
+	initGCPCredentials()
 
-	// Get port from environment variable, default to 8080
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
-	// Ensure port has colon prefix
-	if !strings.HasPrefix(port, ":") {
-		port = ":" + port
+	// Pipe mode transcribes stdin to stdout without starting the HTTP server
+	if pipeMode {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if err := runPipeMode(ctx, pipeConfig); err != nil {
+			logger.Error("Pipe mode failed", "error", err)
+			os.Exit(1)
+		}
+		return
 	}
 
+	// Initialize the server-wide audio ingestion quota
+	initAudioQuota()
+
+	// Load default alternative languages per primary language
+	loadLanguageAlternatives()
+
+	// Remove sessions that stopped sending heartbeats
+	initSessionCleanup()
+
+	// Share Speech-to-Text clients across sessions, pre-warming them when enabled
+	initSpeechClientPool()
+
+	// Deny access to blocked client IPs
+	initIPBlocklist()
+
+	// Record WebSocket connection attempts in the audit log
+	initAuditLogger()
+
+	// Record session operations in Cloud Logging for compliance
+	initCloudAuditLogger()
+
+	// Register built-in transcription pipeline hooks
+	initHooks()
+
+	// Persist transcripts and summaries locally or to GCS
+	initStorageBackend()
+
+	// Archive or delete old session files so TRANSCRIPT_DIR does not fill the disk
+	initTranscriptRotator()
+
+	// Share pooled HTTP connections across outbound webhook and Slack deliveries
+	initWebhookClient()
+
+	// Bound concurrent ffmpeg processes and how long each transcoding may take
+	initTranscoder()
+
+	// Bound concurrent batch re-transcriptions of short sessions
+	initBatchRecognition()
+
+	// Bound concurrent Gemini requests per model to stay within API quotas
+	initModelSemaphores()
+
+	// Embed the synonym vocabulary in the background so sessions never wait for it
+	initSynonymExpander()
+
+	// Keep presets in memory and pick up preset file changes without a restart
+	initPresetWatcher()
+
+	// Bound how long slow clients can hold API and static file requests open
+	apiTimeout := timeoutMiddleware(time.Duration(getEnvInt64("API_TIMEOUT_MS", 10000)) * time.Millisecond)
+	// Batch transcription uploads and recognizes up to a minute of audio, which takes longer than other API calls
+	transcribeTimeout := timeoutMiddleware(time.Duration(getEnvInt64("TRANSCRIBE_TIMEOUT_MS", 120000)) * time.Millisecond)
+	staticTimeout := timeoutMiddleware(time.Duration(getEnvInt64("STATIC_TIMEOUT_MS", 5000)) * time.Millisecond)
+
+	// API routes require the API key when configured and accept cross-origin requests from allowed origins
+	api := []Middleware{loggingMiddleware, corsMiddleware, authMiddleware}
+	timedAPI := []Middleware{loggingMiddleware, corsMiddleware, authMiddleware, apiTimeout}
+	// Session listings can be large, so they are compressed for clients accepting gzip
+	compressedAPI := []Middleware{loggingMiddleware, corsMiddleware, authMiddleware, apiTimeout, gzipMiddleware}
+	// Transcripts are compressed too but have no timeout: they are flushed as they are written, which http.TimeoutHandler would buffer
+	streamedAPI := []Middleware{loggingMiddleware, corsMiddleware, authMiddleware, gzipMiddleware}
+	transcribeAPI := []Middleware{loggingMiddleware, corsMiddleware, authMiddleware, transcribeTimeout}
+
+	// Set up routes; WebSockets and event streams are long-lived and have no timeout
+	router := NewRouter()
+	router.HandleFunc("/ws", handleWebSocket, loggingMiddleware, authMiddleware)
+	router.HandleFunc("/api/default-prompt", serveDefaultPrompt, timedAPI...)
+	router.HandleFunc("/api/presets", servePresets, timedAPI...)
+	router.HandleFunc("/api/presets/", servePreset, timedAPI...)
+	router.HandleFunc("/api/presets/{name}/migrate", serveMigratePreset, timedAPI...)
+	router.HandleFunc("/api/metrics", serveMetrics, timedAPI...)
+	router.HandleFunc("/api/sessions", serveSessions, compressedAPI...)
+	router.HandleFunc("/api/sessions/{sessionID}", serveSession, compressedAPI...)
+	router.HandleFunc("/api/sessions/{sessionID}/export", serveSessionExport, timedAPI...)
+	router.HandleFunc("/api/sessions/{sessionID}/export-to-gdocs", serveGoogleDocsExport, timedAPI...)
+	router.HandleFunc("/api/sessions/{sessionID}/reset", serveSessionReset, timedAPI...)
+	router.HandleFunc("/api/sessions/{sessionID}/word-frequency", serveWordFrequency, timedAPI...)
+	router.HandleFunc("/api/sessions/{sessionID}/events", serveSessionEvents, timedAPI...)
+	router.HandleFunc("/api/sessions/{sessionID}/tags", serveSessionTags, timedAPI...)
+	router.HandleFunc("/api/sessions/{sessionID}/keywords", serveSessionKeywords, timedAPI...)
+	router.HandleFunc("/api/tags", serveTags, timedAPI...)
+	router.HandleFunc("/api/search", serveSearch, timedAPI...)
+	// http.TimeoutHandler buffers the whole response, which would defeat streaming the timeline
+	router.HandleFunc("/api/sessions/{sessionID}/timeline", serveSessionTimeline, api...)
+	router.HandleFunc("/api/sessions/{sessionID}/stream", serveSessionStream, api...)
+	router.HandleFunc("/api/sessions/{sessionID}/watch", serveSessionWatch, api...)
+	router.HandleFunc("/api/replay/{sessionID}", handleReplay, api...)
+	router.HandleFunc("/api/transcribe", serveBatchTranscribe, transcribeAPI...)
+	// Transcoding can outlast API_TIMEOUT_MS on large uploads; it is bounded by TRANSCODE_TIMEOUT_MS instead
+	router.HandleFunc("/api/transcode", serveTranscode, api...)
+	router.HandleFunc("/api/transcript/{sessionID}", serveTranscript, streamedAPI...)
+	router.HandleFunc("/", serveStaticFiles, loggingMiddleware, staticTimeout)
+
+	handler := IPBlocklistMiddleware(ipBlocklist)(router)
+
+	// Get ports from environment variables; the HTTP redirect listens on the standard port 80, where ACME challenges arrive
+	port := listenAddress(os.Getenv("PORT"), "8080")
+	httpPort := listenAddress(os.Getenv("HTTP_PORT"), "80")
+
 	// Get certificate file paths from environment variables or use defaults
 	certFile := os.Getenv("CERT_FILE")
 	if certFile == "" {
 		certFile = "certs/server.crt"
 	}
-	
+
 	keyFile := os.Getenv("KEY_FILE")
 	if keyFile == "" {
 		keyFile = "certs/server.key"
 	}
 
+	// ACME_DOMAIN obtains certificates from Let's Encrypt instead of the certificate files
+	var acmeManager *autocert.Manager
+	if domains := os.Getenv("ACME_DOMAIN"); domains != "" {
+		acmeManager = newACMEManager(domains)
+	}
+
 	// Check if certificate files exist
 	_, certErr := os.Stat(certFile)
 	_, keyErr := os.Stat(keyFile)
 
-	if certErr == nil && keyErr == nil {
-		// Both certificate files exist, start HTTPS server
-		logger.Info("Certificate files found, starting HTTPS server",
-			"address", fmt.Sprintf("https://localhost%s", port),
-			"websocket", fmt.Sprintf("wss://localhost%s/ws", port),
-			"certFile", certFile,
-			"keyFile", keyFile)
+	var servers []*http.Server
+	serverErrs := make(chan error, 2)
+	serve := func(server *http.Server, listen func() error) {
+		servers = append(servers, server)
+		go func() {
+			if err := listen(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				serverErrs <- err
+			}
+		}()
+	}
 
-		if err := http.ListenAndServeTLS(port, certFile, keyFile, nil); err != nil {
-			logger.Error("HTTPS server failed to start", "error", err)
-			os.Exit(1)
+	if acmeManager != nil || (certErr == nil && keyErr == nil) {
+		httpsServer := &http.Server{Addr: port, Handler: handler}
+		if acmeManager != nil {
+			// Both certificate file arguments are empty so the certificates come from the TLS config
+			httpsServer.TLSConfig = acmeManager.TLSConfig()
+			certFile, keyFile = "", ""
+			logger.Info("ACME domain configured, starting HTTPS server with Let's Encrypt certificates",
+				"address", fmt.Sprintf("https://localhost%s", port),
+				"websocket", fmt.Sprintf("wss://localhost%s/ws", port))
+		} else {
+			logger.Info("Certificate files found, starting HTTPS server",
+				"address", fmt.Sprintf("https://localhost%s", port),
+				"websocket", fmt.Sprintf("wss://localhost%s/ws", port),
+				"certFile", certFile,
+				"keyFile", keyFile)
+		}
+		serve(httpsServer, func() error { return httpsServer.ListenAndServeTLS(certFile, keyFile) })
+
+		// The HTTP listener redirects to HTTPS, answering ACME HTTP-01 challenges first.
+		// It cannot share the HTTPS port, so it is only skipped when HTTP_PORT is set to PORT.
+		if httpPort == port {
+			logger.Warn("HTTP_PORT is the HTTPS port, not starting the HTTP to HTTPS redirect", "port", port)
+		} else {
+			if len(redirectHosts()) == 0 {
+				logger.Warn("Neither CANONICAL_HOST nor ACME_DOMAIN is set, HTTP to HTTPS redirects keep the request's Host header",
+					"httpPort", httpPort)
+			}
+			redirect := redirectToHTTPS(port)
+			if acmeManager != nil {
+				redirect = acmeManager.HTTPHandler(redirect)
+			}
+			redirectServer := &http.Server{Addr: httpPort, Handler: redirect, ReadHeaderTimeout: 10 * time.Second}
+			logger.Info("Starting HTTP to HTTPS redirect", "address", fmt.Sprintf("http://localhost%s", httpPort))
+			serve(redirectServer, redirectServer.ListenAndServe)
 		}
 	} else {
 		// Certificate files not found, start HTTP server
@@ -62,9 +220,102 @@ func main() {
 			"websocket", fmt.Sprintf("ws://localhost%s/ws", port),
 			"note", fmt.Sprintf("For HTTPS, place certificate files at %s and %s", certFile, keyFile))
 
-		if err := http.ListenAndServe(port, nil); err != nil {
-			logger.Error("HTTP server failed to start", "error", err)
-			os.Exit(1)
+		httpServer := &http.Server{Addr: port, Handler: handler}
+		serve(httpServer, httpServer.ListenAndServe)
+	}
+
+	// Both listeners stop together, on a failure of either or on a shutdown signal
+	shutdownCh := make(chan os.Signal, 1)
+	signal.Notify(shutdownCh, os.Interrupt, syscall.SIGTERM)
+	select {
+	case err := <-serverErrs:
+		logger.Error("Server failed", "error", err)
+		os.Exit(1)
+	case sig := <-shutdownCh:
+		logger.Info("Shutting down servers", "signal", sig.String())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			logger.Warn("Server did not shut down cleanly", "address", server.Addr, "error", err)
 		}
 	}
-}
\ No newline at end of file
+	if err := presetWatcher.Close(); err != nil {
+		logger.Warn("Preset watcher did not close cleanly", "error", err)
+	}
+	if err := storageBackend.Close(); err != nil {
+		logger.Warn("Storage backend did not close cleanly", "error", err)
+	}
+	if err := cloudAuditLogger.Close(ctx); err != nil {
+		logger.Warn("Cloud audit log did not flush cleanly", "error", err)
+	}
+}
+
+// listenAddress turns a port from the environment into a listen address, defaulting to defaultPort
+func listenAddress(port, defaultPort string) string {
+	if port == "" {
+		port = defaultPort
+	}
+	// Ensure port has colon prefix
+	if !strings.HasPrefix(port, ":") {
+		port = ":" + port
+	}
+	return port
+}
+
+// splitHosts returns the non-empty entries of a comma-separated host list
+func splitHosts(list string) []string {
+	var hosts []string
+	for _, host := range strings.Split(list, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// redirectHosts returns the hosts HTTP requests may be redirected to: CANONICAL_HOST first, then the ACME_DOMAIN domains
+func redirectHosts() []string {
+	return append(splitHosts(os.Getenv("CANONICAL_HOST")), splitHosts(os.Getenv("ACME_DOMAIN"))...)
+}
+
+// redirectToHTTPS permanently redirects requests to the same path on the HTTPS listener at httpsPort.
+// When CANONICAL_HOST or ACME_DOMAIN is set, the request host is kept only if it is one of those hosts; any other
+// Host header is replaced by the canonical host, so a forged header cannot redirect clients to another site.
+func redirectToHTTPS(httpsPort string) http.Handler {
+	hosts := redirectHosts()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if len(hosts) > 0 && !slices.ContainsFunc(hosts, func(allowed string) bool { return strings.EqualFold(allowed, host) }) {
+			host = hosts[0]
+		}
+		port := strings.TrimPrefix(httpsPort, ":")
+		if port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]" // Bare IPv6 literal
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
+
+// newACMEManager obtains and renews certificates for the comma-separated domains over ACME HTTP-01,
+// caching them in ACME_CACHE_DIR (default certs/acme)
+func newACMEManager(domains string) *autocert.Manager {
+	hosts := splitHosts(domains)
+	cacheDir := os.Getenv("ACME_CACHE_DIR")
+	if cacheDir == "" {
+		cacheDir = "certs/acme"
+	}
+	logger.Info("Using ACME certificates", "domains", hosts, "cacheDir", cacheDir)
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(hosts...),
+		Cache:      autocert.DirCache(cacheDir),
+	}
+}
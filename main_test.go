@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// TestMain discards logs so code under test can use the global loggers
+func TestMain(m *testing.M) {
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	auditLogger = NewAuditLogger(io.Discard)
+	os.Exit(m.Run())
+}
+
+func TestListenAddress(t *testing.T) {
+	tests := []struct {
+		port, defaultPort string
+		want              string
+	}{
+		{"", "8080", ":8080"},
+		{"", "80", ":80"},
+		{"9000", "80", ":9000"},
+		{":9443", "8080", ":9443"},
+	}
+	for _, tt := range tests {
+		if got := listenAddress(tt.port, tt.defaultPort); got != tt.want {
+			t.Errorf("listenAddress(%q, %q) = %q, want %q", tt.port, tt.defaultPort, got, tt.want)
+		}
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		name          string
+		canonicalHost string
+		httpsPort     string
+		host          string
+		target        string
+		want          string
+	}{
+		{"canonical host", "example.com,www.example.com", ":443", "example.com", "/ws?x=1", "https://example.com/ws?x=1"},
+		{"other allowed host keeps its name", "example.com,www.example.com", ":443", "WWW.example.com:80", "/", "https://WWW.example.com/"},
+		{"forged host replaced", "example.com,www.example.com", ":443", "evil.test", "/login", "https://example.com/login"},
+		{"non-standard HTTPS port", "example.com,www.example.com", ":8443", "example.com", "/", "https://example.com:8443/"},
+		{"no canonical host keeps the request host", "", ":8443", "localhost:8080", "/", "https://localhost:8443/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CANONICAL_HOST", tt.canonicalHost)
+			t.Setenv("ACME_DOMAIN", "")
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			r.Host = tt.host
+			recorder := httptest.NewRecorder()
+			redirectToHTTPS(tt.httpsPort).ServeHTTP(recorder, r)
+			if recorder.Code != http.StatusMovedPermanently || recorder.Header().Get("Location") != tt.want {
+				t.Errorf("redirect = %d %q, want 301 %q", recorder.Code, recorder.Header().Get("Location"), tt.want)
+			}
+		})
+	}
+}
+
+func TestRedirectHosts(t *testing.T) {
+	tests := []struct {
+		name          string
+		canonicalHost string
+		acmeDomain    string
+		want          []string
+	}{
+		{"neither set", "", "", nil},
+		{"ACME domains", "", "example.com, www.example.com", []string{"example.com", "www.example.com"}},
+		{"canonical host first", "app.example.com", "example.com", []string{"app.example.com", "example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CANONICAL_HOST", tt.canonicalHost)
+			t.Setenv("ACME_DOMAIN", tt.acmeDomain)
+			got := redirectHosts()
+			if len(got) != len(tt.want) {
+				t.Fatalf("redirectHosts() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("redirectHosts() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
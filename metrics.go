@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+)
+
+// Metrics holds server-wide counters
+type Metrics struct {
+	StaleSessionsRemoved atomic.Int64
+	DroppedInvalidChunks atomic.Int64
+	RecvTimeoutCount     atomic.Int64
+}
+
+// Global server metrics
+var serverMetrics Metrics
+
+// MetricsResponse represents the server metrics returned by the metrics endpoint
+type MetricsResponse struct {
+	ActiveSessions       int               `json:"activeSessions"`
+	AudioQuota           AudioQuotaMetrics `json:"audioQuota"`
+	StaleSessionsRemoved int64             `json:"staleSessionsRemoved"`
+	DroppedInvalidChunks int64             `json:"droppedInvalidChunks"`
+	RecvTimeoutCount     int64             `json:"recvTimeoutCount"`
+}
+
+// AudioQuotaMetrics represents the current state of the audio ingestion quota
+type AudioQuotaMetrics struct {
+	CapacityBytes  int64   `json:"capacityBytes"`
+	AvailableBytes int64   `json:"availableBytes"`
+	Utilization    float64 `json:"utilization"`
+}
+
+// serveMetrics serves server-wide metrics as JSON
+func serveMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	response := MetricsResponse{
+		ActiveSessions: len(sessionRegistry.List()),
+		AudioQuota: AudioQuotaMetrics{
+			CapacityBytes:  audioQuota.capacity,
+			AvailableBytes: audioQuota.Available(),
+			Utilization:    audioQuota.Utilization(),
+		},
+		StaleSessionsRemoved: serverMetrics.StaleSessionsRemoved.Load(),
+		DroppedInvalidChunks: serverMetrics.DroppedInvalidChunks.Load(),
+		RecvTimeoutCount:     serverMetrics.RecvTimeoutCount.Load(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.Error("Failed to encode metrics response", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
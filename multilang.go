@@ -0,0 +1,124 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1"
+)
+
+// multiLanguageSelectionWindow is how long to wait for other language tracks after the first final result arrives
+const multiLanguageSelectionWindow = 750 * time.Millisecond
+
+// languageCandidate is a final result produced by one language track
+type languageCandidate struct {
+	Alternative *speechpb.SpeechRecognitionAlternative
+	Language    string
+	ChannelTag  int32
+	Utterance   int // Number of the final result on its track, from 1; tracks finalize the same utterance under the same number
+}
+
+// languageArbiter selects the most confident final result among parallel language tracks.
+// The first final result of an utterance opens a selection window; every candidate for that
+// utterance received during the window competes, and the one with the highest confidence is
+// emitted when it closes. Candidates arriving after their utterance was emitted are dropped.
+type languageArbiter struct {
+	mu        sync.Mutex
+	window    time.Duration
+	pending   map[int][]languageCandidate // Candidates per utterance whose window is open
+	emitted   int                         // Highest utterance already emitted
+	emit      func(languageCandidate)
+	afterFunc func(time.Duration, func()) // Schedules the end of a selection window, replaced in tests
+}
+
+// newLanguageArbiter creates an arbiter that calls emit with the winning candidate
+func newLanguageArbiter(window time.Duration, emit func(languageCandidate)) *languageArbiter {
+	return &languageArbiter{
+		window:    window,
+		pending:   make(map[int][]languageCandidate),
+		emit:      emit,
+		afterFunc: func(d time.Duration, f func()) { time.AfterFunc(d, f) },
+	}
+}
+
+// Offer submits a final result from a language track
+func (a *languageArbiter) Offer(c languageCandidate) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if c.Utterance <= a.emitted {
+		logger.Debug("Dropping late language track result",
+			"language", c.Language,
+			"utterance", c.Utterance)
+		return
+	}
+	candidates, open := a.pending[c.Utterance]
+	a.pending[c.Utterance] = append(candidates, c)
+	if !open {
+		utterance := c.Utterance
+		a.afterFunc(a.window, func() { a.flush(utterance) })
+	}
+}
+
+// flush emits the best candidate collected during the selection window of an utterance
+func (a *languageArbiter) flush(utterance int) {
+	a.mu.Lock()
+	candidates := a.pending[utterance]
+	delete(a.pending, utterance)
+	if utterance > a.emitted {
+		a.emitted = utterance
+	}
+	a.mu.Unlock()
+
+	if len(candidates) == 0 {
+		return
+	}
+
+	best := candidates[0]
+	for _, c := range candidates[1:] {
+		if c.Alternative.Confidence > best.Alternative.Confidence {
+			best = c
+		}
+	}
+
+	logger.Debug("Language track selected",
+		"language", best.Language,
+		"utterance", utterance,
+		"confidence", best.Alternative.Confidence,
+		"candidates", len(candidates))
+
+	a.emit(best)
+}
+
+// uniqueLanguages returns the primary language followed by the alternatives, without duplicates
+func uniqueLanguages(primary string, alternatives []string) []string {
+	seen := make(map[string]bool)
+	var languages []string
+	for _, language := range append([]string{primary}, alternatives...) {
+		if language == "" || seen[language] {
+			continue
+		}
+		seen[language] = true
+		languages = append(languages, language)
+	}
+	return languages
+}
+
+// swapPrimaryLanguage makes newPrimary the primary language and moves the previous primary into its place among the alternatives
+func swapPrimaryLanguage(primary string, alternatives []string, newPrimary string) (string, []string) {
+	swapped := make([]string, 0, len(alternatives)+1)
+	replaced := false
+	for _, language := range alternatives {
+		if strings.EqualFold(language, newPrimary) {
+			swapped = append(swapped, primary)
+			replaced = true
+			continue
+		}
+		swapped = append(swapped, language)
+	}
+	if !replaced {
+		swapped = append(swapped, primary)
+	}
+	return newPrimary, swapped
+}
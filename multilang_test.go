@@ -0,0 +1,108 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1"
+)
+
+func TestSwapPrimaryLanguage(t *testing.T) {
+	tests := []struct {
+		name             string
+		primary          string
+		alternatives     []string
+		newPrimary       string
+		wantAlternatives []string
+	}{
+		{"detected alternative", "en-US", []string{"fr-FR", "de-DE"}, "fr-FR", []string{"en-US", "de-DE"}},
+		{"case insensitive", "en-US", []string{"fr-FR"}, "fr-fr", []string{"en-US"}},
+		{"language outside the alternatives", "en-US", []string{"fr-FR"}, "es-ES", []string{"fr-FR", "en-US"}},
+		{"no alternatives", "en-US", nil, "fr-FR", []string{"en-US"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := append([]string(nil), tt.alternatives...)
+			primary, alternatives := swapPrimaryLanguage(tt.primary, tt.alternatives, tt.newPrimary)
+			if primary != tt.newPrimary || !reflect.DeepEqual(alternatives, tt.wantAlternatives) {
+				t.Errorf("swapPrimaryLanguage() = %q, %v; want %q, %v", primary, alternatives, tt.newPrimary, tt.wantAlternatives)
+			}
+			// Readers may still hold the previous slice after releasing streamMu
+			if !reflect.DeepEqual(tt.alternatives, original) {
+				t.Errorf("alternatives modified in place: %v, was %v", tt.alternatives, original)
+			}
+		})
+	}
+}
+
+// manualWindows replaces the arbiter's timers with selection windows closed explicitly by the test
+type manualWindows struct {
+	durations []time.Duration
+	closers   []func()
+}
+
+func (m *manualWindows) afterFunc(d time.Duration, f func()) {
+	m.durations = append(m.durations, d)
+	m.closers = append(m.closers, f)
+}
+
+// closeAll closes every selection window opened so far, in order
+func (m *manualWindows) closeAll() {
+	closers := m.closers
+	m.closers = nil
+	for _, f := range closers {
+		f()
+	}
+}
+
+func TestLanguageArbiter(t *testing.T) {
+	candidate := func(language string, utterance int, confidence float32) languageCandidate {
+		return languageCandidate{Language: language, Utterance: utterance, Alternative: &speechpb.SpeechRecognitionAlternative{Transcript: language, Confidence: confidence}}
+	}
+	var closeWindows languageCandidate // Closes the selection windows opened so far
+	tests := []struct {
+		name   string
+		offers []languageCandidate
+		want   []string // Languages emitted, in order
+	}{
+		{"single track", []languageCandidate{candidate("en-US", 1, 0.8)}, []string{"en-US"}},
+		{"most confident within the window", []languageCandidate{candidate("en-US", 1, 0.6), candidate("fr-FR", 1, 0.9), candidate("de-DE", 1, 0.7)}, []string{"fr-FR"}},
+		{"tie keeps the first result", []languageCandidate{candidate("en-US", 1, 0.8), candidate("fr-FR", 1, 0.8)}, []string{"en-US"}},
+		{"late result of an emitted utterance is dropped", []languageCandidate{candidate("en-US", 1, 0.6), closeWindows, candidate("fr-FR", 1, 0.9)}, []string{"en-US"}},
+		{"next utterance opens a new window", []languageCandidate{candidate("en-US", 1, 0.6), closeWindows, candidate("fr-FR", 1, 0.9), candidate("fr-FR", 2, 0.9), candidate("en-US", 2, 0.5)}, []string{"en-US", "fr-FR"}},
+		{"utterances compete separately", []languageCandidate{candidate("en-US", 1, 0.9), candidate("en-US", 2, 0.4), candidate("fr-FR", 1, 0.5), candidate("fr-FR", 2, 0.8)}, []string{"en-US", "fr-FR"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			windows := &manualWindows{}
+			arbiter := newLanguageArbiter(multiLanguageSelectionWindow, func(c languageCandidate) { got = append(got, c.Language) })
+			arbiter.afterFunc = windows.afterFunc
+			for _, c := range tt.offers {
+				if c == closeWindows {
+					windows.closeAll()
+					continue
+				}
+				arbiter.Offer(c)
+			}
+			windows.closeAll()
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("emitted %v, want %v", got, tt.want)
+			}
+			for _, d := range windows.durations {
+				if d != multiLanguageSelectionWindow {
+					t.Errorf("selection window of %s, want %s", d, multiLanguageSelectionWindow)
+				}
+			}
+		})
+	}
+}
+
+func TestUniqueLanguages(t *testing.T) {
+	got := uniqueLanguages("en-US", []string{"fr-FR", "en-US", "", "fr-FR", "de-DE"})
+	if want := []string{"en-US", "fr-FR", "de-DE"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("uniqueLanguages() = %v, want %v", got, want)
+	}
+}
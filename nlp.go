@@ -0,0 +1,705 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"google.golang.org/genai"
+)
+
+// defaultStopWords is the built-in English stop word list
+var defaultStopWords = []string{
+	"a", "about", "above", "after", "again", "against", "all", "am", "an", "and", "any", "are", "as", "at",
+	"be", "because", "been", "before", "being", "below", "between", "both", "but", "by",
+	"can", "could", "did", "do", "does", "doing", "down", "during", "each", "few", "for", "from", "further",
+	"had", "has", "have", "having", "he", "her", "here", "hers", "herself", "him", "himself", "his", "how",
+	"i", "if", "in", "into", "is", "it", "its", "itself", "just", "me", "more", "most", "my", "myself",
+	"no", "nor", "not", "now", "of", "off", "on", "once", "only", "or", "other", "our", "ours", "ourselves", "out", "over", "own",
+	"same", "she", "should", "so", "some", "such", "than", "that", "the", "their", "theirs", "them", "themselves", "then", "there",
+	"these", "they", "this", "those", "through", "to", "too", "under", "until", "up", "very",
+	"was", "we", "were", "what", "when", "where", "which", "while", "who", "whom", "why", "will", "with", "would",
+	"you", "your", "yours", "yourself", "yourselves",
+}
+
+var (
+	stopWordsOnce sync.Once
+	stopWords     map[string]bool
+)
+
+// getStopWords returns the stop word set, loaded from STOP_WORDS_FILE (one word per line) or the built-in list
+func getStopWords() map[string]bool {
+	stopWordsOnce.Do(func() {
+		words := defaultStopWords
+		if path := os.Getenv("STOP_WORDS_FILE"); path != "" {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				logger.Error("Failed to read stop words file, using built-in list", "file", path, "error", err)
+			} else {
+				words = strings.Fields(string(content))
+				logger.Info("Stop words loaded", "file", path, "count", len(words))
+			}
+		}
+
+		stopWords = make(map[string]bool, len(words))
+		for _, word := range words {
+			stopWords[strings.ToLower(word)] = true
+		}
+	})
+	return stopWords
+}
+
+// tokenizeWords splits text on whitespace, lowercases each token and strips surrounding punctuation
+func tokenizeWords(text string) []string {
+	var tokens []string
+	for _, field := range strings.Fields(text) {
+		token := strings.TrimFunc(strings.ToLower(field), func(r rune) bool {
+			return unicode.IsPunct(r) || unicode.IsSymbol(r)
+		})
+		if token != "" {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+// removeStopWords returns the tokens that are not in the stop word set
+func removeStopWords(tokens []string, stop map[string]bool) []string {
+	var filtered []string
+	for _, token := range tokens {
+		if !stop[token] {
+			filtered = append(filtered, token)
+		}
+	}
+	return filtered
+}
+
+// computeWordFrequencies counts tokens and returns them sorted by count descending, then alphabetically
+func computeWordFrequencies(tokens []string) []WordFreq {
+	counts := make(map[string]int)
+	for _, token := range tokens {
+		counts[token]++
+	}
+
+	frequencies := make([]WordFreq, 0, len(counts))
+	for word, count := range counts {
+		frequencies = append(frequencies, WordFreq{
+			Word:      word,
+			Count:     count,
+			Frequency: float64(count) / float64(len(tokens)),
+		})
+	}
+
+	sort.Slice(frequencies, func(i, j int) bool {
+		if frequencies[i].Count != frequencies[j].Count {
+			return frequencies[i].Count > frequencies[j].Count
+		}
+		return frequencies[i].Word < frequencies[j].Word
+	})
+	return frequencies
+}
+
+// buildContextFeedbackReport reports which speech context phrases appear in the transcript.
+// Matching is case-insensitive on whole words, ignoring punctuation.
+func buildContextFeedbackReport(transcript string, phrases []string) ContextFeedbackReport {
+	report := ContextFeedbackReport{
+		Type:             "context_feedback",
+		MatchedPhrases:   []string{},
+		UnmatchedPhrases: []string{},
+	}
+	normalizedTranscript := " " + strings.Join(tokenizeWords(transcript), " ") + " "
+
+	seen := make(map[string]bool)
+	for _, phrase := range phrases {
+		normalizedPhrase := strings.Join(tokenizeWords(phrase), " ")
+		if normalizedPhrase == "" || seen[normalizedPhrase] {
+			continue
+		}
+		seen[normalizedPhrase] = true
+
+		if strings.Contains(normalizedTranscript, " "+normalizedPhrase+" ") {
+			report.MatchedPhrases = append(report.MatchedPhrases, phrase)
+		} else {
+			report.UnmatchedPhrases = append(report.UnmatchedPhrases, phrase)
+		}
+	}
+
+	if total := len(report.MatchedPhrases) + len(report.UnmatchedPhrases); total > 0 {
+		report.HitRate = float64(len(report.MatchedPhrases)) / float64(total)
+	}
+	return report
+}
+
+// punctuationDiscourseMarkers are preceded by a comma when the model returned no punctuation before them
+var punctuationDiscourseMarkers = map[string]bool{"however": true, "but": true}
+
+// endsWithLowercase reports whether the last character of word is a lowercase letter
+func endsWithLowercase(word string) bool {
+	runes := []rune(word)
+	return len(runes) > 0 && unicode.IsLower(runes[len(runes)-1])
+}
+
+// startsWithUppercase reports whether the first character of word is an uppercase letter
+func startsWithUppercase(word string) bool {
+	for _, r := range word {
+		return unicode.IsUpper(r)
+	}
+	return false
+}
+
+// capitalizeFirst uppercases the first character of word
+func capitalizeFirst(word string) string {
+	for i, r := range word {
+		return string(unicode.ToUpper(r)) + word[i+len(string(r)):]
+	}
+	return word
+}
+
+// autoPunctuate adds punctuation to unpunctuated text with simple heuristics: a period between a lowercase
+// word and a capitalized one, a comma before discourse markers, a capitalized first word and a final period
+func autoPunctuate(text string) string {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return text
+	}
+
+	for i := 1; i < len(words); i++ {
+		if !endsWithLowercase(words[i-1]) {
+			continue
+		}
+		lower := strings.ToLower(words[i])
+		switch {
+		case startsWithUppercase(words[i]) && lower != "i" && !strings.HasPrefix(lower, "i'"):
+			words[i-1] += "."
+		case punctuationDiscourseMarkers[lower] || (lower == "and" && i+1 < len(words) && strings.ToLower(words[i+1]) == "then"):
+			words[i-1] += ","
+		}
+	}
+
+	words[0] = capitalizeFirst(words[0])
+	lastWord := []rune(words[len(words)-1])
+	if lastRune := lastWord[len(lastWord)-1]; unicode.IsLetter(lastRune) || unicode.IsDigit(lastRune) {
+		words[len(words)-1] += "."
+	}
+	return strings.Join(words, " ")
+}
+
+// fillerWords are dropped from final results by filler word removal
+var fillerWords = map[string]bool{"um": true, "umm": true, "uh": true, "uhh": true, "uhm": true, "erm": true, "hmm": true}
+
+// numberUnits, numberTeens and numberTens are the spelled-out numbers normalized to digits
+var (
+	numberUnits = map[string]int{"one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6, "seven": 7, "eight": 8, "nine": 9}
+	numberTeens = map[string]int{
+		"ten": 10, "eleven": 11, "twelve": 12, "thirteen": 13, "fourteen": 14,
+		"fifteen": 15, "sixteen": 16, "seventeen": 17, "eighteen": 18, "nineteen": 19,
+	}
+	numberTens = map[string]int{"twenty": 20, "thirty": 30, "forty": 40, "fifty": 50, "sixty": 60, "seventy": 70, "eighty": 80, "ninety": 90}
+)
+
+// capitalizedWords are always capitalized by capitalization fixing
+var capitalizedWords = []string{
+	"I", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday", "Sunday",
+	"January", "February", "April", "June", "July", "August", "September", "October", "November", "December",
+}
+
+// normalizeTranscript applies the clean-ups enabled in cfg to a final result:
+// filler words are removed, then numbers converted, capitalization fixed and custom replacements applied
+func normalizeTranscript(text string, cfg NormalizationConfig) string {
+	words := strings.Fields(text)
+	if cfg.RemoveFillerWords {
+		words = removeFillerWords(words)
+	}
+	if cfg.NormalizeNumbers {
+		words = normalizeNumbers(words)
+	}
+	if cfg.FixCapitalization {
+		words = fixCapitalization(words, cfg.properNouns)
+	}
+	text = strings.Join(words, " ")
+
+	if len(cfg.CustomReplacements) > 0 {
+		originals := make([]string, 0, len(cfg.CustomReplacements))
+		for original := range cfg.CustomReplacements {
+			if original != "" {
+				originals = append(originals, original)
+			}
+		}
+		sort.Slice(originals, func(i, j int) bool {
+			if len(originals[i]) != len(originals[j]) {
+				return len(originals[i]) > len(originals[j])
+			}
+			return originals[i] < originals[j]
+		})
+		for _, original := range originals {
+			text = strings.ReplaceAll(text, original, cfg.CustomReplacements[original])
+		}
+	}
+	return text
+}
+
+// splitWordPunctuation separates a word from its leading and trailing punctuation
+func splitWordPunctuation(word string) (prefix, core, suffix string) {
+	core = strings.TrimRightFunc(word, unicode.IsPunct)
+	suffix = word[len(core):]
+	trimmed := strings.TrimLeftFunc(core, unicode.IsPunct)
+	return core[:len(core)-len(trimmed)], trimmed, suffix
+}
+
+// removeFillerWords drops filler words, and "like" when it is set off by commas ("it was, like, huge")
+func removeFillerWords(words []string) []string {
+	var kept []string
+	for _, word := range words {
+		_, core, suffix := splitWordPunctuation(word)
+		lower := strings.ToLower(core)
+		if fillerWords[lower] {
+			// Keep sentence-ending punctuation the filler carried
+			if strings.ContainsAny(suffix, ".?!") && len(kept) > 0 {
+				kept[len(kept)-1] = strings.TrimRight(kept[len(kept)-1], ",") + suffix
+			}
+			continue
+		}
+		if lower == "like" && strings.HasPrefix(suffix, ",") && len(kept) > 0 && strings.HasSuffix(kept[len(kept)-1], ",") {
+			continue
+		}
+		kept = append(kept, word)
+	}
+	return kept
+}
+
+// normalizeNumbers replaces runs of spelled-out number words worth ten or more with digits;
+// smaller numbers stay spelled out ("one of them"), as do runs that do not form a number ("twenty twenty")
+func normalizeNumbers(words []string) []string {
+	var normalized []string
+	for i := 0; i < len(words); {
+		value, consumed, suffix := parseSpelledNumber(words[i:])
+		if consumed == 0 {
+			normalized = append(normalized, words[i])
+			i++
+			continue
+		}
+
+		// Adjacent runs ("twenty twenty", "nineteen ninety nine") are years or codes rather than one number
+		end, adjacent := i+consumed, false
+		for suffix == "" && end < len(words) {
+			_, next, nextSuffix := parseSpelledNumber(words[end:])
+			if next == 0 {
+				break
+			}
+			end, adjacent, suffix = end+next, true, nextSuffix
+		}
+		if adjacent || value < 10 {
+			normalized = append(normalized, words[i:end]...)
+		} else {
+			prefix, _, _ := splitWordPunctuation(words[i])
+			normalized = append(normalized, prefix+strconv.Itoa(value)+suffix)
+		}
+		i = end
+	}
+	return normalized
+}
+
+// parseSpelledNumber reads the number spelled by the leading words ("two hundred and five", "twenty-three"),
+// returning its value, the number of words used and the punctuation following the last one
+func parseSpelledNumber(words []string) (value, consumed int, suffix string) {
+	total, current := 0, 0
+	last := "" // Kind of the previous number word: "unit", "teen", "tens", "hundred" or "thousand"
+	for i, word := range words {
+		prefix, core, wordSuffix := splitWordPunctuation(word)
+		if i > 0 && prefix != "" {
+			break
+		}
+		parts := strings.Split(strings.ToLower(core), "-")
+		if len(parts) > 2 {
+			break
+		}
+
+		ok := true
+		for _, part := range parts {
+			switch {
+			case part == "and" && last == "hundred" && len(parts) == 1 && wordSuffix == "" && i+1 < len(words):
+				// "two hundred and five"; "and" only counts when a number follows, checked below
+			case numberUnits[part] > 0 && (last == "" || last == "tens" || last == "hundred" || last == "thousand"):
+				current += numberUnits[part]
+				last = "unit"
+			case numberTeens[part] > 0 && (last == "" || last == "hundred" || last == "thousand"):
+				current += numberTeens[part]
+				last = "teen"
+			case numberTens[part] > 0 && (last == "" || last == "hundred" || last == "thousand"):
+				current += numberTens[part]
+				last = "tens"
+			case part == "hundred" && (last == "unit" || last == "teen") && current < 100:
+				current *= 100
+				last = "hundred"
+			case part == "thousand" && last != "" && last != "thousand" && total == 0:
+				total, current = current*1000, 0
+				last = "thousand"
+			default:
+				ok = false
+			}
+			if !ok {
+				break
+			}
+		}
+		if !ok || (len(parts) == 2 && (numberTens[parts[0]] == 0 || numberUnits[parts[1]] == 0)) {
+			break
+		}
+		if parts[0] == "and" {
+			continue
+		}
+
+		value, consumed, suffix = total+current, i+1, wordSuffix
+		if wordSuffix != "" {
+			break // Punctuation ends the number
+		}
+	}
+	return value, consumed, suffix
+}
+
+// fixCapitalization restores the casing of days, months, the pronoun "I" and the given proper nouns
+func fixCapitalization(words []string, properNouns []string) []string {
+	casing := make(map[string]string, len(capitalizedWords)+len(properNouns))
+	for _, word := range capitalizedWords {
+		casing[strings.ToLower(word)] = word
+	}
+	for _, noun := range properNouns {
+		if noun = strings.TrimSpace(noun); noun != "" && !strings.Contains(noun, " ") {
+			casing[strings.ToLower(noun)] = noun
+		}
+	}
+
+	fixed := make([]string, len(words))
+	for i, word := range words {
+		prefix, core, suffix := splitWordPunctuation(word)
+		lower := strings.ToLower(core)
+		if cased, ok := casing[lower]; ok {
+			core = cased
+		} else if lowerBase, contraction, found := strings.Cut(lower, "'"); found && lowerBase == "i" {
+			core = "I'" + contraction // "i'm", "i'll"
+		}
+		fixed[i] = prefix + core + suffix
+	}
+	return fixed
+}
+
+// sentenceEndPattern matches the end of a sentence followed by whitespace
+var sentenceEndPattern = regexp.MustCompile(`[.!?]\s`)
+
+// isMarkdownBlockStart reports whether a line starts a heading, list item, table row or quote, which are never split
+func isMarkdownBlockStart(line string) bool {
+	if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "|") || strings.HasPrefix(line, ">") ||
+		strings.HasPrefix(line, "- ") || strings.HasPrefix(line, "* ") || strings.HasPrefix(line, "+ ") {
+		return true
+	}
+	digits := strings.TrimLeftFunc(line, unicode.IsDigit)
+	return len(digits) < len(line) && (strings.HasPrefix(digits, ". ") || strings.HasPrefix(digits, ") "))
+}
+
+// splitLongParagraphs splits Markdown paragraphs longer than maxLen characters into several paragraphs,
+// cutting at the last sentence end before the limit (or the first one after it when there is none).
+// Headings, lists, tables, quotes and fenced code blocks are left untouched; maxLen <= 0 disables splitting.
+func splitLongParagraphs(text string, maxLen int) string {
+	if maxLen <= 0 {
+		return text
+	}
+
+	var out, paragraph []string
+	flush := func() {
+		if len(paragraph) > 0 {
+			out = append(out, splitParagraph(strings.Join(paragraph, "\n"), maxLen))
+			paragraph = nil
+		}
+	}
+	inFence, inBlock := false, false
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			flush()
+			inFence = !inFence
+			out = append(out, line)
+		case inFence:
+			out = append(out, line)
+		case trimmed == "":
+			flush()
+			inBlock = false
+			out = append(out, line)
+		case inBlock || isMarkdownBlockStart(trimmed):
+			// Continuation lines of a list item or table belong to it until the next blank line
+			flush()
+			inBlock = !strings.HasPrefix(trimmed, "#")
+			out = append(out, line)
+		default:
+			paragraph = append(paragraph, line)
+		}
+	}
+	flush()
+	return strings.Join(out, "\n")
+}
+
+// splitParagraph cuts a paragraph at sentence ends into paragraphs of at most maxLen characters where possible
+func splitParagraph(paragraph string, maxLen int) string {
+	var pieces []string
+	for utf8.RuneCountInString(paragraph) > maxLen {
+		cut := -1
+		for _, match := range sentenceEndPattern.FindAllStringIndex(paragraph, -1) {
+			end := match[0] + 1
+			overLimit := utf8.RuneCountInString(paragraph[:end]) > maxLen
+			if overLimit && cut >= 0 {
+				break
+			}
+			cut = end
+			if overLimit {
+				break // No sentence ends before the limit; cut at the first one after it
+			}
+		}
+		if cut < 0 {
+			break // A single sentence
+		}
+		pieces = append(pieces, strings.TrimSpace(paragraph[:cut]))
+		paragraph = strings.TrimSpace(paragraph[cut:])
+	}
+	return strings.Join(append(pieces, paragraph), "\n\n")
+}
+
+// Synonym expansion settings
+const (
+	// maxSynonymsPerWord bounds how many vocabulary words are added for each custom word
+	maxSynonymsPerWord = 3
+	// minSynonymSimilarity is the cosine similarity of embeddings above which a vocabulary word counts as a synonym
+	minSynonymSimilarity = 0.75
+	// synonymExpansionTimeout bounds the embedding requests made when a session starts
+	synonymExpansionTimeout = 10 * time.Second
+	// synonymVocabularyTimeout bounds each attempt at embedding the vocabulary at startup
+	synonymVocabularyTimeout = 2 * time.Minute
+	// synonymVocabularyMaxRetryDelay caps the delay between attempts at embedding the vocabulary
+	synonymVocabularyMaxRetryDelay = 10 * time.Minute
+	// embeddingBatchSize is the number of texts embedded per request
+	embeddingBatchSize = 100
+)
+
+// embedTexts returns one embedding per text, in order
+type embedTexts func(ctx context.Context, texts []string) ([][]float32, error)
+
+// errSynonymVocabularyNotReady is returned by Expand until the vocabulary has been embedded
+var errSynonymVocabularyNotReady = errors.New("synonym vocabulary not embedded yet")
+
+// SynonymExpander finds synonyms of custom words in a vocabulary by the similarity of their embeddings.
+// The vocabulary is embedded once by Prepare, in the background at startup, and shared by all sessions.
+type SynonymExpander struct {
+	embed      embedTexts
+	vocabulary []string
+
+	mu         sync.Mutex
+	embeddings [][]float32 // Embeddings of the vocabulary, nil until embedded
+}
+
+// synonymExpander is nil when synonym expansion is not configured
+var synonymExpander *SynonymExpander
+
+// NewSynonymExpander creates an expander searching vocabulary with embed
+func NewSynonymExpander(embed embedTexts, vocabulary []string) *SynonymExpander {
+	return &SynonymExpander{embed: embed, vocabulary: vocabulary}
+}
+
+// Expand returns up to maxSynonymsPerWord synonyms of each word, most similar first, leaving out the words themselves.
+// It returns errSynonymVocabularyNotReady until Prepare has embedded the vocabulary.
+func (e *SynonymExpander) Expand(ctx context.Context, words []string) ([]string, error) {
+	e.mu.Lock()
+	vocabularyEmbeddings := e.embeddings
+	e.mu.Unlock()
+	if vocabularyEmbeddings == nil {
+		return nil, errSynonymVocabularyNotReady
+	}
+
+	var queries []string
+	seen := make(map[string]bool)
+	for _, word := range words {
+		word = strings.TrimSpace(word)
+		if word != "" && !seen[strings.ToLower(word)] {
+			seen[strings.ToLower(word)] = true
+			queries = append(queries, word)
+		}
+	}
+	if len(queries) == 0 {
+		return nil, nil
+	}
+	queryEmbeddings, err := e.embed(ctx, queries)
+	if err != nil {
+		return nil, fmt.Errorf("error embedding custom words: %v", err)
+	}
+
+	var synonyms []string
+	for _, query := range queryEmbeddings {
+		type candidate struct {
+			word       string
+			similarity float64
+		}
+		var candidates []candidate
+		for i, embedding := range vocabularyEmbeddings {
+			if similarity := cosineSimilarity(query, embedding); similarity >= minSynonymSimilarity {
+				candidates = append(candidates, candidate{e.vocabulary[i], similarity})
+			}
+		}
+		sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].similarity > candidates[j].similarity })
+
+		added := 0
+		for _, c := range candidates {
+			if added == maxSynonymsPerWord {
+				break
+			}
+			if seen[strings.ToLower(c.word)] {
+				continue
+			}
+			seen[strings.ToLower(c.word)] = true
+			synonyms = append(synonyms, c.word)
+			added++
+		}
+	}
+	return synonyms, nil
+}
+
+// Prepare embeds the vocabulary, making it available to Expand; sessions never wait for it
+func (e *SynonymExpander) Prepare(ctx context.Context) error {
+	embeddings, err := e.embed(ctx, e.vocabulary)
+	if err != nil {
+		return err
+	}
+	if len(embeddings) != len(e.vocabulary) {
+		return fmt.Errorf("got %d embeddings for %d vocabulary words", len(embeddings), len(e.vocabulary))
+	}
+	e.mu.Lock()
+	e.embeddings = embeddings
+	e.mu.Unlock()
+	return nil
+}
+
+// prepareInBackground embeds the vocabulary, retrying with a growing delay until it succeeds
+func (e *SynonymExpander) prepareInBackground(retryDelay time.Duration) {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), synonymVocabularyTimeout)
+		err := e.Prepare(ctx)
+		cancel()
+		if err == nil {
+			logger.Info("Synonym vocabulary embedded", "count", len(e.vocabulary))
+			return
+		}
+		logger.Error("Failed to embed synonym vocabulary, retrying", "error", err, "retryIn", retryDelay)
+		time.Sleep(retryDelay)
+		retryDelay = min(2*retryDelay, synonymVocabularyMaxRetryDelay)
+	}
+}
+
+// cosineSimilarity returns the cosine of the angle between two vectors, 0 when either is empty or of different length
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// vertexEmbedder embeds texts with a Vertex AI text embedding model
+func vertexEmbedder(projectID, location, model string) embedTexts {
+	return func(ctx context.Context, texts []string) ([][]float32, error) {
+		client, err := sharedGenAIClient(projectID, location)
+		if err != nil {
+			return nil, err
+		}
+
+		embeddings := make([][]float32, 0, len(texts))
+		for start := 0; start < len(texts); start += embeddingBatchSize {
+			var contents []*genai.Content
+			for _, text := range texts[start:min(start+embeddingBatchSize, len(texts))] {
+				contents = append(contents, &genai.Content{Role: "user", Parts: []*genai.Part{{Text: text}}})
+			}
+			resp, err := client.Models.EmbedContent(ctx, model, contents, &genai.EmbedContentConfig{TaskType: "SEMANTIC_SIMILARITY"})
+			if err != nil {
+				return nil, err
+			}
+			for _, embedding := range resp.Embeddings {
+				embeddings = append(embeddings, embedding.Values)
+			}
+		}
+		return embeddings, nil
+	}
+}
+
+// parseSynonymVocabulary returns the words and phrases of a vocabulary file, one per line, leaving out
+// those longer than limit characters since the Speech API ignores them
+func parseSynonymVocabulary(content string, limit int) (vocabulary []string, skipped int) {
+	for _, line := range strings.Split(content, "\n") {
+		word := strings.TrimSpace(line)
+		if word == "" {
+			continue
+		}
+		if limit > 0 && utf8.RuneCountInString(word) > limit {
+			skipped++
+			continue
+		}
+		vocabulary = append(vocabulary, word)
+	}
+	return vocabulary, skipped
+}
+
+// initSynonymExpander loads the vocabulary named by SYNONYM_VOCABULARY_FILE (one word or phrase per line) and embeds it
+// in the background with the Vertex AI embedding model named by SYNONYM_EXPANSION_API; expansion is disabled when either is unset
+func initSynonymExpander() {
+	model := os.Getenv("SYNONYM_EXPANSION_API")
+	path := os.Getenv("SYNONYM_VOCABULARY_FILE")
+	if model == "" && path == "" {
+		return
+	}
+	projectID, location := os.Getenv("GCP_PROJECT_ID"), os.Getenv("GCP_LOCATION")
+	if model == "" || path == "" || projectID == "" || location == "" {
+		logger.Warn("Synonym expansion requires SYNONYM_EXPANSION_API, SYNONYM_VOCABULARY_FILE, GCP_PROJECT_ID and GCP_LOCATION")
+		return
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		logger.Error("Failed to read synonym vocabulary, synonym expansion disabled", "file", path, "error", err)
+		return
+	}
+	vocabulary, skipped := parseSynonymVocabulary(string(content), maxPhraseLength())
+	synonymExpander = NewSynonymExpander(vertexEmbedder(projectID, location, model), vocabulary)
+	logger.Info("Synonym vocabulary loaded", "file", path, "count", len(vocabulary), "skippedTooLong", skipped, "model", model)
+	go synonymExpander.prepareInBackground(time.Minute)
+}
+
+// expandWithSynonyms returns up to 3 synonyms per word from the synonym vocabulary; failures are logged
+// and expand to nothing, as does a vocabulary still being embedded
+func expandWithSynonyms(words []string) []string {
+	if synonymExpander == nil || len(words) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), synonymExpansionTimeout)
+	defer cancel()
+	synonyms, err := synonymExpander.Expand(ctx, words)
+	if errors.Is(err, errSynonymVocabularyNotReady) {
+		logger.Warn("Synonym vocabulary is still being embedded, custom words not expanded")
+		return nil
+	}
+	if err != nil {
+		logger.Error("Failed to expand custom words with synonyms", "error", err)
+		return nil
+	}
+	return synonyms
+}
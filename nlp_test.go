@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCosineSimilarity(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []float32
+		want float64
+	}{
+		{"identical", []float32{1, 2, 3}, []float32{1, 2, 3}, 1},
+		{"orthogonal", []float32{1, 0}, []float32{0, 1}, 0},
+		{"opposite", []float32{1, 1}, []float32{-1, -1}, -1},
+		{"scaled", []float32{1, 2}, []float32{2, 4}, 1},
+		{"different lengths", []float32{1, 2}, []float32{1}, 0},
+		{"empty", nil, nil, 0},
+		{"zero vector", []float32{0, 0}, []float32{1, 1}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cosineSimilarity(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("cosineSimilarity() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSynonymVocabulary(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		limit       int
+		want        []string
+		wantSkipped int
+	}{
+		{"one entry per line", "car\n  automobile \n\nvehicle\n", 100, []string{"car", "automobile", "vehicle"}, 0},
+		{"long phrases skipped", "car\nthis phrase is far too long\n", 10, []string{"car"}, 1},
+		{"no limit", "this phrase is long\n", 0, []string{"this phrase is long"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, skipped := parseSynonymVocabulary(tt.content, tt.limit)
+			if !reflect.DeepEqual(got, tt.want) || skipped != tt.wantSkipped {
+				t.Errorf("parseSynonymVocabulary() = %v, %d skipped; want %v, %d skipped", got, skipped, tt.want, tt.wantSkipped)
+			}
+		})
+	}
+}
+
+// synonymTestVocabulary embeds with fakeEmbed; every entry but "banana" is similar to "car"
+var synonymTestVocabulary = []string{"banana", "auto", "car", "sedan", "automobile", "vehicle"}
+
+// fakeEmbed embeds each text to a fixed direction; the car-related words point nearly the same way
+func fakeEmbed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := map[string][]float32{
+		"car":        {1, 0},
+		"automobile": {1, 0.1},
+		"auto":       {1, 0.2},
+		"vehicle":    {1, 0.3},
+		"sedan":      {1, 0.4},
+		"banana":     {0, 1},
+	}
+	embeddings := make([][]float32, len(texts))
+	for i, text := range texts {
+		embeddings[i] = vectors[strings.ToLower(strings.TrimSpace(text))]
+	}
+	return embeddings, nil
+}
+
+func TestSynonymExpanderExpand(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare bool
+		words   []string
+		want    []string
+		wantErr error
+	}{
+		{"not embedded yet", false, []string{"car"}, nil, errSynonymVocabularyNotReady},
+		{"three most similar without the word itself", true, []string{"car"}, []string{"automobile", "auto", "vehicle"}, nil},
+		{"no similar entries", true, []string{"banana"}, nil, nil},
+		{"duplicate words expanded once", true, []string{"car", " CAR "}, []string{"automobile", "auto", "vehicle"}, nil},
+		{"synonyms shared by words added once", true, []string{"car", "automobile"}, []string{"auto", "vehicle", "sedan"}, nil},
+		{"blank words", true, []string{" "}, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expander := NewSynonymExpander(fakeEmbed, synonymTestVocabulary)
+			if tt.prepare {
+				if err := expander.Prepare(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := expander.Expand(context.Background(), tt.words)
+			if !errors.Is(err, tt.wantErr) || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expand() = %v, %v; want %v, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExpandWithSynonyms(t *testing.T) {
+	failingEmbed := func(ctx context.Context, texts []string) ([][]float32, error) {
+		if len(texts) == 1 {
+			return nil, errors.New("embedding endpoint unavailable")
+		}
+		return fakeEmbed(ctx, texts)
+	}
+	tests := []struct {
+		name     string
+		expander func() *SynonymExpander
+		want     []string
+	}{
+		{"not configured", func() *SynonymExpander { return nil }, nil},
+		{"vocabulary not embedded yet", func() *SynonymExpander { return NewSynonymExpander(fakeEmbed, synonymTestVocabulary) }, nil},
+		{"embedding error", func() *SynonymExpander {
+			expander := NewSynonymExpander(failingEmbed, synonymTestVocabulary)
+			expander.Prepare(context.Background())
+			return expander
+		}, nil},
+		{"expanded", func() *SynonymExpander {
+			expander := NewSynonymExpander(fakeEmbed, synonymTestVocabulary)
+			expander.Prepare(context.Background())
+			return expander
+		}, []string{"automobile", "auto", "vehicle"}},
+	}
+	previous := synonymExpander
+	t.Cleanup(func() { synonymExpander = previous })
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			synonymExpander = tt.expander()
+			got := expandWithSynonyms([]string{"car"})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expandWithSynonyms() = %v, want %v", got, tt.want)
+			}
+			if got == nil {
+				return
+			}
+			if speechContext := synonymSpeechContext(got); speechContext.Boost != synonymBoost || !reflect.DeepEqual(speechContext.Phrases, got) {
+				t.Errorf("synonym context = %v, want the synonyms at boost %v", speechContext, synonymBoost)
+			}
+		})
+	}
+}
+
+func TestTokenizeWords(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"", nil},
+		{"Hello, World!", []string{"hello", "world"}},
+		{"  the API's   rate-limit -- 100%  ", []string{"the", "api's", "rate-limit", "100"}},
+		{"Café crème", []string{"café", "crème"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := tokenizeWords(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tokenizeWords(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemoveStopWords(t *testing.T) {
+	stop := map[string]bool{"the": true, "and": true}
+	tests := []struct {
+		name   string
+		tokens []string
+		want   []string
+	}{
+		{"mixed", []string{"the", "budget", "and", "the", "plan"}, []string{"budget", "plan"}},
+		{"only stop words", []string{"the", "and"}, nil},
+		{"none", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := removeStopWords(tt.tokens, stop); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("removeStopWords() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComputeWordFrequencies(t *testing.T) {
+	tests := []struct {
+		name   string
+		tokens []string
+		want   []WordFreq
+	}{
+		{"empty", nil, []WordFreq{}},
+		{"sorted by count then word", []string{"plan", "budget", "plan", "audit"}, []WordFreq{
+			{Word: "plan", Count: 2, Frequency: 0.5},
+			{Word: "audit", Count: 1, Frequency: 0.25},
+			{Word: "budget", Count: 1, Frequency: 0.25},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := computeWordFrequencies(tt.tokens); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("computeWordFrequencies() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeTranscript(t *testing.T) {
+	all := NormalizationConfig{RemoveFillerWords: true, NormalizeNumbers: true, FixCapitalization: true}
+	tests := []struct {
+		name string
+		text string
+		cfg  NormalizationConfig
+		want string
+	}{
+		{"disabled", "um we need twenty three on monday", NormalizationConfig{}, "um we need twenty three on monday"},
+		{"filler words", "um so uh we start Umm now", NormalizationConfig{RemoveFillerWords: true}, "so we start now"},
+		{"filler keeps sentence end", "we start now, um.", NormalizationConfig{RemoveFillerWords: true}, "we start now."},
+		{"like set off by commas", "it was, like, huge", NormalizationConfig{RemoveFillerWords: true}, "it was, huge"},
+		{"like as a verb", "I like it", NormalizationConfig{RemoveFillerWords: true}, "I like it"},
+		{"compound number", "we need twenty three chairs", NormalizationConfig{NormalizeNumbers: true}, "we need 23 chairs"},
+		{"hyphenated number", "twenty-three chairs", NormalizationConfig{NormalizeNumbers: true}, "23 chairs"},
+		{"hundreds with and", "two hundred and five people", NormalizationConfig{NormalizeNumbers: true}, "205 people"},
+		{"thousands", "three thousand four hundred", NormalizationConfig{NormalizeNumbers: true}, "3400"},
+		{"punctuation kept", "it costs fifteen.", NormalizationConfig{NormalizeNumbers: true}, "it costs 15."},
+		{"small numbers stay spelled", "one of them", NormalizationConfig{NormalizeNumbers: true}, "one of them"},
+		{"years stay spelled", "back in twenty twenty", NormalizationConfig{NormalizeNumbers: true}, "back in twenty twenty"},
+		{"trailing and", "two hundred and", NormalizationConfig{NormalizeNumbers: true}, "200 and"},
+		{"days months and I", "i'm free on monday in june, i think", NormalizationConfig{FixCapitalization: true}, "I'm free on Monday in June, I think"},
+		{"proper nouns", "deploy kubernetes with istio", NormalizationConfig{FixCapitalization: true, properNouns: []string{"Kubernetes", " Istio ", "two words"}}, "deploy Kubernetes with Istio"},
+		{"custom replacements longest first", "the k eight s cluster", NormalizationConfig{CustomReplacements: map[string]string{"k eight s": "k8s", "eight": "8", "": "x"}}, "the k8s cluster"},
+		{"all together", "um we have twenty three tickets for friday", all, "we have 23 tickets for Friday"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeTranscript(tt.text, tt.cfg); got != tt.want {
+				t.Errorf("normalizeTranscript(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSpelledNumber(t *testing.T) {
+	tests := []struct {
+		words        string
+		wantValue    int
+		wantConsumed int
+		wantSuffix   string
+	}{
+		{"ninety nine balloons", 99, 2, ""},
+		{"nineteen", 19, 1, ""},
+		{"twelve, then", 12, 1, ","},
+		{"one hundred and twenty", 120, 4, ""},
+		{"nine thousand nine hundred ninety nine", 9999, 6, ""},
+		{"hundred", 0, 0, ""},
+		{"twenty-three-four", 0, 0, ""},
+		{"chairs", 0, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.words, func(t *testing.T) {
+			value, consumed, suffix := parseSpelledNumber(strings.Fields(tt.words))
+			if value != tt.wantValue || consumed != tt.wantConsumed || suffix != tt.wantSuffix {
+				t.Errorf("parseSpelledNumber(%q) = %d, %d, %q, want %d, %d, %q",
+					tt.words, value, consumed, suffix, tt.wantValue, tt.wantConsumed, tt.wantSuffix)
+			}
+		})
+	}
+}
+
+func TestSplitLongParagraphs(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		maxLen int
+		want   string
+	}{
+		{"disabled", "First one. Second one.", 0, "First one. Second one."},
+		{"short paragraph", "One. Two.", 50, "One. Two."},
+		{"last sentence end before the limit", "First sentence here. Second one. Third sentence is long.", 35, "First sentence here. Second one.\n\nThird sentence is long."},
+		{"no sentence end before the limit", "A very long opening sentence without a break. Short.", 20, "A very long opening sentence without a break.\n\nShort."},
+		{"single long sentence", "A single sentence that never ends", 10, "A single sentence that never ends"},
+		{"several paragraphs", "Aa aa. Bb bb.\n\nCc cc.", 8, "Aa aa.\n\nBb bb.\n\nCc cc."},
+		{"wrapped paragraph", "Aa aa.\nBb bb.", 8, "Aa aa.\n\nBb bb."},
+		{"length in characters", "Été là. Ça va.", 8, "Été là.\n\nÇa va."},
+		{"heading untouched", "# A heading. That is long. Very long.\n\nOne one. Two two.", 10, "# A heading. That is long. Very long.\n\nOne one.\n\nTwo two."},
+		{"code block untouched", "```\nfirst line. second line. third line.\n```\nAa aa. Bb bb.", 8, "```\nfirst line. second line. third line.\n```\nAa aa.\n\nBb bb."},
+		{"list item untouched", "- Item one. Still item one.\n  more text. And more.", 10, "- Item one. Still item one.\n  more text. And more."},
+		{"numbered list untouched", "1. First step. Then more.", 10, "1. First step. Then more."},
+		{"quote untouched", "> Quoted text. Keeps going.", 10, "> Quoted text. Keeps going."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitLongParagraphs(tt.text, tt.maxLen); got != tt.want {
+				t.Errorf("splitLongParagraphs(%q, %d) = %q, want %q", tt.text, tt.maxLen, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildContextFeedbackReport(t *testing.T) {
+	const transcript = "We moved the Kubernetes cluster to Cloud Run, and BigQuery costs went down."
+	tests := []struct {
+		name          string
+		phrases       []string
+		wantMatched   []string
+		wantUnmatched []string
+		wantHitRate   float64
+	}{
+		{"no phrases", nil, []string{}, []string{}, 0},
+		{"whole words, case and punctuation ignored", []string{"kubernetes", "Cloud Run", "BigQuery", "Spanner"},
+			[]string{"kubernetes", "Cloud Run", "BigQuery"}, []string{"Spanner"}, 0.75},
+		{"partial words do not match", []string{"Kube", "Cloud"}, []string{"Cloud"}, []string{"Kube"}, 0.5},
+		{"multi-word phrases match in order only", []string{"run cloud", "cluster to cloud"}, []string{"cluster to cloud"}, []string{"run cloud"}, 0.5},
+		{"duplicates and empty phrases skipped", []string{"BigQuery", "bigquery!", "", "..."}, []string{"BigQuery"}, []string{}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := buildContextFeedbackReport(transcript, tt.phrases)
+			if report.Type != "context_feedback" {
+				t.Errorf("type = %q, want context_feedback", report.Type)
+			}
+			if !reflect.DeepEqual(report.MatchedPhrases, tt.wantMatched) || !reflect.DeepEqual(report.UnmatchedPhrases, tt.wantUnmatched) {
+				t.Errorf("matched %q, unmatched %q, want %q and %q", report.MatchedPhrases, report.UnmatchedPhrases, tt.wantMatched, tt.wantUnmatched)
+			}
+			if report.HitRate != tt.wantHitRate {
+				t.Errorf("hit rate = %v, want %v", report.HitRate, tt.wantHitRate)
+			}
+		})
+	}
+}
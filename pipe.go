@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1"
+)
+
+// pipeMaxStreamDuration is how much audio, and how much time, a pipe mode stream is used for before it is replaced,
+// below the 305s API limit. Input read from a file arrives faster than real time, so audio is what usually runs out first.
+const pipeMaxStreamDuration = 290 * time.Second
+
+// Output formats of pipe mode
+const (
+	pipeFormatJSON = "json"
+	pipeFormatText = "text"
+)
+
+// PipeConfig configures a transcription of raw audio from Input to Output without the HTTP server
+type PipeConfig struct {
+	Language   string
+	Encoding   string
+	SampleRate int
+	ChunkBytes int
+	Format     string // "json" writes one TranscriptionResponse per line, "text" writes the plain text
+	Input      io.Reader
+	Output     io.Writer
+}
+
+// parsePipeFlags parses the command line; pipe is false when --pipe is not set and the HTTP server should start
+func parsePipeFlags(args []string) (cfg PipeConfig, pipe bool, err error) {
+	flags := flag.NewFlagSet("live_transcription", flag.ContinueOnError)
+	flags.BoolVar(&pipe, "pipe", false, "Transcribe audio from stdin to stdout instead of starting the HTTP server")
+	flags.StringVar(&cfg.Language, "language", "en-US", "Recognition language code")
+	flags.StringVar(&cfg.Encoding, "encoding", "linear16", "Audio encoding (linear16, flac, mulaw, ogg_opus, webm_opus)")
+	flags.IntVar(&cfg.SampleRate, "sample-rate", 16000, "Audio sample rate in Hz")
+	flags.IntVar(&cfg.ChunkBytes, "chunk-bytes", 4096, "Bytes of audio read from stdin per request")
+	flags.StringVar(&cfg.Format, "format", pipeFormatJSON, "Output format: json (JSON lines) or text")
+	if err := flags.Parse(args); err != nil {
+		return PipeConfig{}, false, err
+	}
+
+	if cfg.ChunkBytes <= 0 {
+		return PipeConfig{}, false, fmt.Errorf("--chunk-bytes must be positive")
+	}
+	if cfg.Format != pipeFormatJSON && cfg.Format != pipeFormatText {
+		return PipeConfig{}, false, fmt.Errorf("unknown --format %q (expected %s or %s)", cfg.Format, pipeFormatJSON, pipeFormatText)
+	}
+	cfg.Input, cfg.Output = os.Stdin, os.Stdout
+	return cfg, pipe, nil
+}
+
+// pipeStream is a streaming recognition session whose results are written by its own receive goroutine
+type pipeStream struct {
+	stream        speechpb.Speech_StreamingRecognizeClient
+	startedAt     time.Time
+	audioDuration time.Duration // Audio sent so far; stays 0 for compressed encodings, whose duration is unknown
+	done          chan error    // Receives the result of the receive goroutine once the stream ends
+}
+
+// full reports whether sending a chunk lasting next would take the stream beyond pipeMaxStreamDuration of audio,
+// or whether the stream has been open that long
+func (s *pipeStream) full(next time.Duration, now time.Time) bool {
+	return s.audioDuration+next > pipeMaxStreamDuration || now.Sub(s.startedAt) > pipeMaxStreamDuration
+}
+
+// runPipeMode streams audio from cfg.Input to Speech-to-Text and writes final results to cfg.Output.
+// Streams are replaced before the API duration limit; it returns once the input is exhausted and every result written.
+func runPipeMode(ctx context.Context, cfg PipeConfig) error {
+	client, releaseClient, err := acquireSpeechClient(ctx)
+	if err != nil {
+		return fmt.Errorf("error creating Speech-to-Text client: %v", err)
+	}
+	defer releaseClient()
+
+	streamingConfig := &speechpb.StreamingRecognitionConfig{
+		Config: &speechpb.RecognitionConfig{
+			Encoding:        audioEncoding(cfg.Encoding),
+			SampleRateHertz: int32(cfg.SampleRate),
+			LanguageCode:    cfg.Language,
+		},
+	}
+
+	// writeResult writes a final result in the configured format; results of consecutive streams never interleave
+	var outputMu sync.Mutex
+	writeResult := func(result *speechpb.StreamingRecognitionResult) error {
+		text := strings.TrimSpace(result.Alternatives[0].Transcript)
+		if text == "" {
+			return nil
+		}
+		line := text
+		if cfg.Format == pipeFormatJSON {
+			data, err := json.Marshal(TranscriptionResponse{
+				Type:             "transcription",
+				Text:             text,
+				Timestamp:        Timestamp{Time: time.Now()},
+				Final:            true,
+				DetectedLanguage: result.LanguageCode,
+				ChannelTag:       int(result.ChannelTag),
+			})
+			if err != nil {
+				return fmt.Errorf("error encoding result: %v", err)
+			}
+			line = string(data)
+		}
+		outputMu.Lock()
+		defer outputMu.Unlock()
+		_, err := fmt.Fprintln(cfg.Output, line)
+		return err
+	}
+
+	openStream := func() (*pipeStream, error) {
+		stream, err := client.StreamingRecognize(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error opening stream: %v", err)
+		}
+		if err := stream.Send(&speechpb.StreamingRecognizeRequest{
+			StreamingRequest: &speechpb.StreamingRecognizeRequest_StreamingConfig{StreamingConfig: streamingConfig},
+		}); err != nil {
+			return nil, fmt.Errorf("error sending stream configuration: %v", err)
+		}
+
+		s := &pipeStream{stream: stream, startedAt: time.Now(), done: make(chan error, 1)}
+		go func() {
+			for {
+				resp, err := stream.Recv()
+				if err == io.EOF {
+					s.done <- nil
+					return
+				}
+				if err != nil {
+					s.done <- fmt.Errorf("error receiving results: %v", err)
+					return
+				}
+				for _, result := range resp.Results {
+					if !result.IsFinal || len(result.Alternatives) == 0 {
+						continue
+					}
+					if err := writeResult(result); err != nil {
+						s.done <- fmt.Errorf("error writing result: %v", err)
+						return
+					}
+				}
+			}
+		}()
+		logger.Debug("Pipe stream opened")
+		return s, nil
+	}
+
+	// finish half-closes a stream and waits for its remaining results
+	finish := func(s *pipeStream) error {
+		if err := s.stream.CloseSend(); err != nil {
+			return fmt.Errorf("error closing stream: %v", err)
+		}
+		return <-s.done
+	}
+
+	current, err := openStream()
+	if err != nil {
+		return err
+	}
+
+	encoding := audioEncoding(cfg.Encoding)
+	chunk := make([]byte, cfg.ChunkBytes)
+	var audioBytes int64
+	for {
+		n, readErr := io.ReadFull(cfg.Input, chunk)
+		if n > 0 {
+			chunkDuration := encodedAudioDuration(chunk[:n], encoding, cfg.SampleRate, 1)
+			if current.full(chunkDuration, time.Now()) {
+				logger.Debug("Replacing pipe stream", "audioDuration", current.audioDuration, "age", time.Since(current.startedAt))
+				if err := finish(current); err != nil {
+					return err
+				}
+				if current, err = openStream(); err != nil {
+					return err
+				}
+			}
+			if err := current.stream.Send(&speechpb.StreamingRecognizeRequest{
+				StreamingRequest: &speechpb.StreamingRecognizeRequest_AudioContent{AudioContent: chunk[:n]},
+			}); err != nil {
+				// Send reports io.EOF when the stream failed; the receive goroutine has the cause
+				if recvErr := <-current.done; recvErr != nil {
+					return recvErr
+				}
+				return fmt.Errorf("error sending audio: %v", err)
+			}
+			audioBytes += int64(n)
+			current.audioDuration += chunkDuration
+		}
+
+		if errors.Is(readErr, io.EOF) || errors.Is(readErr, io.ErrUnexpectedEOF) {
+			logger.Info("End of audio input", "audioBytes", audioBytes)
+			return finish(current)
+		}
+		if readErr != nil {
+			return fmt.Errorf("error reading audio: %v", readErr)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPipeStreamFull(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	second := func(bytesPerSecond int) time.Duration {
+		return encodedAudioDuration(make([]byte, bytesPerSecond), audioEncoding("linear16"), 16000, 1)
+	}
+	tests := []struct {
+		name          string
+		audioDuration time.Duration
+		next          time.Duration
+		elapsed       time.Duration
+		want          bool
+	}{
+		{"fresh stream", 0, second(32000), 0, false},
+		{"audio sent faster than real time", pipeMaxStreamDuration - 500*time.Millisecond, second(32000), 10 * time.Second, true},
+		{"audio fits", pipeMaxStreamDuration - 2*time.Second, second(32000), 10 * time.Second, false},
+		{"open too long", 0, 0, pipeMaxStreamDuration + time.Second, true},
+		{"compressed audio falls back to elapsed time", 0, 0, time.Minute, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := &pipeStream{startedAt: start, audioDuration: tt.audioDuration}
+			if got := stream.full(tt.next, start.Add(tt.elapsed)); got != tt.want {
+				t.Errorf("full() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePipeFlags(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		wantPipe bool
+		want     PipeConfig
+		wantErr  bool
+	}{
+		{"server mode", nil, false, PipeConfig{Language: "en-US", Encoding: "linear16", SampleRate: 16000, ChunkBytes: 4096, Format: pipeFormatJSON}, false},
+		{"pipe defaults", []string{"--pipe"}, true, PipeConfig{Language: "en-US", Encoding: "linear16", SampleRate: 16000, ChunkBytes: 4096, Format: pipeFormatJSON}, false},
+		{"pipe options", []string{"--pipe", "--language=fr-FR", "--encoding=flac", "--sample-rate=48000", "--chunk-bytes=1024", "--format=text"}, true,
+			PipeConfig{Language: "fr-FR", Encoding: "flac", SampleRate: 48000, ChunkBytes: 1024, Format: pipeFormatText}, false},
+		{"non-positive chunk size", []string{"--pipe", "--chunk-bytes=0"}, false, PipeConfig{}, true},
+		{"unknown format", []string{"--pipe", "--format=xml"}, false, PipeConfig{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, pipe, err := parsePipeFlags(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePipeFlags(%v) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			cfg.Input, cfg.Output = nil, nil
+			if pipe != tt.wantPipe || cfg != tt.want {
+				t.Errorf("parsePipeFlags(%v) = %+v, %v, want %+v, %v", tt.args, cfg, pipe, tt.want, tt.wantPipe)
+			}
+		})
+	}
+}
+
+func TestRunPipeMode(t *testing.T) {
+	oneSecond := 32000 // Bytes of 16kHz mono LINEAR16
+	tests := []struct {
+		name       string
+		format     string
+		audioBytes int
+		wantLines  []string
+		wantChunks int
+	}{
+		{"JSON lines", pipeFormatJSON, oneSecond, []string{`"text":"hello pipe"`}, 8},
+		{"plain text", pipeFormatText, oneSecond, []string{"hello pipe"}, 8},
+		{"no audio", pipeFormatText, 0, nil, 0},
+		// Input read faster than real time fills a stream with audio before its time runs out
+		{"stream replaced after the audio limit", pipeFormatText, 300 * oneSecond, []string{"hello pipe", "hello pipe"}, 300 * oneSecond / 4096},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSpeechPool(t)
+			fake.setResults("hello pipe", "")
+			var output bytes.Buffer
+			err := runPipeMode(context.Background(), PipeConfig{
+				Language:   "en-US",
+				Encoding:   "linear16",
+				SampleRate: 16000,
+				ChunkBytes: 4096,
+				Format:     tt.format,
+				Input:      bytes.NewReader(make([]byte, tt.audioBytes)),
+				Output:     &output,
+			})
+			if err != nil {
+				t.Fatalf("runPipeMode() error = %v", err)
+			}
+
+			lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+			if len(tt.wantLines) == 0 {
+				if output.Len() != 0 {
+					t.Errorf("output = %q, want none", output.String())
+				}
+			} else if len(lines) != len(tt.wantLines) {
+				t.Fatalf("output = %q, want %d lines", output.String(), len(tt.wantLines))
+			}
+			for i, want := range tt.wantLines {
+				match := strings.Contains(lines[i], want)
+				if tt.format == pipeFormatText {
+					match = lines[i] == want
+				}
+				if !match {
+					t.Errorf("line %d = %q, want %q", i, lines[i], want)
+				}
+			}
+			if got := fake.audioChunks(); got < tt.wantChunks || got > tt.wantChunks+1 {
+				t.Errorf("sent %d audio chunks, want %d", got, tt.wantChunks)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	speech "cloud.google.com/go/speech/apiv1"
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1"
+)
+
+// warmUpHoldDuration is how long warm-up streams are kept open before being closed
+const warmUpHoldDuration = 2 * time.Second
+
+// SpeechClientPool shares a fixed set of Speech-to-Text clients across sessions
+type SpeechClientPool struct {
+	clients []*speech.Client
+	next    atomic.Uint64
+}
+
+// Global Speech-to-Text client pool, nil when the clients could not be created at startup
+var speechClientPool *SpeechClientPool
+
+// NewSpeechClientPool creates a pool of size clients
+func NewSpeechClientPool(ctx context.Context, size int) (*SpeechClientPool, error) {
+	pool := &SpeechClientPool{}
+	for i := 0; i < size; i++ {
+		client, err := speech.NewClient(ctx, googleClientOptions()...)
+		if err != nil {
+			pool.Close()
+			return nil, fmt.Errorf("error creating Speech-to-Text client: %v", err)
+		}
+		pool.clients = append(pool.clients, client)
+	}
+	return pool, nil
+}
+
+// Get returns the next client in round-robin order
+func (p *SpeechClientPool) Get() *speech.Client {
+	return p.clients[(p.next.Add(1)-1)%uint64(len(p.clients))]
+}
+
+// Size returns the number of clients in the pool
+func (p *SpeechClientPool) Size() int {
+	return len(p.clients)
+}
+
+// Close closes every client in the pool
+func (p *SpeechClientPool) Close() {
+	for _, client := range p.clients {
+		client.Close()
+	}
+}
+
+// WarmUp opens n streams spread over the pool clients, sends a streaming config on each,
+// holds them briefly and closes them so the underlying connections are established before use
+func (p *SpeechClientPool) WarmUp(ctx context.Context, n int) error {
+	var streams []speechpb.Speech_StreamingRecognizeClient
+	var errs []error
+	for i := 0; i < n; i++ {
+		stream, err := p.clients[i%len(p.clients)].StreamingRecognize(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error opening warm-up stream %d: %v", i, err))
+			continue
+		}
+		if err := stream.Send(&speechpb.StreamingRecognizeRequest{
+			StreamingRequest: &speechpb.StreamingRecognizeRequest_StreamingConfig{
+				StreamingConfig: &speechpb.StreamingRecognitionConfig{
+					Config: &speechpb.RecognitionConfig{
+						Encoding:        speechpb.RecognitionConfig_LINEAR16,
+						SampleRateHertz: 16000,
+						LanguageCode:    "en-US",
+					},
+				},
+			},
+		}); err != nil {
+			errs = append(errs, fmt.Errorf("error sending warm-up config on stream %d: %v", i, err))
+		}
+		streams = append(streams, stream)
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(warmUpHoldDuration):
+	}
+
+	for _, stream := range streams {
+		stream.CloseSend()
+	}
+	return errors.Join(errs...)
+}
+
+// initSpeechClientPool creates the shared client pool and optionally pre-warms its connections
+func initSpeechClientPool() {
+	size := int(getEnvInt64("SPEECH_CLIENT_POOL_SIZE", 4))
+	if size < 1 {
+		size = 1
+	}
+
+	pool, err := NewSpeechClientPool(context.Background(), size)
+	if err != nil {
+		logger.Error("Failed to create Speech-to-Text client pool, sessions will create their own clients", "error", err)
+		return
+	}
+	speechClientPool = pool
+	logger.Info("Speech-to-Text client pool created", "size", size)
+
+	if os.Getenv("PREHEAT_CONNECTIONS") != "true" {
+		return
+	}
+
+	// Bound the warm-up so a slow region does not delay startup indefinitely
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := pool.WarmUp(ctx, pool.Size()); err != nil {
+		logger.Warn("Speech-to-Text warm-up incomplete", "error", err, "duration", time.Since(start))
+		return
+	}
+	logger.Info("Speech-to-Text connections warmed up", "streams", pool.Size(), "duration", time.Since(start))
+}
+
+// acquireSpeechClient returns a pooled client, or a dedicated one when no pool is available.
+// The returned release function must be called when the client is no longer needed.
+func acquireSpeechClient(ctx context.Context) (*speech.Client, func(), error) {
+	if speechClientPool != nil {
+		return speechClientPool.Get(), func() {}, nil
+	}
+	client, err := speech.NewClient(ctx, googleClientOptions()...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, func() { client.Close() }, nil
+}
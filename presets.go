@@ -0,0 +1,180 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// PresetWatcher keeps the presets of a directory in memory, reloading them on file system events
+type PresetWatcher struct {
+	dir string
+
+	mu          sync.RWMutex
+	presetCache map[string]*Preset
+
+	watcher *fsnotify.Watcher
+	done    chan struct{} // Closed once the event loop has returned
+}
+
+// presetWatcher serves presets from memory; nil when the preset directory cannot be watched and presets are read from disk
+var presetWatcher *PresetWatcher
+
+// NewPresetWatcher creates a watcher for dir; call Scan to load the presets and Start to follow changes
+func NewPresetWatcher(dir string) *PresetWatcher {
+	return &PresetWatcher{
+		dir:         dir,
+		presetCache: make(map[string]*Preset),
+	}
+}
+
+// Get returns a cached preset; a nil watcher caches nothing
+func (w *PresetWatcher) Get(name string) (*Preset, bool) {
+	if w == nil {
+		return nil, false
+	}
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	preset, ok := w.presetCache[name]
+	return preset, ok
+}
+
+// Titles returns the title of every cached preset by name
+func (w *PresetWatcher) Titles() map[string]string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	titles := make(map[string]string, len(w.presetCache))
+	for name, preset := range w.presetCache {
+		titles[name] = preset.Title
+	}
+	return titles
+}
+
+// presetFileName returns the preset name of a .json or .txt preset file
+func presetFileName(fileName string) (string, bool) {
+	extension := filepath.Ext(fileName)
+	if extension != ".json" && extension != ".txt" {
+		return "", false
+	}
+	return strings.TrimSuffix(fileName, extension), true
+}
+
+// Scan loads every preset of the directory, replacing the cached ones
+func (w *PresetWatcher) Scan() {
+	files, err := os.ReadDir(w.dir)
+	if err != nil && !os.IsNotExist(err) {
+		logger.Error("Failed to read preset directory", "directory", w.dir, "error", err)
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	presets := make(map[string]*Preset, len(files))
+	for _, file := range files {
+		name, ok := presetFileName(file.Name())
+		if file.IsDir() || !ok {
+			continue
+		}
+		if _, loaded := presets[name]; loaded {
+			continue
+		}
+		// The .json file of a name takes precedence over its .txt file
+		preset, err := readPreset(w.dir, name)
+		if err != nil {
+			logger.Error("Failed to load preset", "preset", name, "error", err)
+			continue
+		}
+		presets[name] = preset
+	}
+	w.presetCache = presets
+	logger.Info("Presets loaded", "directory", w.dir, "presets", len(presets))
+}
+
+// reload reloads the preset name after one of its files was created, written or removed
+func (w *PresetWatcher) reload(name string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, cached := w.presetCache[name]
+	preset, err := readPreset(w.dir, name)
+	switch {
+	case os.IsNotExist(err):
+		delete(w.presetCache, name)
+		if cached {
+			logger.Info("Preset removed", "preset", name)
+		}
+	case err != nil:
+		delete(w.presetCache, name)
+		logger.Error("Failed to load preset", "preset", name, "error", err)
+	case cached:
+		w.presetCache[name] = preset
+		logger.Info("Preset updated", "preset", name, "title", preset.Title)
+	default:
+		w.presetCache[name] = preset
+		logger.Info("Preset added", "preset", name, "title", preset.Title)
+	}
+}
+
+// Start watches the directory, reloading a preset on CREATE, WRITE, REMOVE and RENAME events of its files until Close
+func (w *PresetWatcher) Start() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(w.dir); err != nil {
+		watcher.Close()
+		return err
+	}
+	w.watcher = watcher
+	w.done = make(chan struct{})
+	go w.run()
+	return nil
+}
+
+// run handles the watcher events until the watcher is closed
+func (w *PresetWatcher) run() {
+	defer close(w.done)
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			name, ok := presetFileName(filepath.Base(event.Name))
+			if !ok || !event.Has(fsnotify.Create|fsnotify.Write|fsnotify.Remove|fsnotify.Rename) {
+				continue
+			}
+			w.reload(name)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			logger.Error("Preset directory watch error", "directory", w.dir, "error", err)
+		}
+	}
+}
+
+// Close stops watching the directory once the pending events are handled; the cached presets are still served
+func (w *PresetWatcher) Close() error {
+	if w == nil || w.watcher == nil {
+		return nil
+	}
+	err := w.watcher.Close()
+	<-w.done
+	return err
+}
+
+// initPresetWatcher loads the presets of PRESET_DIRECTORY and watches it for changes.
+// When the directory cannot be watched, presets are read from disk on each request.
+func initPresetWatcher() {
+	watcher := NewPresetWatcher(getPresetDirectory())
+	if err := watcher.Start(); err != nil {
+		logger.Warn("Cannot watch the preset directory, presets are read from disk on each request",
+			"directory", watcher.dir, "error", err)
+		return
+	}
+	watcher.Scan()
+	presetWatcher = watcher
+}
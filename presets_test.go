@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writePresetFile writes a preset file to dir
+func writePresetFile(t *testing.T, dir, fileName, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, fileName), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPresetWatcherScan(t *testing.T) {
+	dir := t.TempDir()
+	writePresetFile(t, dir, "meeting.txt", "Title: Meeting\nSummary:\nSummarize.")
+	writePresetFile(t, dir, "meeting.json", `{"version":2,"title":"Meeting v2"}`)
+	writePresetFile(t, dir, "lecture.txt", "Title: Lecture\nSummary:\nSummarize.")
+	writePresetFile(t, dir, "broken.json", "{")
+	writePresetFile(t, dir, "notes.md", "Title: Notes")
+	if err := os.Mkdir(filepath.Join(dir, "archive.json"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	watcher := NewPresetWatcher(dir)
+	watcher.Scan()
+	want := map[string]string{"meeting": "Meeting v2", "lecture": "Lecture"}
+	if got := watcher.Titles(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Titles() = %v, want %v", got, want)
+	}
+}
+
+func TestPresetWatcherEvents(t *testing.T) {
+	dir := t.TempDir()
+	watcher := NewPresetWatcher(dir)
+	if err := watcher.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { watcher.Close() })
+	watcher.Scan()
+
+	write := func(fileName, content string) { writePresetFile(t, dir, fileName, content) }
+	remove := func(fileName string) {
+		if err := os.Remove(filepath.Join(dir, fileName)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rename := func(from, to string) {
+		if err := os.Rename(filepath.Join(dir, from), filepath.Join(dir, to)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Steps run in order against the same directory
+	steps := []struct {
+		name   string
+		change func()
+		want   map[string]string
+	}{
+		{"legacy preset created", func() { write("meeting.txt", "Title: Meeting\nSummary:\nSummarize.") }, map[string]string{"meeting": "Meeting"}},
+		{"JSON preset takes precedence", func() { write("meeting.json", `{"version":2,"title":"Meeting v2"}`) }, map[string]string{"meeting": "Meeting v2"}},
+		{"preset written", func() { write("meeting.json", `{"version":2,"title":"Weekly meeting"}`) }, map[string]string{"meeting": "Weekly meeting"}},
+		{"other files ignored", func() {
+			write("notes.md", "Title: Notes")
+			if err := os.Mkdir(filepath.Join(dir, "archive.json"), 0755); err != nil {
+				t.Fatal(err)
+			}
+		}, map[string]string{"meeting": "Weekly meeting"}},
+		{"invalid preset fixed", func() {
+			write("broken.json", "{")
+			write("broken.json", `{"version":2,"title":"Fixed"}`)
+		}, map[string]string{"meeting": "Weekly meeting", "broken": "Fixed"}},
+		{"JSON preset removed", func() { remove("meeting.json") }, map[string]string{"meeting": "Meeting", "broken": "Fixed"}},
+		{"preset renamed", func() { rename("broken.json", "lecture.json") }, map[string]string{"meeting": "Meeting", "lecture": "Fixed"}},
+		{"presets removed", func() { remove("meeting.txt"); remove("lecture.json") }, map[string]string{}},
+	}
+	for _, step := range steps {
+		step.change()
+		waitFor(t, step.name, func() bool { return reflect.DeepEqual(watcher.Titles(), step.want) })
+	}
+
+	// Once closed, changes are no longer picked up
+	if err := watcher.Close(); err != nil {
+		t.Fatal(err)
+	}
+	write("interview.json", `{"version":2,"title":"Interview"}`)
+	time.Sleep(100 * time.Millisecond)
+	if got := watcher.Titles(); len(got) != 0 {
+		t.Errorf("Titles() after Close = %v, want none", got)
+	}
+}
+
+func TestPresetWatcherMissingDirectory(t *testing.T) {
+	watcher := NewPresetWatcher(filepath.Join(t.TempDir(), "missing"))
+	if err := watcher.Start(); err == nil {
+		watcher.Close()
+		t.Error("Start() watched a missing directory")
+	}
+	watcher.Scan()
+	if got := watcher.Titles(); len(got) != 0 {
+		t.Errorf("Titles() = %v, want none", got)
+	}
+	if err := watcher.Close(); err != nil {
+		t.Errorf("Close() of a watcher never started = %v", err)
+	}
+	var nilWatcher *PresetWatcher
+	if _, ok := nilWatcher.Get("meeting"); ok {
+		t.Error("nil watcher returned a preset")
+	}
+}
+
+func TestServePresetsFromWatcher(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PRESET_DIRECTORY", dir)
+	writePresetFile(t, dir, "meeting.json", `{"version":2,"title":"Meeting","summary":"Summarize."}`)
+	previous := presetWatcher
+	presetWatcher = NewPresetWatcher(dir)
+	presetWatcher.Scan()
+	t.Cleanup(func() { presetWatcher = previous })
+
+	// Added after the last scan: not listed yet, but served from disk on a cache miss
+	writePresetFile(t, dir, "lecture.json", `{"version":2,"title":"Lecture"}`)
+
+	recorder := httptest.NewRecorder()
+	servePresets(recorder, httptest.NewRequest(http.MethodGet, "/api/presets", nil))
+	var titles map[string]string
+	if err := json.NewDecoder(recorder.Body).Decode(&titles); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"meeting": "Meeting"}; !reflect.DeepEqual(titles, want) {
+		t.Errorf("presets = %v, want %v", titles, want)
+	}
+
+	tests := []struct {
+		name       string
+		wantStatus int
+		wantTitle  string
+	}{
+		{"meeting", http.StatusOK, "Meeting"},
+		{"lecture", http.StatusOK, "Lecture"},
+		{"interview", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			servePreset(recorder, httptest.NewRequest(http.MethodGet, "/api/presets/"+tt.name, nil))
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var preset Preset
+			if err := json.NewDecoder(recorder.Body).Decode(&preset); err != nil {
+				t.Fatal(err)
+			}
+			if preset.Title != tt.wantTitle {
+				t.Errorf("title = %q, want %q", preset.Title, tt.wantTitle)
+			}
+		})
+	}
+}
+
+func TestMigratePreset(t *testing.T) {
+	standup := &Preset{
+		Title:      "Daily Standup",
+		Summary:    "Summarize what each participant did yesterday, plans for today and any blockers.\nGroup the updates by participant.",
+		Conclusion: "Keep the summary under ten bullet points.",
+	}
+	retro := &Preset{
+		Title:      "Retrospective",
+		Summary:    "List what went well, what did not and the agreed improvements.",
+		Conclusion: "Assign an owner to every improvement.",
+	}
+	tests := []struct {
+		name    string
+		fixture string // File in testdata/presets; content is used when empty
+		content string
+		want    *Preset
+		wantErr bool
+	}{
+		{"legacy format", "standup.txt", "", standup, false},
+		{"JSON format", "retro.json", "", retro, false},
+		{"unknown format", "", "# Meeting\nSummarize.", nil, true},
+		{"invalid JSON", "", `{"title":`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := tt.content
+			if tt.fixture != "" {
+				data, err := os.ReadFile(filepath.Join("testdata", "presets", tt.fixture))
+				if err != nil {
+					t.Fatal(err)
+				}
+				content = string(data)
+			}
+			got, err := migratePreset(content)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("migratePreset() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("migratePreset() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServeMigratePreset(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PRESET_DIRECTORY", dir)
+	t.Setenv("ADMIN_API_KEY", "secret")
+	for _, fixture := range []string{"standup.txt", "retro.json"} {
+		data, err := os.ReadFile(filepath.Join("testdata", "presets", fixture))
+		if err != nil {
+			t.Fatal(err)
+		}
+		writePresetFile(t, dir, fixture, string(data))
+	}
+	retroFile, err := os.ReadFile(filepath.Join(dir, "retro.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Steps run in order against the same directory
+	steps := []struct {
+		name       string
+		method     string
+		preset     string
+		adminKey   string
+		wantStatus int
+		wantTitle  string
+	}{
+		{"admin key required", http.MethodPut, "standup", "", http.StatusUnauthorized, ""},
+		{"wrong admin key", http.MethodPut, "standup", "guess", http.StatusUnauthorized, ""},
+		{"legacy preset converted", http.MethodPut, "standup", "secret", http.StatusOK, "Daily Standup"},
+		{"second migration is idempotent", http.MethodPut, "standup", "secret", http.StatusOK, "Daily Standup"},
+		{"JSON preset passed through", http.MethodPut, "retro", "secret", http.StatusOK, "Retrospective"},
+		{"unknown preset", http.MethodPut, "lecture", "secret", http.StatusNotFound, ""},
+		{"invalid name", http.MethodPut, "../presets", "secret", http.StatusBadRequest, ""},
+		{"wrong method", http.MethodGet, "standup", "secret", http.StatusMethodNotAllowed, ""},
+	}
+	for _, step := range steps {
+		r := httptest.NewRequest(step.method, "/api/presets/"+step.preset+"/migrate", nil)
+		r.SetPathValue("name", step.preset)
+		if step.adminKey != "" {
+			r.Header.Set("X-Admin-API-Key", step.adminKey)
+		}
+		recorder := httptest.NewRecorder()
+		serveMigratePreset(recorder, r)
+		if recorder.Code != step.wantStatus {
+			t.Fatalf("%s: status = %d, want %d", step.name, recorder.Code, step.wantStatus)
+		}
+		if step.wantStatus != http.StatusOK {
+			continue
+		}
+		var preset Preset
+		if err := json.NewDecoder(recorder.Body).Decode(&preset); err != nil {
+			t.Fatal(err)
+		}
+		if preset.Title != step.wantTitle {
+			t.Errorf("%s: title = %q, want %q", step.name, preset.Title, step.wantTitle)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "standup.txt")); !os.IsNotExist(err) {
+		t.Errorf("legacy preset still present after migration: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "standup.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var migrated PresetV2
+	if err := json.Unmarshal(data, &migrated); err != nil {
+		t.Fatal(err)
+	}
+	want := PresetV2{
+		Version:    presetFormatVersion,
+		Title:      "Daily Standup",
+		Summary:    "Summarize what each participant did yesterday, plans for today and any blockers.\nGroup the updates by participant.",
+		Conclusion: "Keep the summary under ten bullet points.",
+	}
+	if migrated != want {
+		t.Errorf("migrated file = %+v, want %+v", migrated, want)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "retro.json")); err != nil || string(data) != string(retroFile) {
+		t.Errorf("JSON preset rewritten to %q (%v), want it untouched", data, err)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// PubSub fans out every message sent to a session's client to the viewers watching that session.
+// Each session is a topic backed by a Broadcaster, opened when the session starts and closed when it ends.
+type PubSub struct {
+	mu     sync.Mutex
+	topics map[string]*Broadcaster
+}
+
+// sessionPubSub carries the outbound messages of every live session
+var sessionPubSub = NewPubSub()
+
+// NewPubSub creates a PubSub without topics
+func NewPubSub() *PubSub {
+	return &PubSub{topics: make(map[string]*Broadcaster)}
+}
+
+// Open creates the topic of a session
+func (p *PubSub) Open(sessionID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.topics[sessionID]; !ok {
+		p.topics[sessionID] = NewBroadcaster()
+	}
+}
+
+// Close disconnects the subscribers of a session and removes its topic
+func (p *PubSub) Close(sessionID string) {
+	p.mu.Lock()
+	topic, ok := p.topics[sessionID]
+	delete(p.topics, sessionID)
+	p.mu.Unlock()
+	if ok {
+		topic.Close()
+	}
+}
+
+// topic returns the broadcaster of an open session
+func (p *PubSub) topic(sessionID string) (*Broadcaster, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	topic, ok := p.topics[sessionID]
+	return topic, ok
+}
+
+// Publish sends data to every subscriber of a session; messages for sessions without a topic are dropped
+func (p *PubSub) Publish(sessionID string, data []byte) {
+	if topic, ok := p.topic(sessionID); ok {
+		topic.Publish(data)
+	}
+}
+
+// Subscribe returns the messages published to a session from now on, in order.
+// The channel is closed when the session ends, or immediately if it is not live; call unsubscribe when done.
+func (p *PubSub) Subscribe(sessionID string) (<-chan []byte, func()) {
+	events, _, unsubscribeEvents := p.subscribeFrom(sessionID, math.MaxInt64) // No replay
+	messages := make(chan []byte, sseSubscriberBuffer)
+	done := make(chan struct{})
+	go func() {
+		defer close(messages)
+		for event := range events {
+			select {
+			case messages <- event.Data:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			close(done)
+			unsubscribeEvents()
+		})
+	}
+	return messages, unsubscribe
+}
+
+// subscribeFrom subscribes to a session's events, replaying those published after lastEventID that are still in history
+func (p *PubSub) subscribeFrom(sessionID string, lastEventID int64) (chan sseEvent, []sseEvent, func()) {
+	topic, ok := p.topic(sessionID)
+	if !ok {
+		events := make(chan sseEvent)
+		close(events)
+		return events, nil, func() {}
+	}
+	return topic.Subscribe(lastEventID)
+}
+
+// serveSessionWatch streams a live session's messages to a read-only WebSocket viewer
+func serveSessionWatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	session, ok := sessionRegistry.Get(r.PathValue("sessionID"))
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logger.Error("WebSocket upgrade failed", "error", err)
+		return
+	}
+	defer conn.Close()
+
+	messages, unsubscribe := sessionPubSub.Subscribe(session.ID)
+	defer unsubscribe()
+
+	// Viewers are read-only: incoming messages are discarded and a read error means the viewer left
+	viewerGone := make(chan struct{})
+	go func() {
+		defer close(viewerGone)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	logger.Info("Session viewer connected", "sessionID", session.ID, "remoteIP", clientIP(r))
+
+	for {
+		select {
+		case <-viewerGone:
+			logger.Info("Session viewer disconnected", "sessionID", session.ID)
+			return
+		case data, ok := <-messages:
+			if !ok {
+				logger.Info("Session ended, closing viewer", "sessionID", session.ID)
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseNormalClosure, "session ended"),
+					time.Now().Add(time.Second))
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+			if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				logger.Warn("Failed to send message to session viewer", "sessionID", session.ID, "error", err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestPubSubFansOutToSubscribers(t *testing.T) {
+	pubsub := NewPubSub()
+	pubsub.Open("session")
+
+	const subscribers, events = 3, 20
+	var channels []<-chan []byte
+	for i := 0; i < subscribers; i++ {
+		messages, unsubscribe := pubsub.Subscribe("session")
+		defer unsubscribe()
+		channels = append(channels, messages)
+	}
+
+	for i := 0; i < events; i++ {
+		pubsub.Publish("session", []byte(fmt.Sprintf("event %d", i)))
+	}
+	pubsub.Close("session")
+
+	var wg sync.WaitGroup
+	for s, messages := range channels {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var got []string
+			for data := range messages {
+				got = append(got, string(data))
+			}
+			if len(got) != events {
+				t.Errorf("subscriber %d received %d events, want %d", s, len(got), events)
+				return
+			}
+			for i, data := range got {
+				if want := fmt.Sprintf("event %d", i); data != want {
+					t.Errorf("subscriber %d event %d = %q, want %q", s, i, data, want)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestPubSubSubscribe(t *testing.T) {
+	tests := []struct {
+		name        string
+		open        bool
+		unsubscribe bool
+		wantEvents  int
+	}{
+		{"session not live", false, false, 0},
+		{"live session", true, false, 1},
+		{"unsubscribed", true, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pubsub := NewPubSub()
+			if tt.open {
+				pubsub.Open("session")
+			}
+			pubsub.Publish("session", []byte("before subscribing"))
+			messages, unsubscribe := pubsub.Subscribe("session")
+			if tt.unsubscribe {
+				unsubscribe()
+			}
+			pubsub.Publish("session", []byte("event"))
+			pubsub.Close("session")
+
+			received := 0
+			timeout := time.After(5 * time.Second)
+			for {
+				select {
+				case data, ok := <-messages:
+					if !ok {
+						if received != tt.wantEvents {
+							t.Errorf("received %d events, want %d", received, tt.wantEvents)
+						}
+						unsubscribe()
+						return
+					}
+					if string(data) != "event" {
+						t.Errorf("received %q, want only events published after subscribing", data)
+					}
+					received++
+				case <-timeout:
+					t.Fatal("subscription channel was not closed")
+				}
+			}
+		})
+	}
+}
+
+func TestServeSessionWatch(t *testing.T) {
+	session := newSession(func() {}, ConfigMessage{})
+	sessionRegistry.Register(session)
+	defer sessionRegistry.Unregister(session.ID)
+	sessionPubSub.Open(session.ID)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/sessions/{sessionID}/watch", serveSessionWatch)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/sessions/" + session.ID + "/watch"
+
+	if _, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/sessions/0123456789abcdef/watch", nil); err == nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("watching an unknown session = %v, want 404", err)
+	}
+
+	var viewers []*websocket.Conn
+	for i := 0; i < 3; i++ {
+		conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		viewers = append(viewers, conn)
+	}
+	// Viewers subscribe after the upgrade; wait until all of them are listening
+	waitFor(t, "viewers to subscribe", func() bool {
+		topic, _ := sessionPubSub.topic(session.ID)
+		topic.mu.Lock()
+		defer topic.mu.Unlock()
+		return len(topic.subscribers) == len(viewers)
+	})
+
+	sessionPubSub.Publish(session.ID, []byte(`{"type":"transcription","text":"one"}`))
+	sessionPubSub.Publish(session.ID, []byte(`{"type":"transcription","text":"two"}`))
+	sessionPubSub.Close(session.ID)
+
+	for i, conn := range viewers {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for _, want := range []string{"one", "two"} {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				t.Fatalf("viewer %d: %v", i, err)
+			}
+			if !strings.Contains(string(data), want) {
+				t.Errorf("viewer %d received %s, want %q", i, data, want)
+			}
+		}
+		if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+			t.Errorf("viewer %d read error = %v, want a normal closure when the session ends", i, err)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// TokenBucket is a thread-safe token bucket refilled continuously over a period
+type TokenBucket struct {
+	mu       sync.Mutex
+	capacity int64
+	tokens   int64
+	period   time.Duration
+	// refilled is when the tokens were last brought up to date; the fraction of a token earned since is kept
+	refilled time.Time
+	// now and interval are the clock and the tick of Run, replaced in tests
+	now      func() time.Time
+	interval time.Duration
+}
+
+// NewTokenBucket creates a full bucket holding capacity tokens refilled over period
+func NewTokenBucket(capacity int64, period time.Duration) *TokenBucket {
+	return &TokenBucket{
+		capacity: capacity,
+		tokens:   capacity,
+		period:   period,
+		refilled: time.Now(),
+		now:      time.Now,
+		interval: time.Second,
+	}
+}
+
+// Take removes n tokens from the bucket, returning false if not enough tokens are available
+func (b *TokenBucket) Take(n int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if int64(n) > b.tokens {
+		return false
+	}
+	b.tokens -= int64(n)
+	return true
+}
+
+// RetryAfter estimates how long until n tokens are available
+func (b *TokenBucket) RetryAfter(n int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	missing := int64(n) - b.tokens
+	if missing <= 0 || b.capacity <= 0 {
+		return 0
+	}
+	return time.Duration(float64(b.period) * float64(missing) / float64(b.capacity))
+}
+
+// Utilization returns the fraction of the bucket currently consumed (0.0 to 1.0)
+func (b *TokenBucket) Utilization() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.capacity <= 0 {
+		return 0
+	}
+	return 1 - float64(b.tokens)/float64(b.capacity)
+}
+
+// Available returns the number of tokens currently in the bucket
+func (b *TokenBucket) Available() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tokens
+}
+
+// refill adds the whole tokens earned since the last refill, clamped to the capacity.
+// Only the time those tokens account for is consumed, so small capacities still refill across several ticks.
+func (b *TokenBucket) refill() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	if b.tokens >= b.capacity || b.capacity <= 0 || b.period <= 0 {
+		b.tokens = min(b.tokens, b.capacity)
+		b.refilled = now
+		return
+	}
+	earned := int64(float64(b.capacity) * float64(now.Sub(b.refilled)) / float64(b.period))
+	if earned <= 0 {
+		return
+	}
+	b.tokens += earned
+	b.refilled = b.refilled.Add(time.Duration(float64(b.period) * float64(earned) / float64(b.capacity)))
+	if b.tokens >= b.capacity {
+		b.tokens = b.capacity
+		b.refilled = now
+	}
+}
+
+// Run refills the bucket in the background until stop is closed
+func (b *TokenBucket) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.refill()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Server-wide audio ingestion quota, in bytes per minute
+var audioQuota = NewTokenBucket(100*1024*1024, time.Minute)
+
+// initAudioQuota configures the audio quota from GCP_AUDIO_QUOTA_BYTES_PER_MINUTE and starts refilling it
+func initAudioQuota() {
+	capacity := getEnvInt64("GCP_AUDIO_QUOTA_BYTES_PER_MINUTE", 100*1024*1024)
+	audioQuota = NewTokenBucket(capacity, time.Minute)
+	go audioQuota.Run(make(chan struct{}))
+	logger.Info("Audio ingestion quota configured", "bytesPerMinute", capacity)
+}
+
+// IPBlocklist holds the networks denied access to the server; it can be replaced at runtime
+type IPBlocklist struct {
+	mu         sync.RWMutex
+	nets       []net.IPNet
+	trustProxy bool
+}
+
+// Global IP blocklist, loaded from BLOCKED_IPS and BLOCKED_IPS_FILE
+var ipBlocklist = &IPBlocklist{}
+
+// parseBlockedIPs parses a comma-separated list of CIDRs and exact IPs
+func parseBlockedIPs(value string) []net.IPNet {
+	var nets []net.IPNet
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			_, ipNet, err := net.ParseCIDR(entry)
+			if err != nil {
+				logger.Warn("Ignoring invalid blocked CIDR", "entry", entry, "error", err)
+				continue
+			}
+			nets = append(nets, *ipNet)
+			continue
+		}
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			logger.Warn("Ignoring invalid blocked IP", "entry", entry)
+			continue
+		}
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		nets = append(nets, net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+	return nets
+}
+
+// readBlockedIPsFile reads blocked CIDRs and exact IPs from a file holding one or more comma-separated entries per line;
+// text after a # is a comment
+func readBlockedIPsFile(path string) ([]net.IPNet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var nets []net.IPNet
+	for _, line := range strings.Split(string(data), "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		nets = append(nets, parseBlockedIPs(line)...)
+	}
+	return nets, nil
+}
+
+// Networks returns a copy of the blocked networks
+func (b *IPBlocklist) Networks() []net.IPNet {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	nets := make([]net.IPNet, len(b.nets))
+	copy(nets, b.nets)
+	return nets
+}
+
+// Set replaces the blocked networks
+func (b *IPBlocklist) Set(nets []net.IPNet, trustProxy bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nets = nets
+	b.trustProxy = trustProxy
+}
+
+// Blocked reports whether the client of r is in a blocked network, returning the client IP checked
+func (b *IPBlocklist) Blocked(r *http.Request) (bool, string) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	address := requestIP(r, b.trustProxy)
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false, address
+	}
+	for _, ipNet := range b.nets {
+		if ipNet.Contains(ip) {
+			return true, address
+		}
+	}
+	return false, address
+}
+
+// IPBlocklistMiddleware rejects requests from blocked client IPs with a 403
+func IPBlocklistMiddleware(blocklist *IPBlocklist) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if blocked, ip := blocklist.Blocked(r); blocked {
+				logger.Warn("Request from blocked IP denied", "remoteIP", ip, "path", r.URL.Path)
+				if r.URL.Path == "/ws" {
+					auditLogger.Log(newAuditRecord(r, "", "failure: blocked IP"))
+				}
+				writeErrorResponse(w, http.StatusForbidden, "blocked")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// loadIPBlocklist reads BLOCKED_IPS, BLOCKED_IPS_FILE and TRUST_PROXY into the global blocklist and the client IP resolution.
+// When the file cannot be read the blocked networks are left unchanged, so a reload never lifts a block by accident.
+func loadIPBlocklist() {
+	nets := parseBlockedIPs(os.Getenv("BLOCKED_IPS"))
+	if path := os.Getenv("BLOCKED_IPS_FILE"); path != "" {
+		fileNets, err := readBlockedIPsFile(path)
+		if err != nil {
+			logger.Error("Failed to read blocked IPs file, keeping the current blocklist", "path", path, "error", err)
+			nets = ipBlocklist.Networks()
+		} else {
+			nets = append(nets, fileNets...)
+		}
+	}
+	trustForwardedFor := os.Getenv("TRUST_PROXY") == "true"
+	trustProxy.Store(trustForwardedFor)
+	ipBlocklist.Set(nets, trustForwardedFor)
+	logger.Info("IP blocklist loaded", "blockedNetworks", len(nets), "trustProxy", trustForwardedFor)
+}
+
+// initIPBlocklist loads the IP blocklist and reloads it on SIGHUP, picking up changes to BLOCKED_IPS_FILE
+func initIPBlocklist() {
+	loadIPBlocklist()
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			logger.Info("SIGHUP received, reloading IP blocklist")
+			loadIPBlocklist()
+		}
+	}()
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a manually advanced clock for TokenBucket
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// newTestBucket returns a full bucket driven by the returned clock
+func newTestBucket(capacity int64, period time.Duration) (*TokenBucket, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	bucket := NewTokenBucket(capacity, period)
+	bucket.now = clock.Now
+	bucket.refilled = clock.Now()
+	return bucket, clock
+}
+
+func TestTokenBucketTake(t *testing.T) {
+	tests := []struct {
+		name     string
+		capacity int64
+		takes    []int
+		want     []bool
+		wantLeft int64
+	}{
+		{"within capacity", 100, []int{40, 60}, []bool{true, true}, 0},
+		{"more than available", 100, []int{60, 60}, []bool{true, false}, 40},
+		{"more than capacity", 100, []int{101}, []bool{false}, 100},
+		{"zero tokens", 100, []int{100, 0}, []bool{true, true}, 0},
+		{"empty bucket", 0, []int{1}, []bool{false}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket, _ := newTestBucket(tt.capacity, time.Minute)
+			for i, n := range tt.takes {
+				if got := bucket.Take(n); got != tt.want[i] {
+					t.Errorf("Take(%d) #%d = %v, want %v", n, i, got, tt.want[i])
+				}
+			}
+			if got := bucket.Available(); got != tt.wantLeft {
+				t.Errorf("Available() = %d, want %d", got, tt.wantLeft)
+			}
+		})
+	}
+}
+
+func TestTokenBucketRefill(t *testing.T) {
+	tests := []struct {
+		name     string
+		capacity int64
+		period   time.Duration
+		take     int
+		ticks    []time.Duration // Clock advance before each refill
+		want     int64
+	}{
+		{"no time elapsed", 600, time.Minute, 600, []time.Duration{0}, 0},
+		{"one second of a minute", 600, time.Minute, 600, []time.Duration{time.Second}, 10},
+		{"half the period", 600, time.Minute, 600, []time.Duration{30 * time.Second}, 300},
+		{"accumulates over ticks", 600, time.Minute, 600, []time.Duration{time.Second, time.Second, time.Second}, 30},
+		{"clamped to capacity", 600, time.Minute, 100, []time.Duration{time.Minute}, 600},
+		{"full bucket stays full", 600, time.Minute, 0, []time.Duration{time.Hour}, 600},
+		{"fractions carried across ticks", 30, time.Minute, 30, []time.Duration{time.Second, time.Second, time.Second}, 1},
+		{"fractions carried past a whole token", 30, time.Minute, 30, []time.Duration{3 * time.Second, time.Second}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket, clock := newTestBucket(tt.capacity, tt.period)
+			if !bucket.Take(tt.take) {
+				t.Fatalf("Take(%d) = false on a full bucket", tt.take)
+			}
+			for _, d := range tt.ticks {
+				clock.Advance(d)
+				bucket.refill()
+			}
+			if got := bucket.Available(); got != tt.want {
+				t.Errorf("Available() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenBucketFullDoesNotBank(t *testing.T) {
+	bucket, clock := newTestBucket(600, time.Minute)
+	// Time spent full earns nothing once the bucket is drained
+	clock.Advance(time.Hour)
+	bucket.refill()
+	bucket.Take(600)
+	clock.Advance(time.Second)
+	bucket.refill()
+	if got := bucket.Available(); got != 10 {
+		t.Errorf("Available() = %d, want 10", got)
+	}
+}
+
+func TestTokenBucketRetryAfter(t *testing.T) {
+	tests := []struct {
+		name     string
+		capacity int64
+		take     int
+		n        int
+		want     time.Duration
+	}{
+		{"tokens available", 600, 0, 600, 0},
+		{"exactly available", 600, 300, 300, 0},
+		{"empty bucket", 600, 600, 300, 30 * time.Second},
+		{"partly available", 600, 500, 200, 10 * time.Second},
+		{"more than capacity", 600, 600, 1200, 2 * time.Minute},
+		{"zero capacity", 0, 0, 10, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket, _ := newTestBucket(tt.capacity, time.Minute)
+			bucket.Take(tt.take)
+			if got := bucket.RetryAfter(tt.n); got != tt.want {
+				t.Errorf("RetryAfter(%d) = %v, want %v", tt.n, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenBucketUtilization(t *testing.T) {
+	tests := []struct {
+		name     string
+		capacity int64
+		take     int
+		want     float64
+	}{
+		{"full", 400, 0, 0},
+		{"quarter used", 400, 100, 0.25},
+		{"empty", 400, 400, 1},
+		{"zero capacity", 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket, _ := newTestBucket(tt.capacity, time.Minute)
+			bucket.Take(tt.take)
+			if got := bucket.Utilization(); got != tt.want {
+				t.Errorf("Utilization() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenBucketRun(t *testing.T) {
+	bucket, clock := newTestBucket(600, time.Minute)
+	bucket.interval = 10 * time.Millisecond
+	bucket.Take(600)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		bucket.Run(stop)
+		close(done)
+	}()
+	clock.Advance(30 * time.Second)
+	waitFor(t, "the bucket to refill", func() bool { return bucket.Available() == 300 })
+
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after stop was closed")
+	}
+	clock.Advance(30 * time.Second)
+	time.Sleep(5 * bucket.interval)
+	if got := bucket.Available(); got != 300 {
+		t.Errorf("Available() after stop = %d, want 300", got)
+	}
+}
+
+func TestIPBlocklistMiddleware(t *testing.T) {
+	tests := []struct {
+		name         string
+		blockedIPs   string
+		trustProxy   bool
+		remoteAddr   string
+		forwardedFor string
+		wantStatus   int
+	}{
+		{"empty list", "", false, "203.0.113.7:5123", "", http.StatusOK},
+		{"exact IPv4", "203.0.113.7", false, "203.0.113.7:5123", "", http.StatusForbidden},
+		{"exact IP does not cover its neighbours", "203.0.113.7", false, "203.0.113.8:5123", "", http.StatusOK},
+		{"IPv4 CIDR", "198.51.100.0/24", false, "198.51.100.42:5123", "", http.StatusForbidden},
+		{"outside the CIDR", "198.51.100.0/24", false, "198.51.101.1:5123", "", http.StatusOK},
+		{"exact IPv6", "2001:db8::1", false, "[2001:db8::1]:5123", "", http.StatusForbidden},
+		{"IPv6 CIDR", "2001:db8::/32", false, "[2001:db8:1::5]:5123", "", http.StatusForbidden},
+		{"invalid entries skipped", "not-an-ip, 10.0.0.0/33, 203.0.113.7", false, "203.0.113.7:5123", "", http.StatusForbidden},
+		{"forwarded client behind a trusted proxy", "198.51.100.0/24", true, "10.0.0.2:5123", "198.51.100.9", http.StatusForbidden},
+		{"forwarded header ignored without TRUST_PROXY", "198.51.100.0/24", false, "10.0.0.2:5123", "198.51.100.9", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocklist := &IPBlocklist{}
+			blocklist.Set(parseBlockedIPs(tt.blockedIPs), tt.trustProxy)
+			handler := IPBlocklistMiddleware(blocklist)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/api/presets", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.forwardedFor != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, r)
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestLoadIPBlocklistFromFile(t *testing.T) {
+	previous := ipBlocklist.Networks()
+	t.Cleanup(func() {
+		ipBlocklist.Set(previous, false)
+		trustProxy.Store(false)
+	})
+	path := filepath.Join(t.TempDir(), "blocked_ips")
+	t.Setenv("BLOCKED_IPS", "192.0.2.1")
+	t.Setenv("BLOCKED_IPS_FILE", path)
+	t.Setenv("TRUST_PROXY", "")
+
+	blocked := func(remoteIP string) bool {
+		r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+		r.RemoteAddr = remoteIP + ":5123"
+		isBlocked, _ := ipBlocklist.Blocked(r)
+		return isBlocked
+	}
+	// Steps run in order; each rewrites or removes the file, then reloads as SIGHUP does
+	steps := []struct {
+		name    string
+		content string // Empty removes the file
+		want    map[string]bool
+	}{
+		{"exact IPs and CIDRs with comments", "# Abusive clients\n203.0.113.7\n198.51.100.0/24 # scraper range\n2001:db8::/32, 192.0.2.99\n",
+			map[string]bool{"192.0.2.1": true, "203.0.113.7": true, "203.0.113.8": false, "198.51.100.42": true, "198.51.101.1": false, "2001:db8:1::5": true, "192.0.2.99": true}},
+		{"file edited", "203.0.113.8\nnot-an-ip\n",
+			map[string]bool{"192.0.2.1": true, "203.0.113.7": false, "203.0.113.8": true, "198.51.100.42": false}},
+		{"unreadable file keeps the current list", "",
+			map[string]bool{"192.0.2.1": true, "203.0.113.8": true, "203.0.113.7": false}},
+	}
+	for _, step := range steps {
+		if step.content == "" {
+			if err := os.Remove(path); err != nil {
+				t.Fatal(err)
+			}
+		} else if err := os.WriteFile(path, []byte(step.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		loadIPBlocklist()
+		for ip, want := range step.want {
+			if got := blocked(ip); got != want {
+				t.Errorf("%s: %s blocked = %v, want %v", step.name, ip, got, want)
+			}
+		}
+	}
+}
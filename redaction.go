@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// redactionPlaceholder replaces every PII match
+const redactionPlaceholder = "[REDACTED]"
+
+// builtinRedactionPatterns match common PII; card numbers and SSNs come before phone numbers so their digits are not partially matched
+var builtinRedactionPatterns = []*regexp.Regexp{
+	// 16-digit card numbers, optionally grouped by four with spaces or dashes
+	regexp.MustCompile(`\b(?:\d{4}[ -]?){3}\d{4}\b`),
+	// US social security numbers
+	regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`),
+	// Email addresses
+	regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	// US phone numbers, with optional +1 country code and (area code)
+	regexp.MustCompile(`(?:\+?1[ .-]?)?(?:\(\d{3}\)|\b\d{3})[ .-]?\d{3}[ .-]?\d{4}\b`),
+}
+
+// compileRedactionPatterns returns the built-in PII patterns followed by the client's custom patterns
+func compileRedactionPatterns(custom []string) ([]*regexp.Regexp, error) {
+	patterns := make([]*regexp.Regexp, 0, len(builtinRedactionPatterns)+len(custom))
+	patterns = append(patterns, builtinRedactionPatterns...)
+	for _, expr := range custom {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, &ConfigError{
+				Field:   "customRedactionPatterns",
+				Message: fmt.Sprintf("pattern %q does not compile: %v", expr, err),
+			}
+		}
+		patterns = append(patterns, re)
+	}
+	return patterns, nil
+}
+
+// redactPII replaces every match of patterns in text with [REDACTED]
+func redactPII(text string, patterns []*regexp.Regexp) string {
+	for _, re := range patterns {
+		text = re.ReplaceAllString(text, redactionPlaceholder)
+	}
+	return text
+}
+
+// redactSegment redacts the segment text and each timed word; PII spanning several words is only caught in the text
+func redactSegment(segment TranscriptionSegment, patterns []*regexp.Regexp) TranscriptionSegment {
+	segment.Text = redactPII(segment.Text, patterns)
+	if len(segment.Words) > 0 {
+		words := make([]WordTiming, len(segment.Words))
+		copy(words, segment.Words)
+		for i := range words {
+			words[i].Word = redactPII(words[i].Word, patterns)
+		}
+		segment.Words = words
+	}
+	return segment
+}
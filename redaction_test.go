@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRedactPIIBuiltinPatterns(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"no PII", "let's meet on Tuesday at 3", "let's meet on Tuesday at 3"},
+		{"email", "write to jane.doe+notes@example.co.uk today", "write to [REDACTED] today"},
+		{"SSN", "my SSN is 123-45-6789", "my SSN is [REDACTED]"},
+		{"card number", "card 4111111111111111 expires", "card [REDACTED] expires"},
+		{"grouped card number", "card 4111 1111 1111 1111 or 4111-1111-1111-1111", "card [REDACTED] or [REDACTED]"},
+		{"plain phone number", "call 555 123 4567", "call [REDACTED]"},
+		{"dotted phone number", "call 555.123.4567", "call [REDACTED]"},
+		{"phone with area code in parentheses", "call (555) 123-4567", "call [REDACTED]"},
+		{"phone with country code", "call +1 555-123-4567", "call [REDACTED]"},
+		{"several matches", "mail a@b.io or call 5551234567", "mail [REDACTED] or call [REDACTED]"},
+		{"short numbers kept", "room 1234 on floor 12", "room 1234 on floor 12"},
+		{"digits inside longer numbers kept", "order 12345678901234567890", "order 12345678901234567890"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactPII(tt.text, builtinRedactionPatterns); got != tt.want {
+				t.Errorf("redactPII(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileRedactionPatterns(t *testing.T) {
+	tests := []struct {
+		name    string
+		custom  []string
+		text    string
+		want    string
+		wantErr bool
+	}{
+		{"built-in only", nil, "mail a@b.io about Project Falcon", "mail [REDACTED] about Project Falcon", false},
+		{"custom pattern", []string{`Project \w+`}, "mail a@b.io about Project Falcon", "mail [REDACTED] about [REDACTED]", false},
+		{"case-insensitive custom pattern", []string{`(?i)\bjohn smith\b`}, "John Smith joined", "[REDACTED] joined", false},
+		{"invalid custom pattern", []string{`(unclosed`}, "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patterns, err := compileRedactionPatterns(tt.custom)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("compileRedactionPatterns(%q) error = %v, wantErr %v", tt.custom, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				var configErr *ConfigError
+				if !errors.As(err, &configErr) || configErr.Field != "customRedactionPatterns" {
+					t.Errorf("error = %#v, want a ConfigError on customRedactionPatterns", err)
+				}
+				return
+			}
+			if got := redactPII(tt.text, patterns); got != tt.want {
+				t.Errorf("redactPII(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactSegment(t *testing.T) {
+	segment := TranscriptionSegment{
+		Text:  "mail jane@example.com now",
+		Words: []WordTiming{{Word: "mail"}, {Word: "jane@example.com"}, {Word: "now"}},
+	}
+	got := redactSegment(segment, builtinRedactionPatterns)
+	if got.Text != "mail [REDACTED] now" {
+		t.Errorf("text = %q, want mail [REDACTED] now", got.Text)
+	}
+	if got.Words[1].Word != "[REDACTED]" || got.Words[0].Word != "mail" {
+		t.Errorf("words = %v, want only the email redacted", got.Words)
+	}
+	if segment.Words[1].Word != "jane@example.com" {
+		t.Error("redactSegment modified the original words")
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Middleware wraps an http.Handler with additional behavior
+type Middleware func(http.Handler) http.Handler
+
+// Router registers routes on a ServeMux with a per-route middleware chain
+type Router struct {
+	mux *http.ServeMux
+}
+
+// NewRouter creates a router backed by a new ServeMux
+func NewRouter() *Router {
+	return &Router{mux: http.NewServeMux()}
+}
+
+// Handle registers handler for pattern, wrapped by the given middleware.
+// Middleware are applied in the order they are listed: the first one is the outermost.
+func (rt *Router) Handle(pattern string, handler http.Handler, middleware ...Middleware) {
+	rt.mux.Handle(pattern, chainMiddleware(handler, middleware...))
+}
+
+// HandleFunc registers a handler function for pattern, wrapped by the given middleware
+func (rt *Router) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request), middleware ...Middleware) {
+	rt.Handle(pattern, http.HandlerFunc(handler), middleware...)
+}
+
+// ServeHTTP dispatches the request to the matching route
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.mux.ServeHTTP(w, r)
+}
+
+// chainMiddleware wraps handler so that middleware[0] runs first
+func chainMiddleware(handler http.Handler, middleware ...Middleware) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// authMiddleware requires the API_KEY from the X-API-Key header or a Bearer token; it does nothing when API_KEY is unset
+func authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiKey := os.Getenv("API_KEY")
+		if apiKey == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		provided := providedAPIKey(r)
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(apiKey)) != 1 {
+			logger.Warn("API request with invalid API key", "path", r.URL.Path, "remoteIP", clientIP(r))
+			writeErrorResponse(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// providedAPIKey returns the API key sent with r; WebSocket handshakes may carry it in the api_key query parameter
+// because browsers cannot set headers on them
+func providedAPIKey(r *http.Request) string {
+	if provided := r.Header.Get("X-API-Key"); provided != "" {
+		return provided
+	}
+	if authorization := r.Header.Get("Authorization"); authorization != "" {
+		return strings.TrimPrefix(authorization, "Bearer ")
+	}
+	if websocket.IsWebSocketUpgrade(r) {
+		return r.URL.Query().Get("api_key")
+	}
+	return ""
+}
+
+// statusRecorder captures the status code written by a handler while keeping streaming and upgrades working
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status code before writing it
+func (rec *statusRecorder) WriteHeader(code int) {
+	rec.status = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+// Flush forwards to the underlying writer so server-sent events are not buffered
+func (rec *statusRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack forwards to the underlying writer so WebSocket upgrades still work
+func (rec *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rec.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	rec.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// loggingMiddleware logs the method, path, status and duration of each request
+func loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		logger.Debug("HTTP request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"duration", time.Since(start),
+			"remoteIP", clientIP(r))
+	})
+}
+
+// corsMiddleware adds CORS headers for origins listed in CORS_ALLOWED_ORIGINS ("*" allows any origin) and answers preflight requests
+func corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || !corsOriginAllowed(origin, os.Getenv("CORS_ALLOWED_ORIGINS")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Add("Vary", "Origin")
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, X-Admin-API-Key, Last-Event-ID")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// corsOriginAllowed reports whether origin appears in the comma-separated allowed list
+func corsOriginAllowed(origin, allowed string) bool {
+	for _, candidate := range strings.Split(allowed, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.EqualFold(candidate, origin) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestRouterMiddlewareOrder(t *testing.T) {
+	var calls []string
+	record := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	tests := []struct {
+		name       string
+		middleware []Middleware
+		want       []string
+	}{
+		{"no middleware", nil, []string{"handler"}},
+		{"first listed runs first", []Middleware{record("outer"), record("inner")}, []string{"outer", "inner", "handler"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = nil
+			router := NewRouter()
+			router.HandleFunc("/api/test", func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, "handler")
+			}, tt.middleware...)
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/test", nil))
+			if !reflect.DeepEqual(calls, tt.want) {
+				t.Errorf("calls = %v, want %v", calls, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	websocketHeaders := map[string]string{"Connection": "Upgrade", "Upgrade": "websocket"}
+	tests := []struct {
+		name       string
+		apiKey     string
+		target     string
+		headers    map[string]string
+		wantStatus int
+	}{
+		{"open without API_KEY", "", "/api/presets", nil, http.StatusOK},
+		{"missing key", "secret", "/api/presets", nil, http.StatusUnauthorized},
+		{"X-API-Key header", "secret", "/api/presets", map[string]string{"X-API-Key": "secret"}, http.StatusOK},
+		{"bearer token", "secret", "/api/presets", map[string]string{"Authorization": "Bearer secret"}, http.StatusOK},
+		{"wrong key", "secret", "/api/presets", map[string]string{"X-API-Key": "guess"}, http.StatusUnauthorized},
+		{"query key on WebSocket handshake", "secret", "/ws?api_key=secret", websocketHeaders, http.StatusOK},
+		{"query key ignored on API requests", "secret", "/api/presets?api_key=secret", nil, http.StatusUnauthorized},
+		{"WebSocket handshake without key", "secret", "/ws", websocketHeaders, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("API_KEY", tt.apiKey)
+			handler := authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, r)
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// BM25 ranking parameters
+const (
+	bm25K1 = 1.2  // Term frequency saturation
+	bm25B  = 0.75 // Document length normalization
+)
+
+// bm25Document holds the term statistics of one session transcript
+type bm25Document struct {
+	sessionID  string
+	createdAt  time.Time
+	transcript string
+	termFreqs  map[string]int
+	length     int
+	indexedAt  time.Time // Modification time of the transcript file when it was indexed
+}
+
+// BM25Index ranks finalized session transcripts against keyword queries.
+// Sessions are indexed the first time a search sees them and re-indexed when their transcript file changes.
+type BM25Index struct {
+	mu   sync.Mutex
+	docs map[string]*bm25Document
+}
+
+// searchIndex is the server-wide transcript search index
+var searchIndex = NewBM25Index()
+
+// NewBM25Index creates an empty index
+func NewBM25Index() *BM25Index {
+	return &BM25Index{docs: make(map[string]*bm25Document)}
+}
+
+// newBM25Document computes the term frequencies of a transcript
+func newBM25Document(sessionID string, createdAt time.Time, transcript string) *bm25Document {
+	doc := &bm25Document{
+		sessionID:  sessionID,
+		createdAt:  createdAt,
+		transcript: transcript,
+		termFreqs:  make(map[string]int),
+	}
+	for _, token := range tokenizeWords(transcript) {
+		doc.termFreqs[token]++
+		doc.length++
+	}
+	return doc
+}
+
+// Add indexes or replaces a session transcript
+func (idx *BM25Index) Add(doc *bm25Document) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.docs[doc.sessionID] = doc
+}
+
+// Search returns the sessions containing every query term, highest BM25 score first
+func (idx *BM25Index) Search(query string, limit int) []SearchHit {
+	terms := uniqueTerms(tokenizeWords(query))
+	if len(terms) == 0 {
+		return []SearchHit{}
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	docCount := float64(len(idx.docs))
+	totalLength := 0
+	docFreqs := make(map[string]int, len(terms))
+	for _, doc := range idx.docs {
+		totalLength += doc.length
+		for _, term := range terms {
+			if doc.termFreqs[term] > 0 {
+				docFreqs[term]++
+			}
+		}
+	}
+	if totalLength == 0 {
+		return []SearchHit{}
+	}
+	avgLength := float64(totalLength) / docCount
+
+	hits := []SearchHit{}
+documents:
+	for _, doc := range idx.docs {
+		score := 0.0
+		for _, term := range terms {
+			tf := float64(doc.termFreqs[term])
+			if tf == 0 {
+				continue documents // All terms must be present
+			}
+			score += bm25IDF(docCount, float64(docFreqs[term])) * bm25TermScore(tf, float64(doc.length), avgLength)
+		}
+		hits = append(hits, SearchHit{
+			SessionID: doc.sessionID,
+			CreatedAt: doc.createdAt,
+			Score:     score,
+			Snippet:   searchSnippet(doc.transcript, terms[0]),
+		})
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].SessionID < hits[j].SessionID
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
+
+// bm25IDF is the inverse document frequency of a term found in docFreq of docCount documents; it is always positive
+func bm25IDF(docCount, docFreq float64) float64 {
+	return math.Log(1 + (docCount-docFreq+0.5)/(docFreq+0.5))
+}
+
+// bm25TermScore weighs a term frequency by the document length relative to the average
+func bm25TermScore(termFreq, docLength, avgLength float64) float64 {
+	return termFreq * (bm25K1 + 1) / (termFreq + bm25K1*(1-bm25B+bm25B*docLength/avgLength))
+}
+
+// uniqueTerms drops repeated query terms, keeping their first occurrence
+func uniqueTerms(terms []string) []string {
+	seen := make(map[string]bool, len(terms))
+	var unique []string
+	for _, term := range terms {
+		if !seen[term] {
+			seen[term] = true
+			unique = append(unique, term)
+		}
+	}
+	return unique
+}
+
+// searchSnippet returns the text around the first case-insensitive occurrence of term
+func searchSnippet(transcript, term string) string {
+	const snippetContext = 80
+	position := strings.Index(strings.ToLower(transcript), term)
+	if position < 0 {
+		return truncateRunes(transcript, 2*snippetContext)
+	}
+	position = min(position, len(transcript))
+	start, end := max(0, position-snippetContext), min(len(transcript), position+len(term)+snippetContext)
+	for start > 0 && !utf8.RuneStart(transcript[start]) {
+		start--
+	}
+	for end < len(transcript) && !utf8.RuneStart(transcript[end]) {
+		end++
+	}
+
+	snippet := strings.TrimSpace(transcript[start:end])
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(transcript) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+// refreshPersisted indexes persisted sessions not seen yet or whose transcript changed since they were indexed
+func (idx *BM25Index) refreshPersisted() error {
+	dir := getTranscriptDirectory()
+	if dir == "" {
+		return nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.meta.json"))
+	if err != nil {
+		return err
+	}
+	present := make(map[string]bool, len(files))
+	for _, file := range files {
+		sessionID := strings.TrimSuffix(filepath.Base(file), ".meta.json")
+		if _, live := sessionRegistry.Get(sessionID); live {
+			continue // Only finalized sessions are searchable
+		}
+		present[sessionID] = true
+
+		var modTime time.Time
+		if info, err := os.Stat(sessionFilePath(dir, sessionID, ".jsonl")); err == nil {
+			modTime = info.ModTime()
+		}
+		idx.mu.Lock()
+		doc, indexed := idx.docs[sessionID]
+		idx.mu.Unlock()
+		if indexed && doc.indexedAt.Equal(modTime) {
+			continue
+		}
+
+		archive, err := loadPersistedSession(sessionID)
+		if err != nil {
+			logger.Warn("Skipping unreadable session in search index", "sessionID", sessionID, "error", err)
+			continue
+		}
+		doc = newBM25Document(sessionID, archive.Metadata.CreatedAt, archive.Transcript)
+		doc.indexedAt = modTime
+		idx.Add(doc)
+	}
+
+	// Forget sessions whose files were removed
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for sessionID := range idx.docs {
+		if !present[sessionID] {
+			delete(idx.docs, sessionID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBM25IndexSearch(t *testing.T) {
+	idx := NewBM25Index()
+	idx.Add(newBM25Document("a", time.Time{}, "The cat sat on the mat."))
+	idx.Add(newBM25Document("b", time.Time{}, "The dog chased the cat, cat!"))
+	idx.Add(newBM25Document("c", time.Time{}, "Dogs and birds"))
+
+	// Average length 5, N = 3: "cat" has idf ln(1 + 1.5/2.5), "dog" ln(1 + 2.5/1.5)
+	tests := []struct {
+		name   string
+		query  string
+		limit  int
+		want   []string
+		scores []float64
+	}{
+		{"single term ranked by frequency", "cat", 0, []string{"b", "a"}, []float64{0.611846, 0.434457}},
+		{"query is case and punctuation insensitive", "CAT?", 0, []string{"b", "a"}, []float64{0.611846, 0.434457}},
+		{"all terms must be present", "cat dog", 0, []string{"b"}, []float64{1.518488}},
+		{"repeated terms count once", "dog dog cat", 0, []string{"b"}, []float64{1.518488}},
+		{"no match", "fish", 0, []string{}, nil},
+		{"limit", "cat", 1, []string{"b"}, []float64{0.611846}},
+		{"empty query", "  ", 0, []string{}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits := idx.Search(tt.query, tt.limit)
+			if len(hits) != len(tt.want) {
+				t.Fatalf("Search(%q) = %+v, want sessions %v", tt.query, hits, tt.want)
+			}
+			for i, hit := range hits {
+				if hit.SessionID != tt.want[i] {
+					t.Errorf("hit %d = %s, want %s", i, hit.SessionID, tt.want[i])
+				}
+				if math.Abs(hit.Score-tt.scores[i]) > 1e-5 {
+					t.Errorf("hit %d score = %f, want %f", i, hit.Score, tt.scores[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBM25IndexShorterDocumentsRankHigher(t *testing.T) {
+	idx := NewBM25Index()
+	idx.Add(newBM25Document("long", time.Time{}, "budget review with many other words about planning and hiring"))
+	idx.Add(newBM25Document("short", time.Time{}, "budget review"))
+	hits := idx.Search("budget", 0)
+	if len(hits) != 2 || hits[0].SessionID != "short" {
+		t.Errorf("Search(budget) = %+v, want the shorter transcript first", hits)
+	}
+}
+
+func TestBM25IDF(t *testing.T) {
+	tests := []struct {
+		docCount, docFreq float64
+	}{
+		{1, 1},
+		{10, 10},
+		{10, 1},
+		{1000, 999},
+	}
+	for _, tt := range tests {
+		if got := bm25IDF(tt.docCount, tt.docFreq); got <= 0 {
+			t.Errorf("bm25IDF(%v, %v) = %v, want positive", tt.docCount, tt.docFreq, got)
+		}
+	}
+	if bm25IDF(10, 1) <= bm25IDF(10, 5) {
+		t.Error("rare terms should weigh more than common ones")
+	}
+}
+
+func TestSearchSnippet(t *testing.T) {
+	long := strings.Repeat("filler ", 30) + "needle" + strings.Repeat(" tail", 30)
+	tests := []struct {
+		name       string
+		transcript string
+		term       string
+		want       string
+	}{
+		{"short transcript", "find the needle here", "needle", "find the needle here"},
+		{"case insensitive", "Find the Needle", "needle", "Find the Needle"},
+		{"missing term falls back to the start", "nothing to see", "needle", "nothing to see"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := searchSnippet(tt.transcript, tt.term); got != tt.want {
+				t.Errorf("searchSnippet() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	snippet := searchSnippet(long, "needle")
+	if len(snippet) > 200 || !strings.HasPrefix(snippet, "…") || !strings.HasSuffix(snippet, "…") || !strings.Contains(snippet, "needle") {
+		t.Errorf("searchSnippet(long) = %q, want an elided window around the match", snippet)
+	}
+}
@@ -0,0 +1,850 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1"
+)
+
+// Session holds the server-side state of a single WebSocket transcription session
+type Session struct {
+	ID        string
+	CreatedAt time.Time
+	Client    ClientMetadata
+
+	cancel context.CancelFunc
+
+	mu              sync.Mutex
+	languageStreams map[string]speechpb.Speech_StreamingRecognizeClient // Per-language streams in multi-language mode
+	config          ConfigMessage
+	lastHeartbeat   time.Time
+	segments        []TranscriptionSegment
+	transcript      strings.Builder
+	newTranscript   strings.Builder // Final text received since the last summary
+	boundaries      []int           // Indexes of the segments preceded by a segment boundary marker
+	summarized      int             // Number of segments whose text was handed to a summary
+	chapters        []Chapter
+	keywords        []KeywordEntry
+	summary         string
+	audioChunks     int64
+	keepalivesSent  int64
+	modelFallbacks  int64
+	genAITokens     int64 // GenAI tokens used by the session's summaries and punctuation
+	genAIExhausted  bool  // Whether genAITokens reached the session's budget
+	wordFreqCache   []WordFreq
+	wordFreqAt      time.Time
+	events          []SessionEvent
+	consentAt       *time.Time
+	tags            []string
+	send            func(v interface{}) error
+	disconnect      func() // Unblocks the handler's read of the client connection
+	timestampFormat string
+	lastSummaryID   int64 // SummaryID of the newest summary delivered to the client
+}
+
+// newSession creates a new session with a random identifier
+func newSession(cancel context.CancelFunc, config ConfigMessage) *Session {
+	return &Session{
+		ID:              newSessionID(),
+		CreatedAt:       time.Now(),
+		cancel:          cancel,
+		languageStreams: make(map[string]speechpb.Speech_StreamingRecognizeClient),
+		config:          config,
+		lastHeartbeat:   time.Now(),
+	}
+}
+
+// newClientMetadata extracts client information from the WebSocket upgrade request
+func newClientMetadata(r *http.Request) ClientMetadata {
+	return ClientMetadata{
+		UserAgent:      r.Header.Get("User-Agent"),
+		RemoteIP:       clientIP(r),
+		AcceptLanguage: r.Header.Get("Accept-Language"),
+		ConnectedAt:    time.Now(),
+	}
+}
+
+// trustProxy is whether the server runs behind a proxy that sets X-Forwarded-For (TRUST_PROXY); set by loadIPBlocklist
+var trustProxy atomic.Bool
+
+// clientIP returns the originating client IP: the first X-Forwarded-For entry behind a trusted proxy,
+// the peer address otherwise, since any client can send the header
+func clientIP(r *http.Request) string {
+	return requestIP(r, trustProxy.Load())
+}
+
+// requestIP returns the peer address of r, or the first X-Forwarded-For entry when trustForwardedFor is set
+func requestIP(r *http.Request, trustForwardedFor bool) string {
+	if trustForwardedFor {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// preferredLanguage returns the highest priority language tag of an Accept-Language header
+func preferredLanguage(acceptLanguage string) string {
+	first := strings.Split(acceptLanguage, ",")[0]
+	return strings.TrimSpace(strings.Split(first, ";")[0])
+}
+
+// newSessionID generates a random hexadecimal session identifier
+func newSessionID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		// Fall back to a time-based identifier if the random source fails
+		return hex.EncodeToString([]byte(time.Now().Format("150405.000000")))
+	}
+	return hex.EncodeToString(b)
+}
+
+// setLanguageStream stores the active stream for a language track
+func (s *Session) setLanguageStream(language string, stream speechpb.Speech_StreamingRecognizeClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.languageStreams[language] = stream
+}
+
+// languageStream returns the active stream for a language track
+func (s *Session) languageStream(language string) speechpb.Speech_StreamingRecognizeClient {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.languageStreams[language]
+}
+
+// allLanguageStreams returns a snapshot of all active language track streams
+func (s *Session) allLanguageStreams() map[string]speechpb.Speech_StreamingRecognizeClient {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	streams := make(map[string]speechpb.Speech_StreamingRecognizeClient, len(s.languageStreams))
+	for language, stream := range s.languageStreams {
+		streams[language] = stream
+	}
+	return streams
+}
+
+// touch records client activity on the session
+func (s *Session) touch() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastHeartbeat = time.Now()
+}
+
+// recordConsent records when the client accepted the recording consent notice
+func (s *Session) recordConsent(at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.consentAt = &at
+}
+
+// LastHeartbeat returns the time of the last client activity
+func (s *Session) LastHeartbeat() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastHeartbeat
+}
+
+// addSegment appends a final transcription segment, assigning its index
+func (s *Session) addSegment(segment TranscriptionSegment) TranscriptionSegment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	segment.Index = len(s.segments)
+	s.segments = append(s.segments, segment)
+	return segment
+}
+
+// Segments returns a copy of the session's final transcription segments
+func (s *Session) Segments() SegmentList {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	segments := make(SegmentList, len(s.segments))
+	copy(segments, s.segments)
+	return segments
+}
+
+// appendTranscript appends final text to the full transcript
+func (s *Session) appendTranscript(text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.transcript.WriteString(text + " ")
+	s.newTranscript.WriteString(text + " ")
+}
+
+// segmentBoundaryMarker separates the transcript at pauses longer than the session's end-of-speech silence
+const segmentBoundaryMarker = "\n---\n"
+
+// segmentBoundaryTracker decides where segment boundaries go. A pause of at least silence after a final result
+// makes a boundary due, and it is inserted before the next final. A pause after an interim result does not count,
+// since that utterance's final text has not arrived yet.
+type segmentBoundaryTracker struct {
+	mu           sync.Mutex
+	silence      time.Duration
+	lastResultAt time.Time
+	lastFinal    bool
+	due          bool
+}
+
+// observe records a recognition result received at now
+func (t *segmentBoundaryTracker) observe(now time.Time, isFinal bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.silence > 0 && t.lastFinal && now.Sub(t.lastResultAt) >= t.silence {
+		t.due = true
+	}
+	t.lastResultAt = now
+	t.lastFinal = isFinal
+}
+
+// take reports whether a boundary goes before the final being recorded and clears it
+func (t *segmentBoundaryTracker) take() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	due := t.due
+	t.due = false
+	return due
+}
+
+// partialSummaryTrigger decides when interim text has grown by interval words since the last partial summary.
+// The count starts over with each final result; an interval of 0 disables partial summaries.
+type partialSummaryTrigger struct {
+	mu       sync.Mutex
+	interval int
+	mark     int // Interim words covered by the last partial summary
+}
+
+// interim reports whether an interim result of text makes a partial summary due
+func (t *partialSummaryTrigger) interim(text string) bool {
+	if t.interval <= 0 {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	words := countWords(text)
+	if words-t.mark < t.interval {
+		return false
+	}
+	t.mark = words
+	return true
+}
+
+// final starts the count over for the next utterance
+func (t *partialSummaryTrigger) final() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.mark = 0
+}
+
+// defaultMinSummarySegmentWords is the minimum words of a final result triggering a summary when the client sets none
+const defaultMinSummarySegmentWords = 5
+
+// summarySegmentGate holds back summaries for final results shorter than minWords ("Yeah", "OK"). Their words are
+// counted and reported with the next final result long enough to trigger a summary; minWords of 0 disables the gate.
+type summarySegmentGate struct {
+	mu       sync.Mutex
+	minWords int
+	deferred int // Words of the short final results since the last summary trigger
+}
+
+// newSummarySegmentGate creates the gate for a session's MinSummarySegmentWords: 0 selects the default, negative disables it
+func newSummarySegmentGate(configured int) *summarySegmentGate {
+	switch {
+	case configured == 0:
+		return &summarySegmentGate{minWords: defaultMinSummarySegmentWords}
+	case configured < 0:
+		return &summarySegmentGate{}
+	default:
+		return &summarySegmentGate{minWords: configured}
+	}
+}
+
+// final reports whether a final result of text triggers a summary and, when it does, the words of the
+// short results deferred before it
+func (g *summarySegmentGate) final(text string) (trigger bool, deferredWords int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if words := countWords(text); words < g.minWords {
+		g.deferred += words
+		return false, 0
+	}
+	deferredWords, g.deferred = g.deferred, 0
+	return true, deferredWords
+}
+
+// withDeferredWords notes in the new transcript of a summary how many of its words come from short results
+// that did not trigger a summary of their own
+func withDeferredWords(newTranscript string, deferredWords int) string {
+	if deferredWords <= 0 {
+		return newTranscript
+	}
+	return fmt.Sprintf("%s\n\n(Includes %d words from short remarks held back from earlier summaries.)", newTranscript, deferredWords)
+}
+
+// markSegmentBoundary appends a segment boundary marker to the transcript, unless it is empty or already ends with one
+func (s *Session) markSegmentBoundary() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if strings.TrimSpace(s.transcript.String()) == "" || strings.HasSuffix(s.transcript.String(), segmentBoundaryMarker) {
+		return false
+	}
+	s.transcript.WriteString(segmentBoundaryMarker)
+	if strings.TrimSpace(s.newTranscript.String()) != "" {
+		s.newTranscript.WriteString(segmentBoundaryMarker)
+	}
+	s.boundaries = append(s.boundaries, len(s.segments))
+	return true
+}
+
+// rebuildTranscripts derives the full transcript and the text awaiting the next summary from the segments,
+// as appendTranscript and markSegmentBoundary wrote them; callers hold s.mu
+func (s *Session) rebuildTranscripts() {
+	s.transcript.Reset()
+	s.newTranscript.Reset()
+	for i, segment := range s.segments {
+		if segment.Text == "" {
+			continue
+		}
+		boundary := slices.Contains(s.boundaries, i)
+		if boundary && strings.TrimSpace(s.transcript.String()) != "" && !strings.HasSuffix(s.transcript.String(), segmentBoundaryMarker) {
+			s.transcript.WriteString(segmentBoundaryMarker)
+		}
+		s.transcript.WriteString(segment.Text + " ")
+		if i < s.summarized {
+			continue
+		}
+		if boundary && strings.TrimSpace(s.newTranscript.String()) != "" {
+			s.newTranscript.WriteString(segmentBoundaryMarker)
+		}
+		s.newTranscript.WriteString(segment.Text + " ")
+	}
+	s.wordFreqCache = nil
+}
+
+// replaceSegments swaps the segments that started before coveredUntil for a re-transcription of that audio.
+// Segments that started later are kept after the new ones. It returns every segment with its new index.
+func (s *Session) replaceSegments(coveredUntil time.Time, segments []TranscriptionSegment) []TranscriptionSegment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, segment := range s.segments {
+		if !segment.StartTime.Before(coveredUntil) {
+			segments = append(segments, segment)
+		}
+	}
+	s.segments = nil
+	s.transcript.Reset()
+	s.newTranscript.Reset()
+	s.boundaries = nil
+	s.summarized = 0
+	s.wordFreqCache = nil
+	for i := range segments {
+		segments[i].Index = i
+		s.segments = append(s.segments, segments[i])
+		s.transcript.WriteString(segments[i].Text + " ")
+		s.newTranscript.WriteString(segments[i].Text + " ")
+	}
+	return segments
+}
+
+// setTimestampFormat selects the format of the timestamps in the messages sent to the client
+func (s *Session) setTimestampFormat(format string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timestampFormat = format
+}
+
+// Timestamp wraps t for a message to the client, in the session's timestamp format
+func (s *Session) Timestamp(t time.Time) Timestamp {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Timestamp{Time: t, Format: s.timestampFormat, SessionStart: s.CreatedAt}
+}
+
+// markSummaryDelivered records that the summary with the given ID reached the client
+func (s *Session) markSummaryDelivered(id int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastSummaryID = max(s.lastSummaryID, id)
+}
+
+// summarySuperseded reports whether a summary newer than id already reached the client
+func (s *Session) summarySuperseded(id int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return id < s.lastSummaryID
+}
+
+// NewTranscript returns the final text received since the last summary
+func (s *Session) NewTranscript() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return strings.TrimSpace(s.newTranscript.String())
+}
+
+// clearNewTranscript clears the text tracked since the last summary
+func (s *Session) clearNewTranscript() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.newTranscript.Reset()
+	s.summarized = len(s.segments)
+}
+
+// incrementAudioChunks counts a received audio chunk, returning the new total
+func (s *Session) incrementAudioChunks() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.audioChunks++
+	return s.audioChunks
+}
+
+// incrementKeepalives counts a keepalive sent on the session's Speech-to-Text stream
+func (s *Session) incrementKeepalives() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keepalivesSent++
+}
+
+// incrementModelFallbacks counts a summary switched to the Gemini fallback model
+func (s *Session) incrementModelFallbacks() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.modelFallbacks++
+}
+
+// chargeGenAITokens adds tokens to the session's GenAI usage and returns the new total. exhausted is true only
+// for the charge that reaches budget; a budget of 0 or less is unlimited.
+func (s *Session) chargeGenAITokens(tokens, budget int64) (used int64, exhausted bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.genAITokens += tokens
+	if budget <= 0 || s.genAITokens < budget || s.genAIExhausted {
+		return s.genAITokens, false
+	}
+	s.genAIExhausted = true
+	return s.genAITokens, true
+}
+
+// GenAIBudgetExhausted reports whether the session spent its GenAI token budget
+func (s *Session) GenAIBudgetExhausted() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.genAIExhausted
+}
+
+// setSender registers the function used to push messages to the session's client
+func (s *Session) setSender(send func(v interface{}) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.send = send
+}
+
+// setDisconnect registers the function that unblocks the handler reading from the session's client
+func (s *Session) setDisconnect(disconnect func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.disconnect = disconnect
+}
+
+// Send pushes a message to the session's WebSocket client
+func (s *Session) Send(v interface{}) error {
+	s.mu.Lock()
+	send := s.send
+	s.mu.Unlock()
+	if send == nil {
+		return fmt.Errorf("session %s has no connected client", s.ID)
+	}
+	return send(v)
+}
+
+// Reset clears the accumulated transcript, segments, chapters, summary and counters, including the GenAI
+// token usage. The Speech-to-Text stream is left untouched so no audio is lost.
+func (s *Session) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.transcript.Reset()
+	s.newTranscript.Reset()
+	s.segments = nil
+	s.boundaries = nil
+	s.summarized = 0
+	s.chapters = nil
+	s.summary = ""
+	s.audioChunks = 0
+	s.genAITokens = 0
+	s.genAIExhausted = false
+	s.wordFreqCache = nil
+}
+
+// Transcript returns the full transcript
+func (s *Session) Transcript() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return strings.TrimSpace(s.transcript.String())
+}
+
+// correctTranscript replaces the last occurrence of original in the segments, possibly spanning several of them,
+// and derives the full transcript and the text awaiting the next summary from them again. It returns the
+// replacement count and the changed segments, which are the record of the correction.
+func (s *Session) correctTranscript(original, corrected string) (replacedCount int, changed []TranscriptionSegment) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	indexes := correctSegments(s.segments, original, corrected)
+	if len(indexes) == 0 {
+		return 0, nil
+	}
+	s.rebuildTranscripts()
+	for _, index := range indexes {
+		changed = append(changed, s.segments[index])
+	}
+	return 1, changed
+}
+
+// retranscribeSegment replaces the text of a segment and its last occurrence in the full transcript,
+// returning the previous text and the updated segment; ok is false when the index is out of range
+func (s *Session) retranscribeSegment(index int, text string) (original string, segment TranscriptionSegment, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if index < 0 || index >= len(s.segments) {
+		return "", TranscriptionSegment{}, false
+	}
+	original = s.segments[index].Text
+	s.segments[index].Text = text
+	s.segments[index].Words = nil // Word timings belong to the replaced text
+	if correctedTranscript, replacedCount := replaceLastOccurrence(s.transcript.String(), original, text); replacedCount > 0 {
+		s.transcript.Reset()
+		s.transcript.WriteString(correctedTranscript)
+	}
+	s.wordFreqCache = nil
+	return original, s.segments[index], true
+}
+
+// punctuateSegment replaces the text of a segment with a re-punctuated version, keeping its word timings.
+// ok is false when the segment no longer holds previous, e.g. because it was re-transcribed in the meantime.
+func (s *Session) punctuateSegment(index int, previous, text string) (segment TranscriptionSegment, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if index < 0 || index >= len(s.segments) || s.segments[index].Text != previous {
+		return TranscriptionSegment{}, false
+	}
+	s.segments[index].Text = text
+	if correctedTranscript, replacedCount := replaceLastOccurrence(s.transcript.String(), previous, text); replacedCount > 0 {
+		s.transcript.Reset()
+		s.transcript.WriteString(correctedTranscript)
+	}
+	s.wordFreqCache = nil
+	return s.segments[index], true
+}
+
+// addChapter records a chapter marker at the current end of the transcript
+func (s *Session) addChapter(title string, timestamp time.Time) Chapter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	chapter := Chapter{
+		Title:      title,
+		CharOffset: s.transcript.Len(),
+		Timestamp:  timestamp,
+	}
+	s.chapters = append(s.chapters, chapter)
+	return chapter
+}
+
+// addKeywords records keywords added during the session at the dynamic keyword boost
+func (s *Session) addKeywords(words []string, addedAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, word := range words {
+		s.keywords = append(s.keywords, KeywordEntry{
+			Word:         word,
+			AddedAt:      addedAt,
+			InitialBoost: dynamicKeywordBoost,
+			CurrentBoost: dynamicKeywordBoost,
+		})
+	}
+}
+
+// decayKeywordBoosts recomputes each keyword's boost for its age at now and returns the updated keywords
+func (s *Session) decayKeywordBoosts(ratePerMinute float32, now time.Time) []KeywordEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.keywords {
+		s.keywords[i].CurrentBoost = decayedBoost(s.keywords[i].InitialBoost, ratePerMinute, now.Sub(s.keywords[i].AddedAt))
+	}
+	keywords := make([]KeywordEntry, len(s.keywords))
+	copy(keywords, s.keywords)
+	return keywords
+}
+
+// Keywords returns a copy of the keywords added during the session
+func (s *Session) Keywords() []KeywordEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keywords := make([]KeywordEntry, len(s.keywords))
+	copy(keywords, s.keywords)
+	return keywords
+}
+
+// Chapters returns a copy of the session's chapter markers
+func (s *Session) Chapters() []Chapter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	chapters := make([]Chapter, len(s.chapters))
+	copy(chapters, s.chapters)
+	return chapters
+}
+
+// recordEvent appends an event to the session event log and persists it
+func (s *Session) recordEvent(eventType string, details map[string]interface{}) {
+	event := SessionEvent{
+		EventType: eventType,
+		Details:   details,
+		Timestamp: time.Now(),
+	}
+
+	s.mu.Lock()
+	s.events = append(s.events, event)
+	s.mu.Unlock()
+
+	if err := appendSessionEvent(s.ID, event); err != nil {
+		logger.Error("Failed to persist session event", "sessionID", s.ID, "eventType", eventType, "error", err)
+	}
+}
+
+// EventLog returns a copy of the session event log
+func (s *Session) EventLog() []SessionEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events := make([]SessionEvent, len(s.events))
+	copy(events, s.events)
+	return events
+}
+
+// wordFrequencyCacheTTL is how long a computed word frequency list is reused
+const wordFrequencyCacheTTL = 5 * time.Second
+
+// WordFrequencies returns the transcript word frequencies, recomputed at most every wordFrequencyCacheTTL
+func (s *Session) WordFrequencies() []WordFreq {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.wordFreqCache != nil && time.Since(s.wordFreqAt) < wordFrequencyCacheTTL {
+		return s.wordFreqCache
+	}
+	tokens := removeStopWords(tokenizeWords(s.transcript.String()), getStopWords())
+	s.wordFreqCache = computeWordFrequencies(tokens)
+	s.wordFreqAt = time.Now()
+	return s.wordFreqCache
+}
+
+// setSummary records the latest summary
+func (s *Session) setSummary(summary string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.summary = summary
+}
+
+// recordSummary stores the latest summary and persists it when persistence is enabled
+func (s *Session) recordSummary(summary string) {
+	s.setSummary(summary)
+	if err := writeSessionSummary(s.ID, summary); err != nil {
+		logger.Error("Failed to persist session summary", "sessionID", s.ID, "error", err)
+	}
+	if err := appendTranscriptRecord(s.ID, TranscriptRecord{Type: "summary", Timestamp: time.Now(), Text: summary}); err != nil {
+		logger.Error("Failed to persist summary record", "sessionID", s.ID, "error", err)
+	}
+}
+
+// Summary returns the latest summary
+func (s *Session) Summary() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.summary
+}
+
+// Metadata returns the session metadata
+func (s *Session) Metadata() SessionMetadata {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return SessionMetadata{
+		SessionID:                s.ID,
+		CreatedAt:                s.CreatedAt,
+		LanguageCode:             s.config.LanguageCode,
+		AlternativeLanguageCodes: s.config.AlternativeLanguageCodes,
+		AudioFormat:              s.config.AudioFormat,
+		SegmentCount:             len(s.segments),
+	}
+}
+
+// Info returns the public description of the session
+func (s *Session) Info() SessionInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return SessionInfo{
+		SessionID:        s.ID,
+		CreatedAt:        s.CreatedAt,
+		LanguageCode:     s.config.LanguageCode,
+		SegmentCount:     len(s.segments),
+		Client:           s.Client,
+		LastHeartbeat:    s.lastHeartbeat,
+		ConsentTimestamp: s.consentAt,
+		Tags:             append([]string(nil), s.tags...),
+		KeepalivesSent:   s.keepalivesSent,
+		FallbackCount:    s.modelFallbacks,
+	}
+}
+
+// Tags returns a copy of the session tags
+func (s *Session) Tags() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.tags...)
+}
+
+// SetTags replaces the session tags
+func (s *Session) SetTags(tags []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tags = append([]string(nil), tags...)
+}
+
+// HasTag reports whether the session is tagged with tag, ignoring case
+func (s *Session) HasTag(tag string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Archive returns a snapshot of the session suitable for export
+func (s *Session) Archive() *SessionArchive {
+	return &SessionArchive{
+		Metadata:   s.Metadata(),
+		Segments:   s.Segments(),
+		Transcript: s.Transcript(),
+		Chapters:   s.Chapters(),
+		Summary:    s.Summary(),
+	}
+}
+
+// SessionRegistry tracks all active sessions on the server
+type SessionRegistry struct {
+	mu       sync.RWMutex
+	sessions map[string]*Session
+}
+
+// Global session registry
+var sessionRegistry = NewSessionRegistry()
+
+// NewSessionRegistry creates an empty session registry
+func NewSessionRegistry() *SessionRegistry {
+	return &SessionRegistry{
+		sessions: make(map[string]*Session),
+	}
+}
+
+// Register adds a session to the registry
+func (r *SessionRegistry) Register(s *Session) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sessions[s.ID] = s
+}
+
+// Unregister removes a session from the registry
+func (r *SessionRegistry) Unregister(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sessions, id)
+}
+
+// Get returns the session with the given identifier
+func (r *SessionRegistry) Get(id string) (*Session, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s, ok := r.sessions[id]
+	return s, ok
+}
+
+// List returns a snapshot of all registered sessions
+func (r *SessionRegistry) List() []*Session {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]*Session, 0, len(r.sessions))
+	for _, s := range r.sessions {
+		list = append(list, s)
+	}
+	return list
+}
+
+// removeStale unregisters, cancels and disconnects sessions without activity since the timeout, returning how many
+// were removed
+func (r *SessionRegistry) removeStale(timeout time.Duration) int {
+	cutoff := time.Now().Add(-timeout)
+	var stale []*Session
+
+	r.mu.Lock()
+	for id, s := range r.sessions {
+		if s.LastHeartbeat().Before(cutoff) {
+			stale = append(stale, s)
+			delete(r.sessions, id)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, s := range stale {
+		logger.Warn("Removed stale session",
+			"sessionID", s.ID,
+			"lastHeartbeat", s.LastHeartbeat(),
+			"timeout", timeout)
+		if s.cancel != nil {
+			s.cancel()
+		}
+		// Cancelling alone leaves the handler blocked reading from a client that went silent
+		s.mu.Lock()
+		disconnect := s.disconnect
+		s.mu.Unlock()
+		if disconnect != nil {
+			disconnect()
+		}
+	}
+	return len(stale)
+}
+
+// RunCleanup periodically removes stale sessions until stop is closed
+func (r *SessionRegistry) RunCleanup(interval, timeout time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if removed := r.removeStale(timeout); removed > 0 {
+				serverMetrics.StaleSessionsRemoved.Add(int64(removed))
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// initSessionCleanup starts the background removal of sessions idle longer than SESSION_STALE_TIMEOUT
+func initSessionCleanup() {
+	timeout := getEnvDuration("SESSION_STALE_TIMEOUT", 5*time.Minute)
+	go sessionRegistry.RunCleanup(60*time.Second, timeout, make(chan struct{}))
+	logger.Info("Stale session cleanup configured", "timeout", timeout)
+}
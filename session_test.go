@@ -0,0 +1,512 @@
+package main
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestIP(t *testing.T) {
+	tests := []struct {
+		name              string
+		remoteAddr        string
+		forwardedFor      string
+		trustForwardedFor bool
+		want              string
+	}{
+		{"peer address", "203.0.113.7:5123", "", false, "203.0.113.7"},
+		{"untrusted header ignored", "203.0.113.7:5123", "198.51.100.1", false, "203.0.113.7"},
+		{"trusted header", "10.0.0.2:5123", "198.51.100.1, 10.0.0.1", true, "198.51.100.1"},
+		{"trusted without header", "10.0.0.2:5123", "", true, "10.0.0.2"},
+		{"address without port", "203.0.113.7", "", false, "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/ws", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.forwardedFor != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			if got := requestIP(r, tt.trustForwardedFor); got != tt.want {
+				t.Errorf("requestIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientIPFollowsTrustProxy(t *testing.T) {
+	t.Cleanup(func() { trustProxy.Store(false) })
+	tests := []struct {
+		trustProxy string
+		want       string
+	}{
+		{"false", "203.0.113.7"},
+		{"true", "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		t.Run("TRUST_PROXY="+tt.trustProxy, func(t *testing.T) {
+			t.Setenv("TRUST_PROXY", tt.trustProxy)
+			loadIPBlocklist()
+			r := httptest.NewRequest("GET", "/ws", nil)
+			r.RemoteAddr = "203.0.113.7:5123"
+			r.Header.Set("X-Forwarded-For", "198.51.100.1")
+			if got := clientIP(r); got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+			if blocked, address := ipBlocklist.Blocked(r); blocked || address != tt.want {
+				t.Errorf("Blocked() = %v, %q; want false, %q", blocked, address, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewClientMetadata(t *testing.T) {
+	t.Cleanup(func() { trustProxy.Store(false) })
+	tests := []struct {
+		name       string
+		trustProxy bool
+		headers    map[string]string
+		want       ClientMetadata
+	}{
+		{"browser", false, map[string]string{"User-Agent": "Mozilla/5.0", "Accept-Language": "fr-FR,fr;q=0.9", "X-Forwarded-For": "198.51.100.1"},
+			ClientMetadata{UserAgent: "Mozilla/5.0", RemoteIP: "203.0.113.7", AcceptLanguage: "fr-FR,fr;q=0.9"}},
+		{"behind a trusted proxy", true, map[string]string{"User-Agent": "desktop/1.2", "X-Forwarded-For": "198.51.100.1, 10.0.0.1"},
+			ClientMetadata{UserAgent: "desktop/1.2", RemoteIP: "198.51.100.1"}},
+		{"no headers", false, nil, ClientMetadata{RemoteIP: "203.0.113.7"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trustProxy.Store(tt.trustProxy)
+			r := httptest.NewRequest("GET", "/ws", nil)
+			r.RemoteAddr = "203.0.113.7:5123"
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			before := time.Now()
+			got := newClientMetadata(r)
+			if got.ConnectedAt.Before(before) || got.ConnectedAt.After(time.Now()) {
+				t.Errorf("ConnectedAt = %v, want the time of the call", got.ConnectedAt)
+			}
+			got.ConnectedAt = time.Time{}
+			if got != tt.want {
+				t.Errorf("newClientMetadata() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionPunctuateSegment(t *testing.T) {
+	tests := []struct {
+		name           string
+		index          int
+		previous       string
+		wantOK         bool
+		wantTranscript string
+	}{
+		{"replaces the segment", 1, "see you tomorrow", true, "hello there. See you tomorrow."},
+		{"segment changed meanwhile", 1, "see you later", false, "hello there. see you tomorrow"},
+		{"out of range", 5, "see you tomorrow", false, "hello there. see you tomorrow"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := newSession(func() {}, ConfigMessage{})
+			for _, text := range []string{"hello there.", "see you tomorrow"} {
+				session.appendTranscript(text)
+				session.addSegment(TranscriptionSegment{Text: text, Words: []WordTiming{{Word: "word"}}})
+			}
+			segment, ok := session.punctuateSegment(tt.index, tt.previous, "See you tomorrow.")
+			if ok != tt.wantOK {
+				t.Fatalf("punctuateSegment() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && (segment.Text != "See you tomorrow." || len(segment.Words) != 1) {
+				t.Errorf("segment = %q with %d words, want the new text with its word timings kept", segment.Text, len(segment.Words))
+			}
+			if got := session.Transcript(); got != tt.wantTranscript {
+				t.Errorf("Transcript() = %q, want %q", got, tt.wantTranscript)
+			}
+		})
+	}
+}
+
+func TestSessionReplaceSegments(t *testing.T) {
+	start := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	streamed := func() []TranscriptionSegment {
+		return []TranscriptionSegment{
+			{Text: "draft one", StartTime: start},
+			{Text: "draft two", StartTime: start.Add(5 * time.Second)},
+			{Text: "after the end prompt", StartTime: start.Add(20 * time.Second)},
+		}
+	}
+	tests := []struct {
+		name           string
+		coveredUntil   time.Time
+		wantTranscript string
+	}{
+		{"keeps finals for later audio", start.Add(10 * time.Second), "batch text after the end prompt"},
+		{"replaces everything covered", start.Add(time.Minute), "batch text"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := newSession(func() {}, ConfigMessage{})
+			for _, segment := range streamed() {
+				session.appendTranscript(segment.Text)
+				session.addSegment(segment)
+			}
+			segments := session.replaceSegments(tt.coveredUntil, []TranscriptionSegment{{Text: "batch text", StartTime: start}})
+			if got := session.Transcript(); got != tt.wantTranscript {
+				t.Errorf("Transcript() = %q, want %q", got, tt.wantTranscript)
+			}
+			for i, segment := range segments {
+				if segment.Index != i {
+					t.Errorf("segment %d has index %d", i, segment.Index)
+				}
+			}
+			if !reflect.DeepEqual([]TranscriptionSegment(session.Segments()), segments) {
+				t.Errorf("Segments() = %v, want %v", session.Segments(), segments)
+			}
+		})
+	}
+}
+
+func TestSegmentBoundaryTracker(t *testing.T) {
+	type result struct {
+		after   time.Duration // Since the previous result
+		isFinal bool
+	}
+	tests := []struct {
+		name    string
+		silence time.Duration
+		results []result
+		want    bool // Boundary before the last final
+	}{
+		{"pause after a final", time.Second, []result{{0, true}, {2 * time.Second, false}, {100 * time.Millisecond, true}}, true},
+		{"pause after an interim", time.Second, []result{{0, true}, {100 * time.Millisecond, false}, {2 * time.Second, true}}, false},
+		{"short pause", time.Second, []result{{0, true}, {500 * time.Millisecond, true}}, false},
+		{"disabled", 0, []result{{0, true}, {time.Hour, true}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := &segmentBoundaryTracker{silence: tt.silence}
+			now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+			var got bool
+			for _, r := range tt.results {
+				now = now.Add(r.after)
+				tracker.observe(now, r.isFinal)
+				if r.isFinal {
+					got = tracker.take()
+				}
+			}
+			if got != tt.want {
+				t.Errorf("boundary before the last final = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPartialSummaryTrigger(t *testing.T) {
+	type result struct {
+		text    string
+		isFinal bool
+	}
+	tests := []struct {
+		name     string
+		interval int
+		results  []result
+		want     []string // Interim texts that trigger a partial summary
+	}{
+		{"every interval words", 3, []result{{"so the", false}, {"so the budget", false}, {"so the budget is", false}, {"so the budget is approved for", false}},
+			[]string{"so the budget", "so the budget is approved for"}},
+		{"final starts the count over", 3, []result{{"so the budget", false}, {"so the budget is", true}, {"next we", false}, {"next we hire", false}},
+			[]string{"so the budget", "next we hire"}},
+		{"without a final the count carries on", 3, []result{{"so the budget", false}, {"next we hire", false}, {"next we hire two senior engineers", false}},
+			[]string{"so the budget", "next we hire two senior engineers"}},
+		{"disabled", 0, []result{{"so the budget is approved", false}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trigger := &partialSummaryTrigger{interval: tt.interval}
+			var got []string
+			for _, r := range tt.results {
+				if r.isFinal {
+					trigger.final()
+				} else if trigger.interim(r.text) {
+					got = append(got, r.text)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("partial summaries for %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSummarySegmentGate(t *testing.T) {
+	type trigger struct {
+		text          string
+		deferredWords int
+	}
+	tests := []struct {
+		name       string
+		configured int
+		finals     []string
+		want       []trigger // Finals that trigger a summary, with the words deferred before them
+	}{
+		{"default minimum", 0, []string{"Yeah", "OK sure", "the budget is approved for Q3"}, []trigger{{"the budget is approved for Q3", 3}}},
+		{"long results trigger directly", 0, []string{"the budget is approved for Q3", "next we hire two engineers"}, []trigger{{"the budget is approved for Q3", 0}, {"next we hire two engineers", 0}}},
+		{"count starts over after a trigger", 0, []string{"Yeah", "the budget is approved for Q3", "OK", "next we hire two engineers"}, []trigger{{"the budget is approved for Q3", 1}, {"next we hire two engineers", 1}}},
+		{"short results only", 0, []string{"Yeah", "Mm-hmm"}, nil},
+		{"configured minimum", 2, []string{"Yeah", "OK sure"}, []trigger{{"OK sure", 1}}},
+		{"negative disables", -1, []string{"Yeah", "OK"}, []trigger{{"Yeah", 0}, {"OK", 0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gate := newSummarySegmentGate(tt.configured)
+			var got []trigger
+			for _, text := range tt.finals {
+				if triggered, deferredWords := gate.final(text); triggered {
+					got = append(got, trigger{text, deferredWords})
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("summaries triggered by %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithDeferredWords(t *testing.T) {
+	if got := withDeferredWords("the budget is approved", 0); got != "the budget is approved" {
+		t.Errorf("withDeferredWords() without deferred words = %q, want the new transcript unchanged", got)
+	}
+	if got := withDeferredWords("Yeah OK the budget is approved", 2); !strings.HasPrefix(got, "Yeah OK the budget is approved\n\n") || !strings.Contains(got, "2 words") {
+		t.Errorf("withDeferredWords() = %q, want the new transcript followed by the deferred word count", got)
+	}
+}
+
+func TestMarkSegmentBoundary(t *testing.T) {
+	tests := []struct {
+		name       string
+		transcript []string
+		want       bool
+		wantText   string // Transcript() trims the trailing newline
+	}{
+		{"empty transcript", nil, false, ""},
+		{"after text", []string{"hello"}, true, "hello \n---"},
+		{"already marked", []string{"hello", segmentBoundaryMarker}, false, "hello \n---"},
+		{"text after a boundary", []string{"hello", segmentBoundaryMarker, "world"}, true, "hello \n---\nworld \n---"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := newSession(func() {}, ConfigMessage{})
+			for _, text := range tt.transcript {
+				if text == segmentBoundaryMarker {
+					session.markSegmentBoundary()
+					continue
+				}
+				session.appendTranscript(text)
+			}
+			if got := session.markSegmentBoundary(); got != tt.want {
+				t.Errorf("markSegmentBoundary() = %v, want %v", got, tt.want)
+			}
+			if got := session.Transcript(); got != tt.wantText {
+				t.Errorf("transcript = %q, want %q", got, tt.wantText)
+			}
+		})
+	}
+}
+
+func TestSessionSummarySuperseded(t *testing.T) {
+	tests := []struct {
+		name      string
+		delivered []int64
+		id        int64
+		want      bool
+	}{
+		{"nothing delivered", nil, 1, false},
+		{"newer summary", []int64{1}, 2, false},
+		{"same summary", []int64{2}, 2, false},
+		{"older summary", []int64{3}, 2, true},
+		{"out of order deliveries", []int64{4, 3}, 3, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := newSession(func() {}, ConfigMessage{})
+			for _, id := range tt.delivered {
+				session.markSummaryDelivered(id)
+			}
+			if got := session.summarySuperseded(tt.id); got != tt.want {
+				t.Errorf("summarySuperseded(%d) = %v, want %v", tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionChargeGenAITokens(t *testing.T) {
+	tests := []struct {
+		name          string
+		budget        int64
+		charges       []int64
+		wantUsed      int64
+		wantExhausted []bool // Per charge
+	}{
+		{"unlimited", 0, []int64{500, 500}, 1000, []bool{false, false}},
+		{"below the budget", 1000, []int64{400, 500}, 900, []bool{false, false}},
+		{"reaching the budget", 1000, []int64{600, 400}, 1000, []bool{false, true}},
+		{"only the first charge over the budget exhausts it", 1000, []int64{1200, 100}, 1300, []bool{true, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := newSession(func() {}, ConfigMessage{})
+			var used int64
+			for i, tokens := range tt.charges {
+				var exhausted bool
+				used, exhausted = session.chargeGenAITokens(tokens, tt.budget)
+				if exhausted != tt.wantExhausted[i] {
+					t.Errorf("charge %d exhausted = %v, want %v", i, exhausted, tt.wantExhausted[i])
+				}
+			}
+			if used != tt.wantUsed {
+				t.Errorf("used = %d, want %d", used, tt.wantUsed)
+			}
+		})
+	}
+}
+
+func TestSessionResetClearsGenAIBudget(t *testing.T) {
+	session := newSession(func() {}, ConfigMessage{})
+	session.chargeGenAITokens(1500, 1000)
+	if !session.GenAIBudgetExhausted() {
+		t.Fatal("budget not exhausted")
+	}
+	session.Reset()
+	if session.GenAIBudgetExhausted() {
+		t.Error("budget still exhausted after reset")
+	}
+	if used, exhausted := session.chargeGenAITokens(100, 1000); used != 100 || exhausted {
+		t.Errorf("chargeGenAITokens() after reset = %d, %v; want 100, false", used, exhausted)
+	}
+}
+
+func TestSessionCorrectTranscript(t *testing.T) {
+	tests := []struct {
+		name              string
+		original          string
+		corrected         string
+		want              string
+		wantCount         int
+		wantChanged       []int
+		wantSegments      []string
+		wantNewTranscript string
+	}{
+		{"corrects the latest mention", "Cuban Eddies", "Kubernetes", "we use Cuban Eddies \n---\nand Kubernetes", 1, []int{1},
+			[]string{"we use Cuban Eddies", "and Kubernetes"}, "and Kubernetes"},
+		{"corrects an already summarized segment", "we use", "we run", "we run Cuban Eddies \n---\nand Cuban eddies", 1, []int{0},
+			[]string{"we run Cuban Eddies", "and Cuban eddies"}, "and Cuban eddies"},
+		{"spans segments", "Eddies and", "Eddies, and", "we use Cuban \n---\nEddies, and Cuban eddies", 1, []int{0, 1},
+			[]string{"we use Cuban", "Eddies, and Cuban eddies"}, "Eddies, and Cuban eddies"},
+		{"unknown text", "Istio", "Envoy", "we use Cuban Eddies \n---\nand Cuban eddies", 0, nil,
+			[]string{"we use Cuban Eddies", "and Cuban eddies"}, "and Cuban eddies"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := newSession(func() {}, ConfigMessage{})
+			session.appendTranscript("we use Cuban Eddies")
+			session.addSegment(TranscriptionSegment{Text: "we use Cuban Eddies", Words: []WordTiming{{Word: "we"}, {Word: "use"}, {Word: "Cuban"}, {Word: "Eddies"}}})
+			session.clearNewTranscript()
+			session.markSegmentBoundary()
+			session.appendTranscript("and Cuban eddies")
+			session.addSegment(TranscriptionSegment{Text: "and Cuban eddies"})
+
+			count, changed := session.correctTranscript(tt.original, tt.corrected)
+			if count != tt.wantCount {
+				t.Errorf("correctTranscript() = %d, want %d", count, tt.wantCount)
+			}
+			var changedIndexes []int
+			for _, segment := range changed {
+				changedIndexes = append(changedIndexes, segment.Index)
+				if segment.Words != nil {
+					t.Errorf("corrected segment %d kept word timings %+v", segment.Index, segment.Words)
+				}
+			}
+			if !reflect.DeepEqual(changedIndexes, tt.wantChanged) {
+				t.Errorf("changed segments = %v, want %v", changedIndexes, tt.wantChanged)
+			}
+			if got := session.Transcript(); got != tt.want {
+				t.Errorf("transcript = %q, want %q", got, tt.want)
+			}
+			var texts []string
+			for _, segment := range session.Segments() {
+				texts = append(texts, segment.Text)
+			}
+			if !reflect.DeepEqual(texts, tt.wantSegments) {
+				t.Errorf("segments = %q, want %q", texts, tt.wantSegments)
+			}
+			if got := session.NewTranscript(); got != tt.wantNewTranscript {
+				t.Errorf("new transcript = %q, want %q", got, tt.wantNewTranscript)
+			}
+		})
+	}
+}
+
+func TestSessionAddChapter(t *testing.T) {
+	session := newSession(func() {}, ConfigMessage{})
+	at := time.Date(2026, 3, 2, 9, 30, 0, 0, time.UTC)
+
+	intro := session.addChapter("Intro", at)
+	session.appendTranscript("welcome everyone")
+	before := time.Now()
+	budget := session.addChapter("Budget", time.Time{})
+	session.appendTranscript("budget review")
+
+	if want := (Chapter{Title: "Intro", CharOffset: 0, Timestamp: at}); intro != want {
+		t.Errorf("first chapter = %+v, want %+v", intro, want)
+	}
+	if budget.Title != "Budget" || budget.CharOffset != len("welcome everyone ") {
+		t.Errorf("second chapter = %+v, want Budget at offset %d", budget, len("welcome everyone "))
+	}
+	if budget.Timestamp.Before(before) {
+		t.Errorf("zero timestamp not replaced by the current time: %v", budget.Timestamp)
+	}
+	if got := session.Chapters(); !reflect.DeepEqual(got, []Chapter{intro, budget}) {
+		t.Errorf("Chapters() = %+v, want %+v", got, []Chapter{intro, budget})
+	}
+	session.Chapters()[0].Title = "changed"
+	if got := session.Chapters()[0].Title; got != "Intro" {
+		t.Errorf("Chapters() returned the session's slice: title = %q", got)
+	}
+}
+
+func TestSessionRegistryRemoveStale(t *testing.T) {
+	registry := NewSessionRegistry()
+	newRegistered := func(idle time.Duration) (*Session, *bool) {
+		cancelled := new(bool)
+		session := newSession(func() { *cancelled = true }, ConfigMessage{})
+		session.lastHeartbeat = time.Now().Add(-idle)
+		registry.Register(session)
+		return session, cancelled
+	}
+	active, activeCancelled := newRegistered(time.Second)
+	stale, staleCancelled := newRegistered(10 * time.Minute)
+	idle, idleCancelled := newRegistered(6 * time.Minute)
+	idle.touch()
+
+	if removed := registry.removeStale(5 * time.Minute); removed != 1 {
+		t.Errorf("removeStale() = %d, want 1", removed)
+	}
+	if _, ok := registry.Get(stale.ID); ok || !*staleCancelled {
+		t.Errorf("stale session: registered = %v, cancelled = %v, want removed and cancelled", ok, *staleCancelled)
+	}
+	for name, s := range map[string]*Session{"active": active, "touched": idle} {
+		if _, ok := registry.Get(s.ID); !ok {
+			t.Errorf("%s session removed", name)
+		}
+	}
+	if *activeCancelled || *idleCancelled {
+		t.Error("a live session was cancelled")
+	}
+	if removed := registry.removeStale(5 * time.Minute); removed != 0 {
+		t.Errorf("second removeStale() = %d, want 0", removed)
+	}
+}
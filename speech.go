@@ -1,16 +1,301 @@
 package main
 
 import (
+	"fmt"
+	"os"
 	"strings"
 	"sync"
+	"time"
+	"unicode/utf8"
 
 	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-// Global variables for dynamic keyword management
-var keywordsMu sync.Mutex
-var currentSpeechContexts []*speechpb.SpeechContext
-var dynamicKeywords []string
+// speechAPIVersion is the Speech-to-Text API version used by the streaming client
+const speechAPIVersion = "v1"
+
+// autoDetectLanguageModel is the model that supports the "auto" language code
+const autoDetectLanguageModel = "chirp_2"
+
+// minScaledBoost is the boost auto-scaled contexts reach once the transcript has BOOST_SCALE_WORDS words
+const minScaledBoost = 5.0
+
+// scaleBoost lowers a configured boost linearly to 5.0 as the transcript grows to BOOST_SCALE_WORDS words (default 500).
+// Boosts already at or below 5.0 are left unchanged.
+func scaleBoost(configured float32, wordCount int) float32 {
+	if configured <= minScaledBoost {
+		return configured
+	}
+	scaleWords := getEnvInt64("BOOST_SCALE_WORDS", 500)
+	if scaleWords <= 0 || int64(wordCount) >= scaleWords {
+		return minScaledBoost
+	}
+	if wordCount <= 0 {
+		return configured
+	}
+	return configured - (configured-minScaledBoost)*float32(wordCount)/float32(scaleWords)
+}
+
+// maxSpeechContextBoost is the highest boost documented by the Speech API
+const maxSpeechContextBoost float32 = 20.0
+
+// clampBoost limits a boost to the documented 0-20 range, where higher values have undefined behaviour.
+// BOOST_CLAMP_ENABLED=false passes boosts through unchanged for API versions accepting a wider range.
+func clampBoost(v float32) float32 {
+	if os.Getenv("BOOST_CLAMP_ENABLED") == "false" {
+		return v
+	}
+	result := min(max(v, 0), maxSpeechContextBoost)
+	if result != v {
+		logger.Warn("Boost value clamped", "original", v, "clamped", result)
+	}
+	return result
+}
+
+// defaultMaxPhraseLength is the longest phrase, in characters, the Speech API does not silently ignore
+const defaultMaxPhraseLength = 100
+
+// maxPhraseLength returns the phrase length limit from MAX_PHRASE_LENGTH
+func maxPhraseLength() int {
+	return int(getEnvInt64("MAX_PHRASE_LENGTH", defaultMaxPhraseLength))
+}
+
+// enforcePhraseLength returns the phrase unchanged when it fits the limit.
+// Longer phrases are dropped with a warning, or split into shorter phrases when split is set.
+func enforcePhraseLength(phrase string, limit int, split bool) []string {
+	length := utf8.RuneCountInString(phrase)
+	if limit <= 0 || length <= limit {
+		return []string{phrase}
+	}
+	if split {
+		return splitLongPhrase(phrase, limit)
+	}
+	logger.Warn("Phrase exceeds maximum length, skipping", "phrase", truncateRunes(phrase, 20)+"...", "length", length)
+	return nil
+}
+
+// splitLongPhrase cuts phrase at the last space before limit until every part fits; words longer than limit are cut mid-word
+func splitLongPhrase(phrase string, limit int) []string {
+	var parts []string
+	runes := []rune(strings.TrimSpace(phrase))
+	for len(runes) > limit {
+		cut := limit
+		for i := limit; i > 0; i-- {
+			if runes[i] == ' ' {
+				cut = i
+				break
+			}
+		}
+		if part := strings.TrimSpace(string(runes[:cut])); part != "" {
+			parts = append(parts, part)
+		}
+		runes = []rune(strings.TrimSpace(string(runes[cut:])))
+	}
+	if len(runes) > 0 {
+		parts = append(parts, string(runes))
+	}
+	return parts
+}
+
+// supportsAutoDetectLanguage reports whether LanguageCode "auto" can be used with the given model and API version
+func supportsAutoDetectLanguage(model, apiVersion string) bool {
+	return model == autoDetectLanguageModel && apiVersion == "v2"
+}
+
+// defaultBatchMaxConcurrent is the default server-wide number of concurrent batch re-transcriptions
+const defaultBatchMaxConcurrent = 4
+
+// batchRecognitionSlots bounds the number of concurrent batch re-transcriptions of short sessions; set by
+// initBatchRecognition
+var batchRecognitionSlots = make(chan struct{}, defaultBatchMaxConcurrent)
+
+// initBatchRecognition configures the batch re-transcription concurrency from BATCH_MAX_CONCURRENT
+func initBatchRecognition() {
+	if concurrent := getEnvInt64("BATCH_MAX_CONCURRENT", defaultBatchMaxConcurrent); concurrent > 0 {
+		batchRecognitionSlots = make(chan struct{}, concurrent)
+	}
+}
+
+// enhancedModels are the models with an enhanced variant; an empty model lets the API pick one
+var enhancedModels = map[string]bool{"": true, "phone_call": true, "video": true}
+
+// enhancedModeWarnings lists why the API may ignore UseEnhanced for the model and language; the request is still sent
+func enhancedModeWarnings(model, languageCode string) []string {
+	var warnings []string
+	if !enhancedModels[model] {
+		warnings = append(warnings, fmt.Sprintf("model %q has no enhanced variant", model))
+	}
+	if languageCode != "en-US" {
+		warnings = append(warnings, fmt.Sprintf("enhanced models are only available for en-US, not %q", languageCode))
+	}
+	return warnings
+}
+
+// dynamicKeywordBoost is the boost of keywords added during a session, higher than configured phrases to prioritize them
+const dynamicKeywordBoost float32 = 15.0
+
+// decayedBoost lowers a keyword boost by ratePerMinute for each minute since it was added, never below 5.0
+func decayedBoost(initial, ratePerMinute float32, elapsed time.Duration) float32 {
+	boost := initial - ratePerMinute*float32(elapsed.Minutes())
+	if boost < minScaledBoost {
+		return minScaledBoost
+	}
+	return boost
+}
+
+// synonymBoost is the boost of synonyms of the custom words, low so they never outweigh the words themselves
+const synonymBoost float32 = 5.0
+
+// synonymSpeechContext puts the synonyms found for the custom words in their own low-boost context
+func synonymSpeechContext(synonyms []string) *speechpb.SpeechContext {
+	return &speechpb.SpeechContext{Phrases: synonyms, Boost: clampBoost(synonymBoost)}
+}
+
+// keywordSpeechContexts builds one SpeechContext per distinct boost, since a context has a single boost for all its phrases
+func keywordSpeechContexts(entries []KeywordEntry) []*speechpb.SpeechContext {
+	var contexts []*speechpb.SpeechContext
+	byBoost := make(map[float32]*speechpb.SpeechContext)
+	for _, entry := range entries {
+		speechContext, ok := byBoost[entry.CurrentBoost]
+		if !ok {
+			speechContext = &speechpb.SpeechContext{Boost: clampBoost(entry.CurrentBoost)}
+			byBoost[entry.CurrentBoost] = speechContext
+			contexts = append(contexts, speechContext)
+		}
+		speechContext.Phrases = append(speechContext.Phrases, entry.Word)
+	}
+	return contexts
+}
+
+// SessionState holds the speech contexts and dynamic keywords of one WebSocket session
+type SessionState struct {
+	mu              sync.Mutex
+	speechContexts  []*speechpb.SpeechContext // Contexts the session started with
+	dynamicKeywords []string
+}
+
+// newSessionState creates the keyword state of a session from its initial speech contexts and custom words
+func newSessionState(speechContexts []*speechpb.SpeechContext, customWords []string) *SessionState {
+	return &SessionState{
+		speechContexts:  append([]*speechpb.SpeechContext(nil), speechContexts...),
+		dynamicKeywords: append([]string(nil), customWords...),
+	}
+}
+
+// Keywords returns a copy of the session's keywords
+func (s *SessionState) Keywords() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.dynamicKeywords...)
+}
+
+// AddKeywords adds the trimmed words not known yet, ignoring case, and returns the ones added
+func (s *SessionState) AddKeywords(words []string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing := make(map[string]bool, len(s.dynamicKeywords))
+	for _, keyword := range s.dynamicKeywords {
+		existing[strings.ToLower(strings.TrimSpace(keyword))] = true
+	}
+	var added []string
+	for _, word := range words {
+		trimmed := strings.TrimSpace(word)
+		if trimmed != "" && !existing[strings.ToLower(trimmed)] {
+			added = append(added, trimmed)
+			s.dynamicKeywords = append(s.dynamicKeywords, trimmed)
+			existing[strings.ToLower(trimmed)] = true
+		}
+	}
+	return added
+}
+
+// ContextPhrases returns the phrases of the initial speech contexts followed by the keywords
+func (s *SessionState) ContextPhrases() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var phrases []string
+	for _, speechContext := range s.speechContexts {
+		phrases = append(phrases, speechContext.Phrases...)
+	}
+	return append(phrases, s.dynamicKeywords...)
+}
+
+// audioEncoding maps a client audio format string to the Speech API encoding, defaulting to LINEAR16
+func audioEncoding(format string) speechpb.RecognitionConfig_AudioEncoding {
+	logger.Debug("Mapping audio format to Speech API encoding", "format", format)
+
+	switch strings.ToLower(format) {
+	case "linear16":
+		logger.Debug("Audio encoding selected", "encoding", "LINEAR16")
+		return speechpb.RecognitionConfig_LINEAR16
+	case "ogg_opus":
+		logger.Debug("Audio encoding selected", "encoding", "OGG_OPUS")
+		return speechpb.RecognitionConfig_OGG_OPUS
+	case "webm_opus":
+		logger.Debug("Audio encoding selected", "encoding", "WEBM_OPUS")
+		return speechpb.RecognitionConfig_WEBM_OPUS
+	case "flac":
+		logger.Debug("Audio encoding selected", "encoding", "FLAC")
+		return speechpb.RecognitionConfig_FLAC
+	case "mulaw":
+		logger.Debug("Audio encoding selected", "encoding", "MULAW")
+		return speechpb.RecognitionConfig_MULAW
+	}
+
+	// Try using the value lookup as fallback
+	if encodingValue, exists := speechpb.RecognitionConfig_AudioEncoding_value[format]; exists {
+		logger.Debug("Audio encoding from value lookup", "encoding", format)
+		return speechpb.RecognitionConfig_AudioEncoding(encodingValue)
+	}
+	logger.Warn("Unknown audio format, defaulting to LINEAR16", "format", format)
+	return speechpb.RecognitionConfig_LINEAR16
+}
+
+// recvResult carries the outcome of a single stream Recv call
+type recvResult struct {
+	resp *speechpb.StreamingRecognizeResponse
+	err  error
+}
+
+// recvWithTimeout receives from a stream, returning a DeadlineExceeded status error when nothing arrives within timeout.
+// gRPC streams cannot take a per-call deadline, so Recv runs in its own goroutine; a timed out call
+// completes once the abandoned stream is closed. A timeout <= 0 waits indefinitely.
+//
+// lastAudioSent, when not nil, reports when audio was last forwarded to the stream: a window without audio is
+// silence rather than a stall, since Speech-to-Text has nothing to answer, so the same Recv keeps waiting.
+func recvWithTimeout(stream speechpb.Speech_StreamingRecognizeClient, timeout time.Duration, lastAudioSent func() time.Time) (*speechpb.StreamingRecognizeResponse, error) {
+	if timeout <= 0 {
+		return stream.Recv()
+	}
+
+	done := make(chan recvResult, 1)
+	go func() {
+		resp, err := stream.Recv()
+		done <- recvResult{resp: resp, err: err}
+	}()
+
+	windowStart := time.Now()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case result := <-done:
+			return result.resp, result.err
+		case <-timer.C:
+			if lastAudioSent == nil || lastAudioSent().After(windowStart) {
+				return nil, status.Errorf(codes.DeadlineExceeded, "no response from Speech-to-Text within %v", timeout)
+			}
+			windowStart = time.Now()
+			timer.Reset(timeout)
+		}
+	}
+}
+
+// keywordSuggestionInterval is the number of final results between keyword suggestions
+const keywordSuggestionInterval = 20
 
 // createSpeechContexts creates speech contexts with custom words/phrases for enhanced recognition
 func createSpeechContexts(customWords []string) []*speechpb.SpeechContext {
@@ -37,7 +322,7 @@ func createSpeechContexts(customWords []string) []*speechpb.SpeechContext {
 	// Create a speech context with the custom phrases
 	speechContext := &speechpb.SpeechContext{
 		Phrases: phrases,
-		Boost:   10.0, // Boost recognition confidence for these phrases
+		Boost:   clampBoost(10.0), // Boost recognition confidence for these phrases
 	}
 
 	logger.Info("SpeechContext created successfully", "phrasesCount", len(phrases))
@@ -45,8 +330,13 @@ func createSpeechContexts(customWords []string) []*speechpb.SpeechContext {
 	return []*speechpb.SpeechContext{speechContext}
 }
 
-// createDynamicSpeechContexts creates updated speech contexts by combining original contexts with new dynamic keywords
-func createDynamicSpeechContexts(originalContexts []*speechpb.SpeechContext, newKeywords []string) []*speechpb.SpeechContext {
+// createDynamicSpeechContexts creates updated speech contexts by combining a session's original contexts with its dynamic keywords
+func createDynamicSpeechContexts(state *SessionState) []*speechpb.SpeechContext {
+	state.mu.Lock()
+	originalContexts := state.speechContexts
+	newKeywords := append([]string(nil), state.dynamicKeywords...)
+	state.mu.Unlock()
+
 	if len(newKeywords) == 0 {
 		logger.Debug("No new keywords provided, returning original contexts")
 		return originalContexts
@@ -83,13 +373,13 @@ func createDynamicSpeechContexts(originalContexts []*speechpb.SpeechContext, new
 	if len(validKeywords) > 0 {
 		dynamicContext := &speechpb.SpeechContext{
 			Phrases: validKeywords,
-			Boost:   15.0, // Higher boost for dynamic keywords to prioritize them
+			Boost:   clampBoost(dynamicKeywordBoost),
 		}
 		updatedContexts = append(updatedContexts, dynamicContext)
 
 		logger.Info("Dynamic SpeechContext created",
 			"validKeywordsCount", len(validKeywords),
-			"boost", 15.0,
+			"boost", dynamicKeywordBoost,
 			"totalContextsAfterUpdate", len(updatedContexts))
 	}
 
@@ -100,13 +390,171 @@ func createDynamicSpeechContexts(originalContexts []*speechpb.SpeechContext, new
 	return updatedContexts
 }
 
+// customClassID derives a valid custom class identifier (lowercase letters, digits and hyphens) from a class name
+func customClassID(name string, index int) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == ' ' || r == '-' || r == '_':
+			b.WriteRune('-')
+		}
+	}
+	id := strings.Trim(b.String(), "-")
+	if id == "" {
+		id = fmt.Sprintf("custom-class-%d", index+1)
+	}
+	if len(id) > 60 {
+		id = id[:60]
+	}
+	return id
+}
+
+// Phrase match strategies selectable per phrase with matchStrategy
+const (
+	phraseMatchExact  = "exact"
+	phraseMatchPrefix = "prefix"
+	phraseMatchClass  = "class"
+)
+
+// speechClassTokens are the predefined Speech API class tokens, without the "$" prefix
+var speechClassTokens = map[string]bool{
+	"ADDRESSNUM":                      true,
+	"DAY":                             true,
+	"DIGIT":                           true,
+	"FULLPHONENUM":                    true,
+	"MONEY":                           true,
+	"MONTH":                           true,
+	"OOV_CLASS_ALPHANUMERIC_SEQUENCE": true,
+	"OOV_CLASS_ALPHA_SEQUENCE":        true,
+	"OOV_CLASS_DIGIT_SEQUENCE":        true,
+	"OOV_CLASS_TEMPERATURE":           true,
+	"OPERAND":                         true,
+	"ORDINAL":                         true,
+	"PERCENT":                         true,
+	"POSTALCODE":                      true,
+	"TIME":                            true,
+	"YEAR":                            true,
+}
+
+// applyMatchStrategy returns the phrases sent for a phrase set item: "prefix" adds the phrase followed by a
+// " *" wildcard hint, and "class" rewrites a recognized class name as its "$" token
+func applyMatchStrategy(phrase, strategy string) []string {
+	switch strategy {
+	case "", phraseMatchExact:
+		return []string{phrase}
+	case phraseMatchPrefix:
+		return []string{phrase, phrase + " *"}
+	case phraseMatchClass:
+		token := strings.ToUpper(strings.TrimPrefix(phrase, "$"))
+		if speechClassTokens[token] {
+			return []string{"$" + token}
+		}
+		logger.Warn("Phrase is not a recognized class token, matching it exactly", "phrase", phrase)
+		return []string{phrase}
+	}
+	logger.Warn("Unknown phrase match strategy, matching exactly", "phrase", phrase, "matchStrategy", strategy)
+	return []string{phrase}
+}
+
+// speechAdaptationEnabled reports whether model adaptation replaces SpeechContexts, set with USE_ADAPTATION_V1P1BETA.
+// The v1 API carries the same adaptation fields as v1p1beta1, so the v1 client is kept.
+func speechAdaptationEnabled() bool {
+	return os.Getenv("USE_ADAPTATION_V1P1BETA") == "true"
+}
+
+// createSpeechAdaptation builds model adaptation with an inline phrase set and inline custom classes.
+// Unlike SpeechContexts, adaptation keeps per-phrase boosts and lets phrases reference classes,
+// both custom ("${class-id}") and predefined ("$DIGIT", "$ORDINAL").
+// phraseSetRefs name existing Cloud Speech phrase sets applied alongside the inline one.
+// synonyms of the custom words are added at synonymBoost.
+func createSpeechAdaptation(customWords, synonyms []string, phraseSetsConfig *PhraseSetConfig, classesConfig *ClassesConfig, phraseSetRefs []string) *speechpb.SpeechAdaptation {
+	adaptation := &speechpb.SpeechAdaptation{}
+	phraseSet := &speechpb.PhraseSet{}
+
+	for _, word := range customWords {
+		if trimmed := strings.TrimSpace(word); trimmed != "" {
+			phraseSet.Phrases = append(phraseSet.Phrases, &speechpb.PhraseSet_Phrase{Value: trimmed, Boost: clampBoost(10.0)})
+		}
+	}
+	for _, synonym := range synonyms {
+		phraseSet.Phrases = append(phraseSet.Phrases, &speechpb.PhraseSet_Phrase{Value: synonym, Boost: clampBoost(synonymBoost)})
+	}
+
+	if phraseSetsConfig != nil {
+		for _, phraseItem := range phraseSetsConfig.Phrases {
+			if trimmed := strings.TrimSpace(phraseItem.Value); trimmed != "" {
+				for _, phrase := range applyMatchStrategy(trimmed, phraseItem.MatchStrategy) {
+					phraseSet.Phrases = append(phraseSet.Phrases, &speechpb.PhraseSet_Phrase{Value: phrase, Boost: clampBoost(phraseItem.Boost)})
+				}
+			}
+		}
+	}
+
+	if classesConfig != nil {
+		addClass := func(name string, items []string, boost float32) {
+			customClass := &speechpb.CustomClass{CustomClassId: customClassID(name, len(adaptation.CustomClasses))}
+			for _, item := range items {
+				if trimmed := strings.TrimSpace(item); trimmed != "" {
+					customClass.Items = append(customClass.Items, &speechpb.CustomClass_ClassItem{Value: trimmed})
+				}
+			}
+			if len(customClass.Items) == 0 {
+				logger.Warn("Custom class has no valid items, skipping adaptation class", "className", name)
+				return
+			}
+			adaptation.CustomClasses = append(adaptation.CustomClasses, customClass)
+			phraseSet.Phrases = append(phraseSet.Phrases, &speechpb.PhraseSet_Phrase{
+				Value: "${" + customClass.CustomClassId + "}",
+				Boost: clampBoost(boost),
+			})
+		}
+
+		defaultBoost := classesConfig.Boost
+		if len(classesConfig.CustomClasses) > 0 {
+			defaultBoost = classesConfig.CustomClasses[0].Boost
+			for _, customClass := range classesConfig.CustomClasses {
+				addClass(customClass.Name, customClass.Items, customClass.Boost)
+			}
+		} else if len(classesConfig.CustomClassItems) > 0 {
+			addClass("custom-class", classesConfig.CustomClassItems, classesConfig.Boost)
+		}
+
+		for _, class := range classesConfig.PredefinedClasses {
+			if trimmed := strings.TrimSpace(class); trimmed != "" {
+				phraseSet.Phrases = append(phraseSet.Phrases, &speechpb.PhraseSet_Phrase{Value: trimmed, Boost: clampBoost(defaultBoost)})
+			}
+		}
+	}
+
+	if len(phraseSet.Phrases) == 0 && len(phraseSetRefs) == 0 {
+		return nil
+	}
+	if len(phraseSet.Phrases) > 0 {
+		adaptation.PhraseSets = []*speechpb.PhraseSet{phraseSet}
+	}
+	adaptation.PhraseSetReferences = phraseSetRefs
+
+	logger.Info("Speech adaptation created",
+		"phrasesCount", len(phraseSet.Phrases),
+		"customClassesCount", len(adaptation.CustomClasses),
+		"phraseSetReferences", phraseSetRefs)
+	return adaptation
+}
+
 // createAdvancedSpeechContexts creates advanced speech contexts with phrase sets and classes
-func createAdvancedSpeechContexts(customWords []string, phraseSetsConfig *PhraseSetConfig, classesConfig *ClassesConfig) []*speechpb.SpeechContext {
+func createAdvancedSpeechContexts(customWords []string, phraseSetsConfig *PhraseSetConfig, classesConfig *ClassesConfig, wordCount int) []*speechpb.SpeechContext {
 	var speechContexts []*speechpb.SpeechContext
+	phraseLimit := maxPhraseLength()
 
 	// Handle custom words (legacy support)
-	if len(customWords) > 0 {
-		contexts := createSpeechContexts(customWords)
+	var boundedWords []string
+	for _, word := range customWords {
+		boundedWords = append(boundedWords, enforcePhraseLength(word, phraseLimit, false)...)
+	}
+	if len(boundedWords) > 0 {
+		contexts := createSpeechContexts(boundedWords)
 		speechContexts = append(speechContexts, contexts...)
 	}
 
@@ -126,10 +574,17 @@ func createAdvancedSpeechContexts(customWords []string, phraseSetsConfig *Phrase
 				"originalPhrase", phraseItem.Value,
 				"trimmedPhrase", trimmedPhrase,
 				"boost", phraseItem.Boost,
+				"matchStrategy", phraseItem.MatchStrategy,
 				"isEmpty", trimmedPhrase == "")
 
+			var bounded []string
 			if trimmedPhrase != "" {
-				phrases = append(phrases, trimmedPhrase)
+				bounded = enforcePhraseLength(trimmedPhrase, phraseLimit, phraseItem.LongPhraseSplit)
+			}
+			if len(bounded) > 0 {
+				for _, phrase := range bounded {
+					phrases = append(phrases, applyMatchStrategy(phrase, phraseItem.MatchStrategy)...)
+				}
 				totalBoostSum += phraseItem.Boost
 				validPhraseCount++
 				logger.Debug("Phrase set item accepted",
@@ -137,7 +592,7 @@ func createAdvancedSpeechContexts(customWords []string, phraseSetsConfig *Phrase
 					"phrase", trimmedPhrase,
 					"boost", phraseItem.Boost)
 			} else {
-				logger.Debug("Phrase set item skipped (empty after trim)",
+				logger.Debug("Phrase set item skipped (empty after trim or too long)",
 					"index", i+1,
 					"originalValue", phraseItem.Value)
 			}
@@ -151,15 +606,19 @@ func createAdvancedSpeechContexts(customWords []string, phraseSetsConfig *Phrase
 				"averageBoost", averageBoost,
 				"usingDefaultBoost", 10.0)
 
+			phraseSetBoost := float32(10.0) // Default boost for phrase sets
+			if phraseSetsConfig.AutoScaleBoost {
+				phraseSetBoost = scaleBoost(phraseSetBoost, wordCount)
+			}
 			speechContext := &speechpb.SpeechContext{
 				Phrases: phrases,
-				Boost:   10.0, // Default boost for phrase sets
+				Boost:   clampBoost(phraseSetBoost),
 			}
 			speechContexts = append(speechContexts, speechContext)
 			logger.Info("PhraseSet SpeechContext created successfully",
 				"phrasesCount", len(phrases),
 				"phrases", phrases,
-				"boost", 10.0)
+				"boost", phraseSetBoost)
 		} else {
 			logger.Warn("No valid phrases found in phrase sets configuration",
 				"totalItems", len(phraseSetsConfig.Phrases),
@@ -172,6 +631,13 @@ func createAdvancedSpeechContexts(customWords []string, phraseSetsConfig *Phrase
 	// Handle classes configuration
 	if classesConfig != nil {
 		var classHints []string
+		classBoost := func(configured float32) float32 {
+			boost := clampBoost(configured)
+			if classesConfig.AutoScaleBoost {
+				return scaleBoost(boost, wordCount)
+			}
+			return boost
+		}
 
 		// Add predefined classes
 		for _, class := range classesConfig.PredefinedClasses {
@@ -227,7 +693,7 @@ func createAdvancedSpeechContexts(customWords []string, phraseSetsConfig *Phrase
 
 					speechContext := &speechpb.SpeechContext{
 						Phrases: customClassPhrases,
-						Boost:   customClass.Boost,
+						Boost:   classBoost(customClass.Boost),
 					}
 					speechContexts = append(speechContexts, speechContext)
 					logger.Info("Custom class SpeechContext created successfully",
@@ -278,7 +744,7 @@ func createAdvancedSpeechContexts(customWords []string, phraseSetsConfig *Phrase
 
 				speechContext := &speechpb.SpeechContext{
 					Phrases: customClassPhrases,
-					Boost:   classesConfig.Boost,
+					Boost:   classBoost(classesConfig.Boost),
 				}
 				speechContexts = append(speechContexts, speechContext)
 				logger.Info("Legacy custom class SpeechContext created successfully",
@@ -314,7 +780,7 @@ func createAdvancedSpeechContexts(customWords []string, phraseSetsConfig *Phrase
 
 			speechContext := &speechpb.SpeechContext{
 				Phrases: classHints,
-				Boost:   defaultBoost,
+				Boost:   classBoost(defaultBoost),
 			}
 			speechContexts = append(speechContexts, speechContext)
 			logger.Info("Predefined classes SpeechContext created successfully",
@@ -356,4 +822,4 @@ func createAdvancedSpeechContexts(customWords []string, phraseSetsConfig *Phrase
 	}
 
 	return speechContexts
-}
\ No newline at end of file
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// delayedStream is a Speech-to-Text stream whose Recv answers after a delay
+type delayedStream struct {
+	speechpb.Speech_StreamingRecognizeClient
+	delay time.Duration
+}
+
+func (s *delayedStream) Recv() (*speechpb.StreamingRecognizeResponse, error) {
+	time.Sleep(s.delay)
+	return &speechpb.StreamingRecognizeResponse{}, nil
+}
+
+func TestRecvWithTimeout(t *testing.T) {
+	const timeout = 30 * time.Millisecond
+	sending := func() time.Time { return time.Now() }
+	silent := func() time.Time { return time.Now().Add(-time.Hour) }
+	tests := []struct {
+		name          string
+		delay         time.Duration
+		lastAudioSent func() time.Time
+		wantTimeout   bool
+	}{
+		{"response in time", 0, sending, false},
+		{"stall while sending audio", 200 * time.Millisecond, sending, true},
+		{"no activity tracking", 200 * time.Millisecond, nil, true},
+		{"silence is not a stall", 100 * time.Millisecond, silent, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := recvWithTimeout(&delayedStream{delay: tt.delay}, timeout, tt.lastAudioSent)
+			if tt.wantTimeout {
+				if status.Code(err) != codes.DeadlineExceeded {
+					t.Errorf("recvWithTimeout() error = %v, want DeadlineExceeded", err)
+				}
+				return
+			}
+			if err != nil || resp == nil {
+				t.Errorf("recvWithTimeout() = %v, %v; want the response", resp, err)
+			}
+		})
+	}
+}
+
+func TestCreateSpeechAdaptationSynonyms(t *testing.T) {
+	tests := []struct {
+		name        string
+		customWords []string
+		synonyms    []string
+		wantBoosts  map[string]float32
+	}{
+		{"custom words only", []string{"Kubernetes"}, nil, map[string]float32{"Kubernetes": 10}},
+		{"synonyms at a lower boost", []string{"car"}, []string{"automobile"}, map[string]float32{"car": 10, "automobile": synonymBoost}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adaptation := createSpeechAdaptation(tt.customWords, tt.synonyms, nil, nil, nil)
+			got := map[string]float32{}
+			for _, phrase := range adaptation.PhraseSets[0].Phrases {
+				got[phrase.Value] = phrase.Boost
+			}
+			if !reflect.DeepEqual(got, tt.wantBoosts) {
+				t.Errorf("phrase boosts = %v, want %v", got, tt.wantBoosts)
+			}
+		})
+	}
+}
+
+func TestSpeechAdaptationEnabled(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  bool
+	}{
+		{"unset", "", false},
+		{"enabled", "true", true},
+		{"disabled", "false", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("USE_ADAPTATION_V1P1BETA", tt.value)
+			if got := speechAdaptationEnabled(); got != tt.want {
+				t.Errorf("speechAdaptationEnabled() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnhancedModeWarnings(t *testing.T) {
+	tests := []struct {
+		name         string
+		model        string
+		languageCode string
+		want         []string
+	}{
+		{"default model in en-US", "", "en-US", nil},
+		{"phone_call in en-US", "phone_call", "en-US", nil},
+		{"video in en-US", "video", "en-US", nil},
+		{"unsupported model", "command_and_search", "en-US", []string{`model "command_and_search" has no enhanced variant`}},
+		{"non en-US language", "video", "fr-FR", []string{`enhanced models are only available for en-US, not "fr-FR"`}},
+		{"unsupported model and language", "command_and_search", "de-DE", []string{
+			`model "command_and_search" has no enhanced variant`,
+			`enhanced models are only available for en-US, not "de-DE"`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := enhancedModeWarnings(tt.model, tt.languageCode); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("enhancedModeWarnings(%q, %q) = %q, want %q", tt.model, tt.languageCode, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScaleBoost(t *testing.T) {
+	tests := []struct {
+		name       string
+		scaleWords string
+		configured float32
+		wordCount  int
+		want       float32
+	}{
+		{"start of the session", "", 15, 0, 15},
+		{"halfway", "", 15, 250, 10},
+		{"scale reached", "", 15, 500, 5},
+		{"past the scale", "", 15, 1200, 5},
+		{"low boost unchanged", "", 5, 250, 5},
+		{"boost below the floor unchanged", "", 2, 500, 2},
+		{"configured scale", "1000", 15, 250, 12.5},
+		{"disabled scale goes straight to the floor", "0", 15, 0, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("BOOST_SCALE_WORDS", tt.scaleWords)
+			if got := scaleBoost(tt.configured, tt.wordCount); got != tt.want {
+				t.Errorf("scaleBoost(%v, %d) = %v, want %v", tt.configured, tt.wordCount, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecayedBoost(t *testing.T) {
+	tests := []struct {
+		name    string
+		initial float32
+		rate    float32
+		elapsed time.Duration
+		want    float32
+	}{
+		{"just added", 15, 1, 0, 15},
+		{"after 30 seconds", 15, 1, 30 * time.Second, 14.5},
+		{"after 4 minutes", 15, 1, 4 * time.Minute, 11},
+		{"reaches the floor", 15, 1, 10 * time.Minute, 5},
+		{"stays at the floor", 15, 1, time.Hour, 5},
+		{"faster rate", 15, 2.5, 2 * time.Minute, 10},
+		{"no decay", 15, 0, time.Hour, 15},
+		{"initial boost below the floor", 3, 0, 0, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decayedBoost(tt.initial, tt.rate, tt.elapsed); got != tt.want {
+				t.Errorf("decayedBoost(%v, %v, %s) = %v, want %v", tt.initial, tt.rate, tt.elapsed, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClampBoost(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled string
+		boost   float32
+		want    float32
+	}{
+		{"negative", "", -5, 0},
+		{"just below zero", "", -0.001, 0},
+		{"zero", "", 0, 0},
+		{"in range", "", 10, 10},
+		{"maximum", "", 20, 20},
+		{"just above the maximum", "", 20.001, 20},
+		{"far above the maximum", "", 100, 20},
+		{"explicitly enabled", "true", 100, 20},
+		{"disabled keeps large boosts", "false", 100, 100},
+		{"disabled keeps negative boosts", "false", -5, -5},
+	}
+	previous := logger
+	t.Cleanup(func() { logger = previous })
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("BOOST_CLAMP_ENABLED", tt.enabled)
+			var output bytes.Buffer
+			logger = slog.New(slog.NewTextHandler(&output, nil))
+			if got := clampBoost(tt.boost); got != tt.want {
+				t.Errorf("clampBoost(%v) = %v, want %v", tt.boost, got, tt.want)
+			}
+			if warned := strings.Contains(output.String(), "Boost value clamped"); warned != (tt.want != tt.boost) {
+				t.Errorf("clamping warning logged = %v, want %v (log %q)", warned, tt.want != tt.boost, output.String())
+			}
+		})
+	}
+}
+
+func TestClientBoostsClamped(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled string
+		boost   float32
+		want    float32
+	}{
+		{"above the maximum", "", 100, 20},
+		{"below zero", "", -3, 0},
+		{"clamping disabled", "false", 100, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("BOOST_CLAMP_ENABLED", tt.enabled)
+			phraseSets := &PhraseSetConfig{Phrases: []PhraseItem{{Value: "Kubernetes", Boost: tt.boost}}}
+			adaptation := createSpeechAdaptation(nil, nil, phraseSets, nil, nil)
+			if got := adaptation.PhraseSets[0].Phrases[0].Boost; got != tt.want {
+				t.Errorf("phrase boost = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateSpeechAdaptationMatchStrategy(t *testing.T) {
+	tests := []struct {
+		name     string
+		phrase   string
+		strategy string
+		want     []string
+	}{
+		{"exact by default", "Kubernetes", "", []string{"Kubernetes"}},
+		{"prefix adds a wildcard", "deploy to", phraseMatchPrefix, []string{"deploy to", "deploy to *"}},
+		{"class token", "digit", phraseMatchClass, []string{"$DIGIT"}},
+		{"unknown class matched exactly", "colour", phraseMatchClass, []string{"colour"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			phraseSets := &PhraseSetConfig{Phrases: []PhraseItem{{Value: tt.phrase, Boost: 5, MatchStrategy: tt.strategy}}}
+			adaptation := createSpeechAdaptation(nil, nil, phraseSets, nil, nil)
+			var got []string
+			for _, phrase := range adaptation.PhraseSets[0].Phrases {
+				got = append(got, phrase.Value)
+				if phrase.Boost != 5 {
+					t.Errorf("phrase %q boost = %v, want 5", phrase.Value, phrase.Boost)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("phrases = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateAdvancedSpeechContextsMatchStrategy(t *testing.T) {
+	tests := []struct {
+		name     string
+		phrase   string
+		strategy string
+		want     []string
+	}{
+		{"exact", "Kubernetes", phraseMatchExact, []string{"Kubernetes"}},
+		{"prefix adds a wildcard", "deploy to", phraseMatchPrefix, []string{"deploy to", "deploy to *"}},
+		{"class token", "ordinal", phraseMatchClass, []string{"$ORDINAL"}},
+		{"class token already prefixed", "$digit", phraseMatchClass, []string{"$DIGIT"}},
+		{"unknown class matched exactly", "colour", phraseMatchClass, []string{"colour"}},
+		{"unknown strategy matched exactly", "Kubernetes", "fuzzy", []string{"Kubernetes"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			phraseSets := &PhraseSetConfig{Phrases: []PhraseItem{{Value: tt.phrase, Boost: 5, MatchStrategy: tt.strategy}}}
+			contexts := createAdvancedSpeechContexts(nil, phraseSets, nil, 0)
+			if len(contexts) != 1 {
+				t.Fatalf("got %d speech contexts, want 1", len(contexts))
+			}
+			if !reflect.DeepEqual(contexts[0].Phrases, tt.want) {
+				t.Errorf("phrases = %v, want %v", contexts[0].Phrases, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionStateAddKeywords(t *testing.T) {
+	tests := []struct {
+		name      string
+		initial   []string
+		words     []string
+		wantAdded []string
+		wantAll   []string
+	}{
+		{"new words", []string{"Kubernetes"}, []string{"Istio", "Envoy"}, []string{"Istio", "Envoy"}, []string{"Kubernetes", "Istio", "Envoy"}},
+		{"known words ignore case", []string{"Kubernetes"}, []string{"kubernetes", " KUBERNETES "}, nil, []string{"Kubernetes"}},
+		{"trimmed and blank skipped", nil, []string{"  gRPC ", "", "   "}, []string{"gRPC"}, []string{"gRPC"}},
+		{"duplicates within one request", nil, []string{"Helm", "helm"}, []string{"Helm"}, []string{"Helm"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := newSessionState(nil, tt.initial)
+			if got := state.AddKeywords(tt.words); !reflect.DeepEqual(got, tt.wantAdded) {
+				t.Errorf("AddKeywords() = %v, want %v", got, tt.wantAdded)
+			}
+			if got := state.Keywords(); !reflect.DeepEqual(got, tt.wantAll) {
+				t.Errorf("Keywords() = %v, want %v", got, tt.wantAll)
+			}
+		})
+	}
+}
+
+// TestSessionStateConcurrentSessions is meant for go test -race: sessions update their keywords
+// concurrently and must neither race nor see each other's keywords
+func TestSessionStateConcurrentSessions(t *testing.T) {
+	initial := []*speechpb.SpeechContext{{Phrases: []string{"shared phrase"}}}
+	const sessions, updates = 4, 50
+	states := make([]*SessionState, sessions)
+	for i := range states {
+		states[i] = newSessionState(initial, nil)
+	}
+
+	var wg sync.WaitGroup
+	for i, state := range states {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < updates; j++ {
+				state.AddKeywords([]string{fmt.Sprintf("session%d-word%d", i, j)})
+			}
+		}()
+		// Streams are recreated while keywords arrive
+		go func() {
+			defer wg.Done()
+			for j := 0; j < updates; j++ {
+				createDynamicSpeechContexts(state)
+				state.ContextPhrases()
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i, state := range states {
+		keywords := state.Keywords()
+		if len(keywords) != updates {
+			t.Errorf("session %d has %d keywords, want %d", i, len(keywords), updates)
+		}
+		prefix := fmt.Sprintf("session%d-", i)
+		for _, keyword := range keywords {
+			if !strings.HasPrefix(keyword, prefix) {
+				t.Errorf("session %d has keyword %q of another session", i, keyword)
+			}
+		}
+		contexts := createDynamicSpeechContexts(state)
+		if len(contexts) != 2 || !reflect.DeepEqual(contexts[0].Phrases, []string{"shared phrase"}) || len(contexts[1].Phrases) != updates {
+			t.Errorf("session %d contexts = %v, want the initial context and one with its keywords", i, contexts)
+		}
+	}
+	if len(initial) != 1 || len(initial[0].Phrases) != 1 {
+		t.Errorf("initial contexts were modified: %v", initial)
+	}
+}
+
+func TestEnforcePhraseLength(t *testing.T) {
+	tests := []struct {
+		name   string
+		phrase string
+		limit  int
+		split  bool
+		want   []string
+	}{
+		{"under the limit", "roadmap", 10, false, []string{"roadmap"}},
+		{"at the limit", "sprint one", 10, false, []string{"sprint one"}},
+		{"at the limit in characters, over in bytes", "équipe été", 10, false, []string{"équipe été"}},
+		{"over the limit dropped", "sprint one two", 10, false, nil},
+		{"over the limit split", "sprint one two", 10, true, []string{"sprint one", "two"}},
+		{"no limit", "a phrase of any length at all", 0, false, []string{"a phrase of any length at all"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := enforcePhraseLength(tt.phrase, tt.limit, tt.split); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("enforcePhraseLength(%q, %d, %v) = %q, want %q", tt.phrase, tt.limit, tt.split, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitLongPhrase(t *testing.T) {
+	tests := []struct {
+		name   string
+		phrase string
+		limit  int
+		want   []string
+	}{
+		{"cut at the last space before the limit", "quarterly roadmap review", 18, []string{"quarterly roadmap", "review"}},
+		{"space right at the limit", "sprint one two", 6, []string{"sprint", "one", "two"}},
+		{"several parts", "one two three four five six", 9, []string{"one two", "three", "four five", "six"}},
+		{"word longer than the limit cut mid-word", "internationalization", 8, []string{"internat", "ionaliza", "tion"}},
+		{"surrounding and repeated spaces trimmed", "  alpha    beta  ", 6, []string{"alpha", "beta"}},
+		{"multi-byte characters counted once", "équipe été réunion", 10, []string{"équipe été", "réunion"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitLongPhrase(tt.phrase, tt.limit)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("splitLongPhrase(%q, %d) = %q, want %q", tt.phrase, tt.limit, got, tt.want)
+			}
+			for _, part := range got {
+				if n := len([]rune(part)); n > tt.limit {
+					t.Errorf("part %q has %d characters, over the limit of %d", part, n, tt.limit)
+				}
+			}
+		})
+	}
+}
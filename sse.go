@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// sseHistorySize is the number of events kept for Last-Event-ID replay
+const sseHistorySize = 100
+
+// sseSubscriberBuffer is the number of events buffered per subscriber before events are dropped
+const sseSubscriberBuffer = 64
+
+// sseEvent is a message fanned out to Server-Sent Events subscribers
+type sseEvent struct {
+	ID   int64
+	Data []byte
+}
+
+// Broadcaster fans out one session's outbound messages to its stream and watch subscribers
+type Broadcaster struct {
+	mu          sync.Mutex
+	nextID      int64
+	history     []sseEvent
+	subscribers map[chan sseEvent]struct{}
+	closed      bool
+}
+
+// NewBroadcaster creates an empty broadcaster
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{
+		subscribers: make(map[chan sseEvent]struct{}),
+	}
+}
+
+// Publish sends data to every subscriber and keeps it for replay
+func (b *Broadcaster) Publish(data []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+
+	b.nextID++
+	event := sseEvent{ID: b.nextID, Data: data}
+	b.history = append(b.history, event)
+	if len(b.history) > sseHistorySize {
+		b.history = b.history[len(b.history)-sseHistorySize:]
+	}
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			logger.Warn("Dropping event for slow stream subscriber", "eventID", event.ID)
+		}
+	}
+}
+
+// Subscribe registers a subscriber and returns the events published after lastEventID that are still in history.
+// The returned channel is closed when the broadcaster closes; call unsubscribe when done.
+func (b *Broadcaster) Subscribe(lastEventID int64) (ch chan sseEvent, replay []sseEvent, unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch = make(chan sseEvent, sseSubscriberBuffer)
+	if b.closed {
+		close(ch)
+		return ch, nil, func() {}
+	}
+
+	for _, event := range b.history {
+		if event.ID > lastEventID {
+			replay = append(replay, event)
+		}
+	}
+	b.subscribers[ch] = struct{}{}
+
+	unsubscribe = func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+	return ch, replay, unsubscribe
+}
+
+// Close disconnects every subscriber
+func (b *Broadcaster) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// writeSSEEvent writes a single event in Server-Sent Events format
+func writeSSEEvent(w http.ResponseWriter, event sseEvent) error {
+	_, err := fmt.Fprintf(w, "id: %d\ndata: %s\n\n", event.ID, event.Data)
+	return err
+}
+
+// serveSessionStream streams the messages sent to a live session's client as Server-Sent Events
+func serveSessionStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	session, ok := sessionRegistry.Get(r.PathValue("sessionID"))
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	var lastEventID int64
+	if value := r.Header.Get("Last-Event-ID"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Last-Event-ID header", http.StatusBadRequest)
+			return
+		}
+		lastEventID = parsed
+	}
+
+	events, replay, unsubscribe := sessionPubSub.subscribeFrom(session.ID, lastEventID)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	logger.Info("Stream subscriber connected",
+		"sessionID", session.ID,
+		"remoteIP", clientIP(r),
+		"replayedEvents", len(replay))
+
+	for _, event := range replay {
+		if err := writeSSEEvent(w, event); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			logger.Info("Stream subscriber disconnected", "sessionID", session.ID)
+			return
+		case event, ok := <-events:
+			if !ok {
+				logger.Info("Session ended, closing stream", "sessionID", session.ID)
+				return
+			}
+			if err := writeSSEEvent(w, event); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// receive reads the next event from ch, failing if none arrives in time
+func receive(t *testing.T, ch chan sseEvent) sseEvent {
+	t.Helper()
+	select {
+	case event := <-ch:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an event")
+		return sseEvent{}
+	}
+}
+
+func TestBroadcasterFanOut(t *testing.T) {
+	b := NewBroadcaster()
+	first, _, unsubscribeFirst := b.Subscribe(0)
+	second, _, unsubscribeSecond := b.Subscribe(0)
+	defer unsubscribeSecond()
+
+	b.Publish([]byte("one"))
+	for name, ch := range map[string]chan sseEvent{"first": first, "second": second} {
+		if event := receive(t, ch); event.ID != 1 || string(event.Data) != "one" {
+			t.Errorf("%s subscriber received %d %q, want 1 \"one\"", name, event.ID, event.Data)
+		}
+	}
+
+	unsubscribeFirst()
+	unsubscribeFirst() // Unsubscribing twice is harmless
+	if _, ok := <-first; ok {
+		t.Error("unsubscribed channel still open")
+	}
+	b.Publish([]byte("two"))
+	if event := receive(t, second); event.ID != 2 || string(event.Data) != "two" {
+		t.Errorf("remaining subscriber received %d %q, want 2 \"two\"", event.ID, event.Data)
+	}
+
+	b.Close()
+	if _, ok := <-second; ok {
+		t.Error("subscriber channel still open after Close")
+	}
+	b.Publish([]byte("three"))
+	late, replay, _ := b.Subscribe(0)
+	if _, ok := <-late; ok || replay != nil {
+		t.Errorf("subscribing after Close returned an open channel or replay %v", replay)
+	}
+}
+
+func TestBroadcasterReplay(t *testing.T) {
+	b := NewBroadcaster()
+	for i := 1; i <= sseHistorySize+10; i++ {
+		b.Publish([]byte(fmt.Sprint(i)))
+	}
+
+	tests := []struct {
+		name        string
+		lastEventID int64
+		wantFirst   int64
+		wantCount   int
+	}{
+		{"recent events after the last ID", sseHistorySize + 5, sseHistorySize + 6, 5},
+		{"up to date", sseHistorySize + 10, 0, 0},
+		{"older events trimmed from history", 0, 11, sseHistorySize},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, replay, unsubscribe := b.Subscribe(tt.lastEventID)
+			defer unsubscribe()
+			if len(replay) != tt.wantCount {
+				t.Fatalf("replayed %d events, want %d", len(replay), tt.wantCount)
+			}
+			if tt.wantCount > 0 && replay[0].ID != tt.wantFirst {
+				t.Errorf("first replayed event = %d, want %d", replay[0].ID, tt.wantFirst)
+			}
+		})
+	}
+}
+
+// readSSEEvents reads n events from a Server-Sent Events body, returning each as "<id> <data>"
+func readSSEEvents(t *testing.T, body *bufio.Reader, n int) []string {
+	t.Helper()
+	var events []string
+	var id, data string
+	for len(events) < n {
+		line, err := body.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading event %d: %v", len(events)+1, err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		case line == "":
+			events = append(events, id+" "+data)
+		}
+	}
+	return events
+}
+
+func TestServeSessionStream(t *testing.T) {
+	session := newSession(func() {}, ConfigMessage{})
+	sessionRegistry.Register(session)
+	defer sessionRegistry.Unregister(session.ID)
+	sessionPubSub.Open(session.ID)
+	defer sessionPubSub.Close(session.ID)
+	for _, text := range []string{"one", "two", "three"} {
+		sessionPubSub.Publish(session.ID, []byte(text))
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/sessions/{sessionID}/stream", serveSessionStream)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	get := func(sessionID, lastEventID string) *http.Response {
+		t.Helper()
+		r, err := http.NewRequest(http.MethodGet, server.URL+"/api/sessions/"+sessionID+"/stream", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lastEventID != "" {
+			r.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	if resp := get("0123456789abcdef", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown session status = %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+	if resp := get(session.ID, "latest"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid Last-Event-ID status = %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+
+	fresh := get(session.ID, "")
+	resumed := get(session.ID, "1")
+	for _, resp := range []*http.Response{fresh, resumed} {
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("status = %d, Content-Type = %q, want an event stream", resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+	}
+	freshBody, resumedBody := bufio.NewReader(fresh.Body), bufio.NewReader(resumed.Body)
+
+	// Without Last-Event-ID the whole history is replayed; with it, only what the client missed
+	if got, want := readSSEEvents(t, freshBody, 3), []string{"1 one", "2 two", "3 three"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("fresh subscriber replay = %q, want %q", got, want)
+	}
+	if got, want := readSSEEvents(t, resumedBody, 2), []string{"2 two", "3 three"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("resumed subscriber replay = %q, want %q", got, want)
+	}
+
+	sessionPubSub.Publish(session.ID, []byte("four"))
+	for name, body := range map[string]*bufio.Reader{"fresh": freshBody, "resumed": resumedBody} {
+		if got, want := readSSEEvents(t, body, 1), []string{"4 four"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s subscriber live event = %q, want %q", name, got, want)
+		}
+	}
+
+	// Ending the session closes every stream
+	sessionPubSub.Close(session.ID)
+	for name, body := range map[string]*bufio.Reader{"fresh": freshBody, "resumed": resumedBody} {
+		if rest, err := io.ReadAll(body); err != nil || len(rest) != 0 {
+			t.Errorf("%s stream after the session ended: %q, %v, want a clean end of stream", name, rest, err)
+		}
+	}
+}
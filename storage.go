@@ -0,0 +1,926 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	storage "google.golang.org/api/storage/v1"
+)
+
+// getTranscriptDirectory returns the transcript persistence directory, or an empty string when persistence is disabled
+func getTranscriptDirectory() string {
+	return os.Getenv("TRANSCRIPT_DIR")
+}
+
+// isValidSessionID reports whether id is safe to use as a file name component
+func isValidSessionID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// sessionFilePath returns the path of a persisted session file with the given suffix
+func sessionFilePath(dir, sessionID, suffix string) string {
+	return filepath.Join(dir, sessionID+suffix)
+}
+
+// StorageBackend persists session transcripts and summaries.
+// Session metadata, tags and event logs stay in TRANSCRIPT_DIR whatever the backend.
+type StorageBackend interface {
+	WriteTranscriptLine(sessionID string, line []byte) error
+	WriteSessionSummary(sessionID string, summary string) error
+	// OpenTranscript opens the transcript JSON lines of a session; a missing transcript returns an error satisfying os.IsNotExist
+	OpenTranscript(sessionID string) (io.ReadCloser, error)
+	// ReadSessionSummary returns the latest summary of a session; a missing summary returns an error satisfying os.IsNotExist
+	ReadSessionSummary(sessionID string) (string, error)
+	// Flush persists the transcript lines still buffered for a session
+	Flush(sessionID string) error
+	// Close persists every buffered line and stops background work
+	Close() error
+}
+
+// storageBackend is where transcripts and summaries are written; set by initStorageBackend
+var storageBackend StorageBackend = LocalStorage{}
+
+// initStorageBackend selects GCS when GCS_BUCKET is set and the local TRANSCRIPT_DIR otherwise
+func initStorageBackend() {
+	bucket := os.Getenv("GCS_BUCKET")
+	if bucket == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), gcsRequestTimeout)
+	defer cancel()
+	flushInterval := time.Duration(getEnvInt64("GCS_FLUSH_INTERVAL_MS", defaultGCSFlushInterval.Milliseconds())) * time.Millisecond
+	backend, err := NewGCSStorage(ctx, bucket, os.Getenv("GCS_PREFIX"), flushInterval)
+	if err != nil {
+		logger.Error("Failed to create GCS storage, using local storage", "bucket", bucket, "error", err)
+		return
+	}
+	storageBackend = backend
+	logger.Info("Persisting transcripts and summaries to GCS",
+		"bucket", bucket,
+		"prefix", backend.prefix,
+		"flushInterval", flushInterval)
+}
+
+// LocalStorage writes session files to TRANSCRIPT_DIR; it does nothing when TRANSCRIPT_DIR is unset
+type LocalStorage struct{}
+
+// WriteTranscriptLine appends a JSON line to the session transcript file
+func (LocalStorage) WriteTranscriptLine(sessionID string, line []byte) error {
+	return appendSessionFileLine(sessionID, ".jsonl", line)
+}
+
+// WriteSessionSummary writes the latest summary as Markdown
+func (LocalStorage) WriteSessionSummary(sessionID, summary string) error {
+	dir := getTranscriptDirectory()
+	if dir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating transcript directory: %v", err)
+	}
+	if err := os.WriteFile(sessionFilePath(dir, sessionID, ".summary.md"), []byte(summary), 0644); err != nil {
+		return fmt.Errorf("error writing summary file: %v", err)
+	}
+	return nil
+}
+
+// OpenTranscript opens the session transcript file
+func (LocalStorage) OpenTranscript(sessionID string) (io.ReadCloser, error) {
+	dir := getTranscriptDirectory()
+	if dir == "" {
+		return nil, &os.PathError{Op: "open", Path: sessionID + ".jsonl", Err: os.ErrNotExist}
+	}
+	return os.Open(sessionFilePath(dir, sessionID, ".jsonl"))
+}
+
+// ReadSessionSummary reads the session summary file
+func (LocalStorage) ReadSessionSummary(sessionID string) (string, error) {
+	dir := getTranscriptDirectory()
+	if dir == "" {
+		return "", &os.PathError{Op: "open", Path: sessionID + ".summary.md", Err: os.ErrNotExist}
+	}
+	summary, err := os.ReadFile(sessionFilePath(dir, sessionID, ".summary.md"))
+	return string(summary), err
+}
+
+// Flush does nothing: lines are appended to the file as they are written
+func (LocalStorage) Flush(string) error { return nil }
+
+// Close does nothing
+func (LocalStorage) Close() error { return nil }
+
+// transcriptRotationInterval is how often the transcript directory is checked for sessions to rotate
+const transcriptRotationInterval = time.Hour
+
+// TranscriptRotator keeps TRANSCRIPT_DIR from growing without bound. Sessions whose files were last written
+// before the retention period, then the oldest sessions while the directory exceeds maxBytes, are moved to
+// archiveDir, or deleted when it is empty. All files of a session are rotated together; live sessions never are.
+type TranscriptRotator struct {
+	dir        string
+	archiveDir string
+	retention  time.Duration // 0 keeps sessions regardless of age
+	maxBytes   int64         // 0 leaves the directory size unbounded
+}
+
+// persistedSessionFiles are the files of one session in the transcript directory
+type persistedSessionFiles struct {
+	sessionID string
+	names     []string
+	size      int64
+	modTime   time.Time // Latest modification of any of the files
+}
+
+// NewTranscriptRotator creates a rotator of dir
+func NewTranscriptRotator(dir, archiveDir string, retention time.Duration, maxBytes int64) *TranscriptRotator {
+	return &TranscriptRotator{dir: dir, archiveDir: archiveDir, retention: retention, maxBytes: maxBytes}
+}
+
+// Run rotates sessions at startup and then every interval until stop is closed
+func (t *TranscriptRotator) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := t.Rotate(time.Now()); err != nil {
+			logger.Error("Failed to rotate transcripts", "dir", t.dir, "error", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Rotate archives or deletes the sessions past the retention period or beyond the size limit
+func (t *TranscriptRotator) Rotate(now time.Time) error {
+	sessions, totalSize, err := t.scan()
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions { // Oldest first
+		expired := t.retention > 0 && now.Sub(session.modTime) > t.retention
+		oversized := t.maxBytes > 0 && totalSize > t.maxBytes
+		if !expired && !oversized {
+			continue
+		}
+		if _, live := sessionRegistry.Get(session.sessionID); live {
+			continue
+		}
+		if err := t.rotateSession(session); err != nil {
+			logger.Error("Failed to rotate session files", "sessionID", session.sessionID, "error", err)
+			continue
+		}
+		totalSize -= session.size
+		reason := "retention"
+		if !expired {
+			reason = "size_limit"
+		}
+		logger.Info("Rotated session files",
+			"sessionID", session.sessionID,
+			"files", len(session.names),
+			"bytes", session.size,
+			"reason", reason,
+			"archived", t.archiveDir != "")
+	}
+	return nil
+}
+
+// scan groups the files of the transcript directory by session, oldest session first
+func (t *TranscriptRotator) scan() ([]*persistedSessionFiles, int64, error) {
+	entries, err := os.ReadDir(t.dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, 0, nil
+		}
+		return nil, 0, fmt.Errorf("error reading transcript directory: %v", err)
+	}
+
+	bySession := make(map[string]*persistedSessionFiles)
+	var sessions []*persistedSessionFiles
+	var totalSize int64
+	for _, entry := range entries {
+		sessionID, _, found := strings.Cut(entry.Name(), ".")
+		if !found || !entry.Type().IsRegular() || !isValidSessionID(sessionID) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue // Removed since the directory was read
+		}
+		session, ok := bySession[sessionID]
+		if !ok {
+			session = &persistedSessionFiles{sessionID: sessionID}
+			bySession[sessionID] = session
+			sessions = append(sessions, session)
+		}
+		session.names = append(session.names, entry.Name())
+		session.size += info.Size()
+		if info.ModTime().After(session.modTime) {
+			session.modTime = info.ModTime()
+		}
+		totalSize += info.Size()
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].modTime.Before(sessions[j].modTime)
+	})
+	return sessions, totalSize, nil
+}
+
+// rotateSession moves the files of a session to the archive directory, or deletes them without one.
+// When a file fails to move, the files already archived are moved back so the session stays whole
+// in the transcript directory. Deletions cannot be undone; files left after a failed deletion stay
+// in the transcript directory and are rotated again on the next run.
+func (t *TranscriptRotator) rotateSession(session *persistedSessionFiles) error {
+	if t.archiveDir == "" {
+		for _, name := range session.names {
+			if err := os.Remove(filepath.Join(t.dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(t.archiveDir, 0755); err != nil {
+		return fmt.Errorf("error creating archive directory: %v", err)
+	}
+	for i, name := range session.names {
+		if err := moveFile(filepath.Join(t.dir, name), filepath.Join(t.archiveDir, name)); err != nil {
+			for _, moved := range session.names[:i] {
+				if undoErr := moveFile(filepath.Join(t.archiveDir, moved), filepath.Join(t.dir, moved)); undoErr != nil {
+					logger.Error("Failed to restore archived session file", "sessionID", session.sessionID, "file", moved, "error", undoErr)
+				}
+			}
+			return fmt.Errorf("error archiving %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// moveFile renames a file, copying it when source and destination are on different file systems
+func moveFile(source, destination string) error {
+	err := os.Rename(source, destination)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(destination, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(destination)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(destination)
+		return err
+	}
+	return os.Remove(source)
+}
+
+// initTranscriptRotator starts rotating TRANSCRIPT_DIR when TRANSCRIPT_RETENTION_DAYS or TRANSCRIPT_MAX_DIR_SIZE_MB is set
+func initTranscriptRotator() {
+	dir := getTranscriptDirectory()
+	retention := time.Duration(getEnvInt64("TRANSCRIPT_RETENTION_DAYS", 0)) * 24 * time.Hour
+	maxBytes := getEnvInt64("TRANSCRIPT_MAX_DIR_SIZE_MB", 0) << 20
+	if dir == "" || (retention <= 0 && maxBytes <= 0) {
+		return
+	}
+
+	rotator := NewTranscriptRotator(dir, os.Getenv("TRANSCRIPT_ARCHIVE_DIR"), max(retention, 0), max(maxBytes, 0))
+	go rotator.Run(transcriptRotationInterval, make(chan struct{}))
+	logger.Info("Transcript rotation configured",
+		"dir", dir,
+		"retention", rotator.retention,
+		"maxDirSizeBytes", rotator.maxBytes,
+		"archiveDir", rotator.archiveDir)
+}
+
+// gcsRequestTimeout bounds each GCS request
+const gcsRequestTimeout = 30 * time.Second
+
+// gcsMaxComponents is kept below the GCS limit of 1024 components per composite object
+const gcsMaxComponents = 1000
+
+// GCS transcript buffering defaults
+const (
+	defaultGCSFlushInterval = 5 * time.Second
+	gcsMaxPendingBytes      = 16 << 20 // Lines buffered per session while GCS is unreachable
+)
+
+// GCSStorage writes session files as objects in a GCS bucket.
+// Transcript lines are buffered in memory and appended in batches every flush interval, by composing
+// the existing object with a new object holding the batch, so writers never wait on GCS.
+type GCSStorage struct {
+	service       *storage.Service
+	bucket        string
+	prefix        string
+	flushInterval time.Duration
+
+	mu      sync.Mutex        // Guards pending
+	pending map[string][]byte // Transcript lines per session waiting for the next flush
+
+	flushMu sync.Mutex // Serializes flushes so compositions of an object do not overwrite each other
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewGCSStorage creates a GCS backend using Application Default Credentials, flushing buffered
+// transcript lines every flushInterval until Close
+func NewGCSStorage(ctx context.Context, bucket, prefix string, flushInterval time.Duration) (*GCSStorage, error) {
+	service, err := storage.NewService(ctx, append(googleClientOptions(), option.WithScopes(storage.DevstorageReadWriteScope))...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating GCS client: %v", err)
+	}
+	return newGCSStorage(service, bucket, prefix, flushInterval), nil
+}
+
+// newGCSStorage creates a GCS backend on an existing service and starts its background flushes
+func newGCSStorage(service *storage.Service, bucket, prefix string, flushInterval time.Duration) *GCSStorage {
+	if flushInterval <= 0 {
+		flushInterval = defaultGCSFlushInterval
+	}
+	g := &GCSStorage{
+		service:       service,
+		bucket:        bucket,
+		prefix:        strings.Trim(prefix, "/"),
+		flushInterval: flushInterval,
+		pending:       make(map[string][]byte),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	go g.run()
+	return g
+}
+
+// objectName returns the object name of a session file with the given suffix
+func (g *GCSStorage) objectName(sessionID, suffix string) string {
+	return path.Join(g.prefix, sessionID+suffix)
+}
+
+// run flushes buffered transcript lines every flush interval, and once more when stopped
+func (g *GCSStorage) run() {
+	defer close(g.done)
+	ticker := time.NewTicker(g.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			g.flushAll()
+		case <-g.stop:
+			g.flushAll()
+			return
+		}
+	}
+}
+
+// flushAll flushes the buffered lines of every session, logging failures; failed lines are retried on the next flush
+func (g *GCSStorage) flushAll() {
+	g.mu.Lock()
+	sessionIDs := make([]string, 0, len(g.pending))
+	for sessionID := range g.pending {
+		sessionIDs = append(sessionIDs, sessionID)
+	}
+	g.mu.Unlock()
+
+	for _, sessionID := range sessionIDs {
+		if err := g.Flush(sessionID); err != nil {
+			logger.Error("Failed to flush transcript lines to GCS", "sessionID", sessionID, "error", err)
+		}
+	}
+}
+
+// WriteTranscriptLine buffers a JSON line for the session transcript object; it is appended on the next flush
+func (g *GCSStorage) WriteTranscriptLine(sessionID string, line []byte) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.pending[sessionID])+len(line)+1 > gcsMaxPendingBytes {
+		return fmt.Errorf("transcript buffer for session %s is full, GCS flushes are failing", sessionID)
+	}
+	g.pending[sessionID] = append(append(g.pending[sessionID], line...), '\n')
+	return nil
+}
+
+// Flush appends the lines buffered for a session to its transcript object.
+// On failure the lines are put back in front of those buffered since, so no line is lost or reordered.
+func (g *GCSStorage) Flush(sessionID string) error {
+	g.flushMu.Lock()
+	defer g.flushMu.Unlock()
+
+	g.mu.Lock()
+	lines := g.pending[sessionID]
+	delete(g.pending, sessionID)
+	g.mu.Unlock()
+	if len(lines) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), gcsRequestTimeout)
+	defer cancel()
+	if err := g.appendObject(ctx, g.objectName(sessionID, ".jsonl"), lines); err != nil {
+		g.mu.Lock()
+		g.pending[sessionID] = append(lines, g.pending[sessionID]...)
+		g.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// appendObject appends content to the named object, creating it when missing
+func (g *GCSStorage) appendObject(ctx context.Context, name string, content []byte) error {
+	existing, err := g.service.Objects.Get(g.bucket, name).Context(ctx).Do()
+	if isNotFoundError(err) {
+		return g.upload(ctx, name, "application/x-ndjson", content)
+	}
+	if err != nil {
+		return fmt.Errorf("error reading transcript object: %v", err)
+	}
+
+	// A composite object cannot grow forever: rewrite it as a single object before hitting the limit
+	if existing.ComponentCount >= gcsMaxComponents {
+		resp, err := g.service.Objects.Get(g.bucket, name).Context(ctx).Download()
+		if err != nil {
+			return fmt.Errorf("error downloading transcript object: %v", err)
+		}
+		defer resp.Body.Close()
+		previous, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("error downloading transcript object: %v", err)
+		}
+		return g.upload(ctx, name, "application/x-ndjson", append(previous, content...))
+	}
+
+	partName := fmt.Sprintf("%s.part-%d", name, time.Now().UnixNano())
+	if err := g.upload(ctx, partName, "application/x-ndjson", content); err != nil {
+		return err
+	}
+	defer func() {
+		if err := g.service.Objects.Delete(g.bucket, partName).Context(ctx).Do(); err != nil {
+			logger.Warn("Failed to delete transcript part object", "object", partName, "error", err)
+		}
+	}()
+
+	compose := &storage.ComposeRequest{
+		SourceObjects: []*storage.ComposeRequestSourceObjects{
+			{Name: name, Generation: existing.Generation},
+			{Name: partName},
+		},
+		Destination: &storage.Object{ContentType: "application/x-ndjson"},
+	}
+	// Fail rather than lose lines if another writer replaced the object in the meantime
+	if _, err := g.service.Objects.Compose(g.bucket, name, compose).IfGenerationMatch(existing.Generation).Context(ctx).Do(); err != nil {
+		return fmt.Errorf("error composing transcript object: %v", err)
+	}
+	return nil
+}
+
+// WriteSessionSummary replaces the session summary object
+func (g *GCSStorage) WriteSessionSummary(sessionID, summary string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), gcsRequestTimeout)
+	defer cancel()
+	return g.upload(ctx, g.objectName(sessionID, ".summary.md"), "text/markdown; charset=utf-8", []byte(summary))
+}
+
+// OpenTranscript flushes the lines buffered for the session, then opens its transcript object
+func (g *GCSStorage) OpenTranscript(sessionID string) (io.ReadCloser, error) {
+	if err := g.Flush(sessionID); err != nil {
+		logger.Warn("Reading transcript without its buffered lines", "sessionID", sessionID, "error", err)
+	}
+	return g.download(context.Background(), g.objectName(sessionID, ".jsonl"))
+}
+
+// ReadSessionSummary downloads the session summary object
+func (g *GCSStorage) ReadSessionSummary(sessionID string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), gcsRequestTimeout)
+	defer cancel()
+	body, err := g.download(ctx, g.objectName(sessionID, ".summary.md"))
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	summary, err := io.ReadAll(body)
+	if err != nil {
+		return "", fmt.Errorf("error downloading summary object: %v", err)
+	}
+	return string(summary), nil
+}
+
+// Close flushes every buffered line and stops the background flushes
+func (g *GCSStorage) Close() error {
+	g.closeOnce.Do(func() { close(g.stop) })
+	<-g.done
+	return nil
+}
+
+// download opens the named object; a missing object returns an error satisfying os.IsNotExist
+func (g *GCSStorage) download(ctx context.Context, name string) (io.ReadCloser, error) {
+	resp, err := g.service.Objects.Get(g.bucket, name).Context(ctx).Download()
+	if isNotFoundError(err) {
+		return nil, &os.PathError{Op: "open", Path: "gs://" + g.bucket + "/" + name, Err: os.ErrNotExist}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error downloading %s: %v", name, err)
+	}
+	return resp.Body, nil
+}
+
+// upload writes content to the named object, replacing it if it exists
+func (g *GCSStorage) upload(ctx context.Context, name, contentType string, content []byte) error {
+	object := &storage.Object{Name: name, ContentType: contentType}
+	if _, err := g.service.Objects.Insert(g.bucket, object).Media(bytes.NewReader(content)).Context(ctx).Do(); err != nil {
+		return fmt.Errorf("error uploading %s: %v", name, err)
+	}
+	return nil
+}
+
+// isNotFoundError reports whether err is a Google API 404
+func isNotFoundError(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
+
+// appendTranscriptRecord appends a record to the session transcript through the storage backend
+func appendTranscriptRecord(sessionID string, record TranscriptRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("error marshaling session record: %v", err)
+	}
+	return storageBackend.WriteTranscriptLine(sessionID, line)
+}
+
+// appendSessionEvent appends an event to the session event log file when persistence is enabled
+func appendSessionEvent(sessionID string, event SessionEvent) error {
+	return appendSessionLine(sessionID, ".events.jsonl", event)
+}
+
+// appendSessionLine appends v as a JSON line to the session file with the given suffix when persistence is enabled
+func appendSessionLine(sessionID, suffix string, v interface{}) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("error marshaling session record: %v", err)
+	}
+	return appendSessionFileLine(sessionID, suffix, line)
+}
+
+// appendSessionFileLine appends a line to the local session file with the given suffix when persistence is enabled
+func appendSessionFileLine(sessionID, suffix string, line []byte) error {
+	dir := getTranscriptDirectory()
+	if dir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating transcript directory: %v", err)
+	}
+
+	f, err := os.OpenFile(sessionFilePath(dir, sessionID, suffix), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening session file: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("error writing session record: %v", err)
+	}
+	return nil
+}
+
+// writeSessionSummary writes the latest summary through the storage backend
+func writeSessionSummary(sessionID, summary string) error {
+	return storageBackend.WriteSessionSummary(sessionID, summary)
+}
+
+// writeSessionMetadata writes the session metadata as JSON when persistence is enabled
+func writeSessionMetadata(metadata SessionMetadata) error {
+	dir := getTranscriptDirectory()
+	if dir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating transcript directory: %v", err)
+	}
+
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling session metadata: %v", err)
+	}
+	if err := os.WriteFile(sessionFilePath(dir, metadata.SessionID, ".meta.json"), data, 0644); err != nil {
+		return fmt.Errorf("error writing metadata file: %v", err)
+	}
+	return nil
+}
+
+// writeSessionTags writes the session tags as JSON when persistence is enabled
+func writeSessionTags(sessionID string, tags []string) error {
+	dir := getTranscriptDirectory()
+	if dir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating transcript directory: %v", err)
+	}
+
+	data, err := json.Marshal(SessionTags{Tags: tags})
+	if err != nil {
+		return fmt.Errorf("error marshaling session tags: %v", err)
+	}
+	if err := os.WriteFile(sessionFilePath(dir, sessionID, ".tags.json"), data, 0644); err != nil {
+		return fmt.Errorf("error writing tags file: %v", err)
+	}
+	return nil
+}
+
+// loadSessionTags reads the persisted tags of a session; a session without a tags file has no tags
+func loadSessionTags(sessionID string) ([]string, error) {
+	dir := getTranscriptDirectory()
+	if dir == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(sessionFilePath(dir, sessionID, ".tags.json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading tags file: %v", err)
+	}
+	var tags SessionTags
+	if err := json.Unmarshal(data, &tags); err != nil {
+		return nil, fmt.Errorf("error parsing tags file: %v", err)
+	}
+	return tags.Tags, nil
+}
+
+// persistedSessionExists reports whether a session's metadata was persisted to the transcript directory
+// or its transcript to the storage backend
+func persistedSessionExists(sessionID string) bool {
+	if dir := getTranscriptDirectory(); dir != "" {
+		if _, err := os.Stat(sessionFilePath(dir, sessionID, ".meta.json")); err == nil {
+			return true
+		}
+	}
+	return persistedTranscriptExists(sessionID)
+}
+
+// persistedTranscriptExists reports whether the storage backend holds a transcript for the session
+func persistedTranscriptExists(sessionID string) bool {
+	transcript, err := storageBackend.OpenTranscript(sessionID)
+	if err != nil {
+		return false
+	}
+	transcript.Close()
+	return true
+}
+
+// listPersistedTags returns the tags of every persisted session
+func listPersistedTags() ([]string, error) {
+	dir := getTranscriptDirectory()
+	if dir == "" {
+		return nil, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.tags.json"))
+	if err != nil {
+		return nil, err
+	}
+	var all []string
+	for _, file := range files {
+		tags, err := loadSessionTags(strings.TrimSuffix(filepath.Base(file), ".tags.json"))
+		if err != nil {
+			logger.Warn("Skipping unreadable tags file", "file", file, "error", err)
+			continue
+		}
+		all = append(all, tags...)
+	}
+	return all, nil
+}
+
+// loadPersistedSession reads a completed session: its metadata from the transcript directory, and its transcript
+// and summary from the storage backend. A session known only to the backend gets metadata holding just its ID.
+func loadPersistedSession(sessionID string) (*SessionArchive, error) {
+	archive := &SessionArchive{Metadata: SessionMetadata{SessionID: sessionID}}
+
+	metadataFound := false
+	if dir := getTranscriptDirectory(); dir != "" {
+		metadata, err := os.ReadFile(sessionFilePath(dir, sessionID, ".meta.json"))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			if err := json.Unmarshal(metadata, &archive.Metadata); err != nil {
+				return nil, fmt.Errorf("error parsing session metadata: %v", err)
+			}
+			metadataFound = true
+		}
+	}
+
+	transcript, err := storageBackend.OpenTranscript(sessionID)
+	switch {
+	case os.IsNotExist(err):
+		if !metadataFound {
+			return nil, err
+		}
+	case err != nil:
+		return nil, fmt.Errorf("error opening transcript: %v", err)
+	default:
+		defer transcript.Close()
+		scanner := bufio.NewScanner(transcript)
+		scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+		for scanner.Scan() {
+			var record TranscriptRecord
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				logger.Warn("Skipping malformed transcript record", "sessionID", sessionID, "error", err)
+				continue
+			}
+			switch {
+			case record.Type == "segment" && record.Segment != nil:
+				archive.Segments = append(archive.Segments, *record.Segment)
+			case record.Type == "chapter" && record.Chapter != nil:
+				archive.Chapters = append(archive.Chapters, *record.Chapter)
+			case (record.Type == "retranscribed" || record.Type == "punctuated" || record.Type == "corrected") && record.Segment != nil:
+				if index := record.Segment.Index; index >= 0 && index < len(archive.Segments) {
+					archive.Segments[index] = *record.Segment
+				}
+			case record.Type == "batch_reprocessed":
+				// The segments that follow replace everything streamed before
+				archive.Segments = nil
+			case record.Type == "session_reset":
+				// An operator cleared the session; only what follows belongs to it
+				archive.Segments = nil
+				archive.Chapters = nil
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("error reading transcript: %v", err)
+		}
+	}
+
+	summary, err := storageBackend.ReadSessionSummary(sessionID)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading summary: %v", err)
+	}
+	archive.Summary = summary
+
+	// Rebuild the full transcript from the persisted segments; a correction spanning segments can empty some
+	var texts []string
+	for _, segment := range archive.Segments {
+		if text := strings.TrimSpace(segment.Text); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	archive.Transcript = strings.Join(texts, " ")
+
+	return archive, nil
+}
+
+// loadSessionEvents reads the event log of a completed session from the transcript directory
+func loadSessionEvents(sessionID string) ([]SessionEvent, error) {
+	dir := getTranscriptDirectory()
+	if dir == "" {
+		return nil, os.ErrNotExist
+	}
+
+	f, err := os.Open(sessionFilePath(dir, sessionID, ".events.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []SessionEvent
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		var event SessionEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			logger.Warn("Skipping malformed session event", "sessionID", sessionID, "error", err)
+			continue
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading event log file: %v", err)
+	}
+	return events, nil
+}
+
+// ReplaySession sends the transcription and summary messages of a persisted session through send,
+// preserving the original time between records divided by speed (0 replays instantly)
+func ReplaySession(ctx context.Context, sessionID string, speed float64, send func(v interface{}) error) error {
+	transcript, err := storageBackend.OpenTranscript(sessionID)
+	if err != nil {
+		return err
+	}
+	defer transcript.Close()
+
+	var records []TranscriptRecord
+	scanner := bufio.NewScanner(transcript)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		var record TranscriptRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			logger.Warn("Skipping malformed transcript record", "sessionID", sessionID, "error", err)
+			continue
+		}
+		switch {
+		case (record.Type == "segment" && record.Segment != nil) || record.Type == "summary":
+			records = append(records, record)
+		case record.Type == "session_reset":
+			records = nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading transcript file: %v", err)
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Timestamp.Before(records[j].Timestamp)
+	})
+
+	for i, record := range records {
+		if i > 0 && speed > 0 {
+			delay := time.Duration(float64(record.Timestamp.Sub(records[i-1].Timestamp)) / speed)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+
+		var message interface{}
+		switch record.Type {
+		case "segment":
+			message = TranscriptionResponse{
+				Type:             "transcription",
+				Text:             record.Segment.Text,
+				Timestamp:        Timestamp{Time: time.Now()},
+				Final:            true,
+				DetectedLanguage: record.Segment.Language,
+			}
+		case "summary":
+			message = SummaryResponse{
+				Type:      "summary",
+				Text:      record.Text,
+				Timestamp: Timestamp{Time: time.Now()},
+			}
+		}
+		if err := send(message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findSessionArchive returns the archive of a live session, falling back to persisted sessions
+func findSessionArchive(sessionID string) (*SessionArchive, error) {
+	if session, ok := sessionRegistry.Get(sessionID); ok {
+		return session.Archive(), nil
+	}
+	return loadPersistedSession(sessionID)
+}
+
+// newSegmentRecord wraps a segment in a transcript record
+func newSegmentRecord(segment TranscriptionSegment) TranscriptRecord {
+	return TranscriptRecord{
+		Type:      "segment",
+		Timestamp: time.Now(),
+		Segment:   &segment,
+	}
+}
@@ -0,0 +1,501 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/api/option"
+	storage "google.golang.org/api/storage/v1"
+)
+
+// memoryStorage is a StorageBackend keeping transcripts and summaries in memory
+type memoryStorage struct {
+	mu          sync.Mutex
+	transcripts map[string][]byte
+	summaries   map[string]string
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{transcripts: map[string][]byte{}, summaries: map[string]string{}}
+}
+
+func (m *memoryStorage) WriteTranscriptLine(sessionID string, line []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.transcripts[sessionID] = append(append(m.transcripts[sessionID], line...), '\n')
+	return nil
+}
+
+func (m *memoryStorage) WriteSessionSummary(sessionID, summary string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.summaries[sessionID] = summary
+	return nil
+}
+
+func (m *memoryStorage) OpenTranscript(sessionID string) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	transcript, ok := m.transcripts[sessionID]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: sessionID, Err: os.ErrNotExist}
+	}
+	return io.NopCloser(bytes.NewReader(transcript)), nil
+}
+
+func (m *memoryStorage) ReadSessionSummary(sessionID string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	summary, ok := m.summaries[sessionID]
+	if !ok {
+		return "", &os.PathError{Op: "open", Path: sessionID, Err: os.ErrNotExist}
+	}
+	return summary, nil
+}
+
+func (m *memoryStorage) Flush(string) error { return nil }
+
+func (m *memoryStorage) Close() error { return nil }
+
+// useStorageBackend swaps the global storage backend and TRANSCRIPT_DIR for the duration of a test
+func useStorageBackend(t *testing.T, backend StorageBackend, transcriptDir string) {
+	t.Helper()
+	previous := storageBackend
+	storageBackend = backend
+	t.Cleanup(func() { storageBackend = previous })
+	t.Setenv("TRANSCRIPT_DIR", transcriptDir)
+}
+
+func TestLoadPersistedSessionFromBackend(t *testing.T) {
+	segment := func(index int, text string) TranscriptRecord {
+		return newSegmentRecord(TranscriptionSegment{Index: index, Text: text})
+	}
+	tests := []struct {
+		name           string
+		records        []TranscriptRecord
+		summary        string
+		writeMetadata  bool
+		wantErr        bool
+		wantTranscript string
+	}{
+		{"transcript and summary", []TranscriptRecord{segment(0, "hello"), segment(1, "world")}, "greeting", true, false, "hello world"},
+		{"backend only", []TranscriptRecord{segment(0, "remote")}, "", false, false, "remote"},
+		{"metadata only", nil, "", true, false, ""},
+		{"unknown session", nil, "", false, true, ""},
+		{"punctuation replaces a segment", []TranscriptRecord{segment(0, "hello world"), {Type: "punctuated", Segment: &TranscriptionSegment{Index: 0, Text: "Hello, world."}}}, "", true, false, "Hello, world."},
+		{"correction replaces a segment", []TranscriptRecord{segment(0, "we use Cuban Eddies"), segment(1, "on prem"), {Type: "corrected", Segment: &TranscriptionSegment{Index: 0, Text: "we use Kubernetes"}}}, "", true, false, "we use Kubernetes on prem"},
+		{"correction spanning segments", []TranscriptRecord{segment(0, "we use Cuban Eddies"), segment(1, "and more"),
+			{Type: "corrected", Segment: &TranscriptionSegment{Index: 0, Text: "we use Cuban"}},
+			{Type: "corrected", Segment: &TranscriptionSegment{Index: 1, Text: "Eddies, and more"}}}, "", true, false, "we use Cuban Eddies, and more"},
+		{"correction emptying a segment", []TranscriptRecord{segment(0, "one"), segment(1, "two"), segment(2, "three"),
+			{Type: "corrected", Segment: &TranscriptionSegment{Index: 1, Text: ""}},
+			{Type: "corrected", Segment: &TranscriptionSegment{Index: 2, Text: "3"}}}, "", true, false, "one 3"},
+		{"batch reprocessing replaces segments", []TranscriptRecord{segment(0, "draft"), {Type: "batch_reprocessed"}, segment(0, "final")}, "", true, false, "final"},
+		{"session reset drops earlier segments", []TranscriptRecord{segment(0, "rehearsal"), {Type: "session_reset"}, segment(0, "meeting")}, "", true, false, "meeting"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newMemoryStorage()
+			dir := t.TempDir()
+			useStorageBackend(t, backend, dir)
+
+			const sessionID = "session-1"
+			for _, record := range tt.records {
+				if err := appendTranscriptRecord(sessionID, record); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.summary != "" {
+				if err := writeSessionSummary(sessionID, tt.summary); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.writeMetadata {
+				if err := writeSessionMetadata(SessionMetadata{SessionID: sessionID}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			archive, err := loadPersistedSession(sessionID)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadPersistedSession() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !os.IsNotExist(err) {
+					t.Errorf("error = %v, want a not-exist error", err)
+				}
+				if persistedSessionExists(sessionID) {
+					t.Error("persistedSessionExists() = true for an unknown session")
+				}
+				return
+			}
+			if archive.Transcript != tt.wantTranscript || archive.Summary != tt.summary || archive.Metadata.SessionID != sessionID {
+				t.Errorf("archive = %q / %q / %q, want %q / %q / %q",
+					archive.Transcript, archive.Summary, archive.Metadata.SessionID, tt.wantTranscript, tt.summary, sessionID)
+			}
+			if !persistedSessionExists(sessionID) {
+				t.Error("persistedSessionExists() = false for a persisted session")
+			}
+		})
+	}
+}
+
+// fakeGCS serves the subset of the GCS JSON API used by GCSStorage from memory
+type fakeGCS struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	requests map[string]int // Count per "METHOD kind"
+	fail     bool
+}
+
+func (f *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	const objectsPath = "/storage/v1/b/bucket/o/"
+	switch {
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/upload/"):
+		f.requests["upload"]++
+		_, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		reader := multipart.NewReader(r.Body, params["boundary"])
+		metadataPart, _ := reader.NextPart()
+		var object storage.Object
+		json.NewDecoder(metadataPart).Decode(&object)
+		mediaPart, _ := reader.NextPart()
+		content, _ := io.ReadAll(mediaPart)
+		f.objects[object.Name] = content
+		json.NewEncoder(w).Encode(&storage.Object{Name: object.Name, Generation: 1})
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/compose"):
+		f.requests["compose"]++
+		name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, objectsPath), "/compose")
+		var compose storage.ComposeRequest
+		json.NewDecoder(r.Body).Decode(&compose)
+		var content []byte
+		for _, source := range compose.SourceObjects {
+			content = append(content, f.objects[source.Name]...)
+		}
+		f.objects[name] = content
+		json.NewEncoder(w).Encode(&storage.Object{Name: name, Generation: 2})
+	case r.Method == http.MethodDelete:
+		delete(f.objects, strings.TrimPrefix(r.URL.Path, objectsPath))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet:
+		name := strings.TrimPrefix(r.URL.Path, objectsPath)
+		content, ok := f.objects[name]
+		if !ok {
+			http.Error(w, `{"error":{"code":404,"message":"not found"}}`, http.StatusNotFound)
+			return
+		}
+		if r.URL.Query().Get("alt") == "media" {
+			w.Write(content)
+			return
+		}
+		json.NewEncoder(w).Encode(&storage.Object{Name: name, Generation: 1, ComponentCount: 1})
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+// newTestGCSStorage creates a GCS backend talking to a fake GCS server, with background flushes effectively disabled
+func newTestGCSStorage(t *testing.T) (*GCSStorage, *fakeGCS) {
+	t.Helper()
+	fake := &fakeGCS{objects: map[string][]byte{}, requests: map[string]int{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	service, err := storage.NewService(context.Background(),
+		option.WithEndpoint(server.URL+"/storage/v1/"),
+		option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := newGCSStorage(service, "bucket", "prefix", time.Hour)
+	t.Cleanup(func() { backend.Close() })
+	return backend, fake
+}
+
+func TestGCSStorageBatchesTranscriptLines(t *testing.T) {
+	tests := []struct {
+		name         string
+		batches      [][]string
+		wantUploads  int
+		wantComposes int
+	}{
+		{"single batch creates the object", [][]string{{"a", "b", "c"}}, 1, 0},
+		{"later batches are composed", [][]string{{"a"}, {"b", "c"}, {"d"}}, 3, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend, fake := newTestGCSStorage(t)
+			var want string
+			for _, batch := range tt.batches {
+				for _, line := range batch {
+					if err := backend.WriteTranscriptLine("s1", []byte(line)); err != nil {
+						t.Fatal(err)
+					}
+					want += line + "\n"
+				}
+				if err := backend.Flush("s1"); err != nil {
+					t.Fatalf("Flush() error = %v", err)
+				}
+			}
+
+			transcript, err := backend.OpenTranscript("s1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ := io.ReadAll(transcript)
+			transcript.Close()
+			if string(got) != want {
+				t.Errorf("transcript = %q, want %q", got, want)
+			}
+			if fake.requests["upload"] != tt.wantUploads || fake.requests["compose"] != tt.wantComposes {
+				t.Errorf("uploads, composes = %d, %d; want %d, %d",
+					fake.requests["upload"], fake.requests["compose"], tt.wantUploads, tt.wantComposes)
+			}
+		})
+	}
+}
+
+func TestGCSStorageRetriesFailedFlushes(t *testing.T) {
+	backend, fake := newTestGCSStorage(t)
+	backend.WriteTranscriptLine("s1", []byte("first"))
+
+	fake.mu.Lock()
+	fake.fail = true
+	fake.mu.Unlock()
+	if err := backend.Flush("s1"); err == nil {
+		t.Fatal("Flush() succeeded against a failing server")
+	}
+	backend.WriteTranscriptLine("s1", []byte("second"))
+
+	fake.mu.Lock()
+	fake.fail = false
+	fake.mu.Unlock()
+	if err := backend.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(fake.objects["prefix/s1.jsonl"]); got != "first\nsecond\n" {
+		t.Errorf("transcript after retry = %q, want both lines in order", got)
+	}
+	if _, err := backend.OpenTranscript("missing"); !os.IsNotExist(err) {
+		t.Errorf("OpenTranscript(missing) error = %v, want a not-exist error", err)
+	}
+}
+
+func TestGCSStorageBoundsBufferedLines(t *testing.T) {
+	backend, _ := newTestGCSStorage(t)
+	line := bytes.Repeat([]byte("x"), gcsMaxPendingBytes/2)
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{"first half", false},
+		{"over the limit", true},
+	}
+	for _, tt := range tests {
+		if err := backend.WriteTranscriptLine("s1", line); (err != nil) != tt.wantErr {
+			t.Errorf("%s: WriteTranscriptLine() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestTranscriptRotatorRotate(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	// Sessions from oldest to newest, with two files of 100 bytes each
+	sessions := []struct {
+		id  string
+		age time.Duration
+	}{
+		{"old", 10 * 24 * time.Hour},
+		{"live", 9 * 24 * time.Hour},
+		{"recent", time.Hour},
+	}
+	tests := []struct {
+		name         string
+		archive      bool
+		retention    time.Duration
+		maxBytes     int64
+		blockArchive string // A directory in the archive named like this file makes moving it fail
+		wantRotated  []string
+	}{
+		{"retention deletes expired sessions", false, 7 * 24 * time.Hour, 0, "", []string{"old"}},
+		{"retention archives expired sessions", true, 7 * 24 * time.Hour, 0, "", []string{"old"}},
+		{"size limit removes the oldest first", false, 0, 400, "", []string{"old"}},
+		{"nothing to rotate", false, 30 * 24 * time.Hour, 0, "", nil},
+		{"failed move restores the session", true, 7 * 24 * time.Hour, 0, "old.summary.md", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			var archiveDir string
+			if tt.archive {
+				archiveDir = filepath.Join(t.TempDir(), "archive")
+			}
+			for _, session := range sessions {
+				for _, name := range []string{session.id + ".jsonl", session.id + ".summary.md"} {
+					path := filepath.Join(dir, name)
+					if err := os.WriteFile(path, bytes.Repeat([]byte("x"), 100), 0644); err != nil {
+						t.Fatal(err)
+					}
+					if err := os.Chtimes(path, now.Add(-session.age), now.Add(-session.age)); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			if tt.blockArchive != "" {
+				if err := os.MkdirAll(filepath.Join(archiveDir, tt.blockArchive, "occupied"), 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			live := newSession(func() {}, ConfigMessage{})
+			live.ID = "live"
+			sessionRegistry.Register(live)
+			defer sessionRegistry.Unregister(live.ID)
+
+			if err := NewTranscriptRotator(dir, archiveDir, tt.retention, tt.maxBytes).Rotate(now); err != nil {
+				t.Fatal(err)
+			}
+			for _, session := range sessions {
+				rotated := slices.Contains(tt.wantRotated, session.id)
+				for _, name := range []string{session.id + ".jsonl", session.id + ".summary.md"} {
+					if _, err := os.Stat(filepath.Join(dir, name)); (err == nil) == rotated {
+						t.Errorf("%s in the transcript directory = %v, want %v", name, err == nil, !rotated)
+					}
+					if archiveDir == "" || name == tt.blockArchive {
+						continue
+					}
+					if _, err := os.Stat(filepath.Join(archiveDir, name)); (err == nil) != rotated {
+						t.Errorf("%s in the archive = %v, want %v", name, err == nil, rotated)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestMoveFile(t *testing.T) {
+	tests := []struct {
+		name        string
+		source      bool
+		destination string
+		wantErr     bool
+	}{
+		{"renamed", true, "moved.jsonl", false},
+		{"missing source", false, "moved.jsonl", true},
+		{"missing destination directory", true, filepath.Join("missing", "moved.jsonl"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			source, destination := filepath.Join(dir, "session.jsonl"), filepath.Join(dir, tt.destination)
+			if tt.source {
+				if err := os.WriteFile(source, []byte("{}\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := moveFile(source, destination)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("moveFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			// Only a cross-device rename falls back to copying, so a failed move leaves no copy behind
+			if _, statErr := os.Stat(destination); (statErr == nil) == tt.wantErr {
+				t.Errorf("destination exists = %v, want %v", statErr == nil, !tt.wantErr)
+			}
+			if _, statErr := os.Stat(source); tt.source && (statErr == nil) != tt.wantErr {
+				t.Errorf("source exists = %v, want %v", statErr == nil, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReplaySession(t *testing.T) {
+	// testdata/replay_session.jsonl has records out of timestamp order, a chapter, a truncated line and a segment record without its segment
+	useStorageBackend(t, LocalStorage{}, "testdata")
+	wantMessages := []string{
+		"transcription en-US welcome to the weekly sync",
+		"transcription fr-FR le budget est validé",
+		"transcription en-US the launch moves to April",
+		"summary Budget approved; launch moved to April.",
+	}
+	describe := func(v interface{}) string {
+		switch message := v.(type) {
+		case TranscriptionResponse:
+			if !message.Final {
+				t.Errorf("replayed transcription %q is not final", message.Text)
+			}
+			return message.Type + " " + message.DetectedLanguage + " " + message.Text
+		case SummaryResponse:
+			return message.Type + " " + message.Text
+		}
+		return fmt.Sprintf("unexpected %T", v)
+	}
+
+	t.Run("instant", func(t *testing.T) {
+		var got []string
+		err := ReplaySession(context.Background(), "replay_session", 0, func(v interface{}) error {
+			got = append(got, describe(v))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, wantMessages) {
+			t.Errorf("replayed %q, want %q", got, wantMessages)
+		}
+	})
+
+	t.Run("paced by speed", func(t *testing.T) {
+		// The records span 6 seconds; at 200x the replay takes at least 30ms
+		start := time.Now()
+		if err := ReplaySession(context.Background(), "replay_session", 200, func(interface{}) error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+		if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+			t.Errorf("replay took %v, want at least 30ms", elapsed)
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		sent := 0
+		err := ReplaySession(ctx, "replay_session", 0.001, func(interface{}) error {
+			sent++
+			cancel()
+			return nil
+		})
+		if err != context.Canceled || sent != 1 {
+			t.Errorf("ReplaySession() = %v after %d messages, want context.Canceled after 1", err, sent)
+		}
+	})
+
+	t.Run("send error", func(t *testing.T) {
+		failed := errors.New("client gone")
+		if err := ReplaySession(context.Background(), "replay_session", 0, func(interface{}) error { return failed }); err != failed {
+			t.Errorf("ReplaySession() = %v, want %v", err, failed)
+		}
+	})
+
+	t.Run("missing session", func(t *testing.T) {
+		if err := ReplaySession(context.Background(), "missing", 0, func(interface{}) error { return nil }); !os.IsNotExist(err) {
+			t.Errorf("ReplaySession() = %v, want a not-exist error", err)
+		}
+	})
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Formats accepted and produced by the transcoding endpoint
+const (
+	transcodeSourceMP3 = "mp3"
+	transcodeSourceAAC = "aac"
+	transcodeSourceWAV = "wav"
+
+	transcodeTargetWebMOpus = "webm_opus"
+	transcodeTargetLinear16 = "linear16"
+)
+
+// Transcoded files kept for repeated uploads: at most this many, and at most this many bytes in total
+const (
+	transcodeCacheEntries  = 16
+	transcodeCacheMaxBytes = 64 << 20
+)
+
+// Transcoding defaults, overridden by initTranscoder
+const defaultTranscodeTimeout = 2 * time.Minute
+
+// errTranscodeBusy is returned when no ffmpeg slot frees up before the request gives up
+var errTranscodeBusy = errors.New("too many transcodings in progress")
+
+// transcodeSlots bounds the number of concurrent ffmpeg processes; set by initTranscoder
+var transcodeSlots = make(chan struct{}, runtime.NumCPU())
+
+// transcodeTimeout bounds each transcoding, including the wait for an ffmpeg slot
+var transcodeTimeout = defaultTranscodeTimeout
+
+// initTranscoder configures transcoding from TRANSCODE_MAX_CONCURRENT and TRANSCODE_TIMEOUT_MS
+func initTranscoder() {
+	if concurrent := int(getEnvInt64("TRANSCODE_MAX_CONCURRENT", int64(runtime.NumCPU()))); concurrent > 0 {
+		transcodeSlots = make(chan struct{}, concurrent)
+	}
+	if timeout := time.Duration(getEnvInt64("TRANSCODE_TIMEOUT_MS", defaultTranscodeTimeout.Milliseconds())) * time.Millisecond; timeout > 0 {
+		transcodeTimeout = timeout
+	}
+}
+
+// transcodeInputFormats maps source formats to the ffmpeg demuxer reading them
+var transcodeInputFormats = map[string]string{
+	transcodeSourceMP3: "mp3",
+	transcodeSourceAAC: "aac",
+	transcodeSourceWAV: "wav",
+}
+
+// TranscodeCache keeps the output of recent transcodings, keyed by input hash and output settings
+type TranscodeCache struct {
+	mu       sync.Mutex
+	entries  map[string][]byte
+	order    []string // Keys from oldest to newest, evicted first to last
+	limit    int
+	maxBytes int
+	size     int
+}
+
+// transcodeCache holds the server-wide transcoding results
+var transcodeCache = NewTranscodeCache(transcodeCacheEntries, transcodeCacheMaxBytes)
+
+// NewTranscodeCache creates a cache holding at most limit outputs totalling at most maxBytes
+func NewTranscodeCache(limit, maxBytes int) *TranscodeCache {
+	return &TranscodeCache{entries: make(map[string][]byte), limit: limit, maxBytes: maxBytes}
+}
+
+// Get returns the cached output for key
+func (c *TranscodeCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	output, ok := c.entries[key]
+	return output, ok
+}
+
+// Put stores an output, evicting the oldest ones until it fits; an output larger than the whole cache is not stored
+func (c *TranscodeCache) Put(key string, output []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; ok || len(output) > c.maxBytes {
+		return
+	}
+	for len(c.order) > 0 && (len(c.order) >= c.limit || c.size+len(output) > c.maxBytes) {
+		c.size -= len(c.entries[c.order[0]])
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.entries[key] = output
+	c.order = append(c.order, key)
+	c.size += len(output)
+}
+
+// transcodeCacheKey identifies a transcoding by the input content and the requested output
+func transcodeCacheKey(input []byte, source, target string, sampleRate int) string {
+	sum := sha256.Sum256(input)
+	return fmt.Sprintf("%s:%s:%s:%d", hex.EncodeToString(sum[:]), source, target, sampleRate)
+}
+
+// transcodeArgs returns the ffmpeg arguments converting source audio on stdin to target audio on stdout
+func transcodeArgs(source, target string, sampleRate int) ([]string, error) {
+	demuxer, ok := transcodeInputFormats[source]
+	if !ok {
+		return nil, fmt.Errorf("unsupported format %q (expected %s, %s or %s)", source, transcodeSourceMP3, transcodeSourceAAC, transcodeSourceWAV)
+	}
+	args := []string{"-hide_banner", "-loglevel", "error", "-f", demuxer, "-i", "pipe:0", "-vn", "-ac", "1"}
+	switch target {
+	case transcodeTargetWebMOpus:
+		// Opus only supports a few rates; 48kHz is what browsers produce
+		return append(args, "-c:a", "libopus", "-ar", "48000", "-f", "webm", "pipe:1"), nil
+	case transcodeTargetLinear16:
+		return append(args, "-c:a", "pcm_s16le", "-ar", strconv.Itoa(sampleRate), "-f", "s16le", "pipe:1"), nil
+	}
+	return nil, fmt.Errorf("unsupported target_format %q (expected %s or %s)", target, transcodeTargetWebMOpus, transcodeTargetLinear16)
+}
+
+// ffmpegPath returns the ffmpeg executable from FFMPEG_PATH, or from PATH when unset
+func ffmpegPath() (string, error) {
+	path := os.Getenv("FFMPEG_PATH")
+	if path == "" {
+		path = "ffmpeg"
+	}
+	return exec.LookPath(path)
+}
+
+// transcodeAudio converts input with ffmpeg, reusing the cached output of an identical request.
+// At most TRANSCODE_MAX_CONCURRENT ffmpeg processes run at once; the wait for one and the run are bounded by TRANSCODE_TIMEOUT_MS.
+func transcodeAudio(ctx context.Context, input []byte, source, target string, sampleRate int) ([]byte, error) {
+	args, err := transcodeArgs(source, target, sampleRate)
+	if err != nil {
+		return nil, err
+	}
+	key := transcodeCacheKey(input, source, target, sampleRate)
+	if output, ok := transcodeCache.Get(key); ok {
+		logger.Debug("Transcoded audio served from cache", "format", source, "targetFormat", target)
+		return output, nil
+	}
+
+	path, err := ffmpegPath()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, transcodeTimeout)
+	defer cancel()
+	select {
+	case transcodeSlots <- struct{}{}:
+		defer func() { <-transcodeSlots }()
+	case <-ctx.Done():
+		return nil, errTranscodeBusy
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("transcoding interrupted: %w", ctx.Err())
+		}
+		return nil, &transcodeError{err: err, stderr: strings.TrimSpace(stderr.String())}
+	}
+	if stdout.Len() == 0 {
+		return nil, &transcodeError{err: errors.New("no audio produced")}
+	}
+
+	transcodeCache.Put(key, stdout.Bytes())
+	return stdout.Bytes(), nil
+}
+
+// transcodeError reports an ffmpeg run that failed, usually because the input is not in the declared format
+type transcodeError struct {
+	err    error
+	stderr string
+}
+
+// Error implements the error interface
+func (e *transcodeError) Error() string {
+	if e.stderr == "" {
+		return fmt.Sprintf("transcoding failed: %v", e.err)
+	}
+	return fmt.Sprintf("transcoding failed: %v: %s", e.err, e.stderr)
+}
+
+// serveTranscode converts an uploaded MP3, AAC or WAV file into WebM Opus or LINEAR16 audio for the WebSocket stream.
+// The multipart form carries the file in "audio" and the formats in "format" and "target_format";
+// "sample_rate" sets the LINEAR16 output rate (default 16000).
+func serveTranscode(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	maxBytes := getEnvInt64("MAX_UPLOAD_BYTES", 50*1024*1024)
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeErrorResponse(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body exceeds %d bytes", maxBytesErr.Limit))
+			return
+		}
+		writeErrorResponse(w, http.StatusBadRequest, "Expected a multipart form with an audio file")
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	source := strings.ToLower(r.FormValue("format"))
+	target := strings.ToLower(r.FormValue("target_format"))
+	sampleRate := 16000
+	if value := r.FormValue("sample_rate"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < minResampleHz || parsed > maxResampleHz {
+			writeErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("sample_rate must be between %d and %d", minResampleHz, maxResampleHz))
+			return
+		}
+		sampleRate = parsed
+	}
+	if _, err := transcodeArgs(source, target, sampleRate); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	file, _, err := r.FormFile("audio")
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Missing audio file")
+		return
+	}
+	defer file.Close()
+	input, err := io.ReadAll(file)
+	if err != nil || len(input) == 0 {
+		writeErrorResponse(w, http.StatusBadRequest, "Empty audio file")
+		return
+	}
+
+	output, err := transcodeAudio(r.Context(), input, source, target, sampleRate)
+	var transcodeErr *transcodeError
+	switch {
+	case errors.Is(err, errTranscodeBusy):
+		logger.Warn("Audio transcoding rejected, no ffmpeg slot available", "timeout", transcodeTimeout)
+		w.Header().Set("Retry-After", "5")
+		writeErrorResponse(w, http.StatusServiceUnavailable, "Too many transcodings in progress, retry later")
+		return
+	case errors.Is(err, context.DeadlineExceeded):
+		logger.Warn("Audio transcoding timed out", "timeout", transcodeTimeout, "inputBytes", len(input))
+		writeErrorResponse(w, http.StatusGatewayTimeout, "Transcoding took too long")
+		return
+	case errors.Is(err, context.Canceled):
+		return // The client went away
+	case errors.As(err, &transcodeErr):
+		logger.Warn("Audio transcoding failed", "format", source, "targetFormat", target, "error", err)
+		writeErrorResponse(w, http.StatusUnprocessableEntity, fmt.Sprintf("Could not transcode the audio as %s", source))
+		return
+	case err != nil:
+		logger.Error("Audio transcoding unavailable", "error", err)
+		writeErrorResponse(w, http.StatusServiceUnavailable, "Transcoding is not available on this server")
+		return
+	}
+
+	logger.Info("Audio transcoded",
+		"format", source,
+		"targetFormat", target,
+		"inputBytes", len(input),
+		"outputBytes", len(output),
+		"remoteIP", clientIP(r))
+
+	if target == transcodeTargetWebMOpus {
+		w.Header().Set("Content-Type", "audio/webm")
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("X-Sample-Rate", strconv.Itoa(sampleRate))
+	}
+	w.Write(output)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTranscodeCacheBounds(t *testing.T) {
+	tests := []struct {
+		name      string
+		limit     int
+		maxBytes  int
+		puts      []int // Output sizes, stored under keys "0", "1", ...
+		wantKeys  []int
+		wantBytes int
+	}{
+		{"within bounds", 4, 100, []int{10, 20, 30}, []int{0, 1, 2}, 60},
+		{"entry limit evicts oldest", 2, 100, []int{10, 20, 30}, []int{1, 2}, 50},
+		{"byte limit evicts oldest", 4, 50, []int{20, 20, 20}, []int{1, 2}, 40},
+		{"large output evicts several", 4, 50, []int{10, 10, 10, 45}, []int{3}, 45},
+		{"output larger than cache is skipped", 4, 50, []int{10, 60}, []int{0}, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := NewTranscodeCache(tt.limit, tt.maxBytes)
+			for i, size := range tt.puts {
+				cache.Put(fmt.Sprint(i), make([]byte, size))
+			}
+			for _, i := range tt.wantKeys {
+				if _, ok := cache.Get(fmt.Sprint(i)); !ok {
+					t.Errorf("entry %d evicted, want it cached", i)
+				}
+			}
+			if len(cache.entries) != len(tt.wantKeys) || cache.size != tt.wantBytes {
+				t.Errorf("cache holds %d entries, %d bytes; want %d entries, %d bytes", len(cache.entries), cache.size, len(tt.wantKeys), tt.wantBytes)
+			}
+		})
+	}
+}
+
+func TestTranscodeArgs(t *testing.T) {
+	tests := []struct {
+		source, target string
+		wantErr        bool
+	}{
+		{transcodeSourceMP3, transcodeTargetWebMOpus, false},
+		{transcodeSourceWAV, transcodeTargetLinear16, false},
+		{"flac", transcodeTargetLinear16, true},
+		{transcodeSourceAAC, "mp3", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source+"_to_"+tt.target, func(t *testing.T) {
+			if _, err := transcodeArgs(tt.source, tt.target, 16000); (err != nil) != tt.wantErr {
+				t.Errorf("transcodeArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTranscodeAudioWaitsForSlot(t *testing.T) {
+	t.Setenv("FFMPEG_PATH", "true")
+	previousSlots, previousTimeout := transcodeSlots, transcodeTimeout
+	t.Cleanup(func() { transcodeSlots, transcodeTimeout = previousSlots, previousTimeout })
+	transcodeSlots = make(chan struct{}, 1)
+	transcodeTimeout = 50 * time.Millisecond
+
+	transcodeSlots <- struct{}{} // Another transcoding holds the only slot
+	_, err := transcodeAudio(context.Background(), []byte("busy input"), transcodeSourceWAV, transcodeTargetLinear16, 16000)
+	if !errors.Is(err, errTranscodeBusy) {
+		t.Errorf("transcodeAudio() with no free slot error = %v, want errTranscodeBusy", err)
+	}
+}
+
+// sineWAV encodes d of a 440Hz tone as a 16-bit mono WAV file
+func sineWAV(sampleRate int, d time.Duration) []byte {
+	samples := int(d.Seconds() * float64(sampleRate))
+	var wav bytes.Buffer
+	write := func(v interface{}) { binary.Write(&wav, binary.LittleEndian, v) }
+	wav.WriteString("RIFF")
+	write(uint32(36 + samples*2))
+	wav.WriteString("WAVEfmt ")
+	write(uint32(16))
+	write(uint16(1)) // PCM
+	write(uint16(1)) // Mono
+	write(uint32(sampleRate))
+	write(uint32(sampleRate * 2))
+	write(uint16(2))
+	write(uint16(16))
+	wav.WriteString("data")
+	write(uint32(samples * 2))
+	for i := 0; i < samples; i++ {
+		write(int16(8000 * math.Sin(2*math.Pi*440*float64(i)/float64(sampleRate))))
+	}
+	return wav.Bytes()
+}
+
+func TestTranscodeAudioWebMContainer(t *testing.T) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg is not on PATH")
+	}
+	t.Setenv("FFMPEG_PATH", "")
+
+	output, err := transcodeAudio(context.Background(), sineWAV(16000, time.Second), transcodeSourceWAV, transcodeTargetWebMOpus, 0)
+	if err != nil {
+		if strings.Contains(err.Error(), "libopus") {
+			t.Skipf("ffmpeg has no Opus encoder: %v", err)
+		}
+		t.Fatal(err)
+	}
+	// A WebM file is an EBML document whose header declares the "webm" DocType (element 0x4282, 4 bytes long)
+	if !bytes.HasPrefix(output, []byte{0x1A, 0x45, 0xDF, 0xA3}) {
+		t.Fatalf("output starts with % X, want the EBML magic 1A 45 DF A3", output[:min(len(output), 4)])
+	}
+	if header := output[:min(len(output), 64)]; !bytes.Contains(header, []byte{0x42, 0x82, 0x84, 'w', 'e', 'b', 'm'}) {
+		t.Errorf("EBML header % X does not declare the webm DocType", header)
+	}
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1"
+)
+
+// replaceLastOccurrence replaces the last case-insensitive occurrence of original in text with replacement.
+// It returns the updated text and the number of replacements made (0 or 1).
+func replaceLastOccurrence(text, original, replacement string) (string, int) {
+	start, end, ok := lastOccurrence(text, original)
+	if !ok {
+		return text, 0
+	}
+	return text[:start] + replacement + text[end:], 1
+}
+
+// lastOccurrence returns the byte range of the last case-insensitive occurrence of original in text
+func lastOccurrence(text, original string) (start, end int, ok bool) {
+	if original == "" {
+		return 0, 0, false
+	}
+
+	re, err := regexp.Compile("(?i)" + regexp.QuoteMeta(original))
+	if err != nil {
+		return 0, 0, false
+	}
+
+	matches := re.FindAllStringIndex(text, -1)
+	if len(matches) == 0 {
+		return 0, 0, false
+	}
+
+	last := matches[len(matches)-1]
+	return last[0], last[1], true
+}
+
+// correctSegments replaces the last case-insensitive occurrence of original in the segment texts joined by
+// spaces, which may span several segments. The last segment it spans gets the corrected text followed by the
+// rest of its own text, the first one keeps the text before the occurrence and those in between are emptied.
+// Word timings of the changed segments are dropped, as they belong to the replaced text. It returns the
+// indexes of the changed segments, none when original does not occur.
+func correctSegments(segments []TranscriptionSegment, original, corrected string) []int {
+	texts := make([]string, len(segments))
+	starts := make([]int, len(segments))
+	offset := 0
+	for i, segment := range segments {
+		texts[i] = strings.TrimSpace(segment.Text)
+		starts[i] = offset
+		offset += len(texts[i]) + 1
+	}
+	start, end, ok := lastOccurrence(strings.Join(texts, " "), original)
+	if !ok {
+		return nil
+	}
+
+	var changed []int
+	for i := range segments {
+		if starts[i] < end && starts[i]+len(texts[i]) > start {
+			changed = append(changed, i)
+		}
+	}
+	for n, i := range changed {
+		text := ""
+		if start > starts[i] {
+			text = texts[i][:start-starts[i]]
+		}
+		if n == len(changed)-1 {
+			text += corrected
+			if end < starts[i]+len(texts[i]) {
+				text += texts[i][end-starts[i]:]
+			}
+		}
+		segments[i].Text = strings.TrimSpace(text)
+		segments[i].Words = nil
+	}
+	return changed
+}
+
+// newTranscriptionSegment builds a segment from a final recognition alternative.
+// Word offsets reported by the Speech API are relative to the stream start, so streamOffset
+// (the stream start relative to the session start) is added to make them session-relative.
+func newTranscriptionSegment(alternative *speechpb.SpeechRecognitionAlternative, language string, sessionStart time.Time, streamOffset time.Duration) TranscriptionSegment {
+	now := time.Now()
+	segment := TranscriptionSegment{
+		Text:       alternative.Transcript,
+		Language:   language,
+		Confidence: alternative.Confidence,
+		StartTime:  now,
+		EndTime:    now,
+	}
+
+	for _, word := range alternative.Words {
+		segment.Words = append(segment.Words, WordTiming{
+			Word:       word.Word,
+			StartMs:    (streamOffset + word.StartTime.AsDuration()).Milliseconds(),
+			EndMs:      (streamOffset + word.EndTime.AsDuration()).Milliseconds(),
+			SpeakerTag: word.SpeakerTag,
+		})
+	}
+
+	if len(segment.Words) > 0 {
+		segment.StartTime = sessionStart.Add(time.Duration(segment.Words[0].StartMs) * time.Millisecond)
+		segment.EndTime = sessionStart.Add(time.Duration(segment.Words[len(segment.Words)-1].EndMs) * time.Millisecond)
+	}
+
+	return segment
+}
+
+// belowConfidenceThreshold reports whether a final result should be filtered out.
+// A threshold of 0 disables filtering; a confidence equal to the threshold is kept.
+func belowConfidenceThreshold(confidence, threshold float32) bool {
+	if threshold <= 0 {
+		return false
+	}
+	return confidence < threshold
+}
+
+// timelineEntries positions the words of a final segment relative to the session start.
+// Segments without word timings have their duration divided evenly across their words.
+func timelineEntries(segment TranscriptionSegment, sessionStart time.Time) []TimelineEntry {
+	if len(segment.Words) > 0 {
+		entries := make([]TimelineEntry, len(segment.Words))
+		for i, word := range segment.Words {
+			entries[i] = TimelineEntry{
+				Word:       word.Word,
+				StartMs:    word.StartMs,
+				EndMs:      word.EndMs,
+				SpeakerTag: word.SpeakerTag,
+				IsFinal:    true,
+			}
+		}
+		return entries
+	}
+
+	words := strings.Fields(segment.Text)
+	if len(words) == 0 {
+		return nil
+	}
+	startMs := segment.StartTime.Sub(sessionStart).Milliseconds()
+	durationMs := segment.EndTime.Sub(segment.StartTime).Milliseconds()
+	entries := make([]TimelineEntry, len(words))
+	for i, word := range words {
+		entries[i] = TimelineEntry{
+			Word:      word,
+			StartMs:   startMs + durationMs*int64(i)/int64(len(words)),
+			EndMs:     startMs + durationMs*int64(i+1)/int64(len(words)),
+			IsFinal:   true,
+			Estimated: true,
+		}
+	}
+	return entries
+}
+
+// formatSubtitleTimestamp formats an offset as HH:MM:SS followed by the separator and milliseconds
+func formatSubtitleTimestamp(offset time.Duration, separator string) string {
+	if offset < 0 {
+		offset = 0
+	}
+	ms := offset.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, separator, ms%1000)
+}
+
+// formatVTT renders final segments as WebVTT cues timed relative to the session start
+func formatVTT(segments []TranscriptionSegment, sessionStart time.Time) string {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+	for i, segment := range segments {
+		fmt.Fprintf(&b, "\n%d\n%s --> %s\n%s\n", i+1,
+			formatSubtitleTimestamp(segment.StartTime.Sub(sessionStart), "."),
+			formatSubtitleTimestamp(segment.EndTime.Sub(sessionStart), "."),
+			strings.TrimSpace(segment.Text))
+	}
+	return b.String()
+}
+
+// formatSRT renders final segments as SubRip cues timed relative to the session start
+func formatSRT(segments []TranscriptionSegment, sessionStart time.Time) string {
+	var b strings.Builder
+	for i, segment := range segments {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n", i+1,
+			formatSubtitleTimestamp(segment.StartTime.Sub(sessionStart), ","),
+			formatSubtitleTimestamp(segment.EndTime.Sub(sessionStart), ","),
+			strings.TrimSpace(segment.Text))
+	}
+	return b.String()
+}
+
+// countWords returns the number of whitespace-separated words in text
+func countWords(text string) int {
+	return len(strings.Fields(text))
+}
+
+// SegmentList is an ordered list of final transcription segments
+type SegmentList []TranscriptionSegment
+
+// WindowedTranscript returns the text of the segments that started at or after since
+func (l SegmentList) WindowedTranscript(since time.Time) string {
+	var texts []string
+	for _, segment := range l {
+		if segment.StartTime.Before(since) || strings.TrimSpace(segment.Text) == "" {
+			continue
+		}
+		texts = append(texts, strings.TrimSpace(segment.Text))
+	}
+	return strings.Join(texts, " ")
+}
+
+// Preview returns the words overlapping [timestampMs - windowMs/2, timestampMs + windowMs/2], with offsets
+// relative to sessionStart; ok is false when no word falls in the window
+func (l SegmentList) Preview(sessionStart time.Time, timestampMs, windowMs int64) (preview TranscriptPreviewResponse, ok bool) {
+	fromMs, toMs := timestampMs-windowMs/2, timestampMs+windowMs/2
+	var words []string
+	for _, segment := range l {
+		for _, entry := range timelineEntries(segment, sessionStart) {
+			if entry.EndMs < fromMs || entry.StartMs > toMs {
+				continue
+			}
+			if len(words) == 0 {
+				preview.StartMs = entry.StartMs
+				preview.SegmentIndex = segment.Index
+			}
+			preview.EndMs = entry.EndMs
+			words = append(words, entry.Word)
+		}
+	}
+	if len(words) == 0 {
+		return TranscriptPreviewResponse{}, false
+	}
+	preview.Type = "transcript_preview"
+	preview.Text = strings.Join(words, " ")
+	return preview, true
+}
+
+// MostOverlapping returns the index of the segment sharing the longest time span with [startMs, endMs],
+// with offsets relative to sessionStart; ok is false when no segment overlaps the range
+func (l SegmentList) MostOverlapping(sessionStart time.Time, startMs, endMs int64) (index int, ok bool) {
+	from := sessionStart.Add(time.Duration(startMs) * time.Millisecond)
+	to := sessionStart.Add(time.Duration(endMs) * time.Millisecond)
+	var longest time.Duration
+	for _, segment := range l {
+		start, end := segment.StartTime, segment.EndTime
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		if end.Before(start) {
+			continue // No overlap
+		}
+		if overlap := end.Sub(start); !ok || overlap > longest {
+			index, longest, ok = segment.Index, overlap, true
+		}
+	}
+	return index, ok
+}
+
+// At returns the segment with the given index
+func (l SegmentList) At(index int) (TranscriptionSegment, bool) {
+	for _, segment := range l {
+		if segment.Index == index {
+			return segment, true
+		}
+	}
+	return TranscriptionSegment{}, false
+}
+
+// annotateChapters inserts chapter boundary markers into the transcript at each chapter's character offset
+func annotateChapters(transcript string, chapters []Chapter) string {
+	if len(chapters) == 0 {
+		return transcript
+	}
+
+	var b strings.Builder
+	previous := 0
+	for _, chapter := range chapters {
+		offset := chapter.CharOffset
+		if offset < previous {
+			offset = previous
+		}
+		if offset > len(transcript) {
+			offset = len(transcript)
+		}
+		b.WriteString(transcript[previous:offset])
+		b.WriteString(fmt.Sprintf("\n<!-- CHAPTER: %s -->\n", chapter.Title))
+		previous = offset
+	}
+	b.WriteString(transcript[previous:])
+	return b.String()
+}
+
+// Overlap de-duplication settings for finals around a stream switch
+const (
+	maxStreamOverlapWords = 30 // Longest run of words compared between the replaced and the current stream
+	minStreamOverlapWords = 2  // Shorter overlaps are only trimmed when they make up a whole final
+)
+
+// overlapWordCount returns the length of the longest run of words ending previous that also starts next,
+// comparing words case- and punctuation-insensitively
+func overlapWordCount(previous, next string) int {
+	normalize := func(text string) []string {
+		words := strings.Fields(text)
+		for i, word := range words {
+			words[i] = strings.ToLower(strings.TrimFunc(word, func(r rune) bool {
+				return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+			}))
+		}
+		return words
+	}
+	tail, head := normalize(previous), normalize(next)
+	limit := min(len(tail), len(head), maxStreamOverlapWords)
+	for n := limit; n > 0; n-- {
+		if !equalWords(tail[len(tail)-n:], head[:n]) {
+			continue
+		}
+		if n < minStreamOverlapWords && n != min(len(tail), len(head)) {
+			return 0
+		}
+		return n
+	}
+	return 0
+}
+
+// equalWords reports whether two word lists are identical
+func equalWords(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// trimAlternativeWords returns a copy of alternative without its first leading and last trailing words
+func trimAlternativeWords(alternative *speechpb.SpeechRecognitionAlternative, leading, trailing int) *speechpb.SpeechRecognitionAlternative {
+	fields := strings.Fields(alternative.Transcript)
+	if leading+trailing >= len(fields) {
+		return &speechpb.SpeechRecognitionAlternative{Confidence: alternative.Confidence}
+	}
+	trimmed := &speechpb.SpeechRecognitionAlternative{
+		Transcript: strings.Join(fields[leading:len(fields)-trailing], " "),
+		Confidence: alternative.Confidence,
+		Words:      alternative.Words,
+	}
+	if len(trimmed.Words) >= leading+trailing {
+		trimmed.Words = trimmed.Words[leading : len(trimmed.Words)-trailing]
+	}
+	return trimmed
+}
+
+// streamOverlapFilter de-duplicates finals across a stream switch. The replaced stream keeps returning finals
+// for audio the current stream also received, so the words both recognized must be emitted only once:
+// whichever of the two overlapping finals arrives second is trimmed.
+type streamOverlapFilter struct {
+	mu           sync.Mutex
+	lastReplaced string // Last final emitted from the replaced stream
+	firstCurrent string // First final emitted from the current stream since the switch
+	checking     bool   // Whether the current stream has not emitted a final since the switch
+}
+
+// Switched starts a new overlap window when the current stream is replaced
+func (f *streamOverlapFilter) Switched() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lastReplaced, f.firstCurrent, f.checking = "", "", true
+}
+
+// TrimReplaced returns the number of trailing words of a final from the replaced stream that the current stream already emitted
+func (f *streamOverlapFilter) TrimReplaced(text string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lastReplaced = text
+	if f.firstCurrent == "" {
+		return 0
+	}
+	return overlapWordCount(text, f.firstCurrent)
+}
+
+// TrimCurrent returns the number of leading words of a final from the current stream that the replaced stream already emitted
+func (f *streamOverlapFilter) TrimCurrent(text string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.checking {
+		return 0
+	}
+	f.checking = false
+	f.firstCurrent = text
+	if f.lastReplaced == "" {
+		return 0
+	}
+	return overlapWordCount(f.lastReplaced, text)
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1"
+)
+
+func TestOverlapWordCount(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous string
+		next     string
+		want     int
+	}{
+		{"no overlap", "the quick brown fox", "jumps over the dog", 0},
+		{"two words", "the quick brown fox", "brown fox jumps", 2},
+		{"case and punctuation", "and then we left.", "We left, quickly", 2},
+		{"single word too short", "we went to the", "the park", 0},
+		{"single word whole final", "we went to the park", "park", 1},
+		{"next fully repeated", "see you tomorrow", "you tomorrow", 2},
+		{"longest run wins", "a b a b", "a b a b c", 4},
+		{"empty previous", "", "hello there", 0},
+		{"empty next", "hello there", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := overlapWordCount(tt.previous, tt.next); got != tt.want {
+				t.Errorf("overlapWordCount(%q, %q) = %d, want %d", tt.previous, tt.next, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrimAlternativeWords(t *testing.T) {
+	words := func(texts ...string) []*speechpb.WordInfo {
+		var infos []*speechpb.WordInfo
+		for _, text := range texts {
+			infos = append(infos, &speechpb.WordInfo{Word: text})
+		}
+		return infos
+	}
+	tests := []struct {
+		name              string
+		alternative       *speechpb.SpeechRecognitionAlternative
+		leading, trailing int
+		wantText          string
+		wantWords         int
+	}{
+		{"leading", &speechpb.SpeechRecognitionAlternative{Transcript: "a b c d", Words: words("a", "b", "c", "d")}, 2, 0, "c d", 2},
+		{"trailing", &speechpb.SpeechRecognitionAlternative{Transcript: "a b c d", Words: words("a", "b", "c", "d")}, 0, 1, "a b c", 3},
+		{"everything", &speechpb.SpeechRecognitionAlternative{Transcript: "a b", Words: words("a", "b")}, 1, 1, "", 0},
+		{"without word timings", &speechpb.SpeechRecognitionAlternative{Transcript: "a b c"}, 1, 0, "b c", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := trimAlternativeWords(tt.alternative, tt.leading, tt.trailing)
+			if got.Transcript != tt.wantText || len(got.Words) != tt.wantWords {
+				t.Errorf("trimAlternativeWords() = %q with %d words, want %q with %d words", got.Transcript, len(got.Words), tt.wantText, tt.wantWords)
+			}
+		})
+	}
+}
+
+func TestStreamOverlapFilter(t *testing.T) {
+	type final struct {
+		text     string
+		replaced bool
+		wantTrim int
+	}
+	tests := []struct {
+		name   string
+		finals []final
+	}{
+		{"replaced final first", []final{
+			{"we should ship the release", true, 0},
+			{"the release on friday", false, 2},
+			{"after the review", false, 0},
+		}},
+		{"current final first", []final{
+			{"the release on friday", false, 0},
+			{"we should ship the release", true, 2},
+		}},
+		{"no replaced finals", []final{
+			{"hello everyone", false, 0},
+			{"hello everyone", false, 0},
+		}},
+		{"unrelated finals", []final{
+			{"first topic done", true, 0},
+			{"second topic starts", false, 0},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := &streamOverlapFilter{}
+			filter.Switched()
+			for _, f := range tt.finals {
+				var got int
+				if f.replaced {
+					got = filter.TrimReplaced(f.text)
+				} else {
+					got = filter.TrimCurrent(f.text)
+				}
+				if got != f.wantTrim {
+					t.Errorf("trim of %q (replaced=%v) = %d, want %d", f.text, f.replaced, got, f.wantTrim)
+				}
+			}
+		})
+	}
+}
+
+func TestSegmentListMostOverlapping(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+	segments := SegmentList{
+		{Index: 0, StartTime: at(0), EndTime: at(1000)},
+		{Index: 1, StartTime: at(1000), EndTime: at(3000)},
+		{Index: 2, StartTime: at(3000), EndTime: at(3500)},
+	}
+	tests := []struct {
+		name           string
+		startMs, endMs int64
+		wantIndex      int
+		wantOK         bool
+	}{
+		{"inside one segment", 1200, 1800, 1, true},
+		{"spanning two segments", 800, 1500, 1, true},
+		{"larger overlap wins", 2900, 3400, 2, true},
+		{"after all segments", 5000, 6000, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index, ok := segments.MostOverlapping(start, tt.startMs, tt.endMs)
+			if index != tt.wantIndex || ok != tt.wantOK {
+				t.Errorf("MostOverlapping() = %d, %v; want %d, %v", index, ok, tt.wantIndex, tt.wantOK)
+			}
+			if ok {
+				if segment, found := segments.At(index); !found || segment.Index != index {
+					t.Errorf("At(%d) = %v, %v", index, segment.Index, found)
+				}
+			}
+		})
+	}
+}
+
+func TestBelowConfidenceThreshold(t *testing.T) {
+	tests := []struct {
+		name       string
+		confidence float32
+		threshold  float32
+		want       bool
+	}{
+		{"filtering disabled", 0.1, 0, false},
+		{"negative threshold disables filtering", 0.1, -0.5, false},
+		{"below", 0.49, 0.5, true},
+		{"equal is kept", 0.5, 0.5, false},
+		{"above", 0.9, 0.5, false},
+		{"no confidence reported", 0, 0.5, true},
+		{"maximum threshold", 1, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := belowConfidenceThreshold(tt.confidence, tt.threshold); got != tt.want {
+				t.Errorf("belowConfidenceThreshold(%v, %v) = %v, want %v", tt.confidence, tt.threshold, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSegmentListWindowedTranscript(t *testing.T) {
+	start := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	segments := SegmentList{
+		{Text: "opening remarks", StartTime: start},
+		{Text: " budget review ", StartTime: start.Add(30 * time.Second)},
+		{Text: "action items", StartTime: start.Add(90 * time.Second)},
+	}
+	tests := []struct {
+		name  string
+		since time.Time
+		want  string
+	}{
+		{"whole session", start, "opening remarks budget review action items"},
+		{"last minute", start.Add(30 * time.Second), "budget review action items"},
+		{"segment starting before the window is left out", start.Add(31 * time.Second), "action items"},
+		{"window after the last segment", start.Add(2 * time.Minute), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := segments.WindowedTranscript(tt.since); got != tt.want {
+				t.Errorf("WindowedTranscript() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSegmentListPreview(t *testing.T) {
+	start := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	segments := SegmentList{
+		{Index: 0, Text: "opening remarks", StartTime: start, EndTime: start.Add(time.Second)},
+		{Index: 1, Text: "budget review", Words: []WordTiming{{Word: "budget", StartMs: 5000, EndMs: 5400}, {Word: "review", StartMs: 5500, EndMs: 6000}}},
+		{Index: 2, Text: "action items", StartTime: start.Add(10 * time.Second), EndTime: start.Add(11 * time.Second)},
+	}
+	tests := []struct {
+		name        string
+		timestampMs int64
+		windowMs    int64
+		want        TranscriptPreviewResponse
+		wantOK      bool
+	}{
+		{"start of session", 0, 1000, TranscriptPreviewResponse{Type: "transcript_preview", Text: "opening remarks", StartMs: 0, EndMs: 1000, SegmentIndex: 0}, true},
+		{"middle of session", 5700, 400, TranscriptPreviewResponse{Type: "transcript_preview", Text: "review", StartMs: 5500, EndMs: 6000, SegmentIndex: 1}, true},
+		{"window spanning segments", 3000, 4000, TranscriptPreviewResponse{Type: "transcript_preview", Text: "remarks budget", StartMs: 500, EndMs: 5400, SegmentIndex: 0}, true},
+		{"end of session", 11000, 1000, TranscriptPreviewResponse{Type: "transcript_preview", Text: "action items", StartMs: 10000, EndMs: 11000, SegmentIndex: 2}, true},
+		{"silence between segments", 3000, 1000, TranscriptPreviewResponse{}, false},
+		{"after the session", 20000, 1000, TranscriptPreviewResponse{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := segments.Preview(start, tt.timestampMs, tt.windowMs)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("Preview(%d, %d) = %+v, %v, want %+v, %v", tt.timestampMs, tt.windowMs, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestTimelineEntries(t *testing.T) {
+	start := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		segment TranscriptionSegment
+		want    []TimelineEntry
+	}{
+		{"word timings", TranscriptionSegment{Text: "hello world", Words: []WordTiming{{Word: "hello", StartMs: 100, EndMs: 400, SpeakerTag: 1}, {Word: "world", StartMs: 450, EndMs: 900, SpeakerTag: 2}}},
+			[]TimelineEntry{{Word: "hello", StartMs: 100, EndMs: 400, SpeakerTag: 1, IsFinal: true}, {Word: "world", StartMs: 450, EndMs: 900, SpeakerTag: 2, IsFinal: true}}},
+		{"even spread without word timings", TranscriptionSegment{Text: "budget review", StartTime: start.Add(2 * time.Second), EndTime: start.Add(3 * time.Second)},
+			[]TimelineEntry{{Word: "budget", StartMs: 2000, EndMs: 2500, IsFinal: true, Estimated: true}, {Word: "review", StartMs: 2500, EndMs: 3000, IsFinal: true, Estimated: true}}},
+		{"uneven division rounds down", TranscriptionSegment{Text: "one two three", StartTime: start, EndTime: start.Add(100 * time.Millisecond)},
+			[]TimelineEntry{{Word: "one", StartMs: 0, EndMs: 33, IsFinal: true, Estimated: true}, {Word: "two", StartMs: 33, EndMs: 66, IsFinal: true, Estimated: true}, {Word: "three", StartMs: 66, EndMs: 100, IsFinal: true, Estimated: true}}},
+		{"zero duration", TranscriptionSegment{Text: "okay", StartTime: start.Add(time.Second), EndTime: start.Add(time.Second)},
+			[]TimelineEntry{{Word: "okay", StartMs: 1000, EndMs: 1000, IsFinal: true, Estimated: true}}},
+		{"empty segment", TranscriptionSegment{Text: "  ", StartTime: start, EndTime: start.Add(time.Second)}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := timelineEntries(tt.segment, start); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("timelineEntries() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplaceLastOccurrence(t *testing.T) {
+	tests := []struct {
+		name        string
+		text        string
+		original    string
+		replacement string
+		want        string
+		wantCount   int
+	}{
+		{"last occurrence only", "meet at noon, then noon again", "noon", "ten", "meet at noon, then ten again", 1},
+		{"case insensitive", "Kubernetes and KUBERNETES", "kubernetes", "k8s", "Kubernetes and k8s", 1},
+		{"no match", "meet at noon", "midnight", "ten", "meet at noon", 0},
+		{"empty original", "meet at noon", "", "ten", "meet at noon", 0},
+		{"regex metacharacters are literal", "costs $5.00 (approx.) or 5a00", "$5.00 (approx.)", "five dollars", "costs five dollars or 5a00", 1},
+		{"dot does not match any character", "5a00 and 5b00", "5.00", "five", "5a00 and 5b00", 0},
+		{"replacement is literal", "call bob", "bob", "$1 ${name}", "call $1 ${name}", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, count := replaceLastOccurrence(tt.text, tt.original, tt.replacement)
+			if got != tt.want || count != tt.wantCount {
+				t.Errorf("replaceLastOccurrence(%q, %q, %q) = %q, %d, want %q, %d", tt.text, tt.original, tt.replacement, got, count, tt.want, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestCorrectSegments(t *testing.T) {
+	tests := []struct {
+		name        string
+		original    string
+		corrected   string
+		want        []string
+		wantChanged []int
+	}{
+		{"within a segment", "cuban eddies", "Kubernetes", []string{"we deploy", "on Kubernetes clusters", "every week"}, []int{1}},
+		{"across two segments", "deploy on", "deploy to", []string{"we", "deploy to Cuban eddies clusters", "every week"}, []int{0, 1}},
+		{"across three segments empties the middle one", "deploy on Cuban eddies clusters every", "ship every",
+			[]string{"we", "", "ship every week"}, []int{0, 1, 2}},
+		{"whole segment", "every week", "weekly", []string{"we deploy", "on Cuban eddies clusters", "weekly"}, []int{2}},
+		{"not found", "Istio", "Envoy", []string{"we deploy", "on Cuban eddies clusters", "every week"}, nil},
+		{"empty original", "", "Envoy", []string{"we deploy", "on Cuban eddies clusters", "every week"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			segments := []TranscriptionSegment{
+				{Text: "we deploy", Words: []WordTiming{{Word: "we"}, {Word: "deploy"}}},
+				{Text: "on Cuban eddies clusters"},
+				{Text: "every week", Words: []WordTiming{{Word: "every"}, {Word: "week"}}},
+			}
+			changed := correctSegments(segments, tt.original, tt.corrected)
+			if !reflect.DeepEqual(changed, tt.wantChanged) {
+				t.Errorf("correctSegments() = %v, want %v", changed, tt.wantChanged)
+			}
+			var texts []string
+			for i, segment := range segments {
+				texts = append(texts, segment.Text)
+				if slices.Contains(changed, i) && segment.Words != nil {
+					t.Errorf("segment %d kept word timings %+v", i, segment.Words)
+				}
+			}
+			if !reflect.DeepEqual(texts, tt.want) {
+				t.Errorf("segments = %q, want %q", texts, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnnotateChapters(t *testing.T) {
+	const transcript = "welcome everyone budget review next steps"
+	marker := func(title string) string { return "\n<!-- CHAPTER: " + title + " -->\n" }
+	tests := []struct {
+		name     string
+		chapters []Chapter
+		want     string
+	}{
+		{"no chapters", nil, transcript},
+		{"at the start", []Chapter{{Title: "Intro", CharOffset: 0}}, marker("Intro") + transcript},
+		{"in the middle", []Chapter{{Title: "Budget", CharOffset: 17}, {Title: "Next", CharOffset: 31}},
+			"welcome everyone " + marker("Budget") + "budget review " + marker("Next") + "next steps"},
+		{"at the end", []Chapter{{Title: "Wrap-up", CharOffset: len(transcript)}}, transcript + marker("Wrap-up")},
+		{"offset past the end clamped", []Chapter{{Title: "Late", CharOffset: 1000}}, transcript + marker("Late")},
+		{"out of order offset kept after the previous", []Chapter{{Title: "A", CharOffset: 17}, {Title: "B", CharOffset: 8}},
+			"welcome everyone " + marker("A") + marker("B") + "budget review next steps"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := annotateChapters(transcript, tt.chapters); got != tt.want {
+				t.Errorf("annotateChapters() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountWords(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"   ", 0},
+		{"hello", 1},
+		{"hello world", 2},
+		{"  leading and trailing  ", 3},
+		{"tabs\tand\nnewlines", 3},
+		{"l'équipe a validé", 3},
+		{"well - okay", 3},
+	}
+	for _, tt := range tests {
+		if got := countWords(tt.text); got != tt.want {
+			t.Errorf("countWords(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"strconv"
 	"time"
 )
 
@@ -14,12 +17,19 @@ type AudioFormat struct {
 // PhraseSetConfig represents phrase sets configuration from the client
 type PhraseSetConfig struct {
 	Phrases []PhraseItem `json:"phrases"`
+	// AutoScaleBoost lowers the boost towards 5.0 as the transcript grows (see BOOST_SCALE_WORDS)
+	AutoScaleBoost bool `json:"autoScaleBoost,omitempty"`
 }
 
 // PhraseItem represents a phrase with boost value
 type PhraseItem struct {
 	Value string  `json:"value"`
 	Boost float32 `json:"boost"`
+	// LongPhraseSplit splits a phrase over MAX_PHRASE_LENGTH at word boundaries instead of dropping it
+	LongPhraseSplit bool `json:"longPhraseSplit,omitempty"`
+	// MatchStrategy is "exact" (default), "prefix" to also boost continuations of the phrase,
+	// or "class" to send a predefined class name such as "digit" as its "$DIGIT" token
+	MatchStrategy string `json:"matchStrategy,omitempty"`
 }
 
 // CustomClass represents a single custom class with its items and boost
@@ -36,6 +46,32 @@ type ClassesConfig struct {
 	// Legacy support for single custom class
 	CustomClassItems []string `json:"customClassItems,omitempty"`
 	Boost            float32  `json:"boost,omitempty"`
+	// AutoScaleBoost lowers class boosts towards 5.0 as the transcript grows (see BOOST_SCALE_WORDS)
+	AutoScaleBoost bool `json:"autoScaleBoost,omitempty"`
+}
+
+// NormalizationConfig selects the clean-ups applied to final results before they are sent and stored
+type NormalizationConfig struct {
+	// RemoveFillerWords drops "um", "uh" and the like, and "like" when set off by commas
+	RemoveFillerWords bool `json:"removeFillerWords,omitempty"`
+	// NormalizeNumbers writes spelled-out numbers from ten upwards as digits ("twenty three" becomes "23")
+	NormalizeNumbers bool `json:"normalizeNumbers,omitempty"`
+	// FixCapitalization capitalizes days, months, the pronoun "I" and the session's custom words as configured
+	FixCapitalization bool `json:"fixCapitalization,omitempty"`
+	// CustomReplacements replaces exact strings, longest first
+	CustomReplacements map[string]string `json:"customReplacements,omitempty"`
+
+	properNouns []string // Custom words of the session, restored with their configured casing
+}
+
+// RecognitionMetadata describes the audio source so Speech-to-Text can pick a better suited model.
+// Enum fields take the Speech API value names, e.g. DISCUSSION, PRESENTATION or PHONE_CALL for InteractionType.
+type RecognitionMetadata struct {
+	InteractionType     string `json:"interactionType,omitempty"`
+	MicrophoneDistance  string `json:"microphoneDistance,omitempty"`  // NEARFIELD, MIDFIELD or FARFIELD
+	RecordingDeviceType string `json:"recordingDeviceType,omitempty"` // SMARTPHONE, PC, PHONE_LINE, VEHICLE, OTHER_OUTDOOR_DEVICE or OTHER_INDOOR_DEVICE
+	RecordingDeviceName string `json:"recordingDeviceName,omitempty"` // Free text, e.g. "Pixel XL"
+	OriginalMediaType   string `json:"originalMediaType,omitempty"`   // AUDIO or VIDEO
 }
 
 // ConfigMessage represents the initial configuration sent from the client
@@ -48,35 +84,337 @@ type ConfigMessage struct {
 	PhraseSets               *PhraseSetConfig `json:"phraseSets"`
 	Classes                  *ClassesConfig   `json:"classes"`
 	SummaryPrompt            string           `json:"summaryPrompt,omitempty"`
+	// PhraseSetResources references existing Cloud Speech phrase sets (projects/*/locations/*/phraseSets/*)
+	// of the server's project; they are applied with USE_ADAPTATION_V1P1BETA
+	PhraseSetResources []string `json:"phraseSetResources,omitempty"`
+	// EnableSynonymExpansion also recognizes up to 3 synonyms of each custom word, at a lower boost
+	EnableSynonymExpansion bool `json:"enableSynonymExpansion,omitempty"`
+	// RecognitionMetadata is passed to Speech-to-Text as recognition metadata
+	RecognitionMetadata *RecognitionMetadata `json:"recognitionMetadata,omitempty"`
+	// MultiLanguageMode runs one recognition stream per configured language in parallel
+	MultiLanguageMode bool `json:"multiLanguageMode,omitempty"`
+	// MinConfidenceThreshold drops final results below this confidence (0.0-1.0, 0 disables filtering)
+	MinConfidenceThreshold float32 `json:"minConfidenceThreshold,omitempty"`
+	// MinInterimWords suppresses interim results with fewer words (0 disables suppression)
+	MinInterimWords int `json:"minInterimWords,omitempty"`
+	// MinSummarySegmentWords keeps final results with fewer words out of summary triggers; their text is
+	// summarized with the next longer result (0 = default of 5, negative disables)
+	MinSummarySegmentWords int `json:"minSummarySegmentWords,omitempty"`
+	// EndOfSpeechSilenceMs marks a segment boundary in the transcript once no result arrived for this long (0 disables)
+	EndOfSpeechSilenceMs int `json:"endOfSpeechSilenceMs,omitempty"`
+	// InactivityWarningSeconds warns this long before SILENCE_TIMEOUT_SECONDS closes an inactive session; it must be
+	// shorter than the timeout (0 = default of 30, or half of a shorter timeout; negative disables the warning)
+	InactivityWarningSeconds int `json:"inactivityWarningSeconds,omitempty"`
+	// ConsentRequired holds audio until the client acknowledges the recording consent notice
+	ConsentRequired bool `json:"consentRequired,omitempty"`
+	// Model selects the Speech API recognition model (e.g. "latest_long", "chirp_2")
+	Model string `json:"model,omitempty"`
+	// MaxSessionDurationMinutes ends the session after this many minutes (0 = unlimited, capped by MAX_SESSION_DURATION_MINUTES)
+	MaxSessionDurationMinutes int `json:"maxSessionDurationMinutes,omitempty"`
+	// KeywordBoostDecayRatePerMinute lowers the boost of keywords added during the session as they age, down to 5.0 (0 = no decay)
+	KeywordBoostDecayRatePerMinute float32 `json:"keywordBoostDecayRatePerMinute,omitempty"`
+	// UseEnhanced requests the enhanced variant of Model (phone_call and video, en-US only)
+	UseEnhanced bool `json:"useEnhanced,omitempty"`
+	// AutoDetectLanguage requests automatic language detection (Chirp models on the v2 API only; sessions requesting
+	// it are rejected while the server streams to the v1 API)
+	AutoDetectLanguage bool `json:"autoDetectLanguage,omitempty"`
+	// WebhookURL receives a signed POST when the final summary is generated
+	WebhookURL    string `json:"webhookURL,omitempty"`
+	WebhookSecret string `json:"webhookSecret,omitempty"`
+	// SlackWebhookURL is a Slack incoming webhook that receives the final summary
+	SlackWebhookURL string `json:"slackWebhookURL,omitempty"`
+	SlackChannel    string `json:"slackChannel,omitempty"`
+	// GeminiModel overrides the GEMINI_MODEL used for summaries, restricted to GEMINI_ALLOWED_MODELS
+	GeminiModel string `json:"geminiModel,omitempty"`
+	// GeminiFallbackModel, restricted to GEMINI_ALLOWED_MODELS, generates summaries while GeminiModel is out of quota
+	GeminiFallbackModel string `json:"geminiFallbackModel,omitempty"`
+	// MaxGenAITokensBudget stops summary generation once the session has used this many tokens (0 = unlimited)
+	MaxGenAITokensBudget int32 `json:"maxGenAITokensBudget,omitempty"`
+	// RedactPII masks phone numbers, emails, SSNs and card numbers in the stored transcript and summaries;
+	// CustomRedactionPatterns are extra regular expressions applied alongside the built-in ones
+	RedactPII               bool     `json:"redactPII,omitempty"`
+	CustomRedactionPatterns []string `json:"customRedactionPatterns,omitempty"`
+	// StreamRecreationStrategy is "full_restart" (default) or "seamless", which overlaps the old and new streams
+	StreamRecreationStrategy string `json:"streamRecreationStrategy,omitempty"`
+	// SummaryLanguage writes summaries in this language (e.g. "fr") instead of the transcript language
+	SummaryLanguage string `json:"summaryLanguage,omitempty"`
+	// SummaryFormat is "markdown" (default) or "json" for summaries following the StructuredSummary schema
+	SummaryFormat string `json:"summaryFormat,omitempty"`
+	// SummaryFocusTopics biases summaries toward these topics, e.g. "technical decisions"
+	SummaryFocusTopics []string `json:"summaryFocusTopics,omitempty"`
+	// MaxSummaryParagraphLength splits summary paragraphs longer than this many characters at sentence ends (0 = unlimited)
+	MaxSummaryParagraphLength int `json:"maxSummaryParagraphLength,omitempty"`
+	// GeminiSafetySettings maps harm categories ("HARM_CATEGORY_HARASSMENT") to block thresholds ("BLOCK_NONE")
+	// for summaries; honoured only with ALLOW_CUSTOM_SAFETY_SETTINGS
+	GeminiSafetySettings map[string]string `json:"geminiSafetySettings,omitempty"`
+	// AutoPunctuate adds punctuation to final results for models that return none;
+	// AutoPunctuateModel uses this Gemini model instead of the rule-based punctuator
+	AutoPunctuate      bool   `json:"autoPunctuate,omitempty"`
+	AutoPunctuateModel string `json:"autoPunctuateModel,omitempty"`
+	// Normalization cleans up final results (filler words, numbers, capitalization, replacements)
+	Normalization *NormalizationConfig `json:"normalization,omitempty"`
+	// DownmixToMono averages multi-channel LINEAR16 audio into one channel instead of recognizing each channel separately
+	DownmixToMono bool `json:"downmixToMono,omitempty"`
+	// ResampleToHz resamples LINEAR16 audio to this rate before it is forwarded (0 keeps the client rate)
+	ResampleToHz int `json:"resampleToHz,omitempty"`
+	// LogLevel lowers the server log verbosity for this session ("debug", "info", "warn"); it cannot raise it
+	LogLevel string `json:"logLevel,omitempty"`
+	// TimestampFormat is how the timestamps of messages, in both directions, and of the summary webhook are serialized:
+	// "rfc3339" (default), "unix_ms" or "relative"
+	TimestampFormat string `json:"timestampFormat,omitempty"`
+	// EmbedWatermark logs a hash of every received audio chunk to TRANSCRIPT_DIR/<sessionID>.watermark.jsonl
+	// so recordings can be traced back to the session; the audio itself is forwarded unchanged
+	EmbedWatermark bool `json:"embedWatermark,omitempty"`
+}
+
+// Timestamp is a time serialized in a session's timestamp format: an RFC 3339 string,
+// Unix milliseconds, or milliseconds since SessionStart.
+// It is used by the messages exchanged with a session's client, which SSE and watch subscribers receive as is,
+// and by the summary webhook payload. Persisted records (TranscriptRecord, Chapter, TranscriptionSegment,
+// SessionEvent, WatermarkRecord, AuditRecord, SessionMetadata) and the HTTP API responses (SessionInfo, SearchHit,
+// KeywordEntry) keep time.Time: they are read back by the server, or by callers that never chose a session format.
+type Timestamp struct {
+	Time         time.Time
+	Format       string
+	SessionStart time.Time
+}
+
+// MarshalJSON writes the time in t.Format
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	switch t.Format {
+	case timestampFormatUnixMs:
+		return []byte(strconv.FormatInt(t.Time.UnixMilli(), 10)), nil
+	case timestampFormatRelative:
+		return []byte(strconv.FormatInt(t.Time.Sub(t.SessionStart).Milliseconds(), 10)), nil
+	}
+	return json.Marshal(t.Time)
+}
+
+// UnmarshalJSON reads a time written in t.Format; set Format, and SessionStart for relative timestamps, before decoding
+func (t *Timestamp) UnmarshalJSON(data []byte) error {
+	switch t.Format {
+	case timestampFormatUnixMs, timestampFormatRelative:
+		var ms int64
+		if err := json.Unmarshal(data, &ms); err != nil {
+			return fmt.Errorf("invalid %s timestamp: %v", t.Format, err)
+		}
+		if t.Format == timestampFormatUnixMs {
+			t.Time = time.UnixMilli(ms)
+		} else {
+			t.Time = t.SessionStart.Add(time.Duration(ms) * time.Millisecond)
+		}
+		return nil
+	}
+	return json.Unmarshal(data, &t.Time)
 }
 
 // KeywordsMessage represents keywords sent from the client during an active session
 type KeywordsMessage struct {
 	Type      string    `json:"type"`
 	Words     []string  `json:"words"`
-	Timestamp time.Time `json:"timestamp"`
+	Timestamp Timestamp `json:"timestamp"`
+}
+
+// KeywordEntry is a keyword added during a session with the boost applied to the current stream
+type KeywordEntry struct {
+	Word         string    `json:"word"`
+	AddedAt      time.Time `json:"addedAt"`
+	InitialBoost float32   `json:"initialBoost"`
+	CurrentBoost float32   `json:"currentBoost"`
 }
 
 // EndPromptMessage represents an end prompt sent from the client when stopping
 type EndPromptMessage struct {
 	Type      string    `json:"type"`
 	EndPrompt string    `json:"endPrompt"`
-	Timestamp time.Time `json:"timestamp"`
+	Timestamp Timestamp `json:"timestamp"`
+}
+
+// CorrectionMessage represents a transcript correction pushed by the client
+type CorrectionMessage struct {
+	Type          string    `json:"type"`
+	OriginalText  string    `json:"originalText"`
+	CorrectedText string    `json:"correctedText"`
+	Timestamp     Timestamp `json:"timestamp"`
+}
+
+// ChapterMessage represents a chapter marker inserted by the client during a session
+type ChapterMessage struct {
+	Type      string    `json:"type"`
+	Title     string    `json:"title"`
+	Timestamp Timestamp `json:"timestamp"`
+}
+
+// FocusTranscriptMessage asks for a one-off summary of the last LastSeconds of the transcript
+type FocusTranscriptMessage struct {
+	Type         string `json:"type"`
+	LastSeconds  int    `json:"lastSeconds"`
+	CustomPrompt string `json:"customPrompt,omitempty"`
+}
+
+// AudioLevelResponse reports the loudest audio level of the last interval for LINEAR16 sessions
+type AudioLevelResponse struct {
+	Type      string    `json:"type"`
+	RMSdBFS   float64   `json:"rmsDBFS"`
+	IsSpeech  bool      `json:"isSpeech"`
+	Timestamp Timestamp `json:"timestamp"`
+}
+
+// AudioStatsResponse reports how much of the audio received was classified as speech
+type AudioStatsResponse struct {
+	Type                  string    `json:"type"`
+	SpeechDurationSeconds float64   `json:"speechDurationSeconds"`
+	AudioDurationSeconds  float64   `json:"audioDurationSeconds"`
+	BufferedAudioMs       int       `json:"bufferedAudioMs"` // Audio waiting for the Speech-to-Text stream to be recreated
+	Timestamp             Timestamp `json:"timestamp"`
+}
+
+// TranscriptPreviewMessage asks for the transcript within WindowMs around TimestampMs (relative to the session start)
+type TranscriptPreviewMessage struct {
+	Type        string `json:"type"`
+	TimestampMs int64  `json:"timestampMs"`
+	WindowMs    int64  `json:"windowMs"`
+}
+
+// RetranscribeMessage asks for the segment overlapping [StartMs, EndMs] (relative to the session start)
+// to be transcribed again from the retained audio
+type RetranscribeMessage struct {
+	Type    string `json:"type"`
+	StartMs int64  `json:"startMs"`
+	EndMs   int64  `json:"endMs"`
+}
+
+// RetranscriptionResult reports the text that replaced a segment after re-transcription
+type RetranscriptionResult struct {
+	Type         string `json:"type"`
+	OriginalText string `json:"originalText"`
+	NewText      string `json:"newText"`
+	SegmentIndex int    `json:"segmentIndex"`
+}
+
+// PunctuationResult replaces the text of a final result once Gemini has punctuated it
+type PunctuationResult struct {
+	Type         string `json:"type"`
+	OriginalText string `json:"originalText"`
+	NewText      string `json:"newText"`
+	SegmentIndex int    `json:"segmentIndex"`
+}
+
+// TranscriptPreviewResponse holds the words found around a requested timestamp
+type TranscriptPreviewResponse struct {
+	Type    string `json:"type"`
+	Text    string `json:"text"`
+	StartMs int64  `json:"startMs"`
+	EndMs   int64  `json:"endMs"`
+	// SegmentIndex is the index of the first segment contributing to the preview
+	SegmentIndex int `json:"segmentIndex"`
+}
+
+// ConsentAckMessage represents the client's answer to the recording consent notice
+type ConsentAckMessage struct {
+	Type     string `json:"type"`
+	Accepted bool   `json:"accepted"`
+}
+
+// Chapter represents a topic boundary in the transcript
+type Chapter struct {
+	Title      string    `json:"title"`
+	CharOffset int       `json:"charOffset"`
+	Timestamp  time.Time `json:"timestamp"`
 }
 
 // TranscriptionResponse represents the transcription response sent back to the client
 type TranscriptionResponse struct {
 	Type      string    `json:"type"`
 	Text      string    `json:"text"`
-	Timestamp time.Time `json:"timestamp"`
+	Timestamp Timestamp `json:"timestamp"`
 	Final     bool      `json:"final"`
+	// DetectedLanguage is the language code of the track or alternative that produced the result
+	DetectedLanguage string `json:"detectedLanguage,omitempty"`
+	// Filtered is true when a final result was excluded from the transcript for low confidence
+	Filtered bool `json:"filtered,omitempty"`
+	// LanguageDetection is populated when the client requested automatic language detection
+	LanguageDetection *LanguageDetectionResult `json:"languageDetection,omitempty"`
+	// ChannelTag is the audio channel (from 1) that produced the result when channels are recognized separately
+	ChannelTag int `json:"channelTag,omitempty"`
+}
+
+// LanguageDetectionResult describes the language detected for a transcription result
+type LanguageDetectionResult struct {
+	DetectedLanguage   string  `json:"detectedLanguage"`
+	LanguageConfidence float32 `json:"languageConfidence"`
 }
 
 // SummaryResponse represents the summary response sent back to the client
 type SummaryResponse struct {
+	Type string `json:"type"`
+	// SummaryID matches the summaryId of the summary_chunk messages that streamed this summary
+	SummaryID int64     `json:"summaryId,omitempty"`
+	Text      string    `json:"text"`
+	Timestamp Timestamp `json:"timestamp"`
+	// Partial is true when the summary includes interim text that is not final yet
+	Partial bool `json:"partial,omitempty"`
+	// SummaryLanguage is set when the summary is written in a language other than the transcript's
+	SummaryLanguage string `json:"summaryLanguage,omitempty"`
+	// JSON is true when Text is a StructuredSummary encoded as JSON rather than Markdown
+	JSON bool `json:"json,omitempty"`
+	// SummaryGenerationStrategy is "direct", or "map_reduce" when the transcript was summarized in chunks first
+	SummaryGenerationStrategy string `json:"summaryGenerationStrategy,omitempty"`
+	// FocusTopics are the topics the summary was focused on
+	FocusTopics []string `json:"focusTopics,omitempty"`
+}
+
+// SummaryChunkResponse carries part of a summary streamed while Gemini generates it (ENABLE_STREAMING_SUMMARY).
+// Chunks hold the text generated since the previous one; the Final chunk holds the complete summary,
+// which is then also sent as a regular SummaryResponse. Several summaries can stream at once, so chunks
+// carry the SummaryID of the summary they belong to. A Reset chunk precedes a restart with the fallback model.
+type SummaryChunkResponse struct {
 	Type      string    `json:"type"`
+	SummaryID int64     `json:"summaryId"`
 	Text      string    `json:"text"`
-	Timestamp time.Time `json:"timestamp"`
+	Final     bool      `json:"final"`
+	Timestamp Timestamp `json:"timestamp"`
+	// Reset discards the text received so far for SummaryID; the summary streams again from the start
+	Reset bool `json:"reset,omitempty"`
+}
+
+// FocusedSummaryResponse is a one-off summary of recent transcript; it does not replace the running summary
+type FocusedSummaryResponse struct {
+	Type        string    `json:"type"`
+	LastSeconds int       `json:"lastSeconds"`
+	Text        string    `json:"text"`
+	Timestamp   Timestamp `json:"timestamp"`
+	JSON        bool      `json:"json,omitempty"`
+}
+
+// StructuredSummary is the summary shape requested from Gemini when summaryFormat is "json"
+type StructuredSummary struct {
+	Title        string             `json:"title"`
+	Participants []string           `json:"participants"`
+	KeyPoints    []string           `json:"keyPoints"`
+	Decisions    []string           `json:"decisions"`
+	ActionItems  []ActionItemSchema `json:"actionItems"`
+	Conclusion   string             `json:"conclusion"`
+}
+
+// ActionItemSchema is an action item in a structured summary
+type ActionItemSchema struct {
+	Description string `json:"description"`
+	Owner       string `json:"owner,omitempty"`
+	DueDate     string `json:"dueDate,omitempty"`
+}
+
+// KeywordSuggestionResponse represents keywords suggested from the transcript for the client to boost
+type KeywordSuggestionResponse struct {
+	Type  string   `json:"type"`
+	Words []string `json:"words"`
+}
+
+// ConsentNoticeResponse informs participants that the session is being transcribed
+type ConsentNoticeResponse struct {
+	Type                    string `json:"type"`
+	Message                 string `json:"message"`
+	RequiresAcknowledgement bool   `json:"requiresAcknowledgement"`
 }
 
 // StatusResponse represents status updates sent to the client
@@ -84,7 +422,28 @@ type StatusResponse struct {
 	Type      string    `json:"type"`
 	Status    string    `json:"status"`
 	Message   string    `json:"message"`
-	Timestamp time.Time `json:"timestamp"`
+	Timestamp Timestamp `json:"timestamp"`
+	// ReplacedCount is the number of replacements made by a correction
+	ReplacedCount int `json:"replacedCount,omitempty"`
+	// Diff is the word-level difference between the original and corrected text of an applied correction
+	Diff []DiffOp `json:"diff,omitempty"`
+	// RetryAfterMs hints how long the client should wait before the condition clears
+	RetryAfterMs int64 `json:"retryAfterMs,omitempty"`
+	// SessionID identifies the server-side session, sent when the session starts
+	SessionID string `json:"sessionID,omitempty"`
+	// Count is the number of items the status refers to, such as dropped audio chunks
+	Count int64 `json:"count,omitempty"`
+	// NewLanguage is the primary language selected after an automatic language swap
+	NewLanguage string `json:"newLanguage,omitempty"`
+	// TokensUsed and Budget report GenAI token consumption against the session budget
+	TokensUsed int64 `json:"tokensUsed,omitempty"`
+	Budget     int64 `json:"budget,omitempty"`
+	// SecondsTillTimeout is the time left before an inactive session is closed
+	SecondsTillTimeout int `json:"secondsTillTimeout,omitempty"`
+	// RequestedModel, ActualModel and Reason describe a switch to the Gemini fallback model
+	RequestedModel string `json:"requestedModel,omitempty"`
+	ActualModel    string `json:"actualModel,omitempty"`
+	Reason         string `json:"reason,omitempty"`
 }
 
 // Preset represents a prompt preset with title, summary and conclusion
@@ -94,7 +453,212 @@ type Preset struct {
 	Conclusion string `json:"conclusion"`
 }
 
+// PresetV2 is the JSON preset file format that replaces the line-based "Title:/Summary:/Conclusion:" format
+type PresetV2 struct {
+	Version    int    `json:"version"`
+	Title      string `json:"title"`
+	Summary    string `json:"summary"`
+	Conclusion string `json:"conclusion"`
+}
+
+// WordTiming represents the timing of a single recognized word relative to the session start
+type WordTiming struct {
+	Word       string `json:"word"`
+	StartMs    int64  `json:"startMs"`
+	EndMs      int64  `json:"endMs"`
+	SpeakerTag int32  `json:"speakerTag,omitempty"`
+}
+
+// SearchHit is a session matching a transcript search, with its BM25 relevance score
+type SearchHit struct {
+	SessionID string    `json:"sessionID"`
+	CreatedAt time.Time `json:"createdAt"`
+	Score     float64   `json:"score"`
+	Snippet   string    `json:"snippet"`
+}
+
+// SearchResponse lists the sessions matching a search query, most relevant first
+type SearchResponse struct {
+	Query string      `json:"query"`
+	Hits  []SearchHit `json:"hits"`
+}
+
+// TimelineEntry is a word positioned relative to the session start, as returned by the timeline API
+type TimelineEntry struct {
+	Word       string `json:"word"`
+	StartMs    int64  `json:"startMs"`
+	EndMs      int64  `json:"endMs"`
+	SpeakerTag int32  `json:"speakerTag,omitempty"`
+	IsFinal    bool   `json:"isFinal"`
+	// Estimated is set when the segment had no word timings and the position was interpolated
+	Estimated bool `json:"estimated,omitempty"`
+}
+
+// TranscriptionSegment represents a single final transcription result
+type TranscriptionSegment struct {
+	Index      int          `json:"index"`
+	Text       string       `json:"text"`
+	Language   string       `json:"language,omitempty"`
+	Confidence float32      `json:"confidence"`
+	StartTime  time.Time    `json:"startTime"`
+	EndTime    time.Time    `json:"endTime"`
+	Words      []WordTiming `json:"words,omitempty"`
+}
+
+// SessionMetadata describes a transcription session
+type SessionMetadata struct {
+	SessionID                string      `json:"sessionID"`
+	CreatedAt                time.Time   `json:"createdAt"`
+	EndedAt                  *time.Time  `json:"endedAt,omitempty"`
+	LanguageCode             string      `json:"languageCode"`
+	AlternativeLanguageCodes []string    `json:"alternativeLanguageCodes,omitempty"`
+	AudioFormat              AudioFormat `json:"audioFormat"`
+	SegmentCount             int         `json:"segmentCount"`
+}
+
+// TranscriptRecord represents a single line of a persisted session JSONL file
+type TranscriptRecord struct {
+	Type      string                `json:"type"`
+	Timestamp time.Time             `json:"timestamp"`
+	Segment   *TranscriptionSegment `json:"segment,omitempty"`
+	Chapter   *Chapter              `json:"chapter,omitempty"`
+	Text      string                `json:"text,omitempty"`
+	// ContextFeedback is set on "context_feedback" records written when the session ends
+	ContextFeedback *ContextFeedbackReport `json:"contextFeedback,omitempty"`
+}
+
+// WatermarkRecord is one line of a session's watermark log, identifying an audio chunk as received from the client
+type WatermarkRecord struct {
+	SessionID   string    `json:"sessionID"`
+	SessionHash string    `json:"sessionHash"` // First 4 bytes of the SHA-256 of the session ID, hex encoded
+	ChunkIndex  int64     `json:"chunkIndex"`
+	Offset      int64     `json:"offset"` // Position of the chunk in the session's received audio
+	Length      int       `json:"length"`
+	SHA256      string    `json:"sha256"` // First 16 bytes of the SHA-256 of the chunk, hex encoded
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// WatermarkMismatch reports a chunk of a watermark log that does not match the verified audio
+type WatermarkMismatch struct {
+	ChunkIndex int64  `json:"chunkIndex"`
+	Offset     int64  `json:"offset"`
+	Reason     string `json:"reason"`
+}
+
+// SessionArchive holds everything known about a live or persisted session
+type SessionArchive struct {
+	Metadata   SessionMetadata
+	Segments   []TranscriptionSegment
+	Transcript string
+	Chapters   []Chapter
+	Summary    string
+}
+
+// TranscriptResponse represents the transcript returned by the transcript API
+type TranscriptResponse struct {
+	SessionID  string                 `json:"sessionID"`
+	Transcript string                 `json:"transcript"`
+	Segments   []TranscriptionSegment `json:"segments"`
+	Chapters   []Chapter              `json:"chapters"`
+}
+
+// ClientMetadata describes the client that opened a WebSocket session
+type ClientMetadata struct {
+	UserAgent      string    `json:"userAgent"`
+	RemoteIP       string    `json:"remoteIP"`
+	AcceptLanguage string    `json:"acceptLanguage"`
+	ConnectedAt    time.Time `json:"connectedAt"`
+}
+
+// AuditRecord describes a single WebSocket connection attempt
+type AuditRecord struct {
+	Timestamp      time.Time         `json:"timestamp"`
+	RemoteIP       string            `json:"remoteIP"`
+	UserAgent      string            `json:"userAgent"`
+	Origin         string            `json:"origin"`
+	SessionID      string            `json:"sessionID,omitempty"`
+	AuthResult     string            `json:"authResult"`
+	TLSVersion     string            `json:"tlsVersion,omitempty"`
+	RequestHeaders map[string]string `json:"requestHeaders"`
+}
+
+// SessionInfo represents a live session as returned by the sessions API
+type SessionInfo struct {
+	SessionID     string         `json:"sessionID"`
+	CreatedAt     time.Time      `json:"createdAt"`
+	LanguageCode  string         `json:"languageCode"`
+	SegmentCount  int            `json:"segmentCount"`
+	Client        ClientMetadata `json:"client"`
+	LastHeartbeat time.Time      `json:"lastHeartbeat"`
+	// ConsentTimestamp is when the client accepted the recording consent notice
+	ConsentTimestamp *time.Time `json:"consentTimestamp,omitempty"`
+	Tags             []string   `json:"tags,omitempty"`
+	// KeepalivesSent counts empty audio chunks sent to keep an idle Speech-to-Text stream open
+	KeepalivesSent int64 `json:"keepalivesSent,omitempty"`
+	// FallbackCount counts summaries switched to the Gemini fallback model after a quota error
+	FallbackCount int64 `json:"fallbackCount,omitempty"`
+}
+
+// SessionTags is the body of the session tags API
+type SessionTags struct {
+	SessionID string   `json:"sessionID,omitempty"`
+	Tags      []string `json:"tags"`
+}
+
+// WebhookPayload represents the body POSTed to the summary webhook
+type WebhookPayload struct {
+	SessionID  string    `json:"sessionID"`
+	Summary    string    `json:"summary"`
+	Timestamp  Timestamp `json:"timestamp"`
+	TokenCount int32     `json:"tokenCount"`
+}
+
+// ErrorResponse represents a structured API error
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// BatchTranscriptionResponse represents the result of transcribing an uploaded audio file
+type BatchTranscriptionResponse struct {
+	Transcript string                 `json:"transcript"`
+	Segments   []TranscriptionSegment `json:"segments"`
+}
+
+// GoogleDocsExportRequest represents the body of a Google Docs export request
+type GoogleDocsExportRequest struct {
+	FolderID string `json:"folderId"`
+	Title    string `json:"title"`
+}
+
+// GoogleDocsExportResponse identifies the document created by a Google Docs export
+type GoogleDocsExportResponse struct {
+	DocumentID string `json:"documentId"`
+	URL        string `json:"url"`
+}
+
+// ContextFeedbackReport summarizes which speech context phrases matched the session transcript
+type ContextFeedbackReport struct {
+	Type             string   `json:"type"`
+	MatchedPhrases   []string `json:"matchedPhrases"`
+	UnmatchedPhrases []string `json:"unmatchedPhrases"`
+	HitRate          float64  `json:"hitRate"`
+}
+
+// SessionEvent represents a significant state change recorded in the session event log
+type SessionEvent struct {
+	EventType string                 `json:"eventType"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	Timestamp time.Time              `json:"timestamp"`
+}
+
+// WordFreq represents how often a word appears in a transcript
+type WordFreq struct {
+	Word      string  `json:"word"`
+	Count     int     `json:"count"`
+	Frequency float64 `json:"frequency"`
+}
+
 // TemplateData holds data for serving the HTML template
 type TemplateData struct {
 	WebSocketHost string
-}
\ No newline at end of file
+}
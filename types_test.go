@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSummaryMessagesCarrySummaryID(t *testing.T) {
+	timestamp := Timestamp{Time: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	tests := []struct {
+		name    string
+		message interface{}
+		want    string
+		wantNot string
+	}{
+		{"chunk", SummaryChunkResponse{Type: "summary_chunk", SummaryID: 3, Text: "a", Timestamp: timestamp}, `"summaryId":3`, ""},
+		{"final summary", SummaryResponse{Type: "summary", SummaryID: 3, Text: "a", Timestamp: timestamp}, `"summaryId":3`, ""},
+		{"unstreamed summary", SummaryResponse{Type: "summary", Text: "a", Timestamp: timestamp}, `"type":"summary"`, "summaryId"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(data), tt.want) {
+				t.Errorf("%s does not contain %s", data, tt.want)
+			}
+			if tt.wantNot != "" && strings.Contains(string(data), tt.wantNot) {
+				t.Errorf("%s contains %s", data, tt.wantNot)
+			}
+		})
+	}
+}
+
+func TestTimestampJSON(t *testing.T) {
+	sessionStart := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	at := sessionStart.Add(1500 * time.Millisecond)
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"", `"2026-01-01T10:00:01.5Z"`},
+		{timestampFormatRFC3339, `"2026-01-01T10:00:01.5Z"`},
+		{timestampFormatUnixMs, "1767261601500"},
+		{timestampFormatRelative, "1500"},
+	}
+	for _, tt := range tests {
+		t.Run("format "+tt.format, func(t *testing.T) {
+			data, err := json.Marshal(Timestamp{Time: at, Format: tt.format, SessionStart: sessionStart})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("MarshalJSON() = %s, want %s", data, tt.want)
+			}
+			decoded := Timestamp{Format: tt.format, SessionStart: sessionStart}
+			if err := json.Unmarshal(data, &decoded); err != nil {
+				t.Fatal(err)
+			}
+			if !decoded.Time.Equal(at) {
+				t.Errorf("UnmarshalJSON() = %v, want %v", decoded.Time, at)
+			}
+		})
+	}
+}
+
+func TestSessionTimestampFormat(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{timestampFormatRFC3339, `{"type":"status","status":"ready","message":"","timestamp":"2026-01-01T10:00:02Z"}`},
+		{timestampFormatRelative, `{"type":"status","status":"ready","message":"","timestamp":2000}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			session := newSession(func() {}, ConfigMessage{})
+			session.CreatedAt = time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+			session.setTimestampFormat(tt.format)
+			data, err := json.Marshal(StatusResponse{Type: "status", Status: "ready", Timestamp: session.Timestamp(session.CreatedAt.Add(2 * time.Second))})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("message = %s, want %s", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientMessageTimestamps(t *testing.T) {
+	sessionStart := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	at := sessionStart.Add(2 * time.Second)
+	tests := []struct {
+		format    string
+		timestamp string
+	}{
+		{timestampFormatRFC3339, `"2026-01-01T10:00:02Z"`},
+		{timestampFormatUnixMs, "1767261602000"},
+		{timestampFormatRelative, "2000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			session := newSession(func() {}, ConfigMessage{})
+			session.CreatedAt = sessionStart
+			session.setTimestampFormat(tt.format)
+
+			// Messages from the client are decoded in the session's format
+			chapter := ChapterMessage{Timestamp: session.Timestamp(time.Time{})}
+			if err := json.Unmarshal([]byte(`{"type":"chapter","title":"Budget","timestamp":`+tt.timestamp+`}`), &chapter); err != nil {
+				t.Fatal(err)
+			}
+			if !chapter.Timestamp.Time.Equal(at) {
+				t.Errorf("chapter timestamp = %v, want %v", chapter.Timestamp.Time, at)
+			}
+
+			// The summary webhook is sent in it
+			data, err := json.Marshal(WebhookPayload{SessionID: session.ID, Timestamp: session.Timestamp(at)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := `"timestamp":` + tt.timestamp; !strings.Contains(string(data), want) {
+				t.Errorf("webhook payload = %s, want %s", data, want)
+			}
+		})
+	}
+}
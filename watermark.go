@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Reasons reported by verifyWatermark
+const (
+	watermarkTruncated     = "truncated"      // The audio ends before the chunk
+	watermarkHashMismatch  = "hash_mismatch"  // The audio at the chunk's offset has a different hash
+	watermarkSessionChange = "session_change" // The record's session hash does not match its session ID
+	watermarkUnlogged      = "unlogged_audio" // The audio continues past the last logged chunk
+)
+
+// audioWatermarker records the hash and position of each audio chunk of a session
+type audioWatermarker struct {
+	sessionID   string
+	sessionHash string
+	offset      int64
+}
+
+// newAudioWatermarker creates a watermarker for a session's audio
+func newAudioWatermarker(sessionID string) *audioWatermarker {
+	return &audioWatermarker{sessionID: sessionID, sessionHash: watermarkSessionHash(sessionID)}
+}
+
+// watermarkSessionHash returns the first 4 bytes of the SHA-256 of a session ID, hex encoded
+func watermarkSessionHash(sessionID string) string {
+	sum := sha256.Sum256([]byte(sessionID))
+	return hex.EncodeToString(sum[:4])
+}
+
+// watermarkChunkHash returns the first 16 bytes of the SHA-256 of an audio chunk, hex encoded
+func watermarkChunkHash(chunk []byte) string {
+	sum := sha256.Sum256(chunk)
+	return hex.EncodeToString(sum[:16])
+}
+
+// Record returns the watermark of the next chunk and advances the audio offset
+func (w *audioWatermarker) Record(chunkIndex int64, chunk []byte) WatermarkRecord {
+	record := WatermarkRecord{
+		SessionID:   w.sessionID,
+		SessionHash: w.sessionHash,
+		ChunkIndex:  chunkIndex,
+		Offset:      w.offset,
+		Length:      len(chunk),
+		SHA256:      watermarkChunkHash(chunk),
+		Timestamp:   time.Now(),
+	}
+	w.offset += int64(len(chunk))
+	return record
+}
+
+// appendWatermarkRecord appends a chunk watermark to the session's watermark log when persistence is enabled
+func appendWatermarkRecord(record WatermarkRecord) error {
+	return appendSessionLine(record.SessionID, ".watermark.jsonl", record)
+}
+
+// verifyWatermark checks a recording of a session's received audio against its watermark log
+// and returns the chunks that do not match; an empty result means the recording is intact
+func verifyWatermark(audioFile, watermarkLog string) ([]WatermarkMismatch, error) {
+	audio, err := os.ReadFile(audioFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading audio: %v", err)
+	}
+	f, err := os.Open(watermarkLog)
+	if err != nil {
+		return nil, fmt.Errorf("error opening watermark log: %v", err)
+	}
+	defer f.Close()
+
+	mismatches := []WatermarkMismatch{}
+	var end int64
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record WatermarkRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("error decoding watermark log line %d: %v", line, err)
+		}
+		end = max(end, record.Offset+int64(record.Length))
+
+		mismatch := WatermarkMismatch{ChunkIndex: record.ChunkIndex, Offset: record.Offset}
+		switch {
+		case record.SessionHash != watermarkSessionHash(record.SessionID):
+			mismatch.Reason = watermarkSessionChange
+		case record.Offset < 0 || record.Length < 0 || record.Offset+int64(record.Length) > int64(len(audio)):
+			mismatch.Reason = watermarkTruncated
+		case watermarkChunkHash(audio[record.Offset:record.Offset+int64(record.Length)]) != record.SHA256:
+			mismatch.Reason = watermarkHashMismatch
+		default:
+			continue
+		}
+		mismatches = append(mismatches, mismatch)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading watermark log: %v", err)
+	}
+
+	if int64(len(audio)) > end {
+		mismatches = append(mismatches, WatermarkMismatch{ChunkIndex: -1, Offset: end, Reason: watermarkUnlogged})
+	}
+	return mismatches, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestVerifyWatermark(t *testing.T) {
+	chunks := [][]byte{bytes.Repeat([]byte{1}, 100), bytes.Repeat([]byte{2}, 50), bytes.Repeat([]byte{3}, 80)}
+	audio := bytes.Join(chunks, nil)
+	tampered := bytes.Clone(audio)
+	tampered[120] ^= 0xff // Inside the second chunk
+
+	tests := []struct {
+		name    string
+		audio   []byte
+		edit    func(records []WatermarkRecord) // Alters the log before it is written
+		extra   string                          // Raw line appended to the log
+		want    []WatermarkMismatch
+		wantErr bool
+	}{
+		{"intact recording", audio, nil, "", []WatermarkMismatch{}, false},
+		{"tampered chunk", tampered, nil, "", []WatermarkMismatch{{ChunkIndex: 2, Offset: 100, Reason: watermarkHashMismatch}}, false},
+		{"truncated recording", audio[:200], nil, "", []WatermarkMismatch{{ChunkIndex: 3, Offset: 150, Reason: watermarkTruncated}}, false},
+		{"audio past the last chunk", append(bytes.Clone(audio), 9), nil, "", []WatermarkMismatch{{ChunkIndex: -1, Offset: 230, Reason: watermarkUnlogged}}, false},
+		{"record from another session", audio, func(records []WatermarkRecord) { records[0].SessionHash = watermarkSessionHash("other") }, "",
+			[]WatermarkMismatch{{ChunkIndex: 1, Offset: 0, Reason: watermarkSessionChange}}, false},
+		{"blank lines skipped", audio, nil, "\n", []WatermarkMismatch{}, false},
+		{"corrupt log", audio, nil, "{not json\n", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("TRANSCRIPT_DIR", dir)
+
+			watermarker := newAudioWatermarker("session")
+			var records []WatermarkRecord
+			for i, chunk := range chunks {
+				records = append(records, watermarker.Record(int64(i+1), chunk))
+			}
+			if tt.edit != nil {
+				tt.edit(records)
+			}
+			logPath := sessionFilePath(dir, "session", ".watermark.jsonl")
+			var log bytes.Buffer
+			for _, record := range records {
+				line, _ := json.Marshal(record)
+				log.Write(append(line, '\n'))
+			}
+			log.WriteString(tt.extra)
+			if err := os.WriteFile(logPath, log.Bytes(), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			audioPath := filepath.Join(dir, "audio.raw")
+			if err := os.WriteFile(audioPath, tt.audio, 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := verifyWatermark(audioPath, logPath)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verifyWatermark() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("verifyWatermark() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppendWatermarkRecord(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TRANSCRIPT_DIR", dir)
+	watermarker := newAudioWatermarker("session")
+	audio := []byte("first chunk second chunk")
+	for i, chunk := range [][]byte{audio[:12], audio[12:]} {
+		if err := appendWatermarkRecord(watermarker.Record(int64(i+1), chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	audioPath := filepath.Join(dir, "audio.raw")
+	if err := os.WriteFile(audioPath, audio, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	mismatches, err := verifyWatermark(audioPath, filepath.Join(dir, "session.watermark.jsonl"))
+	if err != nil || len(mismatches) != 0 {
+		t.Errorf("verifyWatermark() = %v, %v, want the logged audio to verify", mismatches, err)
+	}
+}
+
+func TestVerifyWatermarkMissingFiles(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "file")
+	if err := os.WriteFile(existing, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "missing")
+	for _, paths := range [][2]string{{missing, existing}, {existing, missing}} {
+		if _, err := verifyWatermark(paths[0], paths[1]); err == nil {
+			t.Errorf("verifyWatermark(%s, %s) succeeded, want an error", paths[0], paths[1])
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+// validateWebhookURL checks that a webhook URL is an absolute http(s) URL that does not name a local or private host.
+// Host names are checked again against their resolved addresses when dialing, see webhookDialControl.
+func validateWebhookURL(raw string) error {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid webhook URL: %v", err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("unsupported webhook URL scheme %q", parsed.Scheme)
+	}
+	if parsed.Host == "" {
+		return fmt.Errorf("webhook URL has no host")
+	}
+	if webhookAllowPrivateNetworks {
+		return nil
+	}
+	host := strings.TrimSuffix(strings.ToLower(parsed.Hostname()), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") || host == "metadata.google.internal" {
+		return fmt.Errorf("webhook URL host %q is not allowed", parsed.Hostname())
+	}
+	if ip, err := netip.ParseAddr(host); err == nil && !isPublicWebhookAddr(ip) {
+		return fmt.Errorf("webhook URL address %s is not allowed", ip)
+	}
+	return nil
+}
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598), not covered by netip.Addr.IsPrivate
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// isPublicWebhookAddr reports whether a webhook may be delivered to ip: loopback, private, link-local
+// (including the 169.254.169.254 metadata server), shared, multicast and unspecified addresses are refused
+func isPublicWebhookAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsValid() &&
+		!ip.IsLoopback() &&
+		!ip.IsPrivate() &&
+		!ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast() &&
+		!ip.IsUnspecified() &&
+		!sharedAddressSpace.Contains(ip)
+}
+
+// webhookDialControl refuses connections to non-public addresses; it runs after DNS resolution,
+// so it also covers host names resolving to internal addresses and redirects to them
+func webhookDialControl(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("webhook dial to %s refused: %v", address, err)
+	}
+	if !isPublicWebhookAddr(addrPort.Addr()) {
+		return fmt.Errorf("webhook dial to non-public address %s refused", addrPort.Addr())
+	}
+	return nil
+}
+
+// signWebhookPayload computes the hex-encoded HMAC-SHA256 of payload using secret
+func signWebhookPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// notifySummaryWebhook delivers a summary notification to the configured webhook
+func notifySummaryWebhook(url, secret string, payload WebhookPayload) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		logger.Error("Failed to marshal webhook payload", "sessionID", payload.SessionID, "error", err)
+		return
+	}
+
+	if err := sendWebhook(context.Background(), url, secret, data); err != nil {
+		logger.Error("Failed to deliver summary webhook",
+			"sessionID", payload.SessionID,
+			"url", url,
+			"error", err)
+		return
+	}
+	logger.Info("Summary webhook delivered", "sessionID", payload.SessionID, "url", url)
+}
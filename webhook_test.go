@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestValidateWebhookURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		wantErr bool
+	}{
+		{"https host", "https://hooks.example.com/summary", false},
+		{"http with port", "http://hooks.example.com:8443/x", false},
+		{"public IP", "https://8.8.8.8/hook", false},
+		{"unsupported scheme", "ftp://hooks.example.com/x", true},
+		{"file scheme", "file:///etc/passwd", true},
+		{"relative", "/hook", true},
+		{"no host", "https:///hook", true},
+		{"localhost", "http://localhost:8080/hook", true},
+		{"localhost trailing dot", "http://LOCALHOST./hook", true},
+		{"localhost subdomain", "http://api.localhost/hook", true},
+		{"metadata host", "http://metadata.google.internal/computeMetadata/v1/", true},
+		{"metadata IP", "http://169.254.169.254/latest/meta-data", true},
+		{"loopback", "http://127.0.0.1:9000/", true},
+		{"private", "http://10.1.2.3/", true},
+		{"shared address space", "http://100.64.0.1/", true},
+		{"IPv6 loopback", "http://[::1]/", true},
+		{"IPv4-mapped loopback", "http://[::ffff:127.0.0.1]/", true},
+		{"IPv6 unique local", "http://[fd00:ec2::254]/", true},
+		{"unspecified", "http://0.0.0.0/", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateWebhookURL(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateWebhookURL(%q) error = %v, wantErr %v", tt.url, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIsPublicWebhookAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"192.168.1.1", false},
+		{"172.16.0.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"224.0.0.1", false},
+		{"::", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := isPublicWebhookAddr(netip.MustParseAddr(tt.addr)); got != tt.want {
+				t.Errorf("isPublicWebhookAddr(%s) = %v, want %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookClientRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	tests := []struct {
+		name                 string
+		allowPrivateNetworks bool
+		wantErr              bool
+	}{
+		{"guarded", false, true},
+		{"private networks allowed", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newWebhookClient(1, time.Second, tt.allowPrivateNetworks)
+			req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, server.URL, nil)
+			resp, err := client.Do(req)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Do() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNotifySummaryWebhookSignature(t *testing.T) {
+	t.Cleanup(func() { webhookClient = newWebhookClient(defaultWebhookMaxIdleConns, defaultWebhookTimeout, false) })
+	webhookClient = newWebhookClient(defaultWebhookMaxIdleConns, time.Second, true)
+
+	tests := []struct {
+		name          string
+		secret        string
+		wantSignature bool
+	}{
+		{"signed", "s3cret", true},
+		{"unsigned without a secret", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received := make(chan *http.Request, 1)
+			bodies := make(chan []byte, 1)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				received <- r
+				bodies <- body
+			}))
+			defer server.Close()
+
+			notifySummaryWebhook(server.URL, tt.secret, WebhookPayload{SessionID: "abc", Summary: "Decisions taken.", TokenCount: 42})
+			r, body := <-received, <-bodies
+
+			var payload WebhookPayload
+			if err := json.Unmarshal(body, &payload); err != nil || payload.SessionID != "abc" || payload.Summary != "Decisions taken." {
+				t.Errorf("payload = %s (%v)", body, err)
+			}
+			signature := r.Header.Get("X-Signature-256")
+			if !tt.wantSignature {
+				if signature != "" {
+					t.Errorf("X-Signature-256 = %q, want none", signature)
+				}
+				return
+			}
+			mac := hmac.New(sha256.New, []byte(tt.secret))
+			mac.Write(body)
+			if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); signature != want {
+				t.Errorf("X-Signature-256 = %q, want %q", signature, want)
+			}
+		})
+	}
+}
@@ -1,22 +1,138 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	speech "cloud.google.com/go/speech/apiv1"
 	"github.com/gorilla/websocket"
+	"golang.org/x/time/rate"
+	"google.golang.org/genai"
 	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// maxRetranscriptionRange is the longest range re-transcribed at once; Recognize accepts up to a minute of audio
+const maxRetranscriptionRange = time.Minute
+
+// defaultRetranscriptionMaxAudioBytes bounds the audio kept for re-transcription, about 30 minutes of 16kHz LINEAR16
+const defaultRetranscriptionMaxAudioBytes = 64 << 20
+
+// isTransientWriteError reports whether a failed write may succeed if attempted again; only timeouts qualify,
+// a closed or reset connection will not recover
+func isTransientWriteError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// summaryRetrier re-sends summaries whose write to the client timed out, waiting delay before each of up to
+// maxRetries attempts. Summaries it cannot deliver are persisted to the session's summary file instead.
+type summaryRetrier struct {
+	session    *Session
+	send       func(v interface{}) error
+	delay      time.Duration
+	maxRetries int
+	queue      chan *SummaryResponse
+	logger     *slog.Logger
+}
+
+// newSummaryRetrier creates a retrier sending through send, with room for 5 summaries waiting for a retry
+func newSummaryRetrier(session *Session, send func(v interface{}) error, delay time.Duration, maxRetries int, logger *slog.Logger) *summaryRetrier {
+	return &summaryRetrier{
+		session:    session,
+		send:       send,
+		delay:      delay,
+		maxRetries: maxRetries,
+		queue:      make(chan *SummaryResponse, 5),
+		logger:     logger,
+	}
+}
+
+// persist writes a summary that never reached the client to the transcript directory
+func (r *summaryRetrier) persist(summary *SummaryResponse) {
+	r.logger.Warn("Summary could not be delivered to client, persisting it")
+	if err := writeSessionSummary(r.session.ID, summary.Text); err != nil {
+		r.logger.Error("Failed to persist undelivered summary", "error", err)
+	}
+}
+
+// Queue schedules a summary write that failed with err for another attempt;
+// summaries that cannot be delivered on this connection are persisted right away
+func (r *summaryRetrier) Queue(summary *SummaryResponse, err error) {
+	if !isTransientWriteError(err) {
+		r.persist(summary)
+		return
+	}
+	select {
+	case r.queue <- summary:
+	default:
+		r.persist(summary)
+	}
+}
+
+// Run retries queued summaries until ctx is done, then persists those still waiting
+func (r *summaryRetrier) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			// The connection is gone, keep whatever is still waiting
+			for {
+				select {
+				case summary := <-r.queue:
+					r.persist(summary)
+				default:
+					return
+				}
+			}
+		case summary := <-r.queue:
+			if !r.retry(ctx, summary) {
+				r.persist(summary)
+			}
+		}
+	}
+}
+
+// retry re-sends a summary, reporting whether it was delivered or a newer summary made it obsolete
+func (r *summaryRetrier) retry(ctx context.Context, summary *SummaryResponse) bool {
+	for attempt := 1; attempt <= r.maxRetries; attempt++ {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(r.delay):
+		}
+		// A newer summary reached the client while this one waited
+		if r.session.summarySuperseded(summary.SummaryID) {
+			r.logger.Debug("Dropping summary retry superseded by a newer summary", "summaryID", summary.SummaryID)
+			return true
+		}
+		err := r.send(summary)
+		if err == nil {
+			r.session.markSummaryDelivered(summary.SummaryID)
+			r.logger.Info("Summary delivered after retry", "attempt", attempt)
+			return true
+		}
+		r.logger.Warn("Summary retry failed", "attempt", attempt, "error", err)
+		if !isTransientWriteError(err) {
+			return false
+		}
+	}
+	return false
+}
+
 // WebSocket upgrader
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
@@ -27,37 +143,70 @@ var upgrader = websocket.Upgrader{
 // handleWebSocket handles WebSocket connections for live audio transcription using Google Cloud Speech-to-Text
 func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	var mu sync.Mutex // Mutex to protect concurrent writes to the WebSocket connection
+
+	// Capture client metadata from the upgrade request headers
+	clientMetadata := newClientMetadata(r)
+
 	// Upgrade HTTP connection to WebSocket
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		logger.Error("WebSocket upgrade failed", "error", err)
+		auditLogger.Log(newAuditRecord(r, "", "failure: upgrade failed: "+err.Error()))
 		return
 	}
 	defer conn.Close()
 
-	logger.Info("WebSocket connection established")
+	logger.Info("WebSocket connection established",
+		"remoteIP", clientMetadata.RemoteIP,
+		"userAgent", clientMetadata.UserAgent)
 
 	// Create a context that can be cancelled when the WebSocket closes
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Read the initial configuration message from the client
+	// Read the initial configuration message from the client, giving up if it does not arrive in time
+	configTimeout := time.Duration(getEnvInt64("CONFIG_TIMEOUT_SECONDS", 10)) * time.Second
+	if configTimeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(configTimeout))
+	}
 	_, p, err := conn.ReadMessage()
 	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			logger.Warn("Timed out waiting for config message", "remoteIP", clientMetadata.RemoteIP, "timeout", configTimeout)
+			auditLogger.Log(newAuditRecord(r, "", "failure: configuration message timeout"))
+			statusData, _ := json.Marshal(StatusResponse{
+				Type:      "status",
+				Status:    "config_timeout",
+				Message:   fmt.Sprintf("No configuration message received within %s", configTimeout),
+				Timestamp: Timestamp{Time: time.Now()},
+			})
+			conn.WriteMessage(websocket.TextMessage, statusData)
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "configuration timeout"))
+			return
+		}
 		logger.Error("Failed to read config message", "error", err)
+		auditLogger.Log(newAuditRecord(r, "", "failure: no configuration message"))
 		cancel() // Cancel context on error
 		return
 	}
+	conn.SetReadDeadline(time.Time{})
 
 	var config ConfigMessage
 	if err := json.Unmarshal(p, &config); err != nil {
 		logger.Error("Failed to unmarshal config message", "error", err)
+		auditLogger.Log(newAuditRecord(r, "", "failure: invalid configuration message"))
 		cancel() // Cancel context on error
 		return
 	}
 
+	// The session is created as soon as its configuration is known, so everything logged from here on carries its ID
+	session := newSession(cancel, config)
+	session.Client = clientMetadata
+	sessionLogger := newSessionLogger(session.ID, config.LogLevel)
+
 	// Log detailed configuration information
-	logger.Info("Received configuration",
+	sessionLogger.Info("Received configuration",
 		"audioFormat", config.AudioFormat,
 		"languageCode", config.LanguageCode,
 		"alternativeLanguageCodes", config.AlternativeLanguageCodes,
@@ -67,11 +216,11 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 
 	// Log custom words if present
 	if len(config.CustomWords) > 0 {
-		logger.Info("Custom words configuration received",
+		sessionLogger.Info("Custom words configuration received",
 			"words", config.CustomWords,
 			"count", len(config.CustomWords))
 		for i, word := range config.CustomWords {
-			logger.Debug("Custom word detail",
+			sessionLogger.Debug("Custom word detail",
 				"index", i+1,
 				"word", word,
 				"length", len(word))
@@ -80,22 +229,22 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 
 	// Log phrase sets configuration if present
 	if config.PhraseSets != nil {
-		logger.Info("Phrase sets configuration received",
+		sessionLogger.Info("Phrase sets configuration received",
 			"phrasesCount", len(config.PhraseSets.Phrases))
 		for i, phrase := range config.PhraseSets.Phrases {
-			logger.Info("Phrase set item",
+			sessionLogger.Info("Phrase set item",
 				"index", i+1,
 				"phrase", phrase.Value,
 				"boost", phrase.Boost,
 				"phraseLength", len(phrase.Value))
 		}
 	} else {
-		logger.Debug("No phrase sets configuration provided")
+		sessionLogger.Debug("No phrase sets configuration provided")
 	}
 
 	// Log classes configuration if present
 	if config.Classes != nil {
-		logger.Info("Classes configuration received",
+		sessionLogger.Info("Classes configuration received",
 			"predefinedClassesCount", len(config.Classes.PredefinedClasses),
 			"customClassesCount", len(config.Classes.CustomClasses),
 			"hasLegacyCustomClassItems", len(config.Classes.CustomClassItems) > 0,
@@ -103,10 +252,10 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 
 		// Log predefined classes
 		if len(config.Classes.PredefinedClasses) > 0 {
-			logger.Info("Predefined classes",
+			sessionLogger.Info("Predefined classes",
 				"classes", config.Classes.PredefinedClasses)
 			for i, class := range config.Classes.PredefinedClasses {
-				logger.Debug("Predefined class detail",
+				sessionLogger.Debug("Predefined class detail",
 					"index", i+1,
 					"class", class)
 			}
@@ -115,13 +264,13 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		// Log custom classes (new format)
 		if len(config.Classes.CustomClasses) > 0 {
 			for i, customClass := range config.Classes.CustomClasses {
-				logger.Info("Custom class configuration",
+				sessionLogger.Info("Custom class configuration",
 					"classIndex", i+1,
 					"className", customClass.Name,
 					"itemsCount", len(customClass.Items),
 					"boost", customClass.Boost)
 				for j, item := range customClass.Items {
-					logger.Debug("Custom class item detail",
+					sessionLogger.Debug("Custom class item detail",
 						"classIndex", i+1,
 						"className", customClass.Name,
 						"itemIndex", j+1,
@@ -133,22 +282,73 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 
 		// Log legacy custom class items
 		if len(config.Classes.CustomClassItems) > 0 {
-			logger.Info("Legacy custom class items received",
+			sessionLogger.Info("Legacy custom class items received",
 				"itemsCount", len(config.Classes.CustomClassItems),
 				"boost", config.Classes.Boost)
 			for i, item := range config.Classes.CustomClassItems {
-				logger.Debug("Legacy custom class item detail",
+				sessionLogger.Debug("Legacy custom class item detail",
 					"index", i+1,
 					"item", item,
 					"itemLength", len(item))
 			}
 		}
 	} else {
-		logger.Debug("No classes configuration provided")
+		sessionLogger.Debug("No classes configuration provided")
+	}
+
+	// Ignore invalid webhook URLs rather than failing the session
+	if config.WebhookURL != "" {
+		if err := validateWebhookURL(config.WebhookURL); err != nil {
+			sessionLogger.Warn("Ignoring invalid webhook URL", "webhookURL", config.WebhookURL, "error", err)
+			config.WebhookURL = ""
+		}
+	}
+	if config.SlackWebhookURL != "" {
+		if err := validateWebhookURL(config.SlackWebhookURL); err != nil {
+			sessionLogger.Warn("Ignoring invalid Slack webhook URL", "error", err)
+			config.SlackWebhookURL = ""
+		}
+	}
+
+	// Register the session so its state can be managed alongside other active sessions
+	sessionRegistry.Register(session)
+	defer sessionRegistry.Unregister(session.ID)
+	session.setDisconnect(func() { conn.SetReadDeadline(time.Now()) })
+	sessionPubSub.Open(session.ID)
+	defer sessionPubSub.Close(session.ID)
+
+	// writeText sends a message to the client and publishes it to the session's viewers; callers hold mu
+	writeText := func(data []byte) error {
+		sessionPubSub.Publish(session.ID, data)
+		return conn.WriteMessage(websocket.TextMessage, data)
+	}
+
+	sessionLogger.Info("Session registered",
+		"multiLanguageMode", config.MultiLanguageMode,
+		"remoteIP", clientMetadata.RemoteIP)
+
+	// Accept-Language is only a hint: log mismatches with the configured language but do not enforce it
+	if browserLanguage := preferredLanguage(clientMetadata.AcceptLanguage); browserLanguage != "" && config.LanguageCode != "" {
+		browserBase := strings.ToLower(strings.Split(browserLanguage, "-")[0])
+		configBase := strings.ToLower(strings.Split(config.LanguageCode, "-")[0])
+		if browserBase != configBase {
+			sessionLogger.Info("Configured language differs from browser preference",
+				"languageCode", config.LanguageCode,
+				"browserLanguage", browserLanguage)
+		}
 	}
+	if err := writeSessionMetadata(session.Metadata()); err != nil {
+		sessionLogger.Error("Failed to persist session metadata", "error", err)
+	}
+	session.recordEvent("session_started", map[string]interface{}{
+		"languageCode":      config.LanguageCode,
+		"audioFormat":       config.AudioFormat.Format,
+		"multiLanguageMode": config.MultiLanguageMode,
+		"remoteIP":          clientMetadata.RemoteIP,
+	})
 
 	// Debug: Log the exact format string received
-	logger.Debug("Exact audio format received", "format", config.AudioFormat.Format)
+	sessionLogger.Debug("Exact audio format received", "format", config.AudioFormat.Format)
 
 	// Get project ID and location from environment variables
 	projectID := os.Getenv("GCP_PROJECT_ID")
@@ -157,38 +357,164 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	if geminiModel == "" {
 		geminiModel = "gemini-2.5-flash"
 	}
+	// Sessions may pick a different model from the allowlist
+	geminiModel, err = selectGeminiModel(config.GeminiModel, geminiModel, allowedGeminiModels())
+	var fallbackModel string
+	if err == nil {
+		fallbackModel, err = selectGeminiFallbackModel(config.GeminiFallbackModel, allowedGeminiModels())
+	}
+	var redactionPatterns []*regexp.Regexp
+	if err == nil && config.RedactPII {
+		redactionPatterns, err = compileRedactionPatterns(config.CustomRedactionPatterns)
+	}
+	var recreationStrategy string
+	if err == nil {
+		recreationStrategy, err = selectStreamRecreationStrategy(config.StreamRecreationStrategy)
+	}
+	var summaryLanguage string
+	if err == nil {
+		summaryLanguage, err = selectSummaryLanguage(config.SummaryLanguage, config.LanguageCode)
+	}
+	var summaryFormat string
+	if err == nil {
+		summaryFormat, err = selectSummaryFormat(config.SummaryFormat)
+	}
+	var punctuationModel string
+	if err == nil {
+		punctuationModel, err = selectAutoPunctuateModel(config.AutoPunctuateModel, allowedGeminiModels())
+	}
+	var timestampFormat string
+	if err == nil {
+		timestampFormat, err = selectTimestampFormat(config.TimestampFormat)
+	}
+	var safetySettings []*genai.SafetySetting
+	if err == nil {
+		safetySettings, err = selectSafetySettings(config.GeminiSafetySettings)
+	}
+	var recognitionMetadata *speechpb.RecognitionMetadata
+	if err == nil {
+		recognitionMetadata, err = selectRecognitionMetadata(config.RecognitionMetadata)
+	}
+	for _, ref := range config.PhraseSetResources {
+		if err != nil {
+			break
+		}
+		err = validatePhraseSetRef(ref, projectID)
+	}
+	if err == nil {
+		err = validateAutoDetectLanguage(config.AutoDetectLanguage, config.LanguageCode, config.Model)
+	}
+	silenceTimeout := time.Duration(getEnvInt64("SILENCE_TIMEOUT_SECONDS", 0)) * silenceTimeoutUnit
+	var inactivityWarning time.Duration
+	if err == nil {
+		inactivityWarning, err = selectInactivityWarning(config.InactivityWarningSeconds, silenceTimeout)
+	}
+	if err != nil {
+		sessionLogger.Warn("Rejecting session configuration", "error", err)
+		auditLogger.Log(newAuditRecord(r, session.ID, "failure: "+err.Error()))
+		statusData, _ := json.Marshal(StatusResponse{
+			Type:      "status",
+			Status:    "config_error",
+			Message:   err.Error(),
+			Timestamp: session.Timestamp(time.Now()),
+		})
+		mu.Lock()
+		writeText(statusData)
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "invalid configuration"))
+		mu.Unlock()
+		return
+	}
+	session.setTimestampFormat(timestampFormat)
+	auditLogger.Log(newAuditRecord(r, session.ID, "success"))
+
+	// cloudAudit records a session operation in the Cloud Logging audit log when it is enabled
+	cloudAudit := func(method string, metadata map[string]interface{}) {
+		cloudAuditLogger.Log(CloudAuditEntry{
+			MethodName:     "live_transcription.session." + method,
+			SessionID:      session.ID,
+			PrincipalEmail: authenticatedEmail(r),
+			CallerIP:       clientIP(r),
+			UserAgent:      r.UserAgent(),
+			Metadata:       metadata,
+		})
+	}
+	cloudAudit("start", map[string]interface{}{"languageCode": config.LanguageCode, "geminiModel": geminiModel})
+	summaryOptions := SummaryOptions{
+		Language:           summaryLanguage,
+		TranscriptLanguage: config.LanguageCode,
+		Format:             summaryFormat,
+		FocusTopics:        normalizeFocusTopics(config.SummaryFocusTopics),
+		SafetySettings:     safetySettings,
+		MaxParagraphLength: config.MaxSummaryParagraphLength,
+	}
+
+	// Punctuate final results for models that return none; Gemini punctuation costs tokens so it is opt-in server-side
+	autoPunctuateEnabled := config.AutoPunctuate && os.Getenv("AUTO_PUNCTUATE_ENABLED") != "false"
+	if autoPunctuateEnabled && punctuationModel != "" && (os.Getenv("AUTO_PUNCTUATE_GEMINI_ENABLED") != "true" || projectID == "" || location == "") {
+		sessionLogger.Warn("Gemini punctuation unavailable, using rule-based punctuation", "model", punctuationModel)
+		punctuationModel = ""
+	}
+	punctuationTimeout := time.Duration(getEnvInt64("AUTO_PUNCTUATE_TIMEOUT_MS", 3000)) * time.Millisecond
+
 	if projectID == "" || location == "" {
-		logger.Warn("GCP environment variables not set, summary generation disabled",
+		sessionLogger.Warn("GCP environment variables not set, summary generation disabled",
 			"missing", "GCP_PROJECT_ID or GCP_LOCATION")
 	} else {
-		logger.Info("GCP configuration loaded",
+		sessionLogger.Info("GCP configuration loaded",
 			"projectID", projectID,
 			"location", location,
 			"geminiModel", geminiModel)
 	}
 
 	// Create Speech-to-Text client
-	client, err := speech.NewClient(ctx)
+	client, releaseClient, err := acquireSpeechClient(ctx)
 	if err != nil {
-		logger.Error("Failed to create Speech-to-Text client", "error", err)
+		sessionLogger.Error("Failed to create Speech-to-Text client", "error", err)
 		return
 	}
-	defer client.Close()
+	defer releaseClient()
 
 	// Create speech contexts using the new advanced configuration
 	var speechContexts []*speechpb.SpeechContext
-	speechContexts = createAdvancedSpeechContexts(config.CustomWords, config.PhraseSets, config.Classes)
+	speechContexts = createAdvancedSpeechContexts(config.CustomWords, config.PhraseSets, config.Classes, 0)
 	if speechContexts != nil && len(speechContexts) > 0 {
-		logger.Info("Using advanced SpeechContexts for enhanced recognition", "totalContexts", len(speechContexts))
+		sessionLogger.Info("Using advanced SpeechContexts for enhanced recognition", "totalContexts", len(speechContexts))
+	}
+
+	// Auto-scaled boosts are recomputed from the transcript length whenever a stream is opened
+	autoScaleBoost := (config.PhraseSets != nil && config.PhraseSets.AutoScaleBoost) || (config.Classes != nil && config.Classes.AutoScaleBoost)
+	baseSpeechContexts := speechContexts
+
+	// Model adaptation replaces the initial SpeechContexts when enabled; keywords added during the session still use SpeechContexts
+	// Synonyms of the custom words are recognized too, with a lower boost
+	var synonyms []string
+	if config.EnableSynonymExpansion {
+		if synonyms = expandWithSynonyms(config.CustomWords); len(synonyms) > 0 {
+			sessionLogger.Info("Custom words expanded with synonyms", "synonyms", synonyms)
+		}
+	}
+
+	var adaptation *speechpb.SpeechAdaptation
+	if speechAdaptationEnabled() {
+		adaptation = createSpeechAdaptation(config.CustomWords, synonyms, config.PhraseSets, config.Classes, config.PhraseSetResources)
+		if adaptation != nil {
+			speechContexts = nil
+		}
+		if len(config.PhraseSetResources) > 0 {
+			sessionLogger.Info("Phrase set references applied", "phraseSetReferences", config.PhraseSetResources)
+		}
+	} else if len(config.PhraseSetResources) > 0 {
+		sessionLogger.Warn("Phrase set references ignored, set USE_ADAPTATION_V1P1BETA=true to apply them",
+			"phraseSetReferences", config.PhraseSetResources)
+	}
+
+	// Model adaptation carries the synonyms in its phrase set; otherwise they get their own context
+	if adaptation == nil && len(synonyms) > 0 {
+		speechContexts = append(speechContexts, synonymSpeechContext(synonyms))
 	}
 
 	// Store initial speech contexts and keywords for dynamic updates
-	keywordsMu.Lock()
-	currentSpeechContexts = make([]*speechpb.SpeechContext, len(speechContexts))
-	copy(currentSpeechContexts, speechContexts)
-	dynamicKeywords = make([]string, len(config.CustomWords))
-	copy(dynamicKeywords, config.CustomWords)
-	keywordsMu.Unlock()
+	sessionState := newSessionState(speechContexts, config.CustomWords)
 
 	// Set default language codes if none are provided by the client
 	primaryLanguage := config.LanguageCode
@@ -196,59 +522,99 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		primaryLanguage = "en-US" // Default primary language
 	}
 	alternativeLanguages := config.AlternativeLanguageCodes
-	if len(alternativeLanguages) == 0 && primaryLanguage == "en-US" {
-		alternativeLanguages = []string{"fr-FR", "es-ES"} // Default alternatives if primary is en-US and no alternatives provided
+	if len(alternativeLanguages) == 0 {
+		alternativeLanguages = defaultAlternativeLanguages(primaryLanguage) // Explicit alternatives from the client always take precedence
+	}
+
+	// Automatic language detection was validated against the model and API version with the rest of the config
+	if config.AutoDetectLanguage {
+		primaryLanguage = "auto"
+		alternativeLanguages = nil
 	}
 
-	logger.Info("Language configuration",
+	sessionLogger.Info("Language configuration",
 		"primaryLanguage", primaryLanguage,
 		"alternativeLanguages", alternativeLanguages)
 
+	// Enhanced mode is still requested when unsupported; the API falls back to the standard model
+	if config.UseEnhanced {
+		for _, warning := range enhancedModeWarnings(config.Model, primaryLanguage) {
+			sessionLogger.Warn("Enhanced recognition may be ignored", "reason", warning)
+		}
+	}
+
 	// Map audio format string to Google Speech API encoding
-	var encoding speechpb.RecognitionConfig_AudioEncoding
-	formatLower := strings.ToLower(config.AudioFormat.Format)
-
-	logger.Debug("Mapping audio format to Speech API encoding", "format", config.AudioFormat.Format)
-
-	switch formatLower {
-	case "linear16":
-		encoding = speechpb.RecognitionConfig_LINEAR16
-		logger.Debug("Audio encoding selected", "encoding", "LINEAR16")
-	case "ogg_opus":
-		encoding = speechpb.RecognitionConfig_OGG_OPUS
-		logger.Debug("Audio encoding selected", "encoding", "OGG_OPUS")
-	case "webm_opus":
-		encoding = speechpb.RecognitionConfig_WEBM_OPUS
-		logger.Debug("Audio encoding selected", "encoding", "WEBM_OPUS")
-	case "flac":
-		encoding = speechpb.RecognitionConfig_FLAC
-		logger.Debug("Audio encoding selected", "encoding", "FLAC")
-	case "mulaw":
-		encoding = speechpb.RecognitionConfig_MULAW
-		logger.Debug("Audio encoding selected", "encoding", "MULAW")
-	default:
-		// Try using the value lookup as fallback
-		if encodingValue, exists := speechpb.RecognitionConfig_AudioEncoding_value[config.AudioFormat.Format]; exists {
-			encoding = speechpb.RecognitionConfig_AudioEncoding(encodingValue)
-			logger.Debug("Audio encoding from value lookup", "encoding", encoding)
-		} else {
-			logger.Warn("Unknown audio format, defaulting to LINEAR16", "format", config.AudioFormat.Format)
-			encoding = speechpb.RecognitionConfig_LINEAR16
+	encoding := audioEncoding(config.AudioFormat.Format)
+
+	// LINEAR16 audio can be resampled before forwarding, e.g. from 22050 Hz to the 16000 Hz most models are tuned for
+	forwardedSampleRate, resample := config.AudioFormat.SampleRate, false
+	if config.ResampleToHz != 0 && config.ResampleToHz != config.AudioFormat.SampleRate {
+		switch {
+		case encoding != speechpb.RecognitionConfig_LINEAR16:
+			sessionLogger.Warn("Resampling is only supported for LINEAR16 audio, forwarding audio unchanged",
+				"encoding", encoding)
+		case config.AudioFormat.SampleRate <= 0:
+			sessionLogger.Warn("Resampling requires the client sample rate, forwarding audio unchanged")
+		case config.ResampleToHz < minResampleHz || config.ResampleToHz > maxResampleHz:
+			sessionLogger.Warn("Resampling target out of range, forwarding audio unchanged",
+				"resampleToHz", config.ResampleToHz)
+		default:
+			forwardedSampleRate, resample = config.ResampleToHz, true
+			sessionLogger.Info("Resampling audio",
+				"fromHz", config.AudioFormat.SampleRate,
+				"toHz", config.ResampleToHz)
 		}
 	}
 
 	// Configure the streaming recognition request template
 	recognitionConfig := &speechpb.RecognitionConfig{
 		Encoding:                 encoding,
-		SampleRateHertz:          int32(config.AudioFormat.SampleRate),
+		SampleRateHertz:          int32(forwardedSampleRate),
 		LanguageCode:             primaryLanguage,
 		AlternativeLanguageCodes: alternativeLanguages,
+		Metadata:                 recognitionMetadata,
+	}
+	if recognitionMetadata != nil {
+		sessionLogger.Info("Recognition metadata applied",
+			"interactionType", recognitionMetadata.InteractionType.String(),
+			"microphoneDistance", recognitionMetadata.MicrophoneDistance.String(),
+			"recordingDeviceType", recognitionMetadata.RecordingDeviceType.String(),
+			"recordingDeviceName", recognitionMetadata.RecordingDeviceName,
+			"originalMediaType", recognitionMetadata.OriginalMediaType.String())
+	}
+
+	// Multi-channel audio is either recognized per channel or downmixed to mono before forwarding
+	var downmixer *pcmDownmixer
+	if config.AudioFormat.Channels > 1 {
+		if config.DownmixToMono && encoding == speechpb.RecognitionConfig_LINEAR16 {
+			downmixer = newPCMDownmixer(config.AudioFormat.Channels)
+		} else {
+			if config.DownmixToMono {
+				sessionLogger.Warn("Downmixing is only supported for LINEAR16 audio, recognizing channels separately",
+					"encoding", encoding)
+			}
+			recognitionConfig.AudioChannelCount = int32(config.AudioFormat.Channels)
+			recognitionConfig.EnableSeparateRecognitionPerChannel = true
+		}
+		sessionLogger.Info("Multi-channel audio configured",
+			"channels", config.AudioFormat.Channels,
+			"downmixToMono", downmixer != nil)
+	}
+
+	// The resampler runs after downmixing and keeps its position across chunks
+	var resampler *pcmResampler
+	if resample {
+		forwardedChannels := config.AudioFormat.Channels
+		if downmixer != nil {
+			forwardedChannels = 1
+		}
+		resampler = newPCMResampler(config.AudioFormat.SampleRate, forwardedSampleRate, forwardedChannels)
 	}
 
 	// Add speech contexts if available
 	if speechContexts != nil && len(speechContexts) > 0 {
 		recognitionConfig.SpeechContexts = speechContexts
-		logger.Info("Applied SpeechContexts to recognition configuration",
+		sessionLogger.Info("Applied SpeechContexts to recognition configuration",
 			"contextsCount", len(speechContexts),
 			"encoding", encoding,
 			"sampleRate", config.AudioFormat.SampleRate,
@@ -260,79 +626,156 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		for i, context := range speechContexts {
 			totalPhrases += len(context.Phrases)
 			totalBoostSum += context.Boost
-			logger.Debug("Applied SpeechContext to recognition config",
+			sessionLogger.Debug("Applied SpeechContext to recognition config",
 				"contextIndex", i+1,
 				"phrasesInContext", len(context.Phrases),
 				"contextBoost", context.Boost)
 		}
 		averageBoost := totalBoostSum / float32(len(speechContexts))
-		logger.Info("SpeechContexts application summary",
+		sessionLogger.Info("SpeechContexts application summary",
 			"totalContexts", len(speechContexts),
 			"totalPhrases", totalPhrases,
 			"averageBoost", averageBoost)
 	} else {
-		logger.Info("No SpeechContexts to apply to recognition configuration",
+		sessionLogger.Info("No SpeechContexts to apply to recognition configuration",
 			"encoding", encoding,
 			"sampleRate", config.AudioFormat.SampleRate,
 			"primaryLanguage", primaryLanguage)
 	}
 
-	logger.Info("Speech API configuration finalized",
+	sessionLogger.Info("Speech API configuration finalized",
 		"encoding", encoding,
 		"sampleRate", config.AudioFormat.SampleRate,
 		"language", primaryLanguage)
 
+	// The sample rate may be corrected once the audio header is known, so streams read it atomically
+	var sampleRateHertz atomic.Int32
+	sampleRateHertz.Store(int32(forwardedSampleRate))
+	detectSampleRate := encoding == speechpb.RecognitionConfig_FLAC && config.AudioFormat.SampleRate == 0
+
+	// Containerized Opus audio arrives in arbitrary fragments, so packet validation is only
+	// enabled for clients that send one raw Opus packet per message
+	validateOpus := os.Getenv("VALIDATE_OPUS_PACKETS") == "true" &&
+		(encoding == speechpb.RecognitionConfig_OGG_OPUS || encoding == speechpb.RecognitionConfig_WEBM_OPUS)
+	var droppedInvalidChunks int64
+
+	// LINEAR16 audio is metered and classified as speech or silence; long silences can end the session
+	var vad *voiceActivityDetector
+	if encoding == speechpb.RecognitionConfig_LINEAR16 {
+		vad = newVoiceActivityDetector(vadThresholdDBFS())
+	}
+
 	// Stream management variables
 	var stream speechpb.Speech_StreamingRecognizeClient
 	var streamMu sync.Mutex
 	streamStartTime := time.Now()
+	// Finals drained from a replaced stream overlap with the first finals of the stream that replaced it
+	streamOverlap := &streamOverlapFilter{}
 	const maxStreamDuration = 300 * time.Second // 300 seconds, slightly less than 305s limit
-	var pendingAudioChunks [][]byte             // Buffer for audio chunks during stream recreation
-
-	// Function to create or recreate the stream with optional updated speech contexts
-	createStream := func(updatedContexts []*speechpb.SpeechContext) error {
-		streamMu.Lock()
-		defer streamMu.Unlock()
+	// Audio received while the stream is unavailable is replayed once it is recreated
+	pendingAudio := newPendingAudioBuffer(time.Duration(getEnvInt64("AUDIO_BUFFER_MAX_MS", 2000)) * time.Millisecond)
+
+	// In seamless mode the next stream runs alongside the current one until it answers,
+	// primed with the most recent audio so no words are lost at the switch
+	seamlessRecreation := recreationStrategy == streamRecreationSeamless && !config.MultiLanguageMode
+	var handoverStream speechpb.Speech_StreamingRecognizeClient
+	const handoverAudioWindow = 500 * time.Millisecond
+	recentAudio := newAudioRingBuffer(handoverAudioWindow)
+
+	keywordDecayRate := config.KeywordBoostDecayRatePerMinute
+
+	// With BATCH_THRESHOLD_SECONDS, sessions with less audio are re-transcribed with the synchronous Recognize
+	// RPC when they end, which is more accurate for short clips but billed again; the audio is kept until then
+	batchThreshold := time.Duration(getEnvInt64("BATCH_THRESHOLD_SECONDS", 0)) * time.Second
+	const maxBatchAudioBytes = 10 << 20 // Recognize rejects inline audio larger than 10MB
+	shortAudioEligible := batchThreshold > 0 && !config.MultiLanguageMode
+	batchSlots := batchRecognitionSlots // Read once, as re-transcriptions outlive the handler
+	var shortAudio []byte
+	var firstAudioAt time.Time
+
+	// With ENABLE_RETRANSCRIPTION, forwarded audio of raw encodings is kept, up to RETRANSCRIPTION_MAX_AUDIO_BYTES,
+	// so segments can be transcribed again
+	var retainedAudio *audioRingBuffer
+	if os.Getenv("ENABLE_RETRANSCRIPTION") == "true" &&
+		(encoding == speechpb.RecognitionConfig_LINEAR16 || encoding == speechpb.RecognitionConfig_MULAW) {
+		retainedAudio = newRetainedAudioBuffer(int(getEnvInt64("RETRANSCRIPTION_MAX_AUDIO_BYTES", defaultRetranscriptionMaxAudioBytes)))
+	}
 
-		// Close existing stream if it exists
-		if stream != nil {
-			stream.CloseSend()
-			stream = nil
+	// With EmbedWatermark, every received chunk is hashed into a side-channel log; the audio is forwarded unchanged
+	var watermarker *audioWatermarker
+	if config.EmbedWatermark {
+		if getTranscriptDirectory() == "" {
+			sessionLogger.Warn("Audio watermarking requested without TRANSCRIPT_DIR, watermarks will not be stored")
+		} else {
+			watermarker = newAudioWatermarker(session.ID)
 		}
+	}
+
+	// takeShortAudio hands over the buffered audio of a short session, or nil once the session is too long
+	takeShortAudio := func() []byte {
+		audio := shortAudio
+		shortAudio, shortAudioEligible = nil, false
+		return audio
+	}
 
+	// Function to open a new bidirectional stream configured for the given languages and contexts
+	openStream := func(language string, alternatives []string, contexts []*speechpb.SpeechContext) (speechpb.Speech_StreamingRecognizeClient, error) {
 		// Check if context is still valid before creating new stream
 		if ctx.Err() != nil {
-			return fmt.Errorf("context cancelled, cannot create new stream: %v", ctx.Err())
+			return nil, fmt.Errorf("context cancelled, cannot create new stream: %v", ctx.Err())
 		}
 
 		// Create a new bidirectional streaming RPC
 		newStream, err := client.StreamingRecognize(ctx)
 		if err != nil {
-			return fmt.Errorf("failed to create streaming client: %v", err)
+			return nil, fmt.Errorf("failed to create streaming client: %v", err)
 		}
 
-		// Create updated recognition config with new contexts if provided
-		currentRecognitionConfig := &speechpb.RecognitionConfig{
-			Encoding:                 encoding,
-			SampleRateHertz:          int32(config.AudioFormat.SampleRate),
-			LanguageCode:             primaryLanguage,
-			AlternativeLanguageCodes: alternativeLanguages,
+		// Swap the configured contexts for ones with boosts scaled to the current transcript length;
+		// contexts are built deterministically, so they line up with the originals index by index
+		if autoScaleBoost && len(baseSpeechContexts) > 0 {
+			wordCount := countWords(session.Transcript())
+			scaled := createAdvancedSpeechContexts(config.CustomWords, config.PhraseSets, config.Classes, wordCount)
+			if len(scaled) == len(baseSpeechContexts) {
+				scaledContexts := make([]*speechpb.SpeechContext, len(contexts))
+				for i, speechContext := range contexts {
+					scaledContexts[i] = speechContext
+					for j, base := range baseSpeechContexts {
+						if speechContext == base {
+							scaledContexts[i] = scaled[j]
+							break
+						}
+					}
+				}
+				contexts = scaledContexts
+				sessionLogger.Debug("Speech context boosts scaled", "wordCount", wordCount)
+			}
 		}
 
-		// Use updated contexts if provided, otherwise use original speech contexts
-		var contextsToUse []*speechpb.SpeechContext
-		if updatedContexts != nil {
-			contextsToUse = updatedContexts
-			logger.Info("Using updated SpeechContexts for stream recreation",
-				"contextsCount", len(updatedContexts))
-		} else {
-			contextsToUse = speechContexts
-			logger.Debug("Using original SpeechContexts for stream recreation",
-				"contextsCount", len(speechContexts))
+		// With boost decay, keywords added during the session are appended here at their aged boost
+		// rather than carried in the contexts passed in
+		if keywordDecayRate > 0 {
+			if keywordContexts := keywordSpeechContexts(session.decayKeywordBoosts(keywordDecayRate, time.Now())); len(keywordContexts) > 0 {
+				contexts = append(contexts[:len(contexts):len(contexts)], keywordContexts...)
+			}
 		}
 
-		if len(contextsToUse) > 0 {
-			currentRecognitionConfig.SpeechContexts = contextsToUse
+		currentRecognitionConfig := &speechpb.RecognitionConfig{
+			Encoding:                 encoding,
+			SampleRateHertz:          sampleRateHertz.Load(),
+			LanguageCode:             language,
+			AlternativeLanguageCodes: alternatives,
+			EnableWordTimeOffsets:    true,
+			Model:                    config.Model,
+			UseEnhanced:              config.UseEnhanced,
+			Adaptation:               adaptation,
+			Metadata:                 recognitionMetadata,
+
+			AudioChannelCount:                   recognitionConfig.AudioChannelCount,
+			EnableSeparateRecognitionPerChannel: recognitionConfig.EnableSeparateRecognitionPerChannel,
+		}
+		if len(contexts) > 0 {
+			currentRecognitionConfig.SpeechContexts = contexts
 		}
 
 		// Create updated request template
@@ -347,59 +790,297 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 
 		// Send the initial configuration message
 		if err := newStream.Send(&currentReqTemplate); err != nil {
-			return fmt.Errorf("failed to send initial config to Speech-to-Text: %v", err)
+			return nil, fmt.Errorf("failed to send initial config to Speech-to-Text: %v", err)
+		}
+
+		return newStream, nil
+	}
+
+	// Function to create or recreate the stream with optional updated speech contexts
+	createStream := func(updatedContexts []*speechpb.SpeechContext) error {
+		streamMu.Lock()
+		defer streamMu.Unlock()
+
+		// Close existing stream if it exists, abandoning any seamless handover in progress
+		if stream != nil {
+			stream.CloseSend()
+			stream = nil
+		}
+		if handoverStream != nil {
+			handoverStream.CloseSend()
+			handoverStream = nil
+		}
+
+		// Use updated contexts if provided, otherwise use original speech contexts
+		var contextsToUse []*speechpb.SpeechContext
+		if updatedContexts != nil {
+			contextsToUse = updatedContexts
+			sessionLogger.Info("Using updated SpeechContexts for stream recreation",
+				"contextsCount", len(updatedContexts))
+		} else {
+			contextsToUse = speechContexts
+			sessionLogger.Debug("Using original SpeechContexts for stream recreation",
+				"contextsCount", len(speechContexts))
+		}
+
+		newStream, err := openStream(primaryLanguage, alternativeLanguages, contextsToUse)
+		if err != nil {
+			return err
 		}
 
 		stream = newStream
 		streamStartTime = time.Now()
+		streamOverlap.Switched()
+		session.recordEvent("stream_created", map[string]interface{}{"contextsCount": len(contextsToUse)})
 
 		// Send any buffered audio chunks
-		if len(pendingAudioChunks) > 0 {
-			logger.Info("Sending buffered audio chunks after stream recreation", "chunks", len(pendingAudioChunks))
-			for _, chunk := range pendingAudioChunks {
+		bufferedDuration, bufferedSince := pendingAudio.Duration()
+		if bufferedChunks := pendingAudio.Take(); len(bufferedChunks) > 0 {
+			sessionLogger.Info("Sending buffered audio chunks after stream recreation",
+				"chunks", len(bufferedChunks),
+				"bufferedMs", bufferedDuration.Milliseconds(),
+				"bufferedSince", bufferedSince)
+			for _, chunk := range bufferedChunks {
 				if err := newStream.Send(&speechpb.StreamingRecognizeRequest{
 					StreamingRequest: &speechpb.StreamingRecognizeRequest_AudioContent{
 						AudioContent: chunk,
 					},
 				}); err != nil {
-					logger.Error("Failed to send buffered audio chunk", "error", err)
+					sessionLogger.Error("Failed to send buffered audio chunk", "error", err)
 					break
 				}
 			}
-			// Clear the buffer after sending
-			pendingAudioChunks = nil
 		}
 
-		logger.Info("Speech-to-Text stream created/recreated")
+		sessionLogger.Info("Speech-to-Text stream created/recreated")
 
 		// Notify client about stream recreation
 		statusResponse := StatusResponse{
 			Type:      "status",
 			Status:    "stream_recreated",
 			Message:   "Speech recognition stream was recreated for optimal performance",
-			Timestamp: time.Now(),
+			Timestamp: session.Timestamp(time.Now()),
 		}
 		statusData, _ := json.Marshal(statusResponse)
 		// Send status update in a goroutine to avoid blocking
 		go func() {
 			mu.Lock()
-			conn.WriteMessage(websocket.TextMessage, statusData)
+			writeText(statusData)
 			mu.Unlock()
 		}()
 
 		return nil
 	}
 
-	// Create initial stream
-	if err := createStream(nil); err != nil {
-		logger.Error("Failed to create initial stream", "error", err)
-		return
+	// sendJSON marshals a response and writes it to the client, serializing writes on the connection
+	sendJSON := func(v interface{}) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("failed to marshal response: %v", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return writeText(data)
+	}
+
+	// Allow REST endpoints to push messages to this session's client
+	session.setSender(sendJSON)
+
+	// A session is inactive for the silence ending its last audio chunk plus the time since that chunk arrived,
+	// so clients of every encoding are warned and disconnected once they stop sending audio, and LINEAR16
+	// clients also when their audio carries no speech. Any text message from the client restarts the count.
+	var inactivityMu sync.Mutex
+	var silenceBeforeLastAudio time.Duration
+	lastAudioAt := time.Now()
+	inactivityWarned, silenceTimedOut := false, false
+	// audioReceived restarts the wall clock part of the inactivity count, keeping the silence heard so far
+	audioReceived := func() {
+		inactivityMu.Lock()
+		defer inactivityMu.Unlock()
+		lastAudioAt = time.Now()
+	}
+	// silenceHeard sets the silence ending the last audio chunk, 0 restarting the inactivity count
+	silenceHeard := func(silence time.Duration) {
+		inactivityMu.Lock()
+		defer inactivityMu.Unlock()
+		silenceBeforeLastAudio, lastAudioAt = silence, time.Now()
+	}
+	// checkInactivity warns the client inactivityWarning before the silence timeout and closes the session once
+	// it is reached, reporting whether the session is closed
+	inactivityUnit := silenceTimeoutUnit // Read once, as the check runs in its own goroutine
+	checkInactivity := func() bool {
+		if silenceTimeout <= 0 {
+			return false
+		}
+		inactivityMu.Lock()
+		inactive := silenceBeforeLastAudio + time.Since(lastAudioAt)
+		closedBefore := silenceTimedOut
+		warn, timedOut := false, false
+		switch {
+		case silenceTimedOut:
+		case inactive >= silenceTimeout:
+			silenceTimedOut, timedOut = true, true
+		case inactive < silenceTimeout-inactivityWarning:
+			inactivityWarned = false
+		case !inactivityWarned:
+			inactivityWarned, warn = true, true
+		}
+		inactivityMu.Unlock()
+
+		switch {
+		case warn:
+			secondsLeft := int((silenceTimeout - inactive).Round(inactivityUnit) / inactivityUnit)
+			sessionLogger.Info("Session inactive, warning before silence timeout", "secondsTillTimeout", secondsLeft)
+			if err := sendJSON(StatusResponse{
+				Type:               "status",
+				Status:             "inactivity_warning",
+				Message:            fmt.Sprintf("Session ends in %ds without speech; send any message to keep it open", secondsLeft),
+				Timestamp:          session.Timestamp(time.Now()),
+				SecondsTillTimeout: secondsLeft,
+			}); err != nil {
+				sessionLogger.Error("Failed to send inactivity warning", "error", err)
+			}
+		case timedOut:
+			sessionLogger.Info("Silence timeout reached, closing session", "silenceTimeout", silenceTimeout)
+			session.recordEvent("silence_timeout", map[string]interface{}{"silenceTimeoutSeconds": silenceTimeout.Seconds()})
+			if err := sendJSON(StatusResponse{
+				Type:      "status",
+				Status:    "silence_timeout",
+				Message:   fmt.Sprintf("Session ended after %s without speech", silenceTimeout),
+				Timestamp: session.Timestamp(time.Now()),
+			}); err != nil {
+				sessionLogger.Error("Failed to send silence timeout status", "error", err)
+			}
+			mu.Lock()
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "silence timeout"))
+			mu.Unlock()
+			cancel()
+			// Unblock the read loop if the client does not answer the close frame
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		}
+		return closedBefore || timedOut
+	}
+	if silenceTimeout > 0 {
+		go func() {
+			// Clients that stop sending audio have no chunk left to trigger the check
+			ticker := time.NewTicker(inactivityUnit / 4)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					if checkInactivity() {
+						return
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	// With ENABLE_STREAMING_SUMMARY, running and final summaries are sent as summary_chunk messages while
+	// Gemini generates them; JSON summaries are only usable once complete, so they are never streamed
+	streamSummaries := os.Getenv("ENABLE_STREAMING_SUMMARY") == "true" && summaryFormat != summaryFormatJSON
+	// Summaries switch to the fallback model while the session's model is out of quota
+	fallbackReset := time.Duration(getEnvInt64("GEMINI_FALLBACK_RESET_MINUTES", 5)) * time.Minute
+	summaryOptions.Fallback = newModelFallback(fallbackModel, fallbackReset, func(requested, actual string) {
+		session.incrementModelFallbacks()
+		session.recordEvent("model_fallback", map[string]interface{}{"requestedModel": requested, "actualModel": actual})
+		if err := sendJSON(StatusResponse{
+			Type:           "status",
+			Status:         "model_fallback",
+			Message:        fmt.Sprintf("Gemini quota exceeded for %s, using %s", requested, actual),
+			Timestamp:      session.Timestamp(time.Now()),
+			RequestedModel: requested,
+			ActualModel:    actual,
+			Reason:         "quota_exceeded",
+		}); err != nil {
+			sessionLogger.Error("Failed to send model fallback status", "error", err)
+		}
+	})
+	// Summaries are numbered so clients can tell apart the chunks of summaries streamed concurrently
+	var summarySequence atomic.Int64
+	streamingSummaryOptions := func(summaryID int64) SummaryOptions {
+		options := summaryOptions
+		if streamSummaries {
+			options.OnChunk = func(text string) {
+				if err := sendJSON(SummaryChunkResponse{Type: "summary_chunk", SummaryID: summaryID, Text: text, Timestamp: session.Timestamp(time.Now())}); err != nil {
+					sessionLogger.Debug("Failed to send summary chunk to client", "error", err)
+				}
+			}
+			options.OnReset = func() {
+				if err := sendJSON(SummaryChunkResponse{Type: "summary_chunk", SummaryID: summaryID, Reset: true, Timestamp: session.Timestamp(time.Now())}); err != nil {
+					sessionLogger.Debug("Failed to send summary reset to client", "error", err)
+				}
+			}
+		}
+		return options
+	}
+	// finishSummaryStream sends the complete summary as the final chunk of a streamed summary
+	finishSummaryStream := func(summaryID int64, summary string) {
+		if !streamSummaries {
+			return
+		}
+		if err := sendJSON(SummaryChunkResponse{Type: "summary_chunk", SummaryID: summaryID, Text: summary, Final: true, Timestamp: session.Timestamp(time.Now())}); err != nil {
+			sessionLogger.Debug("Failed to send final summary chunk to client", "error", err)
+		}
+	}
+
+	// Let the client know its session identifier for use with the sessions API
+	if err := sendJSON(StatusResponse{
+		Type:      "status",
+		Status:    "session_started",
+		Message:   "Transcription session started",
+		Timestamp: session.Timestamp(time.Now()),
+		SessionID: session.ID,
+	}); err != nil {
+		sessionLogger.Error("Failed to send session started status", "error", err)
+	}
+
+	// Forgotten sessions would otherwise consume Speech-to-Text quota indefinitely
+	if maxDuration := effectiveMaxSessionDuration(config.MaxSessionDurationMinutes, getEnvInt64("MAX_SESSION_DURATION_MINUTES", 0)); maxDuration > 0 {
+		maxDurationTimer := time.AfterFunc(maxDuration, func() {
+			sessionLogger.Info("Maximum session duration reached, closing session", "maxDuration", maxDuration)
+			session.recordEvent("session_max_duration_reached", map[string]interface{}{"maxDurationMinutes": maxDuration.Minutes()})
+			if err := sendJSON(StatusResponse{
+				Type:      "status",
+				Status:    "session_max_duration_reached",
+				Message:   fmt.Sprintf("Session ended after the maximum duration of %s", maxDuration),
+				Timestamp: session.Timestamp(time.Now()),
+			}); err != nil {
+				sessionLogger.Error("Failed to send max duration status", "error", err)
+			}
+			mu.Lock()
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "maximum session duration reached"))
+			mu.Unlock()
+			cancel()
+			// Unblock the read loop if the client does not answer the close frame
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		})
+		defer maxDurationTimer.Stop()
+	}
+
+	// Audio is held until the client acknowledges the recording consent notice
+	consentPending := config.ConsentRequired
+	if consentPending {
+		if err := sendJSON(ConsentNoticeResponse{
+			Type:                    "consent_notice",
+			Message:                 "This session is being transcribed. All participants must be informed before recording starts.",
+			RequiresAcknowledgement: true,
+		}); err != nil {
+			sessionLogger.Error("Failed to send consent notice", "error", err)
+		}
+		session.recordEvent("consent_requested", nil)
+	}
+
+	// Create initial stream (language tracks are created separately in multi-language mode)
+	if !config.MultiLanguageMode {
+		if err := createStream(nil); err != nil {
+			sessionLogger.Error("Failed to create initial stream", "error", err)
+			return
+		}
 	}
 
-	var fullTranscription strings.Builder
-	var newTranscripts strings.Builder // Track new transcripts since last summary
-	var currentSummary string
-	var summaryMu sync.Mutex // Protect currentSummary from race conditions
 	customWords := config.CustomWords // Store custom words for use in summary generation
 
 	// Default prompt for summarization
@@ -415,153 +1096,1017 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 
 If this is an update to an existing summary, maintain the structure and content of the previous summary unless corrections are needed. Use the FULL TRANSCRIPT as context, but focus your updates on incorporating the NEW TRANSCRIPT content.`
 
+	// Optionally restrict the new transcript passed to the summary to a rolling window
+	summaryWindow := time.Duration(getEnvInt64("SUMMARY_WINDOW_SECONDS", 0)) * time.Second
+	if summaryWindow > 0 {
+		sessionLogger.Info("Summary window enabled", "window", summaryWindow)
+	}
+
+	// Limit the number of summaries generated concurrently for this session
+	summarySemaphore := newSummarySemaphore()
+
 	// Get summarization prompt from config, or use default
 	summaryPrompt := config.SummaryPrompt
 	if summaryPrompt == "" {
 		summaryPrompt = defaultSummaryPrompt
 	}
 
-	// Goroutine to receive messages from Speech-to-Text and send to client
-	go func() {
-		for {
-			var currentStream speechpb.Speech_StreamingRecognizeClient
+	// Validate the confidence threshold used to filter final results
+	minConfidence := config.MinConfidenceThreshold
+	if minConfidence < 0 || minConfidence > 1 {
+		sessionLogger.Warn("Invalid minimum confidence threshold, filtering disabled",
+			"minConfidenceThreshold", minConfidence)
+		minConfidence = 0
+	}
 
-			// Get current stream reference safely
-			streamMu.Lock()
-			currentStream = stream
-			streamMu.Unlock()
+	// Retry summaries that could not be written to the client before falling back to disk
+	summaryRetries := newSummaryRetrier(session, sendJSON,
+		time.Duration(getEnvInt64("SUMMARY_RETRY_DELAY_MS", 2000))*time.Millisecond,
+		int(getEnvInt64("SUMMARY_MAX_RETRIES", 3)),
+		sessionLogger)
+	go summaryRetries.Run(ctx)
+
+	// Stop generating summaries once the session's GenAI token budget is spent
+	genAIBudget := effectiveTokenBudget(config.MaxGenAITokensBudget, getEnvInt64("MAX_GENAI_TOKENS_PER_SESSION", 0))
+
+	// chargeGenAITokens adds a summary's token usage to the session total and returns the summary text,
+	// with a footer and a client notification when this summary exhausts the budget
+	chargeGenAITokens := func(result SummaryResult) string {
+		used, exhausted := session.chargeGenAITokens(int64(result.TotalTokens()), genAIBudget)
+		if !exhausted {
+			return result.Text
+		}
 
-			if currentStream == nil {
-				time.Sleep(100 * time.Millisecond)
-				continue
-			}
+		sessionLogger.Warn("GenAI token budget exhausted, stopping summary generation",
+			"tokensUsed", used,
+			"budget", genAIBudget)
+		session.recordEvent("genai_budget_exhausted", map[string]interface{}{"tokensUsed": used, "budget": genAIBudget})
+		if err := sendJSON(StatusResponse{
+			Type:       "status",
+			Status:     "genai_budget_exhausted",
+			Message:    "Summary generation stopped because the token budget was exceeded",
+			Timestamp:  session.Timestamp(time.Now()),
+			TokensUsed: used,
+			Budget:     genAIBudget,
+		}); err != nil {
+			sessionLogger.Error("Failed to send budget exhausted status", "error", err)
+		}
+		if summaryFormat == summaryFormatJSON {
+			return result.Text // A Markdown footer would break the JSON; the status message tells the client
+		}
+		return result.Text + "\n\n---\n*NOTE: Summary generation stopped due to token budget*"
+	}
 
-			resp, err := currentStream.Recv()
-			if err == io.EOF {
-				// Stream closed, try to recreate
-				logger.Debug("Speech-to-Text stream closed, recreating...")
-				if recreateErr := createStream(nil); recreateErr != nil {
-					// Check if the error is due to connection closing
-					if ctx.Err() != nil {
-						logger.Info("Context cancelled during stream recreation, stopping receive loop")
-						return
-					}
-					logger.Error("Failed to recreate stream", "error", recreateErr)
-					return
-				}
-				// After recreation, continue to get new stream reference
-				continue
-			}
-			if err != nil {
-				// Check if this is a context cancellation error first
-				if ctx.Err() != nil {
-					logger.Debug("Context cancelled, stopping receive loop", "error", err)
-					return
-				}
-				logger.Error("Error receiving from Speech-to-Text", "error", err)
-				// Try to recreate stream on error
-				if recreateErr := createStream(nil); recreateErr != nil {
-					// Check if the error is due to connection closing
-					if ctx.Err() != nil {
-						logger.Info("Context cancelled during stream recreation, stopping receive loop")
-						return
-					}
-					logger.Error("Failed to recreate stream after error", "error", recreateErr)
-					return
-				}
-				// After recreation, continue to get new stream reference
-				continue
-			}
+	// Periodically suggest new keywords to boost based on the transcript
+	keywordSuggestionsEnabled := os.Getenv("ENABLE_KEYWORD_SUGGESTIONS") == "true" && projectID != "" && location != ""
 
-			if err := resp.Error; err != nil {
-				logger.Error("Speech-to-Text API error", "error", err)
+	// Optionally summarize interim text every N words so slow speakers do not stall the summary
+	partialSummaries := &partialSummaryTrigger{interval: int(getEnvInt64("PARTIAL_SUMMARY_WORD_INTERVAL", 0))}
+
+	// Short final results ("Yeah", "OK") are transcribed but wait for a longer one before triggering a summary
+	summaryGate := newSummarySegmentGate(config.MinSummarySegmentWords)
+
+	// A pause longer than EndOfSpeechSilenceMs after a final result marks a segment boundary for the summary
+	endOfSpeechSilence := time.Duration(config.EndOfSpeechSilenceMs) * time.Millisecond
+	segmentBoundaries := &segmentBoundaryTracker{silence: endOfSpeechSilence}
+
+	// generatePartialSummary summarizes the final transcript plus the current interim text without recording it
+	generatePartialSummary := func(interimText string) {
+		if session.GenAIBudgetExhausted() {
+			return
+		}
+		release, ok := tryAcquireSlot(summarySemaphore)
+		if !ok {
+			sessionLogger.Debug("Partial summary skipped, too many summaries in progress")
+			return
+		}
+		go func() {
+			defer release()
+
+			fullTranscript := session.Transcript() + " " + interimText
+			newTranscript := session.NewTranscript() + " " + interimText
+			result, err := generateSummary(ctx, projectID, location, geminiModel, fullTranscript, newTranscript, session.Summary(), summaryPrompt, customWords, session.Chapters(), summaryOptions)
+			if err != nil {
+				sessionLogger.Error("Error generating partial summary", "error", err)
+				return
+			}
+			if result.Text == "" {
+				return
+			}
+			summary := chargeGenAITokens(result)
+			cloudAudit("summary.generate", map[string]interface{}{"kind": "partial", "tokens": result.TotalTokens()})
+
+			sessionLogger.Debug("Partial summary generated", "summaryLength", len(summary))
+			summaryResponse := SummaryResponse{
+				Type:                      "summary",
+				Text:                      summary,
+				Timestamp:                 session.Timestamp(time.Now()),
+				Partial:                   true,
+				SummaryLanguage:           summaryLanguage,
+				JSON:                      summaryFormat == summaryFormatJSON,
+				SummaryGenerationStrategy: result.Strategy,
+				FocusTopics:               summaryOptions.FocusTopics,
+			}
+			if err := sendJSON(summaryResponse); err != nil {
+				sessionLogger.Error("Failed to send partial summary to client", "error", err)
+			}
+		}()
+	}
+
+	// punctuateSegmentWithGemini re-punctuates a final result with Gemini after it was sent with rule-based punctuation,
+	// so the receive loop never waits on Gemini. unpunctuated is the text before punctuation and stored the segment text
+	// it replaces; the segment is left alone when Gemini fails or the segment changed in the meantime.
+	punctuateSegmentWithGemini := func(segmentIndex int, unpunctuated, stored, languageCode string) {
+		if session.GenAIBudgetExhausted() {
+			return
+		}
+		punctuateCtx, cancel := context.WithTimeout(ctx, punctuationTimeout)
+		result, err := punctuateWithGemini(punctuateCtx, projectID, location, punctuationModel, unpunctuated)
+		cancel()
+		if err != nil {
+			if ctx.Err() == nil {
+				sessionLogger.Warn("Gemini punctuation failed, keeping rule-based punctuation", "segmentIndex", segmentIndex, "error", err)
+			}
+			return
+		}
+		punctuated := chargeGenAITokens(result)
+		newText := hookRegistry.Run(ctx, HookEvent{
+			Type:         HookPostFinal,
+			SessionID:    session.ID,
+			Text:         punctuated,
+			LanguageCode: languageCode,
+			IsFinal:      true,
+		}).Text
+		if len(redactionPatterns) > 0 {
+			newText = redactPII(newText, redactionPatterns)
+		}
+		if newText == stored {
+			return
+		}
+
+		segment, ok := session.punctuateSegment(segmentIndex, stored, newText)
+		if !ok {
+			return
+		}
+		if err := appendTranscriptRecord(session.ID, TranscriptRecord{Type: "punctuated", Timestamp: time.Now(), Segment: &segment}); err != nil {
+			sessionLogger.Error("Failed to persist punctuated segment", "error", err)
+		}
+		// The client already has the raw text, so it gets the punctuated text before redaction
+		if err := sendJSON(PunctuationResult{
+			Type:         "punctuation_result",
+			OriginalText: stored,
+			NewText:      punctuated,
+			SegmentIndex: segmentIndex,
+		}); err != nil {
+			sessionLogger.Error("Failed to send punctuation result to client", "error", err)
+		}
+	}
+
+	// Final results are cleaned up before punctuation; capitalization fixes restore the casing of custom words
+	normalization := config.Normalization
+	if normalization != nil {
+		normalization.properNouns = config.CustomWords
+	}
+
+	// currentLanguages returns the primary and alternative languages, which the receive loop swaps under streamMu
+	currentLanguages := func() (string, []string) {
+		streamMu.Lock()
+		defer streamMu.Unlock()
+		return primaryLanguage, alternativeLanguages
+	}
+
+	// batchRecognitionConfig configures the synchronous Recognize RPC like the session's streams
+	batchRecognitionConfig := func() *speechpb.RecognitionConfig {
+		language, alternatives := currentLanguages()
+		return &speechpb.RecognitionConfig{
+			Encoding:                            encoding,
+			SampleRateHertz:                     sampleRateHertz.Load(),
+			LanguageCode:                        language,
+			AlternativeLanguageCodes:            alternatives,
+			EnableWordTimeOffsets:               true,
+			Model:                               config.Model,
+			UseEnhanced:                         config.UseEnhanced,
+			SpeechContexts:                      speechContexts,
+			AudioChannelCount:                   recognitionConfig.AudioChannelCount,
+			EnableSeparateRecognitionPerChannel: recognitionConfig.EnableSeparateRecognitionPerChannel,
+			Metadata:                            recognitionMetadata,
+		}
+	}
+
+	// reprocessWithBatch re-transcribes a short session's audio with Recognize and replaces the streamed segments
+	// that started before audioEnd; finals received for later audio are kept. The streamed transcript is kept
+	// when recognition fails or returns nothing, or when BATCH_MAX_CONCURRENT re-transcriptions are already
+	// running. It runs detached from ctx, which is cancelled at teardown.
+	reprocessWithBatch := func(audio []byte, audioStart, audioEnd time.Time) {
+		if len(audio) == 0 {
+			return
+		}
+		release, ok := tryAcquireSlot(batchSlots)
+		if !ok {
+			sessionLogger.Warn("Too many batch re-transcriptions in progress, keeping streamed transcript")
+			return
+		}
+		defer release()
+
+		batchCtx, batchCancel := context.WithTimeout(context.WithoutCancel(ctx), 20*time.Second)
+		defer batchCancel()
+		resp, err := client.Recognize(batchCtx, &speechpb.RecognizeRequest{
+			Config: batchRecognitionConfig(),
+			Audio: &speechpb.RecognitionAudio{
+				AudioSource: &speechpb.RecognitionAudio_Content{Content: audio},
+			},
+		})
+		if err != nil {
+			sessionLogger.Warn("Batch re-transcription failed, keeping streamed transcript", "error", err)
+			return
+		}
+
+		var segments []TranscriptionSegment
+		for _, result := range resp.Results {
+			if len(result.Alternatives) == 0 || strings.TrimSpace(result.Alternatives[0].Transcript) == "" {
 				continue
 			}
+			segment := newTranscriptionSegment(result.Alternatives[0], result.LanguageCode, session.CreatedAt, audioStart.Sub(session.CreatedAt))
+			segment.Text = hookRegistry.Run(batchCtx, HookEvent{
+				Type:         HookPostFinal,
+				SessionID:    session.ID,
+				Text:         segment.Text,
+				LanguageCode: result.LanguageCode,
+				IsFinal:      true,
+			}).Text
+			if len(redactionPatterns) > 0 {
+				segment = redactSegment(segment, redactionPatterns)
+			}
+			segments = append(segments, segment)
+		}
+		if len(segments) == 0 {
+			sessionLogger.Info("Batch re-transcription returned no results, keeping streamed transcript")
+			return
+		}
 
-			for _, result := range resp.Results {
-				if len(result.Alternatives) > 0 {
-					transcriptionText := result.Alternatives[0].Transcript
-					logger.Debug("Transcription received",
-						"text", transcriptionText,
-						"isFinal", result.IsFinal)
+		batchSegments := len(segments)
+		segments = session.replaceSegments(audioEnd, segments)
+		// The marker drops every persisted segment, so the kept ones are written again with their new indexes
+		if err := appendTranscriptRecord(session.ID, TranscriptRecord{Type: "batch_reprocessed", Timestamp: time.Now()}); err != nil {
+			sessionLogger.Error("Failed to persist batch re-transcription marker", "error", err)
+		}
+		for _, segment := range segments {
+			if err := appendTranscriptRecord(session.ID, newSegmentRecord(segment)); err != nil {
+				sessionLogger.Error("Failed to persist transcript segment", "error", err)
+			}
+		}
+		sessionLogger.Info("Short session re-transcribed with batch recognition",
+			"audioBytes", len(audio),
+			"segments", batchSegments,
+			"keptSegments", len(segments)-batchSegments)
+		session.recordEvent("reprocessed_with_batch", map[string]interface{}{"audioBytes": len(audio), "segments": batchSegments})
+		// The client may already have closed the connection
+		if err := sendJSON(StatusResponse{
+			Type:      "status",
+			Status:    "reprocessed_with_batch",
+			Message:   "Transcript replaced with a batch re-transcription of the session audio",
+			Timestamp: session.Timestamp(time.Now()),
+			Count:     int64(batchSegments),
+		}); err != nil {
+			sessionLogger.Debug("Batch re-transcription status not delivered to client", "error", err)
+		}
+	}
+
+	// retranscribeRange transcribes again with Recognize the segment overlapping [startMs, endMs] the most
+	// and replaces its text. The audio of the whole segment is recognized, not just the requested range,
+	// so the new text covers exactly what it replaces.
+	retranscribeRange := func(msg RetranscribeMessage) {
+		fail := func(text string) {
+			if err := sendJSON(StatusResponse{Type: "status", Status: "retranscription_error", Message: text, Timestamp: session.Timestamp(time.Now())}); err != nil {
+				sessionLogger.Error("Failed to send retranscription error to client", "error", err)
+			}
+		}
+
+		segmentIndex, ok := session.Segments().MostOverlapping(session.CreatedAt, msg.StartMs, msg.EndMs)
+		if !ok {
+			fail("No transcript segment in the requested range")
+			return
+		}
+		segment, ok := session.Segments().At(segmentIndex)
+		if !ok {
+			fail("Segment no longer exists")
+			return
+		}
+		if !segment.EndTime.After(segment.StartTime) {
+			fail("Segment has no word timings to locate its audio")
+			return
+		}
+		if segment.EndTime.Sub(segment.StartTime) > maxRetranscriptionRange {
+			fail(fmt.Sprintf("Segment is longer than the %s re-transcription limit", maxRetranscriptionRange))
+			return
+		}
+		audio, complete := retainedAudio.Range(segment.StartTime, segment.EndTime)
+		if !complete {
+			fail("Audio of the segment is no longer retained")
+			return
+		}
+		if len(audio) == 0 {
+			fail("No audio retained for the segment")
+			return
+		}
+
+		recognizeCtx, recognizeCancel := context.WithTimeout(ctx, 20*time.Second)
+		defer recognizeCancel()
+		resp, err := client.Recognize(recognizeCtx, &speechpb.RecognizeRequest{
+			Config: batchRecognitionConfig(),
+			Audio:  &speechpb.RecognitionAudio{AudioSource: &speechpb.RecognitionAudio_Content{Content: audio}},
+		})
+		if err != nil {
+			sessionLogger.Warn("Re-transcription failed", "segmentIndex", segmentIndex, "error", err)
+			fail("Re-transcription failed")
+			return
+		}
+		var texts []string
+		for _, result := range resp.Results {
+			if len(result.Alternatives) > 0 {
+				texts = append(texts, strings.TrimSpace(result.Alternatives[0].Transcript))
+			}
+		}
+		newText := strings.TrimSpace(strings.Join(texts, " "))
+		if newText == "" {
+			fail("Re-transcription returned no text")
+			return
+		}
+		language, _ := currentLanguages()
+		newText = hookRegistry.Run(ctx, HookEvent{
+			Type:         HookPostFinal,
+			SessionID:    session.ID,
+			Text:         newText,
+			LanguageCode: language,
+			IsFinal:      true,
+		}).Text
+		if len(redactionPatterns) > 0 {
+			newText = redactPII(newText, redactionPatterns)
+		}
+
+		originalText, segment, ok := session.retranscribeSegment(segmentIndex, newText)
+		if !ok {
+			fail("Segment no longer exists")
+			return
+		}
+		if err := appendTranscriptRecord(session.ID, TranscriptRecord{Type: "retranscribed", Timestamp: time.Now(), Segment: &segment}); err != nil {
+			sessionLogger.Error("Failed to persist re-transcribed segment", "error", err)
+		}
+		session.recordEvent("retranscribed", map[string]interface{}{
+			"segmentIndex": segmentIndex,
+			"originalText": originalText,
+			"newText":      newText,
+		})
+		sessionLogger.Info("Segment re-transcribed",
+			"segmentIndex", segmentIndex,
+			"audioBytes", len(audio))
+		if err := sendJSON(RetranscriptionResult{
+			Type:         "retranscription_result",
+			OriginalText: originalText,
+			NewText:      newText,
+			SegmentIndex: segmentIndex,
+		}); err != nil {
+			sessionLogger.Error("Failed to send retranscription result to client", "error", err)
+		}
+	}
 
-					response := TranscriptionResponse{
-						Type:      "transcription",
-						Text:      transcriptionText,
-						Timestamp: time.Now(),
-						Final:     result.IsFinal,
+	// processResult sends a recognition result to the client and, for final results, updates the transcript and summary.
+	// Word timings are relative to streamStart, or to the current stream when it is zero.
+	processResult := func(alternative *speechpb.SpeechRecognitionAlternative, isFinal bool, languageCode string, channelTag int32, streamStart time.Time) error {
+		transcriptionText := alternative.Transcript
+		filtered := isFinal && belowConfidenceThreshold(alternative.Confidence, minConfidence)
+		sessionLogger.Debug("Transcription received",
+			"text", transcriptionText,
+			"isFinal", isFinal,
+			"languageCode", languageCode)
+
+		segmentBoundaries.observe(time.Now(), isFinal)
+
+		// Short interim results are noise in the UI; the final result is always sent
+		if !isFinal && config.MinInterimWords > 0 && countWords(transcriptionText) < config.MinInterimWords {
+			return nil
+		}
+		transcriptionText = hookRegistry.Run(ctx, HookEvent{
+			Type:         HookPreSend,
+			SessionID:    session.ID,
+			Text:         transcriptionText,
+			LanguageCode: languageCode,
+			IsFinal:      isFinal,
+		}).Text
+		if isFinal && normalization != nil {
+			transcriptionText = normalizeTranscript(transcriptionText, *normalization)
+		}
+		// Finals are sent with rule-based punctuation right away; Gemini punctuation, when configured, replaces it later
+		unpunctuatedText := transcriptionText
+		if isFinal && autoPunctuateEnabled {
+			transcriptionText = autoPunctuate(transcriptionText)
+		}
+
+		response := TranscriptionResponse{
+			Type:             "transcription",
+			Text:             transcriptionText,
+			Timestamp:        session.Timestamp(time.Now()),
+			Final:            isFinal,
+			DetectedLanguage: languageCode,
+			Filtered:         filtered,
+			ChannelTag:       int(channelTag),
+		}
+		if config.AutoDetectLanguage && languageCode != "" {
+			// The v1 API reports the detected language but not a language confidence
+			response.LanguageDetection = &LanguageDetectionResult{DetectedLanguage: languageCode}
+		}
+
+		responseData, err := json.Marshal(response)
+		if err != nil {
+			sessionLogger.Error("Failed to marshal transcription response", "error", err)
+			return nil
+		}
+
+		mu.Lock()
+		if err := writeText(responseData); err != nil {
+			sessionLogger.Error("Failed to send transcription to client", "error", err)
+			mu.Unlock()
+			return err
+		}
+		mu.Unlock()
+
+		if filtered {
+			sessionLogger.Debug("Final result filtered for low confidence",
+				"text", transcriptionText,
+				"confidence", alternative.Confidence,
+				"threshold", minConfidence)
+			return nil
+		}
+
+		if !isFinal && projectID != "" && location != "" && partialSummaries.interim(transcriptionText) {
+			generatePartialSummary(redactPII(transcriptionText, redactionPatterns))
+		}
+
+		if isFinal {
+			partialSummaries.final()
+			finalText := hookRegistry.Run(ctx, HookEvent{
+				Type:         HookPostFinal,
+				SessionID:    session.ID,
+				Text:         transcriptionText,
+				LanguageCode: languageCode,
+				IsFinal:      true,
+			}).Text
+
+			if segmentBoundaries.take() && session.markSegmentBoundary() {
+				sessionLogger.Debug("Segment boundary marked after silence", "endOfSpeechSilence", endOfSpeechSilence)
+			}
+			// The client already has the raw text; only the redacted text is stored and summarized
+			session.appendTranscript(redactPII(finalText, redactionPatterns)) // Also tracked as new content since the last summary
+
+			// Record the segment with word timings relative to the session start
+			if streamStart.IsZero() {
+				streamMu.Lock()
+				streamStart = streamStartTime
+				streamMu.Unlock()
+			}
+			streamOffset := streamStart.Sub(session.CreatedAt)
+			segment := newTranscriptionSegment(alternative, languageCode, session.CreatedAt, streamOffset)
+			segment.Text = finalText
+			if len(redactionPatterns) > 0 {
+				segment = redactSegment(segment, redactionPatterns)
+			}
+			segment = session.addSegment(segment)
+			if err := appendTranscriptRecord(session.ID, newSegmentRecord(segment)); err != nil {
+				sessionLogger.Error("Failed to persist transcript segment", "error", err)
+			}
+			if autoPunctuateEnabled && punctuationModel != "" {
+				go punctuateSegmentWithGemini(segment.Index, unpunctuatedText, segment.Text, languageCode)
+			}
+			if keywordSuggestionsEnabled && (segment.Index+1)%keywordSuggestionInterval == 0 {
+				go func() {
+					words, err := suggestKeywords(ctx, projectID, location, geminiModel, session.Transcript(), sessionState.Keywords())
+					if err != nil {
+						sessionLogger.Error("Error suggesting keywords", "error", err)
+						return
+					}
+					if len(words) == 0 {
+						return
+					}
+					sessionLogger.Debug("Keywords suggested", "words", words)
+					if err := sendJSON(KeywordSuggestionResponse{Type: "keyword_suggestions", Words: words}); err != nil {
+						sessionLogger.Error("Failed to send keyword suggestions", "error", err)
+					}
+				}()
+			}
+			// Short results stay in the new transcript and are summarized with the next qualifying result
+			triggered, deferredWords := summaryGate.final(finalText)
+			if !triggered {
+				sessionLogger.Debug("Summary deferred for short final result",
+					"words", countWords(finalText),
+					"minSummarySegmentWords", summaryGate.minWords)
+				return nil
+			}
+			if deferredWords > 0 {
+				sessionLogger.Debug("Summarizing deferred short results", "deferredWords", deferredWords)
+			}
+
+			// Generate summary asynchronously to avoid blocking transcript processing
+			if projectID != "" && location != "" && !session.GenAIBudgetExhausted() {
+				// Skip this summary if too many are already in flight for the session
+				release, ok := tryAcquireSlot(summarySemaphore)
+				if !ok {
+					sessionLogger.Debug("Summary generation skipped, too many summaries in progress",
+						"maxConcurrentSummaries", cap(summarySemaphore))
+					if err := sendJSON(StatusResponse{
+						Type:      "status",
+						Status:    "summary_skipped_busy",
+						Message:   "Summary generation skipped because previous summaries are still in progress",
+						Timestamp: session.Timestamp(time.Now()),
+					}); err != nil {
+						sessionLogger.Error("Failed to send summary skipped status", "error", err)
 					}
+					return nil
+				}
+				go func() {
+					defer release()
+
+					fullTranscript := session.Transcript()
+					newTranscript := session.NewTranscript()
+					if summaryWindow > 0 {
+						newTranscript = session.Segments().WindowedTranscript(time.Now().Add(-summaryWindow))
+					}
+					newTranscript = withDeferredWords(newTranscript, deferredWords)
+
+					previousSummary := session.Summary()
 
-					responseData, err := json.Marshal(response)
+					sessionLogger.Debug("Generating summary",
+						"transcriptLength", len(fullTranscript),
+						"newTranscriptLength", len(newTranscript),
+						"previousSummaryLength", len(previousSummary))
+					summaryID := summarySequence.Add(1)
+					result, err := generateSummary(ctx, projectID, location, geminiModel, fullTranscript, newTranscript, previousSummary, summaryPrompt, customWords, session.Chapters(), streamingSummaryOptions(summaryID))
 					if err != nil {
-						logger.Error("Failed to marshal transcription response", "error", err)
+						sessionLogger.Error("Error generating summary", "error", err)
+						session.recordEvent("summary_error", map[string]interface{}{"final": false, "error": err.Error()})
+						return
+					}
+					summary := chargeGenAITokens(result)
+					if summary != "" {
+						// Update current summary and clear new transcripts after successful summary generation
+						session.recordSummary(summary)
+						session.clearNewTranscript()
+
+						sessionLogger.Info("Summary generated", "summaryLength", len(summary))
+						cloudAudit("summary.generate", map[string]interface{}{"kind": "running", "tokens": result.TotalTokens()})
+						finishSummaryStream(summaryID, summary)
+						summaryResponse := SummaryResponse{
+							Type:                      "summary",
+							SummaryID:                 summaryID,
+							Text:                      summary,
+							Timestamp:                 session.Timestamp(time.Now()),
+							SummaryLanguage:           summaryLanguage,
+							JSON:                      summaryFormat == summaryFormatJSON,
+							SummaryGenerationStrategy: result.Strategy,
+							FocusTopics:               summaryOptions.FocusTopics,
+						}
+						summaryData, err := json.Marshal(summaryResponse)
+						if err != nil {
+							sessionLogger.Error("Failed to marshal summary response", "error", err)
+							return
+						}
+						// Summaries generate concurrently; one finishing after a newer summary was sent is stale
+						if session.summarySuperseded(summaryID) {
+							sessionLogger.Debug("Dropping summary superseded by a newer summary", "summaryID", summaryID)
+							return
+						}
+						mu.Lock()
+						if err := writeText(summaryData); err != nil {
+							sessionLogger.Error("Failed to send summary to client", "error", err)
+							summaryRetries.Queue(&summaryResponse, err)
+						} else {
+							session.markSummaryDelivered(summaryID)
+						}
+						mu.Unlock()
+					}
+				}()
+			}
+		}
+		return nil
+	}
+
+	// Recreate streams whose Recv produces nothing for too long while audio is being sent
+	recvTimeout := time.Duration(getEnvInt64("SPEECH_RECV_TIMEOUT_MS", 10000)) * time.Millisecond
+	var lastAudioSentAt atomic.Int64 // Unix nanoseconds of the last audio chunk forwarded to Speech-to-Text
+	lastAudioSentAt.Store(time.Now().UnixNano())
+	audioSentAt := func() time.Time { return time.Unix(0, lastAudioSentAt.Load()) }
+
+	// Swap to a detected alternative language after this many consecutive responses without results
+	noResultFallbackCount := int(getEnvInt64("NO_RESULT_FALLBACK_COUNT", 20))
+
+	// processStreamResult forwards a single-stream result, trimming words of a final that the stream on the other side
+	// of a recent switch already emitted. replaced marks results drained from a stream that has been replaced.
+	processStreamResult := func(result *speechpb.StreamingRecognitionResult, replaced bool, streamStart time.Time) error {
+		if len(result.Alternatives) == 0 {
+			return nil
+		}
+		alternative := result.Alternatives[0]
+		if result.IsFinal {
+			var leading, trailing int
+			if replaced {
+				trailing = streamOverlap.TrimReplaced(alternative.Transcript)
+			} else {
+				leading = streamOverlap.TrimCurrent(alternative.Transcript)
+			}
+			if leading+trailing > 0 {
+				sessionLogger.Debug("Trimmed words repeated across a stream switch",
+					"text", alternative.Transcript,
+					"leading", leading,
+					"trailing", trailing)
+				alternative = trimAlternativeWords(alternative, leading, trailing)
+				if alternative.Transcript == "" {
+					return nil
+				}
+			}
+		}
+		return processResult(alternative, result.IsFinal, result.LanguageCode, result.ChannelTag, streamStart)
+	}
+
+	// drainReplacedStream keeps receiving from a replaced stream until it ends, forwarding its finals:
+	// they cover audio sent before the switch that the new stream may not have received. resp and err are
+	// the result of the receive that found the stream replaced.
+	drainReplacedStream := func(replacedStream speechpb.Speech_StreamingRecognizeClient, streamStart time.Time, resp *speechpb.StreamingRecognizeResponse, err error) {
+		finals := 0
+		for err == nil && ctx.Err() == nil {
+			if resp.Error == nil {
+				for _, result := range resp.Results {
+					if !result.IsFinal {
 						continue
 					}
+					finals++
+					if err := processStreamResult(result, true, streamStart); err != nil {
+						return
+					}
+				}
+			}
+			resp, err = recvWithTimeout(replacedStream, recvTimeout, nil)
+		}
+		if err != io.EOF && ctx.Err() == nil {
+			sessionLogger.Debug("Replaced stream ended without EOF", "error", err)
+		}
+		sessionLogger.Debug("Replaced stream drained", "finals", finals)
+	}
 
-					mu.Lock()
-					if err := conn.WriteMessage(websocket.TextMessage, responseData); err != nil {
-						logger.Error("Failed to send transcription to client", "error", err)
-						mu.Unlock()
+	// receiveSingleStream receives messages from the Speech-to-Text stream and sends them to the client
+	receiveSingleStream := func() {
+		noResultWindow := 0
+		detectedAlternative := ""
+		for {
+			var currentStream speechpb.Speech_StreamingRecognizeClient
+
+			// Get current stream reference safely
+			streamMu.Lock()
+			currentStream = stream
+			currentStreamStart := streamStartTime
+			streamMu.Unlock()
+
+			if currentStream == nil {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+
+			resp, err := recvWithTimeout(currentStream, recvTimeout, audioSentAt)
+
+			// The stream may already have been replaced by a handover or a keyword update; its remaining finals
+			// are drained in the background while this loop moves on to the new stream
+			streamMu.Lock()
+			replaced := stream != currentStream
+			streamMu.Unlock()
+			if replaced {
+				go drainReplacedStream(currentStream, currentStreamStart, resp, err)
+				continue
+			}
+
+			if status.Code(err) == codes.DeadlineExceeded && ctx.Err() == nil {
+				sessionLogger.Warn("Speech-to-Text receive timed out, recreating stream",
+					"timeout", recvTimeout)
+				serverMetrics.RecvTimeoutCount.Add(1)
+				session.recordEvent("recv_timeout", map[string]interface{}{"timeoutMs": recvTimeout.Milliseconds()})
+				if recreateErr := createStream(nil); recreateErr != nil {
+					if ctx.Err() != nil {
+						sessionLogger.Info("Context cancelled during stream recreation, stopping receive loop")
 						return
 					}
-					mu.Unlock()
+					sessionLogger.Error("Failed to recreate stream after receive timeout", "error", recreateErr)
+					return
+				}
+				continue
+			}
+			if err == io.EOF {
+				// Stream closed, try to recreate
+				sessionLogger.Debug("Speech-to-Text stream closed, recreating...")
+				if recreateErr := createStream(nil); recreateErr != nil {
+					// Check if the error is due to connection closing
+					if ctx.Err() != nil {
+						sessionLogger.Info("Context cancelled during stream recreation, stopping receive loop")
+						return
+					}
+					sessionLogger.Error("Failed to recreate stream", "error", recreateErr)
+					return
+				}
+				// After recreation, continue to get new stream reference
+				continue
+			}
+			if err != nil {
+				// Check if this is a context cancellation error first
+				if ctx.Err() != nil {
+					sessionLogger.Debug("Context cancelled, stopping receive loop", "error", err)
+					return
+				}
+				sessionLogger.Error("Error receiving from Speech-to-Text", "error", err)
+				session.recordEvent("stream_error", map[string]interface{}{"error": err.Error()})
+				// Try to recreate stream on error
+				if recreateErr := createStream(nil); recreateErr != nil {
+					// Check if the error is due to connection closing
+					if ctx.Err() != nil {
+						sessionLogger.Info("Context cancelled during stream recreation, stopping receive loop")
+						return
+					}
+					sessionLogger.Error("Failed to recreate stream after error", "error", recreateErr)
+					return
+				}
+				// After recreation, continue to get new stream reference
+				continue
+			}
+
+			if err := resp.Error; err != nil {
+				sessionLogger.Error("Speech-to-Text API error", "error", err)
+				session.recordEvent("speech_api_error", map[string]interface{}{"code": err.GetCode(), "message": err.GetMessage()})
+				continue
+			}
+
+			// A wrong primary language tends to produce empty responses; fall back to a detected alternative
+			if len(resp.Results) == 0 {
+				noResultWindow++
+				if noResultFallbackCount > 0 && noResultWindow >= noResultFallbackCount && detectedAlternative != "" {
+					streamMu.Lock()
+					previousLanguage := primaryLanguage
+					primaryLanguage, alternativeLanguages = swapPrimaryLanguage(primaryLanguage, alternativeLanguages, detectedAlternative)
+					newLanguage := primaryLanguage
+					streamMu.Unlock()
+
+					sessionLogger.Warn("No results for primary language, swapping to detected alternative",
+						"previousLanguage", previousLanguage,
+						"newLanguage", detectedAlternative,
+						"emptyResponses", noResultWindow)
+					session.recordEvent("language_swapped", map[string]interface{}{"previousLanguage": previousLanguage, "newLanguage": detectedAlternative})
+					noResultWindow = 0
+					detectedAlternative = ""
+
+					if err := createStream(nil); err != nil {
+						if ctx.Err() != nil {
+							return
+						}
+						sessionLogger.Error("Failed to recreate stream after language swap", "error", err)
+						return
+					}
+					if err := sendJSON(StatusResponse{
+						Type:        "status",
+						Status:      "language_swapped",
+						Message:     "No results for the primary language, switched to a detected alternative language",
+						Timestamp:   session.Timestamp(time.Now()),
+						NewLanguage: newLanguage,
+					}); err != nil {
+						sessionLogger.Error("Failed to send language swapped status", "error", err)
+					}
+				}
+				continue
+			}
+			noResultWindow = 0
+
+			language, _ := currentLanguages()
+			for _, result := range resp.Results {
+				if detectedAlternative == "" && result.LanguageCode != "" && !strings.EqualFold(result.LanguageCode, language) {
+					detectedAlternative = result.LanguageCode
+				}
+				if err := processStreamResult(result, false, time.Time{}); err != nil {
+					return
+				}
+			}
+		}
+	}
+
+	// receiveLanguageTrack receives messages from a single-language stream in multi-language mode.
+	// Interim results are only forwarded from the primary track; final results compete in the arbiter.
+	receiveLanguageTrack := func(language string, primary bool, arbiter *languageArbiter) {
+		utterance := 0 // Final results received on this track, across stream recreations
+		for {
+			currentStream := session.languageStream(language)
+			if currentStream == nil {
+				return
+			}
+
+			resp, err := recvWithTimeout(currentStream, recvTimeout, audioSentAt)
+			if err != nil {
+				if ctx.Err() != nil {
+					sessionLogger.Debug("Context cancelled, stopping language track", "language", language, "error", err)
+					return
+				}
+				// The stream may already have been replaced by the duration monitor or a keyword update
+				if session.languageStream(language) != currentStream {
+					continue
+				}
+				if status.Code(err) == codes.DeadlineExceeded {
+					sessionLogger.Warn("Language track receive timed out, recreating stream",
+						"language", language,
+						"timeout", recvTimeout)
+					serverMetrics.RecvTimeoutCount.Add(1)
+					session.recordEvent("recv_timeout", map[string]interface{}{"language": language, "timeoutMs": recvTimeout.Milliseconds()})
+					currentStream.CloseSend()
+				} else if err != io.EOF {
+					sessionLogger.Error("Error receiving from language track", "language", language, "error", err)
+					session.recordEvent("stream_error", map[string]interface{}{"language": language, "error": err.Error()})
+				}
+				newStream, openErr := openStream(language, nil, speechContexts)
+				if openErr != nil {
+					sessionLogger.Error("Failed to recreate language track stream", "language", language, "error", openErr)
+					return
+				}
+				session.setLanguageStream(language, newStream)
+				session.recordEvent("stream_created", map[string]interface{}{"language": language})
+				continue
+			}
+
+			if err := resp.Error; err != nil {
+				sessionLogger.Error("Speech-to-Text API error on language track", "language", language, "error", err)
+				session.recordEvent("speech_api_error", map[string]interface{}{"language": language, "code": err.GetCode(), "message": err.GetMessage()})
+				continue
+			}
+
+			for _, result := range resp.Results {
+				if len(result.Alternatives) == 0 {
+					continue
+				}
+				alternative := result.Alternatives[0]
+				if !result.IsFinal {
+					if primary {
+						if err := processResult(alternative, false, language, result.ChannelTag, time.Time{}); err != nil {
+							return
+						}
+					}
+					continue
+				}
+				utterance++
+				arbiter.Offer(languageCandidate{
+					Alternative: alternative,
+					Language:    language,
+					ChannelTag:  result.ChannelTag,
+					Utterance:   utterance,
+				})
+			}
+		}
+	}
+
+	// recreateLanguageStreams reopens every language track with the given contexts
+	recreateLanguageStreams := func(contexts []*speechpb.SpeechContext) error {
+		for language, oldStream := range session.allLanguageStreams() {
+			newStream, err := openStream(language, nil, contexts)
+			if err != nil {
+				return fmt.Errorf("failed to recreate language track %s: %v", language, err)
+			}
+			session.setLanguageStream(language, newStream)
+			oldStream.CloseSend()
+		}
+		session.recordEvent("stream_created", map[string]interface{}{"languageTracks": len(session.allLanguageStreams()), "contextsCount": len(contexts)})
+		streamMu.Lock()
+		streamStartTime = time.Now()
+		streamMu.Unlock()
+		return nil
+	}
+
+	// startStreamHandover opens the next stream alongside the current one and promotes it once it
+	// answers; the current stream keeps receiving audio until then. Falls back to a full restart on error.
+	startStreamHandover := func(updatedContexts []*speechpb.SpeechContext) error {
+		contextsToUse := speechContexts
+		if updatedContexts != nil {
+			contextsToUse = updatedContexts
+		}
+
+		language, alternatives := currentLanguages()
+
+		newStream, err := openStream(language, alternatives, contextsToUse)
+		if err != nil {
+			return err
+		}
+		for _, chunk := range recentAudio.Chunks() {
+			if err := newStream.Send(&speechpb.StreamingRecognizeRequest{
+				StreamingRequest: &speechpb.StreamingRecognizeRequest_AudioContent{
+					AudioContent: chunk,
+				},
+			}); err != nil {
+				newStream.CloseSend()
+				return fmt.Errorf("failed to prime handover stream: %v", err)
+			}
+		}
+
+		streamMu.Lock()
+		if handoverStream != nil {
+			handoverStream.CloseSend()
+		}
+		handoverStream = newStream
+		streamMu.Unlock()
+		sessionLogger.Info("Starting seamless stream handover")
+
+		go func() {
+			resp, err := recvWithTimeout(newStream, recvTimeout, nil)
+
+			streamMu.Lock()
+			if handoverStream != newStream {
+				// Superseded by another handover or a full restart
+				streamMu.Unlock()
+				newStream.CloseSend()
+				return
+			}
+			handoverStream = nil
+			if err != nil {
+				streamMu.Unlock()
+				newStream.CloseSend()
+				if ctx.Err() != nil {
+					return
+				}
+				sessionLogger.Warn("Seamless stream handover failed, falling back to full restart", "error", err)
+				if err := createStream(updatedContexts); err != nil {
+					sessionLogger.Error("Failed to recreate stream after handover failure", "error", err)
+				}
+				return
+			}
+			oldStream := stream
+			stream = newStream
+			streamStartTime = time.Now()
+			streamOverlap.Switched()
+			streamMu.Unlock()
+
+			if oldStream != nil {
+				oldStream.CloseSend()
+			}
+			sessionLogger.Info("Seamless stream handover completed")
+			session.recordEvent("stream_created", map[string]interface{}{"contextsCount": len(contextsToUse), "strategy": streamRecreationSeamless})
+			if err := sendJSON(StatusResponse{
+				Type:      "status",
+				Status:    "stream_recreated",
+				Message:   "Speech recognition stream was recreated without interrupting audio",
+				Timestamp: session.Timestamp(time.Now()),
+			}); err != nil {
+				sessionLogger.Error("Failed to send stream recreated status", "error", err)
+			}
+
+			if resp.Error != nil {
+				return
+			}
+			for _, result := range resp.Results {
+				if err := processStreamResult(result, false, time.Time{}); err != nil {
+					return
+				}
+			}
+		}()
+		return nil
+	}
+
+	// recreateStreams recreates the active stream(s) for the current mode
+	recreateStreams := func(contexts []*speechpb.SpeechContext) error {
+		if config.MultiLanguageMode {
+			if contexts == nil {
+				contexts = speechContexts
+			}
+			return recreateLanguageStreams(contexts)
+		}
+		if seamlessRecreation {
+			return startStreamHandover(contexts)
+		}
+		return createStream(contexts)
+	}
 
-					if result.IsFinal {
-						fullTranscription.WriteString(transcriptionText + " ")
-						newTranscripts.WriteString(transcriptionText + " ") // Track new content
-						// Generate summary asynchronously to avoid blocking transcript processing
-						if projectID != "" && location != "" {
-							go func() {
-								fullTranscript := strings.TrimSpace(fullTranscription.String())
-								newTranscript := strings.TrimSpace(newTranscripts.String())
-
-								// Safely read current summary
-								summaryMu.Lock()
-								previousSummary := currentSummary
-								summaryMu.Unlock()
-
-								logger.Debug("Generating summary",
-									"transcriptLength", len(fullTranscript),
-									"newTranscriptLength", len(newTranscript),
-									"previousSummaryLength", len(previousSummary))
-								summary, err := generateSummary(ctx, projectID, location, geminiModel, fullTranscript, newTranscript, previousSummary, summaryPrompt, customWords)
-								if err != nil {
-									logger.Error("Error generating summary", "error", err)
-									return
-								}
-								if summary != "" {
-									// Safely update current summary and clear new transcripts
-									summaryMu.Lock()
-									currentSummary = summary
-									summaryMu.Unlock()
-									
-									// Clear new transcripts buffer after successful summary generation
-									newTranscripts.Reset()
-
-									logger.Info("Summary generated", "summaryLength", len(summary))
-									summaryResponse := SummaryResponse{
-										Type:      "summary",
-										Text:      summary,
-										Timestamp: time.Now(),
-									}
-									summaryData, err := json.Marshal(summaryResponse)
-									if err != nil {
-										logger.Error("Failed to marshal summary response", "error", err)
-										return
-									}
-									mu.Lock()
-									if err := conn.WriteMessage(websocket.TextMessage, summaryData); err != nil {
-										logger.Error("Failed to send summary to client", "error", err)
-									}
-									mu.Unlock()
-								}
-							}()
-						}
-					}
-				}
+	// Start receiving from Speech-to-Text
+	if config.MultiLanguageMode {
+		languages := uniqueLanguages(primaryLanguage, alternativeLanguages)
+		sessionLogger.Info("Starting multi-language mode",
+			"languages", languages)
+
+		arbiter := newLanguageArbiter(multiLanguageSelectionWindow, func(c languageCandidate) {
+			if err := processResult(c.Alternative, true, c.Language, c.ChannelTag, time.Time{}); err != nil {
+				sessionLogger.Error("Failed to process selected language result", "language", c.Language, "error", err)
 			}
+		})
+
+		for _, language := range languages {
+			languageStream, err := openStream(language, nil, speechContexts)
+			if err != nil {
+				sessionLogger.Error("Failed to create language track stream", "language", language, "error", err)
+				return
+			}
+			session.setLanguageStream(language, languageStream)
 		}
-	}()
+		session.recordEvent("stream_created", map[string]interface{}{"languageTracks": len(languages), "contextsCount": len(speechContexts)})
+		for i, language := range languages {
+			go receiveLanguageTrack(language, i == 0, arbiter)
+		}
+	} else {
+		go receiveSingleStream()
+	}
 
 	// Goroutine to monitor stream duration and restart before hitting the limit
 	go func() {
@@ -573,19 +2118,20 @@ If this is an update to an existing summary, maintain the structure and content
 			case <-ticker.C:
 				streamMu.Lock()
 				elapsed := time.Since(streamStartTime)
+				handingOver := handoverStream != nil
 				streamMu.Unlock()
 
-				if elapsed >= maxStreamDuration {
-					logger.Info("Stream duration limit approaching, recreating stream",
+				if elapsed >= maxStreamDuration && !handingOver {
+					sessionLogger.Info("Stream duration limit approaching, recreating stream",
 						"elapsed", elapsed,
 						"limit", maxStreamDuration)
-					if err := createStream(nil); err != nil {
+					if err := recreateStreams(nil); err != nil {
 						// Check if the error is due to connection closing
 						if ctx.Err() != nil {
-							logger.Info("Context cancelled during stream recreation, stopping duration monitoring")
+							sessionLogger.Info("Context cancelled during stream recreation, stopping duration monitoring")
 							return
 						}
-						logger.Error("Failed to recreate stream due to duration limit", "error", err)
+						sessionLogger.Error("Failed to recreate stream due to duration limit", "error", err)
 					}
 				}
 			case <-ctx.Done():
@@ -594,28 +2140,113 @@ If this is an update to an existing summary, maintain the structure and content
 		}
 	}()
 
+	// Send empty audio chunks while the client is silent so NAT devices do not drop the idle gRPC connection
+	var audioSendMu sync.Mutex // Serializes audio and keepalive sends on the Speech-to-Text streams
+	if keepaliveInterval := time.Duration(getEnvInt64("STREAM_KEEPALIVE_INTERVAL_MS", 0)) * time.Millisecond; keepaliveInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(keepaliveInterval)
+			defer ticker.Stop()
+
+			keepalive := &speechpb.StreamingRecognizeRequest{
+				StreamingRequest: &speechpb.StreamingRecognizeRequest_AudioContent{
+					AudioContent: []byte{},
+				},
+			}
+			for {
+				select {
+				case <-ticker.C:
+					if time.Since(time.Unix(0, lastAudioSentAt.Load())) < keepaliveInterval {
+						continue
+					}
+
+					var streams []speechpb.Speech_StreamingRecognizeClient
+					if config.MultiLanguageMode {
+						for _, languageStream := range session.allLanguageStreams() {
+							streams = append(streams, languageStream)
+						}
+					} else {
+						streamMu.Lock()
+						if stream != nil {
+							streams = append(streams, stream)
+						}
+						streamMu.Unlock()
+					}
+
+					audioSendMu.Lock()
+					for _, keepaliveStream := range streams {
+						if err := keepaliveStream.Send(keepalive); err != nil {
+							// The receive loop recreates broken streams
+							sessionLogger.Debug("Failed to send stream keepalive", "error", err)
+							continue
+						}
+						session.incrementKeepalives()
+					}
+					audioSendMu.Unlock()
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
 	// Channel to coordinate final summary completion before closing
 	finalSummaryDone := make(chan struct{})
 	var finalSummaryInProgress int32 // atomic counter
 
 	// Main loop to read from client and send audio to Speech-to-Text
-	audioChunkCount := 0
+	var audioChunkCount int64
+	quotaThrottled := false
+	// Audio received while the quota is exhausted; it is charged to the quota when forwarding resumes
+	throttledAudio := newPendingAudioBuffer(time.Duration(getEnvInt64("AUDIO_BUFFER_MAX_MS", 2000)) * time.Millisecond)
+
+	// bufferAudio keeps a chunk that cannot be forwarded yet; the client is told once per buffering episode
+	// when the buffer is full and its oldest audio is dropped
+	bufferAudio := func(buffer *pendingAudioBuffer, data []byte, duration time.Duration, reason string) {
+		dropped := buffer.Add(data, duration, time.Now())
+		if dropped == 0 {
+			return
+		}
+		if buffer.Dropped() > dropped {
+			sessionLogger.Debug("Dropped buffered audio", "reason", reason, "droppedMs", dropped.Milliseconds())
+			return
+		}
+		sessionLogger.Warn("Audio buffer full, dropping the oldest audio", "reason", reason, "droppedMs", dropped.Milliseconds())
+		session.recordEvent("audio_dropped", map[string]interface{}{"reason": reason})
+		if err := sendJSON(StatusResponse{
+			Type:      "status",
+			Status:    "audio_dropped",
+			Message:   "Audio buffer full, the oldest buffered audio is being dropped",
+			Timestamp: session.Timestamp(time.Now()),
+		}); err != nil {
+			sessionLogger.Error("Failed to send audio dropped status", "error", err)
+		}
+	}
+
+	// Limit text messages per connection so a misbehaving client cannot flood the server
+	textMessageRate := getEnvInt64("TEXT_MSG_RATE", 10)
+	if textMessageRate < 1 {
+		textMessageRate = 1
+	}
+	textMessageLimiter := rate.NewLimiter(rate.Limit(textMessageRate), int(textMessageRate))
+	maxTextMessageViolations := getEnvInt64("TEXT_MSG_CONSECUTIVE_VIOLATIONS", 50)
+	var textMessageViolations int64
+readLoop:
 	for {
 		messageType, message, err := conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				logger.Error("Unexpected WebSocket error", "error", err)
+				sessionLogger.Error("Unexpected WebSocket error", "error", err)
 			} else {
-				logger.Info("WebSocket connection closed by client")
+				sessionLogger.Info("WebSocket connection closed by client")
 
 				// If final summary is in progress, wait for it to complete
 				if atomic.LoadInt32(&finalSummaryInProgress) > 0 {
-					logger.Info("Waiting for final summary to complete before closing connection")
+					sessionLogger.Info("Waiting for final summary to complete before closing connection")
 					select {
 					case <-finalSummaryDone:
-						logger.Info("Final summary completed, proceeding with connection closure")
+						sessionLogger.Info("Final summary completed, proceeding with connection closure")
 					case <-time.After(35 * time.Second): // Slightly longer than the summary timeout
-						logger.Warn("Timeout waiting for final summary, proceeding with connection closure")
+						sessionLogger.Warn("Timeout waiting for final summary, proceeding with connection closure")
 					}
 				}
 			}
@@ -624,95 +2255,322 @@ If this is an update to an existing summary, maintain the structure and content
 			break
 		}
 
+		// Every client message counts as a heartbeat
+		session.touch()
+
 		switch messageType {
 		case websocket.BinaryMessage:
-			audioChunkCount++
-			logger.Debug("Received audio chunk",
+			audioChunkCount = session.incrementAudioChunks()
+			sessionLogger.Debug("Received audio chunk",
 				"chunkNumber", audioChunkCount,
 				"bytes", len(message))
+			audioReceived()
+
+			if consentPending {
+				sessionLogger.Debug("Dropping audio chunk until consent is acknowledged",
+					"chunkNumber", audioChunkCount)
+				continue
+			}
+
+			if watermarker != nil {
+				if err := appendWatermarkRecord(watermarker.Record(audioChunkCount, message)); err != nil {
+					sessionLogger.Warn("Failed to write audio watermark", "chunkNumber", audioChunkCount, "error", err)
+				}
+			}
+
+			// FLAC streams carry their sample rate in the header of the first chunk
+			if detectSampleRate {
+				detectSampleRate = false
+				sampleRate, channels, err := parseFLACHeader(message)
+				if err != nil {
+					sessionLogger.Warn("Failed to detect FLAC sample rate", "error", err)
+				} else {
+					sessionLogger.Info("FLAC sample rate detected, recreating stream",
+						"sampleRate", sampleRate,
+						"channels", channels)
+					session.recordEvent("sample_rate_detected", map[string]interface{}{"sampleRate": sampleRate, "channels": channels})
+					sampleRateHertz.Store(int32(sampleRate))
+					recognitionConfig.SampleRateHertz = int32(sampleRate)
+					if err := recreateStreams(nil); err != nil {
+						sessionLogger.Error("Failed to recreate stream with detected sample rate", "error", err)
+					}
+				}
+			}
+
+			// Drop corrupt or truncated Opus packets rather than confusing the Speech API
+			if validateOpus {
+				if err := validateOpusPacket(message); err != nil {
+					droppedInvalidChunks++
+					serverMetrics.DroppedInvalidChunks.Add(1)
+					sessionLogger.Debug("Dropping invalid Opus packet",
+						"chunkNumber", audioChunkCount,
+						"firstBytes", fmt.Sprintf("%x", message[:min(len(message), 16)]),
+						"error", err)
+					if droppedInvalidChunks%10 == 0 {
+						if err := sendJSON(StatusResponse{
+							Type:      "status",
+							Status:    "invalid_audio_chunks_dropped",
+							Message:   "Invalid audio chunks were dropped",
+							Timestamp: session.Timestamp(time.Now()),
+							Count:     droppedInvalidChunks,
+						}); err != nil {
+							sessionLogger.Error("Failed to send invalid audio chunks status", "error", err)
+						}
+					}
+					continue
+				}
+			}
 
-			// Send audio content to Speech-to-Text
+			channels := config.AudioFormat.Channels
+			if downmixer != nil {
+				message, channels = downmixer.Downmix(message), 1
+			}
+			if resampler != nil {
+				message = resampler.Resample(message)
+			}
+			if len(message) == 0 {
+				// The chunk held only part of a frame, which is carried over to the next one
+				continue
+			}
+
+			chunkDuration := encodedAudioDuration(message, encoding, int(sampleRateHertz.Load()), channels)
+			if vad != nil {
+				if reading := vad.Process(message, chunkDuration, time.Now()); reading != nil {
+					reading.Timestamp = session.Timestamp(reading.Timestamp.Time)
+					if err := sendJSON(reading); err != nil {
+						sessionLogger.Error("Failed to send audio level to client", "error", err)
+					}
+				}
+				silenceHeard(vad.silenceDuration)
+			}
+			if checkInactivity() {
+				continue
+			}
+
+			// Enforce the server-wide audio quota before forwarding to Speech-to-Text; the audio buffered while
+			// throttled is charged with the chunk that ends the throttling
+			chargedBytes := len(message)
+			if quotaThrottled {
+				chargedBytes += throttledAudio.Bytes()
+			}
+			if !audioQuota.Take(chargedBytes) {
+				bufferAudio(throttledAudio, message, chunkDuration, "quota")
+
+				if !quotaThrottled {
+					quotaThrottled = true
+					retryAfter := audioQuota.RetryAfter(chargedBytes)
+					session.recordEvent("quota_throttled", map[string]interface{}{"retryAfterMs": retryAfter.Milliseconds()})
+					sessionLogger.Warn("Audio quota exhausted, throttling session",
+						"chunkNumber", audioChunkCount,
+						"retryAfter", retryAfter)
+					if err := sendJSON(StatusResponse{
+						Type:         "status",
+						Status:       "quota_throttling",
+						Message:      "Audio quota exceeded, audio is being buffered",
+						Timestamp:    session.Timestamp(time.Now()),
+						RetryAfterMs: retryAfter.Milliseconds(),
+					}); err != nil {
+						sessionLogger.Error("Failed to send quota throttling status", "error", err)
+					}
+				}
+				continue
+			}
+			if quotaThrottled {
+				quotaThrottled = false
+				sessionLogger.Info("Audio quota available again, resuming forwarding", "chargedBytes", chargedBytes)
+				session.recordEvent("quota_resumed", nil)
+
+				// Forward the audio buffered while throttled ahead of the current chunk
+				if bufferedChunks := throttledAudio.Take(); len(bufferedChunks) > 0 {
+					message = append(bytes.Join(bufferedChunks, nil), message...)
+				}
+			}
+
+			lastAudioSentAt.Store(time.Now().UnixNano())
+
+			if retainedAudio != nil {
+				retainedAudio.Add(message, time.Now())
+			}
+			if shortAudioEligible {
+				if firstAudioAt.IsZero() {
+					firstAudioAt = time.Now()
+				}
+				if time.Since(firstAudioAt) > batchThreshold || len(shortAudio)+len(message) > maxBatchAudioBytes {
+					takeShortAudio() // Too long for batch recognition; stop buffering
+				} else {
+					shortAudio = append(shortAudio, message...)
+				}
+			}
+
+			// In multi-language mode, every language track receives the same audio
+			if config.MultiLanguageMode {
+				audioSendMu.Lock()
+				for language, languageStream := range session.allLanguageStreams() {
+					if err := languageStream.Send(&speechpb.StreamingRecognizeRequest{
+						StreamingRequest: &speechpb.StreamingRecognizeRequest_AudioContent{
+							AudioContent: message,
+						},
+					}); err != nil {
+						// The track's receive loop recreates the stream on error
+						sessionLogger.Error("Failed to send audio chunk to language track",
+							"language", language,
+							"chunkNumber", audioChunkCount,
+							"error", err)
+					}
+				}
+				audioSendMu.Unlock()
+				continue
+			}
+
+			// Send audio content to Speech-to-Text, and to the next stream while a handover is in progress
 			streamMu.Lock()
 			currentStream := stream
+			nextStream := handoverStream
 			streamMu.Unlock()
 
-			if currentStream != nil {
-				if err := currentStream.Send(&speechpb.StreamingRecognizeRequest{
+			if seamlessRecreation {
+				recentAudio.Add(message, time.Now())
+			}
+			audioSendMu.Lock()
+			if nextStream != nil {
+				if err := nextStream.Send(&speechpb.StreamingRecognizeRequest{
 					StreamingRequest: &speechpb.StreamingRecognizeRequest_AudioContent{
 						AudioContent: message,
 					},
 				}); err != nil {
-					logger.Error("Failed to send audio chunk to Speech-to-Text",
+					// The handover receiver falls back to a full restart when the stream fails
+					sessionLogger.Warn("Failed to send audio chunk to handover stream", "chunkNumber", audioChunkCount, "error", err)
+				}
+			}
+
+			var sendErr error
+			if currentStream != nil {
+				sendErr = currentStream.Send(&speechpb.StreamingRecognizeRequest{
+					StreamingRequest: &speechpb.StreamingRecognizeRequest_AudioContent{
+						AudioContent: message,
+					},
+				})
+			}
+			audioSendMu.Unlock()
+
+			if currentStream != nil {
+				if err := sendErr; err != nil {
+					sessionLogger.Error("Failed to send audio chunk to Speech-to-Text",
 						"chunkNumber", audioChunkCount,
 						"error", err)
 
 					// Buffer this audio chunk before recreating stream
-					streamMu.Lock()
-					pendingAudioChunks = append(pendingAudioChunks, message)
-					// Limit buffer size to prevent memory issues
-					if len(pendingAudioChunks) > 10 {
-						pendingAudioChunks = pendingAudioChunks[1:] // Remove oldest chunk
-					}
-					streamMu.Unlock()
+					bufferAudio(pendingAudio, message, chunkDuration, "stream_error")
 
 					// Try to recreate stream on send error
 					if recreateErr := createStream(nil); recreateErr != nil {
-						logger.Error("Failed to recreate stream after send error", "error", recreateErr)
+						sessionLogger.Error("Failed to recreate stream after send error", "error", recreateErr)
 						return
 					}
 					continue
 				}
 			} else {
 				// Stream is nil, buffer the audio chunk
-				streamMu.Lock()
-				pendingAudioChunks = append(pendingAudioChunks, message)
-				// Limit buffer size to prevent memory issues
-				if len(pendingAudioChunks) > 10 {
-					pendingAudioChunks = pendingAudioChunks[1:] // Remove oldest chunk
-				}
-				streamMu.Unlock()
-				logger.Debug("Buffered audio chunk (stream is nil)", "chunkNumber", audioChunkCount)
+				bufferAudio(pendingAudio, message, chunkDuration, "no_stream")
+				sessionLogger.Debug("Buffered audio chunk (stream is nil)", "chunkNumber", audioChunkCount)
 			}
-			logger.Debug("Successfully processed audio chunk",
+			sessionLogger.Debug("Successfully processed audio chunk",
 				"chunkNumber", audioChunkCount)
 		case websocket.TextMessage:
-			logger.Debug("Received text message", "message", string(message))
+			sessionLogger.Debug("Received text message", "message", string(message))
+
+			if reservation := textMessageLimiter.Reserve(); reservation.Delay() > 0 {
+				retryAfter := reservation.Delay()
+				reservation.Cancel()
+				textMessageViolations++
+				if textMessageViolations >= maxTextMessageViolations {
+					sessionLogger.Warn("Too many rate limited text messages, closing connection",
+						"violations", textMessageViolations)
+					session.recordEvent("rate_limit_disconnect", map[string]interface{}{"violations": textMessageViolations})
+					mu.Lock()
+					conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "too many messages"))
+					mu.Unlock()
+					cancel()
+					break readLoop
+				}
+				sessionLogger.Debug("Text message rate limited",
+					"violations", textMessageViolations,
+					"retryAfter", retryAfter)
+				if err := sendJSON(StatusResponse{
+					Type:         "status",
+					Status:       "rate_limited",
+					Message:      "Too many messages, message ignored",
+					Timestamp:    session.Timestamp(time.Now()),
+					RetryAfterMs: retryAfter.Milliseconds(),
+				}); err != nil {
+					sessionLogger.Error("Failed to send rate limited status", "error", err)
+				}
+				continue
+			}
+			textMessageViolations = 0
+
+			// Any client message proves someone is still there, restarting the silence timeout
+			if vad != nil {
+				vad.silenceDuration = 0
+			}
+			silenceHeard(0)
 
 			// Parse the message to determine its type
 			var baseMessage struct {
 				Type string `json:"type"`
 			}
 			if err := json.Unmarshal(message, &baseMessage); err != nil {
-				logger.Warn("Failed to parse message type", "error", err, "message", string(message))
+				sessionLogger.Warn("Failed to parse message type", "error", err, "message", string(message))
 				continue
 			}
 
 			switch baseMessage.Type {
+			case "activity_ping":
+				sessionLogger.Debug("Activity ping received, silence timeout restarted")
 			case "config":
 				// Check if it's a new config message (for system audio mode)
 				var newConfig ConfigMessage
 				if err := json.Unmarshal(message, &newConfig); err == nil {
-					logger.Info("Received new config message", "config", newConfig)
+					sessionLogger.Info("Received new config message", "config", newConfig)
 				}
 			case "end_prompt":
 				// Handle end prompt message (final summary generation when stopping)
-				logger.Info("End prompt message received",
+				sessionLogger.Info("End prompt message received",
 					"rawMessage", string(message))
 
-				var endPromptMsg EndPromptMessage
+				endPromptMsg := EndPromptMessage{Timestamp: session.Timestamp(time.Time{})}
 				if err := json.Unmarshal(message, &endPromptMsg); err != nil {
-					logger.Error("Failed to parse end prompt message",
+					sessionLogger.Error("Failed to parse end prompt message",
 						"error", err,
 						"rawMessage", string(message),
 						"messageLength", len(message))
 					continue
 				}
 
-				logger.Info("End prompt processed successfully",
+				session.recordEvent("end_prompt_received", map[string]interface{}{"endPrompt": endPromptMsg.EndPrompt})
+
+				if vad != nil {
+					stats := vad.Stats()
+					stats.Timestamp = session.Timestamp(stats.Timestamp.Time)
+					bufferedDuration, _ := pendingAudio.Duration()
+					throttledDuration, _ := throttledAudio.Duration()
+					stats.BufferedAudioMs = int((bufferedDuration + throttledDuration).Milliseconds())
+					if err := sendJSON(stats); err != nil {
+						sessionLogger.Error("Failed to send audio stats to client", "error", err)
+					}
+				}
+
+				sessionLogger.Info("End prompt processed successfully",
 					"endPrompt", endPromptMsg.EndPrompt,
-					"clientTimestamp", endPromptMsg.Timestamp,
+					"clientTimestamp", endPromptMsg.Timestamp.Time,
 					"serverTimestamp", time.Now(),
-					"timeDelta", time.Since(endPromptMsg.Timestamp))
+					"timeDelta", time.Since(endPromptMsg.Timestamp.Time))
+
+				// Short sessions are re-transcribed before the final summary so it uses the batch transcript
+				batchAudio, batchAudioStart, batchAudioEnd := takeShortAudio(), firstAudioAt, time.Now()
+				if projectID == "" || location == "" {
+					go reprocessWithBatch(batchAudio, batchAudioStart, batchAudioEnd)
+				}
 
 				// Generate final summary with end prompt asynchronously
 				if projectID != "" && location != "" {
@@ -730,52 +2588,78 @@ If this is an update to an existing summary, maintain the structure and content
 
 						// Create a new context with timeout for the end prompt generation
 						// This prevents cancellation when WebSocket closes
+						reprocessWithBatch(batchAudio, batchAudioStart, batchAudioEnd)
+
 						endPromptCtx, endPromptCancel := context.WithTimeout(context.Background(), 30*time.Second)
 						defer endPromptCancel()
 
-						fullTranscript := strings.TrimSpace(fullTranscription.String())
+						fullTranscript := session.Transcript()
+						// For final summary, use remaining new transcripts or empty string if none
+						newTranscript := session.NewTranscript()
+						if summaryWindow > 0 {
+							newTranscript = session.Segments().WindowedTranscript(time.Now().Add(-summaryWindow))
+						}
+
 						if fullTranscript == "" {
-							logger.Warn("No transcript available for end prompt summary")
+							sessionLogger.Warn("No transcript available for end prompt summary")
+							return
+						}
+						if session.GenAIBudgetExhausted() {
+							sessionLogger.Info("Final summary skipped, GenAI token budget exhausted")
 							return
 						}
 
-						// For final summary, use remaining new transcripts or empty string if none
-						newTranscript := strings.TrimSpace(newTranscripts.String())
-
-						// Safely read current summary
-						summaryMu.Lock()
-						previousSummary := currentSummary
-						summaryMu.Unlock()
+						previousSummary := session.Summary()
 
 						// Combine original summary prompt with end prompt
 						combinedPrompt := summaryPrompt + "\n\n" + endPromptMsg.EndPrompt
 
-						logger.Info("Generating final summary with end prompt",
+						sessionLogger.Info("Generating final summary with end prompt",
 							"transcriptLength", len(fullTranscript),
 							"newTranscriptLength", len(newTranscript),
 							"previousSummaryLength", len(previousSummary),
 							"combinedPromptLength", len(combinedPrompt))
 
-						summary, err := generateSummary(endPromptCtx, projectID, location, geminiModel, fullTranscript, newTranscript, previousSummary, combinedPrompt, customWords)
+						summaryID := summarySequence.Add(1)
+						result, err := generateSummary(endPromptCtx, projectID, location, geminiModel, fullTranscript, newTranscript, previousSummary, combinedPrompt, customWords, session.Chapters(), streamingSummaryOptions(summaryID))
 						if err != nil {
-							logger.Error("Error generating final summary with end prompt", "error", err)
+							sessionLogger.Error("Error generating final summary with end prompt", "error", err)
+							session.recordEvent("summary_error", map[string]interface{}{"final": true, "error": err.Error()})
 							return
 						}
+						summary := chargeGenAITokens(result)
 						if summary != "" {
-							// Safely update current summary
-							summaryMu.Lock()
-							currentSummary = summary
-							summaryMu.Unlock()
+							session.recordSummary(summary)
+
+							// Notify external systems that the final summary is ready
+							if config.WebhookURL != "" {
+								go notifySummaryWebhook(config.WebhookURL, config.WebhookSecret, WebhookPayload{
+									SessionID:  session.ID,
+									Summary:    summary,
+									Timestamp:  session.Timestamp(time.Now()),
+									TokenCount: result.TotalTokens(),
+								})
+							}
+							if config.SlackWebhookURL != "" {
+								go notifySlack(config.SlackWebhookURL, config.SlackChannel, session.ID, summary)
+							}
 
-							logger.Info("Final summary with end prompt generated", "summaryLength", len(summary))
+							sessionLogger.Info("Final summary with end prompt generated", "summaryLength", len(summary))
+							cloudAudit("summary.generate", map[string]interface{}{"kind": "final", "tokens": result.TotalTokens()})
+							finishSummaryStream(summaryID, summary)
 							summaryResponse := SummaryResponse{
-								Type:      "summary",
-								Text:      summary,
-								Timestamp: time.Now(),
+								Type:                      "summary",
+								SummaryID:                 summaryID,
+								Text:                      summary,
+								Timestamp:                 session.Timestamp(time.Now()),
+								SummaryLanguage:           summaryLanguage,
+								JSON:                      summaryFormat == summaryFormatJSON,
+								SummaryGenerationStrategy: result.Strategy,
+								FocusTopics:               summaryOptions.FocusTopics,
 							}
 							summaryData, err := json.Marshal(summaryResponse)
 							if err != nil {
-								logger.Error("Failed to marshal final summary response", "error", err)
+								sessionLogger.Error("Failed to marshal final summary response", "error", err)
 								return
 							}
 
@@ -787,55 +2671,267 @@ If this is an update to an existing summary, maintain the structure and content
 								// Set a write deadline to prevent blocking on a dead connection
 								conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
 
-								logger.Info("Sending final summary to client",
+								sessionLogger.Info("Sending final summary to client",
 									"summaryLength", len(summary),
 									"connectionState", "open")
 
-								if err := conn.WriteMessage(websocket.TextMessage, summaryData); err != nil {
-									logger.Warn("Failed to send final summary to client",
+								if err := writeText(summaryData); err != nil {
+									sessionLogger.Warn("Failed to send final summary to client",
 										"error", err,
 										"errorType", fmt.Sprintf("%T", err))
+									summaryRetries.Queue(&summaryResponse, err)
 								} else {
-									logger.Info("Final summary sent to client successfully",
+									session.markSummaryDelivered(summaryID)
+									sessionLogger.Info("Final summary sent to client successfully",
 										"summaryLength", len(summary))
 								}
 
 								// Clear the write deadline
 								conn.SetWriteDeadline(time.Time{})
 							} else {
-								logger.Warn("WebSocket connection is nil, final summary generated but not sent",
+								sessionLogger.Warn("WebSocket connection is nil, final summary generated but not sent",
 									"summaryLength", len(summary))
 							}
 						}
 					}()
 				} else {
-					logger.Warn("GCP configuration not available for end prompt summary generation")
+					sessionLogger.Warn("GCP configuration not available for end prompt summary generation")
+				}
+			case "consent_ack":
+				// Handle the client's answer to the recording consent notice
+				var consentMsg ConsentAckMessage
+				if err := json.Unmarshal(message, &consentMsg); err != nil {
+					sessionLogger.Error("Failed to parse consent acknowledgement",
+						"error", err,
+						"rawMessage", string(message))
+					continue
+				}
+
+				if !consentMsg.Accepted {
+					sessionLogger.Info("Recording consent declined, closing session")
+					session.recordEvent("consent_declined", nil)
+					if err := sendJSON(StatusResponse{
+						Type:      "status",
+						Status:    "session_declined",
+						Message:   "Recording consent was declined",
+						Timestamp: session.Timestamp(time.Now()),
+					}); err != nil {
+						sessionLogger.Error("Failed to send session declined status", "error", err)
+					}
+					mu.Lock()
+					conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "consent declined"))
+					mu.Unlock()
+					cancel()
+					break readLoop
+				}
+
+				consentPending = false
+				consentAt := time.Now()
+				session.recordConsent(consentAt)
+				session.recordEvent("consent_accepted", nil)
+				sessionLogger.Info("Recording consent accepted", "consentTimestamp", consentAt)
+			case "chapter":
+				// Handle chapter marker inserted by the client at a topic boundary
+				chapterMsg := ChapterMessage{Timestamp: session.Timestamp(time.Time{})}
+				if err := json.Unmarshal(message, &chapterMsg); err != nil {
+					sessionLogger.Error("Failed to parse chapter message",
+						"error", err,
+						"rawMessage", string(message))
+					continue
+				}
+
+				chapter := session.addChapter(chapterMsg.Title, chapterMsg.Timestamp.Time)
+				if err := appendTranscriptRecord(session.ID, TranscriptRecord{Type: "chapter", Timestamp: time.Now(), Chapter: &chapter}); err != nil {
+					sessionLogger.Error("Failed to persist chapter", "error", err)
+				}
+				session.recordEvent("chapter_added", map[string]interface{}{"title": chapter.Title, "charOffset": chapter.CharOffset})
+				sessionLogger.Info("Chapter marker added",
+					"title", chapter.Title,
+					"charOffset", chapter.CharOffset)
+			case "transcript_preview":
+				// Answered inline: the lookup only reads the stored segments
+				var previewMsg TranscriptPreviewMessage
+				if err := json.Unmarshal(message, &previewMsg); err != nil {
+					sessionLogger.Error("Failed to parse transcript preview message",
+						"error", err,
+						"rawMessage", string(message))
+					continue
+				}
+
+				var reply interface{}
+				if previewMsg.WindowMs <= 0 || previewMsg.TimestampMs < 0 {
+					reply = StatusResponse{Type: "status", Status: "transcript_preview_error", Message: "timestampMs must not be negative and windowMs must be positive", Timestamp: session.Timestamp(time.Now())}
+				} else if preview, ok := session.Segments().Preview(session.CreatedAt, previewMsg.TimestampMs, previewMsg.WindowMs); ok {
+					reply = preview
+				} else {
+					reply = StatusResponse{Type: "status", Status: "transcript_preview_error", Message: "No transcript in the requested window", Timestamp: session.Timestamp(time.Now())}
+				}
+				if err := sendJSON(reply); err != nil {
+					sessionLogger.Error("Failed to send transcript preview to client", "error", err)
+				}
+
+			case "retranscribe":
+				var retranscribeMsg RetranscribeMessage
+				if err := json.Unmarshal(message, &retranscribeMsg); err != nil {
+					sessionLogger.Error("Failed to parse retranscribe message",
+						"error", err,
+						"rawMessage", string(message))
+					continue
+				}
+
+				var rejection string
+				switch {
+				case retainedAudio == nil:
+					rejection = "Re-transcription requires ENABLE_RETRANSCRIPTION and LINEAR16 or MULAW audio"
+				case retranscribeMsg.StartMs < 0 || retranscribeMsg.EndMs <= retranscribeMsg.StartMs:
+					rejection = "startMs must not be negative and endMs must be after startMs"
+				case retranscribeMsg.EndMs-retranscribeMsg.StartMs > maxRetranscriptionRange.Milliseconds():
+					rejection = fmt.Sprintf("Re-transcribed ranges are limited to %s", maxRetranscriptionRange)
+				}
+				if rejection != "" {
+					if err := sendJSON(StatusResponse{Type: "status", Status: "retranscription_error", Message: rejection, Timestamp: session.Timestamp(time.Now())}); err != nil {
+						sessionLogger.Error("Failed to send retranscription error to client", "error", err)
+					}
+					continue
+				}
+				go retranscribeRange(retranscribeMsg)
+
+			case "focus_transcript":
+				// Summarize only the recent transcript, leaving the running summary untouched
+				var focusMsg FocusTranscriptMessage
+				if err := json.Unmarshal(message, &focusMsg); err != nil {
+					sessionLogger.Error("Failed to parse focus transcript message",
+						"error", err,
+						"rawMessage", string(message))
+					continue
+				}
+
+				focusStatus := func(status, text string) {
+					if err := sendJSON(StatusResponse{Type: "status", Status: status, Message: text, Timestamp: session.Timestamp(time.Now())}); err != nil {
+						sessionLogger.Error("Failed to send focus transcript status", "error", err)
+					}
+				}
+				if focusMsg.LastSeconds <= 0 {
+					focusStatus("focused_summary_error", "lastSeconds must be positive")
+					continue
+				}
+				if projectID == "" || location == "" || session.GenAIBudgetExhausted() {
+					focusStatus("focused_summary_error", "Summary generation is not available")
+					continue
+				}
+				focusedTranscript := session.Segments().WindowedTranscript(time.Now().Add(-time.Duration(focusMsg.LastSeconds) * time.Second))
+				if strings.TrimSpace(focusedTranscript) == "" {
+					focusStatus("focused_summary_error", "No transcript in the requested window")
+					continue
+				}
+				focusPrompt := focusMsg.CustomPrompt
+				if focusPrompt == "" {
+					focusPrompt = summaryPrompt
+				}
+
+				// Like running summaries, a focused summary is refused rather than queued when every slot is taken
+				release, ok := tryAcquireSlot(summarySemaphore)
+				if !ok {
+					sessionLogger.Debug("Focused summary refused, too many summaries in progress",
+						"maxConcurrentSummaries", cap(summarySemaphore))
+					focusStatus("focused_summary_error", "Summary generation is busy, try again once the previous summaries are done")
+					continue
+				}
+
+				session.recordEvent("focused_summary_requested", map[string]interface{}{"lastSeconds": focusMsg.LastSeconds})
+				go func() {
+					defer release()
+
+					result, err := generateSummary(ctx, projectID, location, geminiModel, focusedTranscript, "", "", focusPrompt, customWords, nil, summaryOptions)
+					if err != nil {
+						sessionLogger.Error("Error generating focused summary", "error", err)
+						focusStatus("focused_summary_error", "Failed to generate the focused summary")
+						return
+					}
+					cloudAudit("summary.generate", map[string]interface{}{"kind": "focused", "tokens": result.TotalTokens()})
+					if err := sendJSON(FocusedSummaryResponse{
+						Type:        "focused_summary",
+						LastSeconds: focusMsg.LastSeconds,
+						Text:        chargeGenAITokens(result),
+						Timestamp:   session.Timestamp(time.Now()),
+						JSON:        summaryFormat == summaryFormatJSON,
+					}); err != nil {
+						sessionLogger.Error("Failed to send focused summary to client", "error", err)
+					}
+				}()
+			case "correction":
+				// Handle transcript correction pushed by a human reviewer
+				correctionMsg := CorrectionMessage{Timestamp: session.Timestamp(time.Time{})}
+				if err := json.Unmarshal(message, &correctionMsg); err != nil {
+					sessionLogger.Error("Failed to parse correction message",
+						"error", err,
+						"rawMessage", string(message))
+					continue
+				}
+
+				replacedCount, correctedSegments := session.correctTranscript(correctionMsg.OriginalText, correctionMsg.CorrectedText)
+				for _, segment := range correctedSegments {
+					if err := appendTranscriptRecord(session.ID, TranscriptRecord{Type: "corrected", Timestamp: time.Now(), Segment: &segment}); err != nil {
+						sessionLogger.Error("Failed to persist corrected segment", "error", err)
+					}
+				}
+				correctionDiff := generateDiff(correctionMsg.OriginalText, correctionMsg.CorrectedText)
+				session.recordEvent("correction", map[string]interface{}{
+					"originalText":  correctionMsg.OriginalText,
+					"correctedText": correctionMsg.CorrectedText,
+					"replacedCount": replacedCount,
+					"diff":          correctionDiff,
+				})
+
+				// Audit trail for every correction attempt
+				sessionLogger.Info("Transcript correction received",
+					"originalText", correctionMsg.OriginalText,
+					"correctedText", correctionMsg.CorrectedText,
+					"replacedCount", replacedCount,
+					"clientTimestamp", correctionMsg.Timestamp.Time,
+					"serverTimestamp", time.Now())
+
+				statusResponse := StatusResponse{
+					Type:          "status",
+					Status:        "correction_applied",
+					Message:       "Correction applied to transcript",
+					Timestamp:     session.Timestamp(time.Now()),
+					ReplacedCount: replacedCount,
+					Diff:          correctionDiff,
+				}
+				if replacedCount == 0 {
+					statusResponse.Status = "correction_not_found"
+					statusResponse.Message = "Original text not found in transcript"
+					statusResponse.Diff = nil
+				}
+				if err := sendJSON(statusResponse); err != nil {
+					sessionLogger.Error("Failed to send correction status to client", "error", err)
 				}
 			case "keywords":
 				// Handle keywords message (dynamic keyword updates during recording)
-				logger.Info("Dynamic keywords update received",
+				sessionLogger.Info("Dynamic keywords update received",
 					"rawMessage", string(message))
 
-				var keywordsMsg KeywordsMessage
+				keywordsMsg := KeywordsMessage{Timestamp: session.Timestamp(time.Time{})}
 				if err := json.Unmarshal(message, &keywordsMsg); err != nil {
-					logger.Error("Failed to parse keywords message",
+					sessionLogger.Error("Failed to parse keywords message",
 						"error", err,
 						"rawMessage", string(message),
 						"messageLength", len(message))
 					continue
 				}
 
-				logger.Info("Dynamic keywords processed successfully",
+				sessionLogger.Info("Dynamic keywords processed successfully",
 					"words", keywordsMsg.Words,
 					"wordCount", len(keywordsMsg.Words),
-					"clientTimestamp", keywordsMsg.Timestamp,
+					"clientTimestamp", keywordsMsg.Timestamp.Time,
 					"serverTimestamp", time.Now(),
-					"timeDelta", time.Since(keywordsMsg.Timestamp))
+					"timeDelta", time.Since(keywordsMsg.Timestamp.Time))
 
 				// Log each individual keyword for detailed tracking
 				for i, word := range keywordsMsg.Words {
 					trimmedWord := strings.TrimSpace(word)
-					logger.Info("Dynamic keyword detail",
+					sessionLogger.Info("Dynamic keyword detail",
 						"index", i+1,
 						"originalWord", word,
 						"trimmedWord", trimmedWord,
@@ -845,69 +2941,181 @@ If this is an update to an existing summary, maintain the structure and content
 				}
 
 				// Update dynamic keywords and recreate stream with new SpeechContexts
-				keywordsMu.Lock()
 				// Add new keywords to existing dynamic keywords (avoiding duplicates)
-				existingKeywords := make(map[string]bool)
-				for _, existing := range dynamicKeywords {
-					existingKeywords[strings.ToLower(strings.TrimSpace(existing))] = true
-				}
-
-				var newKeywordsToAdd []string
-				for _, newKeyword := range keywordsMsg.Words {
-					trimmed := strings.TrimSpace(newKeyword)
-					if trimmed != "" && !existingKeywords[strings.ToLower(trimmed)] {
-						newKeywordsToAdd = append(newKeywordsToAdd, trimmed)
-						dynamicKeywords = append(dynamicKeywords, trimmed)
-						existingKeywords[strings.ToLower(trimmed)] = true
-					}
-				}
+				newKeywordsToAdd := sessionState.AddKeywords(keywordsMsg.Words)
+				dynamicKeywords := sessionState.Keywords()
 
-				logger.Info("Dynamic keywords update processed",
+				sessionLogger.Info("Dynamic keywords update processed",
 					"newKeywordsAdded", len(newKeywordsToAdd),
 					"totalDynamicKeywords", len(dynamicKeywords),
 					"newKeywords", newKeywordsToAdd,
 					"allDynamicKeywords", dynamicKeywords)
 
 				// Create updated speech contexts combining original + dynamic keywords
-				updatedContexts := createDynamicSpeechContexts(currentSpeechContexts, dynamicKeywords)
-				keywordsMu.Unlock()
+				updatedContexts := createDynamicSpeechContexts(sessionState)
+				session.addKeywords(newKeywordsToAdd, time.Now())
+				if keywordDecayRate > 0 {
+					updatedContexts = nil // openStream adds the keywords with their decayed boosts
+				}
 
 				// Recreate stream with updated contexts if we have new keywords
 				if len(newKeywordsToAdd) > 0 {
-					logger.Info("Recreating Speech-to-Text stream with dynamic keywords",
+					session.recordEvent("keywords_updated", map[string]interface{}{"newKeywords": newKeywordsToAdd})
+					cloudAudit("keywords.update", map[string]interface{}{"newKeywords": newKeywordsToAdd})
+					sessionLogger.Info("Recreating Speech-to-Text stream with dynamic keywords",
 						"newKeywordsCount", len(newKeywordsToAdd),
 						"totalDynamicKeywords", len(dynamicKeywords),
 						"updatedContextsCount", len(updatedContexts))
 
-					if err := createStream(updatedContexts); err != nil {
-						logger.Error("Failed to recreate stream with dynamic keywords",
+					if err := recreateStreams(updatedContexts); err != nil {
+						sessionLogger.Error("Failed to recreate stream with dynamic keywords",
 							"error", err,
 							"newKeywords", newKeywordsToAdd)
 					} else {
-						logger.Info("Stream successfully recreated with dynamic keywords",
+						sessionLogger.Info("Stream successfully recreated with dynamic keywords",
 							"appliedKeywords", newKeywordsToAdd,
 							"totalKeywords", len(dynamicKeywords))
 					}
 				} else {
-					logger.Info("No new keywords to apply - all keywords already exist",
+					sessionLogger.Info("No new keywords to apply - all keywords already exist",
 						"duplicateKeywords", keywordsMsg.Words,
 						"existingDynamicKeywords", dynamicKeywords)
 				}
 			default:
-				logger.Debug("Received unknown message type", "type", baseMessage.Type, "message", string(message))
+				sessionLogger.Debug("Received unknown message type", "type", baseMessage.Type, "message", string(message))
 			}
 		}
 	}
 
+	// Sessions that ended without an end prompt are re-transcribed in the background so teardown never waits on it
+	go reprocessWithBatch(takeShortAudio(), firstAudioAt, time.Now())
+
+	// Report which speech context phrases never matched so operators can prune their hints
+	contextPhrases := sessionState.ContextPhrases()
+	if len(contextPhrases) > 0 {
+		report := buildContextFeedbackReport(session.Transcript(), contextPhrases)
+		for _, phrase := range report.UnmatchedPhrases {
+			sessionLogger.Warn("Speech context phrase never matched", "phrase", phrase)
+		}
+		sessionLogger.Info("Speech context feedback",
+			"matchedPhrases", len(report.MatchedPhrases),
+			"unmatchedPhrases", len(report.UnmatchedPhrases),
+			"hitRate", report.HitRate)
+		if err := appendTranscriptRecord(session.ID, TranscriptRecord{Type: "context_feedback", Timestamp: time.Now(), ContextFeedback: &report}); err != nil {
+			sessionLogger.Error("Failed to persist context feedback", "error", err)
+		}
+		// The client may already have closed the connection, in which case the report is only logged
+		if err := sendJSON(report); err != nil {
+			sessionLogger.Debug("Context feedback not delivered to client", "error", err)
+		}
+	}
+
 	// Close the Speech-to-Text stream when the WebSocket connection closes
 	streamMu.Lock()
 	if stream != nil {
-		logger.Info("Closing Speech-to-Text stream due to WebSocket closure")
+		sessionLogger.Info("Closing Speech-to-Text stream due to WebSocket closure")
 		stream.CloseSend()
 	}
 	streamMu.Unlock()
+	for language, languageStream := range session.allLanguageStreams() {
+		sessionLogger.Info("Closing language track stream due to WebSocket closure", "language", language)
+		languageStream.CloseSend()
+	}
+
+	// Persist the final session metadata
+	metadata := session.Metadata()
+	endedAt := time.Now()
+	metadata.EndedAt = &endedAt
+	if err := writeSessionMetadata(metadata); err != nil {
+		sessionLogger.Error("Failed to persist session metadata", "error", err)
+	}
+	if err := storageBackend.Flush(session.ID); err != nil {
+		sessionLogger.Error("Failed to flush session transcript", "error", err)
+	}
+	session.recordEvent("session_ended", map[string]interface{}{"segmentCount": metadata.SegmentCount})
+	cloudAudit("stop", map[string]interface{}{"segmentCount": metadata.SegmentCount})
 
 	// Ensure context is cancelled to stop all related goroutines
 	cancel()
-	logger.Info("WebSocket connection and Speech-to-Text stream closed")
-}
\ No newline at end of file
+	sessionLogger.Info("WebSocket connection and Speech-to-Text stream closed")
+}
+
+// handleReplay replays a persisted session over a WebSocket as if it were live
+func handleReplay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sessionID := r.PathValue("sessionID")
+	if !isValidSessionID(sessionID) {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+	if !persistedTranscriptExists(sessionID) {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	speed := 1.0
+	if value := r.URL.Query().Get("speed"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < 0 {
+			http.Error(w, "Invalid speed parameter", http.StatusBadRequest)
+			return
+		}
+		speed = parsed
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logger.Error("WebSocket upgrade failed", "error", err)
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	// Stop replaying as soon as the client goes away
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				cancel()
+				return
+			}
+		}
+	}()
+
+	logger.Info("Replaying session", "sessionID", sessionID, "speed", speed)
+
+	var mu sync.Mutex
+	send := func(v interface{}) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("failed to marshal replay message: %v", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return conn.WriteMessage(websocket.TextMessage, data)
+	}
+
+	if err := ReplaySession(ctx, sessionID, speed, send); err != nil {
+		if ctx.Err() == nil {
+			logger.Error("Session replay failed", "sessionID", sessionID, "error", err)
+		}
+		return
+	}
+
+	if err := send(StatusResponse{
+		Type:      "status",
+		Status:    "replay_complete",
+		Message:   "Session replay complete",
+		Timestamp: Timestamp{Time: time.Now()},
+		SessionID: sessionID,
+	}); err != nil {
+		logger.Error("Failed to send replay complete status", "error", err)
+	}
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	logger.Info("Session replay complete", "sessionID", sessionID)
+}
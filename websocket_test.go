@@ -0,0 +1,1368 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	speech "cloud.google.com/go/speech/apiv1"
+	"github.com/gorilla/websocket"
+	"google.golang.org/api/option"
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestIsTransientWriteError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"write deadline", os.ErrDeadlineExceeded, true},
+		{"wrapped write deadline", fmt.Errorf("write: %w", os.ErrDeadlineExceeded), true},
+		{"close frame sent", websocket.ErrCloseSent, false},
+		{"closed connection", net.ErrClosed, false},
+		{"broken pipe", &net.OpError{Op: "write", Net: "tcp", Err: syscall.EPIPE}, false},
+		{"other error", errors.New("failed"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransientWriteError(tt.err); got != tt.want {
+				t.Errorf("isTransientWriteError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// flakyConn is a mock client connection whose first failures writes fail with err
+type flakyConn struct {
+	mu       sync.Mutex
+	failures int
+	err      error
+	writes   int
+}
+
+func (c *flakyConn) send(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writes++
+	if c.writes <= c.failures {
+		return c.err
+	}
+	return nil
+}
+
+func TestSummaryRetrier(t *testing.T) {
+	tests := []struct {
+		name          string
+		failures      int
+		err           error
+		superseded    bool
+		wantWrites    int
+		wantDelivered bool
+	}{
+		{"fails twice then delivered", 2, os.ErrDeadlineExceeded, false, 3, true},
+		{"retries exhausted", 10, os.ErrDeadlineExceeded, false, 4, false},
+		{"closed connection not retried", 10, net.ErrClosed, false, 1, false},
+		{"superseded by a newer summary", 10, os.ErrDeadlineExceeded, true, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useStorageBackend(t, LocalStorage{}, t.TempDir())
+			session := newSession(func() {}, ConfigMessage{})
+			conn := &flakyConn{failures: tt.failures, err: tt.err}
+			retrier := newSummaryRetrier(session, conn.send, time.Millisecond, 3, logger)
+			summary := &SummaryResponse{Type: "summary", Text: "Budget approved.", SummaryID: 1}
+
+			// The first write is the regular send that failed
+			if err := conn.send(summary); err != nil {
+				retrier.Queue(summary, err)
+			}
+			if tt.superseded {
+				session.markSummaryDelivered(2)
+			}
+			// One pass of the loop in Run
+			select {
+			case queued := <-retrier.queue:
+				if !retrier.retry(context.Background(), queued) {
+					retrier.persist(queued)
+				}
+			default:
+			}
+
+			if conn.writes != tt.wantWrites {
+				t.Errorf("%d writes, want %d", conn.writes, tt.wantWrites)
+			}
+			if delivered := session.summarySuperseded(0); tt.wantDelivered && !tt.superseded && !delivered {
+				t.Error("summary not marked as delivered")
+			}
+			persisted, err := storageBackend.ReadSessionSummary(session.ID)
+			if tt.wantDelivered && err == nil {
+				t.Errorf("delivered summary persisted as %q", persisted)
+			}
+			if !tt.wantDelivered && persisted != summary.Text {
+				t.Errorf("persisted summary = %q, %v, want %q", persisted, err, summary.Text)
+			}
+		})
+	}
+}
+
+func TestSummaryRetrierPersistsOnClose(t *testing.T) {
+	useStorageBackend(t, LocalStorage{}, t.TempDir())
+	session := newSession(func() {}, ConfigMessage{})
+	conn := &flakyConn{failures: 1, err: os.ErrDeadlineExceeded}
+	retrier := newSummaryRetrier(session, conn.send, time.Hour, 3, logger)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	retrier.Queue(&SummaryResponse{Type: "summary", Text: "Budget approved.", SummaryID: 1}, os.ErrDeadlineExceeded)
+	retrier.Run(ctx)
+
+	if persisted, err := storageBackend.ReadSessionSummary(session.ID); persisted != "Budget approved." {
+		t.Errorf("persisted summary = %q, %v, want the queued summary", persisted, err)
+	}
+	if conn.writes != 0 {
+		t.Errorf("%d writes after the connection closed, want 0", conn.writes)
+	}
+}
+
+// fakeSpeech is an in-process Speech-to-Text server recording the audio it receives.
+// When final is set, the first audio chunk of each stream is answered with a final result holding it,
+// or every chunk when everyChunk is set; recognized is returned by Recognize. onStream, when set, is called with the
+// number of each new stream (from 1) before it is served, and can hold the stream back or fail it.
+type fakeSpeech struct {
+	speechpb.UnimplementedSpeechServer
+
+	mu         sync.Mutex
+	streams    int
+	ended      []int // Numbers of the streams that ended, in order
+	keepalives int   // Empty audio chunks received
+	onStream   func(stream int) error
+	audio      [][]byte
+	final      string
+	interims   []string // Interim results sent before each final
+	everyChunk bool
+	recognized string
+	recognizes int // Recognize calls received
+}
+
+func (f *fakeSpeech) StreamingRecognize(stream speechpb.Speech_StreamingRecognizeServer) error {
+	f.mu.Lock()
+	f.streams++
+	number, onStream := f.streams, f.onStream
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.ended = append(f.ended, number)
+		f.mu.Unlock()
+	}()
+	if onStream != nil {
+		if err := onStream(number); err != nil {
+			return err
+		}
+	}
+
+	answered := false
+	for {
+		req, err := stream.Recv()
+		if err != nil {
+			return nil
+		}
+		audio := req.GetAudioContent()
+		if len(audio) == 0 {
+			if req.GetStreamingConfig() == nil {
+				f.mu.Lock()
+				f.keepalives++
+				f.mu.Unlock()
+			}
+			continue
+		}
+		f.mu.Lock()
+		f.audio = append(f.audio, audio)
+		final, interims, everyChunk := f.final, f.interims, f.everyChunk
+		f.mu.Unlock()
+		if final == "" || (answered && !everyChunk) {
+			continue
+		}
+		answered = true
+		for _, interim := range interims {
+			if err := stream.Send(&speechpb.StreamingRecognizeResponse{
+				Results: []*speechpb.StreamingRecognitionResult{{
+					Alternatives: []*speechpb.SpeechRecognitionAlternative{{Transcript: interim}},
+				}},
+			}); err != nil {
+				return err
+			}
+		}
+		if err := stream.Send(&speechpb.StreamingRecognizeResponse{
+			Results: []*speechpb.StreamingRecognitionResult{{
+				IsFinal: true,
+				Alternatives: []*speechpb.SpeechRecognitionAlternative{{
+					Transcript: final,
+					Confidence: 0.9,
+					Words:      fakeWordTimings(final),
+				}},
+			}},
+		}); err != nil {
+			return err
+		}
+	}
+}
+
+func (f *fakeSpeech) Recognize(ctx context.Context, req *speechpb.RecognizeRequest) (*speechpb.RecognizeResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.recognizes++
+	return &speechpb.RecognizeResponse{
+		Results: []*speechpb.SpeechRecognitionResult{{
+			Alternatives: []*speechpb.SpeechRecognitionAlternative{{Transcript: f.recognized}},
+		}},
+	}, nil
+}
+
+// recognizeCalls returns the number of Recognize calls received
+func (f *fakeSpeech) recognizeCalls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.recognizes
+}
+
+// setResults configures the streaming final result and the Recognize transcript
+func (f *fakeSpeech) setResults(final, recognized string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.final, f.recognized = final, recognized
+}
+
+// setInterims configures the interim results sent before each streaming final result
+func (f *fakeSpeech) setInterims(interims ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.interims = interims
+}
+
+// keepalivesReceived returns the number of empty audio chunks received so far
+func (f *fakeSpeech) keepalivesReceived() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.keepalives
+}
+
+// streamCount returns the number of streams opened so far
+func (f *fakeSpeech) streamCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.streams
+}
+
+// streamEnded reports whether the stream with the given number has ended
+func (f *fakeSpeech) streamEnded(number int) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Contains(f.ended, number)
+}
+
+// setOnStream installs the function called as each new stream starts
+func (f *fakeSpeech) setOnStream(onStream func(stream int) error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.onStream = onStream
+}
+
+// answerEveryChunk makes every audio chunk produce a final result
+func (f *fakeSpeech) answerEveryChunk() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.everyChunk = true
+}
+
+// fakeWordTimings spreads the words of a transcript over the first second of the stream
+func fakeWordTimings(transcript string) []*speechpb.WordInfo {
+	words := strings.Fields(transcript)
+	var infos []*speechpb.WordInfo
+	for i, word := range words {
+		infos = append(infos, &speechpb.WordInfo{
+			Word:      word,
+			StartTime: durationpb.New(time.Duration(i) * time.Second / time.Duration(len(words))),
+			EndTime:   durationpb.New(time.Duration(i+1) * time.Second / time.Duration(len(words))),
+		})
+	}
+	return infos
+}
+
+// audioChunks returns the number of non-empty audio chunks received so far
+func (f *fakeSpeech) audioChunks() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.audio)
+}
+
+// newFakeSpeechPool starts a fakeSpeech server and installs a client pool pointing at it
+func newFakeSpeechPool(t *testing.T) *fakeSpeech {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeSpeech{}
+	server := grpc.NewServer()
+	speechpb.RegisterSpeechServer(server, fake)
+	go server.Serve(lis)
+
+	client, err := speech.NewClient(context.Background(),
+		option.WithEndpoint(lis.Addr().String()),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := speechClientPool
+	speechClientPool = &SpeechClientPool{clients: []*speech.Client{client}}
+	t.Cleanup(func() {
+		speechClientPool = previous
+		client.Close()
+		server.Stop()
+	})
+	return fake
+}
+
+// dialWebSocket serves handleWebSocket and opens a client connection with header.
+// Cleanup closes the connection and waits for the handler to return, so that sessions
+// do not outlive their test and race with the globals the next test sets.
+func dialWebSocket(t *testing.T, header http.Header) *websocket.Conn {
+	t.Helper()
+	var handlers sync.WaitGroup
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.Add(1)
+		defer handlers.Done()
+		handleWebSocket(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		handlers.Wait()
+	})
+	return conn
+}
+
+// dialTestSession opens a client connection to handleWebSocket and sends config
+func dialTestSession(t *testing.T, config ConfigMessage) *websocket.Conn {
+	t.Helper()
+	conn := dialWebSocket(t, nil)
+	if err := conn.WriteJSON(config); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// readUntil reads messages until one has the given type and, when status is set, that status
+func readUntil(t *testing.T, conn *websocket.Conn, messageType, status string) map[string]interface{} {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	defer conn.SetReadDeadline(time.Time{})
+	for {
+		var message map[string]interface{}
+		if err := conn.ReadJSON(&message); err != nil {
+			t.Fatalf("waiting for %s %s: %v", messageType, status, err)
+		}
+		if message["type"] == messageType && (status == "" || message["status"] == status) {
+			return message
+		}
+	}
+}
+
+// waitFor polls cond until it holds or the deadline passes
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestBatchReprocessing(t *testing.T) {
+	tests := []struct {
+		name           string
+		threshold      string
+		slotsTaken     bool
+		wantRecognizes int
+	}{
+		{"disabled by default", "", false, 0},
+		{"enabled", "60", false, 1},
+		{"every slot taken", "60", true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.threshold != "" {
+				t.Setenv("BATCH_THRESHOLD_SECONDS", tt.threshold)
+			}
+			previous := batchRecognitionSlots
+			batchRecognitionSlots = make(chan struct{}, 1)
+			if tt.slotsTaken {
+				batchRecognitionSlots <- struct{}{}
+			}
+			t.Cleanup(func() { batchRecognitionSlots = previous })
+			fake := newFakeSpeechPool(t)
+			fake.setResults("streamed text", "batch text")
+			conn := dialTestSession(t, ConfigMessage{
+				AudioFormat:  AudioFormat{Format: "LINEAR16", SampleRate: 16000, Channels: 1},
+				LanguageCode: "en-US",
+			})
+			sessionID := readUntil(t, conn, "status", "session_started")["sessionID"].(string)
+			if err := conn.WriteMessage(websocket.BinaryMessage, make([]byte, 3200)); err != nil {
+				t.Fatal(err)
+			}
+			readUntil(t, conn, "transcription", "")
+
+			// The session ends without an end prompt, so it is re-transcribed at teardown
+			conn.Close()
+			waitFor(t, "session teardown", func() bool {
+				_, ok := sessionRegistry.Get(sessionID)
+				return !ok
+			})
+			if tt.wantRecognizes > 0 {
+				waitFor(t, "batch re-transcription", func() bool { return fake.recognizeCalls() >= tt.wantRecognizes })
+			}
+			if got := fake.recognizeCalls(); got != tt.wantRecognizes {
+				t.Errorf("%d Recognize calls, want %d", got, tt.wantRecognizes)
+			}
+		})
+	}
+}
+
+func TestStaleSessionDisconnected(t *testing.T) {
+	newFakeSpeechPool(t)
+	conn := dialTestSession(t, ConfigMessage{
+		AudioFormat:  AudioFormat{Format: "LINEAR16", SampleRate: 16000, Channels: 1},
+		LanguageCode: "en-US",
+	})
+	started := readUntil(t, conn, "status", "session_started")
+	session, ok := sessionRegistry.Get(started["sessionID"].(string))
+	if !ok {
+		t.Fatal("session not registered")
+	}
+	session.mu.Lock()
+	session.lastHeartbeat = time.Now().Add(-time.Hour)
+	session.mu.Unlock()
+
+	if removed := sessionRegistry.removeStale(30 * time.Minute); removed != 1 {
+		t.Fatalf("removeStale() = %d, want 1", removed)
+	}
+	// The handler returning closes the connection, well before the client gives up on reading
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				t.Fatal("connection still open after the session was removed as stale")
+			}
+			break
+		}
+	}
+}
+
+func TestConsentFlow(t *testing.T) {
+	tests := []struct {
+		name     string
+		accepted bool
+	}{
+		{"accepted", true},
+		{"declined", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("TRANSCRIPT_DIR", dir)
+			fake := newFakeSpeechPool(t)
+			conn := dialTestSession(t, ConfigMessage{
+				AudioFormat:     AudioFormat{Format: "LINEAR16", SampleRate: 16000, Channels: 1},
+				LanguageCode:    "en-US",
+				ConsentRequired: true,
+				EmbedWatermark:  true,
+			})
+			started := readUntil(t, conn, "status", "session_started")
+			session, ok := sessionRegistry.Get(started["sessionID"].(string))
+			if !ok {
+				t.Fatal("session not registered")
+			}
+			// Dropped audio must not be watermarked, so the log only covers the audio that was forwarded
+			watermarks := func() int {
+				log, _ := os.ReadFile(sessionFilePath(dir, session.ID, ".watermark.jsonl"))
+				return strings.Count(string(log), "\n")
+			}
+			readUntil(t, conn, "consent_notice", "")
+
+			// Audio sent before the acknowledgement is dropped
+			if err := conn.WriteMessage(websocket.BinaryMessage, make([]byte, 320)); err != nil {
+				t.Fatal(err)
+			}
+			if err := conn.WriteJSON(ConsentAckMessage{Type: "consent_ack", Accepted: tt.accepted}); err != nil {
+				t.Fatal(err)
+			}
+
+			if !tt.accepted {
+				readUntil(t, conn, "status", "session_declined")
+				conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+				for {
+					if _, _, err := conn.ReadMessage(); err != nil {
+						if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+							t.Fatalf("read error = %v, want normal closure", err)
+						}
+						break
+					}
+				}
+				if session.Info().ConsentTimestamp != nil {
+					t.Error("declined consent recorded a consent timestamp")
+				}
+				if got := fake.audioChunks(); got != 0 {
+					t.Errorf("forwarded %d audio chunks, want 0", got)
+				}
+				if got := watermarks(); got != 0 {
+					t.Errorf("watermarked %d audio chunks, want 0", got)
+				}
+				return
+			}
+
+			if err := conn.WriteMessage(websocket.BinaryMessage, make([]byte, 320)); err != nil {
+				t.Fatal(err)
+			}
+			waitFor(t, "forwarded audio", func() bool { return fake.audioChunks() > 0 })
+			if got := fake.audioChunks(); got != 1 {
+				t.Errorf("forwarded %d audio chunks, want 1", got)
+			}
+			if got := watermarks(); got != 1 {
+				t.Errorf("watermarked %d audio chunks, want 1", got)
+			}
+			if session.Info().ConsentTimestamp == nil {
+				t.Error("accepted consent did not record a consent timestamp")
+			}
+		})
+	}
+}
+
+func TestTextMessageRateLimit(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxViolations string
+		messages      int
+		wantLimited   int
+		wantClosed    bool
+	}{
+		{"messages over the rate are ignored", "50", 4, 3, false},
+		{"consecutive violations close the connection", "3", 4, 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEXT_MSG_RATE", "1")
+			t.Setenv("TEXT_MSG_CONSECUTIVE_VIOLATIONS", tt.maxViolations)
+			newFakeSpeechPool(t)
+			conn := dialTestSession(t, ConfigMessage{AudioFormat: AudioFormat{Format: "LINEAR16", SampleRate: 16000, Channels: 1}})
+			readUntil(t, conn, "status", "session_started")
+
+			for i := 0; i < tt.messages; i++ {
+				if err := conn.WriteJSON(map[string]string{"type": "activity_ping"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			limited := 0
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			for {
+				var message StatusResponse
+				err := conn.ReadJSON(&message)
+				if err != nil {
+					var netErr net.Error
+					switch {
+					case tt.wantClosed && !websocket.IsCloseError(err, websocket.ClosePolicyViolation):
+						t.Errorf("read error = %v, want policy violation close", err)
+					case !tt.wantClosed && !(errors.As(err, &netErr) && netErr.Timeout()):
+						t.Errorf("read error = %v, want the connection to stay open", err)
+					}
+					break
+				}
+				if message.Status != "rate_limited" {
+					continue
+				}
+				limited++
+				if message.RetryAfterMs <= 0 {
+					t.Errorf("retryAfterMs = %d, want a positive hint", message.RetryAfterMs)
+				}
+			}
+			if limited != tt.wantLimited {
+				t.Errorf("got %d rate_limited statuses, want %d", limited, tt.wantLimited)
+			}
+		})
+	}
+}
+
+func TestGeminiModelOverride(t *testing.T) {
+	tests := []struct {
+		name       string
+		model      string
+		wantStatus string
+	}{
+		{"allowed model", "gemini-2.5-pro", "session_started"},
+		{"disallowed model", "gemini-1.0-ultra", "config_error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GEMINI_ALLOWED_MODELS", "")
+			newFakeSpeechPool(t)
+			conn := dialTestSession(t, ConfigMessage{GeminiModel: tt.model})
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			var message StatusResponse
+			if err := conn.ReadJSON(&message); err != nil {
+				t.Fatal(err)
+			}
+			if message.Status != tt.wantStatus {
+				t.Errorf("status = %q (%s), want %q", message.Status, message.Message, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestAutoDetectLanguageRejected(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     ConfigMessage
+		wantStatus string
+	}{
+		{"configured language", ConfigMessage{LanguageCode: "fr-FR", Model: autoDetectLanguageModel}, "session_started"},
+		{"auto detection", ConfigMessage{LanguageCode: "fr-FR", Model: autoDetectLanguageModel, AutoDetectLanguage: true}, "config_error"},
+		{"auto language code", ConfigMessage{LanguageCode: "auto"}, "config_error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newFakeSpeechPool(t)
+			conn := dialTestSession(t, tt.config)
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			var message StatusResponse
+			if err := conn.ReadJSON(&message); err != nil {
+				t.Fatal(err)
+			}
+			if message.Status != tt.wantStatus {
+				t.Errorf("status = %q (%s), want %q", message.Status, message.Message, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestConfigMessageTimeout(t *testing.T) {
+	t.Setenv("CONFIG_TIMEOUT_SECONDS", "1")
+
+	t.Run("no config message", func(t *testing.T) {
+		conn := dialWebSocket(t, nil)
+		start := time.Now()
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var status StatusResponse
+		if err := conn.ReadJSON(&status); err != nil {
+			t.Fatal(err)
+		}
+		if status.Status != "config_timeout" {
+			t.Errorf("status = %q, want config_timeout", status.Status)
+		}
+		if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+			t.Errorf("timed out after %s, want about 1s", elapsed)
+		}
+		if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+			t.Errorf("read error = %v, want a policy violation close", err)
+		}
+	})
+
+	t.Run("deadline cleared after the config message", func(t *testing.T) {
+		newFakeSpeechPool(t)
+		conn := dialTestSession(t, ConfigMessage{AudioFormat: AudioFormat{Format: "LINEAR16", SampleRate: 16000, Channels: 1}})
+		readUntil(t, conn, "status", "session_started")
+
+		// An idle but configured session outlives the config timeout
+		conn.SetReadDeadline(time.Now().Add(1500 * time.Millisecond))
+		for {
+			_, _, err := conn.ReadMessage()
+			if err == nil {
+				continue
+			}
+			var netErr net.Error
+			if !errors.As(err, &netErr) || !netErr.Timeout() {
+				t.Errorf("read error = %v, want the session to stay open", err)
+			}
+			break
+		}
+	})
+}
+
+func TestMaxSessionDuration(t *testing.T) {
+	previous := sessionDurationUnit
+	sessionDurationUnit = 100 * time.Millisecond
+	t.Cleanup(func() { sessionDurationUnit = previous })
+	t.Setenv("MAX_SESSION_DURATION_MINUTES", "")
+
+	newFakeSpeechPool(t)
+	start := time.Now()
+	conn := dialTestSession(t, ConfigMessage{
+		AudioFormat:               AudioFormat{Format: "LINEAR16", SampleRate: 16000, Channels: 1},
+		LanguageCode:              "en-US",
+		MaxSessionDurationMinutes: 2,
+	})
+	readUntil(t, conn, "status", "session_max_duration_reached")
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Errorf("session ended after %s, want about 200ms", elapsed)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+			t.Errorf("read error = %v, want a going away (1001) close", err)
+		}
+		break
+	}
+}
+
+func TestStreamKeepalive(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval string
+		want     int // Keepalives expected within 300ms of silence
+	}{
+		{"sent at the interval", "50", 3},
+		{"disabled", "0", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("STREAM_KEEPALIVE_INTERVAL_MS", tt.interval)
+			fake := newFakeSpeechPool(t)
+			conn := dialTestSession(t, ConfigMessage{AudioFormat: AudioFormat{Format: "LINEAR16", SampleRate: 16000, Channels: 1}, LanguageCode: "en-US"})
+			started := readUntil(t, conn, "status", "session_started")
+			session, ok := sessionRegistry.Get(started["sessionID"].(string))
+			if !ok {
+				t.Fatal("session not registered")
+			}
+
+			if tt.want == 0 {
+				time.Sleep(300 * time.Millisecond)
+				if received, sent := fake.keepalivesReceived(), session.Info().KeepalivesSent; received != 0 || sent != 0 {
+					t.Errorf("%d keepalives received and %d sent, want none", received, sent)
+				}
+				return
+			}
+			start := time.Now()
+			waitFor(t, "the keepalives", func() bool {
+				return fake.keepalivesReceived() >= tt.want && session.Info().KeepalivesSent >= int64(tt.want)
+			})
+			// The first keepalive goes out one interval after the session started
+			if elapsed := time.Since(start); elapsed < time.Duration(tt.want-1)*50*time.Millisecond {
+				t.Errorf("%d keepalives after %s, want one every 50ms", tt.want, elapsed)
+			}
+		})
+	}
+}
+
+func TestRetranscribeSegment(t *testing.T) {
+	tests := []struct {
+		name        string
+		enabled     string
+		startMs     int64
+		endMs       int64
+		wantType    string
+		wantStatus  string
+		wantNewText string
+	}{
+		{"replaces the overlapping segment", "true", 0, 1000, "retranscription_result", "", "meet at ten"},
+		{"disabled", "false", 0, 1000, "status", "retranscription_error", ""},
+		{"empty range", "true", 500, 500, "status", "retranscription_error", ""},
+		{"range over the limit", "true", 0, maxRetranscriptionRange.Milliseconds() + 1, "status", "retranscription_error", ""},
+		{"no segment in range", "true", 60000, 61000, "status", "retranscription_error", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ENABLE_RETRANSCRIPTION", tt.enabled)
+			fake := newFakeSpeechPool(t)
+			fake.setResults("meet at noon", "meet at ten")
+			conn := dialTestSession(t, ConfigMessage{AudioFormat: AudioFormat{Format: "LINEAR16", SampleRate: 16000, Channels: 1}, LanguageCode: "en-US"})
+			readUntil(t, conn, "status", "session_started")
+
+			if err := conn.WriteMessage(websocket.BinaryMessage, make([]byte, 3200)); err != nil {
+				t.Fatal(err)
+			}
+			readUntil(t, conn, "transcription", "")
+
+			if err := conn.WriteJSON(RetranscribeMessage{Type: "retranscribe", StartMs: tt.startMs, EndMs: tt.endMs}); err != nil {
+				t.Fatal(err)
+			}
+			message := readUntil(t, conn, tt.wantType, tt.wantStatus)
+			if tt.wantNewText == "" {
+				return
+			}
+			if message["originalText"] != "meet at noon" || message["newText"] != tt.wantNewText {
+				t.Errorf("retranscription result = %v, want meet at noon replaced by %q", message, tt.wantNewText)
+			}
+		})
+	}
+}
+
+func TestMinInterimWords(t *testing.T) {
+	tests := []struct {
+		name            string
+		minInterimWords int
+		want            []string
+	}{
+		{"disabled", 0, []string{"so", "so the", "so the budget is", "so the budget is approved"}},
+		{"short interims suppressed", 3, []string{"so the budget is", "so the budget is approved"}},
+		{"final sent even when short", 10, []string{"so the budget is approved"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSpeechPool(t)
+			fake.setResults("so the budget is approved", "")
+			fake.setInterims("so", "so the", "so the budget is")
+			conn := dialTestSession(t, ConfigMessage{
+				AudioFormat:     AudioFormat{Format: "LINEAR16", SampleRate: 16000, Channels: 1},
+				LanguageCode:    "en-US",
+				MinInterimWords: tt.minInterimWords,
+			})
+			readUntil(t, conn, "status", "session_started")
+			if err := conn.WriteMessage(websocket.BinaryMessage, make([]byte, 3200)); err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for {
+				message := readUntil(t, conn, "transcription", "")
+				got = append(got, message["text"].(string))
+				if message["final"] == true {
+					break
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("transcriptions = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEndOfSpeechSilenceBoundary(t *testing.T) {
+	fake := newFakeSpeechPool(t)
+	fake.setResults("next topic", "")
+	fake.answerEveryChunk()
+	conn := dialTestSession(t, ConfigMessage{
+		AudioFormat:          AudioFormat{Format: "LINEAR16", SampleRate: 16000, Channels: 1},
+		LanguageCode:         "en-US",
+		EndOfSpeechSilenceMs: 200,
+	})
+	started := readUntil(t, conn, "status", "session_started")
+	session, ok := sessionRegistry.Get(started["sessionID"].(string))
+	if !ok {
+		t.Fatal("session not registered")
+	}
+
+	// Each chunk is answered with a final; the pause before the last one exceeds the silence timeout
+	for _, pause := range []time.Duration{0, 0, 400 * time.Millisecond} {
+		time.Sleep(pause)
+		if err := conn.WriteMessage(websocket.BinaryMessage, make([]byte, 320)); err != nil {
+			t.Fatal(err)
+		}
+		readUntil(t, conn, "transcription", "")
+	}
+
+	waitFor(t, "the third final", func() bool { return strings.Count(session.Transcript(), "next topic") == 3 })
+	if got := strings.Count(session.Transcript(), segmentBoundaryMarker); got != 1 {
+		t.Fatalf("transcript %q has %d boundaries, want 1", session.Transcript(), got)
+	}
+	if before, _, _ := strings.Cut(session.Transcript(), segmentBoundaryMarker); strings.Count(before, "next topic") != 2 {
+		t.Errorf("boundary in %q is not before the last final", session.Transcript())
+	}
+}
+
+// sendSilence sends d of silent 16 kHz mono LINEAR16 audio in 100ms chunks
+func sendSilence(t *testing.T, conn *websocket.Conn, d time.Duration) {
+	t.Helper()
+	for sent := time.Duration(0); sent < d; sent += 100 * time.Millisecond {
+		if err := conn.WriteMessage(websocket.BinaryMessage, make([]byte, 3200)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// nextInactivityStatus reads until an inactivity warning or a silence timeout arrives
+func nextInactivityStatus(t *testing.T, conn *websocket.Conn) map[string]interface{} {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	defer conn.SetReadDeadline(time.Time{})
+	for {
+		var message map[string]interface{}
+		if err := conn.ReadJSON(&message); err != nil {
+			t.Fatalf("waiting for an inactivity status: %v", err)
+		}
+		if message["status"] == "inactivity_warning" || message["status"] == "silence_timeout" {
+			return message
+		}
+	}
+}
+
+func TestStreamHandover(t *testing.T) {
+	tests := []struct {
+		name          string
+		keywords      [][]string
+		onStream      func(release chan struct{}) func(stream int) error
+		wantSeamless  int // stream_created events of completed handovers
+		wantRestarts  int // stream_created events of full restarts, including the first stream
+		wantRecreated bool
+	}{
+		{"handover completes", [][]string{{"Kubernetes"}}, nil, 1, 1, true},
+		{"failure falls back to a full restart", [][]string{{"Kubernetes"}}, func(chan struct{}) func(int) error {
+			return func(stream int) error {
+				if stream == 2 {
+					return status.Error(codes.Unavailable, "handover stream refused")
+				}
+				return nil
+			}
+		}, 0, 2, false},
+		{"superseded by a newer handover", [][]string{{"Kubernetes"}, {"Terraform"}}, func(release chan struct{}) func(int) error {
+			return func(stream int) error {
+				if stream == 2 {
+					<-release
+				}
+				return nil
+			}
+		}, 1, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSpeechPool(t)
+			fake.setResults("budget review", "")
+			conn := dialTestSession(t, ConfigMessage{
+				AudioFormat:              AudioFormat{Format: "LINEAR16", SampleRate: 16000, Channels: 1},
+				LanguageCode:             "en-US",
+				StreamRecreationStrategy: streamRecreationSeamless,
+			})
+			started := readUntil(t, conn, "status", "session_started")
+			session, ok := sessionRegistry.Get(started["sessionID"].(string))
+			if !ok {
+				t.Fatal("session not registered")
+			}
+			// The handover stream is primed with this audio and answers with a final
+			if err := conn.WriteMessage(websocket.BinaryMessage, make([]byte, 3200)); err != nil {
+				t.Fatal(err)
+			}
+			readUntil(t, conn, "transcription", "")
+
+			release := make(chan struct{})
+			defer func() {
+				select {
+				case <-release:
+				default:
+					close(release)
+				}
+			}()
+			if tt.onStream != nil {
+				fake.setOnStream(tt.onStream(release))
+			}
+			for i, words := range tt.keywords {
+				if err := conn.WriteJSON(KeywordsMessage{Type: "keywords", Words: words}); err != nil {
+					t.Fatal(err)
+				}
+				// Each handover stream reaches the server before the next one so their numbers follow the updates
+				waitFor(t, "the handover stream", func() bool { return fake.streamCount() >= i+2 })
+			}
+
+			streamEvents := func() (seamless, restarts int) {
+				for _, event := range session.EventLog() {
+					if event.EventType != "stream_created" {
+						continue
+					}
+					if event.Details["strategy"] == streamRecreationSeamless {
+						seamless++
+					} else {
+						restarts++
+					}
+				}
+				return seamless, restarts
+			}
+			waitFor(t, "the stream switch", func() bool {
+				seamless, restarts := streamEvents()
+				return seamless == tt.wantSeamless && restarts == tt.wantRestarts
+			})
+			if tt.wantRecreated {
+				readUntil(t, conn, "status", "stream_recreated")
+			}
+
+			if tt.onStream != nil && len(tt.keywords) > 1 {
+				// The superseded handover stream answers only now and must not replace the newer one
+				close(release)
+				waitFor(t, "the superseded stream to end", func() bool { return fake.streamEnded(2) })
+			}
+			// Audio keeps flowing to the stream that won
+			received := fake.audioChunks()
+			if err := conn.WriteMessage(websocket.BinaryMessage, make([]byte, 3200)); err != nil {
+				t.Fatal(err)
+			}
+			waitFor(t, "the audio to reach the active stream", func() bool { return fake.audioChunks() > received })
+			if seamless, restarts := streamEvents(); seamless != tt.wantSeamless || restarts != tt.wantRestarts {
+				t.Errorf("%d handovers and %d full restarts, want %d and %d", seamless, restarts, tt.wantSeamless, tt.wantRestarts)
+			}
+		})
+	}
+}
+
+func TestInactivityWarning(t *testing.T) {
+	tests := []struct {
+		name           string
+		warningSeconds int
+		ping           bool // An activity ping is sent after the first warning, followed by the same silence
+		silence        time.Duration
+		wantSeconds    float64 // secondsTillTimeout of the first warning
+		wantNext       string  // Status following the first warning
+	}{
+		{"warning then timeout", 1, false, 4 * time.Second, 1, "silence_timeout"},
+		{"default halves a shorter timeout", 0, false, 4 * time.Second, 2, "silence_timeout"},
+		{"activity ping restarts the count", 1, true, 3 * time.Second, 1, "inactivity_warning"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SILENCE_TIMEOUT_SECONDS", "4")
+			newFakeSpeechPool(t)
+			conn := dialTestSession(t, ConfigMessage{
+				AudioFormat:              AudioFormat{Format: "LINEAR16", SampleRate: 16000, Channels: 1},
+				LanguageCode:             "en-US",
+				InactivityWarningSeconds: tt.warningSeconds,
+			})
+			readUntil(t, conn, "status", "session_started")
+
+			sendSilence(t, conn, tt.silence)
+			warning := nextInactivityStatus(t, conn)
+			if warning["status"] != "inactivity_warning" || warning["secondsTillTimeout"] != tt.wantSeconds {
+				t.Fatalf("first status = %v, want an inactivity warning %vs before the timeout", warning, tt.wantSeconds)
+			}
+
+			if tt.ping {
+				if err := conn.WriteJSON(map[string]string{"type": "activity_ping"}); err != nil {
+					t.Fatal(err)
+				}
+				sendSilence(t, conn, tt.silence)
+			}
+			if next := nextInactivityStatus(t, conn); next["status"] != tt.wantNext {
+				t.Errorf("next status = %v, want %s", next, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestInactivityWarningWithoutAudio(t *testing.T) {
+	tests := []struct {
+		name     string
+		ping     bool // An activity ping is sent after the first warning
+		wantNext string
+	}{
+		{"warning then timeout", false, "silence_timeout"},
+		{"activity ping restarts the count", true, "inactivity_warning"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := silenceTimeoutUnit
+			silenceTimeoutUnit = 100 * time.Millisecond
+			t.Cleanup(func() { silenceTimeoutUnit = previous })
+			t.Setenv("SILENCE_TIMEOUT_SECONDS", "4")
+			newFakeSpeechPool(t)
+			conn := dialTestSession(t, ConfigMessage{
+				AudioFormat:              AudioFormat{Format: "WEBM_OPUS", SampleRate: 48000, Channels: 1},
+				LanguageCode:             "en-US",
+				InactivityWarningSeconds: 1,
+			})
+			readUntil(t, conn, "status", "session_started")
+
+			// Opus audio is not metered, so only the time without audio counts
+			warning := nextInactivityStatus(t, conn)
+			if warning["status"] != "inactivity_warning" || warning["secondsTillTimeout"] != float64(1) {
+				t.Fatalf("first status = %v, want an inactivity warning 1s before the timeout", warning)
+			}
+			if tt.ping {
+				if err := conn.WriteJSON(map[string]string{"type": "activity_ping"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if next := nextInactivityStatus(t, conn); next["status"] != tt.wantNext {
+				t.Errorf("next status = %v, want %s", next, tt.wantNext)
+			}
+		})
+	}
+}
+
+// useFakeGemini points the GCP_PROJECT_ID and GCP_LOCATION of new sessions at a fakeGemini answering with reply
+func useFakeGemini(t *testing.T, location string, reply func(model string) (int, string)) {
+	t.Helper()
+	t.Setenv("GCP_PROJECT_ID", "project")
+	t.Setenv("GCP_LOCATION", location)
+	client, _ := newFakeGeminiClient(t, reply)
+	genAIClientsMu.Lock()
+	genAIClients["project/"+location] = client
+	genAIClientsMu.Unlock()
+	t.Cleanup(func() {
+		genAIClientsMu.Lock()
+		delete(genAIClients, "project/"+location)
+		genAIClientsMu.Unlock()
+	})
+}
+
+// dialFinalSummary starts a session, transcribes one chunk of audio and sends an end prompt to get its final summary
+func dialFinalSummary(t *testing.T, config ConfigMessage) (*websocket.Conn, *Session) {
+	t.Helper()
+	fake := newFakeSpeechPool(t)
+	fake.setResults("we agreed on friday", "we agreed on friday")
+	conn := dialTestSession(t, config)
+	started := readUntil(t, conn, "status", "session_started")
+	session, ok := sessionRegistry.Get(started["sessionID"].(string))
+	if !ok {
+		t.Fatal("session not registered")
+	}
+	if err := conn.WriteMessage(websocket.BinaryMessage, make([]byte, 3200)); err != nil {
+		t.Fatal(err)
+	}
+	readUntil(t, conn, "transcription", "")
+	if err := conn.WriteJSON(EndPromptMessage{Type: "end_prompt", EndPrompt: "List the decisions.", Timestamp: Timestamp{Time: time.Now()}}); err != nil {
+		t.Fatal(err)
+	}
+	return conn, session
+}
+
+func TestStreamingSummary(t *testing.T) {
+	tests := []struct {
+		name       string
+		enabled    string
+		wantChunks []string // Text of the summary_chunk messages before the final one
+	}{
+		{"streamed", "true", []string{"The team ", "agreed on ", "Friday."}},
+		{"disabled", "false", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ENABLE_STREAMING_SUMMARY", tt.enabled)
+			useFakeGemini(t, "streaming-summary-"+tt.enabled, func(model string) (int, string) {
+				return http.StatusOK, "The team |agreed on |Friday."
+			})
+			conn, _ := dialFinalSummary(t, ConfigMessage{AudioFormat: AudioFormat{Format: "LINEAR16", SampleRate: 16000, Channels: 1}, LanguageCode: "en-US"})
+
+			var chunks []string
+			var final map[string]interface{}
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			for {
+				var message map[string]interface{}
+				if err := conn.ReadJSON(&message); err != nil {
+					t.Fatalf("waiting for the summary: %v", err)
+				}
+				if message["type"] == "summary" {
+					if message["text"] != "The team agreed on Friday." {
+						t.Errorf("summary = %v, want the complete text", message)
+					}
+					if final != nil && final["summaryId"] != message["summaryId"] {
+						t.Errorf("summary id %v, want %v of its chunks", message["summaryId"], final["summaryId"])
+					}
+					break
+				}
+				if message["type"] != "summary_chunk" {
+					continue
+				}
+				if final != nil {
+					t.Fatalf("chunk %v after the final chunk", message)
+				}
+				if message["final"] == true {
+					final = message
+					continue
+				}
+				chunks = append(chunks, message["text"].(string))
+			}
+			if !reflect.DeepEqual(chunks, tt.wantChunks) {
+				t.Errorf("chunks = %q, want %q", chunks, tt.wantChunks)
+			}
+			if streamed := tt.wantChunks != nil; (final != nil) != streamed {
+				t.Errorf("final chunk = %v, want one only when streaming", final)
+			} else if streamed && final["text"] != "The team agreed on Friday." {
+				t.Errorf("final chunk = %v, want the complete summary", final)
+			}
+		})
+	}
+}
+
+func TestModelFallbackStatus(t *testing.T) {
+	tests := []struct {
+		name          string
+		fallbackModel string
+		wantSummary   string
+		wantFallbacks int64
+	}{
+		{"quota exceeded", "gemini-2.5-flash", "gemini-2.5-flash summary", 1},
+		{"no fallback model", "", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GEMINI_ALLOWED_MODELS", "")
+			useFakeGemini(t, "model-fallback-"+tt.name, func(model string) (int, string) {
+				if model == "gemini-2.5-pro" {
+					return http.StatusTooManyRequests, "quota exceeded"
+				}
+				return http.StatusOK, model + " summary"
+			})
+			conn, session := dialFinalSummary(t, ConfigMessage{
+				AudioFormat:         AudioFormat{Format: "LINEAR16", SampleRate: 16000, Channels: 1},
+				LanguageCode:        "en-US",
+				GeminiModel:         "gemini-2.5-pro",
+				GeminiFallbackModel: tt.fallbackModel,
+			})
+
+			if tt.fallbackModel == "" {
+				waitFor(t, "the failed summary", func() bool {
+					for _, event := range session.EventLog() {
+						if event.EventType == "summary_error" {
+							return true
+						}
+					}
+					return false
+				})
+			} else {
+				status := readUntil(t, conn, "status", "model_fallback")
+				if status["requestedModel"] != "gemini-2.5-pro" || status["actualModel"] != tt.fallbackModel || status["reason"] != "quota_exceeded" {
+					t.Errorf("fallback status = %v, want gemini-2.5-pro replaced by %s for quota_exceeded", status, tt.fallbackModel)
+				}
+				if summary := readUntil(t, conn, "summary", ""); summary["text"] != tt.wantSummary {
+					t.Errorf("summary = %v, want %q", summary["text"], tt.wantSummary)
+				}
+			}
+			if got := session.Info().FallbackCount; got != tt.wantFallbacks {
+				t.Errorf("FallbackCount = %d, want %d", got, tt.wantFallbacks)
+			}
+		})
+	}
+}
+
+func TestSessionCloudAudit(t *testing.T) {
+	previousTrust := trustIAPHeaders
+	trustIAPHeaders = true
+	auditor, fake := newTestCloudAuditLogger(t, 0)
+	previous := cloudAuditLogger
+	cloudAuditLogger = auditor
+	t.Cleanup(func() { cloudAuditLogger, trustIAPHeaders = previous, previousTrust })
+
+	newFakeSpeechPool(t)
+	conn := dialWebSocket(t, http.Header{"X-Goog-Authenticated-User-Email": {"accounts.google.com:alice@example.com"}})
+	if err := conn.WriteJSON(ConfigMessage{AudioFormat: AudioFormat{Format: "LINEAR16", SampleRate: 16000, Channels: 1}, LanguageCode: "en-US"}); err != nil {
+		t.Fatal(err)
+	}
+	started := readUntil(t, conn, "status", "session_started")
+	if err := conn.WriteJSON(KeywordsMessage{Type: "keywords", Words: []string{"Kubernetes"}, Timestamp: Timestamp{Time: time.Now()}}); err != nil {
+		t.Fatal(err)
+	}
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+
+	// Sessions of earlier tests may still be closing; only this session's entries are checked
+	sessionPayloads := func() []map[string]interface{} {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		var payloads []map[string]interface{}
+		for _, payload := range fake.payloads {
+			if payload["resourceName"] == started["sessionID"] {
+				payloads = append(payloads, payload)
+			}
+		}
+		return payloads
+	}
+	want := []string{"live_transcription.session.start", "live_transcription.session.keywords.update", "live_transcription.session.stop"}
+	waitFor(t, "the session audit entries", func() bool { return len(sessionPayloads()) >= len(want) })
+	var methods []string
+	for _, payload := range sessionPayloads() {
+		methods = append(methods, payload["methodName"].(string))
+		if email := payload["authenticationInfo"].(map[string]interface{})["principalEmail"]; email != "alice@example.com" {
+			t.Errorf("%v: principalEmail = %v, want alice@example.com", payload["methodName"], email)
+		}
+		if ip := payload["requestMetadata"].(map[string]interface{})["callerIp"]; ip != "127.0.0.1" {
+			t.Errorf("%v: callerIp = %v, want 127.0.0.1", payload["methodName"], ip)
+		}
+	}
+	if !reflect.DeepEqual(methods, want) {
+		t.Errorf("audit methods = %v, want %v", methods, want)
+	}
+}
+
+func TestFocusTranscript(t *testing.T) {
+	tests := []struct {
+		name          string
+		transcribe    bool
+		lastSeconds   []int // One focus_transcript message each, sent while Gemini holds its replies
+		wantErrors    []string
+		wantSummaries int
+	}{
+		{"recent transcript", true, []int{300}, nil, 1},
+		{"invalid window", true, []int{0}, []string{"lastSeconds must be positive"}, 0},
+		{"no transcript in the window", false, []int{300}, []string{"No transcript in the requested window"}, 0},
+		{"busy", true, []int{300, 60}, []string{"Summary generation is busy, try again once the previous summaries are done"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MAX_CONCURRENT_SUMMARIES", "1")
+			hold := make(chan struct{})
+			useFakeGemini(t, "focus-"+tt.name, func(model string) (int, string) {
+				<-hold
+				return http.StatusOK, "focused summary"
+			})
+			fake := newFakeSpeechPool(t)
+			fake.setResults("we agreed on friday", "")
+			conn := dialTestSession(t, ConfigMessage{AudioFormat: AudioFormat{Format: "LINEAR16", SampleRate: 16000, Channels: 1}, LanguageCode: "en-US"})
+			started := readUntil(t, conn, "status", "session_started")
+			session, ok := sessionRegistry.Get(started["sessionID"].(string))
+			if !ok {
+				t.Fatal("session not registered")
+			}
+			if tt.transcribe {
+				if err := conn.WriteMessage(websocket.BinaryMessage, make([]byte, 3200)); err != nil {
+					t.Fatal(err)
+				}
+				readUntil(t, conn, "transcription", "")
+			}
+
+			for _, lastSeconds := range tt.lastSeconds {
+				if err := conn.WriteJSON(FocusTranscriptMessage{Type: "focus_transcript", LastSeconds: lastSeconds}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, want := range tt.wantErrors {
+				if status := readUntil(t, conn, "status", "focused_summary_error"); status["message"] != want {
+					t.Errorf("focused summary error = %v, want %q", status["message"], want)
+				}
+			}
+			close(hold)
+			for range tt.wantSummaries {
+				if summary := readUntil(t, conn, "focused_summary", ""); summary["text"] != "focused summary" || summary["lastSeconds"] != float64(tt.lastSeconds[0]) {
+					t.Errorf("focused summary = %v, want the summary of the last %d seconds", summary, tt.lastSeconds[0])
+				}
+			}
+			// A focused summary leaves the running summary alone
+			if got := session.Summary(); got != "" {
+				t.Errorf("running summary = %q, want it untouched", got)
+			}
+		})
+	}
+}